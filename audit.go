@@ -0,0 +1,119 @@
+package gorse
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// The actions we record in the audit log.
+const (
+	AuditFeedCreate     = "feed-create"
+	AuditFeedUpdate     = "feed-update"
+	AuditFeedDeactivate = "feed-deactivate"
+	AuditFeedDelete     = "feed-delete"
+	AuditFeedRestore    = "feed-restore"
+	AuditFeedRetention  = "feed-retention"
+	AuditFeedArchive    = "feed-archive"
+	AuditFeedFrequency  = "feed-frequency"
+	AuditFeedFullText   = "feed-full-text"
+	AuditUserCreate     = "user-create"
+	AuditUserPassword   = "user-password"
+	AuditItemStates     = "item-states"
+)
+
+// AuditEntry is an action in the audit log.
+type AuditEntry struct {
+	ID int64
+
+	// ActorID is the user who took the action. It is 0 if we took it ourselves
+	// or the user no longer exists.
+	ActorID int
+
+	// ActorEmail is the actor's email. It is blank if there is no actor.
+	ActorEmail string
+
+	// Action is one of the Audit constants.
+	Action string
+
+	// Details describes what the action was done to.
+	Details string
+
+	Time time.Time
+}
+
+// actorKey is the context key for the user taking actions.
+type actorKey struct{}
+
+// WithActor says the user is the one taking the actions done with the
+// context. We record them in the audit log.
+func WithActor(ctx context.Context, userID int) context.Context {
+	return context.WithValue(ctx, actorKey{}, userID)
+}
+
+// actor retrieves the user WithActor set on the context. It is 0 if there is
+// none.
+func actor(ctx context.Context) int {
+	userID, _ := ctx.Value(actorKey{}).(int)
+	return userID
+}
+
+// RecordAudit records the action in the audit log. The actor is the user set
+// on the context with WithActor, if any.
+func RecordAudit(ctx context.Context, db Querier, action,
+	details string) error {
+	query := `
+INSERT INTO rss_audit_log (actor_id, action, details)
+VALUES ($1, $2, $3)
+`
+
+	var actorID *int
+	if userID := actor(ctx); userID != 0 {
+		actorID = &userID
+	}
+
+	if _, err := db.ExecContext(ctx, query, actorID, action,
+		details); err != nil {
+		return fmt.Errorf("unable to record %s in the audit log: %s", action, err)
+	}
+
+	return nil
+}
+
+// AuditLog retrieves the most recent actions in the audit log, newest first.
+func AuditLog(ctx context.Context, db Querier, limit int) ([]AuditEntry,
+	error) {
+	query := `
+SELECT ral.id, ral.actor_id, COALESCE(ru.email, ''), ral.action, ral.details,
+ral.create_time
+FROM rss_audit_log ral
+LEFT JOIN rss_user ru ON ru.id = ral.actor_id
+ORDER BY ral.create_time DESC, ral.id DESC
+LIMIT $1
+`
+
+	rows, err := db.QueryContext(ctx, query, limit)
+	if err != nil {
+		return nil, fmt.Errorf("unable to query audit log: %s", err)
+	}
+
+	var entries []AuditEntry
+	for rows.Next() {
+		var entry AuditEntry
+		var actorID sql.NullInt64
+		if err := rows.Scan(&entry.ID, &actorID, &entry.ActorEmail, &entry.Action,
+			&entry.Details, &entry.Time); err != nil {
+			_ = rows.Close()
+			return nil, fmt.Errorf("failed to scan row: %s", err)
+		}
+		entry.ActorID = int(actorID.Int64)
+		entries = append(entries, entry)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failure fetching rows: %s", err)
+	}
+
+	return entries, nil
+}
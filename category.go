@@ -0,0 +1,116 @@
+package gorse
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// maxItemCategories is the most categories we keep for an item. Some feeds
+// tag items with dozens of keywords, which are no use for finding them.
+const maxItemCategories = 20
+
+// xmlCategory is an RSS or Atom category element. RSS gives the category as
+// the element's text and Atom as its term.
+type xmlCategory struct {
+	Term string `xml:"term,attr"`
+	Text string `xml:",chardata"`
+}
+
+// categories gives the item's categories.
+func (e itemElement) categories() []string {
+	var names []string
+	for _, c := range e.Categories {
+		name := c.Term
+		if strings.TrimSpace(name) == "" {
+			name = c.Text
+		}
+		names = append(names, name)
+	}
+	return cleanCategories(names)
+}
+
+// cleanCategories trims the categories and drops blank ones and repeats. We
+// keep at most maxItemCategories.
+func cleanCategories(names []string) []string {
+	var categories []string
+	seen := map[string]struct{}{}
+	for _, name := range names {
+		name = strings.Join(strings.Fields(name), " ")
+		if name == "" {
+			continue
+		}
+		if _, ok := seen[name]; ok {
+			continue
+		}
+		seen[name] = struct{}{}
+		categories = append(categories, name)
+		if len(categories) == maxItemCategories {
+			break
+		}
+	}
+	return categories
+}
+
+// addItemCategories records the item's categories.
+func addItemCategories(ctx context.Context, db Querier, itemID int64,
+	categories []string) error {
+	query := `
+INSERT INTO rss_item_category (item_id, category)
+VALUES ($1, $2)
+`
+
+	for _, category := range categories {
+		if _, err := db.ExecContext(ctx, query, itemID, category); err != nil {
+			return fmt.Errorf("failed to add category [%s] of item %d: %s",
+				category, itemID, err)
+		}
+	}
+
+	return nil
+}
+
+// ItemCategories retrieves the categories of the items, by item ID. Items
+// without any aren't included.
+func ItemCategories(ctx context.Context, db Querier,
+	itemIDs []int64) (map[int64][]string, error) {
+	categories := map[int64][]string{}
+	if len(itemIDs) == 0 {
+		return categories, nil
+	}
+
+	placeholders := make([]string, len(itemIDs))
+	params := make([]interface{}, len(itemIDs))
+	for i, id := range itemIDs {
+		placeholders[i] = fmt.Sprintf("$%d", i+1)
+		params[i] = id
+	}
+
+	query := `
+SELECT item_id, category
+FROM rss_item_category
+WHERE item_id IN (` + strings.Join(placeholders, ", ") + `)
+ORDER BY category
+`
+
+	rows, err := db.QueryContext(ctx, query, params...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to query categories: %s", err)
+	}
+
+	for rows.Next() {
+		var id int64
+		var category string
+		if err := rows.Scan(&id, &category); err != nil {
+			_ = rows.Close()
+			return nil, fmt.Errorf("failed to scan row: %s", err)
+		}
+		categories[id] = append(categories[id], category)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failure fetching rows: %s", err)
+	}
+
+	return categories, nil
+}
@@ -0,0 +1,92 @@
+package gorse
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseFeedCategories(t *testing.T) {
+	tests := []struct {
+		Name    string
+		Payload string
+		Want    [][]string
+	}{
+		{
+			Name: "RSS",
+			Payload: `<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0">
+<channel>
+<title>Blog</title>
+<link>https://example.com/</link>
+<description>Blog</description>
+<item>
+<title>One</title>
+<link>https://example.com/1</link>
+<category>Go</category>
+<category domain="https://example.com/tags"> Databases
+	and SQL </category>
+<category>Go</category>
+<category></category>
+</item>
+<item>
+<title>Two</title>
+<link>https://example.com/2</link>
+</item>
+</channel>
+</rss>`,
+			Want: [][]string{{"Go", "Databases and SQL"}, nil},
+		},
+		{
+			Name: "Atom",
+			Payload: `<?xml version="1.0" encoding="UTF-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom">
+<title>Blog</title>
+<updated>2020-03-01T12:00:00Z</updated>
+<entry>
+<title>One</title>
+<link href="https://example.com/1"/>
+<category term="go" label="Go"/>
+<category term="sql"/>
+<updated>2020-03-01T12:00:00Z</updated>
+</entry>
+</feed>`,
+			Want: [][]string{{"go", "sql"}},
+		},
+		{
+			Name: "JSON Feed",
+			Payload: `{
+	"version": "https://jsonfeed.org/version/1.1",
+	"title": "Blog",
+	"items": [
+		{
+			"id": "1",
+			"url": "https://example.com/1",
+			"content_text": "One",
+			"tags": ["Go", " ", "Go", "SQL"]
+		}
+	]
+}`,
+			Want: [][]string{{"Go", "SQL"}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			feed, err := ParseFeed([]byte(test.Payload), ParseOptions{
+				URL: "https://example.com/feed",
+			})
+			if err != nil {
+				t.Fatalf("ParseFeed() = error %s", err)
+			}
+			if len(feed.Items) != len(test.Want) {
+				t.Fatalf("got %d items, wanted %d", len(feed.Items), len(test.Want))
+			}
+			for i, item := range feed.Items {
+				if !reflect.DeepEqual(item.Categories, test.Want[i]) {
+					t.Errorf("item %d categories = %q, wanted %q", i+1,
+						item.Categories, test.Want[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/sessions"
+	"github.com/horgh/gorse"
+	"github.com/horgh/gorse/internal/version"
+)
+
+// handlerAbout reports which build we are. Only admins may see it.
+//
+// It implements the type RequestHandlerFunc.
+func handlerAbout(rw http.ResponseWriter, request *http.Request,
+	settings *Config, store gorse.Store, session *sessions.Session) {
+	if _, ok := requireAdmin(rw, request, settings, store, session); !ok {
+		return
+	}
+
+	info := version.Get()
+	rw.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if _, err := fmt.Fprintf(rw, "gorse %s\nCommit: %s\nBuilt: %s\nGo: %s\n",
+		info.Version, info.Commit, info.BuildDate, info.GoVersion); err != nil {
+		logf(request, "Unable to write about page: %s", err)
+	}
+}
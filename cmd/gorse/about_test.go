@@ -0,0 +1,56 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/horgh/gorse/internal/gorsetest"
+	"github.com/horgh/gorse/internal/version"
+)
+
+func TestHandlerAboutIntegration(t *testing.T) {
+	for _, dbType := range gorsetest.Types {
+		t.Run(dbType, func(t *testing.T) {
+			testHandlerAboutIntegration(t, dbType)
+		})
+	}
+}
+
+func testHandlerAboutIntegration(t *testing.T, dbType string) {
+	store, _ := gorsetest.Store(t, dbType)
+
+	loaded := gorsetest.Load(t, store, gorsetest.Fixture{
+		Users: []gorsetest.User{
+			{Email: "admin@example.com", Password: "password", Admin: true},
+			{Email: "user@example.com", Password: "password"},
+		},
+	})
+
+	version.Commit = "abc123"
+	defer func() {
+		version.Commit = ""
+	}()
+
+	get := func(userID int) *httptest.ResponseRecorder {
+		rw := httptest.NewRecorder()
+		request := httptest.NewRequest(http.MethodGet, "/about", nil)
+		handlerAbout(rw, request, &Config{}, store,
+			loggedInSession(t, request, userID))
+		return rw
+	}
+
+	rw := get(loaded.Users["admin@example.com"])
+	if rw.Code != http.StatusOK ||
+		!strings.Contains(rw.Body.String(), "Commit: abc123") {
+		t.Errorf("/about = status %d: %q, wanted the commit", rw.Code,
+			rw.Body.String())
+	}
+
+	rw = get(loaded.Users["user@example.com"])
+	if rw.Code != http.StatusForbidden {
+		t.Errorf("/about as a user = status %d, wanted %d", rw.Code,
+			http.StatusForbidden)
+	}
+}
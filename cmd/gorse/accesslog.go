@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Access log formats. JSON has a line per request with all we know about it.
+// Common is the Common Log Format that web servers use, for existing tools.
+const (
+	accessLogJSON   = "json"
+	accessLogCommon = "common"
+)
+
+// accessLog records a line for each request we serve, separate from the
+// application log.
+type accessLog struct {
+	w      io.Writer
+	common bool
+}
+
+// accessEntry is what we record about a request.
+type accessEntry struct {
+	Time       time.Time `json:"time"`
+	RequestID  string    `json:"request_id"`
+	Remote     string    `json:"remote"`
+	Method     string    `json:"method"`
+	URI        string    `json:"uri"`
+	Proto      string    `json:"proto"`
+	Status     int       `json:"status"`
+	Bytes      int64     `json:"bytes"`
+	DurationMS float64   `json:"duration_ms"`
+
+	// UserID is 0 if we don't know whose request it was.
+	UserID int `json:"user_id,omitempty"`
+}
+
+// record writes a line for the request. We write each line at once so that
+// lines from concurrent requests don't mix.
+func (a *accessLog) record(entry accessEntry) {
+	var line []byte
+	if a.common {
+		line = []byte(commonLogLine(entry))
+	} else {
+		buf, err := json.Marshal(entry)
+		if err != nil {
+			log.Printf("Unable to encode access log entry: %s", err)
+			return
+		}
+		line = append(buf, '\n')
+	}
+
+	if _, err := a.w.Write(line); err != nil {
+		log.Printf("Unable to write access log: %s", err)
+	}
+}
+
+// commonLogLine formats the entry in the Common Log Format:
+//
+//	host ident authuser [date] "request" status bytes
+func commonLogLine(entry accessEntry) string {
+	host, _, err := net.SplitHostPort(entry.Remote)
+	if err != nil || host == "" {
+		host = entry.Remote
+	}
+	if host == "" {
+		host = "-"
+	}
+
+	user := "-"
+	if entry.UserID != 0 {
+		user = strconv.Itoa(entry.UserID)
+	}
+
+	bytes := "-"
+	if entry.Bytes > 0 {
+		bytes = strconv.FormatInt(entry.Bytes, 10)
+	}
+
+	return fmt.Sprintf("%s - %s [%s] %s %d %s\n", host, user,
+		entry.Time.Format("02/Jan/2006:15:04:05 -0700"),
+		strconv.Quote(entry.Method+" "+entry.URI+" "+entry.Proto), entry.Status,
+		bytes)
+}
+
+// setRequestUser notes whose request it is for the access log.
+func setRequestUser(request *http.Request, userID int) {
+	if l, ok := request.Context().Value(requestLogKey{}).(*requestLog); ok {
+		l.userID = userID
+	}
+}
+
+// requestUser returns whose request it is, or 0 if we don't know.
+func requestUser(request *http.Request) int {
+	if l, ok := request.Context().Value(requestLogKey{}).(*requestLog); ok {
+		return l.userID
+	}
+	return 0
+}
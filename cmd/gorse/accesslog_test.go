@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/sessions"
+)
+
+func TestCommonLogLine(t *testing.T) {
+	entry := accessEntry{
+		Time:   time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC),
+		Remote: "192.0.2.1:5678",
+		Method: "GET",
+		URI:    "/gorse/?page=2",
+		Proto:  "HTTP/1.1",
+		Status: 200,
+		Bytes:  1234,
+		UserID: 1,
+	}
+
+	want := `192.0.2.1 - 1 [02/Jan/2020:03:04:05 +0000] "GET /gorse/?page=2 ` +
+		`HTTP/1.1" 200 1234` + "\n"
+	if got := commonLogLine(entry); got != want {
+		t.Errorf("commonLogLine() = %q, wanted %q", got, want)
+	}
+
+	entry.UserID = 0
+	entry.Bytes = 0
+	want = `192.0.2.1 - - [02/Jan/2020:03:04:05 +0000] "GET /gorse/?page=2 ` +
+		`HTTP/1.1" 200 -` + "\n"
+	if got := commonLogLine(entry); got != want {
+		t.Errorf("commonLogLine() = %q, wanted %q", got, want)
+	}
+}
+
+func TestAccessLogJSON(t *testing.T) {
+	var buf bytes.Buffer
+	handler := HTTPHandler{
+		settings:     &Config{SessionName: "gorse", URIPrefix: "/gorse"},
+		sessionStore: sessions.NewCookieStore([]byte(strings.Repeat("k", 32))),
+		accessLog:    &accessLog{w: &buf},
+	}
+
+	request := httptest.NewRequest(http.MethodGet, "/gorse/missing?x=1", nil)
+	request.Header.Set(requestIDHeader, "abc-123")
+	rw := httptest.NewRecorder()
+	handler.ServeHTTP(rw, request)
+
+	var entry accessEntry
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("access log is not JSON: %s: %q", err, buf.String())
+	}
+	if entry.RequestID != "abc-123" || entry.Method != http.MethodGet ||
+		entry.URI != "/gorse/missing?x=1" || entry.Status != http.StatusNotFound ||
+		entry.Bytes != int64(rw.Body.Len()) || entry.UserID != 0 {
+		t.Errorf("access log entry = %+v, wanted it to describe the request",
+			entry)
+	}
+	if strings.Count(buf.String(), "\n") != 1 {
+		t.Errorf("access log = %q, wanted one line", buf.String())
+	}
+}
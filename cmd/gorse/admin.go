@@ -0,0 +1,106 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gorilla/sessions"
+	"github.com/horgh/gorse"
+)
+
+// auditLogSize is how many of the most recent actions we show from the audit
+// log.
+const auditLogSize = 200
+
+// requireAdmin checks that the request is from an admin. If it's not, we
+// respond saying so and return false. Otherwise we return the admin.
+func requireAdmin(rw http.ResponseWriter, request *http.Request,
+	settings *Config, store gorse.Store, session *sessions.Session) (*gorse.User,
+	bool) {
+	userID, ok := sessionUser(rw, request, settings, session)
+	if !ok {
+		return nil, false
+	}
+
+	user, err := store.GetUser(request.Context(), userID)
+	if err != nil {
+		logf(request, "Unable to look up user: %s", err)
+		send500Error(rw, "Unable to look up user")
+		return nil, false
+	}
+	if !user.Admin {
+		rw.WriteHeader(http.StatusForbidden)
+		_, _ = rw.Write([]byte("<h1>Forbidden</h1>"))
+		return nil, false
+	}
+
+	return user, true
+}
+
+// handlerAuditLog shows the most recent actions in the audit log. Only admins
+// may see it.
+//
+// It implements the type RequestHandlerFunc.
+func handlerAuditLog(rw http.ResponseWriter, request *http.Request,
+	settings *Config, store gorse.Store, session *sessions.Session) {
+	user, ok := requireAdmin(rw, request, settings, store, session)
+	if !ok {
+		return
+	}
+
+	entries, err := store.AuditLog(request.Context(), auditLogSize)
+	if err != nil {
+		logf(request, "Unable to retrieve audit log: %s", err)
+		send500Error(rw, "Unable to retrieve audit log")
+		return
+	}
+
+	location, err := time.LoadLocation(settings.DisplayTimeZone)
+	if err != nil {
+		logf(request, "Failed to load time zone location [%s]: %s",
+			settings.DisplayTimeZone, err)
+		send500Error(rw, "Unable to load timezone information")
+		return
+	}
+
+	locale := userLocale(request, user)
+
+	type HTMLEntry struct {
+		Time    string
+		Actor   string
+		Action  string
+		Details string
+	}
+
+	var htmlEntries []HTMLEntry
+	for _, entry := range entries {
+		actor := entry.ActorEmail
+		if actor == "" {
+			actor = "gorse"
+		}
+		htmlEntries = append(htmlEntries, HTMLEntry{
+			Time:    locale.FormatDate(entry.Time.In(location)),
+			Actor:   actor,
+			Action:  entry.Action,
+			Details: entry.Details,
+		})
+	}
+
+	type AuditLogPage struct {
+		Entries   []HTMLEntry
+		Path      string
+		UserID    int
+		ReadState gorse.ReadState
+	}
+
+	if err := renderPage(settings, rw, locale, "_audit_log", AuditLogPage{
+		Entries:   htmlEntries,
+		Path:      settings.URIPrefix,
+		UserID:    user.ID,
+		ReadState: gorse.Unread,
+	}); err != nil {
+		logf(request, "Failure rendering page: %s", err)
+		send500Error(rw, "Failed to render page")
+		return
+	}
+}
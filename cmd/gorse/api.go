@@ -0,0 +1,210 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/sessions"
+	"github.com/horgh/gorse"
+)
+
+// The API lets other clients and scripts read items and set their states. Its
+// paths start with /api/v1 so that we can change it later without breaking
+// them.
+//
+// Clients log in with the user's email and password using HTTP Basic
+// authentication, as the browser extension does. See extensionUser. We
+// respond with JSON, including for errors:
+//
+//	{"error": "Unknown item"}
+
+// apiDefaultLimit is how many items we list at a time unless asked for a
+// different number.
+const apiDefaultLimit = pageSize
+
+// apiMaxLimit is the most items we list at a time.
+const apiMaxLimit = 500
+
+// apiItem is an item as the API describes it.
+type apiItem struct {
+	ID              int64     `json:"id"`
+	FeedID          int64     `json:"feed_id"`
+	FeedName        string    `json:"feed_name"`
+	Title           string    `json:"title"`
+	Link            string    `json:"link"`
+	PublicationDate time.Time `json:"publication_date"`
+	Description     string    `json:"description"`
+	State           string    `json:"state"`
+	Note            string    `json:"note"`
+}
+
+// newAPIItem describes the item for the API.
+func newAPIItem(item gorse.UserItem) apiItem {
+	return apiItem{
+		ID:              item.ID,
+		FeedID:          item.RSSFeedID,
+		FeedName:        item.FeedName,
+		Title:           sanitiseItemText(item.Title),
+		Link:            item.Link,
+		PublicationDate: item.PublicationDate,
+		Description: string(itemDescription(gorse.DisplayFull,
+			item.Description)),
+		State: item.ReadState.String(),
+		Note:  item.Note,
+	}
+}
+
+// handlerAPIItems lists the user's items, newest first:
+//
+//	{"items": [{"id": 3, "feed_id": 1, "feed_name": "Example",
+//	  "title": "...", "link": "...", "publication_date": "...",
+//	  "description": "...", "state": "unread", "note": ""}],
+//	 "more": true}
+//
+// more says whether there are more items after these.
+//
+// It implements the type RequestHandlerFunc.
+//
+// read-state is unread (the default), read-later, read, or all. Like the list
+// of unread items, we leave out unread items that are old or muted. feed-id
+// limits us to one feed. limit is how many items to list. To list the next
+// items, after is the ID of the last item listed. Items arriving or being read
+// in the meantime don't make us skip any.
+func handlerAPIItems(rw http.ResponseWriter, request *http.Request,
+	settings *Config, store gorse.Store, session *sessions.Session) {
+	user, ok := extensionUser(rw, request, store)
+	if !ok {
+		return
+	}
+
+	requestValues := request.URL.Query()
+
+	filter := gorse.ItemFilter{
+		UserID:     user.ID,
+		Subscribed: true,
+		Limit:      apiDefaultLimit,
+	}
+
+	switch state := requestValues.Get("read-state"); state {
+	case "all":
+	case "":
+		unread := gorse.Unread
+		filter.State = &unread
+	default:
+		readState, err := gorse.ParseReadState(state)
+		if err != nil {
+			logf(request, "Bad read state: %s", state)
+			sendJSONError(rw, http.StatusBadRequest, "Bad read state")
+			return
+		}
+		filter.State = &readState
+	}
+
+	if filter.State != nil && *filter.State == gorse.Unread {
+		filter.Since = unreadCutoff()
+		if err := hideMuted(request.Context(), store, &filter); err != nil {
+			logf(request, "Unable to look up muted keywords: %s", err)
+			sendJSONError(rw, http.StatusInternalServerError,
+				"Unable to look up muted keywords")
+			return
+		}
+	}
+
+	if feedIDStr := requestValues.Get("feed-id"); feedIDStr != "" {
+		feedID, err := strconv.ParseInt(feedIDStr, 10, 64)
+		if err != nil || feedID <= 0 {
+			logf(request, "Bad feed ID: %s", feedIDStr)
+			sendJSONError(rw, http.StatusBadRequest, "Bad feed ID")
+			return
+		}
+		filter.FeedID = feedID
+	}
+
+	if limitStr := requestValues.Get("limit"); limitStr != "" {
+		limit, err := strconv.Atoi(limitStr)
+		if err != nil || limit < 1 || limit > apiMaxLimit {
+			logf(request, "Bad limit: %s", limitStr)
+			sendJSONError(rw, http.StatusBadRequest, "Bad limit")
+			return
+		}
+		filter.Limit = limit
+	}
+
+	if afterStr := requestValues.Get("after"); afterStr != "" {
+		afterID, err := strconv.ParseInt(afterStr, 10, 64)
+		if err != nil {
+			logf(request, "Bad item ID: %s: %s", afterStr, err)
+			sendJSONError(rw, http.StatusBadRequest, "Bad item ID")
+			return
+		}
+		after, err := store.GetItem(request.Context(), afterID, user.ID)
+		if err != nil {
+			logf(request, "Unable to look up item %d: %s", afterID, err)
+			sendJSONError(rw, http.StatusBadRequest, "Unknown item")
+			return
+		}
+		cursor := after.Cursor()
+		filter.After = &cursor
+	}
+
+	// One more than we list tells us whether there are more.
+	filter.Limit++
+	items, err := store.FindItems(request.Context(), filter)
+	if err != nil {
+		logf(request, "Unable to retrieve items: %s", err)
+		sendJSONError(rw, http.StatusInternalServerError,
+			"Unable to retrieve items")
+		return
+	}
+	more := len(items) == filter.Limit
+	if more {
+		items = items[:len(items)-1]
+	}
+
+	apiItems := []apiItem{}
+	for _, item := range items {
+		apiItems = append(apiItems, newAPIItem(item))
+	}
+
+	sendJSON(request, rw, http.StatusOK, struct {
+		Items []apiItem `json:"items"`
+		More  bool      `json:"more"`
+	}{apiItems, more})
+}
+
+// handlerAPIItemState sets the state of the item in the path,
+// /api/v1/items/<id>/state, to the state parameter. This is unread, read, or
+// read-later. We respond with the item:
+//
+//	{"id": 3, "feed_id": 1, ..., "state": "read", "note": ""}
+//
+// It implements the type RequestHandlerFunc.
+func handlerAPIItemState(rw http.ResponseWriter, request *http.Request,
+	settings *Config, store gorse.Store, session *sessions.Session) {
+	user, ok := extensionUser(rw, request, store)
+	if !ok {
+		return
+	}
+
+	if err := request.ParseForm(); err != nil {
+		logf(request, "Failed to parse form: %s", err)
+		if bodyTooLarge(err) {
+			sendJSONError(rw, http.StatusRequestEntityTooLarge,
+				tooLargeError(settings.maxFormBytes()))
+			return
+		}
+		sendJSONError(rw, http.StatusBadRequest, "Failed to parse request")
+		return
+	}
+
+	stateStr := request.PostForm.Get("state")
+	state, err := gorse.ParseReadState(stateStr)
+	if err != nil {
+		logf(request, "Bad read state: %s", stateStr)
+		sendJSONError(rw, http.StatusBadRequest, "Bad read state")
+		return
+	}
+
+	setItemStateJSON(rw, request, store, user.ID, state)
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/sessions"
+	"github.com/horgh/gorse"
+	"github.com/horgh/gorse/internal/gorsetest"
+	"github.com/horgh/rss"
+)
+
+func TestHandlerAPIIntegration(t *testing.T) {
+	for _, dbType := range gorsetest.Types {
+		t.Run(dbType, func(t *testing.T) {
+			testHandlerAPIIntegration(t, dbType)
+		})
+	}
+}
+
+func testHandlerAPIIntegration(t *testing.T, dbType string) {
+	ctx := context.Background()
+	store, _ := gorsetest.Store(t, dbType)
+
+	defer func(l *loginLimiter) { loginLimits = l }(loginLimits)
+	loginLimits = newLoginLimiter()
+
+	now := time.Now()
+	loaded := gorsetest.Load(t, store, gorsetest.Fixture{
+		Users: []gorsetest.User{
+			{Email: "user@example.com", Password: "password"},
+		},
+		Feeds: []gorsetest.Feed{
+			{
+				DBFeed: gorse.DBFeed{
+					Name:                   "Example",
+					URI:                    "https://example.com/feed",
+					UpdateFrequencySeconds: 3600,
+					Active:                 true,
+				},
+				Items: []rss.Item{
+					{
+						Title:   "One",
+						Link:    "https://example.com/1",
+						PubDate: now.Add(-time.Hour),
+					},
+					{
+						Title:   "Two",
+						Link:    "https://example.com/2",
+						PubDate: now,
+					},
+				},
+				Subscribers: []string{"user@example.com"},
+			},
+		},
+	})
+	userID := loaded.Users["user@example.com"]
+	one := loaded.Items["https://example.com/1"]
+	two := loaded.Items["https://example.com/2"]
+
+	settings := &Config{}
+	sessionStore := sessions.NewCookieStore([]byte(strings.Repeat("k", 32)))
+
+	call := func(handler func(http.ResponseWriter, *http.Request, *Config,
+		gorse.Store, *sessions.Session), method, path string, form url.Values,
+		password string, v interface{}) int {
+		request := httptest.NewRequest(method, path,
+			strings.NewReader(form.Encode()))
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		request.SetBasicAuth("user@example.com", password)
+		session, err := sessionStore.New(request, "gorse")
+		if err != nil {
+			t.Fatalf("creating session: %s", err)
+		}
+
+		rw := httptest.NewRecorder()
+		handler(rw, request, settings, store, session)
+
+		if err := json.Unmarshal(rw.Body.Bytes(), v); err != nil {
+			t.Fatalf("%s %s responded %q, wanted JSON: %s", method, path,
+				rw.Body.String(), err)
+		}
+		return rw.Code
+	}
+
+	type itemsResponse struct {
+		Items []apiItem `json:"items"`
+		More  bool      `json:"more"`
+		Error string    `json:"error"`
+	}
+
+	var response itemsResponse
+	if code := call(handlerAPIItems, http.MethodGet, "/api/v1/items?limit=1",
+		nil, "password", &response); code != http.StatusOK {
+		t.Fatalf("GET items = status %d %+v, wanted %d", code, response,
+			http.StatusOK)
+	}
+	if len(response.Items) != 1 || response.Items[0].ID != two ||
+		response.Items[0].FeedName != "Example" ||
+		response.Items[0].State != "unread" || !response.More {
+		t.Errorf("GET items = %+v, wanted Two and more", response)
+	}
+
+	response = itemsResponse{}
+	if code := call(handlerAPIItems, http.MethodGet,
+		fmt.Sprintf("/api/v1/items?limit=1&after=%d", two), nil, "password",
+		&response); code != http.StatusOK {
+		t.Fatalf("GET items after = status %d %+v, wanted %d", code, response,
+			http.StatusOK)
+	}
+	if len(response.Items) != 1 || response.Items[0].ID != one ||
+		response.More {
+		t.Errorf("GET items after = %+v, wanted One and no more", response)
+	}
+
+	var item apiItem
+	if code := call(handlerAPIItemState, http.MethodPost,
+		fmt.Sprintf("/api/v1/items/%d/state", one),
+		url.Values{"state": {"read"}}, "password", &item); code != http.StatusOK {
+		t.Fatalf("POST state = status %d %+v, wanted %d", code, item,
+			http.StatusOK)
+	}
+	if item.ID != one || item.State != "read" {
+		t.Errorf("POST state = %+v, wanted One read", item)
+	}
+	if got, err := store.GetItem(ctx, one, userID); err != nil ||
+		got.ReadState != gorse.Read {
+		t.Errorf("GetItem() = %+v, %v, wanted it read", got, err)
+	}
+
+	response = itemsResponse{}
+	if code := call(handlerAPIItems, http.MethodGet,
+		"/api/v1/items?read-state=read", nil, "password",
+		&response); code != http.StatusOK || len(response.Items) != 1 ||
+		response.Items[0].ID != one {
+		t.Errorf("GET read items = status %d %+v, wanted One", code, response)
+	}
+
+	for _, test := range []struct {
+		path  string
+		state string
+		want  int
+	}{
+		{fmt.Sprintf("/api/v1/items/%d/state", two), "archived",
+			http.StatusBadRequest},
+		{"/api/v1/items/999999/state", "read", http.StatusNotFound},
+	} {
+		var e itemsResponse
+		if code := call(handlerAPIItemState, http.MethodPost, test.path,
+			url.Values{"state": {test.state}}, "password",
+			&e); code != test.want || e.Error == "" {
+			t.Errorf("POST %s state %s = status %d %+v, wanted %d", test.path,
+				test.state, code, e, test.want)
+		}
+	}
+
+	for _, query := range []string{"read-state=saved", "limit=0",
+		fmt.Sprintf("limit=%d", apiMaxLimit+1), "after=x", "feed-id=-1"} {
+		var e itemsResponse
+		if code := call(handlerAPIItems, http.MethodGet, "/api/v1/items?"+query,
+			nil, "password", &e); code != http.StatusBadRequest {
+			t.Errorf("GET items?%s = status %d %+v, wanted %d", query, code, e,
+				http.StatusBadRequest)
+		}
+	}
+
+	var e itemsResponse
+	if code := call(handlerAPIItems, http.MethodGet, "/api/v1/items", nil,
+		"wrong", &e); code != http.StatusUnauthorized {
+		t.Errorf("GET items with the wrong password = status %d, wanted %d",
+			code, http.StatusUnauthorized)
+	}
+}
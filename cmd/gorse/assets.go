@@ -0,0 +1,108 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// immutableCacheControl is the Cache-Control for a versioned asset URL. Its
+// content can't change without its URL changing, so browsers may keep it as
+// long as they like without checking with us.
+const immutableCacheControl = "public, max-age=31536000, immutable"
+
+// assetVersion is what we know about a static file's content.
+type assetVersion struct {
+	modTime time.Time
+	size    int64
+	hash    string
+}
+
+// assetVersions caches static files' hashes by path. We hash a file again only
+// if it changes.
+var assetVersions = struct {
+	mu       sync.Mutex
+	versions map[string]assetVersion
+}{versions: map[string]assetVersion{}}
+
+// assetHash returns a hash of the content of the static file named name under
+// webRoot.
+func assetHash(webRoot, name string) (string, error) {
+	path := filepath.Join(webRoot, filepath.FromSlash(name))
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+
+	assetVersions.mu.Lock()
+	defer assetVersions.mu.Unlock()
+
+	if v, ok := assetVersions.versions[path]; ok &&
+		v.modTime.Equal(fi.ModTime()) && v.size == fi.Size() {
+		return v.hash, nil
+	}
+
+	fh, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer fh.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, fh); err != nil {
+		return "", fmt.Errorf("unable to read %s: %s", path, err)
+	}
+	hash := hex.EncodeToString(h.Sum(nil))[:16]
+
+	assetVersions.versions[path] = assetVersion{
+		modTime: fi.ModTime(),
+		size:    fi.Size(),
+		hash:    hash,
+	}
+	return hash, nil
+}
+
+// assetURL gives the path under /static to use for the static file. It
+// includes a hash of the file's content so the URL changes when the file does.
+// This lets browsers cache it indefinitely.
+//
+// If we can't read the file, we give the path without the hash. The request
+// for it will fail anyway.
+func assetURL(webRoot, name string) string {
+	hash, err := assetHash(webRoot, name)
+	if err != nil {
+		return name
+	}
+	return name + "?v=" + hash
+}
+
+// setStaticCacheControl sets how long browsers may cache the static file
+// requested. If the request is for the current version of the file, it's
+// forever. Otherwise it's StaticMaxAgeSeconds, after which they must check
+// whether it changed.
+func setStaticCacheControl(rw http.ResponseWriter, request *http.Request,
+	settings *Config) {
+	name := strings.TrimPrefix(request.URL.Path, "/static/")
+	if v := request.URL.Query().Get("v"); v != "" {
+		if hash, err := assetHash(settings.WebRoot, name); err == nil &&
+			hash == v {
+			rw.Header().Set("Cache-Control", immutableCacheControl)
+			return
+		}
+	}
+
+	if settings.StaticMaxAgeSeconds > 0 {
+		rw.Header().Set("Cache-Control",
+			fmt.Sprintf("public, max-age=%d", settings.StaticMaxAgeSeconds))
+		return
+	}
+	rw.Header().Set("Cache-Control", "no-cache")
+}
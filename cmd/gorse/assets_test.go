@@ -0,0 +1,97 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAssetURL(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "gorse.css")
+	if err := os.WriteFile(path, []byte("a {}"), 0644); err != nil {
+		t.Fatalf("unable to write file: %s", err)
+	}
+
+	url := assetURL(dir, "gorse.css")
+	if !strings.HasPrefix(url, "gorse.css?v=") {
+		t.Fatalf("assetURL() = %s, wanted gorse.css?v=<hash>", url)
+	}
+	if url2 := assetURL(dir, "gorse.css"); url2 != url {
+		t.Errorf("assetURL() = %s then %s, wanted it to stay the same", url, url2)
+	}
+
+	// Changing the file changes its URL.
+	if err := os.WriteFile(path, []byte("a { color: red; }"), 0644); err != nil {
+		t.Fatalf("unable to write file: %s", err)
+	}
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatalf("unable to set time: %s", err)
+	}
+	if url2 := assetURL(dir, "gorse.css"); url2 == url {
+		t.Errorf("assetURL() = %s after changing file, wanted a new URL", url2)
+	}
+
+	if url := assetURL(dir, "missing.js"); url != "missing.js" {
+		t.Errorf("assetURL(missing.js) = %s, wanted missing.js", url)
+	}
+}
+
+func TestHandlerStaticFilesCacheControl(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "gorse.js"), []byte("1;"),
+		0644); err != nil {
+		t.Fatalf("unable to write file: %s", err)
+	}
+	settings := &Config{WebRoot: dir, StaticMaxAgeSeconds: 60}
+
+	tests := []struct {
+		Name         string
+		Path         string
+		CacheControl string
+	}{
+		{
+			Name:         "versioned",
+			Path:         "/static/" + assetURL(dir, "gorse.js"),
+			CacheControl: immutableCacheControl,
+		},
+		{
+			Name:         "unversioned",
+			Path:         "/static/gorse.js",
+			CacheControl: "public, max-age=60",
+		},
+		{
+			Name:         "old version",
+			Path:         "/static/gorse.js?v=0123456789abcdef",
+			CacheControl: "public, max-age=60",
+		},
+	}
+
+	for _, test := range tests {
+		request := httptest.NewRequest(http.MethodGet, test.Path, nil)
+		rw := httptest.NewRecorder()
+		handlerStaticFiles(rw, request, settings, nil, nil)
+
+		if rw.Code != http.StatusOK || rw.Body.String() != "1;" {
+			t.Errorf("%s: response = %d %q, wanted the file", test.Name, rw.Code,
+				rw.Body.String())
+		}
+		if got := rw.Header().Get("Cache-Control"); got != test.CacheControl {
+			t.Errorf("%s: Cache-Control = %q, wanted %q", test.Name, got,
+				test.CacheControl)
+		}
+	}
+
+	settings.StaticMaxAgeSeconds = 0
+	request := httptest.NewRequest(http.MethodGet, "/static/gorse.js", nil)
+	rw := httptest.NewRecorder()
+	handlerStaticFiles(rw, request, settings, nil, nil)
+	if got := rw.Header().Get("Cache-Control"); got != "no-cache" {
+		t.Errorf("Cache-Control = %q, wanted no-cache", got)
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// defaultMaxFormBytes is how large a form we accept if MaxFormBytes is 0. A
+// page of items with notes on each is well under this.
+const defaultMaxFormBytes = 1 << 20
+
+// maxFormBytes is how large a form we accept.
+func (c *Config) maxFormBytes() int64 {
+	if c.MaxFormBytes == 0 {
+		return defaultMaxFormBytes
+	}
+	return c.MaxFormBytes
+}
+
+// tooLargeMessage is the error http.MaxBytesReader gives once we read past the
+// limit. We recognize it by its message as the error has no type we can check
+// for until Go 1.19.
+const tooLargeMessage = "http: request body too large"
+
+// limitBody stops us reading more than max bytes of the request's body. This
+// way a huge upload can't exhaust our memory when we parse it.
+//
+// If the client tells us the body is larger, we respond with 413 and return
+// false. Otherwise the client may still send more than it said (or not say),
+// so handlers must check errors reading the body with bodyTooLarge.
+func limitBody(rw http.ResponseWriter, request *http.Request,
+	max int64) bool {
+	if request.ContentLength > max {
+		logf(request, "Request body is %d bytes. The limit is %d.",
+			request.ContentLength, max)
+		send413Error(rw, tooLargeError(max))
+		return false
+	}
+
+	request.Body = http.MaxBytesReader(rw, request.Body, max)
+	return true
+}
+
+// bodyTooLarge reports whether the error is from reading past the limit
+// limitBody sets.
+func bodyTooLarge(err error) bool {
+	return err != nil && err.Error() == tooLargeMessage
+}
+
+// tooLargeError is the message to give a client sending more than max bytes.
+func tooLargeError(max int64) string {
+	return fmt.Sprintf("Request too large. The limit is %d bytes.", max)
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/sessions"
+)
+
+func TestBodyLimit(t *testing.T) {
+	handler := HTTPHandler{
+		settings:     &Config{SessionName: "gorse", MaxFormBytes: 100},
+		sessionStore: sessions.NewCookieStore([]byte(strings.Repeat("k", 32))),
+	}
+
+	form := "read-state=read&read-item=" + strings.Repeat("1", 100)
+
+	tests := []struct {
+		Name string
+		Body io.Reader
+	}{
+		// We know it's too large from its Content-Length.
+		{Name: "length", Body: strings.NewReader(form)},
+
+		// We only find out once we read it.
+		{
+			Name: "chunked",
+			Body: io.MultiReader(strings.NewReader(form)),
+		},
+	}
+
+	for _, test := range tests {
+		request := httptest.NewRequest(http.MethodPost, "/update_read_flags",
+			test.Body)
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rw := httptest.NewRecorder()
+		handler.ServeHTTP(rw, request)
+
+		if rw.Code != http.StatusRequestEntityTooLarge {
+			t.Errorf("%s: status = %d, wanted %d", test.Name, rw.Code,
+				http.StatusRequestEntityTooLarge)
+		}
+		if !strings.Contains(rw.Body.String(), "The limit is 100 bytes.") {
+			t.Errorf("%s: body = %q, wanted it to give the limit", test.Name,
+				rw.Body.String())
+		}
+	}
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"fmt"
+	"net/mail"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/horgh/gorse"
+)
+
+// minCookieKeyLength is the shortest cookie authentication key we accept.
+// gorilla/sessions recommends 32 or 64 bytes.
+const minCookieKeyLength = 32
+
+// validateConfig checks the settings we need to serve requests. It returns a
+// description of each problem it finds along with how to fix it.
+//
+// We check everything up front so that we can report every problem at once
+// rather than failing on the first, or later while serving requests.
+func validateConfig(settings *Config) []string {
+	var problems []string
+	problem := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	if listensOnSocket(settings) {
+		dir := filepath.Dir(settings.ListenHost)
+		if fi, err := os.Stat(dir); err != nil || !fi.IsDir() {
+			problem("ListenHost is the socket %s but its directory %s doesn't "+
+				"exist. Create it or choose another path.", settings.ListenHost, dir)
+		}
+		if _, err := socketMode(settings); err != nil {
+			problem("ListenSocketMode is %q. Set it to the socket's permissions "+
+				"in octal, such as 0660, or leave it blank for 0660.",
+				settings.ListenSocketMode)
+		}
+	} else if settings.ListenPort < 1 || settings.ListenPort > 65535 {
+		problem("ListenPort is %d. It must be a port from 1 to 65535, such as "+
+			"9901.", settings.ListenPort)
+	}
+
+	if settings.FastCGI != 0 && settings.FastCGI != 1 {
+		problem("FastCGI is %d. Set it to 1 to serve FastCGI or 0 to serve HTTP.",
+			settings.FastCGI)
+	}
+
+	if settings.DebugEndpoints != 0 && settings.DebugEndpoints != 1 {
+		problem("DebugEndpoints is %d. Set it to 1 to serve the profiler and "+
+			"runtime statistics to admins, or 0 to not.", settings.DebugEndpoints)
+	}
+
+	switch settings.DBType {
+	case "", gorse.Postgres:
+	case gorse.SQLite:
+		if settings.DBName == "" {
+			problem("DBName is blank. For sqlite3 set it to the path to the " +
+				"database file.")
+		}
+	default:
+		problem("DBType is %q. Set it to %s or %s.", settings.DBType,
+			gorse.Postgres, gorse.SQLite)
+	}
+
+	if settings.DBMaxOpenConns < 0 || settings.DBMaxIdleConns < 0 ||
+		settings.DBConnMaxLifetimeSeconds < 0 {
+		problem("The database connection pool limits (DBMaxOpenConns, " +
+			"DBMaxIdleConns, DBConnMaxLifetimeSeconds) must not be negative. " +
+			"Use 0 for the defaults.")
+	}
+
+	if settings.DBStatementTimeoutSeconds < 0 ||
+		settings.DBSlowQueryMilliseconds < 0 {
+		problem("DBStatementTimeoutSeconds and DBSlowQueryMilliseconds must not " +
+			"be negative. Use 0 for no limit and to not log slow queries.")
+	}
+	if settings.DBStatementTimeoutSeconds > 0 && settings.DBType == gorse.SQLite {
+		problem("DBStatementTimeoutSeconds is not supported with SQLite. Set it " +
+			"to 0.")
+	}
+
+	if settings.MaxFormBytes < 0 {
+		problem("MaxFormBytes is %d. Set it to the largest form to accept in "+
+			"bytes, or to 0 for the default of %d.", settings.MaxFormBytes,
+			defaultMaxFormBytes)
+	}
+
+	if settings.StaticMaxAgeSeconds < 0 {
+		problem("StaticMaxAgeSeconds is %d. Set it to how long browsers may "+
+			"cache static files in seconds, or to 0 to have them check each time.",
+			settings.StaticMaxAgeSeconds)
+	}
+
+	if settings.SMTPHost != "" {
+		if settings.SMTPPort < 1 || settings.SMTPPort > 65535 {
+			problem("SMTPPort is %d. Set it to the SMTP server's port, such as "+
+				"587.", settings.SMTPPort)
+		}
+		if _, err := mail.ParseAddress(settings.SMTPFrom); err != nil {
+			problem("SMTPFrom is %q. Set it to the address to email items from, "+
+				"such as gorse@example.com.", settings.SMTPFrom)
+		}
+	}
+
+	for _, origin := range strings.Fields(settings.ExtensionOrigins) {
+		if u, err := url.Parse(origin); err != nil || u.Scheme == "" ||
+			u.Host == "" || u.Path != "" || u.RawQuery != "" {
+			problem("ExtensionOrigins has %q. Set it to the origins of browser "+
+				"extensions, such as moz-extension://<uuid>, separated by spaces.",
+				origin)
+		}
+	}
+
+	if settings.PollDBTimeoutSeconds < 0 || settings.RequestTimeoutSeconds < 0 {
+		problem("PollDBTimeoutSeconds and RequestTimeoutSeconds must not be " +
+			"negative. Use 0 for no limit.")
+	}
+
+	if settings.PollIntervalSeconds < 0 {
+		problem("PollIntervalSeconds is %d. Set it to how often to poll feeds "+
+			"in seconds, such as 300, or to 0 to not poll.",
+			settings.PollIntervalSeconds)
+	}
+
+	if _, err := time.LoadLocation(settings.DisplayTimeZone); err != nil ||
+		settings.DisplayTimeZone == "" {
+		problem("DisplayTimeZone %q is not a time zone we know. Set it to a "+
+			"name from the tz database such as America/Vancouver, or to UTC.",
+			settings.DisplayTimeZone)
+	}
+
+	if prefix := settings.URIPrefix; prefix != "" &&
+		(!strings.HasPrefix(prefix, "/") || strings.HasSuffix(prefix, "/")) {
+		problem("URIPrefix is %q. It must start with / and not end with one, "+
+			"such as /gorse, or be blank if serving from the root.",
+			settings.URIPrefix)
+	}
+
+	if _, err := cookieKeyPairs(settings); err != nil {
+		problem("CookieAuthenticationKey and CookieEncryptionKey are invalid: "+
+			"%s. Generate new keys with: gorse gen-key", err)
+	}
+
+	if settings.SessionName == "" {
+		problem("SessionName is blank. Set it to the name for the session " +
+			"cookie, such as gorse.")
+	}
+
+	if settings.LogFile == "" {
+		problem("LogFile is blank. Set it to the file to log to, or - to log " +
+			"to stdout.")
+	}
+
+	switch settings.AccessLogFormat {
+	case "", accessLogJSON, accessLogCommon:
+	default:
+		problem("AccessLogFormat is %q. Set it to %s, or to %s for the Common "+
+			"Log Format.", settings.AccessLogFormat, accessLogJSON,
+			accessLogCommon)
+	}
+
+	switch settings.LogLevel {
+	case "", logLevelInfo, logLevelDebug:
+	default:
+		problem("LogLevel is %q. Set it to %s, or to %s to also log each "+
+			"request's parameters and timing.", settings.LogLevel, logLevelInfo,
+			logLevelDebug)
+	}
+
+	// Check the directories by looking for a file each should have.
+	checkDir := func(name, dir, file, example string) {
+		if dir == "" {
+			problem("%s is blank. Set it to the directory holding %s, such as %s.",
+				name, file, example)
+			return
+		}
+		if _, err := os.Stat(filepath.Join(dir, file)); err != nil {
+			problem("%s is %q but we can't find %s there: %s. Set it to the "+
+				"directory holding %s, such as %s.", name, dir, file, err, file,
+				example)
+		}
+	}
+	checkDir("WebRoot", settings.WebRoot, "gorse.css", "cmd/gorse/static")
+	checkDir("TemplateDir", settings.TemplateDir, "_header.html",
+		"cmd/gorse/templates")
+
+	return problems
+}
+
+// readSecrets reads the secrets given as files into the settings.
+func readSecrets(settings *Config) error {
+	pass, err := gorse.ReadSecret(settings.DBPass, settings.DBPassFile)
+	if err != nil {
+		return fmt.Errorf("DBPassFile: %s", err)
+	}
+	settings.DBPass = pass
+
+	key, err := gorse.ReadSecret(settings.CookieAuthenticationKey,
+		settings.CookieAuthenticationKeyFile)
+	if err != nil {
+		return fmt.Errorf("CookieAuthenticationKeyFile: %s", err)
+	}
+	settings.CookieAuthenticationKey = key
+
+	key, err = gorse.ReadSecret(settings.CookieEncryptionKey,
+		settings.CookieEncryptionKeyFile)
+	if err != nil {
+		return fmt.Errorf("CookieEncryptionKeyFile: %s", err)
+	}
+	settings.CookieEncryptionKey = key
+
+	pass, err = gorse.ReadSecret(settings.SMTPPassword,
+		settings.SMTPPasswordFile)
+	if err != nil {
+		return fmt.Errorf("SMTPPasswordFile: %s", err)
+	}
+	settings.SMTPPassword = pass
+
+	return nil
+}
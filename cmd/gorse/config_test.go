@@ -0,0 +1,188 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateConfig(t *testing.T) {
+	valid := Config{
+		ListenHost:              "127.0.0.1",
+		ListenPort:              9901,
+		DBType:                  "postgres",
+		DisplayTimeZone:         "America/Vancouver",
+		URIPrefix:               "/gorse",
+		CookieAuthenticationKey: strings.Repeat("k", 32),
+		SessionName:             "gorse",
+		LogFile:                 "-",
+		WebRoot:                 "static",
+		TemplateDir:             "templates",
+	}
+
+	if problems := validateConfig(&valid); len(problems) != 0 {
+		t.Errorf("validateConfig() = %q, wanted no problems", problems)
+	}
+
+	tests := []struct {
+		Name   string
+		Change func(*Config)
+		Wanted []string
+	}{
+		{
+			Name:   "root prefix",
+			Change: func(c *Config) { c.URIPrefix = "" },
+		},
+		{
+			Name: "socket",
+			Change: func(c *Config) {
+				c.ListenHost = "/tmp/gorse.sock"
+				c.ListenPort = 0
+			},
+		},
+		{
+			Name: "socket mode",
+			Change: func(c *Config) {
+				c.ListenHost = "/nonexistent/gorse.sock"
+				c.ListenSocketMode = "rw"
+			},
+			Wanted: []string{"ListenHost", "ListenSocketMode"},
+		},
+		{
+			Name:   "port",
+			Change: func(c *Config) { c.ListenPort = 70000 },
+			Wanted: []string{"ListenPort"},
+		},
+		{
+			Name:   "prefix",
+			Change: func(c *Config) { c.URIPrefix = "gorse/" },
+			Wanted: []string{"URIPrefix"},
+		},
+		{
+			Name:   "debug",
+			Change: func(c *Config) { c.LogLevel = "debug" },
+		},
+		{
+			Name:   "log level",
+			Change: func(c *Config) { c.LogLevel = "verbose" },
+			Wanted: []string{"LogLevel"},
+		},
+		{
+			Name: "access log",
+			Change: func(c *Config) {
+				c.AccessLogFile = "-"
+				c.AccessLogFormat = "common"
+			},
+		},
+		{
+			Name:   "access log format",
+			Change: func(c *Config) { c.AccessLogFormat = "combined" },
+			Wanted: []string{"AccessLogFormat"},
+		},
+		{
+			Name: "rotated cookie keys",
+			Change: func(c *Config) {
+				c.CookieAuthenticationKey = strings.Repeat("n", 64) + " " +
+					strings.Repeat("o", 32)
+				c.CookieEncryptionKey = strings.Repeat("e", 32) + " -"
+			},
+		},
+		{
+			Name:   "cookie encryption key",
+			Change: func(c *Config) { c.CookieEncryptionKey = "short" },
+			Wanted: []string{"CookieAuthenticationKey and CookieEncryptionKey"},
+		},
+		{
+			Name: "query limits",
+			Change: func(c *Config) {
+				c.DBStatementTimeoutSeconds = 30
+				c.DBSlowQueryMilliseconds = 1000
+			},
+		},
+		{
+			Name:   "slow query threshold",
+			Change: func(c *Config) { c.DBSlowQueryMilliseconds = -1 },
+			Wanted: []string{
+				"DBStatementTimeoutSeconds and DBSlowQueryMilliseconds"},
+		},
+		{
+			Name: "sqlite statement timeout",
+			Change: func(c *Config) {
+				c.DBType = "sqlite3"
+				c.DBName = "/tmp/gorse.db"
+				c.DBStatementTimeoutSeconds = 30
+			},
+			Wanted: []string{"DBStatementTimeoutSeconds"},
+		},
+		{
+			Name:   "max form bytes",
+			Change: func(c *Config) { c.MaxFormBytes = -1 },
+			Wanted: []string{"MaxFormBytes"},
+		},
+		{
+			Name: "smtp",
+			Change: func(c *Config) {
+				c.SMTPHost = "smtp.example.com"
+				c.SMTPPort = 587
+				c.SMTPFrom = "Gorse <gorse@example.com>"
+			},
+		},
+		{
+			Name: "smtp port and from",
+			Change: func(c *Config) {
+				c.SMTPHost = "smtp.example.com"
+				c.SMTPFrom = "gorse"
+			},
+			Wanted: []string{"SMTPPort", "SMTPFrom"},
+		},
+		{
+			Name: "extension origins",
+			Change: func(c *Config) {
+				c.ExtensionOrigins = "moz-extension://0a1b2c3d " +
+					"chrome-extension://abcdefgh"
+			},
+		},
+		{
+			Name: "extension origin with path",
+			Change: func(c *Config) {
+				c.ExtensionOrigins = "chrome-extension://abcdefgh/popup.html"
+			},
+			Wanted: []string{"ExtensionOrigins"},
+		},
+		{
+			Name:   "time zone",
+			Change: func(c *Config) { c.DisplayTimeZone = "Mars/Olympus_Mons" },
+			Wanted: []string{"DisplayTimeZone"},
+		},
+		{
+			Name: "everything at once",
+			Change: func(c *Config) {
+				c.DBType = "mysql"
+				c.CookieAuthenticationKey = "short"
+				c.SessionName = ""
+				c.LogFile = ""
+				c.TemplateDir = "static"
+				c.WebRoot = ""
+			},
+			Wanted: []string{"DBType", "CookieAuthenticationKey", "SessionName",
+				"LogFile", "WebRoot", "TemplateDir"},
+		},
+	}
+
+	for _, test := range tests {
+		settings := valid
+		test.Change(&settings)
+
+		problems := validateConfig(&settings)
+		if len(problems) != len(test.Wanted) {
+			t.Errorf("%s: validateConfig() = %q, wanted %d problems", test.Name,
+				problems, len(test.Wanted))
+			continue
+		}
+		for i, problem := range problems {
+			if !strings.HasPrefix(problem, test.Wanted[i]) {
+				t.Errorf("%s: problem %d = %q, wanted one about %s", test.Name, i,
+					problem, test.Wanted[i])
+			}
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// noEncryptionKey stands in CookieEncryptionKey for a key pair without an
+// encryption key.
+const noEncryptionKey = "-"
+
+// cookieKeyPairs builds the session store's key pairs from the settings.
+//
+// CookieAuthenticationKey holds one or more keys separated by whitespace. We
+// sign cookies with the first and accept cookies signed by any of them. This
+// lets us rotate keys without logging everyone out: add a new key at the
+// start, and remove the old one once its cookies have expired.
+//
+// CookieEncryptionKey is blank to not encrypt cookies. Otherwise it holds an
+// encryption key for each authentication key, in the same order, with - for
+// none.
+func cookieKeyPairs(settings *Config) ([][]byte, error) {
+	authKeys := strings.Fields(settings.CookieAuthenticationKey)
+	if len(authKeys) == 0 {
+		return nil, fmt.Errorf("no authentication key")
+	}
+
+	encryptionKeys := strings.Fields(settings.CookieEncryptionKey)
+	if len(encryptionKeys) != 0 && len(encryptionKeys) != len(authKeys) {
+		return nil, fmt.Errorf(
+			"%d encryption keys but %d authentication keys. Give one for each, "+
+				"or - for none", len(encryptionKeys), len(authKeys))
+	}
+
+	var pairs [][]byte
+	for i, authKey := range authKeys {
+		if len(authKey) < minCookieKeyLength {
+			return nil, fmt.Errorf("authentication key %d is %d bytes. It must be "+
+				"at least %d", i+1, len(authKey), minCookieKeyLength)
+		}
+
+		var encryptionKey []byte
+		if len(encryptionKeys) != 0 && encryptionKeys[i] != noEncryptionKey {
+			encryptionKey = []byte(encryptionKeys[i])
+			switch len(encryptionKey) {
+			case 16, 24, 32:
+			default:
+				return nil, fmt.Errorf("encryption key %d is %d bytes. It must be 16, "+
+					"24, or 32", i+1, len(encryptionKey))
+			}
+		}
+
+		pairs = append(pairs, []byte(authKey), encryptionKey)
+	}
+
+	return pairs, nil
+}
+
+// genKey writes new cookie keys in the config format.
+func genKey(w io.Writer) error {
+	// Base64 encoding gives 4 bytes for every 3, so these are 64 and 32 bytes,
+	// the longest keys each accepts.
+	authKey, err := randomKey(48)
+	if err != nil {
+		return err
+	}
+	encryptionKey, err := randomKey(24)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "CookieAuthenticationKey = %s\n"+
+		"CookieEncryptionKey = %s\n", authKey, encryptionKey)
+	return err
+}
+
+// randomKey generates n random bytes and encodes them as base64.
+func randomKey(n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("unable to generate key: %s", err)
+	}
+	return base64.StdEncoding.EncodeToString(buf), nil
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/sessions"
+)
+
+func TestCookieKeyPairs(t *testing.T) {
+	auth1 := strings.Repeat("a", 32)
+	auth2 := strings.Repeat("b", 64)
+	enc := strings.Repeat("e", 32)
+
+	tests := []struct {
+		Auth      string
+		Enc       string
+		WantPairs int
+	}{
+		{Auth: auth1, WantPairs: 1},
+		{Auth: auth1 + " " + auth2, WantPairs: 2},
+		{Auth: auth1, Enc: enc, WantPairs: 1},
+		{Auth: auth1 + "\n" + auth2, Enc: enc + " -", WantPairs: 2},
+		{Auth: ""},
+		{Auth: auth1 + " short"},
+		{Auth: auth1 + " " + auth2, Enc: enc},
+		{Auth: auth1, Enc: "not 16, 24, or 32 bytes"},
+	}
+
+	for _, test := range tests {
+		pairs, err := cookieKeyPairs(&Config{
+			CookieAuthenticationKey: test.Auth,
+			CookieEncryptionKey:     test.Enc,
+		})
+		if test.WantPairs == 0 {
+			if err == nil {
+				t.Errorf("cookieKeyPairs(%q, %q) = success, wanted error", test.Auth,
+					test.Enc)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("cookieKeyPairs(%q, %q) = error %s", test.Auth, test.Enc, err)
+			continue
+		}
+		if len(pairs) != 2*test.WantPairs {
+			t.Errorf("cookieKeyPairs(%q, %q) = %d keys, wanted %d pairs", test.Auth,
+				test.Enc, len(pairs), test.WantPairs)
+		}
+	}
+}
+
+// TestCookieKeyRotation checks sessions from before adding a new key still
+// work.
+func TestCookieKeyRotation(t *testing.T) {
+	oldKey := strings.Repeat("o", 32)
+	newKey := strings.Repeat("n", 32)
+	enc := strings.Repeat("e", 16)
+
+	store := func(auth, encryption string) *sessions.CookieStore {
+		pairs, err := cookieKeyPairs(&Config{
+			CookieAuthenticationKey: auth,
+			CookieEncryptionKey:     encryption,
+		})
+		if err != nil {
+			t.Fatalf("cookieKeyPairs() = error %s", err)
+		}
+		return sessions.NewCookieStore(pairs...)
+	}
+
+	oldStore := store(oldKey, "")
+	request := httptest.NewRequest(http.MethodGet, "/", nil)
+	session, err := oldStore.New(request, "gorse")
+	if err != nil {
+		t.Fatalf("New() = error %s", err)
+	}
+	session.Values["user"] = "1"
+	rw := httptest.NewRecorder()
+	if err := session.Save(request, rw); err != nil {
+		t.Fatalf("Save() = error %s", err)
+	}
+	cookies := rw.Result().Cookies()
+
+	for _, test := range []struct {
+		Name     string
+		Store    *sessions.CookieStore
+		WantUser bool
+	}{
+		{"rotated", store(newKey+" "+oldKey, enc+" -"), true},
+		{"old key removed", store(newKey, ""), false},
+	} {
+		request := httptest.NewRequest(http.MethodGet, "/", nil)
+		for _, cookie := range cookies {
+			request.AddCookie(cookie)
+		}
+
+		session, _ := test.Store.Get(request, "gorse")
+		if got := session.Values["user"] == "1"; got != test.WantUser {
+			t.Errorf("%s: session values = %v, wanted the user: %t", test.Name,
+				session.Values, test.WantUser)
+		}
+	}
+}
+
+func TestGenKey(t *testing.T) {
+	var buf bytes.Buffer
+	if err := genKey(&buf); err != nil {
+		t.Fatalf("genKey() = error %s", err)
+	}
+
+	settings := &Config{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		parts := strings.SplitN(line, " = ", 2)
+		if len(parts) != 2 {
+			t.Fatalf("genKey() line = %q, wanted key = value", line)
+		}
+		switch parts[0] {
+		case "CookieAuthenticationKey":
+			settings.CookieAuthenticationKey = parts[1]
+		case "CookieEncryptionKey":
+			settings.CookieEncryptionKey = parts[1]
+		default:
+			t.Errorf("genKey() gave unknown key %s", parts[0])
+		}
+	}
+
+	if _, err := cookieKeyPairs(settings); err != nil {
+		t.Errorf("genKey() keys are invalid: %s", err)
+	}
+}
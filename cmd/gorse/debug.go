@@ -0,0 +1,63 @@
+package main
+
+import (
+	"expvar"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"time"
+
+	"github.com/gorilla/sessions"
+	"github.com/horgh/gorse"
+)
+
+// startTime is when we started. We report how long we've been running.
+var startTime = time.Now()
+
+func init() {
+	// expvar publishes the command line and memory statistics itself.
+	expvar.Publish("goroutines", expvar.Func(func() interface{} {
+		return runtime.NumGoroutine()
+	}))
+	expvar.Publish("uptime_seconds", expvar.Func(func() interface{} {
+		return int64(time.Since(startTime).Seconds())
+	}))
+}
+
+// handlerDebug serves the Go profiler under /debug/pprof/ and runtime
+// statistics as JSON at /debug/vars. Only admins may see them, and only if
+// DebugEndpoints is on.
+//
+// It implements the type RequestHandlerFunc.
+//
+// These let us look into problems such as memory growth or goroutine leaks in
+// a process that's been running a while. Requests need an admin's session
+// cookie. For example:
+//
+//	curl -b 'gorse=<cookie>' -o heap \
+//	  'http://localhost:9901/debug/pprof/heap'
+//	go tool pprof heap
+func handlerDebug(rw http.ResponseWriter, request *http.Request,
+	settings *Config, store gorse.Store, session *sessions.Session) {
+	if _, ok := requireAdmin(rw, request, settings, store, session); !ok {
+		return
+	}
+
+	logf(request, "Serving debug request [%s]", request.URL.Path)
+
+	switch request.URL.Path {
+	case "/debug/vars":
+		expvar.Handler().ServeHTTP(rw, request)
+	case "/debug/pprof/cmdline":
+		pprof.Cmdline(rw, request)
+	case "/debug/pprof/profile":
+		pprof.Profile(rw, request)
+	case "/debug/pprof/symbol":
+		pprof.Symbol(rw, request)
+	case "/debug/pprof/trace":
+		pprof.Trace(rw, request)
+	default:
+		// The index and the named profiles such as heap and goroutine.
+		pprof.Index(rw, request)
+	}
+}
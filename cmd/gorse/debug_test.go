@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/horgh/gorse/internal/gorsetest"
+)
+
+func TestHandlerDebugIntegration(t *testing.T) {
+	for _, dbType := range gorsetest.Types {
+		t.Run(dbType, func(t *testing.T) {
+			testHandlerDebugIntegration(t, dbType)
+		})
+	}
+}
+
+func testHandlerDebugIntegration(t *testing.T, dbType string) {
+	store, _ := gorsetest.Store(t, dbType)
+
+	loaded := gorsetest.Load(t, store, gorsetest.Fixture{
+		Users: []gorsetest.User{
+			{Email: "admin@example.com", Password: "password", Admin: true},
+			{Email: "user@example.com", Password: "password"},
+		},
+	})
+
+	get := func(path string, userID int) *httptest.ResponseRecorder {
+		rw := httptest.NewRecorder()
+		request := httptest.NewRequest(http.MethodGet, path, nil)
+		handlerDebug(rw, request, &Config{}, store,
+			loggedInSession(t, request, userID))
+		return rw
+	}
+
+	rw := get("/debug/vars", loaded.Users["admin@example.com"])
+	if rw.Code != http.StatusOK {
+		t.Fatalf("/debug/vars = status %d, wanted %d", rw.Code, http.StatusOK)
+	}
+	var vars struct {
+		Goroutines int `json:"goroutines"`
+	}
+	if err := json.Unmarshal(rw.Body.Bytes(), &vars); err != nil {
+		t.Fatalf("/debug/vars is not JSON: %s: %s", err, rw.Body.String())
+	}
+	if vars.Goroutines == 0 {
+		t.Errorf("/debug/vars = %s, wanted the goroutine count", rw.Body.String())
+	}
+
+	rw = get("/debug/pprof/goroutine", loaded.Users["admin@example.com"])
+	if rw.Code != http.StatusOK || rw.Body.Len() == 0 {
+		t.Errorf("/debug/pprof/goroutine = status %d with %d bytes, wanted a "+
+			"profile", rw.Code, rw.Body.Len())
+	}
+
+	rw = get("/debug/vars", loaded.Users["user@example.com"])
+	if rw.Code != http.StatusForbidden {
+		t.Errorf("/debug/vars as a user = status %d, wanted %d", rw.Code,
+			http.StatusForbidden)
+	}
+}
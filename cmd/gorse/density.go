@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/gorilla/sessions"
+	"github.com/horgh/gorse"
+)
+
+// handlerListDensity sets whether the user's lists show items as one line
+// each, without their descriptions. density is compact or expanded.
+//
+// It implements the type RequestHandlerFunc.
+//
+// Like handlerUpdateReadFlags, we redirect back to the list of items after.
+func handlerListDensity(rw http.ResponseWriter, request *http.Request,
+	settings *Config, store gorse.Store, session *sessions.Session) {
+	if err := request.ParseForm(); err != nil {
+		logf(request, "Failed to parse form: %s", err)
+		if bodyTooLarge(err) {
+			send413Error(rw, tooLargeError(settings.maxFormBytes()))
+			return
+		}
+		send400Error(rw, "Failed to parse request")
+		return
+	}
+
+	userID, ok := sessionUser(rw, request, settings, session)
+	if !ok {
+		return
+	}
+
+	var compact bool
+	switch density := request.PostForm.Get("density"); density {
+	case "compact":
+		compact = true
+	case "expanded":
+	default:
+		logf(request, "Bad list density: %s", density)
+		send400Error(rw, "Bad list density")
+		return
+	}
+
+	if err := store.UpdateCompactList(gorse.WithActor(request.Context(), userID),
+		userID, compact); err != nil {
+		logf(request, "Unable to update list density: %s", err)
+		send500Error(rw, "Unable to update list density")
+		return
+	}
+
+	logf(request, "Set compact list: %t", compact)
+
+	uri := fmt.Sprintf("%s/?read-state=%s&page=%s",
+		settings.URIPrefix,
+		url.QueryEscape(request.PostForm.Get("read-state")),
+		url.QueryEscape(request.PostForm.Get("page")),
+	)
+	uri += listViewParams(request.PostForm)
+
+	logf(request, "Redirecting to %s", uri)
+
+	http.Redirect(rw, request, uri, http.StatusFound)
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/sessions"
+	"github.com/horgh/gorse/internal/gorsetest"
+)
+
+func TestHandlerListDensityIntegration(t *testing.T) {
+	for _, dbType := range gorsetest.Types {
+		t.Run(dbType, func(t *testing.T) {
+			testHandlerListDensityIntegration(t, dbType)
+		})
+	}
+}
+
+func testHandlerListDensityIntegration(t *testing.T, dbType string) {
+	ctx := context.Background()
+	store, _ := gorsetest.Store(t, dbType)
+
+	loaded := gorsetest.Load(t, store, gorsetest.Fixture{
+		Users: []gorsetest.User{
+			{Email: "user@example.com", Password: "password"},
+		},
+	})
+	userID := loaded.Users["user@example.com"]
+
+	settings := &Config{URIPrefix: "/gorse"}
+	sessionStore := sessions.NewCookieStore([]byte(strings.Repeat("k", 32)))
+
+	post := func(density string) *httptest.ResponseRecorder {
+		form := url.Values{
+			"density":    {density},
+			"read-state": {"read-later"},
+			"page":       {"2"},
+		}
+		request := httptest.NewRequest(http.MethodPost, "/list_density",
+			strings.NewReader(form.Encode()))
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		session, err := sessionStore.New(request, "gorse")
+		if err != nil {
+			t.Fatalf("creating session: %s", err)
+		}
+		session.Values[sessionUserKey] = userID
+		rw := httptest.NewRecorder()
+		handlerListDensity(rw, request, settings, store, session)
+		return rw
+	}
+
+	for _, test := range []struct {
+		density string
+		compact bool
+	}{
+		{"compact", true},
+		{"expanded", false},
+	} {
+		rw := post(test.density)
+		want := "/gorse/?read-state=read-later&page=2"
+		if rw.Code != http.StatusFound || rw.Header().Get("Location") != want {
+			t.Fatalf("POST %s = status %d to %s, wanted %d to %s", test.density,
+				rw.Code, rw.Header().Get("Location"), http.StatusFound, want)
+		}
+
+		user, err := store.GetUser(ctx, userID)
+		if err != nil {
+			t.Fatalf("GetUser() = error %s", err)
+		}
+		if user.CompactList != test.compact {
+			t.Errorf("after POST %s, compact list = %t, wanted %t", test.density,
+				user.CompactList, test.compact)
+		}
+	}
+
+	if rw := post("tiny"); rw.Code != http.StatusBadRequest {
+		t.Errorf("POST tiny = status %d, wanted %d", rw.Code,
+			http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gorilla/sessions"
+	"github.com/horgh/gorse"
+)
+
+// digestItemsPerFeed is how many of each feed's items we list in the digest.
+const digestItemsPerFeed = 5
+
+// handlerDigest shows an overview of the items from the last 24 hours grouped
+// by feed. For each feed we show how many items it had and the titles of its
+// newest. It's a quick look at what's new without paging through everything.
+//
+// It implements the type RequestHandlerFunc.
+//
+// day=YYYY-MM-DD shows that day in the display time zone instead. Like the
+// list of unread items, we leave out muted items.
+func handlerDigest(rw http.ResponseWriter, request *http.Request,
+	settings *Config, store gorse.Store, session *sessions.Session) {
+	requestValues := request.URL.Query()
+
+	userID, ok := sessionUser(rw, request, settings, session)
+	if !ok {
+		return
+	}
+
+	location, err := time.LoadLocation(settings.DisplayTimeZone)
+	if err != nil {
+		logf(request, "Failed to load time zone location [%s]: %s",
+			settings.DisplayTimeZone, err)
+		send500Error(rw, "Unable to load timezone information")
+		return
+	}
+
+	filter := gorse.ItemFilter{
+		UserID:     userID,
+		Since:      time.Now().Add(-24 * time.Hour),
+		Subscribed: true,
+	}
+
+	day := requestValues.Get("day")
+	if day != "" {
+		start, err := time.ParseInLocation("2006-01-02", day, location)
+		if err != nil {
+			logf(request, "Bad day: %s: %s", day, err)
+			send400Error(rw, "Bad day")
+			return
+		}
+		filter.Since = start
+		filter.Until = start.AddDate(0, 0, 1)
+	}
+
+	user, err := store.GetUser(request.Context(), userID)
+	if err != nil {
+		logf(request, "Unable to look up user: %s", err)
+		send500Error(rw, "Unable to look up user")
+		return
+	}
+	locale := userLocale(request, user)
+
+	if err := hideMuted(request.Context(), store, &filter); err != nil {
+		logf(request, "Unable to look up muted keywords: %s", err)
+		send500Error(rw, "Unable to look up muted keywords")
+		return
+	}
+
+	feeds, err := store.Digest(request.Context(), filter, digestItemsPerFeed)
+	if err != nil {
+		logf(request, "Unable to retrieve digest: %s", err)
+		send500Error(rw, "Unable to retrieve digest")
+		return
+	}
+
+	type HTMLItem struct {
+		ID    int64
+		Title string
+		Link  string
+		Read  bool
+	}
+
+	type HTMLFeed struct {
+		ID     int64
+		Name   string
+		Count  int
+		Unread int
+		More   int
+		Items  []HTMLItem
+	}
+
+	var htmlFeeds []HTMLFeed
+	total := 0
+	for _, feed := range feeds {
+		htmlFeed := HTMLFeed{
+			ID:     feed.FeedID,
+			Name:   feed.FeedName,
+			Count:  feed.Count,
+			Unread: feed.Unread,
+			More:   feed.Count - len(feed.Items),
+		}
+		for _, item := range feed.Items {
+			htmlFeed.Items = append(htmlFeed.Items, HTMLItem{
+				ID:    item.ID,
+				Title: sanitiseItemText(item.Title),
+				Link:  item.Link,
+				Read:  item.ReadState != gorse.Unread,
+			})
+		}
+		htmlFeeds = append(htmlFeeds, htmlFeed)
+		total += feed.Count
+	}
+
+	type DigestPage struct {
+		Feeds     []HTMLFeed
+		Total     int
+		Day       string
+		Path      string
+		UserID    int
+		ReadState gorse.ReadState
+	}
+
+	if err := renderPage(settings, rw, locale, "_digest", DigestPage{
+		Feeds:     htmlFeeds,
+		Total:     total,
+		Day:       day,
+		Path:      settings.URIPrefix,
+		UserID:    userID,
+		ReadState: gorse.Unread,
+	}); err != nil {
+		logf(request, "Failure rendering page: %s", err)
+		send500Error(rw, "Failed to render page")
+		return
+	}
+}
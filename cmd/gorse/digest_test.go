@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/sessions"
+	"github.com/horgh/gorse"
+	"github.com/horgh/gorse/internal/gorsetest"
+	"github.com/horgh/rss"
+)
+
+func TestHandlerDigestIntegration(t *testing.T) {
+	for _, dbType := range gorsetest.Types {
+		t.Run(dbType, func(t *testing.T) {
+			testHandlerDigestIntegration(t, dbType)
+		})
+	}
+}
+
+func testHandlerDigestIntegration(t *testing.T, dbType string) {
+	store, _ := gorsetest.Store(t, dbType)
+
+	day := time.Date(2021, 3, 4, 12, 0, 0, 0, time.UTC)
+	var items []rss.Item
+	for i := 0; i < digestItemsPerFeed+2; i++ {
+		items = append(items, rss.Item{
+			Title:   fmt.Sprintf("Item <b>%d</b>", i),
+			Link:    fmt.Sprintf("https://example.com/%d", i),
+			PubDate: day.Add(time.Duration(i) * time.Minute),
+		})
+	}
+	items = append(items, rss.Item{
+		Title:   "Recent",
+		Link:    "https://example.com/recent",
+		PubDate: time.Now().Add(-time.Hour),
+	})
+
+	loaded := gorsetest.Load(t, store, gorsetest.Fixture{
+		Users: []gorsetest.User{
+			{Email: "user@example.com", Password: "password"},
+		},
+		Feeds: []gorsetest.Feed{
+			{
+				DBFeed: gorse.DBFeed{
+					Name:                   "Example",
+					URI:                    "https://example.com/feed",
+					UpdateFrequencySeconds: 3600,
+					Active:                 true,
+				},
+				Items:       items,
+				Subscribers: []string{"user@example.com"},
+			},
+		},
+	})
+	userID := loaded.Users["user@example.com"]
+
+	settings := &Config{
+		URIPrefix:       "/gorse",
+		DisplayTimeZone: "UTC",
+		WebRoot:         "static",
+		TemplateDir:     "templates",
+	}
+	sessionStore := sessions.NewCookieStore([]byte(strings.Repeat("k", 32)))
+
+	get := func(query string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodGet,
+			"/digest?"+query, nil)
+		session, err := sessionStore.New(request, "gorse")
+		if err != nil {
+			t.Fatalf("creating session: %s", err)
+		}
+		session.Values[sessionUserKey] = userID
+		rw := httptest.NewRecorder()
+		handlerDigest(rw, request, settings, store, session)
+		return rw
+	}
+
+	rw := get("")
+	if rw.Code != http.StatusOK {
+		t.Fatalf("GET = status %d: %s, wanted %d", rw.Code, rw.Body.String(),
+			http.StatusOK)
+	}
+	body := rw.Body.String()
+	if !strings.Contains(body, "Recent") ||
+		strings.Contains(body, ">Item 0<") {
+		t.Errorf("GET = %s, wanted only the item from the last day", body)
+	}
+
+	rw = get("day=2021-03-04")
+	if rw.Code != http.StatusOK {
+		t.Fatalf("GET day = status %d: %s, wanted %d", rw.Code,
+			rw.Body.String(), http.StatusOK)
+	}
+	body = rw.Body.String()
+	if !strings.Contains(body, ">Item 6<") ||
+		strings.Contains(body, ">Item 1<") ||
+		!strings.Contains(body, "and 2 more") ||
+		!strings.Contains(body, "7 items, 7 unread") ||
+		strings.Contains(body, ">Recent<") {
+		t.Errorf("GET day = %s, wanted the newest %d of the day's 7 items",
+			body, digestItemsPerFeed)
+	}
+
+	if rw := get("day=yesterday"); rw.Code != http.StatusBadRequest {
+		t.Errorf("GET bad day = status %d, wanted %d", rw.Code,
+			http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"html/template"
+	"log"
+	"strings"
+	"unicode"
+
+	"github.com/horgh/gorse"
+)
+
+// Users choose how their lists show items from each feed: their full
+// descriptions, summaries of them, or only their titles.
+
+// descriptionLength is the most of an item's description we show.
+const descriptionLength = 2000
+
+// summaryLength is about how much of an item's description a summary is.
+const summaryLength = 300
+
+// itemDescription makes the HTML version of an item's description the way the
+// display mode says to show it.
+func itemDescription(mode gorse.DisplayMode,
+	description string) template.HTML {
+	text := sanitiseItemText(description)
+
+	switch mode {
+	case gorse.DisplayTitle:
+		return ""
+	case gorse.DisplaySummary:
+		text = summarise(text, summaryLength)
+	default:
+		text = substr(text, descriptionLength)
+	}
+
+	// We set it as type HTML so the template execution knows not to re-encode
+	// it. We want to control the encoding more carefully for making links of
+	// URLs, for one.
+	return getHTMLDescription(text)
+}
+
+// summarise shortens the text to at most n characters, ending at a word and
+// saying there is more if it cuts any.
+func summarise(s string, n int) string {
+	short := substr(s, n)
+	if short == s {
+		return s
+	}
+
+	// Drop the word we cut through, if we did.
+	next := []rune(s[len(short):])[0]
+	if !unicode.IsSpace(next) {
+		if i := strings.LastIndexFunc(short, unicode.IsSpace); i > 0 {
+			short = short[:i]
+		}
+	}
+	return strings.TrimRightFunc(short, func(r rune) bool {
+		return unicode.IsSpace(r) || unicode.IsPunct(r)
+	}) + "…"
+}
+
+// setFeedDisplay sets how the lists of the user with the email show items
+// from the feed at the URI. The mode is full, summary, or title.
+func setFeedDisplay(ctx context.Context, settings *Config, email, uri,
+	display string) error {
+	mode, err := gorse.ParseDisplayMode(display)
+	if err != nil {
+		return fmt.Errorf("%s. Use full, summary, or title", err)
+	}
+
+	db, err := connectToDB(settings)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := db.Close(); err != nil {
+			log.Printf("Database close: %s", err)
+		}
+	}()
+
+	user, err := findUserByEmail(ctx, db, email)
+	if err != nil {
+		return err
+	}
+
+	feed, err := gorse.GetFeedByURI(ctx, db, uri)
+	if err != nil {
+		if err == gorse.ErrNotFound {
+			return fmt.Errorf("no feed at %s", uri)
+		}
+		return err
+	}
+
+	if err := gorse.SetFeedDisplay(ctx, db, user.ID, feed.ID,
+		mode); err != nil {
+		if err == gorse.ErrNotFound {
+			return fmt.Errorf("%s doesn't subscribe to %s", email, uri)
+		}
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/horgh/gorse"
+)
+
+func TestSummarise(t *testing.T) {
+	tests := []struct {
+		input  string
+		n      int
+		output string
+	}{
+		{"Short enough", 20, "Short enough"},
+		{"The storm hits the coast, again.", 21, "The storm hits the…"},
+		{"The storm hits the coast, again.", 25, "The storm hits the coast…"},
+		{"Élan vital", 6, "Élan…"},
+		{"Unbroken", 4, "Unbr…"},
+	}
+
+	for _, test := range tests {
+		if got := summarise(test.input, test.n); got != test.output {
+			t.Errorf("summarise(%q, %d) = %q, wanted %q", test.input, test.n, got,
+				test.output)
+		}
+	}
+}
+
+func TestItemDescription(t *testing.T) {
+	description := "<p>" + strings.Repeat("word ", 1000) + "</p>"
+
+	if got := itemDescription(gorse.DisplayTitle, description); got != "" {
+		t.Errorf("itemDescription() of title only = %q, wanted nothing", got)
+	}
+
+	summary := itemDescription(gorse.DisplaySummary, description)
+	if len(summary) > summaryLength+len("…") ||
+		!strings.HasSuffix(string(summary), "word…") {
+		t.Errorf("itemDescription() of summary = %q, wanted a summary", summary)
+	}
+
+	full := itemDescription(gorse.DisplayFull, description)
+	if len(full) != descriptionLength || strings.Contains(string(full), "<p>") {
+		t.Errorf("itemDescription() of full = %q, wanted %d characters of text",
+			full, descriptionLength)
+	}
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/http"
+	"net/mail"
+	"net/smtp"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/sessions"
+	"github.com/horgh/gorse"
+)
+
+// smtpTimeout is how long we give the SMTP server to take an email.
+const smtpTimeout = 30 * time.Second
+
+// handlerEmailItem emails an item's title, link, and description to an
+// address so people can share it. The address is in the to parameter, or if
+// that's blank, the user's share email.
+//
+// It implements the type RequestHandlerFunc.
+//
+// Like handlerUpdateReadFlags, we redirect back to the list of items after.
+func handlerEmailItem(rw http.ResponseWriter, request *http.Request,
+	settings *Config, store gorse.Store, session *sessions.Session) {
+	if settings.SMTPHost == "" {
+		logf(request, "Not emailing item as there is no SMTPHost.")
+		send400Error(rw, "Emailing items is not set up")
+		return
+	}
+
+	if err := request.ParseForm(); err != nil {
+		logf(request, "Failed to parse form: %s", err)
+		if bodyTooLarge(err) {
+			send413Error(rw, tooLargeError(settings.maxFormBytes()))
+			return
+		}
+		send400Error(rw, "Failed to parse request")
+		return
+	}
+
+	userID, ok := sessionUser(rw, request, settings, session)
+	if !ok {
+		return
+	}
+
+	readState := gorse.Unread
+	if request.PostForm.Get("read-state") == "read-later" {
+		readState = gorse.ReadLater
+	}
+
+	itemIDStr := request.PostForm.Get("item-id")
+	itemID, err := strconv.ParseInt(itemIDStr, 10, 64)
+	if err != nil {
+		logf(request, "Bad item ID: %s: %s", itemIDStr, err)
+		send400Error(rw, "Bad item ID")
+		return
+	}
+
+	user, err := store.GetUser(request.Context(), userID)
+	if err != nil {
+		logf(request, "Unable to look up user: %s", err)
+		send500Error(rw, "Unable to look up user")
+		return
+	}
+
+	to := strings.TrimSpace(request.PostForm.Get("to"))
+	if to == "" {
+		to = user.ShareEmail
+	}
+	if to == "" {
+		logf(request, "No address to email item %d to", itemID)
+		send400Error(rw, "Give an address to email the item to")
+		return
+	}
+	toAddress, err := mail.ParseAddress(to)
+	if err != nil {
+		logf(request, "Invalid address to email item to: %s: %s", to, err)
+		send400Error(rw, "Invalid email address")
+		return
+	}
+
+	item, err := store.GetItem(request.Context(), itemID, userID)
+	if err != nil {
+		logf(request, "Unable to look up item %d: %s", itemID, err)
+		send500Error(rw, "Unable to look up item")
+		return
+	}
+
+	// We checked SMTPFrom when validating the config.
+	fromAddress, err := mail.ParseAddress(settings.SMTPFrom)
+	if err != nil {
+		logf(request, "Invalid SMTPFrom: %s", err)
+		send500Error(rw, "Unable to email the item")
+		return
+	}
+
+	message, err := itemEmail(fromAddress, toAddress, user.Email, item,
+		time.Now())
+	if err != nil {
+		logf(request, "Unable to write email: %s", err)
+		send500Error(rw, "Unable to email the item")
+		return
+	}
+
+	if err := sendEmail(request.Context(), settings, fromAddress.Address,
+		toAddress.Address, message); err != nil {
+		logf(request, "Unable to email item %d to %s: %s", itemID,
+			toAddress.Address, err)
+		send500Error(rw, "Unable to email the item")
+		return
+	}
+
+	logf(request, "Emailed item %d to %s", itemID, toAddress.Address)
+
+	session.AddFlash("Sent.")
+
+	if err := session.Save(request, rw); err != nil {
+		logf(request, "Unable to save session: %s", err)
+		send500Error(rw, "Failed to save your session.")
+		return
+	}
+
+	uri := fmt.Sprintf("%s/?read-state=%s&page=%s",
+		settings.URIPrefix,
+		url.QueryEscape(readState.String()),
+		url.QueryEscape(request.PostForm.Get("page")),
+	)
+	uri += listViewParams(request.PostForm)
+
+	logf(request, "Redirecting to %s", uri)
+
+	http.Redirect(rw, request, uri, http.StatusFound)
+}
+
+// itemEmail writes an email sharing the item. replyTo is the address of the
+// user sharing it so that replies go to them rather than to us.
+//
+// The body is plain text. We strip the HTML from the description as we do
+// when showing it.
+func itemEmail(from, to *mail.Address, replyTo string, item *gorse.UserItem,
+	date time.Time) ([]byte, error) {
+	title := strings.Join(strings.Fields(sanitiseItemText(item.Title)), " ")
+	if title == "" {
+		title = item.Link
+	}
+
+	var buf bytes.Buffer
+	header := func(name, value string) {
+		fmt.Fprintf(&buf, "%s: %s\r\n", name, value)
+	}
+	header("From", from.String())
+	header("To", to.String())
+	if replyTo != "" {
+		header("Reply-To", (&mail.Address{Address: replyTo}).String())
+	}
+	header("Subject", mime.QEncoding.Encode("utf-8", title))
+	header("Date", date.Format(time.RFC1123Z))
+	header("MIME-Version", "1.0")
+	header("Content-Type", "text/plain; charset=utf-8")
+	header("Content-Transfer-Encoding", "quoted-printable")
+	buf.WriteString("\r\n")
+
+	body := title + "\n" + item.Link + "\n"
+	if description := strings.TrimSpace(sanitiseItemText(
+		item.Description)); description != "" {
+		body += "\n" + description + "\n"
+	}
+	if replyTo != "" {
+		body += "\n-- \nShared by " + replyTo + " from gorse.\n"
+	}
+
+	qp := quotedprintable.NewWriter(&buf)
+	if _, err := qp.Write([]byte(strings.ReplaceAll(body, "\n",
+		"\r\n"))); err != nil {
+		return nil, fmt.Errorf("encoding body: %s", err)
+	}
+	if err := qp.Close(); err != nil {
+		return nil, fmt.Errorf("encoding body: %s", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// sendEmail sends the message through the SMTP server.
+//
+// This is what smtp.SendMail does, but with a time limit so that a server that
+// stops responding doesn't hold up the request forever. We use STARTTLS if the
+// server offers it, and log in if SMTPUsername is set.
+func sendEmail(ctx context.Context, settings *Config, from, to string,
+	message []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, smtpTimeout)
+	defer cancel()
+
+	address := net.JoinHostPort(settings.SMTPHost,
+		strconv.FormatInt(settings.SMTPPort, 10))
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := conn.SetDeadline(deadline); err != nil {
+			_ = conn.Close()
+			return fmt.Errorf("setting deadline: %s", err)
+		}
+	}
+
+	client, err := smtp.NewClient(conn, settings.SMTPHost)
+	if err != nil {
+		_ = conn.Close()
+		return err
+	}
+	// This fails once we've quit, which is fine.
+	defer func() {
+		_ = client.Close()
+	}()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{
+			ServerName: settings.SMTPHost,
+		}); err != nil {
+			return fmt.Errorf("STARTTLS: %s", err)
+		}
+	}
+
+	if settings.SMTPUsername != "" {
+		if err := client.Auth(smtp.PlainAuth("", settings.SMTPUsername,
+			settings.SMTPPassword, settings.SMTPHost)); err != nil {
+			return fmt.Errorf("logging in: %s", err)
+		}
+	}
+
+	if err := client.Mail(from); err != nil {
+		return fmt.Errorf("MAIL: %s", err)
+	}
+	if err := client.Rcpt(to); err != nil {
+		return fmt.Errorf("RCPT: %s", err)
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("DATA: %s", err)
+	}
+	if _, err := w.Write(message); err != nil {
+		return fmt.Errorf("writing message: %s", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("sending message: %s", err)
+	}
+
+	return client.Quit()
+}
+
+// setShareEmail sets where the user with the email emails items they share
+// unless they say otherwise. none means nowhere.
+func setShareEmail(ctx context.Context, settings *Config, email,
+	shareEmail string) error {
+	if shareEmail == "none" {
+		shareEmail = ""
+	}
+
+	db, err := connectToDB(settings)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := db.Close(); err != nil {
+			log.Printf("Database close: %s", err)
+		}
+	}()
+
+	user, err := findUserByEmail(ctx, db, email)
+	if err != nil {
+		return err
+	}
+
+	return gorse.UpdateShareEmail(ctx, db, user.ID, shareEmail)
+}
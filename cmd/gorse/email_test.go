@@ -0,0 +1,243 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/mail"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/sessions"
+	"github.com/horgh/gorse"
+	"github.com/horgh/gorse/internal/gorsetest"
+	"github.com/horgh/rss"
+)
+
+// smtpServer is an SMTP server that accepts each message and sends it on the
+// channel along with who it was to.
+func smtpServer(t *testing.T) (string, int64, <-chan string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listening: %s", err)
+	}
+	t.Cleanup(func() {
+		_ = listener.Close()
+	})
+
+	messages := make(chan string, 10)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer func() {
+					_ = conn.Close()
+				}()
+				r := bufio.NewReader(conn)
+				reply := func(line string) {
+					_, _ = fmt.Fprintf(conn, "%s\r\n", line)
+				}
+				reply("220 localhost ESMTP")
+				var rcpt, data string
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					command := strings.ToUpper(strings.Fields(line + " x")[0])
+					switch command {
+					case "EHLO", "HELO", "MAIL":
+						reply("250 OK")
+					case "RCPT":
+						rcpt = strings.TrimSpace(line)
+						reply("250 OK")
+					case "DATA":
+						reply("354 Go ahead")
+						for {
+							line, err := r.ReadString('\n')
+							if err != nil {
+								return
+							}
+							if line == ".\r\n" {
+								break
+							}
+							data += line
+						}
+						messages <- rcpt + "\n" + data
+						reply("250 OK")
+					case "QUIT":
+						reply("221 Bye")
+						return
+					default:
+						reply("502 Unknown")
+					}
+				}
+			}()
+		}
+	}()
+
+	port := listener.Addr().(*net.TCPAddr).Port
+	return "127.0.0.1", int64(port), messages
+}
+
+func TestHandlerEmailItemIntegration(t *testing.T) {
+	for _, dbType := range gorsetest.Types {
+		t.Run(dbType, func(t *testing.T) {
+			testHandlerEmailItemIntegration(t, dbType)
+		})
+	}
+}
+
+func testHandlerEmailItemIntegration(t *testing.T, dbType string) {
+	store, _ := gorsetest.Store(t, dbType)
+
+	loaded := gorsetest.Load(t, store, gorsetest.Fixture{
+		Users: []gorsetest.User{
+			{Email: "user@example.com", Password: "password"},
+		},
+		Feeds: []gorsetest.Feed{
+			{
+				DBFeed: gorse.DBFeed{
+					Name:                   "Example",
+					URI:                    "https://example.com/feed",
+					UpdateFrequencySeconds: 3600,
+					Active:                 true,
+				},
+				Items: []rss.Item{
+					{Title: "One", Link: "https://example.com/1",
+						Description: "<p>About <b>one</b></p>", PubDate: time.Now()},
+				},
+				Subscribers: []string{"user@example.com"},
+			},
+		},
+	})
+	userID := loaded.Users["user@example.com"]
+	itemID := loaded.Items["https://example.com/1"]
+
+	host, port, messages := smtpServer(t)
+	settings := &Config{
+		SMTPHost: host,
+		SMTPPort: port,
+		SMTPFrom: "gorse@example.com",
+	}
+
+	sessionStore := sessions.NewCookieStore([]byte(strings.Repeat("k", 32)))
+
+	emailItem := func(to string) *httptest.ResponseRecorder {
+		form := url.Values{}
+		form.Set("item-id", fmt.Sprintf("%d", itemID))
+		form.Set("to", to)
+
+		request := httptest.NewRequest(http.MethodPost, "/email_item",
+			strings.NewReader(form.Encode()))
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		session, err := sessionStore.New(request, "gorse")
+		if err != nil {
+			t.Fatalf("creating session: %s", err)
+		}
+		session.Values[sessionUserKey] = userID
+
+		rw := httptest.NewRecorder()
+		handlerEmailItem(rw, request, settings, store, session)
+		return rw
+	}
+
+	// There's no address given and the user has no default.
+	if rw := emailItem(""); rw.Code != http.StatusBadRequest {
+		t.Errorf("handlerEmailItem() with no address = status %d, wanted %d",
+			rw.Code, http.StatusBadRequest)
+	}
+
+	if err := store.UpdateShareEmail(context.Background(), userID,
+		"friend@example.com"); err != nil {
+		t.Fatalf("UpdateShareEmail() = error %s", err)
+	}
+
+	for _, to := range []string{"", "other@example.com"} {
+		rw := emailItem(to)
+		if rw.Code != http.StatusFound {
+			t.Fatalf("handlerEmailItem(%q) = status %d, wanted %d: %s", to,
+				rw.Code, http.StatusFound, rw.Body.String())
+		}
+
+		wantTo := to
+		if wantTo == "" {
+			wantTo = "friend@example.com"
+		}
+
+		select {
+		case message := <-messages:
+			if !strings.Contains(message, "RCPT TO:<"+wantTo+">") ||
+				!strings.Contains(message, "Subject: One") ||
+				!strings.Contains(message, "About one") {
+				t.Errorf("emailed %q, wanted item One to %s", message, wantTo)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("no email sent to %s", wantTo)
+		}
+	}
+
+	settings.SMTPHost = ""
+	if rw := emailItem(""); rw.Code != http.StatusBadRequest {
+		t.Errorf("handlerEmailItem() without SMTP = status %d, wanted %d",
+			rw.Code, http.StatusBadRequest)
+	}
+}
+
+func TestItemEmail(t *testing.T) {
+	item := &gorse.UserItem{
+		DBItem: gorse.DBItem{
+			Title:       "Caf&eacute;\r\nBcc: victim@example.com",
+			Link:        "https://example.com/cafe",
+			Description: "<p>Coffee &amp; cake</p>",
+		},
+	}
+
+	message, err := itemEmail(&mail.Address{Address: "gorse@example.com"},
+		&mail.Address{Address: "friend@example.com"}, "user@example.com", item,
+		time.Date(2020, 3, 1, 14, 5, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("itemEmail() = error %s", err)
+	}
+
+	parsed, err := mail.ReadMessage(strings.NewReader(string(message)))
+	if err != nil {
+		t.Fatalf("itemEmail() wrote an invalid message: %s: %s", err, message)
+	}
+
+	if bcc := parsed.Header.Get("Bcc"); bcc != "" {
+		t.Errorf("itemEmail() let the title add a Bcc header: %s", bcc)
+	}
+
+	subject, err := new(mime.WordDecoder).DecodeHeader(
+		parsed.Header.Get("Subject"))
+	if err != nil {
+		t.Fatalf("decoding subject: %s", err)
+	}
+	if subject != "Café Bcc: victim@example.com" {
+		t.Errorf("subject = %q", subject)
+	}
+	if got := parsed.Header.Get("Reply-To"); got != "<user@example.com>" {
+		t.Errorf("Reply-To = %q, wanted the user", got)
+	}
+
+	body, err := ioutil.ReadAll(parsed.Body)
+	if err != nil {
+		t.Fatalf("reading body: %s", err)
+	}
+	if !strings.Contains(string(body), "Coffee & cake") ||
+		!strings.Contains(string(body), "https://example.com/cafe") {
+		t.Errorf("body = %q, wanted the link and description as text", body)
+	}
+}
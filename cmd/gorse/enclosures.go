@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/horgh/gorse"
+)
+
+// HTMLEnclosure is an item's enclosure as we show it in the list.
+type HTMLEnclosure struct {
+	URL string
+
+	// Whether to give a player for it.
+	Audio bool
+	Video bool
+
+	// Size and Duration are blank if the feed didn't say.
+	Size     string
+	Duration string
+}
+
+// newHTMLEnclosures prepares the item's enclosures for showing.
+func newHTMLEnclosures(enclosures []gorse.Enclosure) []HTMLEnclosure {
+	var htmlEnclosures []HTMLEnclosure
+	for _, e := range enclosures {
+		htmlEnclosures = append(htmlEnclosures, HTMLEnclosure{
+			URL:      e.URL,
+			Audio:    e.Audio(),
+			Video:    e.Video(),
+			Size:     formatSize(e.Length),
+			Duration: formatPlayTime(e.Duration),
+		})
+	}
+	return htmlEnclosures
+}
+
+// formatSize describes a number of bytes, such as 12.3 MB.
+func formatSize(bytes int64) string {
+	if bytes <= 0 {
+		return ""
+	}
+	if bytes < 1000 {
+		return fmt.Sprintf("%d B", bytes)
+	}
+
+	size := float64(bytes)
+	for _, unit := range []string{"kB", "MB", "GB"} {
+		size /= 1000
+		if size < 1000 || unit == "GB" {
+			return fmt.Sprintf("%.1f %s", size, unit)
+		}
+	}
+	return ""
+}
+
+// formatPlayTime describes how long something plays, such as 1:02:03 or
+// 4:05.
+func formatPlayTime(d time.Duration) string {
+	if d <= 0 {
+		return ""
+	}
+
+	seconds := int64(d / time.Second)
+	if seconds >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", seconds/3600, seconds%3600/60,
+			seconds%60)
+	}
+	return fmt.Sprintf("%d:%02d", seconds/60, seconds%60)
+}
@@ -0,0 +1,346 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/mail"
+	"net/textproto"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/sessions"
+	"github.com/horgh/gorse"
+	"github.com/horgh/gorse/internal/epub"
+)
+
+// maxBookItems is how many items can go in one book. This is a page's worth.
+const maxBookItems = pageSize
+
+// bookFetchTimeout is how long we spend fetching articles for a book. Once
+// it's up, items we don't have a reader view of yet get their description.
+const bookFetchTimeout = 2 * time.Minute
+
+// handlerExportEPUB bundles the items the user selected, usually from their
+// items to read later, into an EPUB book so that they can read them offline
+// on an e-reader. The items are in the item-id parameters.
+//
+// It implements the type RequestHandlerFunc.
+//
+// Each item's chapter is its reader view, which we fetch if we don't have it
+// yet. If we can't, we use the item's description.
+//
+// With send=kindle we email the book to the address in the kindle parameter,
+// or if that's blank, the user's Kindle email, and redirect back to the list
+// of items. Otherwise the response is the book.
+func handlerExportEPUB(rw http.ResponseWriter, request *http.Request,
+	settings *Config, store gorse.Store, session *sessions.Session) {
+	if err := request.ParseForm(); err != nil {
+		logf(request, "Failed to parse form: %s", err)
+		if bodyTooLarge(err) {
+			send413Error(rw, tooLargeError(settings.maxFormBytes()))
+			return
+		}
+		send400Error(rw, "Failed to parse request")
+		return
+	}
+
+	userID, ok := sessionUser(rw, request, settings, session)
+	if !ok {
+		return
+	}
+
+	var itemIDs []int64
+	for _, itemIDStr := range request.PostForm["item-id"] {
+		itemID, err := strconv.ParseInt(itemIDStr, 10, 64)
+		if err != nil {
+			logf(request, "Bad item ID: %s: %s", itemIDStr, err)
+			send400Error(rw, "Bad item ID")
+			return
+		}
+		itemIDs = append(itemIDs, itemID)
+	}
+	if len(itemIDs) == 0 {
+		logf(request, "No items to export.")
+		send400Error(rw, "Select the items to put in the book")
+		return
+	}
+	if len(itemIDs) > maxBookItems {
+		logf(request, "Too many items to export: %d", len(itemIDs))
+		send400Error(rw, fmt.Sprintf("A book can have at most %d items",
+			maxBookItems))
+		return
+	}
+
+	user, err := store.GetUser(request.Context(), userID)
+	if err != nil {
+		logf(request, "Unable to look up user: %s", err)
+		send500Error(rw, "Unable to look up user")
+		return
+	}
+
+	// We check where we're sending the book before we go to the trouble of
+	// making it.
+	kindle := request.PostForm.Get("send") == "kindle"
+	var toAddress *mail.Address
+	if kindle {
+		if settings.SMTPHost == "" {
+			logf(request, "Not emailing book as there is no SMTPHost.")
+			send400Error(rw, "Emailing books is not set up")
+			return
+		}
+		to := strings.TrimSpace(request.PostForm.Get("kindle"))
+		if to == "" {
+			to = user.KindleEmail
+		}
+		if to == "" {
+			logf(request, "No address to email book to")
+			send400Error(rw, "Give your Kindle's email address")
+			return
+		}
+		toAddress, err = mail.ParseAddress(to)
+		if err != nil {
+			logf(request, "Invalid address to email book to: %s: %s", to, err)
+			send400Error(rw, "Invalid email address")
+			return
+		}
+	}
+
+	date := time.Now()
+	book := epub.Book{
+		Title: "gorse " + date.Format("2006-01-02"),
+		Date:  date,
+	}
+
+	fetchCtx, cancel := context.WithTimeout(request.Context(), bookFetchTimeout)
+	defer cancel()
+
+	for _, itemID := range itemIDs {
+		item, err := store.GetItem(request.Context(), itemID, userID)
+		if err != nil {
+			logf(request, "Unable to look up item %d: %s", itemID, err)
+			send500Error(rw, "Unable to look up item")
+			return
+		}
+
+		chapter, err := bookChapter(fetchCtx, request, store, item)
+		if err != nil {
+			logf(request, "Unable to make chapter of item %d: %s", itemID, err)
+			send500Error(rw, "Unable to make the book")
+			return
+		}
+		book.Chapters = append(book.Chapters, chapter)
+	}
+
+	var buf bytes.Buffer
+	if err := epub.Write(&buf, book); err != nil {
+		logf(request, "Unable to write EPUB: %s", err)
+		send500Error(rw, "Unable to make the book")
+		return
+	}
+
+	filename := fmt.Sprintf("gorse-%s.epub", date.Format("2006-01-02"))
+
+	if !kindle {
+		logf(request, "Exported %d items as EPUB", len(book.Chapters))
+		rw.Header().Set("Content-Type", "application/epub+zip")
+		rw.Header().Set("Content-Disposition", mime.FormatMediaType("attachment",
+			map[string]string{"filename": filename}))
+		if _, err := rw.Write(buf.Bytes()); err != nil {
+			logf(request, "Unable to write EPUB response: %s", err)
+		}
+		return
+	}
+
+	// We checked SMTPFrom when validating the config.
+	fromAddress, err := mail.ParseAddress(settings.SMTPFrom)
+	if err != nil {
+		logf(request, "Invalid SMTPFrom: %s", err)
+		send500Error(rw, "Unable to email the book")
+		return
+	}
+
+	message, err := bookEmail(fromAddress, toAddress, book.Title, filename,
+		buf.Bytes(), date)
+	if err != nil {
+		logf(request, "Unable to write email: %s", err)
+		send500Error(rw, "Unable to email the book")
+		return
+	}
+
+	if err := sendEmail(request.Context(), settings, fromAddress.Address,
+		toAddress.Address, message); err != nil {
+		logf(request, "Unable to email book to %s: %s", toAddress.Address, err)
+		send500Error(rw, "Unable to email the book")
+		return
+	}
+
+	logf(request, "Emailed book of %d items to %s", len(book.Chapters),
+		toAddress.Address)
+
+	session.AddFlash("Sent to your Kindle.")
+
+	if err := session.Save(request, rw); err != nil {
+		logf(request, "Unable to save session: %s", err)
+		send500Error(rw, "Failed to save your session.")
+		return
+	}
+
+	uri := fmt.Sprintf("%s/?read-state=%s&page=%s",
+		settings.URIPrefix,
+		url.QueryEscape(gorse.ReadLater.String()),
+		url.QueryEscape(request.PostForm.Get("page")),
+	)
+	uri += listViewParams(request.PostForm)
+
+	logf(request, "Redirecting to %s", uri)
+
+	http.Redirect(rw, request, uri, http.StatusFound)
+}
+
+// bookChapter makes the item's chapter of a book.
+//
+// We use the item's reader view, fetching and keeping it if we don't have it
+// yet as handlerReader does. We fetch it with fetchCtx so that we can give up
+// on fetching without giving up on the book. If we can't fetch it, we use the
+// item's description, keeping only what a reader view would.
+func bookChapter(fetchCtx context.Context, request *http.Request,
+	store gorse.Store, item *gorse.UserItem) (epub.Chapter, error) {
+	chapter := epub.Chapter{
+		Title:  strings.Join(strings.Fields(sanitiseItemText(item.Title)), " "),
+		Source: item.FeedName,
+		Link:   item.Link,
+	}
+
+	view, err := store.GetReaderView(request.Context(), item.ID)
+	if err != nil && err != gorse.ErrNotFound {
+		return epub.Chapter{}, err
+	}
+
+	if view == nil && fetchCtx.Err() == nil {
+		fetched, err := fetchReaderView(request.WithContext(fetchCtx), item)
+		if err != nil {
+			logf(request, "Unable to fetch reader view of item %d: %s", item.ID,
+				err)
+		} else {
+			if err := store.SetReaderView(request.Context(),
+				*fetched); err != nil {
+				return epub.Chapter{}, err
+			}
+			view = fetched
+		}
+	}
+
+	if view == nil {
+		description, err := gorse.ExtractReaderView(
+			[]byte("<body>"+item.Description+"</body>"), "text/html; charset=utf-8",
+			item.Link)
+		if err == nil {
+			view = &description
+		}
+	}
+
+	if view != nil {
+		if chapter.Title == "" {
+			chapter.Title = view.Title
+		}
+		chapter.HTML = string(view.Content)
+	}
+	if chapter.Title == "" {
+		chapter.Title = item.Link
+	}
+
+	return chapter, nil
+}
+
+// bookEmail writes an email with the book attached.
+func bookEmail(from, to *mail.Address, subject, filename string, book []byte,
+	date time.Time) ([]byte, error) {
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+
+	text, err := w.CreatePart(textproto.MIMEHeader{
+		"Content-Type": {"text/plain; charset=utf-8"},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("writing text: %s", err)
+	}
+	if _, err := text.Write([]byte("Sent from gorse.\r\n")); err != nil {
+		return nil, fmt.Errorf("writing text: %s", err)
+	}
+
+	attachment, err := w.CreatePart(textproto.MIMEHeader{
+		"Content-Type": {mime.FormatMediaType("application/epub+zip",
+			map[string]string{"name": filename})},
+		"Content-Disposition": {mime.FormatMediaType("attachment",
+			map[string]string{"filename": filename})},
+		"Content-Transfer-Encoding": {"base64"},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("writing attachment: %s", err)
+	}
+	// Lines can be at most 76 characters in base64 bodies.
+	encoded := base64.StdEncoding.EncodeToString(book)
+	for len(encoded) > 76 {
+		if _, err := attachment.Write([]byte(encoded[:76] + "\r\n")); err != nil {
+			return nil, fmt.Errorf("writing attachment: %s", err)
+		}
+		encoded = encoded[76:]
+	}
+	if _, err := attachment.Write([]byte(encoded + "\r\n")); err != nil {
+		return nil, fmt.Errorf("writing attachment: %s", err)
+	}
+
+	if err := w.Close(); err != nil {
+		return nil, fmt.Errorf("writing email: %s", err)
+	}
+
+	var buf bytes.Buffer
+	header := func(name, value string) {
+		fmt.Fprintf(&buf, "%s: %s\r\n", name, value)
+	}
+	header("From", from.String())
+	header("To", to.String())
+	header("Subject", mime.QEncoding.Encode("utf-8", subject))
+	header("Date", date.Format(time.RFC1123Z))
+	header("MIME-Version", "1.0")
+	header("Content-Type", mime.FormatMediaType("multipart/mixed",
+		map[string]string{"boundary": w.Boundary()}))
+	buf.WriteString("\r\n")
+	buf.Write(body.Bytes())
+
+	return buf.Bytes(), nil
+}
+
+// setKindleEmail sets where we email books of the user with the email's items
+// to read later. none means nowhere.
+func setKindleEmail(ctx context.Context, settings *Config, email,
+	kindleEmail string) error {
+	if kindleEmail == "none" {
+		kindleEmail = ""
+	}
+
+	db, err := connectToDB(settings)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := db.Close(); err != nil {
+			log.Printf("Database close: %s", err)
+		}
+	}()
+
+	user, err := findUserByEmail(ctx, db, email)
+	if err != nil {
+		return err
+	}
+
+	return gorse.UpdateKindleEmail(ctx, db, user.ID, kindleEmail)
+}
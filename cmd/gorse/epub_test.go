@@ -0,0 +1,209 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/mail"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/sessions"
+	"github.com/horgh/gorse"
+	"github.com/horgh/gorse/internal/gorsetest"
+	"github.com/horgh/rss"
+)
+
+func TestHandlerExportEPUBIntegration(t *testing.T) {
+	for _, dbType := range gorsetest.Types {
+		t.Run(dbType, func(t *testing.T) {
+			testHandlerExportEPUBIntegration(t, dbType)
+		})
+	}
+}
+
+func testHandlerExportEPUBIntegration(t *testing.T, dbType string) {
+	store, _ := gorsetest.Store(t, dbType)
+
+	site := httptest.NewServer(http.HandlerFunc(
+		func(rw http.ResponseWriter, request *http.Request) {
+			if request.URL.Path != "/1" {
+				http.NotFound(rw, request)
+				return
+			}
+			rw.Header().Set("Content-Type", "text/html; charset=utf-8")
+			_, _ = rw.Write([]byte(`<title>Story</title>
+<article><p>The whole story.</p></article>`))
+		}))
+	defer site.Close()
+
+	loaded := gorsetest.Load(t, store, gorsetest.Fixture{
+		Users: []gorsetest.User{
+			{Email: "user@example.com", Password: "password"},
+		},
+		Feeds: []gorsetest.Feed{
+			{
+				DBFeed: gorse.DBFeed{
+					Name:                   "Example",
+					URI:                    "https://example.com/feed",
+					UpdateFrequencySeconds: 3600,
+					Active:                 true,
+				},
+				Items: []rss.Item{
+					{Title: "One", Link: site.URL + "/1", PubDate: time.Now()},
+					{Title: "Two", Link: site.URL + "/2",
+						Description: "<p>About <b>two</b></p>", PubDate: time.Now()},
+				},
+				Subscribers: []string{"user@example.com"},
+			},
+		},
+	})
+	userID := loaded.Users["user@example.com"]
+	itemOne := loaded.Items[site.URL+"/1"]
+	itemTwo := loaded.Items[site.URL+"/2"]
+
+	host, port, messages := smtpServer(t)
+	settings := &Config{
+		SMTPHost: host,
+		SMTPPort: port,
+		SMTPFrom: "gorse@example.com",
+	}
+
+	sessionStore := sessions.NewCookieStore([]byte(strings.Repeat("k", 32)))
+
+	export := func(form url.Values) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodPost, "/export_epub",
+			strings.NewReader(form.Encode()))
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		session, err := sessionStore.New(request, "gorse")
+		if err != nil {
+			t.Fatalf("creating session: %s", err)
+		}
+		session.Values[sessionUserKey] = userID
+
+		rw := httptest.NewRecorder()
+		handlerExportEPUB(rw, request, settings, store, session)
+		return rw
+	}
+
+	items := []string{fmt.Sprintf("%d", itemOne), fmt.Sprintf("%d", itemTwo)}
+
+	if rw := export(url.Values{}); rw.Code != http.StatusBadRequest {
+		t.Errorf("handlerExportEPUB() with no items = status %d, wanted %d",
+			rw.Code, http.StatusBadRequest)
+	}
+
+	rw := export(url.Values{"item-id": items})
+	if rw.Code != http.StatusOK ||
+		rw.Header().Get("Content-Type") != "application/epub+zip" {
+		t.Fatalf("handlerExportEPUB() = status %d %v, wanted an EPUB: %s",
+			rw.Code, rw.Header(), rw.Body.String())
+	}
+	checkBook(t, rw.Body.Bytes())
+
+	// We keep the reader view we fetched.
+	if _, err := store.GetReaderView(context.Background(),
+		itemOne); err != nil {
+		t.Errorf("GetReaderView() = error %s, wanted the fetched view", err)
+	}
+
+	// There's no Kindle address given and the user has no default.
+	rw = export(url.Values{"item-id": items, "send": {"kindle"}})
+	if rw.Code != http.StatusBadRequest {
+		t.Errorf("handlerExportEPUB() to Kindle with no address = status %d, "+
+			"wanted %d", rw.Code, http.StatusBadRequest)
+	}
+
+	if err := store.UpdateKindleEmail(context.Background(), userID,
+		"me@kindle.com"); err != nil {
+		t.Fatalf("UpdateKindleEmail() = error %s", err)
+	}
+
+	rw = export(url.Values{"item-id": items, "send": {"kindle"}})
+	if rw.Code != http.StatusFound {
+		t.Fatalf("handlerExportEPUB() to Kindle = status %d, wanted %d: %s",
+			rw.Code, http.StatusFound, rw.Body.String())
+	}
+
+	select {
+	case message := <-messages:
+		if !strings.HasPrefix(message, "RCPT TO:<me@kindle.com>") {
+			t.Errorf("emailed %q, wanted the Kindle", message)
+		}
+		checkBook(t, bookAttachment(t, message[strings.Index(message, "\n")+1:]))
+	case <-time.After(5 * time.Second):
+		t.Fatal("no email sent to the Kindle")
+	}
+}
+
+// checkBook checks the EPUB has the exported items' chapters.
+func checkBook(t *testing.T, book []byte) {
+	r, err := zip.NewReader(bytes.NewReader(book), int64(len(book)))
+	if err != nil {
+		t.Fatalf("book is not a zip: %s", err)
+	}
+
+	var chapters []string
+	for _, f := range r.File {
+		if !strings.HasPrefix(f.Name, "OEBPS/chapter-") {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatalf("opening %s: %s", f.Name, err)
+		}
+		data, err := ioutil.ReadAll(rc)
+		_ = rc.Close()
+		if err != nil {
+			t.Fatalf("reading %s: %s", f.Name, err)
+		}
+		chapters = append(chapters, string(data))
+	}
+
+	if len(chapters) != 2 ||
+		!strings.Contains(chapters[0], "The whole story.") ||
+		!strings.Contains(chapters[1], "About <b>two</b>") {
+		t.Errorf("book chapters = %q, wanted the article and the description",
+			chapters)
+	}
+}
+
+// bookAttachment finds the book attached to the email.
+func bookAttachment(t *testing.T, message string) []byte {
+	parsed, err := mail.ReadMessage(strings.NewReader(message))
+	if err != nil {
+		t.Fatalf("invalid message: %s: %s", err, message)
+	}
+
+	_, params, err := mime.ParseMediaType(parsed.Header.Get("Content-Type"))
+	if err != nil {
+		t.Fatalf("invalid Content-Type: %s", err)
+	}
+
+	r := multipart.NewReader(parsed.Body, params["boundary"])
+	for {
+		part, err := r.NextPart()
+		if err != nil {
+			t.Fatalf("no book attached: %s", err)
+		}
+		if !strings.HasPrefix(part.Header.Get("Content-Type"),
+			"application/epub+zip") {
+			continue
+		}
+		book, err := ioutil.ReadAll(base64.NewDecoder(base64.StdEncoding, part))
+		if err != nil {
+			t.Fatalf("decoding book: %s", err)
+		}
+		return book
+	}
+}
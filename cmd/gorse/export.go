@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/sessions"
+	"github.com/horgh/gorse"
+)
+
+// handlerExport sends all of the user's data as a JSON file to download.
+//
+// It implements the type RequestHandlerFunc.
+func handlerExport(rw http.ResponseWriter, request *http.Request,
+	settings *Config, store gorse.Store, session *sessions.Session) {
+	userID, ok := sessionUser(rw, request, settings, session)
+	if !ok {
+		return
+	}
+
+	// Check the user exists while we can still send an error.
+	if _, err := store.GetUser(request.Context(), userID); err != nil {
+		logf(request, "Unable to export user ID [%d]: %s", userID, err)
+		send500Error(rw, "Unable to export")
+		return
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+	rw.Header().Set("Content-Disposition", fmt.Sprintf(
+		"attachment; filename=\"gorse-export-%s.json\"",
+		time.Now().Format("2006-01-02")))
+
+	// Once we start writing we can't send an error status. A failed export is
+	// missing its end so it won't parse.
+	if err := store.ExportUser(request.Context(), userID, rw); err != nil {
+		logf(request, "Unable to export user ID [%d]: %s", userID, err)
+	}
+}
+
+// exportUser writes the data of the user with the email as JSON.
+func exportUser(ctx context.Context, settings *Config, email string,
+	w io.Writer) error {
+	db, err := connectToDB(settings)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err := db.Close(); err != nil {
+			log.Printf("Database close: %s", err)
+		}
+	}()
+
+	user, err := findUserByEmail(ctx, db, email)
+	if err != nil {
+		return err
+	}
+
+	return gorse.ExportUser(ctx, db, user.ID, w)
+}
+
+// findUserByEmail looks up the user with the email.
+func findUserByEmail(ctx context.Context, db gorse.Querier,
+	email string) (*gorse.User, error) {
+	users, err := gorse.ListUsers(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, user := range users {
+		if user.Email == strings.ToLower(strings.TrimSpace(email)) {
+			return &user, nil
+		}
+	}
+
+	return nil, fmt.Errorf("user not found: %s", email)
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/horgh/gorse"
+	"github.com/horgh/gorse/internal/gorsetest"
+	"github.com/horgh/rss"
+)
+
+func TestHandlerExportIntegration(t *testing.T) {
+	for _, dbType := range gorsetest.Types {
+		t.Run(dbType, func(t *testing.T) {
+			testHandlerExportIntegration(t, dbType)
+		})
+	}
+}
+
+func testHandlerExportIntegration(t *testing.T, dbType string) {
+	store, db := gorsetest.Store(t, dbType)
+
+	loaded := gorsetest.Load(t, store, gorsetest.Fixture{
+		Users: []gorsetest.User{
+			{Email: "user@example.com", Password: "password"},
+		},
+		Feeds: []gorsetest.Feed{
+			{
+				DBFeed: gorse.DBFeed{
+					Name:                   "Example",
+					URI:                    "https://example.com/feed",
+					UpdateFrequencySeconds: 3600,
+					Active:                 true,
+				},
+				Items: []rss.Item{
+					{Title: "One", Link: "https://example.com/1", PubDate: time.Now()},
+					{Title: "Two", Link: "https://example.com/2", PubDate: time.Now()},
+				},
+				Subscribers: []string{"user@example.com"},
+			},
+		},
+	})
+	userID := loaded.Users["user@example.com"]
+
+	if err := store.SetItemReadState(context.Background(),
+		loaded.Items["https://example.com/1"], userID,
+		gorse.ReadLater); err != nil {
+		t.Fatalf("SetItemReadState() = error %s", err)
+	}
+
+	user, err := findUserByEmail(context.Background(), db, " User@example.com")
+	if err != nil {
+		t.Fatalf("findUserByEmail() = error %s", err)
+	}
+	if user.ID != userID {
+		t.Errorf("findUserByEmail() = user ID %d, wanted %d", user.ID, userID)
+	}
+
+	rw := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodGet, "/export", nil)
+	handlerExport(rw, request, &Config{}, store,
+		loggedInSession(t, request, userID))
+	if rw.Code != http.StatusOK {
+		t.Fatalf("handlerExport() = status %d, wanted %d", rw.Code,
+			http.StatusOK)
+	}
+
+	var export struct {
+		User struct {
+			Email string `json:"email"`
+		} `json:"user"`
+		Subscriptions []gorse.ExportedFeed `json:"subscriptions"`
+		Items         []gorse.ExportedItem `json:"items"`
+	}
+	if err := json.Unmarshal(rw.Body.Bytes(), &export); err != nil {
+		t.Fatalf("export is not JSON: %s: %s", err, rw.Body.String())
+	}
+	if export.User.Email != "user@example.com" {
+		t.Errorf("export user = %s, wanted user@example.com", export.User.Email)
+	}
+	if len(export.Subscriptions) != 1 {
+		t.Errorf("export has %d subscriptions, wanted 1",
+			len(export.Subscriptions))
+	}
+	if len(export.Items) != 1 || export.Items[0].State != "read-later" {
+		t.Errorf("export items = %+v, wanted the one read later", export.Items)
+	}
+
+	rw = httptest.NewRecorder()
+	request = httptest.NewRequest(http.MethodGet, "/export", nil)
+	handlerExport(rw, request, &Config{}, store,
+		loggedInSession(t, request, 99))
+	if rw.Code != http.StatusInternalServerError {
+		t.Errorf("handlerExport() of missing user = status %d, wanted %d",
+			rw.Code, http.StatusInternalServerError)
+	}
+}
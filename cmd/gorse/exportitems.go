@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/sessions"
+	"github.com/horgh/gorse"
+)
+
+// exportBatchSize is how many items we retrieve at a time while exporting.
+const exportBatchSize = 500
+
+// exportedItem is an item as handlerExportItems describes it.
+type exportedItem struct {
+	Title           string    `json:"title"`
+	Link            string    `json:"link"`
+	Feed            string    `json:"feed"`
+	PublicationDate time.Time `json:"publication_date"`
+	State           string    `json:"state"`
+}
+
+// handlerExportItems sends the items a list of items shows as a file to
+// download, all of them rather than a page. It takes the list's parameters,
+// such as read-state, and format, which is csv (the default) or json.
+//
+// Each item has its title, link, feed, publication date, and state. CSV has a
+// header row naming these. JSON is an array of objects:
+//
+//	[{"title": "...", "link": "...", "feed": "...",
+//	  "publication_date": "...", "state": "unread"}]
+//
+// It implements the type RequestHandlerFunc.
+func handlerExportItems(rw http.ResponseWriter, request *http.Request,
+	settings *Config, store gorse.Store, session *sessions.Session) {
+	requestValues := request.URL.Query()
+
+	userID, ok := sessionUser(rw, request, settings, session)
+	if !ok {
+		return
+	}
+
+	format := requestValues.Get("format")
+	if format == "" {
+		format = "csv"
+	}
+	if format != "csv" && format != "json" {
+		logf(request, "Bad format: %s", format)
+		send400Error(rw, "Bad format")
+		return
+	}
+
+	feedID, err := listFeedID(requestValues)
+	if err != nil {
+		logf(request, "%s", err)
+		send400Error(rw, "Bad feed ID")
+		return
+	}
+
+	filter, err := listFilter(request.Context(), store, requestValues, userID,
+		feedID)
+	if err != nil {
+		logf(request, "Unable to look up muted keywords: %s", err)
+		send500Error(rw, "Unable to look up muted keywords")
+		return
+	}
+
+	// Check we can find items while we can still send an error.
+	filter.Limit = exportBatchSize
+	items, err := store.FindItems(request.Context(), filter)
+	if err != nil {
+		logf(request, "Unable to retrieve items: %s", err)
+		send500Error(rw, "Unable to retrieve items")
+		return
+	}
+
+	contentType := "text/csv; charset=utf-8"
+	if format == "json" {
+		contentType = "application/json"
+	}
+	rw.Header().Set("Content-Type", contentType)
+	rw.Header().Set("Content-Disposition", fmt.Sprintf(
+		"attachment; filename=\"gorse-items-%s.%s\"",
+		time.Now().Format("2006-01-02"), format))
+
+	// Once we start writing we can't send an error status. A failed export is
+	// missing items, and in JSON its end so it won't parse.
+	write := writeItemsCSV
+	if format == "json" {
+		write = writeItemsJSON
+	}
+	count, err := write(request.Context(), store, filter, items, rw)
+	if err != nil {
+		logf(request, "Unable to export items: %s", err)
+		return
+	}
+
+	logf(request, "Exported %d items as %s", count, format)
+}
+
+// exportItems calls the function with each batch of items matching the
+// filter, starting with the first batch, which we already retrieved. We go
+// through the items by their position rather than offset so that items
+// changing state as we go don't make us skip any. We return how many there
+// were.
+func exportItems(ctx context.Context, store gorse.Store,
+	filter gorse.ItemFilter, items []gorse.UserItem,
+	fn func([]gorse.UserItem) error) (int, error) {
+	count := 0
+	for {
+		if err := fn(items); err != nil {
+			return count, err
+		}
+		count += len(items)
+
+		if len(items) < filter.Limit {
+			return count, nil
+		}
+
+		cursor := items[len(items)-1].Cursor()
+		filter.After = &cursor
+		var err error
+		if items, err = store.FindItems(ctx, filter); err != nil {
+			return count, err
+		}
+	}
+}
+
+// newExportedItem describes the item for export.
+func newExportedItem(item gorse.UserItem) exportedItem {
+	return exportedItem{
+		Title:           sanitiseItemText(item.Title),
+		Link:            item.Link,
+		Feed:            item.FeedName,
+		PublicationDate: item.PublicationDate.UTC(),
+		State:           item.ReadState.String(),
+	}
+}
+
+// writeItemsCSV writes the items matching the filter as CSV.
+func writeItemsCSV(ctx context.Context, store gorse.Store,
+	filter gorse.ItemFilter, items []gorse.UserItem,
+	rw http.ResponseWriter) (int, error) {
+	w := csv.NewWriter(rw)
+	if err := w.Write([]string{"title", "link", "feed", "date",
+		"state"}); err != nil {
+		return 0, err
+	}
+
+	count, err := exportItems(ctx, store, filter, items,
+		func(items []gorse.UserItem) error {
+			for _, item := range items {
+				e := newExportedItem(item)
+				if err := w.Write([]string{e.Title, e.Link, e.Feed,
+					e.PublicationDate.Format(time.RFC3339), e.State}); err != nil {
+					return err
+				}
+			}
+			w.Flush()
+			return w.Error()
+		})
+	if err != nil {
+		return count, err
+	}
+
+	w.Flush()
+	return count, w.Error()
+}
+
+// writeItemsJSON writes the items matching the filter as a JSON array.
+func writeItemsJSON(ctx context.Context, store gorse.Store,
+	filter gorse.ItemFilter, items []gorse.UserItem,
+	rw http.ResponseWriter) (int, error) {
+	if _, err := rw.Write([]byte("[")); err != nil {
+		return 0, err
+	}
+
+	first := true
+	count, err := exportItems(ctx, store, filter, items,
+		func(items []gorse.UserItem) error {
+			for _, item := range items {
+				buf, err := json.Marshal(newExportedItem(item))
+				if err != nil {
+					return err
+				}
+				if !first {
+					buf = append([]byte(",\n"), buf...)
+				}
+				first = false
+				if _, err := rw.Write(buf); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	if err != nil {
+		return count, err
+	}
+
+	_, err = rw.Write([]byte("]\n"))
+	return count, err
+}
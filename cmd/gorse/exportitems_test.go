@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/sessions"
+	"github.com/horgh/gorse"
+	"github.com/horgh/gorse/internal/gorsetest"
+	"github.com/horgh/rss"
+)
+
+func TestHandlerExportItemsIntegration(t *testing.T) {
+	for _, dbType := range gorsetest.Types {
+		t.Run(dbType, func(t *testing.T) {
+			testHandlerExportItemsIntegration(t, dbType)
+		})
+	}
+}
+
+func testHandlerExportItemsIntegration(t *testing.T, dbType string) {
+	ctx := context.Background()
+	store, _ := gorsetest.Store(t, dbType)
+
+	// More than a batch so that we page through them.
+	now := time.Now()
+	var items []rss.Item
+	for i := 0; i < exportBatchSize+2; i++ {
+		items = append(items, rss.Item{
+			Title:   fmt.Sprintf("Item <b>%d</b>, &quot;quoted&quot;", i),
+			Link:    fmt.Sprintf("https://example.com/%d", i),
+			PubDate: now.Add(-time.Duration(i) * time.Minute),
+		})
+	}
+
+	loaded := gorsetest.Load(t, store, gorsetest.Fixture{
+		Users: []gorsetest.User{
+			{Email: "user@example.com", Password: "password"},
+		},
+		Feeds: []gorsetest.Feed{
+			{
+				DBFeed: gorse.DBFeed{
+					Name:                   "Example",
+					URI:                    "https://example.com/feed",
+					UpdateFrequencySeconds: 3600,
+					Active:                 true,
+				},
+				Items:       items,
+				Subscribers: []string{"user@example.com"},
+			},
+		},
+	})
+	userID := loaded.Users["user@example.com"]
+
+	if err := store.SetItemsReadState(ctx,
+		[]int64{loaded.Items["https://example.com/1"]}, userID,
+		gorse.ReadLater); err != nil {
+		t.Fatalf("SetItemsReadState() = error %s", err)
+	}
+
+	sessionStore := sessions.NewCookieStore([]byte(strings.Repeat("k", 32)))
+
+	export := func(query string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodGet,
+			"/export_items?"+query, nil)
+		session, err := sessionStore.New(request, "gorse")
+		if err != nil {
+			t.Fatalf("creating session: %s", err)
+		}
+		session.Values[sessionUserKey] = userID
+		rw := httptest.NewRecorder()
+		handlerExportItems(rw, request, &Config{}, store, session)
+		return rw
+	}
+
+	rw := export("")
+	if rw.Code != http.StatusOK {
+		t.Fatalf("GET = status %d: %s, wanted %d", rw.Code, rw.Body.String(),
+			http.StatusOK)
+	}
+	if ct := rw.Header().Get("Content-Type"); !strings.HasPrefix(ct,
+		"text/csv") {
+		t.Errorf("GET Content-Type = %s, wanted CSV", ct)
+	}
+	records, err := csv.NewReader(rw.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("reading CSV: %s", err)
+	}
+	if len(records) != exportBatchSize+2 {
+		t.Fatalf("GET = %d rows, wanted a header and %d unread items",
+			len(records), exportBatchSize+1)
+	}
+	if strings.Join(records[0], ",") != "title,link,feed,date,state" {
+		t.Errorf("GET header = %v", records[0])
+	}
+	if r := records[1]; r[0] != `Item 0, "quoted"` ||
+		r[1] != "https://example.com/0" || r[2] != "Example" ||
+		r[3] != now.UTC().Format(time.RFC3339) || r[4] != "unread" {
+		t.Errorf("GET first item = %v", r)
+	}
+	if r := records[2]; r[1] != "https://example.com/2" {
+		t.Errorf("GET second item = %v, wanted the item after the one saved", r)
+	}
+	if r := records[len(records)-1]; r[1] != fmt.Sprintf(
+		"https://example.com/%d", exportBatchSize+1) {
+		t.Errorf("GET last item = %v, wanted the oldest", r)
+	}
+
+	rw = export("read-state=read-later&format=json")
+	if rw.Code != http.StatusOK {
+		t.Fatalf("GET JSON = status %d: %s, wanted %d", rw.Code,
+			rw.Body.String(), http.StatusOK)
+	}
+	var exported []exportedItem
+	if err := json.Unmarshal(rw.Body.Bytes(), &exported); err != nil {
+		t.Fatalf("GET JSON = %s: %s", rw.Body.String(), err)
+	}
+	if len(exported) != 1 || exported[0].Link != "https://example.com/1" ||
+		exported[0].State != "read-later" || exported[0].Feed != "Example" {
+		t.Errorf("GET JSON = %+v, wanted the item saved to read later", exported)
+	}
+
+	if rw := export("format=xml"); rw.Code != http.StatusBadRequest {
+		t.Errorf("GET XML = status %d, wanted %d", rw.Code,
+			http.StatusBadRequest)
+	}
+}
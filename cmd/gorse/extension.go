@@ -0,0 +1,396 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/sessions"
+	"github.com/horgh/gorse"
+)
+
+// These endpoints are for a browser extension. It can show how many unread
+// items there are on its button, subscribe to the page you're on, and save it
+// to read later.
+//
+// The extension logs in with the user's email and password using HTTP Basic
+// authentication rather than with the session our pages use. We respond with
+// JSON, including for errors.
+//
+// Browsers only let the extension read our responses if we allow its origin
+// with CORS. ExtensionOrigins lists the origins we allow.
+
+// extensionUser authenticates the request. If it's not from a user, we respond
+// saying so and return false. Otherwise we return the user.
+func extensionUser(rw http.ResponseWriter, request *http.Request,
+	store gorse.Store) (*gorse.User, bool) {
+	email, password, ok := request.BasicAuth()
+	if !ok {
+		logf(request, "No credentials in extension request.")
+		rw.Header().Set("WWW-Authenticate", `Basic realm="gorse"`)
+		sendJSONError(rw, http.StatusUnauthorized, "Log in with your email and "+
+			"password")
+		return nil, false
+	}
+
+	// Too many failed logins lock out the account or address. See
+	// loginLimiter.
+	keys := loginKeys(request, email)
+	if wait, locked := loginLimits.LockedOut(keys); locked {
+		logf(request, "Refusing extension request for %s: locked out for %s",
+			email, wait.Round(time.Second))
+		rw.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(
+			wait.Seconds()))))
+		sendJSONError(rw, http.StatusTooManyRequests, "Too many failed logins. "+
+			"Try again later")
+		return nil, false
+	}
+
+	user, err := store.AuthenticateUser(request.Context(), email, password)
+	if err == gorse.ErrInvalidCredentials {
+		logf(request, "Invalid credentials for %s in extension request.", email)
+		for key, lockout := range loginLimits.Failed(keys) {
+			logf(request, "Locking out %s for %s after repeated failed logins",
+				key, lockout)
+		}
+		rw.Header().Set("WWW-Authenticate", `Basic realm="gorse"`)
+		sendJSONError(rw, http.StatusUnauthorized, "Invalid email or password")
+		return nil, false
+	}
+	if err != nil {
+		logf(request, "Unable to authenticate user: %s", err)
+		sendJSONError(rw, http.StatusInternalServerError,
+			"Unable to authenticate you")
+		return nil, false
+	}
+	loginLimits.Succeeded(email)
+	setRequestUser(request, user.ID)
+
+	return user, true
+}
+
+// allowExtensionOrigin sets the CORS headers letting the extension read our
+// response if the request is from one of ExtensionOrigins.
+func allowExtensionOrigin(rw http.ResponseWriter, request *http.Request,
+	settings *Config) {
+	// Responses differ by origin so caches must keep them apart.
+	rw.Header().Add("Vary", "Origin")
+
+	origin := request.Header.Get("Origin")
+	if origin == "" {
+		return
+	}
+	for _, allowed := range strings.Fields(settings.ExtensionOrigins) {
+		if origin == allowed {
+			rw.Header().Set("Access-Control-Allow-Origin", origin)
+			return
+		}
+	}
+}
+
+// handlerExtensionPreflight answers the requests browsers make to check
+// whether the extension may make a request.
+//
+// It implements the type RequestHandlerFunc.
+func handlerExtensionPreflight(rw http.ResponseWriter, request *http.Request,
+	settings *Config, store gorse.Store, session *sessions.Session) {
+	allowExtensionOrigin(rw, request, settings)
+	rw.Header().Set("Access-Control-Allow-Methods", "GET, POST")
+	rw.Header().Set("Access-Control-Allow-Headers", "Authorization, "+
+		"Content-Type")
+	rw.Header().Set("Access-Control-Max-Age", "3600")
+	rw.WriteHeader(http.StatusNoContent)
+}
+
+// handlerExtensionUnreadCount tells the extension how many unread items the
+// user has, as the list of unread items would show:
+//
+//	{"unread": 12}
+//
+// It implements the type RequestHandlerFunc.
+func handlerExtensionUnreadCount(rw http.ResponseWriter,
+	request *http.Request, settings *Config, store gorse.Store,
+	session *sessions.Session) {
+	allowExtensionOrigin(rw, request, settings)
+
+	user, ok := extensionUser(rw, request, store)
+	if !ok {
+		return
+	}
+
+	unread := gorse.Unread
+	filter := gorse.ItemFilter{
+		UserID:     user.ID,
+		State:      &unread,
+		Since:      unreadCutoff(),
+		Subscribed: true,
+	}
+	if err := hideMuted(request.Context(), store, &filter); err != nil {
+		logf(request, "Unable to look up muted keywords: %s", err)
+		sendJSONError(rw, http.StatusInternalServerError,
+			"Unable to count unread items")
+		return
+	}
+	count, err := store.CountItems(request.Context(), filter)
+	if err != nil {
+		logf(request, "Unable to count unread items: %s", err)
+		sendJSONError(rw, http.StatusInternalServerError,
+			"Unable to count unread items")
+		return
+	}
+
+	sendJSON(request, rw, http.StatusOK, struct {
+		Unread int `json:"unread"`
+	}{count})
+}
+
+// handlerExtensionSubscribe subscribes the user to the feed of the page in the
+// url parameter, such as the one they're on. The URL may also be that of the
+// feed itself. We respond with the feed:
+//
+//	{"id": 3, "name": "Example", "url": "https://example.com/feed",
+//	 "added": true}
+//
+// added says whether we didn't have the feed before.
+//
+// It implements the type RequestHandlerFunc.
+func handlerExtensionSubscribe(rw http.ResponseWriter, request *http.Request,
+	settings *Config, store gorse.Store, session *sessions.Session) {
+	allowExtensionOrigin(rw, request, settings)
+
+	user, ok := extensionUser(rw, request, store)
+	if !ok {
+		return
+	}
+
+	pageURL, ok := extensionURL(rw, request, settings)
+	if !ok {
+		return
+	}
+
+	feedURL, name, _, err := findFeed(request, pageURL)
+	if err != nil {
+		logf(request, "Unable to find feed of %s: %s", pageURL, err)
+		sendJSONError(rw, http.StatusNotFound, "No feed found for the page")
+		return
+	}
+
+	ctx := gorse.WithActor(request.Context(), user.ID)
+	var feedID int64
+	var added bool
+	if err := store.InTx(ctx, func(store gorse.Store) error {
+		var err error
+		feedID, added, err = gorse.SubscribeToFeed(ctx, store, user.ID, name,
+			feedURL)
+		return err
+	}); err != nil {
+		logf(request, "Unable to subscribe to %s: %s", feedURL, err)
+		sendJSONError(rw, http.StatusInternalServerError,
+			"Unable to subscribe to the feed")
+		return
+	}
+
+	logf(request, "Subscribed user ID [%d] to %s", user.ID, feedURL)
+
+	sendJSON(request, rw, http.StatusOK, struct {
+		ID    int64  `json:"id"`
+		Name  string `json:"name"`
+		URL   string `json:"url"`
+		Added bool   `json:"added"`
+	}{feedID, name, feedURL, added})
+}
+
+// maxFoundFeeds is the most feeds a page links to that we look at. Each is a
+// fetch.
+const maxFoundFeeds = 10
+
+// foundFeed is a feed we found for a page.
+type foundFeed struct {
+	URL  string
+	Name string
+	Feed *gorse.Feed
+}
+
+// findFeed finds the feed of the page at the URL. It returns the feed's URL,
+// its title, and the feed as we parsed it. See findFeeds.
+func findFeed(request *http.Request, pageURL string) (string, string,
+	*gorse.Feed, error) {
+	feeds, err := findFeeds(request, pageURL, 1)
+	if err != nil {
+		return "", "", nil, err
+	}
+	return feeds[0].URL, feeds[0].Name, feeds[0].Feed, nil
+}
+
+// findFeeds finds up to limit feeds of the page at the URL that we can read.
+//
+// We prefer feeds the page links to. If it doesn't link to any, the page may
+// be a feed itself, or have an h-feed. Failing those, we look where sites
+// commonly put their feeds and take the first we find.
+func findFeeds(request *http.Request, pageURL string, limit int) ([]foundFeed,
+	error) {
+	body, contentType, err := fetchURL(request.Context(), pageURL)
+	if err != nil {
+		return nil, err
+	}
+
+	// The page may not be HTML, such as if it's a feed.
+	discovered, err := gorse.DiscoverFeeds(body, contentType, pageURL)
+	if err != nil {
+		logf(request, "Unable to look for feeds in %s: %s", pageURL, err)
+	}
+
+	// We check the feeds the page links to are ones we can read, and find
+	// their titles. Sites sometimes link to ones that are gone.
+	var feeds []foundFeed
+	for _, d := range discovered {
+		if len(feeds) == limit {
+			break
+		}
+		if found, ok := readFeed(request, d.URL, d.Title); ok {
+			feeds = append(feeds, found)
+		}
+	}
+	if len(feeds) > 0 {
+		return feeds, nil
+	}
+
+	feed, parseErr := gorse.ParseFeed(body, gorse.ParseOptions{
+		ContentType: contentType,
+		URL:         pageURL,
+	})
+	if parseErr == nil {
+		return []foundFeed{
+			{URL: pageURL, Name: strings.TrimSpace(feed.Title), Feed: feed},
+		}, nil
+	}
+
+	fallbacks, err := gorse.FallbackFeedURLs(pageURL)
+	if err != nil {
+		return nil, err
+	}
+	for _, feedURL := range fallbacks {
+		if feedURL == pageURL {
+			continue
+		}
+		if found, ok := readFeed(request, feedURL, ""); ok {
+			return []foundFeed{found}, nil
+		}
+	}
+
+	return nil, fmt.Errorf("page links to no feeds we can read, is not a "+
+		"feed, and we found none where sites usually put them: %s", parseErr)
+}
+
+// readFeed fetches and parses the feed at the URL. We call it title if it has
+// none. If we can't read it, we log why and return false.
+func readFeed(request *http.Request, feedURL, title string) (foundFeed,
+	bool) {
+	body, contentType, err := fetchURL(request.Context(), feedURL)
+	if err != nil {
+		logf(request, "Unable to fetch feed %s: %s", feedURL, err)
+		return foundFeed{}, false
+	}
+	feed, err := gorse.ParseFeed(body, gorse.ParseOptions{
+		ContentType: contentType,
+		URL:         feedURL,
+	})
+	if err != nil {
+		logf(request, "Unable to parse feed %s: %s", feedURL, err)
+		return foundFeed{}, false
+	}
+	name := strings.TrimSpace(feed.Title)
+	if name == "" {
+		name = title
+	}
+	return foundFeed{URL: feedURL, Name: name, Feed: feed}, true
+}
+
+// handlerExtensionSave saves the page in the url parameter to the user's
+// Saved feed to read later, as handlerSave does. It takes the page's title in
+// the title parameter in case we can't find it. We respond with the item's
+// ID:
+//
+//	{"id": 42}
+//
+// It implements the type RequestHandlerFunc.
+func handlerExtensionSave(rw http.ResponseWriter, request *http.Request,
+	settings *Config, store gorse.Store, session *sessions.Session) {
+	allowExtensionOrigin(rw, request, settings)
+
+	user, ok := extensionUser(rw, request, store)
+	if !ok {
+		return
+	}
+
+	pageURL, ok := extensionURL(rw, request, settings)
+	if !ok {
+		return
+	}
+
+	request = request.WithContext(gorse.WithActor(request.Context(), user.ID))
+
+	id, err := saveLink(request, store, user.ID, pageURL,
+		request.PostForm.Get("title"))
+	if err != nil {
+		logf(request, "Unable to save link: %s", err)
+		sendJSONError(rw, http.StatusInternalServerError, "Unable to save link")
+		return
+	}
+
+	sendJSON(request, rw, http.StatusOK, struct {
+		ID int64 `json:"id"`
+	}{id})
+}
+
+// extensionURL parses the form and finds the page URL in its url parameter.
+// If we can't, we respond saying so and return false.
+func extensionURL(rw http.ResponseWriter, request *http.Request,
+	settings *Config) (string, bool) {
+	if err := request.ParseForm(); err != nil {
+		logf(request, "Failed to parse form: %s", err)
+		if bodyTooLarge(err) {
+			sendJSONError(rw, http.StatusRequestEntityTooLarge,
+				tooLargeError(settings.maxFormBytes()))
+			return "", false
+		}
+		sendJSONError(rw, http.StatusBadRequest, "Failed to parse request")
+		return "", false
+	}
+
+	rawURL := request.PostForm.Get("url")
+	u, ok := subscribeURL(rawURL)
+	if !ok {
+		logf(request, "Invalid URL: %s", rawURL)
+		sendJSONError(rw, http.StatusBadRequest,
+			"The URL must be an http or https URL")
+		return "", false
+	}
+
+	return u, true
+}
+
+// sendJSON responds with the value as JSON.
+func sendJSON(request *http.Request, rw http.ResponseWriter, status int,
+	v interface{}) {
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(status)
+	if err := json.NewEncoder(rw).Encode(v); err != nil {
+		logf(request, "Unable to write JSON response: %s", err)
+	}
+}
+
+// sendJSONError responds with the error message as JSON:
+//
+//	{"error": "Invalid email or password"}
+func sendJSONError(rw http.ResponseWriter, status int, message string) {
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(status)
+	_ = json.NewEncoder(rw).Encode(struct {
+		Error string `json:"error"`
+	}{message})
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/sessions"
+	"github.com/horgh/gorse"
+	"github.com/horgh/gorse/internal/gorsetest"
+	"github.com/horgh/rss"
+)
+
+func TestHandlerExtensionIntegration(t *testing.T) {
+	for _, dbType := range gorsetest.Types {
+		t.Run(dbType, func(t *testing.T) {
+			testHandlerExtensionIntegration(t, dbType)
+		})
+	}
+}
+
+func testHandlerExtensionIntegration(t *testing.T, dbType string) {
+	ctx := context.Background()
+	store, _ := gorsetest.Store(t, dbType)
+
+	defer func(l *loginLimiter) { loginLimits = l }(loginLimits)
+	loginLimits = newLoginLimiter()
+
+	loaded := gorsetest.Load(t, store, gorsetest.Fixture{
+		Users: []gorsetest.User{
+			{Email: "user@example.com", Password: "password"},
+		},
+		Feeds: []gorsetest.Feed{
+			{
+				DBFeed: gorse.DBFeed{
+					Name:                   "Example",
+					URI:                    "https://example.com/feed",
+					UpdateFrequencySeconds: 3600,
+					Active:                 true,
+				},
+				Items: []rss.Item{
+					{Title: "One", Link: "https://example.com/1", PubDate: time.Now()},
+					{Title: "Two", Link: "https://example.com/2", PubDate: time.Now()},
+				},
+				Subscribers: []string{"user@example.com"},
+			},
+		},
+	})
+	userID := loaded.Users["user@example.com"]
+
+	site := httptest.NewServer(http.HandlerFunc(
+		func(rw http.ResponseWriter, request *http.Request) {
+			switch request.URL.Path {
+			case "/blog":
+				rw.Header().Set("Content-Type", "text/html")
+				_, _ = rw.Write([]byte(`<title>Blog</title>
+<link rel="alternate" type="application/rss+xml" href="/gone.xml">
+<link rel="alternate" type="application/rss+xml" href="/feed.xml">`))
+			case "/feed.xml":
+				rw.Header().Set("Content-Type", "application/rss+xml")
+				_, _ = rw.Write([]byte(`<?xml version="1.0"?>
+<rss version="2.0"><channel><title>The Blog</title>
+<link>https://blog.example.com/</link><description>Posts</description>
+</channel></rss>`))
+			default:
+				http.NotFound(rw, request)
+			}
+		}))
+	defer site.Close()
+
+	settings := &Config{ExtensionOrigins: "moz-extension://allowed"}
+	sessionStore := sessions.NewCookieStore([]byte(strings.Repeat("k", 32)))
+
+	call := func(handler func(http.ResponseWriter, *http.Request, *Config,
+		gorse.Store, *sessions.Session), method, path string, form url.Values,
+		password string) (*httptest.ResponseRecorder, map[string]interface{}) {
+		request := httptest.NewRequest(method, path,
+			strings.NewReader(form.Encode()))
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		request.Header.Set("Origin", "moz-extension://allowed")
+		if password != "" {
+			request.SetBasicAuth("user@example.com", password)
+		}
+		session, err := sessionStore.New(request, "gorse")
+		if err != nil {
+			t.Fatalf("creating session: %s", err)
+		}
+
+		rw := httptest.NewRecorder()
+		handler(rw, request, settings, store, session)
+
+		if origin := rw.Header().Get(
+			"Access-Control-Allow-Origin"); origin != "moz-extension://allowed" {
+			t.Errorf("%s %s allowed origin %q, wanted the extension", method, path,
+				origin)
+		}
+
+		var response map[string]interface{}
+		if rw.Code != http.StatusNoContent {
+			if err := json.Unmarshal(rw.Body.Bytes(), &response); err != nil {
+				t.Fatalf("%s %s responded %q, wanted JSON: %s", method, path,
+					rw.Body.String(), err)
+			}
+		}
+		return rw, response
+	}
+
+	rw, _ := call(handlerExtensionPreflight, http.MethodOptions,
+		"/extension/save", nil, "")
+	if rw.Code != http.StatusNoContent || !strings.Contains(
+		rw.Header().Get("Access-Control-Allow-Headers"), "Authorization") {
+		t.Errorf("preflight = status %d headers %v, wanted Authorization allowed",
+			rw.Code, rw.Header())
+	}
+
+	for _, password := range []string{"", "wrong"} {
+		rw, response := call(handlerExtensionUnreadCount, http.MethodGet,
+			"/extension/unread_count", nil, password)
+		if rw.Code != http.StatusUnauthorized || response["error"] == nil {
+			t.Errorf("unread count with password %q = status %d %v, wanted %d",
+				password, rw.Code, response, http.StatusUnauthorized)
+		}
+	}
+
+	rw, response := call(handlerExtensionUnreadCount, http.MethodGet,
+		"/extension/unread_count", nil, "password")
+	if rw.Code != http.StatusOK || response["unread"] != float64(2) {
+		t.Errorf("unread count = status %d %v, wanted 2", rw.Code, response)
+	}
+
+	rw, response = call(handlerExtensionSubscribe, http.MethodPost,
+		"/extension/subscribe", url.Values{"url": {site.URL + "/blog"}},
+		"password")
+	if rw.Code != http.StatusOK || response["url"] != site.URL+"/feed.xml" ||
+		response["name"] != "The Blog" || response["added"] != true {
+		t.Fatalf("subscribe = status %d %v, wanted The Blog added", rw.Code,
+			response)
+	}
+
+	subscriptions, err := store.ListSubscriptions(ctx, userID)
+	if err != nil {
+		t.Fatalf("ListSubscriptions() = error %s", err)
+	}
+	if len(subscriptions) != 2 || subscriptions[1].URI != site.URL+"/feed.xml" {
+		t.Errorf("subscriptions = %+v, wanted the blog's feed", subscriptions)
+	}
+
+	// Subscribing with the feed's URL finds the same feed.
+	rw, response = call(handlerExtensionSubscribe, http.MethodPost,
+		"/extension/subscribe", url.Values{"url": {site.URL + "/feed.xml"}},
+		"password")
+	if rw.Code != http.StatusOK || response["id"] != float64(
+		subscriptions[1].ID) || response["added"] != false {
+		t.Errorf("subscribe to feed = status %d %v, wanted feed %d", rw.Code,
+			response, subscriptions[1].ID)
+	}
+
+	rw, response = call(handlerExtensionSubscribe, http.MethodPost,
+		"/extension/subscribe", url.Values{"url": {site.URL + "/missing"}},
+		"password")
+	if rw.Code != http.StatusNotFound {
+		t.Errorf("subscribe to missing page = status %d %v, wanted %d", rw.Code,
+			response, http.StatusNotFound)
+	}
+
+	rw, response = call(handlerExtensionSave, http.MethodPost,
+		"/extension/save", url.Values{"url": {site.URL + "/blog"}}, "password")
+	if rw.Code != http.StatusOK {
+		t.Fatalf("save = status %d %v, wanted %d", rw.Code, response,
+			http.StatusOK)
+	}
+	item, err := store.GetItem(ctx, int64(response["id"].(float64)), userID)
+	if err != nil {
+		t.Fatalf("GetItem() = error %s", err)
+	}
+	if item.Title != "Blog" || item.ReadState != gorse.ReadLater {
+		t.Errorf("saved item = %+v, wanted Blog to read later", item)
+	}
+
+	rw, _ = call(handlerExtensionSave, http.MethodPost, "/extension/save",
+		url.Values{"url": {"javascript:alert(1)"}}, "password")
+	if rw.Code != http.StatusBadRequest {
+		t.Errorf("save of invalid URL = status %d, wanted %d", rw.Code,
+			http.StatusBadRequest)
+	}
+
+	// Too many failed logins lock the account out even with the right
+	// password.
+	for i := 0; i < loginFreeFailures; i++ {
+		call(handlerExtensionUnreadCount, http.MethodGet,
+			"/extension/unread_count", nil, "wrong")
+	}
+	rw, response = call(handlerExtensionUnreadCount, http.MethodGet,
+		"/extension/unread_count", nil, "password")
+	if rw.Code != http.StatusTooManyRequests ||
+		rw.Header().Get("Retry-After") == "" {
+		t.Errorf("unread count when locked out = status %d %v, wanted %d", rw.Code,
+			response, http.StatusTooManyRequests)
+	}
+}
+
+func TestAllowExtensionOrigin(t *testing.T) {
+	settings := &Config{
+		ExtensionOrigins: "moz-extension://a chrome-extension://b",
+	}
+
+	tests := []struct {
+		Origin string
+		Want   string
+	}{
+		{"moz-extension://a", "moz-extension://a"},
+		{"chrome-extension://b", "chrome-extension://b"},
+		{"https://evil.example.com", ""},
+		{"", ""},
+	}
+
+	for _, test := range tests {
+		request := httptest.NewRequest(http.MethodGet, "/extension/unread_count",
+			nil)
+		if test.Origin != "" {
+			request.Header.Set("Origin", test.Origin)
+		}
+		rw := httptest.NewRecorder()
+		allowExtensionOrigin(rw, request, settings)
+		if got := rw.Header().Get("Access-Control-Allow-Origin"); got != test.Want {
+			t.Errorf("allowExtensionOrigin(%q) allowed %q, wanted %q", test.Origin,
+				got, test.Want)
+		}
+		if vary := rw.Header().Get("Vary"); vary != "Origin" {
+			t.Errorf("allowExtensionOrigin(%q) set Vary %q, wanted Origin",
+				test.Origin, vary)
+		}
+	}
+}
@@ -0,0 +1,523 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/sessions"
+	"github.com/horgh/gorse"
+)
+
+// maxUpdateFrequencyMinutes is the longest we let users set between polls of
+// a feed, a week.
+const maxUpdateFrequencyMinutes = 7 * 24 * 60
+
+// handlerFeeds lists the feeds the user subscribes to along with how we poll
+// them, and lets them change that.
+//
+// It implements the type RequestHandlerFunc.
+//
+// The feeds have pages like the list of items. sort orders them by name (the
+// default), unread, updated, or errors. This way the user can see which feeds
+// are busy, and which we're having trouble polling.
+//
+// For each feed we show how often it publishes, going by the items we have.
+// suggest is the ID of a feed to suggest how often to poll from that. We fill
+// it in for the user to save if they like it.
+func handlerFeeds(rw http.ResponseWriter, request *http.Request,
+	settings *Config, store gorse.Store, session *sessions.Session) {
+	requestValues := request.URL.Query()
+
+	userID, ok := sessionUser(rw, request, settings, session)
+	if !ok {
+		return
+	}
+
+	var err error
+
+	sort := gorse.FeedSortName
+	if sortStr := requestValues.Get("sort"); sortStr != "" {
+		if sort, err = gorse.ParseFeedSort(sortStr); err != nil {
+			logf(request, "Bad sort: %s", sortStr)
+			send400Error(rw, "Bad sort")
+			return
+		}
+	}
+
+	page := 1
+	if pageStr := requestValues.Get("page"); pageStr != "" {
+		if page, err = strconv.Atoi(pageStr); err != nil || page < 1 {
+			logf(request, "Bad page: %s", pageStr)
+			send400Error(rw, "Bad page")
+			return
+		}
+	}
+
+	user, err := store.GetUser(request.Context(), userID)
+	if err != nil {
+		logf(request, "Unable to look up user: %s", err)
+		send500Error(rw, "Unable to look up user")
+		return
+	}
+	locale := userLocale(request, user)
+
+	location, err := time.LoadLocation(settings.DisplayTimeZone)
+	if err != nil {
+		logf(request, "Failed to load time zone location [%s]: %s",
+			settings.DisplayTimeZone, err)
+		send500Error(rw, "Unable to load timezone information")
+		return
+	}
+
+	var suggestID int64
+	if suggestStr := requestValues.Get("suggest"); suggestStr != "" {
+		if suggestID, err = strconv.ParseInt(suggestStr, 10, 64); err != nil {
+			logf(request, "Bad feed ID: %s: %s", suggestStr, err)
+			send400Error(rw, "Bad feed ID")
+			return
+		}
+	}
+
+	feeds, err := store.FeedOverview(request.Context(), userID, sort, pageSize,
+		(page-1)*pageSize)
+	if err != nil {
+		logf(request, "Unable to retrieve subscriptions: %s", err)
+		send500Error(rw, "Unable to retrieve subscriptions")
+		return
+	}
+
+	total, err := store.CountSubscriptions(request.Context(), userID)
+	if err != nil {
+		logf(request, "Unable to count subscriptions: %s", err)
+		send500Error(rw, "Unable to count subscriptions")
+		return
+	}
+
+	stats, err := store.SubscriptionStats(request.Context(), userID)
+	if err != nil {
+		logf(request, "Unable to retrieve feed stats: %s", err)
+		send500Error(rw, "Unable to retrieve feed stats")
+		return
+	}
+
+	type HTMLFeed struct {
+		ID          int64
+		Name        string
+		URI         string
+		Active      bool
+		Archive     bool
+		FullText    bool
+		Items       int
+		Unread      int
+		Archived    int
+		ItemsPerDay float64
+		Minutes     int64
+		Suggested   bool
+		Updated     string
+		FullUpdated string
+		ErrorCount  int
+		LastError   string
+	}
+
+	var htmlFeeds []HTMLFeed
+	for _, feed := range feeds {
+		htmlFeed := HTMLFeed{
+			ID:          feed.ID,
+			Name:        feed.Name,
+			URI:         feed.URI,
+			Active:      feed.Active,
+			Archive:     feed.Archive,
+			FullText:    feed.FullText,
+			Items:       stats[feed.ID].Items,
+			Unread:      feed.Unread,
+			Archived:    stats[feed.ID].Archived,
+			ItemsPerDay: stats[feed.ID].ItemsPerDay(),
+			Minutes:     feed.UpdateFrequencySeconds / 60,
+			ErrorCount:  feed.ErrorCount,
+			LastError:   feed.LastError,
+		}
+		if feed.LastUpdateTime != nil {
+			htmlFeed.Updated, htmlFeed.FullUpdated = formatDate(locale, user,
+				*feed.LastUpdateTime, location)
+		}
+		if feed.ID == suggestID {
+			htmlFeed.Minutes = gorse.SuggestUpdateFrequency(
+				htmlFeed.ItemsPerDay) / 60
+			htmlFeed.Suggested = true
+		}
+		htmlFeeds = append(htmlFeeds, htmlFeed)
+	}
+
+	nextPage := -1
+	if page < int(math.Ceil(float64(total)/float64(pageSize))) {
+		nextPage = page + 1
+	}
+
+	type HTMLSort struct {
+		Value string
+		Label string
+	}
+
+	sorts := []HTMLSort{
+		{gorse.FeedSortName.String(), "Name"},
+		{gorse.FeedSortUnread.String(), "Unread"},
+		{gorse.FeedSortUpdated.String(), "Last checked"},
+		{gorse.FeedSortErrors.String(), "Errors"},
+	}
+
+	type FeedsPage struct {
+		Feeds        []HTMLFeed
+		MaxMinutes   int
+		Sort         string
+		Sorts        []HTMLSort
+		TotalFeeds   int
+		Page         int
+		NextPage     int
+		PreviousPage int
+		Path         string
+		UserID       int
+		ReadState    gorse.ReadState
+		Admin        bool
+	}
+
+	if err := renderPage(settings, rw, locale, "_feeds", FeedsPage{
+		Feeds:        htmlFeeds,
+		MaxMinutes:   maxUpdateFrequencyMinutes,
+		Sort:         sort.String(),
+		Sorts:        sorts,
+		TotalFeeds:   total,
+		Page:         page,
+		NextPage:     nextPage,
+		PreviousPage: page - 1,
+		Path:         settings.URIPrefix,
+		UserID:       userID,
+		ReadState:    gorse.Unread,
+		Admin:        user.Admin,
+	}); err != nil {
+		logf(request, "Failure rendering page: %s", err)
+		send500Error(rw, "Failed to render page")
+		return
+	}
+}
+
+// handlerFeedArchive turns archive mode on or off for a feed the user
+// subscribes to. archive is 1 to turn it on. We go back to the feeds after.
+//
+// It implements the type RequestHandlerFunc.
+func handlerFeedArchive(rw http.ResponseWriter, request *http.Request,
+	settings *Config, store gorse.Store, session *sessions.Session) {
+	userID, feed, ok := subscribedFeedForm(rw, request, settings, store,
+		session)
+	if !ok {
+		return
+	}
+	feedID := feed.ID
+
+	archive := request.PostForm.Get("archive") == "1"
+
+	if err := store.SetFeedArchive(gorse.WithActor(request.Context(), userID),
+		feedID, archive); err != nil {
+		logf(request, "Unable to set archive mode of feed %d: %s", feedID, err)
+		send500Error(rw, "Unable to update feed")
+		return
+	}
+
+	logf(request, "Set archive mode of feed %d to %t", feedID, archive)
+
+	uri := feedsURL(settings, request.PostForm)
+
+	logf(request, "Redirecting to %s", uri)
+
+	http.Redirect(rw, request, uri, http.StatusFound)
+}
+
+// handlerFeedFullText turns full text mode on or off for a feed the user
+// subscribes to. full-text is 1 to turn it on. We go back to the feeds after.
+//
+// It implements the type RequestHandlerFunc.
+func handlerFeedFullText(rw http.ResponseWriter, request *http.Request,
+	settings *Config, store gorse.Store, session *sessions.Session) {
+	userID, feed, ok := subscribedFeedForm(rw, request, settings, store,
+		session)
+	if !ok {
+		return
+	}
+	feedID := feed.ID
+
+	fullText := request.PostForm.Get("full-text") == "1"
+
+	if err := store.SetFeedFullText(gorse.WithActor(request.Context(), userID),
+		feedID, fullText); err != nil {
+		logf(request, "Unable to set full text mode of feed %d: %s", feedID, err)
+		send500Error(rw, "Unable to update feed")
+		return
+	}
+
+	logf(request, "Set full text mode of feed %d to %t", feedID, fullText)
+
+	uri := feedsURL(settings, request.PostForm)
+
+	logf(request, "Redirecting to %s", uri)
+
+	http.Redirect(rw, request, uri, http.StatusFound)
+}
+
+// handlerFeedFrequency sets how often we poll a feed the user subscribes to.
+// minutes is how many minutes apart. We go back to the feeds after.
+//
+// It implements the type RequestHandlerFunc.
+func handlerFeedFrequency(rw http.ResponseWriter, request *http.Request,
+	settings *Config, store gorse.Store, session *sessions.Session) {
+	userID, feed, ok := subscribedFeedForm(rw, request, settings, store,
+		session)
+	if !ok {
+		return
+	}
+	feedID := feed.ID
+
+	minutesStr := request.PostForm.Get("minutes")
+	minutes, err := strconv.ParseInt(minutesStr, 10, 64)
+	if err != nil || minutes*60 < gorse.MinUpdateFrequencySeconds ||
+		minutes > maxUpdateFrequencyMinutes {
+		logf(request, "Bad update frequency: %s", minutesStr)
+		send400Error(rw, "Bad update frequency")
+		return
+	}
+
+	if err := store.SetFeedUpdateFrequency(
+		gorse.WithActor(request.Context(), userID), feedID,
+		minutes*60); err != nil {
+		logf(request, "Unable to set update frequency of feed %d: %s", feedID,
+			err)
+		send500Error(rw, "Unable to update feed")
+		return
+	}
+
+	logf(request, "Set update frequency of feed %d to %d minutes", feedID,
+		minutes)
+
+	uri := feedsURL(settings, request.PostForm)
+
+	logf(request, "Redirecting to %s", uri)
+
+	http.Redirect(rw, request, uri, http.StatusFound)
+}
+
+// handlerFeedUpdate renames a feed the user subscribes to or changes its URL.
+// name and uri are what to change them to. We go back to the feeds after.
+//
+// It implements the type RequestHandlerFunc.
+//
+// Feeds are shared, so this changes the feed for everyone subscribing to it.
+// Only admins may do this. The URL must be an http or https URL that no other
+// feed has.
+func handlerFeedUpdate(rw http.ResponseWriter, request *http.Request,
+	settings *Config, store gorse.Store, session *sessions.Session) {
+	if _, ok := requireAdmin(rw, request, settings, store, session); !ok {
+		return
+	}
+
+	userID, feed, ok := subscribedFeedForm(rw, request, settings, store,
+		session)
+	if !ok {
+		return
+	}
+
+	name := strings.TrimSpace(request.PostForm.Get("name"))
+	if name == "" {
+		logf(request, "No feed name in request.")
+		send400Error(rw, "The name must not be blank")
+		return
+	}
+
+	uri, ok := subscribeURL(request.PostForm.Get("uri"))
+	if !ok {
+		logf(request, "Invalid URL: %s", request.PostForm.Get("uri"))
+		send400Error(rw, "The URL must be an http or https URL")
+		return
+	}
+
+	ctx := gorse.WithActor(request.Context(), userID)
+
+	if uri != feed.URI {
+		other, err := store.GetFeedByURI(ctx, uri)
+		if err == nil {
+			logf(request, "Feed %d already has URL %s", other.ID, uri)
+			send400Error(rw, "Another feed has that URL")
+			return
+		}
+		if err != gorse.ErrNotFound {
+			logf(request, "Unable to look up feed: %s", err)
+			send500Error(rw, "Unable to look up feed")
+			return
+		}
+	}
+
+	feed.Name = name
+	feed.URI = uri
+	if err := store.UpdateFeed(ctx, feed); err != nil {
+		logf(request, "Unable to update feed %d: %s", feed.ID, err)
+		send500Error(rw, "Unable to update feed")
+		return
+	}
+
+	logf(request, "Set name of feed %d to %s and URL to %s", feed.ID, name, uri)
+
+	uri = feedsURL(settings, request.PostForm)
+
+	logf(request, "Redirecting to %s", uri)
+
+	http.Redirect(rw, request, uri, http.StatusFound)
+}
+
+// handlerFeedActive turns polling a feed the user subscribes to on or off.
+// active is 1 to turn it on. We keep the feed's items either way. We go back
+// to the feeds after.
+//
+// It implements the type RequestHandlerFunc.
+//
+// Like renaming a feed, this affects everyone subscribing to it, so only
+// admins may do it.
+func handlerFeedActive(rw http.ResponseWriter, request *http.Request,
+	settings *Config, store gorse.Store, session *sessions.Session) {
+	if _, ok := requireAdmin(rw, request, settings, store, session); !ok {
+		return
+	}
+
+	userID, feed, ok := subscribedFeedForm(rw, request, settings, store,
+		session)
+	if !ok {
+		return
+	}
+
+	active := request.PostForm.Get("active") == "1"
+
+	ctx := gorse.WithActor(request.Context(), userID)
+	var err error
+	if active {
+		feed.Active = true
+		err = store.UpdateFeed(ctx, feed)
+	} else {
+		err = store.DeactivateFeed(ctx, feed.ID)
+	}
+	if err != nil {
+		logf(request, "Unable to set polling of feed %d: %s", feed.ID, err)
+		send500Error(rw, "Unable to update feed")
+		return
+	}
+
+	logf(request, "Set polling of feed %d to %t", feed.ID, active)
+
+	uri := feedsURL(settings, request.PostForm)
+
+	logf(request, "Redirecting to %s", uri)
+
+	http.Redirect(rw, request, uri, http.StatusFound)
+}
+
+// handlerFeedDelete deletes a feed the user subscribes to. items says what to
+// do with its items: keep them, archive them (mark them read), or purge them.
+// See gorse.DeleteFeed. We go back to the feeds after.
+//
+// It implements the type RequestHandlerFunc.
+//
+// Deleting the feed deletes it for everyone subscribing to it, so only admins
+// may do it.
+func handlerFeedDelete(rw http.ResponseWriter, request *http.Request,
+	settings *Config, store gorse.Store, session *sessions.Session) {
+	if _, ok := requireAdmin(rw, request, settings, store, session); !ok {
+		return
+	}
+
+	userID, feed, ok := subscribedFeedForm(rw, request, settings, store,
+		session)
+	if !ok {
+		return
+	}
+
+	retentionStr := request.PostForm.Get("items")
+	retention, err := gorse.ParseItemRetention(retentionStr)
+	if err != nil {
+		logf(request, "Bad item retention: %s", retentionStr)
+		send400Error(rw, "Bad item retention")
+		return
+	}
+
+	if err := store.DeleteFeed(gorse.WithActor(request.Context(), userID),
+		feed.ID, retention); err != nil {
+		logf(request, "Unable to delete feed %d: %s", feed.ID, err)
+		send500Error(rw, "Unable to delete feed")
+		return
+	}
+
+	logf(request, "Deleted feed %d (%s its items)", feed.ID, retention)
+
+	uri := feedsURL(settings, request.PostForm)
+
+	logf(request, "Redirecting to %s", uri)
+
+	http.Redirect(rw, request, uri, http.StatusFound)
+}
+
+// subscribedFeedForm parses the form of a request changing one of the feeds
+// the user subscribes to. It has the feed-id. We return the user and the feed.
+// If there's a problem, we respond saying so and return false.
+func subscribedFeedForm(rw http.ResponseWriter, request *http.Request,
+	settings *Config, store gorse.Store, session *sessions.Session) (int,
+	gorse.DBFeed, bool) {
+	if err := request.ParseForm(); err != nil {
+		logf(request, "Failed to parse form: %s", err)
+		if bodyTooLarge(err) {
+			send413Error(rw, tooLargeError(settings.maxFormBytes()))
+			return -1, gorse.DBFeed{}, false
+		}
+		send400Error(rw, "Failed to parse request")
+		return -1, gorse.DBFeed{}, false
+	}
+
+	userID, ok := sessionUser(rw, request, settings, session)
+	if !ok {
+		return -1, gorse.DBFeed{}, false
+	}
+
+	feedIDStr := request.PostForm.Get("feed-id")
+	feedID, err := strconv.ParseInt(feedIDStr, 10, 64)
+	if err != nil {
+		logf(request, "Bad feed ID: %s: %s", feedIDStr, err)
+		send400Error(rw, "Bad feed ID")
+		return -1, gorse.DBFeed{}, false
+	}
+
+	feeds, err := store.ListSubscriptions(request.Context(), userID)
+	if err != nil {
+		logf(request, "Unable to retrieve subscriptions: %s", err)
+		send500Error(rw, "Unable to retrieve subscriptions")
+		return -1, gorse.DBFeed{}, false
+	}
+	for _, feed := range feeds {
+		if feed.ID == feedID {
+			return userID, feed, true
+		}
+	}
+
+	logf(request, "User %d doesn't subscribe to feed %d", userID, feedID)
+	send400Error(rw, "Unknown feed")
+	return -1, gorse.DBFeed{}, false
+}
+
+// feedsURL gives the URL of the page of feeds a form on it came from, keeping
+// its sort and page.
+func feedsURL(settings *Config, form url.Values) string {
+	values := url.Values{}
+	for _, name := range []string{"sort", "page"} {
+		if v := form.Get(name); v != "" {
+			values.Set(name, v)
+		}
+	}
+	return fmt.Sprintf("%s/feeds?%s", settings.URIPrefix, values.Encode())
+}
@@ -0,0 +1,606 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/sessions"
+	"github.com/horgh/gorse"
+	"github.com/horgh/gorse/internal/gorsetest"
+	"github.com/horgh/rss"
+)
+
+func TestHandlerFeedsIntegration(t *testing.T) {
+	for _, dbType := range gorsetest.Types {
+		t.Run(dbType, func(t *testing.T) {
+			testHandlerFeedsIntegration(t, dbType)
+		})
+	}
+}
+
+func testHandlerFeedsIntegration(t *testing.T, dbType string) {
+	ctx := context.Background()
+	store, _ := gorsetest.Store(t, dbType)
+
+	loaded := gorsetest.Load(t, store, gorsetest.Fixture{
+		Users: []gorsetest.User{
+			{Email: "user@example.com", Password: "password"},
+			{Email: "other@example.com", Password: "password"},
+		},
+		Feeds: []gorsetest.Feed{
+			{
+				DBFeed: gorse.DBFeed{
+					Name:                   "Example",
+					URI:                    "https://example.com/feed",
+					UpdateFrequencySeconds: 3600,
+					Active:                 true,
+				},
+				Items: []rss.Item{
+					{Title: "One", Link: "https://example.com/1", PubDate: time.Now()},
+				},
+				Subscribers: []string{"user@example.com"},
+			},
+		},
+	})
+	userID := loaded.Users["user@example.com"]
+	otherID := loaded.Users["other@example.com"]
+	feedID := loaded.Feeds["https://example.com/feed"]
+
+	if err := store.SetItemsArchived(ctx, []int64{
+		loaded.Items["https://example.com/1"]}); err != nil {
+		t.Fatalf("SetItemsArchived() = error %s", err)
+	}
+
+	settings := &Config{
+		URIPrefix:       "/gorse",
+		DisplayTimeZone: "UTC",
+		WebRoot:         "static",
+		TemplateDir:     "templates",
+	}
+	sessionStore := sessions.NewCookieStore([]byte(strings.Repeat("k", 32)))
+
+	list := func() string {
+		request := httptest.NewRequest(http.MethodGet,
+			"/feeds", nil)
+		session, err := sessionStore.New(request, "gorse")
+		if err != nil {
+			t.Fatalf("creating session: %s", err)
+		}
+		session.Values[sessionUserKey] = userID
+		rw := httptest.NewRecorder()
+		handlerFeeds(rw, request, settings, store, session)
+		if rw.Code != http.StatusOK {
+			t.Fatalf("GET = status %d: %s, wanted %d", rw.Code, rw.Body.String(),
+				http.StatusOK)
+		}
+		return rw.Body.String()
+	}
+
+	setArchive := func(userID int, archive string) int {
+		form := url.Values{
+			"feed-id": {fmt.Sprintf("%d", feedID)},
+			"archive": {archive},
+		}
+		request := httptest.NewRequest(http.MethodPost, "/feed_archive",
+			strings.NewReader(form.Encode()))
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		session, err := sessionStore.New(request, "gorse")
+		if err != nil {
+			t.Fatalf("creating session: %s", err)
+		}
+		session.Values[sessionUserKey] = userID
+		rw := httptest.NewRecorder()
+		handlerFeedArchive(rw, request, settings, store, session)
+		return rw.Code
+	}
+
+	body := list()
+	if !strings.Contains(body, "Example") ||
+		!strings.Contains(body, "1 marked read by archive mode") ||
+		!strings.Contains(body, `name="archive" value="1"`) {
+		t.Errorf("GET = %s, wanted the feed with archive mode off", body)
+	}
+
+	if code := setArchive(userID, "1"); code != http.StatusFound {
+		t.Fatalf("POST = status %d, wanted %d", code, http.StatusFound)
+	}
+	feed, err := store.GetFeedByURI(ctx, "https://example.com/feed")
+	if err != nil {
+		t.Fatalf("GetFeedByURI() = error %s", err)
+	}
+	if !feed.Archive {
+		t.Errorf("feed archive = false, wanted true")
+	}
+	if body := list(); !strings.Contains(body,
+		`name="archive" value="0"`) {
+		t.Errorf("GET after turning archive mode on = %s, wanted it on", body)
+	}
+
+	if code := setArchive(otherID, "0"); code != http.StatusBadRequest {
+		t.Errorf("POST by a user not subscribed = status %d, wanted %d", code,
+			http.StatusBadRequest)
+	}
+	if feed, err := store.GetFeedByURI(ctx,
+		"https://example.com/feed"); err != nil || !feed.Archive {
+		t.Errorf("feed after POST by a user not subscribed = %+v, %v, wanted "+
+			"archive mode on", feed, err)
+	}
+
+	form := url.Values{
+		"feed-id":   {fmt.Sprintf("%d", feedID)},
+		"full-text": {"1"},
+	}
+	request := httptest.NewRequest(http.MethodPost, "/feed_full_text",
+		strings.NewReader(form.Encode()))
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	session, err := sessionStore.New(request, "gorse")
+	if err != nil {
+		t.Fatalf("creating session: %s", err)
+	}
+	session.Values[sessionUserKey] = userID
+	rw := httptest.NewRecorder()
+	handlerFeedFullText(rw, request, settings, store, session)
+	if rw.Code != http.StatusFound {
+		t.Fatalf("POST full text = status %d, wanted %d", rw.Code,
+			http.StatusFound)
+	}
+	if feed, err := store.GetFeedByURI(ctx,
+		"https://example.com/feed"); err != nil || !feed.FullText {
+		t.Errorf("feed after turning full text mode on = %+v, %v, wanted it on",
+			feed, err)
+	}
+	if body := list(); !strings.Contains(body,
+		`name="full-text" value="0"`) {
+		t.Errorf("GET after turning full text mode on = %s, wanted it on", body)
+	}
+}
+
+func TestHandlerFeedFrequencyIntegration(t *testing.T) {
+	for _, dbType := range gorsetest.Types {
+		t.Run(dbType, func(t *testing.T) {
+			testHandlerFeedFrequencyIntegration(t, dbType)
+		})
+	}
+}
+
+func testHandlerFeedFrequencyIntegration(t *testing.T, dbType string) {
+	ctx := context.Background()
+	store, _ := gorsetest.Store(t, dbType)
+
+	var items []rss.Item
+	for i := 0; i < 24; i++ {
+		items = append(items, rss.Item{
+			Title:   fmt.Sprintf("Item %d", i),
+			Link:    fmt.Sprintf("https://example.com/%d", i),
+			PubDate: time.Now().Add(-time.Duration(i+1) * 12 * time.Hour),
+		})
+	}
+
+	loaded := gorsetest.Load(t, store, gorsetest.Fixture{
+		Users: []gorsetest.User{
+			{Email: "user@example.com", Password: "password"},
+		},
+		Feeds: []gorsetest.Feed{
+			{
+				DBFeed: gorse.DBFeed{
+					Name:                   "Example",
+					URI:                    "https://example.com/feed",
+					UpdateFrequencySeconds: 3600,
+					Active:                 true,
+				},
+				Items:       items,
+				Subscribers: []string{"user@example.com"},
+			},
+		},
+	})
+	userID := loaded.Users["user@example.com"]
+	feedID := loaded.Feeds["https://example.com/feed"]
+
+	settings := &Config{
+		URIPrefix:       "/gorse",
+		DisplayTimeZone: "UTC",
+		WebRoot:         "static",
+		TemplateDir:     "templates",
+	}
+	sessionStore := sessions.NewCookieStore([]byte(strings.Repeat("k", 32)))
+
+	list := func(query string) string {
+		request := httptest.NewRequest(http.MethodGet,
+			"/feeds?"+query, nil)
+		session, err := sessionStore.New(request, "gorse")
+		if err != nil {
+			t.Fatalf("creating session: %s", err)
+		}
+		session.Values[sessionUserKey] = userID
+		rw := httptest.NewRecorder()
+		handlerFeeds(rw, request, settings, store, session)
+		if rw.Code != http.StatusOK {
+			t.Fatalf("GET = status %d: %s, wanted %d", rw.Code, rw.Body.String(),
+				http.StatusOK)
+		}
+		return rw.Body.String()
+	}
+
+	setFrequency := func(minutes string) int {
+		form := url.Values{
+			"feed-id": {fmt.Sprintf("%d", feedID)},
+			"minutes": {minutes},
+		}
+		request := httptest.NewRequest(http.MethodPost, "/feed_frequency",
+			strings.NewReader(form.Encode()))
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		session, err := sessionStore.New(request, "gorse")
+		if err != nil {
+			t.Fatalf("creating session: %s", err)
+		}
+		session.Values[sessionUserKey] = userID
+		rw := httptest.NewRecorder()
+		handlerFeedFrequency(rw, request, settings, store, session)
+		return rw.Code
+	}
+
+	// Two items a day for 12 days.
+	body := list("")
+	if !strings.Contains(body, "2.0 a day") ||
+		!strings.Contains(body, `name="minutes" value="60"`) ||
+		strings.Contains(body, "Save to use the suggestion.") {
+		t.Errorf("GET = %s, wanted the rate and current frequency", body)
+	}
+
+	body = list(fmt.Sprintf("suggest=%d", feedID))
+	if !strings.Contains(body, `name="minutes" value="720"`) ||
+		!strings.Contains(body, "Save to use the suggestion.") {
+		t.Errorf("GET suggest = %s, wanted 12 hours suggested", body)
+	}
+
+	if code := setFrequency("720"); code != http.StatusFound {
+		t.Fatalf("POST = status %d, wanted %d", code, http.StatusFound)
+	}
+	feed, err := store.GetFeedByURI(ctx, "https://example.com/feed")
+	if err != nil {
+		t.Fatalf("GetFeedByURI() = error %s", err)
+	}
+	if feed.UpdateFrequencySeconds != 720*60 {
+		t.Errorf("update frequency = %d, wanted %d", feed.UpdateFrequencySeconds,
+			720*60)
+	}
+
+	for _, minutes := range []string{"0", "-5", "soon",
+		fmt.Sprintf("%d", maxUpdateFrequencyMinutes+1)} {
+		if code := setFrequency(minutes); code != http.StatusBadRequest {
+			t.Errorf("POST %s minutes = status %d, wanted %d", minutes, code,
+				http.StatusBadRequest)
+		}
+	}
+}
+
+func TestHandlerFeedsSortIntegration(t *testing.T) {
+	for _, dbType := range gorsetest.Types {
+		t.Run(dbType, func(t *testing.T) {
+			testHandlerFeedsSortIntegration(t, dbType)
+		})
+	}
+}
+
+func testHandlerFeedsSortIntegration(t *testing.T, dbType string) {
+	ctx := context.Background()
+	store, _ := gorsetest.Store(t, dbType)
+
+	var feeds []gorsetest.Feed
+	for i := 0; i < pageSize+1; i++ {
+		feeds = append(feeds, gorsetest.Feed{
+			DBFeed: gorse.DBFeed{
+				Name:                   fmt.Sprintf("Feed %02d", i),
+				URI:                    fmt.Sprintf("https://example.com/%d", i),
+				UpdateFrequencySeconds: 3600,
+				Active:                 true,
+			},
+			Subscribers: []string{"user@example.com"},
+		})
+	}
+
+	loaded := gorsetest.Load(t, store, gorsetest.Fixture{
+		Users: []gorsetest.User{
+			{Email: "user@example.com", Password: "password"},
+		},
+		Feeds: feeds,
+	})
+	userID := loaded.Users["user@example.com"]
+	lastID := loaded.Feeds[fmt.Sprintf("https://example.com/%d", pageSize)]
+
+	for i := 0; i < 3; i++ {
+		if err := store.SetFeedError(ctx, lastID, "timeout"); err != nil {
+			t.Fatalf("SetFeedError() = error %s", err)
+		}
+	}
+
+	settings := &Config{
+		URIPrefix:       "/gorse",
+		DisplayTimeZone: "UTC",
+		WebRoot:         "static",
+		TemplateDir:     "templates",
+	}
+	sessionStore := sessions.NewCookieStore([]byte(strings.Repeat("k", 32)))
+
+	get := func(query string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodGet,
+			"/feeds?"+query, nil)
+		session, err := sessionStore.New(request, "gorse")
+		if err != nil {
+			t.Fatalf("creating session: %s", err)
+		}
+		session.Values[sessionUserKey] = userID
+		rw := httptest.NewRecorder()
+		handlerFeeds(rw, request, settings, store, session)
+		return rw
+	}
+
+	rw := get("")
+	body := rw.Body.String()
+	if rw.Code != http.StatusOK || !strings.Contains(body, "51 feeds.") ||
+		!strings.Contains(body, "Feed 00") || strings.Contains(body, "Feed 50") ||
+		!strings.Contains(body, "sort=name&amp;page=2") {
+		t.Errorf("GET = status %d: %s, wanted the first page by name", rw.Code,
+			body)
+	}
+
+	rw = get("sort=errors")
+	body = rw.Body.String()
+	if rw.Code != http.StatusOK || !strings.Contains(body, "Feed 50") ||
+		!strings.Contains(body, "Failed 3 times in a row") ||
+		!strings.Contains(body, "sort=errors&amp;page=2") {
+		t.Errorf("GET sort by errors = status %d: %s, wanted the failing feed "+
+			"first", rw.Code, body)
+	}
+
+	rw = get("sort=name&page=2")
+	body = rw.Body.String()
+	if rw.Code != http.StatusOK || !strings.Contains(body, "Feed 50") ||
+		strings.Contains(body, "Feed 00") {
+		t.Errorf("GET page 2 = status %d: %s, wanted the last feed", rw.Code,
+			body)
+	}
+
+	for _, query := range []string{"&sort=size", "&page=0"} {
+		if rw := get(query); rw.Code != http.StatusBadRequest {
+			t.Errorf("GET %s = status %d, wanted %d", query, rw.Code,
+				http.StatusBadRequest)
+		}
+	}
+
+	form := url.Values{
+		"feed-id": {fmt.Sprintf("%d", lastID)},
+		"archive": {"1"},
+		"sort":    {"errors"},
+		"page":    {"1"},
+	}
+	request := httptest.NewRequest(http.MethodPost, "/feed_archive",
+		strings.NewReader(form.Encode()))
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	session, err := sessionStore.New(request, "gorse")
+	if err != nil {
+		t.Fatalf("creating session: %s", err)
+	}
+	session.Values[sessionUserKey] = userID
+	rw = httptest.NewRecorder()
+	handlerFeedArchive(rw, request, settings, store, session)
+	want := "/gorse/feeds?page=1&sort=errors"
+	if rw.Code != http.StatusFound || rw.Header().Get("Location") != want {
+		t.Errorf("POST = status %d, Location %s, wanted %d, %s", rw.Code,
+			rw.Header().Get("Location"), http.StatusFound, want)
+	}
+}
+
+func TestHandlerFeedManageIntegration(t *testing.T) {
+	for _, dbType := range gorsetest.Types {
+		t.Run(dbType, func(t *testing.T) {
+			testHandlerFeedManageIntegration(t, dbType)
+		})
+	}
+}
+
+func testHandlerFeedManageIntegration(t *testing.T, dbType string) {
+	ctx := context.Background()
+	store, _ := gorsetest.Store(t, dbType)
+
+	loaded := gorsetest.Load(t, store, gorsetest.Fixture{
+		Users: []gorsetest.User{
+			{Email: "user@example.com", Password: "password", Admin: true},
+			{Email: "other@example.com", Password: "password"},
+		},
+		Feeds: []gorsetest.Feed{
+			{
+				DBFeed: gorse.DBFeed{
+					Name:                   "Example",
+					URI:                    "https://example.com/feed",
+					UpdateFrequencySeconds: 3600,
+					Active:                 true,
+				},
+				Items: []rss.Item{
+					{Title: "One", Link: "https://example.com/1", PubDate: time.Now()},
+				},
+				Subscribers: []string{"user@example.com", "other@example.com"},
+			},
+			{
+				DBFeed: gorse.DBFeed{
+					Name:                   "Other",
+					URI:                    "https://example.org/feed",
+					UpdateFrequencySeconds: 3600,
+					Active:                 true,
+				},
+				Subscribers: []string{"user@example.com"},
+			},
+			{
+				DBFeed: gorse.DBFeed{
+					Name:                   "Unsubscribed",
+					URI:                    "https://example.net/feed",
+					UpdateFrequencySeconds: 3600,
+					Active:                 true,
+				},
+			},
+		},
+	})
+	userID := loaded.Users["user@example.com"]
+	feedID := loaded.Feeds["https://example.com/feed"]
+
+	settings := &Config{
+		URIPrefix:       "/gorse",
+		DisplayTimeZone: "UTC",
+		WebRoot:         "static",
+		TemplateDir:     "templates",
+	}
+	sessionStore := sessions.NewCookieStore([]byte(strings.Repeat("k", 32)))
+
+	postAs := func(userID int, handler func(http.ResponseWriter,
+		*http.Request, *Config, gorse.Store, *sessions.Session), path string,
+		feedID int64, form url.Values) *httptest.ResponseRecorder {
+		form.Set("feed-id", fmt.Sprintf("%d", feedID))
+		form.Set("sort", "errors")
+		request := httptest.NewRequest(http.MethodPost, path,
+			strings.NewReader(form.Encode()))
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		session, err := sessionStore.New(request, "gorse")
+		if err != nil {
+			t.Fatalf("creating session: %s", err)
+		}
+		session.Values[sessionUserKey] = userID
+		rw := httptest.NewRecorder()
+		handler(rw, request, settings, store, session)
+		return rw
+	}
+
+	post := func(handler func(http.ResponseWriter, *http.Request, *Config,
+		gorse.Store, *sessions.Session), path string, feedID int64,
+		form url.Values) *httptest.ResponseRecorder {
+		return postAs(userID, handler, path, feedID, form)
+	}
+
+	getFeed := func() gorse.DBFeed {
+		feeds, err := store.ListSubscriptions(ctx, userID)
+		if err != nil {
+			t.Fatalf("ListSubscriptions() = error %s", err)
+		}
+		for _, feed := range feeds {
+			if feed.ID == feedID {
+				return feed
+			}
+		}
+		t.Fatalf("ListSubscriptions() = %v, wanted feed %d", feeds, feedID)
+		return gorse.DBFeed{}
+	}
+
+	// Feeds are shared, so someone who only subscribes may not change them.
+	otherID := loaded.Users["other@example.com"]
+	for _, test := range []struct {
+		handler func(http.ResponseWriter, *http.Request, *Config, gorse.Store,
+			*sessions.Session)
+		path string
+		form url.Values
+	}{
+		{handlerFeedUpdate, "/feed_update", url.Values{"name": {"Mine"},
+			"uri": {"https://example.com/mine"}}},
+		{handlerFeedActive, "/feed_active", url.Values{"active": {"0"}}},
+		{handlerFeedDelete, "/feed_delete", url.Values{"items": {"purge"}}},
+	} {
+		if rw := postAs(otherID, test.handler, test.path, feedID,
+			test.form); rw.Code != http.StatusForbidden {
+			t.Errorf("POST %s as a subscriber = status %d, wanted %d", test.path,
+				rw.Code, http.StatusForbidden)
+		}
+	}
+	if feed := getFeed(); feed.Name != "Example" || !feed.Active {
+		t.Errorf("feed = %+v after a subscriber's changes, wanted it unchanged",
+			feed)
+	}
+
+	update := func(name, uri string) *httptest.ResponseRecorder {
+		return post(handlerFeedUpdate, "/feed_update", feedID,
+			url.Values{"name": {name}, "uri": {uri}})
+	}
+
+	rw := update(" Renamed ", "https://example.com/new-feed")
+	if rw.Code != http.StatusFound {
+		t.Fatalf("POST update = status %d: %s, wanted %d", rw.Code,
+			rw.Body.String(), http.StatusFound)
+	}
+	wantLocation := "/gorse/feeds?sort=errors"
+	if location := rw.Header().Get("Location"); location != wantLocation {
+		t.Errorf("Location = %s, wanted %s", location, wantLocation)
+	}
+	feed := getFeed()
+	if feed.Name != "Renamed" || feed.URI != "https://example.com/new-feed" ||
+		feed.UpdateFrequencySeconds != 3600 || !feed.Active {
+		t.Errorf("feed = %+v, wanted the new name and URL and the rest kept",
+			feed)
+	}
+
+	for _, test := range []struct {
+		name string
+		uri  string
+	}{
+		{"", "https://example.com/feed"},
+		{"Renamed", "ftp://example.com/feed"},
+		{"Renamed", "not a url"},
+		{"Renamed", "https://example.org/feed"},
+	} {
+		if rw := update(test.name, test.uri); rw.Code != http.StatusBadRequest {
+			t.Errorf("POST update %q %q = status %d, wanted %d", test.name,
+				test.uri, rw.Code, http.StatusBadRequest)
+		}
+	}
+	if feed := getFeed(); feed.URI != "https://example.com/new-feed" {
+		t.Errorf("URI = %s after bad updates, wanted it unchanged", feed.URI)
+	}
+
+	if rw := post(handlerFeedActive, "/feed_active", feedID,
+		url.Values{"active": {"0"}}); rw.Code != http.StatusFound {
+		t.Fatalf("POST inactive = status %d, wanted %d", rw.Code,
+			http.StatusFound)
+	}
+	if getFeed().Active {
+		t.Errorf("feed active after turning it off")
+	}
+	if rw := post(handlerFeedActive, "/feed_active", feedID,
+		url.Values{"active": {"1"}}); rw.Code != http.StatusFound {
+		t.Fatalf("POST active = status %d, wanted %d", rw.Code, http.StatusFound)
+	}
+	if !getFeed().Active {
+		t.Errorf("feed inactive after turning it on")
+	}
+
+	if rw := post(handlerFeedDelete, "/feed_delete", feedID,
+		url.Values{"items": {"forget"}}); rw.Code != http.StatusBadRequest {
+		t.Errorf("POST delete bad retention = status %d, wanted %d", rw.Code,
+			http.StatusBadRequest)
+	}
+
+	if rw := post(handlerFeedDelete, "/feed_delete",
+		loaded.Feeds["https://example.net/feed"],
+		url.Values{"items": {"keep"}}); rw.Code != http.StatusBadRequest {
+		t.Errorf("POST delete unsubscribed = status %d, wanted %d", rw.Code,
+			http.StatusBadRequest)
+	}
+
+	if rw := post(handlerFeedDelete, "/feed_delete", feedID,
+		url.Values{"items": {"purge"}}); rw.Code != http.StatusFound {
+		t.Fatalf("POST delete = status %d: %s, wanted %d", rw.Code,
+			rw.Body.String(), http.StatusFound)
+	}
+	feeds, err := store.ListSubscriptions(ctx, userID)
+	if err != nil {
+		t.Fatalf("ListSubscriptions() = error %s", err)
+	}
+	if len(feeds) != 1 || feeds[0].Name != "Other" {
+		t.Errorf("ListSubscriptions() = %v, wanted only Other", feeds)
+	}
+	if _, err := store.GetItem(ctx, loaded.Items["https://example.com/1"],
+		userID); err != gorse.ErrNotFound {
+		t.Errorf("GetItem() = error %v, wanted %s", err, gorse.ErrNotFound)
+	}
+}
@@ -5,49 +5,95 @@
 //
 // The interface shows items from feeds and allows flagging them as read.
 //
-// For the database schema, refer to gorsepoll.
+// For the database schema, refer to the migrations directory of the gorse
+// package.
 //
 package main
 
 import (
+	"context"
 	"database/sql"
 	"flag"
 	"fmt"
 	"html/template"
 	"log"
 	"math"
-	"net"
 	"net/http"
-	"net/http/fcgi"
 	"net/url"
 	"os"
 	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
-	"sync"
 	"time"
+	"unicode/utf8"
 
-	"github.com/gorilla/context"
+	gcontext "github.com/gorilla/context"
 	"github.com/gorilla/sessions"
 	"github.com/horgh/config"
 	"github.com/horgh/gorse"
-	_ "github.com/lib/pq"
+	"github.com/horgh/gorse/internal/sendto"
+	"github.com/horgh/gorse/internal/version"
 )
 
 // Config holds runtime configuration information.
 type Config struct {
+	// ListenHost is the host to listen on, or the path to a unix socket. We
+	// ignore ListenPort for a unix socket.
 	ListenHost string
 	ListenPort uint64
 
+	// The unix socket's permissions in octal, such as 0660. Blank for 0660.
+	ListenSocketMode string
+
 	// Whether to serve using FastCGI (1) or regular HTTP (0)
 	FastCGI int32
 
+	// Whether to serve the Go profiler and runtime statistics to admins under
+	// /debug (1) or not (0).
+	DebugEndpoints int32
+
+	// Database type: postgres or sqlite3. For sqlite3, DBName is the path to
+	// the database file.
+	DBType string
 	DBUser string
 	DBPass string
 	DBName string
 	DBHost string
 
+	// DBPassFile is a file holding the database password, such as a systemd
+	// credential, to use instead of DBPass.
+	DBPassFile string
+
+	// Database connection pool limits. 0 means use the default.
+	DBMaxOpenConns           int64
+	DBMaxIdleConns           int64
+	DBConnMaxLifetimeSeconds int64
+
+	// How long a query may run before the database cancels it, and how long
+	// one may take before we log it. 0 means no limit and not to log.
+	DBStatementTimeoutSeconds int64
+	DBSlowQueryMilliseconds   int64
+
+	// How often to poll feeds, in seconds. 0 means we don't, and gorsepoll
+	// does.
+	PollIntervalSeconds int64
+
+	// How many hosts to poll feeds from at once. 0 means 1.
+	PollConcurrency int64
+
+	// How long in seconds we wait on the database to record a feed when
+	// polling. 0 means no limit.
+	PollDBTimeoutSeconds int64
+
+	// How long in seconds a request may take. Once it is up, the request's
+	// context ends, cancelling its queries even if a connection stops
+	// responding. 0 means no limit.
+	RequestTimeoutSeconds int64
+
+	// The largest form we accept in bytes. 0 means defaultMaxFormBytes.
+	MaxFormBytes int64
+
 	// TODO: Auto detect timezone, or move this to a user setting
 	DisplayTimeZone string
 
@@ -55,21 +101,60 @@ type Config struct {
 	CookieAuthenticationKey string
 	SessionName             string
 	LogFile                 string
-	WebRoot                 string
-	TemplateDir             string
-}
 
-// DB is the connection to the database.
-//
-// This is so we try to share a single connection for multiple requests.
-//
-// Note according to the database/sql documentation, the DB type is indeed safe
-// for concurrent use by multiple goroutines.
-var DB *sql.DB
-
-// DBLock helps us avoid race conditions associated with the database. Such as
-// connecting to it (assigning the global).
-var DBLock sync.Mutex
+	// CookieAuthenticationKeyFile is a file holding the cookie authentication
+	// key to use instead of CookieAuthenticationKey.
+	CookieAuthenticationKeyFile string
+
+	// CookieEncryptionKey encrypts session cookies. Blank to not. See
+	// cookieKeyPairs for how this and CookieAuthenticationKey can hold several
+	// keys to rotate them.
+	CookieEncryptionKey string
+
+	// CookieEncryptionKeyFile is a file holding the cookie encryption key to
+	// use instead of CookieEncryptionKey.
+	CookieEncryptionKeyFile string
+
+	// LogLevel is info, or debug to also log each request's parameters and
+	// how long it took. Blank means info.
+	LogLevel string
+
+	// AccessLogFile is the file to record each request to, separate from
+	// LogFile. - for stdout, or blank to not keep an access log.
+	AccessLogFile string
+
+	// AccessLogFormat is json (one object per request), or common for the
+	// Common Log Format. Blank means json.
+	AccessLogFormat string
+
+	WebRoot     string
+	TemplateDir string
+
+	// StaticMaxAgeSeconds is how long browsers may cache static files requested
+	// without their version. 0 means they must check each time whether they
+	// changed. Versioned requests, as our pages make, may be cached forever.
+	StaticMaxAgeSeconds int64
+
+	// SMTP server to email items through when people share them. Blank
+	// SMTPHost means we don't offer to email items. SMTPUsername blank means
+	// the server doesn't need us to log in.
+	SMTPHost     string
+	SMTPPort     int64
+	SMTPUsername string
+	SMTPPassword string
+
+	// SMTPPasswordFile is a file holding the SMTP password to use instead of
+	// SMTPPassword.
+	SMTPPasswordFile string
+
+	// SMTPFrom is the address we email items from.
+	SMTPFrom string
+
+	// ExtensionOrigins are the origins of browser extensions we let use the
+	// /extension endpoints, separated by spaces, such as
+	// moz-extension://<uuid>. Blank to allow none.
+	ExtensionOrigins string
+}
 
 // HTTPHandler holds functions/data used to service HTTP requests.
 //
@@ -78,17 +163,127 @@ var DBLock sync.Mutex
 type HTTPHandler struct {
 	settings     *Config
 	sessionStore *sessions.CookieStore
+	store        gorse.Store
+
+	// db is the database the store uses. We report on its connection pool.
+	db *sql.DB
+
+	// accessLog records each request. It's nil if we don't keep one.
+	accessLog *accessLog
 }
 
 const pageSize = 50
 
+// failingFeedErrors is how many times in a row polling a feed must fail for
+// us to point it out on the list of items. One failure is often a blip.
+const failingFeedErrors = 3
+
 func main() {
 	log.SetFlags(log.Ldate | log.Ltime)
 
 	configPath := flag.String("config", "", "Path to a configuration file.")
+	showVersion := flag.Bool("version", false, "Print the version and exit.")
+
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(),
+			"Usage: %s -config <file> [command]\n\n", os.Args[0])
+		fmt.Fprintf(flag.CommandLine.Output(), "Commands:\n")
+		fmt.Fprintf(flag.CommandLine.Output(),
+			"  migrate\tApply any outstanding database migrations and exit.\n")
+		fmt.Fprintf(flag.CommandLine.Output(),
+			"  export <email>\tWrite all of the user's data as JSON to stdout and "+
+				"exit.\n")
+		fmt.Fprintf(flag.CommandLine.Output(),
+			"  import <email> <file>\tImport a Miniflux or Tiny Tiny RSS export "+
+				"for the user and exit.\n")
+		fmt.Fprintf(flag.CommandLine.Output(),
+			"  create-user <email> [admin]\tAdd a user who logs in with the "+
+				"password on standard input and exit. admin makes them an admin."+
+				"\n")
+		fmt.Fprintf(flag.CommandLine.Output(),
+			"  set-password <email>\tSet the user's password to the one on "+
+				"standard input and exit.\n")
+		fmt.Fprintf(flag.CommandLine.Output(),
+			"  set-locale <email> <locale> [relative|absolute]\tSet the language "+
+				"and date format the user sees and exit. browser for the locale "+
+				"to be what their browser asks for.\n")
+		fmt.Fprintf(flag.CommandLine.Output(),
+			"  set-share-email <email> <address>\tSet where the user emails "+
+				"items they share unless they say otherwise and exit. none for "+
+				"nowhere.\n")
+		fmt.Fprintf(flag.CommandLine.Output(),
+			"  set-kindle-email <email> <address>\tSet where the user emails "+
+				"books of items to read later, such as their Kindle's address, "+
+				"and exit. none for nowhere.\n")
+		fmt.Fprintf(flag.CommandLine.Output(),
+			"  share-starred <email> on|off\tStart or stop publishing the items "+
+				"the user starred as a feed anyone with its URL can follow, and "+
+				"exit. Starting prints the URL. Starting again changes it.\n")
+		fmt.Fprintf(flag.CommandLine.Output(),
+			"  set-feed-display <email> <feed URI> full|summary|title\tSet "+
+				"whether the user's lists show the feed's items in full, as "+
+				"summaries, or as only titles, and exit.\n")
+		fmt.Fprintf(flag.CommandLine.Output(),
+			"  set-integration <email> <service> [key=value ...]\tSet up the "+
+				"user to send items to pocket or wallabag and exit. Pocket needs "+
+				"consumer-key and access-token. Wallabag needs url, client-id, "+
+				"client-secret, username, and password. mark-read=true sets items "+
+				"read once sent.\n")
+		fmt.Fprintf(flag.CommandLine.Output(),
+			"  remove-integration <email> <service>\tStop the user sending items "+
+				"to the service and exit.\n")
+		fmt.Fprintf(flag.CommandLine.Output(),
+			"  add-notifier <email> <service> [key=value ...]\tPost the user's "+
+				"new items to a telegram or slack chat and exit. Telegram needs "+
+				"token and chat-id. Slack needs url, the webhook. feed=<uri> posts "+
+				"only that feed's items, and match=<text> only items containing "+
+				"the text.\n")
+		fmt.Fprintf(flag.CommandLine.Output(),
+			"  list-notifiers <email>\tList the chats we post the user's new "+
+				"items to and exit.\n")
+		fmt.Fprintf(flag.CommandLine.Output(),
+			"  remove-notifier <email> <id>\tStop posting to the chat and exit."+
+				"\n")
+		fmt.Fprintf(flag.CommandLine.Output(),
+			"  mute <email> <phrase> [mark-read|regex]\tHide the user's unread "+
+				"items containing the phrase, ignoring case, and exit. mark-read "+
+				"also marks new items containing it read. regex says the phrase is "+
+				"a regular expression, and marks new items matching it read.\n")
+		fmt.Fprintf(flag.CommandLine.Output(),
+			"  unmute <email> <phrase>\tStop hiding items containing the phrase "+
+				"and exit.\n")
+		fmt.Fprintf(flag.CommandLine.Output(),
+			"  list-mutes <email>\tList the phrases the user muted and exit.\n")
+		fmt.Fprintf(flag.CommandLine.Output(),
+			"  highlight <email> <phrase>\tMark the user's items containing the "+
+				"phrase, ignoring case, and exit. Highlights on the list of unread "+
+				"items shows only these.\n")
+		fmt.Fprintf(flag.CommandLine.Output(),
+			"  unhighlight <email> <phrase>\tStop marking items containing the "+
+				"phrase and exit.\n")
+		fmt.Fprintf(flag.CommandLine.Output(),
+			"  list-highlights <email>\tList the phrases the user highlights and "+
+				"exit.\n")
+		fmt.Fprintf(flag.CommandLine.Output(),
+			"  gen-key\tPrint new cookie keys for the config and exit. This "+
+				"doesn't need -config.\n\n")
+		flag.PrintDefaults()
+	}
 
 	flag.Parse()
 
+	if *showVersion {
+		fmt.Printf("gorse %s\n", version.Get())
+		return
+	}
+
+	if flag.Arg(0) == "gen-key" {
+		if err := genKey(os.Stdout); err != nil {
+			log.Fatalf("Failed to generate keys: %s", err)
+		}
+		return
+	}
+
 	if len(*configPath) == 0 {
 		fmt.Println("You must specify a configuration file.")
 		flag.PrintDefaults()
@@ -101,16 +296,257 @@ func main() {
 		log.Fatalf("Failed to retrieve config: %s", err)
 	}
 
-	if settings.LogFile == "" {
-		log.Fatalf("You must provide a log file.")
+	if err := readSecrets(&settings); err != nil {
+		log.Fatalf("Failed to read secrets: %s", err)
 	}
 
+	switch flag.Arg(0) {
+	case "":
+	case "migrate":
+		if err := migrateDB(context.Background(), &settings); err != nil {
+			log.Fatalf("Failed to migrate database: %s", err)
+		}
+		return
+	case "export":
+		if flag.NArg() != 2 {
+			log.Printf("You must specify the user's email.")
+			flag.Usage()
+			os.Exit(1)
+		}
+		if err := exportUser(context.Background(), &settings, flag.Arg(1),
+			os.Stdout); err != nil {
+			log.Fatalf("Failed to export: %s", err)
+		}
+		return
+	case "import":
+		if flag.NArg() != 3 {
+			log.Printf("You must specify the user's email and the file to import.")
+			flag.Usage()
+			os.Exit(1)
+		}
+		if err := importUser(context.Background(), &settings, flag.Arg(1),
+			flag.Arg(2)); err != nil {
+			log.Fatalf("Failed to import: %s", err)
+		}
+		return
+	case "set-locale":
+		if flag.NArg() != 3 && flag.NArg() != 4 {
+			log.Printf("You must specify the user's email and the locale.")
+			flag.Usage()
+			os.Exit(1)
+		}
+		if err := setLocale(context.Background(), &settings, flag.Arg(1),
+			flag.Arg(2), flag.Arg(3)); err != nil {
+			log.Fatalf("Failed to set locale: %s", err)
+		}
+		return
+	case "set-share-email":
+		if flag.NArg() != 3 {
+			log.Printf("You must specify the user's email and the address.")
+			flag.Usage()
+			os.Exit(1)
+		}
+		if err := setShareEmail(context.Background(), &settings, flag.Arg(1),
+			flag.Arg(2)); err != nil {
+			log.Fatalf("Failed to set share email: %s", err)
+		}
+		return
+	case "set-kindle-email":
+		if flag.NArg() != 3 {
+			log.Printf("You must specify the user's email and the address.")
+			flag.Usage()
+			os.Exit(1)
+		}
+		if err := setKindleEmail(context.Background(), &settings, flag.Arg(1),
+			flag.Arg(2)); err != nil {
+			log.Fatalf("Failed to set Kindle email: %s", err)
+		}
+		return
+	case "share-starred":
+		if flag.NArg() != 3 {
+			log.Printf("You must specify the user's email and on or off.")
+			flag.Usage()
+			os.Exit(1)
+		}
+		if err := shareStarred(context.Background(), &settings, flag.Arg(1),
+			flag.Arg(2)); err != nil {
+			log.Fatalf("Failed to share starred items: %s", err)
+		}
+		return
+	case "set-feed-display":
+		if flag.NArg() != 4 {
+			log.Printf("You must specify the user's email, the feed's URI, and " +
+				"full, summary, or title.")
+			flag.Usage()
+			os.Exit(1)
+		}
+		if err := setFeedDisplay(context.Background(), &settings, flag.Arg(1),
+			flag.Arg(2), flag.Arg(3)); err != nil {
+			log.Fatalf("Failed to set feed display: %s", err)
+		}
+		return
+	case "set-integration":
+		if flag.NArg() < 3 {
+			log.Printf("You must specify the user's email and the service.")
+			flag.Usage()
+			os.Exit(1)
+		}
+		if err := setIntegration(context.Background(), &settings, flag.Arg(1),
+			flag.Arg(2), flag.Args()[3:]); err != nil {
+			log.Fatalf("Failed to set integration: %s", err)
+		}
+		return
+	case "remove-integration":
+		if flag.NArg() != 3 {
+			log.Printf("You must specify the user's email and the service.")
+			flag.Usage()
+			os.Exit(1)
+		}
+		if err := removeIntegration(context.Background(), &settings,
+			flag.Arg(1), flag.Arg(2)); err != nil {
+			log.Fatalf("Failed to remove integration: %s", err)
+		}
+		return
+	case "add-notifier":
+		if flag.NArg() < 3 {
+			log.Printf("You must specify the user's email and the service.")
+			flag.Usage()
+			os.Exit(1)
+		}
+		if err := addNotifier(context.Background(), &settings, flag.Arg(1),
+			flag.Arg(2), flag.Args()[3:], os.Stdout); err != nil {
+			log.Fatalf("Failed to add notifier: %s", err)
+		}
+		return
+	case "list-notifiers":
+		if flag.NArg() != 2 {
+			log.Printf("You must specify the user's email.")
+			flag.Usage()
+			os.Exit(1)
+		}
+		if err := listNotifiers(context.Background(), &settings, flag.Arg(1),
+			os.Stdout); err != nil {
+			log.Fatalf("Failed to list notifiers: %s", err)
+		}
+		return
+	case "remove-notifier":
+		if flag.NArg() != 3 {
+			log.Printf("You must specify the user's email and the notifier's ID.")
+			flag.Usage()
+			os.Exit(1)
+		}
+		if err := removeNotifier(context.Background(), &settings, flag.Arg(1),
+			flag.Arg(2)); err != nil {
+			log.Fatalf("Failed to remove notifier: %s", err)
+		}
+		return
+	case "create-user":
+		if flag.NArg() != 2 && flag.NArg() != 3 {
+			log.Printf("You must specify the user's email.")
+			flag.Usage()
+			os.Exit(1)
+		}
+		if err := createUser(context.Background(), &settings, flag.Arg(1),
+			flag.Arg(2), os.Stdin); err != nil {
+			log.Fatalf("Failed to create user: %s", err)
+		}
+		return
+	case "set-password":
+		if flag.NArg() != 2 {
+			log.Printf("You must specify the user's email.")
+			flag.Usage()
+			os.Exit(1)
+		}
+		if err := setPassword(context.Background(), &settings, flag.Arg(1),
+			os.Stdin); err != nil {
+			log.Fatalf("Failed to set password: %s", err)
+		}
+		return
+	case "mute":
+		if flag.NArg() != 3 && flag.NArg() != 4 {
+			log.Printf("You must specify the user's email and the phrase.")
+			flag.Usage()
+			os.Exit(1)
+		}
+		if err := muteKeyword(context.Background(), &settings, flag.Arg(1),
+			flag.Arg(2), flag.Arg(3)); err != nil {
+			log.Fatalf("Failed to mute phrase: %s", err)
+		}
+		return
+	case "unmute":
+		if flag.NArg() != 3 {
+			log.Printf("You must specify the user's email and the phrase.")
+			flag.Usage()
+			os.Exit(1)
+		}
+		if err := unmuteKeyword(context.Background(), &settings, flag.Arg(1),
+			flag.Arg(2)); err != nil {
+			log.Fatalf("Failed to unmute phrase: %s", err)
+		}
+		return
+	case "list-mutes":
+		if flag.NArg() != 2 {
+			log.Printf("You must specify the user's email.")
+			flag.Usage()
+			os.Exit(1)
+		}
+		if err := listMutedKeywords(context.Background(), &settings, flag.Arg(1),
+			os.Stdout); err != nil {
+			log.Fatalf("Failed to list muted phrases: %s", err)
+		}
+		return
+	case "highlight":
+		if flag.NArg() != 3 {
+			log.Printf("You must specify the user's email and the phrase.")
+			flag.Usage()
+			os.Exit(1)
+		}
+		if err := addHighlight(context.Background(), &settings, flag.Arg(1),
+			flag.Arg(2)); err != nil {
+			log.Fatalf("Failed to highlight phrase: %s", err)
+		}
+		return
+	case "unhighlight":
+		if flag.NArg() != 3 {
+			log.Printf("You must specify the user's email and the phrase.")
+			flag.Usage()
+			os.Exit(1)
+		}
+		if err := removeHighlight(context.Background(), &settings, flag.Arg(1),
+			flag.Arg(2)); err != nil {
+			log.Fatalf("Failed to remove highlight: %s", err)
+		}
+		return
+	case "list-highlights":
+		if flag.NArg() != 2 {
+			log.Printf("You must specify the user's email.")
+			flag.Usage()
+			os.Exit(1)
+		}
+		if err := listHighlights(context.Background(), &settings, flag.Arg(1),
+			os.Stdout); err != nil {
+			log.Fatalf("Failed to list highlights: %s", err)
+		}
+		return
+	default:
+		log.Printf("Unknown command: %s", flag.Arg(0))
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	if problems := validateConfig(&settings); len(problems) > 0 {
+		for _, problem := range problems {
+			log.Printf("Config problem: %s", problem)
+		}
+		log.Fatalf("Found %d problem(s) in %s. Fix them and start again.",
+			len(problems), *configPath)
+	}
+
+	var logFiles []*logFile
 	if settings.LogFile != "-" {
-		// Open log file. Don't use os.Create() because that truncates.
-		logFh, err := os.OpenFile(settings.LogFile,
-			os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+		logFh, err := openLogFile(settings.LogFile)
 		if err != nil {
-			log.Fatalf("Failed to open log file: %s: %s", settings.LogFile, err)
+			log.Fatalf("Failed to open log file: %s", err)
 		}
 
 		defer func() {
@@ -121,10 +557,36 @@ func main() {
 		}()
 
 		log.SetOutput(logFh)
+		logFiles = append(logFiles, logFh)
+	}
+
+	var accessLogger *accessLog
+	if settings.AccessLogFile != "" {
+		accessLogger = &accessLog{
+			w:      os.Stdout,
+			common: settings.AccessLogFormat == accessLogCommon,
+		}
+
+		if settings.AccessLogFile != "-" {
+			accessFh, err := openLogFile(settings.AccessLogFile)
+			if err != nil {
+				log.Fatalf("Failed to open access log file: %s", err)
+			}
+
+			defer func() {
+				if err := accessFh.Close(); err != nil {
+					log.Printf("Access log file: Close: %s: %s",
+						settings.AccessLogFile, err)
+				}
+			}()
+
+			accessLogger.w = accessFh
+			logFiles = append(logFiles, accessFh)
+		}
 	}
 
-	if settings.WebRoot == "" {
-		log.Fatalf("You must provide a web root.")
+	if len(logFiles) > 0 {
+		go reopenOnSignal(logFiles...)
 	}
 
 	webRoot, err := filepath.Abs(settings.WebRoot)
@@ -133,9 +595,6 @@ func main() {
 	}
 	settings.WebRoot = webRoot
 
-	if settings.TemplateDir == "" {
-		log.Fatalf("You must provide a template directory")
-	}
 	templateDir, err := filepath.Abs(settings.TemplateDir)
 	if err != nil {
 		log.Fatalf("Unable to make template dir absolute: %s: %s",
@@ -143,50 +602,154 @@ func main() {
 	}
 	settings.TemplateDir = templateDir
 
-	sessionStore := sessions.NewCookieStore(
-		[]byte(settings.CookieAuthenticationKey))
+	// We checked the keys when validating the config.
+	keyPairs, err := cookieKeyPairs(&settings)
+	if err != nil {
+		log.Fatalf("Invalid cookie keys: %s", err)
+	}
+	sessionStore := sessions.NewCookieStore(keyPairs...)
+	// The session says who logged in. Scripts don't need it, and other sites
+	// shouldn't be able to send it along with forms posting to us.
+	sessionStore.Options.HttpOnly = true
+	sessionStore.Options.SameSite = http.SameSiteLaxMode
+
+	db, err := connectToDB(&settings)
+	if err != nil {
+		log.Fatalf("Failed to open database: %s", err)
+	}
+	defer func() {
+		if err := db.Close(); err != nil {
+			log.Printf("Database close: %s", err)
+		}
+	}()
+
+	// The database being unavailable is not fatal. The pool connects when it
+	// comes back.
+	if err := db.PingContext(context.Background()); err != nil {
+		log.Printf("Unable to connect to the database: %s", err)
+	}
+
+	store := gorse.NewSQLStore(db, settings.DBType)
+	defer func() {
+		if err := store.Close(); err != nil {
+			log.Printf("Store close: %s", err)
+		}
+	}()
 
-	hostPort := fmt.Sprintf("%s:%d", settings.ListenHost, settings.ListenPort)
+	// Retry rather than failing requests when the database has a momentary
+	// problem.
+	store.SetRetryPolicy(gorse.DefaultRetryPolicy)
+
+	if settings.DBSlowQueryMilliseconds > 0 {
+		store.SetSlowQueryLog(
+			time.Duration(settings.DBSlowQueryMilliseconds)*time.Millisecond,
+			logSlowQuery)
+	}
 
 	handler := HTTPHandler{
 		settings:     &settings,
 		sessionStore: sessionStore,
+		store:        store,
+		db:           db,
+		accessLog:    accessLogger,
 	}
 
-	// TODO: We serve requests forever. Should we have a signal or a method
-	// to cause this to gracefully stop?
-
-	if settings.FastCGI == 1 {
-		log.Printf("Starting to serve requests on %s (FastCGI)", hostPort)
+	go logDBStats(db, time.Minute)
+
+	pollCtx, stopPolling := context.WithCancel(context.Background())
+	defer stopPolling()
+	polled := make(chan struct{})
+	if settings.PollIntervalSeconds > 0 {
+		go func() {
+			defer close(polled)
+			pollFeeds(pollCtx, store,
+				time.Duration(settings.PollIntervalSeconds)*time.Second,
+				settings.PollConcurrency,
+				time.Duration(settings.PollDBTimeoutSeconds)*time.Second)
+		}()
+	} else {
+		close(polled)
+	}
 
-		listener, err := net.Listen("tcp", hostPort)
-		if err != nil {
-			log.Fatalf("Failed to open port: %s", err)
-		}
+	listener, address, err := listen(&settings)
+	if err != nil {
+		log.Fatalf("Failed to listen: %s", err)
+	}
 
-		err = fcgi.Serve(listener, handler)
-		if err != nil {
-			log.Fatalf("Failed to start serving: %s", err)
-		}
+	if settings.FastCGI == 1 {
+		log.Printf("Starting to serve requests on %s (FastCGI)", address)
 	} else {
-		log.Printf("Starting to serve requests on %s (HTTP)", hostPort)
-
-		s := &http.Server{
-			Addr:    hostPort,
-			Handler: handler,
-		}
+		log.Printf("Starting to serve requests on %s (HTTP)", address)
+	}
 
-		err := s.ListenAndServe()
-		if err != nil {
-			log.Fatalf("Unable to serve: %s", err)
-		}
+	srv := newServer(listener, handler, settings.FastCGI == 1)
+	if err := serveUntilStopped(srv, stopPolling); err != nil {
+		log.Fatalf("Unable to serve: %s", err)
 	}
+
+	// Let the poller finish recording what it's recording.
+	stopPolling()
+	<-polled
+	log.Printf("Stopped")
 }
 
 // ServeHTTP handles an HTTP request. It is invoked by the fastcgi package in a
 // goroutine.
+//
+// We give each request an ID. It starts each log line about the request and
+// shows on error pages so we can find what happened to a request someone
+// reports.
 func (h HTTPHandler) ServeHTTP(rw http.ResponseWriter,
 	request *http.Request) {
+	start := time.Now()
+	uri := request.URL.RequestURI()
+
+	request, requestID := withRequestLog(request,
+		h.settings.LogLevel == logLevelDebug)
+	rw.Header().Set(requestIDHeader, requestID)
+
+	if h.settings.RequestTimeoutSeconds > 0 {
+		ctx, cancel := context.WithTimeout(request.Context(),
+			time.Duration(h.settings.RequestTimeoutSeconds)*time.Second)
+		defer cancel()
+		request = request.WithContext(ctx)
+	}
+	recorder := &statusRecorder{ResponseWriter: rw}
+
+	if request.URL.RawQuery != "" {
+		debugf(request, "Query parameters: %v", request.URL.Query())
+	}
+
+	h.serveRequest(recorder, request)
+
+	if len(request.PostForm) > 0 {
+		debugf(request, "Form parameters: %v", paramNames(request.PostForm))
+	}
+	debugf(request, "Responded %d in %s", recorder.status, time.Since(start))
+
+	if h.accessLog != nil {
+		status := recorder.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		h.accessLog.record(accessEntry{
+			Time:       start,
+			RequestID:  requestID,
+			Remote:     request.RemoteAddr,
+			Method:     request.Method,
+			URI:        uri,
+			Proto:      request.Proto,
+			Status:     status,
+			Bytes:      recorder.bytes,
+			DurationMS: float64(time.Since(start)) / float64(time.Millisecond),
+			UserID:     requestUser(request),
+		})
+	}
+}
+
+// serveRequest finds the handler for the request and runs it.
+func (h HTTPHandler) serveRequest(rw http.ResponseWriter,
+	request *http.Request) {
 
 	// If we're served through FastCGI then we will probably be given a request
 	// prefix. e.g., GET /gorse. Treat this as GET /. Strip the prefix.
@@ -194,46 +757,425 @@ func (h HTTPHandler) ServeHTTP(rw http.ResponseWriter,
 	origPath := request.URL.Path
 	request.URL.Path = strings.TrimPrefix(request.URL.Path, h.settings.URIPrefix)
 
-	log.Printf("Serving [%s] request from [%s] to path [%s] (originally %s)",
+	logf(request, "Serving [%s] request from [%s] to path [%s] (originally %s)",
 		request.Method, request.RemoteAddr, request.URL.Path, origPath)
 
 	// Get existing session, or make a new one.
 	session, err := h.sessionStore.Get(request, h.settings.SessionName)
 	if err != nil {
-		log.Printf("Session Get error: %s", err)
+		logf(request, "Session Get error: %s", err)
 		send500Error(rw, "Failed to get your session.")
-		context.Clear(request)
+		gcontext.Clear(request)
 		return
 	}
 
 	// We need to decide how to parse this request. We do this by looking at the
 	// HTTP method and the path.
 
-	type RequestHandlerFunc func(http.ResponseWriter, *http.Request,
-		*Config, *sessions.Session)
+	type RequestHandlerFunc func(http.ResponseWriter, *http.Request,
+		*Config, gorse.Store, *sessions.Session)
+
+	type RequestHandler struct {
+		Method string
+
+		// Regex pattern on the path to match.
+		PathPattern string
+
+		// The most bytes of body we read. 0 means MaxFormBytes.
+		MaxBodyBytes int64
+
+		Func RequestHandlerFunc
+	}
+
+	handlers := []RequestHandler{
+		// GET /
+		{
+			Method:      "GET",
+			PathPattern: "^/?$",
+			Func:        handlerListItems,
+		},
+
+		// POST /update_read_flags
+		{
+			Method:      "POST",
+			PathPattern: "^/update_read_flags$",
+			Func:        handlerUpdateReadFlags,
+		},
+
+		// POST /mark_all_read
+		{
+			Method:      "POST",
+			PathPattern: "^/mark_all_read$",
+			Func:        handlerMarkAllRead,
+		},
+
+		// GET /save and POST /save
+		{
+			Method:      "GET",
+			PathPattern: "^/save$",
+			Func:        handlerSave,
+		},
+		{
+			Method:      "POST",
+			PathPattern: "^/save$",
+			Func:        handlerSave,
+		},
+
+		// POST /send_to
+		{
+			Method:      "POST",
+			PathPattern: "^/send_to$",
+			Func:        handlerSendTo,
+		},
+
+		// GET /reader
+		{
+			Method:      "GET",
+			PathPattern: "^/reader$",
+			Func:        handlerReader,
+		},
+
+		// POST /email_item
+		{
+			Method:      "POST",
+			PathPattern: "^/email_item$",
+			Func:        handlerEmailItem,
+		},
+
+		// POST /export_epub
+		{
+			Method:      "POST",
+			PathPattern: "^/export_epub$",
+			Func:        handlerExportEPUB,
+		},
+
+		// GET /shared/<token>.rss and .atom
+		{
+			Method:      "GET",
+			PathPattern: `^/shared/[A-Za-z0-9_-]+\.(rss|atom)$`,
+			Func:        handlerSharedFeed,
+		},
+
+		// POST /share_item
+		{
+			Method:      "POST",
+			PathPattern: "^/share_item$",
+			Func:        handlerShareItem,
+		},
+
+		// POST /star_item
+		{
+			Method:      "POST",
+			PathPattern: "^/star_item$",
+			Func:        handlerStarItem,
+		},
+
+		// POST /tag_item
+		{
+			Method:      "POST",
+			PathPattern: "^/tag_item$",
+			Func:        handlerTagItem,
+		},
+
+		// POST /untag_item
+		{
+			Method:      "POST",
+			PathPattern: "^/untag_item$",
+			Func:        handlerUntagItem,
+		},
+
+		// GET /tags
+		{
+			Method:      "GET",
+			PathPattern: "^/tags$",
+			Func:        handlerTags,
+		},
+
+		// GET /rules
+		{
+			Method:      "GET",
+			PathPattern: "^/rules$",
+			Func:        handlerRules,
+		},
+
+		// POST /rule_add
+		{
+			Method:      "POST",
+			PathPattern: "^/rule_add$",
+			Func:        handlerRuleAdd,
+		},
+
+		// POST /rule_delete
+		{
+			Method:      "POST",
+			PathPattern: "^/rule_delete$",
+			Func:        handlerRuleDelete,
+		},
+
+		// GET /muted
+		{
+			Method:      "GET",
+			PathPattern: "^/muted$",
+			Func:        handlerMuted,
+		},
+
+		// POST /mute
+		{
+			Method:      "POST",
+			PathPattern: "^/mute$",
+			Func:        handlerMute,
+		},
+
+		// POST /unmute
+		{
+			Method:      "POST",
+			PathPattern: "^/unmute$",
+			Func:        handlerUnmute,
+		},
+
+		// POST /list_density
+		{
+			Method:      "POST",
+			PathPattern: "^/list_density$",
+			Func:        handlerListDensity,
+		},
+
+		// GET /random
+		{
+			Method:      "GET",
+			PathPattern: "^/random$",
+			Func:        handlerRandom,
+		},
+
+		// POST /next
+		{
+			Method:      "POST",
+			PathPattern: "^/next$",
+			Func:        handlerNext,
+		},
+
+		// GET /recent
+		{
+			Method:      "GET",
+			PathPattern: "^/recent$",
+			Func:        handlerRecentlyRead,
+		},
+
+		// POST /mark_unread
+		{
+			Method:      "POST",
+			PathPattern: "^/mark_unread$",
+			Func:        handlerMarkUnread,
+		},
+
+		// GET /digest
+		{
+			Method:      "GET",
+			PathPattern: "^/digest$",
+			Func:        handlerDigest,
+		},
+
+		// GET /subscribe
+		{
+			Method:      "GET",
+			PathPattern: "^/subscribe$",
+			Func:        handlerSubscribeForm,
+		},
+
+		// POST /subscribe
+		{
+			Method:      "POST",
+			PathPattern: "^/subscribe$",
+			Func:        handlerSubscribe,
+		},
+
+		// GET /feeds
+		{
+			Method:      "GET",
+			PathPattern: "^/feeds$",
+			Func:        handlerFeeds,
+		},
+
+		// POST /feed_archive
+		{
+			Method:      "POST",
+			PathPattern: "^/feed_archive$",
+			Func:        handlerFeedArchive,
+		},
+
+		// POST /feed_full_text
+		{
+			Method:      "POST",
+			PathPattern: "^/feed_full_text$",
+			Func:        handlerFeedFullText,
+		},
+
+		// POST /feed_frequency
+		{
+			Method:      "POST",
+			PathPattern: "^/feed_frequency$",
+			Func:        handlerFeedFrequency,
+		},
+
+		// POST /feed_update
+		{
+			Method:      "POST",
+			PathPattern: "^/feed_update$",
+			Func:        handlerFeedUpdate,
+		},
+
+		// POST /feed_active
+		{
+			Method:      "POST",
+			PathPattern: "^/feed_active$",
+			Func:        handlerFeedActive,
+		},
+
+		// POST /feed_delete
+		{
+			Method:      "POST",
+			PathPattern: "^/feed_delete$",
+			Func:        handlerFeedDelete,
+		},
+
+		// GET /export_items
+		{
+			Method:      "GET",
+			PathPattern: "^/export_items$",
+			Func:        handlerExportItems,
+		},
+
+		// GET /search
+		{
+			Method:      "GET",
+			PathPattern: "^/search$",
+			Func:        handlerSearch,
+		},
+
+		// GET /api/v1/items
+		{
+			Method:      "GET",
+			PathPattern: "^/api/v1/items$",
+			Func:        handlerAPIItems,
+		},
+
+		// POST /api/v1/items/<id>/state
+		{
+			Method:      "POST",
+			PathPattern: "^/api/v1/items/[0-9]+/state$",
+			Func:        handlerAPIItemState,
+		},
+
+		// POST /api/items/<id>/read
+		{
+			Method:      "POST",
+			PathPattern: "^/api/items/[0-9]+/read$",
+			Func:        handlerItemRead,
+		},
+
+		// POST /api/items/<id>/read-later
+		{
+			Method:      "POST",
+			PathPattern: "^/api/items/[0-9]+/read-later$",
+			Func:        handlerItemReadLater,
+		},
+
+		// GET /image
+		{
+			Method:      "GET",
+			PathPattern: "^/image$",
+			Func:        handlerImage,
+		},
+
+		// GET /position
+		{
+			Method:      "GET",
+			PathPattern: "^/position$",
+			Func:        handlerGetPosition,
+		},
+
+		// POST /position
+		{
+			Method:      "POST",
+			PathPattern: "^/position$",
+			Func:        handlerSetPosition,
+		},
+
+		// OPTIONS /extension/*
+		{
+			Method:      "OPTIONS",
+			PathPattern: "^/extension/",
+			Func:        handlerExtensionPreflight,
+		},
+
+		// GET /extension/unread_count
+		{
+			Method:      "GET",
+			PathPattern: "^/extension/unread_count$",
+			Func:        handlerExtensionUnreadCount,
+		},
+
+		// POST /extension/subscribe
+		{
+			Method:      "POST",
+			PathPattern: "^/extension/subscribe$",
+			Func:        handlerExtensionSubscribe,
+		},
 
-	type RequestHandler struct {
-		Method string
+		// POST /extension/save
+		{
+			Method:      "POST",
+			PathPattern: "^/extension/save$",
+			Func:        handlerExtensionSave,
+		},
 
-		// Regex pattern on the path to match.
-		PathPattern string
+		// GET /export
+		{
+			Method:      "GET",
+			PathPattern: "^/export$",
+			Func:        handlerExport,
+		},
 
-		Func RequestHandlerFunc
-	}
+		// GET /admin/audit
+		{
+			Method:      "GET",
+			PathPattern: "^/admin/audit$",
+			Func:        handlerAuditLog,
+		},
 
-	handlers := []RequestHandler{
-		// GET /
+		// GET /login
 		{
 			Method:      "GET",
-			PathPattern: "^/?$",
-			Func:        handlerListItems,
+			PathPattern: "^/login$",
+			Func:        handlerLoginForm,
 		},
 
-		// POST /update_read_flags
+		// POST /login
 		{
 			Method:      "POST",
-			PathPattern: "^/update_read_flags$",
-			Func:        handlerUpdateReadFlags,
+			PathPattern: "^/login$",
+			Func:        handlerLogin,
+		},
+
+		// POST /logout
+		{
+			Method:      "POST",
+			PathPattern: "^/logout$",
+			Func:        handlerLogout,
+		},
+
+		// GET /about
+		{
+			Method:      "GET",
+			PathPattern: "^/about$",
+			Func:        handlerAbout,
+		},
+
+		// GET /metrics
+		{
+			Method:      "GET",
+			PathPattern: "^/metrics$",
+			Func:        h.handlerMetrics,
 		},
 
 		// GET /static/*
@@ -244,6 +1186,15 @@ func (h HTTPHandler) ServeHTTP(rw http.ResponseWriter,
 		},
 	}
 
+	if h.settings.DebugEndpoints == 1 {
+		// GET /debug/pprof/* and /debug/vars
+		handlers = append(handlers, RequestHandler{
+			Method:      "GET",
+			PathPattern: "^/debug/(pprof/|vars$)",
+			Func:        handlerDebug,
+		})
+	}
+
 	// Find a matching handler.
 	for _, actionHandler := range handlers {
 		if actionHandler.Method != request.Method {
@@ -253,35 +1204,53 @@ func (h HTTPHandler) ServeHTTP(rw http.ResponseWriter,
 		matched, err := regexp.MatchString(actionHandler.PathPattern,
 			request.URL.Path)
 		if err != nil {
-			log.Printf("Error matching regex: %s", err)
+			logf(request, "Error matching regex: %s", err)
 			continue
 		}
 
 		if matched {
-			actionHandler.Func(rw, request, h.settings, session)
+			maxBodyBytes := actionHandler.MaxBodyBytes
+			if maxBodyBytes == 0 {
+				maxBodyBytes = h.settings.maxFormBytes()
+			}
+			if !limitBody(rw, request, maxBodyBytes) {
+				gcontext.Clear(request)
+				return
+			}
+
+			actionHandler.Func(rw, request, h.settings, h.store, session)
 			// Note we don't session.Save() here as if we redirect the Save() won't
 			// take effect.
 			//
 			// Clean up gorilla globals. Sessions package says this must be done or
 			// we'll leak memory.
-			context.Clear(request)
+			gcontext.Clear(request)
 			return
 		}
 	}
 
 	// There was no matching handler. Send a 404.
 
-	log.Printf("No handler for this request.")
+	logf(request, "No handler for this request.")
 	rw.WriteHeader(http.StatusNotFound)
 	_, _ = rw.Write([]byte("<h1>404 Not Found</h1>"))
 	_ = session.Save(request, rw)
-	context.Clear(request)
+	gcontext.Clear(request)
 }
 
 // send400Error sends a bad request error with the given message in the body.
 func send400Error(rw http.ResponseWriter, message string) {
 	rw.WriteHeader(http.StatusBadRequest)
 	_, _ = rw.Write([]byte("<h1>" + template.HTMLEscapeString(message) + "</h1>"))
+	writeRequestID(rw)
+}
+
+// send413Error sends a request entity too large error with the given message
+// in the body.
+func send413Error(rw http.ResponseWriter, message string) {
+	rw.WriteHeader(http.StatusRequestEntityTooLarge)
+	_, _ = rw.Write([]byte("<h1>" + template.HTMLEscapeString(message) + "</h1>"))
+	writeRequestID(rw)
 }
 
 // send500Error sends an internal server error with the given message in the
@@ -289,105 +1258,215 @@ func send400Error(rw http.ResponseWriter, message string) {
 func send500Error(rw http.ResponseWriter, message string) {
 	rw.WriteHeader(http.StatusInternalServerError)
 	_, _ = rw.Write([]byte("<h1>" + template.HTMLEscapeString(message) + "</h1>"))
+	writeRequestID(rw)
+}
+
+// writeRequestID adds the request's ID to an error page so that someone
+// reporting the error can tell us which request it was.
+func writeRequestID(rw http.ResponseWriter) {
+	if id := rw.Header().Get(requestIDHeader); id != "" {
+		_, _ = rw.Write([]byte("<p>Request ID: " + template.HTMLEscapeString(id) +
+			"</p>"))
+	}
 }
 
 // handlerListItems handles a list RSS items request and builds an HTML
 // response.
 //
 // It implements the type RequestHandlerFunc
+//
+// feed-id shows only the items of one of the feeds the user subscribes to.
+// We list those feeds alongside the items to choose from. starred=1 shows
+// the items the user starred, whatever their read state.
 func handlerListItems(rw http.ResponseWriter, request *http.Request,
-	settings *Config, session *sessions.Session) {
-
-	db, err := getDB(settings)
-	if err != nil {
-		log.Printf("Failed to get database connection: %s", err)
-		send500Error(rw, "Failed to connect to database")
-		return
-	}
+	settings *Config, store gorse.Store, session *sessions.Session) {
 
 	requestValues := request.URL.Query()
 
 	page := 1
 	pageParam := requestValues.Get("page")
 	if pageParam != "" {
+		var err error
 		page, err = strconv.Atoi(pageParam)
 		if err != nil {
 			page = 1
 		}
 	}
 
-	userIDStr := requestValues.Get("user-id")
-	if userIDStr == "" {
-		log.Printf("No user ID found")
-		// TODO: At this time I have users partially implemented. There is only one
-		//   user. Default to that user. When we require logins and such this will
-		//   need to change.
-		userIDStr = "1"
+	userID, ok := sessionUser(rw, request, settings, session)
+	if !ok {
+		return
+	}
+
+	if page < 1 {
+		page = 1
 	}
-	userID, err := strconv.Atoi(userIDStr)
+
+	feedID, err := listFeedID(requestValues)
 	if err != nil {
-		log.Printf("Invalid user ID: %s: %s", userIDStr, err)
-		send500Error(rw, "Invalid user ID.")
+		logf(request, "%s", err)
+		send400Error(rw, "Bad feed ID")
 		return
 	}
 
-	// We either view unread or read later items. Those marked read we never can
-	// see again currently.
-	readState := gorse.Unread
-	requestedReadState := requestValues.Get("read-state")
-	if requestedReadState == "read-later" {
-		readState = gorse.ReadLater
+	filter, err := listFilter(request.Context(), store, requestValues, userID,
+		feedID)
+	if err != nil {
+		logf(request, "Unable to look up muted keywords: %s", err)
+		send500Error(rw, "Unable to look up muted keywords")
+		return
 	}
+	filter.Limit = pageSize
+	filter.Offset = (page - 1) * pageSize
 
-	var items []DBItem
-	var totalItems int
-	if readState == gorse.ReadLater {
-		items, err = dbRetrieveReadLaterItems(db, settings, page, userID)
-		if err != nil {
-			log.Printf("%+v", err)
-			send500Error(rw, "Error retrieving items")
-			return
-		}
-		totalItems, err = dbCountReadLaterItems(db, userID)
-		if err != nil {
-			log.Printf("%+v", err)
-			send500Error(rw, "Error looking up counts")
-			return
-		}
-	} else {
-		items, err = dbRetrieveUnreadItems(db, settings, page)
-		if err != nil {
-			log.Printf("%+v", err)
-			send500Error(rw, "Error retrieving items")
-			return
-		}
-		totalItems, err = dbCountUnreadItems(db)
-		if err != nil {
-			log.Printf("%+v", err)
-			send500Error(rw, "Error looking up counts")
-			return
-		}
+	readState := listReadState(requestValues)
+	highlightsOnly := filter.Highlighted
+	starredOnly := filter.Starred
+
+	items, err := store.FindItems(request.Context(), filter)
+	if err != nil {
+		logf(request, "%+v", err)
+		send500Error(rw, "Error retrieving items")
+		return
+	}
+	totalItems, err := store.CountItems(request.Context(), filter)
+	if err != nil {
+		logf(request, "%+v", err)
+		send500Error(rw, "Error looking up counts")
+		return
 	}
 
 	// Our display timezone location.
 	location, err := time.LoadLocation(settings.DisplayTimeZone)
 	if err != nil {
-		log.Printf("Failed to load time zone location [%s]: %s",
+		logf(request, "Failed to load time zone location [%s]: %s",
 			settings.DisplayTimeZone, err)
 		send500Error(rw, "Unable to load timezone information")
 		return
 	}
 
+	// The user says how to show dates and which language to use.
+	user, err := store.GetUser(request.Context(), userID)
+	if err != nil {
+		logf(request, "Unable to look up user: %s", err)
+		send500Error(rw, "Unable to look up user")
+		return
+	}
+	locale := userLocale(request, user)
+
+	// Services the user can send items to, such as Pocket.
+	integrations, err := store.ListIntegrations(request.Context(), userID)
+	if err != nil {
+		logf(request, "Unable to look up integrations: %s", err)
+		send500Error(rw, "Unable to look up integrations")
+		return
+	}
+
+	type SendTo struct {
+		Service string
+		Name    string
+	}
+
+	var sendTos []SendTo
+	for _, integration := range integrations {
+		sendTos = append(sendTos, SendTo{
+			Service: integration.Service,
+			Name:    sendto.Name(integration.Service),
+		})
+	}
+
+	// How to show items from each feed, such as only their titles.
+	displayModes, err := store.FeedDisplayModes(request.Context(), userID)
+	if err != nil {
+		logf(request, "Unable to look up display modes: %s", err)
+		send500Error(rw, "Unable to look up display modes")
+		return
+	}
+
+	// Feeds in full text mode have their items' articles to show instead of
+	// their descriptions.
+	var itemIDs []int64
+	for _, item := range items {
+		itemIDs = append(itemIDs, item.ID)
+	}
+	fullTexts, err := store.FullTextContents(request.Context(), itemIDs)
+	if err != nil {
+		logf(request, "Unable to look up full text of items: %s", err)
+		send500Error(rw, "Unable to look up items")
+		return
+	}
+
+	enclosures, err := store.ItemEnclosures(request.Context(), itemIDs)
+	if err != nil {
+		logf(request, "Unable to look up enclosures of items: %s", err)
+		send500Error(rw, "Unable to look up items")
+		return
+	}
+
+	categories, err := store.ItemCategories(request.Context(), itemIDs)
+	if err != nil {
+		logf(request, "Unable to look up categories of items: %s", err)
+		send500Error(rw, "Unable to look up items")
+		return
+	}
+
+	tags, err := store.ItemTags(request.Context(), userID, itemIDs)
+	if err != nil {
+		logf(request, "Unable to look up tags of items: %s", err)
+		send500Error(rw, "Unable to look up items")
+		return
+	}
+
+	// Phrases to highlight items containing.
+	highlights, err := store.ListHighlights(request.Context(), userID)
+	if err != nil {
+		logf(request, "Unable to look up highlights: %s", err)
+		send500Error(rw, "Unable to look up highlights")
+		return
+	}
+
+	// The feeds the user subscribes to, to view one at a time.
+	sidebarFeeds, feedName, err := listSidebarFeeds(request.Context(), store,
+		userID, readState == gorse.Unread && !starredOnly, feedID)
+	if err != nil {
+		logf(request, "Unable to look up feeds: %s", err)
+		send500Error(rw, "Unable to look up feeds")
+		return
+	}
+	if feedID != 0 && feedName == "" {
+		logf(request, "User %d doesn't subscribe to feed %d", userID, feedID)
+		send400Error(rw, "Unknown feed")
+		return
+	}
+
+	// So the user notices feeds that have gone away.
+	failingFeeds, err := store.CountFailingFeeds(request.Context(), userID,
+		failingFeedErrors)
+	if err != nil {
+		logf(request, "Unable to count failing feeds: %s", err)
+		send500Error(rw, "Unable to look up feeds")
+		return
+	}
+
 	// Set up additional information about each item. Specifically we want to set
 	// a string timestamp and do some formatting.
 
 	type HTMLItem struct {
-		ID              int64
-		FeedName        string
-		Title           string
-		Link            string
-		PublicationDate string
-		Description     template.HTML
+		ID                  int64
+		FeedName            string
+		Title               string
+		Link                string
+		PublicationDate     string
+		FullPublicationDate string
+		Description         template.HTML
+		Note                string
+		Unshared            bool
+		Starred             bool
+		Display             string
+		Highlighted         bool
+		Enclosures          []HTMLEnclosure
+		Categories          []string
+		Tags                []string
 	}
 
 	var htmlItems []HTMLItem
@@ -395,23 +1474,43 @@ func handlerListItems(rw http.ResponseWriter, request *http.Request,
 	for _, item := range items {
 		title := sanitiseItemText(item.Title)
 
-		// Make an HTML version of description. We set it as type HTML so the
-		// template execution knows not to re-encode it. We want to control the
-		// encoding more carefully for making links of URLs, for one.
-		description := getHTMLDescription(
-			substr(
-				sanitiseItemText(item.Description),
-				2000,
-			),
-		)
+		// Feeds show items' full descriptions unless the user says otherwise.
+		// Compact lists show none, so we don't make them.
+		displayMode := displayModes[item.RSSFeedID]
+		if user.CompactList {
+			displayMode = gorse.DisplayTitle
+		}
+		text := item.Description
+		if fullText, ok := fullTexts[item.ID]; ok {
+			text = fullText
+		}
+		description := itemDescription(displayMode, text)
+
+		// Nor do they show players.
+		var htmlEnclosures []HTMLEnclosure
+		if !user.CompactList {
+			htmlEnclosures = newHTMLEnclosures(enclosures[item.ID])
+		}
+
+		pubDate, fullPubDate := formatDate(locale, user, item.PublicationDate,
+			location)
 
 		htmlItems = append(htmlItems, HTMLItem{
-			ID:              item.ID,
-			FeedName:        item.FeedName,
-			Title:           title,
-			Link:            item.Link,
-			PublicationDate: item.PublicationDate.In(location).Format(time.RFC1123Z),
-			Description:     description,
+			ID:                  item.ID,
+			FeedName:            item.FeedName,
+			Title:               title,
+			Link:                item.Link,
+			PublicationDate:     pubDate,
+			FullPublicationDate: fullPubDate,
+			Description:         description,
+			Note:                item.Note,
+			Unshared:            item.Unshared,
+			Starred:             item.Starred,
+			Display:             displayMode.String(),
+			Highlighted:         highlighted(highlights, item),
+			Enclosures:          htmlEnclosures,
+			Categories:          categories[item.ID],
+			Tags:                tags[item.ID],
 		})
 	}
 
@@ -434,7 +1533,7 @@ func handlerListItems(rw http.ResponseWriter, request *http.Request,
 
 	err = session.Save(request, rw)
 	if err != nil {
-		log.Printf("Unable to save session: %s", err)
+		logf(request, "Unable to save session: %s", err)
 		send500Error(rw, "Failed to save your session.")
 		return
 	}
@@ -453,6 +1552,23 @@ func handlerListItems(rw http.ResponseWriter, request *http.Request,
 		ReadState       gorse.ReadState
 		Unread          gorse.ReadState
 		ReadLater       gorse.ReadState
+		MaxNoteLength   int
+		MaxTagLength    int
+		SendTos         []SendTo
+		EmailItems      bool
+		ShareEmail      string
+		KindleEmail     string
+		ShareToken      string
+		Compact         bool
+		HighlightsOnly  bool
+		HasHighlights   bool
+		StarredOnly     bool
+		FeedID          int64
+		FeedName        string
+		Category        string
+		Tag             string
+		Feeds           []sidebarFeed
+		FailingFeeds    int
 	}
 
 	listItemsPage := ListItemsPage{
@@ -467,15 +1583,169 @@ func handlerListItems(rw http.ResponseWriter, request *http.Request,
 		ReadState:       readState,
 		Unread:          gorse.Unread,
 		ReadLater:       gorse.ReadLater,
+		MaxNoteLength:   gorse.MaxNoteLength,
+		MaxTagLength:    gorse.MaxTagLength,
+		SendTos:         sendTos,
+		EmailItems:      settings.SMTPHost != "",
+		ShareEmail:      user.ShareEmail,
+		KindleEmail:     user.KindleEmail,
+		ShareToken:      user.ShareToken,
+		Compact:         user.CompactList,
+		HighlightsOnly:  highlightsOnly,
+		HasHighlights:   len(highlights) > 0,
+		StarredOnly:     starredOnly,
+		FeedID:          feedID,
+		FeedName:        feedName,
+		Category:        filter.Category,
+		Tag:             filter.Tag,
+		Feeds:           sidebarFeeds,
+		FailingFeeds:    failingFeeds,
 	}
 
-	err = renderPage(settings, rw, "_list_items", listItemsPage)
+	err = renderPage(settings, rw, locale, "_list_items", listItemsPage)
 	if err != nil {
-		log.Printf("Failure rendering page: %s", err)
+		logf(request, "Failure rendering page: %s", err)
 		send500Error(rw, "Failed to render page")
 		return
 	}
-	log.Print("Rendered list items page.")
+	logf(request, "Rendered list items page.")
+}
+
+// listFilter decides which items the list of items shows from the request's
+// parameters. It doesn't limit how many. We show only items of feeds the user
+// subscribes to. feedID limits it to one feed if it's not 0. See listFeedID.
+// category limits it to items in that category, and tag to items the user
+// tagged with that tag.
+func listFilter(ctx context.Context, store gorse.Store, values url.Values,
+	userID int, feedID int64) (gorse.ItemFilter, error) {
+	readState := listReadState(values)
+
+	// We may show only items with phrases the user highlights.
+	filter := gorse.ItemFilter{
+		UserID:      userID,
+		State:       &readState,
+		FeedID:      feedID,
+		Category:    strings.TrimSpace(values.Get("category")),
+		Highlighted: values.Get("highlights") == "1",
+		Subscribed:  true,
+	}
+
+	// Tagged items we show whatever their state too, as tagging sorts them.
+	if tag := values.Get("tag"); tag != "" {
+		filter.Tag, _ = gorse.NormalizeTag(tag)
+	}
+
+	// Starred items we show whatever their state, and whether the user still
+	// subscribes to their feed, as starring them is asking to keep them.
+	if values.Get("starred") == "1" {
+		filter.State = nil
+		filter.Starred = true
+		filter.Subscribed = false
+		return filter, nil
+	}
+	if filter.Tag != "" {
+		filter.State = nil
+		return filter, nil
+	}
+
+	// Items we saved to read later stay around however old they get. They stay
+	// however the user mutes too, since they chose to save them.
+	if readState == gorse.Unread {
+		filter.Since = unreadCutoff()
+		if err := hideMuted(ctx, store, &filter); err != nil {
+			return gorse.ItemFilter{}, err
+		}
+	}
+
+	return filter, nil
+}
+
+// listReadState decides which read state's items to list. We either view
+// unread or read later items. Those marked read we never can see again
+// currently.
+func listReadState(values url.Values) gorse.ReadState {
+	if values.Get("read-state") == "read-later" {
+		return gorse.ReadLater
+	}
+	return gorse.Unread
+}
+
+// listFeedID parses the feed-id parameter limiting the list of items to one
+// feed. It is 0 if there isn't one.
+func listFeedID(values url.Values) (int64, error) {
+	feedIDStr := values.Get("feed-id")
+	if feedIDStr == "" {
+		return 0, nil
+	}
+
+	feedID, err := strconv.ParseInt(feedIDStr, 10, 64)
+	if err != nil || feedID <= 0 {
+		return 0, fmt.Errorf("bad feed ID: %s", feedIDStr)
+	}
+	return feedID, nil
+}
+
+// listViewParams gives the parameters to add to a link back to the list of
+// items so that it keeps showing the one feed the form says, if any, and
+// starred items if it was.
+func listViewParams(form url.Values) string {
+	params := ""
+	if feedID, err := listFeedID(form); err == nil && feedID != 0 {
+		params += fmt.Sprintf("&feed-id=%d", feedID)
+	}
+	if form.Get("starred") == "1" {
+		params += "&starred=1"
+	}
+	if category := strings.TrimSpace(form.Get("category")); category != "" {
+		params += "&category=" + url.QueryEscape(category)
+	}
+	if tag, err := gorse.NormalizeTag(form.Get("tag")); err == nil {
+		params += "&tag=" + url.QueryEscape(tag)
+	}
+	return params
+}
+
+// sidebarFeed is a feed we link to viewing the items of alongside the list of
+// items.
+type sidebarFeed struct {
+	ID     int64
+	Name   string
+	Unread int
+}
+
+// listSidebarFeeds retrieves the feeds the user subscribes to, to link to
+// viewing the items of each. When listing unread items, countUnread, we say
+// how many each has. We also return the name of the feed with feedID, or
+// blank if the user doesn't subscribe to it.
+func listSidebarFeeds(ctx context.Context, store gorse.Store, userID int,
+	countUnread bool, feedID int64) ([]sidebarFeed, string, error) {
+	feeds, err := store.ListSubscriptions(ctx, userID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var counts map[int64]int
+	if countUnread {
+		if counts, err = store.UnreadCounts(ctx, userID,
+			unreadCutoff()); err != nil {
+			return nil, "", err
+		}
+	}
+
+	var sidebar []sidebarFeed
+	feedName := ""
+	for _, feed := range feeds {
+		sidebar = append(sidebar, sidebarFeed{
+			ID:     feed.ID,
+			Name:   feed.Name,
+			Unread: counts[feed.ID],
+		})
+		if feed.ID == feedID {
+			feedName = feed.Name
+		}
+	}
+
+	return sidebar, feedName, nil
 }
 
 func substr(s string, n int) string {
@@ -496,150 +1766,201 @@ func substr(s string, n int) string {
 // We update the requested flags in the database, and then redirect us back to
 // the list of items page.
 func handlerUpdateReadFlags(rw http.ResponseWriter, request *http.Request,
-	settings *Config, session *sessions.Session) {
+	settings *Config, store gorse.Store, session *sessions.Session) {
 	// We should have some posted request values. In order to get at these, we
 	// have to run ParseForm().
 	err := request.ParseForm()
 	if err != nil {
-		log.Printf("Failed to parse form: %s", err)
+		logf(request, "Failed to parse form: %s", err)
+		if bodyTooLarge(err) {
+			send413Error(rw, tooLargeError(settings.maxFormBytes()))
+			return
+		}
 		send500Error(rw, "Failed to parse request")
 		return
 	}
 
-	db, err := getDB(settings)
-	if err != nil {
-		log.Printf("Failed to get database connection: %s", err)
-		send500Error(rw, "Failed to connect to database")
+	userID, ok := sessionUser(rw, request, settings, session)
+	if !ok {
 		return
 	}
 
-	userIDStr := request.PostForm.Get("user-id")
-	if userIDStr == "" {
-		log.Printf("No user ID in request.")
-		send400Error(rw, "Incomplete request")
-		return
-	}
-	userID, err := strconv.Atoi(userIDStr)
-	if err != nil {
-		log.Printf("Bad user ID: %s: %s", userIDStr, err)
-		send400Error(rw, "Bad user ID")
-		return
-	}
+	// The user is the one changing the states.
+	request = request.WithContext(gorse.WithActor(request.Context(), userID))
 
-	// What read state were we viewing? This tells us where to go after. We
-	// either view unread or read later items. Those marked read we never can see
-	// again currently.
-	readState := gorse.Unread
-	requestedReadState := request.PostForm.Get("read-state")
-	if requestedReadState == "read-later" {
-		readState = gorse.ReadLater
-	}
+	// What read state were we viewing? This tells us where to go after.
+	readState := listReadState(request.PostForm)
 
 	// Set some read.
 
 	// Check if we have any items to update. These are in the request key
-	// 'read-item'.
-	readItems, exists := request.PostForm["read-item"]
-	readCount := 0
-	if exists {
-		// This is associated with a slice of strings. Each of these is an id we
-		// want to mark as read now.
-		for _, idStr := range readItems {
-			var id int64
-			id, err = strconv.ParseInt(idStr, 10, 64)
-			if err != nil {
-				log.Printf("Failed to parse id into an integer %s: %s", idStr, err)
-				send500Error(rw, "Invalid id")
-				return
-			}
-
-			// Record it to the "read after archive" table if it was saved to read
-			// later and now is being flagged read.
+	// 'read-item'. Each is an id we want to mark as read now.
+	readIDs, err := parseItemIDs(request.PostForm["read-item"])
+	if err != nil {
+		logf(request, "%s", err)
+		send500Error(rw, "Invalid id")
+		return
+	}
 
-			item, err := dbGetItem(db, id, userID)
-			if err != nil {
-				log.Printf("Unable to look up item: %d: %s", id, err)
-				send500Error(rw, "Unable to look up item.")
-				return
-			}
+	if err := markItemsRead(request.Context(), store, readIDs,
+		userID); err != nil {
+		logf(request, "Unable to mark items read: %s", err)
+		send500Error(rw, "Unable to update read flags")
+		return
+	}
 
-			if item.ReadState == "read-later" {
-				if err := dbRecordReadAfterReadLater(db, userID, item); err != nil {
-					log.Printf("Unable to record read-later item read: %d: %s", id, err)
-					send500Error(rw, "Unable to read read after archive.")
-					return
-				}
-			}
+	if len(readIDs) == 1 {
+		logf(request, "Set %d item read.", len(readIDs))
+	} else {
+		logf(request, "Set %d items read.", len(readIDs))
+	}
 
-			// Flag it read.
+	// Set some to read later.
 
-			if err := gorse.DBSetItemReadState(db, id, userID,
-				gorse.Read); err != nil {
-				send500Error(rw, "Unable to update read flag for "+idStr)
-				return
-			}
+	archiveIDs, err := parseItemIDs(request.PostForm["archive-item"])
+	if err != nil {
+		logf(request, "%s", err)
+		send500Error(rw, "Invalid id")
+		return
+	}
 
-			readCount++
+	if len(archiveIDs) > 0 {
+		if err := store.SetItemsReadState(request.Context(), archiveIDs, userID,
+			gorse.ReadLater); err != nil {
+			logf(request, "Unable to mark items read later: %s", err)
+			send500Error(rw, "Unable to update read flags")
+			return
 		}
 	}
 
-	if readCount == 1 {
-		log.Printf("Set %d item read.", readCount)
+	if len(archiveIDs) == 1 {
+		logf(request, "Archived %d item.", len(archiveIDs))
 	} else {
-		log.Printf("Set %d items read.", readCount)
+		logf(request, "Archived %d items.", len(archiveIDs))
 	}
 
-	// Set some to read later.
+	// Set notes. We receive only those edited.
 
-	archiveItems, exists := request.PostForm["archive-item"]
-	archivedCount := 0
-	if exists {
-		for _, idStr := range archiveItems {
-			var id int64
-			id, err = strconv.ParseInt(idStr, 10, 64)
-			if err != nil {
-				log.Printf("Failed to parse id into an integer %s: %s", idStr, err)
-				send500Error(rw, "Invalid id")
-				return
-			}
+	notes, err := parseItemNotes(request.PostForm)
+	if err != nil {
+		logf(request, "%s", err)
+		send400Error(rw, "Invalid note")
+		return
+	}
 
-			if err := gorse.DBSetItemReadState(db, id, userID,
-				gorse.ReadLater); err != nil {
-				send500Error(rw, "Unable to update read flag for "+idStr)
-				return
+	for id, note := range notes {
+		if err := store.SetItemNote(request.Context(), id, userID,
+			note); err != nil {
+			// A note on an item we didn't save. There's nothing to attach it to.
+			if err == gorse.ErrNotFound {
+				continue
 			}
-
-			archivedCount++
+			logf(request, "Unable to set note: %s", err)
+			send500Error(rw, "Unable to save notes")
+			return
 		}
 	}
 
-	if archivedCount == 1 {
-		log.Printf("Archived %d item.", archivedCount)
-	} else {
-		log.Printf("Archived %d items.", archivedCount)
-	}
-
 	session.AddFlash("Saved.")
 
 	err = session.Save(request, rw)
 	if err != nil {
-		log.Printf("Unable to save session: %s", err)
+		logf(request, "Unable to save session: %s", err)
 		send500Error(rw, "Failed to save your session.")
 		return
 	}
 
-	uri := fmt.Sprintf("%s/?user-id=%d&read-state=%s&page=%s",
+	uri := fmt.Sprintf("%s/?read-state=%s&page=%s",
 		settings.URIPrefix,
-		userID,
 		url.QueryEscape(readState.String()),
 		url.QueryEscape(request.PostForm.Get("page")),
 	)
+	if request.PostForm.Get("highlights") == "1" {
+		uri += "&highlights=1"
+	}
+	uri += listViewParams(request.PostForm)
 
-	log.Printf("Redirecting to %s", uri)
+	logf(request, "Redirecting to %s", uri)
 
 	http.Redirect(rw, request, uri, http.StatusFound)
 }
 
+// parseItemIDs parses item IDs from a request.
+func parseItemIDs(idStrs []string) ([]int64, error) {
+	var ids []int64
+	for _, idStr := range idStrs {
+		id, err := strconv.ParseInt(idStr, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse id into an integer %s: %s",
+				idStr, err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// parseItemNotes parses notes on items from a request. Each is in a field
+// named note-<item ID>.
+func parseItemNotes(form url.Values) (map[int64]string, error) {
+	notes := map[int64]string{}
+	for key, values := range form {
+		if !strings.HasPrefix(key, "note-") || len(values) == 0 {
+			continue
+		}
+
+		idStr := strings.TrimPrefix(key, "note-")
+		id, err := strconv.ParseInt(idStr, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse id into an integer %s: %s",
+				idStr, err)
+		}
+
+		if utf8.RuneCountInString(values[0]) > gorse.MaxNoteLength {
+			return nil, fmt.Errorf("note on item %d is too long", id)
+		}
+
+		notes[id] = values[0]
+	}
+	return notes, nil
+}
+
+// markItemsRead sets the items read for the user.
+//
+// We record each to the "read after archive" table if it was saved to read
+// later and now is being flagged read. We do it all in one transaction so we
+// never have one without the other.
+func markItemsRead(ctx context.Context, store gorse.Store, ids []int64,
+	userID int) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	return store.InTx(ctx, func(store gorse.Store) error {
+		seen := map[int64]struct{}{}
+		for _, id := range ids {
+			if _, ok := seen[id]; ok {
+				continue
+			}
+			seen[id] = struct{}{}
+
+			item, err := store.GetItem(ctx, id, userID)
+			if err != nil {
+				return fmt.Errorf("unable to look up item: %d: %s", id, err)
+			}
+
+			if item.ReadState == gorse.ReadLater {
+				if err := store.RecordReadAfterReadLater(ctx, userID,
+					item); err != nil {
+					return fmt.Errorf("unable to record read-later item read: %d: %s",
+						id, err)
+				}
+			}
+		}
+
+		return store.SetItemsReadState(ctx, ids, userID, gorse.Read)
+	})
+}
+
 // handlerStaticFiles serves up some static files.
 //
 // It implements the type RequestHandlerFunc
@@ -647,8 +1968,8 @@ func handlerUpdateReadFlags(rw http.ResponseWriter, request *http.Request,
 // While it may be better to serve these through a standalone httpd or
 // something, this simplifies setup, so support this method too.
 func handlerStaticFiles(rw http.ResponseWriter, request *http.Request,
-	settings *Config, session *sessions.Session) {
-	log.Printf("Serving static request [%s]", request.URL.Path)
+	settings *Config, store gorse.Store, session *sessions.Session) {
+	logf(request, "Serving static request [%s]", request.URL.Path)
 
 	// Serve files from /WebRoot. At this point, GET /gorse.js goes to
 	// /WebRoot/gorse.js.
@@ -664,5 +1985,7 @@ func handlerStaticFiles(rw http.ResponseWriter, request *http.Request,
 	// the filesever's perspective the request is GET /gorse.js
 	strippedHandler := http.StripPrefix("/static", fileserverHandler)
 
+	setStaticCacheControl(rw, request, settings)
+
 	strippedHandler.ServeHTTP(rw, request)
 }
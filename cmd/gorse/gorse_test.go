@@ -1,6 +1,19 @@
 package main
 
-import "testing"
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/horgh/gorse"
+	"github.com/horgh/gorse/internal/gorsetest"
+	"github.com/horgh/rss"
+)
 
 func TestSubstr(t *testing.T) {
 	tests := []struct {
@@ -37,3 +50,275 @@ func TestSubstr(t *testing.T) {
 			output, test.Output)
 	}
 }
+
+func TestListFeedID(t *testing.T) {
+	tests := []struct {
+		input string
+		want  int64
+		param string
+		err   bool
+	}{
+		{"", 0, "", false},
+		{"3", 3, "&feed-id=3", false},
+		{"0", 0, "", true},
+		{"-1", 0, "", true},
+		{"x", 0, "", true},
+	}
+
+	for _, test := range tests {
+		values := url.Values{"feed-id": {test.input}}
+		got, err := listFeedID(values)
+		if got != test.want || (err != nil) != test.err {
+			t.Errorf("listFeedID(%q) = %d, %v, wanted %d, error %t", test.input,
+				got, err, test.want, test.err)
+		}
+		if param := listViewParams(values); param != test.param {
+			t.Errorf("listViewParams(%q) = %q, wanted %q", test.input, param,
+				test.param)
+		}
+	}
+
+	values := url.Values{"feed-id": {"3"}, "starred": {"1"}}
+	if param := listViewParams(values); param != "&feed-id=3&starred=1" {
+		t.Errorf("listViewParams(%v) = %q, wanted the feed and starred", values,
+			param)
+	}
+}
+
+func TestHandlerListItemsFeedIntegration(t *testing.T) {
+	for _, dbType := range gorsetest.Types {
+		t.Run(dbType, func(t *testing.T) {
+			testHandlerListItemsFeedIntegration(t, dbType)
+		})
+	}
+}
+
+func testHandlerListItemsFeedIntegration(t *testing.T, dbType string) {
+	store, _ := gorsetest.Store(t, dbType)
+
+	feed := func(name string, subscribers ...string) gorsetest.Feed {
+		return gorsetest.Feed{
+			DBFeed: gorse.DBFeed{
+				Name:                   name,
+				URI:                    "https://example.com/" + name,
+				UpdateFrequencySeconds: 3600,
+				Active:                 true,
+			},
+			Items: []rss.Item{
+				{Title: "Item from " + name, Link: "https://example.com/" + name + "/1",
+					PubDate: time.Now().Add(-time.Hour)},
+			},
+			Subscribers: subscribers,
+		}
+	}
+
+	loaded := gorsetest.Load(t, store, gorsetest.Fixture{
+		Users: []gorsetest.User{
+			{Email: "user@example.com", Password: "password"},
+		},
+		Feeds: []gorsetest.Feed{
+			feed("Alpha", "user@example.com"),
+			feed("Beta", "user@example.com"),
+			feed("Gamma"),
+		},
+	})
+	userID := loaded.Users["user@example.com"]
+	alpha := loaded.Feeds["https://example.com/Alpha"]
+
+	settings := &Config{
+		URIPrefix:       "/gorse",
+		DisplayTimeZone: "UTC",
+		WebRoot:         "static",
+		TemplateDir:     "templates",
+	}
+
+	list := func(query string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodGet, "/?"+query, nil)
+		rw := httptest.NewRecorder()
+		handlerListItems(rw, request, settings, store,
+			loggedInSession(t, request, userID))
+		return rw
+	}
+
+	rw := list("")
+	body := rw.Body.String()
+	if rw.Code != http.StatusOK {
+		t.Fatalf("status = %d: %q, wanted %d", rw.Code, body, http.StatusOK)
+	}
+	if !strings.Contains(body, "Item from Alpha") ||
+		!strings.Contains(body, "Item from Beta") {
+		t.Errorf("page = %q, wanted items from every feed", body)
+	}
+	link := fmt.Sprintf(`/gorse?read-state=unread&amp;feed-id=%d"`, alpha)
+	if !strings.Contains(body, link) {
+		t.Errorf("page = %q, wanted a link to view Alpha's items", body)
+	}
+	if strings.Contains(body, "keep failing") {
+		t.Errorf("page = %q, wanted no failing feeds", body)
+	}
+
+	for i := 0; i < failingFeedErrors; i++ {
+		if err := store.SetFeedError(context.Background(), alpha,
+			"timeout"); err != nil {
+			t.Fatalf("SetFeedError() = error %s", err)
+		}
+	}
+	if body := list("").Body.String(); !strings.Contains(body,
+		"1 of your feeds keep failing to update.") {
+		t.Errorf("page = %q, wanted Alpha failing", body)
+	}
+
+	if _, err := store.AddItem(context.Background(),
+		loaded.Feeds["https://example.com/Beta"], &gorse.Item{
+			Item: rss.Item{
+				Title:   "Episode from Beta",
+				Link:    "https://example.com/Beta/2",
+				PubDate: time.Now(),
+			},
+			Enclosures: []gorse.Enclosure{{
+				URL:      "https://example.com/Beta/2.mp3",
+				Type:     "audio/mpeg",
+				Length:   12345678,
+				Duration: 4*time.Minute + 5*time.Second,
+			}},
+		}); err != nil {
+		t.Fatalf("AddItem() = error %s", err)
+	}
+	body = list("").Body.String()
+	if !strings.Contains(body,
+		`<audio controls preload="none" src="https://example.com/Beta/2.mp3">`) ||
+		!strings.Contains(body, "(4:05)") ||
+		!strings.Contains(body, "12.3 MB") {
+		t.Errorf("page = %q, wanted a player for the episode", body)
+	}
+
+	if _, err := store.AddItem(context.Background(), alpha, &gorse.Item{
+		Item: rss.Item{
+			Title:   "Post about Go",
+			Link:    "https://example.com/Alpha/2",
+			PubDate: time.Now(),
+		},
+		Categories: []string{"Go & SQL"},
+	}); err != nil {
+		t.Fatalf("AddItem() = error %s", err)
+	}
+	category := `/gorse?read-state=unread&amp;category=Go%20%26%20SQL"`
+	if body := list("").Body.String(); !strings.Contains(body, category) {
+		t.Errorf("page = %q, wanted a link to the item's category", body)
+	}
+	body = list("category=Go+%26+SQL").Body.String()
+	if !strings.Contains(body, "Post about Go") ||
+		strings.Contains(body, "Item from Alpha") ||
+		!strings.Contains(body, "Showing only items in Go &amp; SQL.") {
+		t.Errorf("page = %q, wanted only the item in the category", body)
+	}
+
+	// Marking all read would mark items outside the category or highlights.
+	form := `id="mark-all-read-form"`
+	if body := list("").Body.String(); !strings.Contains(body, form) {
+		t.Errorf("page = %q, wanted the mark all read form", body)
+	}
+	for _, query := range []string{"category=Go+%26+SQL", "highlights=1"} {
+		if body := list(query).Body.String(); strings.Contains(body, form) {
+			t.Errorf("%s: page = %q, wanted no mark all read form", query, body)
+		}
+	}
+
+	rw = list(fmt.Sprintf("feed-id=%d", alpha))
+	body = rw.Body.String()
+	if rw.Code != http.StatusOK {
+		t.Fatalf("status = %d: %q, wanted %d", rw.Code, body, http.StatusOK)
+	}
+	if !strings.Contains(body, "Item from Alpha") ||
+		strings.Contains(body, "Item from Beta") {
+		t.Errorf("feed page = %q, wanted only Alpha's items", body)
+	}
+	if !strings.Contains(body, "Showing only Alpha.") ||
+		!strings.Contains(body, fmt.Sprintf(
+			`name="feed-id" value="%d"`, alpha)) {
+		t.Errorf("feed page = %q, wanted saving to come back to it", body)
+	}
+
+	for _, query := range []string{
+		"feed-id=x",
+		fmt.Sprintf("feed-id=%d", loaded.Feeds["https://example.com/Gamma"]),
+	} {
+		if rw := list(query); rw.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, wanted %d", query, rw.Code,
+				http.StatusBadRequest)
+		}
+	}
+}
+
+func TestHandlerListItemsSubscriptionsIntegration(t *testing.T) {
+	for _, dbType := range gorsetest.Types {
+		t.Run(dbType, func(t *testing.T) {
+			testHandlerListItemsSubscriptionsIntegration(t, dbType)
+		})
+	}
+}
+
+func testHandlerListItemsSubscriptionsIntegration(t *testing.T,
+	dbType string) {
+	store, _ := gorsetest.Store(t, dbType)
+
+	feed := func(name, subscriber string) gorsetest.Feed {
+		return gorsetest.Feed{
+			DBFeed: gorse.DBFeed{
+				Name:                   name,
+				URI:                    "https://example.com/" + name,
+				UpdateFrequencySeconds: 3600,
+				Active:                 true,
+			},
+			Items: []rss.Item{
+				{Title: "Item from " + name, Link: "https://example.com/" + name + "/1",
+					PubDate: time.Now().Add(-time.Hour)},
+			},
+			Subscribers: []string{subscriber},
+		}
+	}
+
+	loaded := gorsetest.Load(t, store, gorsetest.Fixture{
+		Users: []gorsetest.User{
+			{Email: "user@example.com", Password: "password"},
+			{Email: "other@example.com", Password: "password"},
+		},
+		Feeds: []gorsetest.Feed{
+			feed("Alpha", "user@example.com"),
+			feed("Beta", "other@example.com"),
+		},
+	})
+
+	settings := &Config{
+		URIPrefix:       "/gorse",
+		DisplayTimeZone: "UTC",
+		WebRoot:         "static",
+		TemplateDir:     "templates",
+	}
+
+	for _, test := range []struct {
+		email    string
+		want     string
+		unwanted string
+	}{
+		{"user@example.com", "Item from Alpha", "Item from Beta"},
+		{"other@example.com", "Item from Beta", "Item from Alpha"},
+	} {
+		request := httptest.NewRequest(http.MethodGet, "/", nil)
+		rw := httptest.NewRecorder()
+		handlerListItems(rw, request, settings, store,
+			loggedInSession(t, request, loaded.Users[test.email]))
+		body := rw.Body.String()
+		if rw.Code != http.StatusOK {
+			t.Fatalf("%s: status = %d: %q, wanted %d", test.email, rw.Code, body,
+				http.StatusOK)
+		}
+		if !strings.Contains(body, test.want) {
+			t.Errorf("%s: page = %q, wanted %q", test.email, body, test.want)
+		}
+		if strings.Contains(body, test.unwanted) {
+			t.Errorf("%s: page = %q, wanted no %q as they don't subscribe",
+				test.email, body, test.unwanted)
+		}
+	}
+}
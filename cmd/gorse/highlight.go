@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+
+	"github.com/horgh/gorse"
+)
+
+// highlighted decides whether the item contains any of the phrases.
+func highlighted(highlights []gorse.Highlight, item gorse.UserItem) bool {
+	for _, h := range highlights {
+		if h.Matches(item.Title, item.Description) {
+			return true
+		}
+	}
+	return false
+}
+
+// addHighlight highlights the phrase for the user with the email.
+func addHighlight(ctx context.Context, settings *Config, email,
+	phrase string) error {
+	db, err := connectToDB(settings)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := db.Close(); err != nil {
+			log.Printf("Database close: %s", err)
+		}
+	}()
+
+	user, err := findUserByEmail(ctx, db, email)
+	if err != nil {
+		return err
+	}
+
+	return gorse.AddHighlight(ctx, db, user.ID, phrase)
+}
+
+// removeHighlight stops highlighting the phrase for the user with the email.
+func removeHighlight(ctx context.Context, settings *Config, email,
+	phrase string) error {
+	db, err := connectToDB(settings)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := db.Close(); err != nil {
+			log.Printf("Database close: %s", err)
+		}
+	}()
+
+	user, err := findUserByEmail(ctx, db, email)
+	if err != nil {
+		return err
+	}
+
+	if err := gorse.RemoveHighlight(ctx, db, user.ID, phrase); err != nil {
+		if err == gorse.ErrNotFound {
+			return fmt.Errorf("%s does not highlight %q", email, phrase)
+		}
+		return err
+	}
+	return nil
+}
+
+// listHighlights writes the phrases the user with the email highlights, one
+// per line.
+func listHighlights(ctx context.Context, settings *Config, email string,
+	w io.Writer) error {
+	db, err := connectToDB(settings)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := db.Close(); err != nil {
+			log.Printf("Database close: %s", err)
+		}
+	}()
+
+	user, err := findUserByEmail(ctx, db, email)
+	if err != nil {
+		return err
+	}
+
+	highlights, err := gorse.ListHighlights(ctx, db, user.ID)
+	if err != nil {
+		return err
+	}
+
+	for _, h := range highlights {
+		if _, err := fmt.Fprintf(w, "%q\n", h.Phrase); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
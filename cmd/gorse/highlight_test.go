@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/sessions"
+	"github.com/horgh/gorse"
+	"github.com/horgh/gorse/internal/gorsetest"
+	"github.com/horgh/rss"
+)
+
+func TestHandlerListItemsHighlightsIntegration(t *testing.T) {
+	for _, dbType := range gorsetest.Types {
+		t.Run(dbType, func(t *testing.T) {
+			testHandlerListItemsHighlightsIntegration(t, dbType)
+		})
+	}
+}
+
+func testHandlerListItemsHighlightsIntegration(t *testing.T, dbType string) {
+	store, _ := gorsetest.Store(t, dbType)
+
+	loaded := gorsetest.Load(t, store, gorsetest.Fixture{
+		Users: []gorsetest.User{
+			{Email: "user@example.com", Password: "password"},
+		},
+		Feeds: []gorsetest.Feed{
+			{
+				DBFeed: gorse.DBFeed{
+					Name:                   "Example",
+					URI:                    "https://example.com/feed",
+					UpdateFrequencySeconds: 3600,
+					Active:                 true,
+				},
+				Items: []rss.Item{
+					{
+						Title:   "Gorse 2 released",
+						Link:    "https://example.com/1",
+						PubDate: time.Now().Add(-2 * time.Hour),
+					},
+					{
+						Title:   "Bake sale",
+						Link:    "https://example.com/2",
+						PubDate: time.Now().Add(-time.Hour),
+					},
+				},
+				Subscribers: []string{"user@example.com"},
+			},
+		},
+	})
+	userID := loaded.Users["user@example.com"]
+
+	settings := &Config{
+		DisplayTimeZone: "UTC",
+		WebRoot:         "static",
+		TemplateDir:     "templates",
+	}
+	sessionStore := sessions.NewCookieStore([]byte(strings.Repeat("k", 32)))
+
+	list := func(query string) string {
+		request := httptest.NewRequest(http.MethodGet,
+			"/?"+query, nil)
+		session, err := sessionStore.New(request, "gorse")
+		if err != nil {
+			t.Fatalf("unable to create session: %s", err)
+		}
+		session.Values[sessionUserKey] = userID
+		rw := httptest.NewRecorder()
+		handlerListItems(rw, request, settings, store, session)
+
+		body := rw.Body.String()
+		if rw.Code != http.StatusOK {
+			t.Fatalf("status = %d: %q, wanted %d", rw.Code, body, http.StatusOK)
+		}
+		return body
+	}
+
+	if body := list(""); strings.Contains(body, "highlights=1") {
+		t.Errorf("page links to highlights without any: %q", body)
+	}
+
+	if err := store.AddHighlight(context.Background(), userID,
+		"GORSE"); err != nil {
+		t.Fatalf("AddHighlight() = error %s", err)
+	}
+
+	body := list("")
+	if n := strings.Count(body, `class="highlight"`); n != 1 {
+		t.Errorf("page has %d highlight badges, wanted 1: %q", n, body)
+	}
+	if !strings.Contains(body, "highlights=1") ||
+		!strings.Contains(body, "Bake sale") {
+		t.Errorf("page = %q, wanted every item and a link to highlights", body)
+	}
+
+	body = list("highlights=1")
+	if !strings.Contains(body, "Gorse 2 released") ||
+		strings.Contains(body, "Bake sale") {
+		t.Errorf("highlights page = %q, wanted only the highlighted item", body)
+	}
+	if !strings.Contains(body, `name="highlights" value="1"`) {
+		t.Errorf("highlights page = %q, wanted saving to come back to it", body)
+	}
+}
+
+func TestHighlighted(t *testing.T) {
+	highlights := []gorse.Highlight{{Phrase: "storm"}, {Phrase: "bake sale"}}
+	tests := []struct {
+		item gorse.UserItem
+		want bool
+	}{
+		{gorse.UserItem{DBItem: gorse.DBItem{Title: "Storms ahead"}}, true},
+		{gorse.UserItem{DBItem: gorse.DBItem{Title: "Cakes",
+			Description: "At the <b>BAKE SALE</b>"}}, true},
+		{gorse.UserItem{DBItem: gorse.DBItem{Title: "Bake a cake"}}, false},
+	}
+
+	for _, test := range tests {
+		if got := highlighted(highlights, test.item); got != test.want {
+			t.Errorf("highlighted(%+v) = %t, wanted %t", test.item, got,
+				test.want)
+		}
+	}
+	if highlighted(nil, tests[0].item) {
+		t.Errorf("highlighted() with no highlights = true, wanted false")
+	}
+}
@@ -2,19 +2,24 @@ package main
 
 import (
 	"errors"
+	"fmt"
 	"html"
 	"html/template"
-	"log"
 	"net/http"
 	"path/filepath"
 	"regexp"
+
+	"github.com/horgh/gorse/internal/i18n"
 )
 
 // renderPage builds a full page.
 //
 // The specified content template is used to build the content section of the
 // page wrapped between header and footer.
-func renderPage(settings *Config, rw http.ResponseWriter,
+//
+// Templates translate their text into the locale with the t function, such as
+// {{t "Save"}}.
+func renderPage(settings *Config, rw http.ResponseWriter, locale *i18n.Locale,
 	contentTemplate string, data interface{}) error {
 	// Ensure the specified content template is valid.
 	matched, err := regexp.MatchString("^[_a-zA-Z]+$", contentTemplate)
@@ -22,17 +27,23 @@ func renderPage(settings *Config, rw http.ResponseWriter,
 		return errors.New("invalid template name")
 	}
 
-	header, err := template.ParseFiles(
-		filepath.Join(settings.TemplateDir, "_header.html"))
+	// The header refers to static files with the asset function so their URLs
+	// include their version.
+	header, err := template.New("_header.html").Funcs(template.FuncMap{
+		"asset": func(name string) string {
+			return assetURL(settings.WebRoot, name)
+		},
+		"t": locale.T,
+	}).ParseFiles(filepath.Join(settings.TemplateDir, "_header.html"))
 	if err != nil {
-		log.Printf("Failed to load header: %s", err)
-		return err
+		return fmt.Errorf("failed to load header: %s", err)
 	}
 
 	// Content.
 
 	funcMap := template.FuncMap{
 		"getRowCSSClass": getRowCSSClass,
+		"t":              locale.T,
 	}
 
 	// We need the base path as that is the name that gets assigned to the
@@ -45,36 +56,33 @@ func renderPage(settings *Config, rw http.ResponseWriter,
 	content, err := template.New("content").Funcs(funcMap).ParseFiles(
 		contentTemplatePath)
 	if err != nil {
-		log.Printf("Failed to load content template [%s]: %s", contentTemplate, err)
-		return err
+		return fmt.Errorf("failed to load content template [%s]: %s",
+			contentTemplate, err)
 	}
 
 	// Footer.
-	footer, err := template.ParseFiles(
-		filepath.Join(settings.TemplateDir, "_footer.html"))
+	footer, err := template.New("_footer.html").Funcs(template.FuncMap{
+		"t": locale.T,
+	}).ParseFiles(filepath.Join(settings.TemplateDir, "_footer.html"))
 	if err != nil {
-		log.Printf("Failed to load footer: %s", err)
-		return err
+		return fmt.Errorf("failed to load footer: %s", err)
 	}
 
 	// Execute the templates and write them out.
 
 	err = header.Execute(rw, data)
 	if err != nil {
-		log.Printf("Failed to execute header: %s", err)
-		return err
+		return fmt.Errorf("failed to execute header: %s", err)
 	}
 
 	err = content.ExecuteTemplate(rw, contentTemplateBasePath, data)
 	if err != nil {
-		log.Printf("Failed to execute content: %s", err)
-		return err
+		return fmt.Errorf("failed to execute content: %s", err)
 	}
 
 	err = footer.Execute(rw, data)
 	if err != nil {
-		log.Printf("Failed to execute footer: %s", err)
-		return err
+		return fmt.Errorf("failed to execute footer: %s", err)
 	}
 
 	return nil
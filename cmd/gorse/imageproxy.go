@@ -0,0 +1,245 @@
+package main
+
+import (
+	"container/list"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"html/template"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/gorilla/sessions"
+	"github.com/horgh/gorse"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// We show the images in articles through /image rather than linking to where
+// they are. This way publishers' servers and tracking pixels don't see who is
+// reading what.
+//
+// We sign the URLs we proxy so that we only fetch images from articles we
+// showed rather than whatever anyone asks for. We keep recent images in
+// memory so that we fetch each once.
+
+// maxImageBytes is the largest image we proxy.
+const maxImageBytes = 5 << 20
+
+// imageCacheBytes is how much memory we use to keep images.
+const imageCacheBytes = 64 << 20
+
+// imageTypes are the types of images we proxy, as http.DetectContentType
+// reports them. We leave out SVG as it can have scripts.
+var imageTypes = map[string]struct{}{
+	"image/bmp":    {},
+	"image/gif":    {},
+	"image/jpeg":   {},
+	"image/png":    {},
+	"image/webp":   {},
+	"image/x-icon": {},
+}
+
+// proxiedImage is an image we fetched.
+type proxiedImage struct {
+	url         string
+	contentType string
+	body        []byte
+}
+
+// imageCache holds the images we fetched most recently, up to imageCacheBytes
+// of them.
+var imageCache = struct {
+	mu     sync.Mutex
+	bytes  int
+	recent *list.List
+	images map[string]*list.Element
+}{recent: list.New(), images: map[string]*list.Element{}}
+
+// cachedImage retrieves the image from the cache if it's there.
+func cachedImage(imageURL string) (*proxiedImage, bool) {
+	imageCache.mu.Lock()
+	defer imageCache.mu.Unlock()
+
+	e, ok := imageCache.images[imageURL]
+	if !ok {
+		return nil, false
+	}
+	imageCache.recent.MoveToFront(e)
+	return e.Value.(*proxiedImage), true
+}
+
+// cacheImage adds the image to the cache, forgetting the least recently used
+// images if there isn't room.
+func cacheImage(image *proxiedImage) {
+	imageCache.mu.Lock()
+	defer imageCache.mu.Unlock()
+
+	if _, ok := imageCache.images[image.url]; ok {
+		return
+	}
+
+	imageCache.images[image.url] = imageCache.recent.PushFront(image)
+	imageCache.bytes += len(image.body)
+
+	for imageCache.bytes > imageCacheBytes {
+		e := imageCache.recent.Back()
+		old := imageCache.recent.Remove(e).(*proxiedImage)
+		delete(imageCache.images, old.url)
+		imageCache.bytes -= len(old.body)
+	}
+}
+
+// imageSignature signs the URL so that we know we made the proxy URL for it.
+//
+// We use a key derived from the first cookie authentication key so that there
+// is no other secret to set up. Rotating that key changes the URLs.
+func imageSignature(settings *Config, imageURL string) string {
+	var authKey string
+	if keys := strings.Fields(settings.CookieAuthenticationKey); len(keys) > 0 {
+		authKey = keys[0]
+	}
+
+	keyMAC := hmac.New(sha256.New, []byte(authKey))
+	_, _ = keyMAC.Write([]byte("gorse image proxy"))
+
+	mac := hmac.New(sha256.New, keyMAC.Sum(nil))
+	_, _ = mac.Write([]byte(imageURL))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// imageProxyURL is the URL to show the image at through the proxy.
+func imageProxyURL(settings *Config, imageURL string) string {
+	return settings.URIPrefix + "/image?url=" + url.QueryEscape(imageURL) +
+		"&sig=" + imageSignature(settings, imageURL)
+}
+
+// proxyImages changes the sources of the images in the HTML to go through the
+// proxy.
+func proxyImages(settings *Config, content template.HTML) template.HTML {
+	var b strings.Builder
+	tokenizer := html.NewTokenizer(strings.NewReader(string(content)))
+	for {
+		if tokenizer.Next() == html.ErrorToken {
+			break
+		}
+		token := tokenizer.Token()
+		if (token.Type == html.StartTagToken ||
+			token.Type == html.SelfClosingTagToken) && token.DataAtom == atom.Img {
+			for i, a := range token.Attr {
+				if a.Key == "src" && a.Namespace == "" {
+					token.Attr[i].Val = imageProxyURL(settings, a.Val)
+				}
+			}
+		}
+		b.WriteString(token.String())
+	}
+
+	return template.HTML(b.String())
+}
+
+// handlerImage serves an image through the proxy. The query has the url of
+// the image and sig, its signature.
+//
+// It implements the type RequestHandlerFunc.
+func handlerImage(rw http.ResponseWriter, request *http.Request,
+	settings *Config, store gorse.Store, session *sessions.Session) {
+	imageURL := request.URL.Query().Get("url")
+	sig := request.URL.Query().Get("sig")
+	if !hmac.Equal([]byte(sig), []byte(imageSignature(settings, imageURL))) {
+		logf(request, "Bad image signature for %s", imageURL)
+		rw.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	image, ok := cachedImage(imageURL)
+	if !ok {
+		var err error
+		image, err = fetchImage(request.Context(), imageURL)
+		if err != nil {
+			logf(request, "Unable to fetch image %s: %s", imageURL, err)
+			rw.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		cacheImage(image)
+	}
+
+	rw.Header().Set("Content-Type", image.contentType)
+	rw.Header().Set("Content-Length", fmt.Sprintf("%d", len(image.body)))
+	rw.Header().Set("X-Content-Type-Options", "nosniff")
+	rw.Header().Set("Content-Security-Policy", "default-src 'none'; sandbox")
+	// The URL is for this image alone, so browsers may keep it.
+	rw.Header().Set("Cache-Control", "private, max-age=604800")
+	if _, err := rw.Write(image.body); err != nil {
+		logf(request, "Unable to write image: %s", err)
+	}
+}
+
+// fetchImage fetches the image if it's one we proxy.
+func fetchImage(ctx context.Context, imageURL string) (*proxiedImage,
+	error) {
+	u, err := url.Parse(imageURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid URL: %s", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("unsupported scheme: %s", u.Scheme)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, pageTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, imageURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("creating request: %s", err)
+	}
+	req.Header.Set("User-Agent", "gorse")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status %s", resp.Status)
+	}
+
+	mediaType, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err != nil || !strings.HasPrefix(mediaType, "image/") {
+		return nil, fmt.Errorf("not an image: %s",
+			resp.Header.Get("Content-Type"))
+	}
+	if resp.ContentLength > maxImageBytes {
+		return nil, fmt.Errorf("image is %d bytes", resp.ContentLength)
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxImageBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("reading body: %s", err)
+	}
+	if len(body) > maxImageBytes {
+		return nil, fmt.Errorf("image is over %d bytes", maxImageBytes)
+	}
+
+	// Believe what the image is rather than what the server says.
+	contentType := http.DetectContentType(body)
+	if _, ok := imageTypes[contentType]; !ok {
+		return nil, fmt.Errorf("unsupported image type: %s", contentType)
+	}
+
+	return &proxiedImage{
+		url:         imageURL,
+		contentType: contentType,
+		body:        body,
+	}, nil
+}
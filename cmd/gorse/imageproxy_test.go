@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"html/template"
+	"image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestProxyImages(t *testing.T) {
+	settings := &Config{
+		URIPrefix:               "/gorse",
+		CookieAuthenticationKey: strings.Repeat("k", 32),
+	}
+
+	got := proxyImages(settings, template.HTML(
+		`<p>Tom &amp; Jerry<img src="https://example.com/a.png?x=1&amp;y=2" `+
+			`alt="A"></p>`))
+
+	want := `<p>Tom &amp; Jerry<img src="` + template.HTMLEscapeString(
+		imageProxyURL(settings, "https://example.com/a.png?x=1&y=2")) +
+		`" alt="A"></p>`
+	if string(got) != want {
+		t.Errorf("proxyImages() = %s, wanted %s", got, want)
+	}
+}
+
+func TestHandlerImage(t *testing.T) {
+	var pngImage bytes.Buffer
+	if err := png.Encode(&pngImage, image.NewGray(image.Rect(0, 0, 2,
+		2))); err != nil {
+		t.Fatalf("encoding image: %s", err)
+	}
+
+	fetches := 0
+	site := httptest.NewServer(http.HandlerFunc(
+		func(rw http.ResponseWriter, request *http.Request) {
+			fetches++
+			switch request.URL.Path {
+			case "/image.png":
+				rw.Header().Set("Content-Type", "image/png")
+				_, _ = rw.Write(pngImage.Bytes())
+			case "/page.png":
+				// Claims to be an image but isn't.
+				rw.Header().Set("Content-Type", "image/png")
+				_, _ = rw.Write([]byte("<html><script>evil()</script></html>"))
+			case "/huge.png":
+				rw.Header().Set("Content-Type", "image/png")
+				_, _ = rw.Write(append(pngImage.Bytes(),
+					make([]byte, maxImageBytes)...))
+			default:
+				http.NotFound(rw, request)
+			}
+		}))
+	defer site.Close()
+
+	settings := &Config{CookieAuthenticationKey: strings.Repeat("k", 32)}
+
+	get := func(path string) *httptest.ResponseRecorder {
+		rw := httptest.NewRecorder()
+		handlerImage(rw, httptest.NewRequest(http.MethodGet, path, nil),
+			settings, nil, nil)
+		return rw
+	}
+
+	imageURL := site.URL + "/image.png"
+	for i := 0; i < 2; i++ {
+		rw := get(imageProxyURL(settings, imageURL))
+		if rw.Code != http.StatusOK ||
+			rw.Header().Get("Content-Type") != "image/png" ||
+			!bytes.Equal(rw.Body.Bytes(), pngImage.Bytes()) {
+			t.Fatalf("GET image = status %d, type %s, wanted the image", rw.Code,
+				rw.Header().Get("Content-Type"))
+		}
+	}
+	if fetches != 1 {
+		t.Errorf("fetched the image %d times, wanted once", fetches)
+	}
+
+	if rw := get("/image?url=" + url.QueryEscape(imageURL) +
+		"&sig=forged"); rw.Code != http.StatusForbidden {
+		t.Errorf("GET with a bad signature = status %d, wanted %d", rw.Code,
+			http.StatusForbidden)
+	}
+
+	for _, path := range []string{"/page.png", "/huge.png", "/missing.png"} {
+		if rw := get(imageProxyURL(settings,
+			site.URL+path)); rw.Code != http.StatusBadGateway {
+			t.Errorf("GET %s = status %d, wanted %d", path, rw.Code,
+				http.StatusBadGateway)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+
+	"github.com/horgh/gorse"
+)
+
+// importUser imports another reader's export from the file for the user with
+// the email. See gorse.ParseImport for the exports we understand.
+func importUser(ctx context.Context, settings *Config, email,
+	path string) error {
+	fh, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := fh.Close(); err != nil {
+			log.Printf("Close: %s: %s", path, err)
+		}
+	}()
+
+	items, err := gorse.ParseImport(fh)
+	if err != nil {
+		return err
+	}
+
+	db, err := connectToDB(settings)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := db.Close(); err != nil {
+			log.Printf("Database close: %s", err)
+		}
+	}()
+
+	user, err := findUserByEmail(ctx, db, email)
+	if err != nil {
+		return err
+	}
+
+	store := gorse.NewSQLStore(db, settings.DBType)
+	defer func() {
+		if err := store.Close(); err != nil {
+			log.Printf("Store close: %s", err)
+		}
+	}()
+
+	// The user is the one importing.
+	ctx = gorse.WithActor(ctx, user.ID)
+
+	var result gorse.ImportResult
+	if err := store.InTx(ctx, func(store gorse.Store) error {
+		var err error
+		result, err = gorse.ImportItems(ctx, store, user.ID, items)
+		return err
+	}); err != nil {
+		return err
+	}
+
+	log.Printf("Imported %d items. Added %d feeds and %d items we didn't have.",
+		len(items), result.FeedsAdded, result.ItemsAdded)
+	return nil
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"net/http"
+	"path"
+	"strconv"
+
+	"github.com/gorilla/sessions"
+	"github.com/horgh/gorse"
+)
+
+// handlerItemRead marks one of the user's items read. Our script uses it to
+// mark items from the list without submitting the whole form and coming back.
+// We respond with the item as the API describes it.
+//
+// It implements the type RequestHandlerFunc.
+func handlerItemRead(rw http.ResponseWriter, request *http.Request,
+	settings *Config, store gorse.Store, session *sessions.Session) {
+	userID, ok := itemStateUser(rw, request, settings, session)
+	if !ok {
+		return
+	}
+	setItemStateJSON(rw, request, store, userID, gorse.Read)
+}
+
+// handlerItemReadLater saves one of the user's items to read later. It is
+// handlerItemRead for saving items.
+//
+// It implements the type RequestHandlerFunc.
+func handlerItemReadLater(rw http.ResponseWriter, request *http.Request,
+	settings *Config, store gorse.Store, session *sessions.Session) {
+	userID, ok := itemStateUser(rw, request, settings, session)
+	if !ok {
+		return
+	}
+	setItemStateJSON(rw, request, store, userID, gorse.ReadLater)
+}
+
+// itemStateUser parses the form of a request from our script setting an
+// item's state and gives the user logged in with the session. If there's a
+// problem, we respond saying so and return false.
+func itemStateUser(rw http.ResponseWriter, request *http.Request,
+	settings *Config, session *sessions.Session) (int, bool) {
+	if err := request.ParseForm(); err != nil {
+		logf(request, "Failed to parse form: %s", err)
+		if bodyTooLarge(err) {
+			sendJSONError(rw, http.StatusRequestEntityTooLarge,
+				tooLargeError(settings.maxFormBytes()))
+			return -1, false
+		}
+		sendJSONError(rw, http.StatusBadRequest, "Failed to parse request")
+		return -1, false
+	}
+
+	return sessionUserJSON(rw, request, session)
+}
+
+// setItemStateJSON sets the state of the item with the ID in the path, which
+// ends /<id>/<action>, for the user. We respond with the item as the API
+// describes it. Our script and the API both set states this way.
+func setItemStateJSON(rw http.ResponseWriter, request *http.Request,
+	store gorse.Store, userID int, state gorse.ReadState) {
+	itemIDStr := path.Base(path.Dir(request.URL.Path))
+	itemID, err := strconv.ParseInt(itemIDStr, 10, 64)
+	if err != nil {
+		logf(request, "Bad item ID: %s: %s", itemIDStr, err)
+		sendJSONError(rw, http.StatusBadRequest, "Bad item ID")
+		return
+	}
+
+	ctx := gorse.WithActor(request.Context(), userID)
+
+	if _, err := store.GetItem(ctx, itemID, userID); err != nil {
+		if err == gorse.ErrNotFound {
+			logf(request, "No item %d", itemID)
+			sendJSONError(rw, http.StatusNotFound, "Unknown item")
+			return
+		}
+		logf(request, "Unable to look up item %d: %s", itemID, err)
+		sendJSONError(rw, http.StatusInternalServerError,
+			"Unable to look up item")
+		return
+	}
+
+	// Marking read goes through markItemsRead so that we remember items read
+	// after saving them, as when the user marks them read on the list.
+	if state == gorse.Read {
+		err = markItemsRead(ctx, store, []int64{itemID}, userID)
+	} else {
+		err = store.SetItemsReadState(ctx, []int64{itemID}, userID, state)
+	}
+	if err != nil {
+		logf(request, "Unable to set state of item %d: %s", itemID, err)
+		sendJSONError(rw, http.StatusInternalServerError,
+			"Unable to set the item's state")
+		return
+	}
+
+	item, err := store.GetItem(ctx, itemID, userID)
+	if err != nil {
+		logf(request, "Unable to look up item %d: %s", itemID, err)
+		sendJSONError(rw, http.StatusInternalServerError,
+			"Unable to look up item")
+		return
+	}
+
+	logf(request, "Set state of item %d to %s", itemID, state)
+
+	sendJSON(request, rw, http.StatusOK, newAPIItem(*item))
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/sessions"
+	"github.com/horgh/gorse"
+	"github.com/horgh/gorse/internal/gorsetest"
+	"github.com/horgh/rss"
+)
+
+func TestHandlerItemStateIntegration(t *testing.T) {
+	for _, dbType := range gorsetest.Types {
+		t.Run(dbType, func(t *testing.T) {
+			testHandlerItemStateIntegration(t, dbType)
+		})
+	}
+}
+
+func testHandlerItemStateIntegration(t *testing.T, dbType string) {
+	store, _ := gorsetest.Store(t, dbType)
+
+	loaded := gorsetest.Load(t, store, gorsetest.Fixture{
+		Users: []gorsetest.User{
+			{Email: "user@example.com", Password: "password"},
+		},
+		Feeds: []gorsetest.Feed{
+			{
+				DBFeed: gorse.DBFeed{
+					Name:                   "Example",
+					URI:                    "https://example.com/feed",
+					UpdateFrequencySeconds: 3600,
+					Active:                 true,
+				},
+				Items: []rss.Item{
+					{Title: "One", Link: "https://example.com/1", PubDate: time.Now()},
+				},
+				Subscribers: []string{"user@example.com"},
+			},
+		},
+	})
+	userID := loaded.Users["user@example.com"]
+	itemID := loaded.Items["https://example.com/1"]
+
+	settings := &Config{}
+	sessionStore := sessions.NewCookieStore([]byte(strings.Repeat("k", 32)))
+
+	serve := func(handler func(http.ResponseWriter, *http.Request, *Config,
+		gorse.Store, *sessions.Session), path string,
+		userID int) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodPost, path, nil)
+		session, err := sessionStore.New(request, "gorse")
+		if err != nil {
+			t.Fatalf("creating session: %s", err)
+		}
+		if userID != 0 {
+			session.Values[sessionUserKey] = userID
+		}
+		rw := httptest.NewRecorder()
+		handler(rw, request, settings, store, session)
+		return rw
+	}
+
+	tests := []struct {
+		Name    string
+		Handler func(http.ResponseWriter, *http.Request, *Config, gorse.Store,
+			*sessions.Session)
+		Path   string
+		UserID int
+		Status int
+		State  string
+	}{
+		{
+			Name:    "read later",
+			Handler: handlerItemReadLater,
+			Path:    fmt.Sprintf("/api/items/%d/read-later", itemID),
+			UserID:  userID,
+			Status:  http.StatusOK,
+			State:   "read-later",
+		},
+		{
+			Name:    "read",
+			Handler: handlerItemRead,
+			Path:    fmt.Sprintf("/api/items/%d/read", itemID),
+			UserID:  userID,
+			Status:  http.StatusOK,
+			State:   "read",
+		},
+		{
+			Name:    "not logged in",
+			Handler: handlerItemRead,
+			Path:    fmt.Sprintf("/api/items/%d/read", itemID),
+			Status:  http.StatusUnauthorized,
+		},
+		{
+			Name:    "unknown item",
+			Handler: handlerItemReadLater,
+			Path:    "/api/items/999999/read-later",
+			UserID:  userID,
+			Status:  http.StatusNotFound,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			rw := serve(test.Handler, test.Path, test.UserID)
+			if rw.Code != test.Status {
+				t.Fatalf("POST %s = status %d, wanted %d: %s", test.Path, rw.Code,
+					test.Status, rw.Body.String())
+			}
+			if test.Status != http.StatusOK {
+				return
+			}
+
+			var item apiItem
+			if err := json.Unmarshal(rw.Body.Bytes(), &item); err != nil {
+				t.Fatalf("POST %s = %s, wanted JSON: %s", test.Path,
+					rw.Body.String(), err)
+			}
+			if item.ID != itemID || item.State != test.State {
+				t.Errorf("POST %s = item %d in state %s, wanted item %d in state %s",
+					test.Path, item.ID, item.State, itemID, test.State)
+			}
+
+			stored, err := store.GetItem(context.Background(), itemID, userID)
+			if err != nil {
+				t.Fatalf("getting item: %s", err)
+			}
+			if stored.ReadState.String() != test.State {
+				t.Errorf("item is in state %s, wanted %s", stored.ReadState,
+					test.State)
+			}
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// defaultSocketMode is the permissions we give a unix socket if
+// ListenSocketMode is blank. This lets a web server in our group connect.
+const defaultSocketMode os.FileMode = 0660
+
+// listensOnSocket says whether we listen on a unix socket rather than a TCP
+// port. We do if ListenHost is a path.
+func listensOnSocket(settings *Config) bool {
+	return strings.HasPrefix(settings.ListenHost, "/")
+}
+
+// socketMode parses ListenSocketMode, the unix socket's permissions in octal.
+func socketMode(settings *Config) (os.FileMode, error) {
+	if settings.ListenSocketMode == "" {
+		return defaultSocketMode, nil
+	}
+
+	mode, err := strconv.ParseUint(settings.ListenSocketMode, 8, 32)
+	if err != nil || mode > 0777 {
+		return 0, fmt.Errorf("invalid socket mode: %s", settings.ListenSocketMode)
+	}
+
+	return os.FileMode(mode), nil
+}
+
+// listen opens what we serve requests on. This is a unix socket if ListenHost
+// is a path, and otherwise the TCP port on the host. If we're taking over from
+// another process, it's the listener that process passed us. It also returns a
+// description of the address for logging.
+func listen(settings *Config) (net.Listener, string, error) {
+	listener, err := inheritedListener()
+	if err != nil {
+		return nil, "", err
+	}
+	if listener != nil {
+		return listener, listener.Addr().String(), nil
+	}
+
+	if !listensOnSocket(settings) {
+		address := net.JoinHostPort(settings.ListenHost,
+			strconv.FormatUint(settings.ListenPort, 10))
+		listener, err = net.Listen("tcp", address)
+		if err != nil {
+			return nil, "", fmt.Errorf("unable to listen on %s: %s", address, err)
+		}
+		return listener, address, nil
+	}
+
+	path := settings.ListenHost
+	mode, err := socketMode(settings)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// A socket left behind by a previous run stops us listening. Remove it,
+	// but don't remove anything else that happens to be there.
+	if fi, err := os.Lstat(path); err == nil {
+		if fi.Mode()&os.ModeSocket == 0 {
+			return nil, "", fmt.Errorf("%s exists and is not a socket", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, "", fmt.Errorf("unable to remove old socket: %s", err)
+		}
+	}
+
+	// The listener removes the socket when it closes.
+	listener, err = net.Listen("unix", path)
+	if err != nil {
+		return nil, "", fmt.Errorf("unable to listen on %s: %s", path, err)
+	}
+
+	if err := os.Chmod(path, mode); err != nil {
+		_ = listener.Close()
+		return nil, "", fmt.Errorf("unable to set permissions of %s: %s", path,
+			err)
+	}
+
+	return listener, path, nil
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestListenSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "gorse.sock")
+	settings := &Config{ListenHost: path, ListenSocketMode: "0600"}
+
+	listener, address, err := listen(settings)
+	if err != nil {
+		t.Fatalf("listen() = error %s", err)
+	}
+	if address != path {
+		t.Errorf("listen() address = %s, wanted %s", address, path)
+	}
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("socket: %s", err)
+	}
+	if fi.Mode()&os.ModeSocket == 0 || fi.Mode().Perm() != 0600 {
+		t.Errorf("socket mode = %s, wanted a socket with 0600", fi.Mode())
+	}
+
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatalf("unable to connect to socket: %s", err)
+	}
+	_ = conn.Close()
+
+	// A socket left behind doesn't stop us listening again.
+	listener.(*net.UnixListener).SetUnlinkOnClose(false)
+	if err := listener.Close(); err != nil {
+		t.Fatalf("closing listener: %s", err)
+	}
+
+	settings.ListenSocketMode = ""
+	listener, _, err = listen(settings)
+	if err != nil {
+		t.Fatalf("listen() with old socket = error %s", err)
+	}
+	if fi, err := os.Stat(path); err != nil ||
+		fi.Mode().Perm() != defaultSocketMode {
+		t.Errorf("socket mode = %v (%v), wanted %s", fi.Mode(), err,
+			defaultSocketMode)
+	}
+	if err := listener.Close(); err != nil {
+		t.Fatalf("closing listener: %s", err)
+	}
+
+	// Anything else there does.
+	if err := os.WriteFile(path, []byte("x"), 0600); err != nil {
+		t.Fatalf("writing file: %s", err)
+	}
+	if _, _, err := listen(settings); err == nil {
+		t.Errorf("listen() over a file = success, wanted error")
+	}
+}
+
+func TestSocketMode(t *testing.T) {
+	tests := []struct {
+		Mode    string
+		Want    os.FileMode
+		WantErr bool
+	}{
+		{"", 0660, false},
+		{"0666", 0666, false},
+		{"600", 0600, false},
+		{"0999", 0, true},
+		{"01777", 0, true},
+		{"rw", 0, true},
+	}
+
+	for _, test := range tests {
+		mode, err := socketMode(&Config{ListenSocketMode: test.Mode})
+		if (err != nil) != test.WantErr || mode != test.Want {
+			t.Errorf("socketMode(%q) = %s, %v, wanted %s (error: %t)", test.Mode,
+				mode, err, test.Want, test.WantErr)
+		}
+	}
+}
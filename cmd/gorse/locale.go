@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/horgh/gorse"
+	"github.com/horgh/gorse/internal/i18n"
+)
+
+// userLocale decides which locale to show the user the page in. It's the one
+// they chose if they did, and otherwise the one their browser asks for.
+func userLocale(request *http.Request, user *gorse.User) *i18n.Locale {
+	if user != nil && user.Locale != "" {
+		if l, ok := i18n.Lookup(user.Locale); ok {
+			return l
+		}
+		logf(request, "User %d has locale %s which we don't have", user.ID,
+			user.Locale)
+	}
+	return i18n.Negotiate(request.Header.Get("Accept-Language"))
+}
+
+// formatDate formats the time for the user in the location. It gives the
+// date as the user wants to see it, which may be relative to now, along with
+// the full date.
+func formatDate(l *i18n.Locale, user *gorse.User, t time.Time,
+	location *time.Location) (string, string) {
+	full := l.FormatDate(t.In(location))
+	if user != nil && user.RelativeDates {
+		return l.FormatRelative(t, time.Now()), full
+	}
+	return full, full
+}
+
+// browserLocale is what to give setLocale for the user to see the locale their
+// browser asks for.
+const browserLocale = "browser"
+
+// setLocale sets the locale of the user with the email, and whether they see
+// dates relative to now. dates is relative or absolute. Blank means absolute.
+func setLocale(ctx context.Context, settings *Config, email, tag,
+	dates string) error {
+	if tag == browserLocale {
+		tag = ""
+	} else if _, ok := i18n.Lookup(tag); !ok {
+		return fmt.Errorf("unknown locale: %s. Use one of %s, or %s",
+			tag, strings.Join(i18n.Tags(), ", "), browserLocale)
+	}
+
+	var relativeDates bool
+	switch dates {
+	case "", "absolute":
+	case "relative":
+		relativeDates = true
+	default:
+		return fmt.Errorf("unknown kind of dates: %s. Use relative or absolute",
+			dates)
+	}
+
+	db, err := connectToDB(settings)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := db.Close(); err != nil {
+			log.Printf("Database close: %s", err)
+		}
+	}()
+
+	user, err := findUserByEmail(ctx, db, email)
+	if err != nil {
+		return err
+	}
+
+	return gorse.UpdateLocale(ctx, db, user.ID, tag, relativeDates)
+}
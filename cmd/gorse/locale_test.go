@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/sessions"
+	"github.com/horgh/gorse"
+	"github.com/horgh/gorse/internal/gorsetest"
+	"github.com/horgh/rss"
+)
+
+func TestUserLocale(t *testing.T) {
+	tests := []struct {
+		Name           string
+		User           *gorse.User
+		AcceptLanguage string
+		Tag            string
+	}{
+		{"chosen", &gorse.User{Locale: "de"}, "fr", "de"},
+		{"browser", &gorse.User{}, "fr-CA, en;q=0.5", "fr"},
+		{"unknown", &gorse.User{Locale: "xx"}, "", "en"},
+		{"no user", nil, "de", "de"},
+	}
+
+	for _, test := range tests {
+		request := httptest.NewRequest(http.MethodGet, "/", nil)
+		request.Header.Set("Accept-Language", test.AcceptLanguage)
+		if l := userLocale(request, test.User); l.Tag != test.Tag {
+			t.Errorf("%s: userLocale() = %s, wanted %s", test.Name, l.Tag, test.Tag)
+		}
+	}
+}
+
+func TestHandlerListItemsLocaleIntegration(t *testing.T) {
+	for _, dbType := range gorsetest.Types {
+		t.Run(dbType, func(t *testing.T) {
+			testHandlerListItemsLocaleIntegration(t, dbType)
+		})
+	}
+}
+
+func testHandlerListItemsLocaleIntegration(t *testing.T, dbType string) {
+	store, _ := gorsetest.Store(t, dbType)
+
+	loaded := gorsetest.Load(t, store, gorsetest.Fixture{
+		Users: []gorsetest.User{
+			{Email: "user@example.com", Password: "password"},
+		},
+		Feeds: []gorsetest.Feed{
+			{
+				DBFeed: gorse.DBFeed{
+					Name:                   "Example",
+					URI:                    "https://example.com/feed",
+					UpdateFrequencySeconds: 3600,
+					Active:                 true,
+				},
+				Items: []rss.Item{
+					{
+						Title:   "One",
+						Link:    "https://example.com/1",
+						PubDate: time.Now().Add(-2 * time.Hour),
+					},
+				},
+				Subscribers: []string{"user@example.com"},
+			},
+		},
+	})
+	userID := loaded.Users["user@example.com"]
+
+	if err := store.UpdateLocale(context.Background(), userID, "fr",
+		true); err != nil {
+		t.Fatalf("UpdateLocale() = error %s", err)
+	}
+
+	settings := &Config{
+		DisplayTimeZone: "UTC",
+		WebRoot:         "static",
+		TemplateDir:     "templates",
+	}
+	sessionStore := sessions.NewCookieStore([]byte(strings.Repeat("k", 32)))
+
+	request := httptest.NewRequest(http.MethodGet,
+		"/", nil)
+	request.Header.Set("Accept-Language", "en")
+	session, err := sessionStore.New(request, "gorse")
+	if err != nil {
+		t.Fatalf("unable to create session: %s", err)
+	}
+	session.Values[sessionUserKey] = userID
+	rw := httptest.NewRecorder()
+	handlerListItems(rw, request, settings, store, session)
+
+	body := rw.Body.String()
+	if rw.Code != http.StatusOK {
+		t.Fatalf("status = %d: %q, wanted %d", rw.Code, body, http.StatusOK)
+	}
+	for _, want := range []string{"Tout marquer comme lu", "il y a 2 heures"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("page does not contain %q: %q", want, body)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+// logFile is a log file we can reopen. This lets tools like logrotate move the
+// file aside and have us start a new one without restarting.
+type logFile struct {
+	path string
+
+	mu   sync.Mutex
+	file *os.File
+}
+
+func openLogFile(path string) (*logFile, error) {
+	f := &logFile{path: path}
+	if err := f.Reopen(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Write writes to the file that's currently open.
+func (f *logFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.file.Write(p)
+}
+
+// Reopen opens the file at the path again and closes the one we had open. If
+// we can't open it, we keep writing to the one we had.
+func (f *logFile) Reopen() error {
+	// Don't use os.Create() because that truncates.
+	file, err := os.OpenFile(f.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return fmt.Errorf("unable to open log file: %s: %s", f.path, err)
+	}
+
+	f.mu.Lock()
+	old := f.file
+	f.file = file
+	f.mu.Unlock()
+
+	if old != nil {
+		if err := old.Close(); err != nil {
+			return fmt.Errorf("unable to close old log file: %s: %s", f.path, err)
+		}
+	}
+	return nil
+}
+
+// Close closes the file.
+func (f *logFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.file.Close()
+}
+
+// reopenOnSignal reopens the log files each time we receive SIGHUP or
+// SIGUSR1, such as from logrotate after it moves them aside.
+func reopenOnSignal(files ...*logFile) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP, syscall.SIGUSR1)
+
+	for sig := range signals {
+		for _, f := range files {
+			if err := f.Reopen(); err != nil {
+				log.Printf("Received %s but unable to reopen log file: %s", sig, err)
+				continue
+			}
+			log.Printf("Received %s. Reopened log file %s.", sig, f.path)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLogFileReopen(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "gorse.log")
+	rotated := filepath.Join(dir, "gorse.log.1")
+
+	f, err := openLogFile(path)
+	if err != nil {
+		t.Fatalf("openLogFile() = error %s", err)
+	}
+
+	if _, err := f.Write([]byte("before\n")); err != nil {
+		t.Fatalf("Write() = error %s", err)
+	}
+
+	if err := os.Rename(path, rotated); err != nil {
+		t.Fatalf("unable to rename log file: %s", err)
+	}
+	if err := f.Reopen(); err != nil {
+		t.Fatalf("Reopen() = error %s", err)
+	}
+
+	if _, err := f.Write([]byte("after\n")); err != nil {
+		t.Fatalf("Write() = error %s", err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("Close() = error %s", err)
+	}
+
+	for file, want := range map[string]string{
+		rotated: "before\n",
+		path:    "after\n",
+	} {
+		got, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatalf("unable to read %s: %s", file, err)
+		}
+		if string(got) != want {
+			t.Errorf("%s = %q, wanted %q", file, got, want)
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/sessions"
+	"github.com/horgh/gorse"
+)
+
+// Users log in with their email and password. We remember who logged in in
+// their session, and that is who each request is from. We don't take the user
+// from request parameters as anyone could send any ID.
+//
+// The session is a cookie we sign with CookieAuthenticationKey, so users can't
+// change who it says they are.
+
+// sessionUserKey is the session value holding the ID of the user who logged
+// in.
+const sessionUserKey = "user-id"
+
+// sessionUser gives the ID of the user logged in with the session. If no one
+// is, we send GET requests to log in, coming back after, and refuse others.
+// Then we return false.
+func sessionUser(rw http.ResponseWriter, request *http.Request,
+	settings *Config, session *sessions.Session) (int, bool) {
+	if userID, ok := loggedInUser(request, session); ok {
+		return userID, true
+	}
+
+	if request.Method == http.MethodGet {
+		next := settings.URIPrefix + request.URL.RequestURI()
+		uri := fmt.Sprintf("%s/login?%s", settings.URIPrefix,
+			url.Values{"next": {next}}.Encode())
+
+		logf(request, "Redirecting to %s", uri)
+
+		http.Redirect(rw, request, uri, http.StatusFound)
+		return -1, false
+	}
+
+	rw.WriteHeader(http.StatusUnauthorized)
+	_, _ = rw.Write([]byte("<h1>Log in first</h1>"))
+	writeRequestID(rw)
+	return -1, false
+}
+
+// sessionUserJSON is sessionUser for requests we respond to with JSON. If no
+// one is logged in, we respond with an error.
+func sessionUserJSON(rw http.ResponseWriter, request *http.Request,
+	session *sessions.Session) (int, bool) {
+	if userID, ok := loggedInUser(request, session); ok {
+		return userID, true
+	}
+	sendJSONError(rw, http.StatusUnauthorized, "Log in first")
+	return -1, false
+}
+
+// loggedInUser gives the ID of the user logged in with the session, if any.
+func loggedInUser(request *http.Request, session *sessions.Session) (int,
+	bool) {
+	if session != nil {
+		if userID, ok := session.Values[sessionUserKey].(int); ok && userID > 0 {
+			setRequestUser(request, userID)
+			return userID, true
+		}
+	}
+	logf(request, "Not logged in.")
+	return -1, false
+}
+
+// handlerLoginForm shows the form to log in. next is where to go after.
+//
+// It implements the type RequestHandlerFunc.
+func handlerLoginForm(rw http.ResponseWriter, request *http.Request,
+	settings *Config, store gorse.Store, session *sessions.Session) {
+	next := loginNext(settings, request.URL.Query().Get("next"))
+
+	if _, ok := loggedInUser(request, session); ok {
+		logf(request, "Already logged in. Redirecting to %s", next)
+		http.Redirect(rw, request, next, http.StatusFound)
+		return
+	}
+
+	renderLogin(rw, request, settings, http.StatusOK, "", next)
+}
+
+// handlerLogin logs the user in with their email and password. We go to next
+// after, or show the form again if we can't log them in.
+//
+// It implements the type RequestHandlerFunc.
+//
+// Failed logins count towards locking out the account and address like those
+// of the extension. See loginLimiter.
+func handlerLogin(rw http.ResponseWriter, request *http.Request,
+	settings *Config, store gorse.Store, session *sessions.Session) {
+	if err := request.ParseForm(); err != nil {
+		logf(request, "Failed to parse form: %s", err)
+		if bodyTooLarge(err) {
+			send413Error(rw, tooLargeError(settings.maxFormBytes()))
+			return
+		}
+		send400Error(rw, "Failed to parse request")
+		return
+	}
+
+	email := request.PostForm.Get("email")
+	password := request.PostForm.Get("password")
+	next := loginNext(settings, request.PostForm.Get("next"))
+
+	keys := loginKeys(request, email)
+	if wait, locked := loginLimits.LockedOut(keys); locked {
+		logf(request, "Refusing login for %s: locked out for %s", email,
+			wait.Round(time.Second))
+		rw.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(
+			wait.Seconds()))))
+		renderLogin(rw, request, settings, http.StatusTooManyRequests,
+			"Too many failed logins. Try again later.", next)
+		return
+	}
+
+	user, err := store.AuthenticateUser(request.Context(), email, password)
+	if err == gorse.ErrInvalidCredentials {
+		logf(request, "Invalid credentials for %s.", email)
+		for key, lockout := range loginLimits.Failed(keys) {
+			logf(request, "Locking out %s for %s after repeated failed logins",
+				key, lockout)
+		}
+		renderLogin(rw, request, settings, http.StatusUnauthorized,
+			"Invalid email or password.", next)
+		return
+	}
+	if err != nil {
+		logf(request, "Unable to authenticate user: %s", err)
+		send500Error(rw, "Unable to authenticate you")
+		return
+	}
+	loginLimits.Succeeded(email)
+	setRequestUser(request, user.ID)
+
+	session.Values[sessionUserKey] = user.ID
+	if err := session.Save(request, rw); err != nil {
+		logf(request, "Unable to save session: %s", err)
+		send500Error(rw, "Failed to save your session.")
+		return
+	}
+
+	logf(request, "Logged in user ID [%d]. Redirecting to %s", user.ID, next)
+
+	http.Redirect(rw, request, next, http.StatusFound)
+}
+
+// handlerLogout logs the user out. We go to the form to log in after.
+//
+// It implements the type RequestHandlerFunc.
+func handlerLogout(rw http.ResponseWriter, request *http.Request,
+	settings *Config, store gorse.Store, session *sessions.Session) {
+	_, _ = loggedInUser(request, session)
+
+	delete(session.Values, sessionUserKey)
+	if err := session.Save(request, rw); err != nil {
+		logf(request, "Unable to save session: %s", err)
+		send500Error(rw, "Failed to save your session.")
+		return
+	}
+
+	logf(request, "Logged out.")
+
+	http.Redirect(rw, request, settings.URIPrefix+"/login", http.StatusFound)
+}
+
+// renderLogin shows the form to log in with the status and message, if any.
+func renderLogin(rw http.ResponseWriter, request *http.Request,
+	settings *Config, status int, message, next string) {
+	type LoginPage struct {
+		Message   string
+		Next      string
+		Path      string
+		UserID    int
+		ReadState gorse.ReadState
+	}
+
+	rw.WriteHeader(status)
+	if err := renderPage(settings, rw, userLocale(request, nil), "_login",
+		LoginPage{
+			Message:   message,
+			Next:      next,
+			Path:      settings.URIPrefix,
+			ReadState: gorse.Unread,
+		}); err != nil {
+		logf(request, "Failure rendering page: %s", err)
+		return
+	}
+}
+
+// loginNext checks where to go after logging in is one of our pages. This is
+// so that a link to log in can't send the user elsewhere. If it's not, we go
+// to the list of items.
+func loginNext(settings *Config, next string) string {
+	u, err := url.Parse(next)
+	if err != nil || u.Scheme != "" || u.Host != "" || u.User != nil ||
+		strings.HasPrefix(next, "//") || strings.Contains(next, `\`) ||
+		!strings.HasPrefix(u.Path, settings.URIPrefix+"/") {
+		return settings.URIPrefix + "/"
+	}
+	return next
+}
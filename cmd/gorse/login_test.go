@@ -0,0 +1,209 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/sessions"
+	"github.com/horgh/gorse/internal/gorsetest"
+)
+
+// loggedInSession gives a session for the request with the user logged in.
+func loggedInSession(t *testing.T, request *http.Request,
+	userID int) *sessions.Session {
+	sessionStore := sessions.NewCookieStore([]byte(strings.Repeat("k", 32)))
+	session, err := sessionStore.New(request, "gorse")
+	if err != nil {
+		t.Fatalf("creating session: %s", err)
+	}
+	session.Values[sessionUserKey] = userID
+	return session
+}
+
+func TestLoginNext(t *testing.T) {
+	settings := &Config{URIPrefix: "/gorse"}
+
+	tests := []struct {
+		next string
+		want string
+	}{
+		{"", "/gorse/"},
+		{"/gorse/feeds?sort=errors", "/gorse/feeds?sort=errors"},
+		{"/gorse/", "/gorse/"},
+		{"/other/", "/gorse/"},
+		{"/gorse", "/gorse/"},
+		{"https://example.com/gorse/", "/gorse/"},
+		{"//example.com/gorse/", "/gorse/"},
+		{`/gorse/\example.com`, "/gorse/"},
+		{"javascript:alert(1)", "/gorse/"},
+	}
+
+	for _, test := range tests {
+		if got := loginNext(settings, test.next); got != test.want {
+			t.Errorf("loginNext(%q) = %q, wanted %q", test.next, got, test.want)
+		}
+	}
+}
+
+func TestSessionUser(t *testing.T) {
+	settings := &Config{URIPrefix: "/gorse"}
+
+	request := httptest.NewRequest(http.MethodGet, "/feeds?sort=errors", nil)
+	rw := httptest.NewRecorder()
+	if userID, ok := sessionUser(rw, request, settings,
+		loggedInSession(t, request, 3)); !ok || userID != 3 {
+		t.Errorf("sessionUser() = %d, %t, wanted 3, true", userID, ok)
+	}
+
+	// Not logged in. A user-id parameter doesn't count.
+	request = httptest.NewRequest(http.MethodGet,
+		"/feeds?sort=errors&user-id=1", nil)
+	session := loggedInSession(t, request, 0)
+	delete(session.Values, sessionUserKey)
+	rw = httptest.NewRecorder()
+	if _, ok := sessionUser(rw, request, settings, session); ok {
+		t.Errorf("sessionUser() without a login = ok, wanted not")
+	}
+	want := "/gorse/login?next=" + url.QueryEscape(
+		"/gorse/feeds?sort=errors&user-id=1")
+	if rw.Code != http.StatusFound || rw.Header().Get("Location") != want {
+		t.Errorf("GET = status %d to %s, wanted %d to %s", rw.Code,
+			rw.Header().Get("Location"), http.StatusFound, want)
+	}
+
+	request = httptest.NewRequest(http.MethodPost, "/feed_archive", nil)
+	rw = httptest.NewRecorder()
+	if _, ok := sessionUser(rw, request, settings, session); ok ||
+		rw.Code != http.StatusUnauthorized {
+		t.Errorf("POST = %t, status %d, wanted false, %d", ok, rw.Code,
+			http.StatusUnauthorized)
+	}
+}
+
+func TestHandlerLoginIntegration(t *testing.T) {
+	for _, dbType := range gorsetest.Types {
+		t.Run(dbType, func(t *testing.T) {
+			testHandlerLoginIntegration(t, dbType)
+		})
+	}
+}
+
+func testHandlerLoginIntegration(t *testing.T, dbType string) {
+	defer func(l *loginLimiter) { loginLimits = l }(loginLimits)
+	loginLimits = newLoginLimiter()
+
+	store, _ := gorsetest.Store(t, dbType)
+
+	loaded := gorsetest.Load(t, store, gorsetest.Fixture{
+		Users: []gorsetest.User{
+			{Email: "user@example.com", Password: "password"},
+		},
+	})
+	userID := loaded.Users["user@example.com"]
+
+	settings := &Config{
+		URIPrefix:       "/gorse",
+		DisplayTimeZone: "UTC",
+		WebRoot:         "static",
+		TemplateDir:     "templates",
+	}
+	sessionStore := sessions.NewCookieStore([]byte(strings.Repeat("k", 32)))
+
+	login := func(email, password string) (*httptest.ResponseRecorder,
+		*sessions.Session) {
+		form := url.Values{
+			"email":    {email},
+			"password": {password},
+			"next":     {"/gorse/feeds"},
+		}
+		request := httptest.NewRequest(http.MethodPost, "/login",
+			strings.NewReader(form.Encode()))
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		session, err := sessionStore.New(request, "gorse")
+		if err != nil {
+			t.Fatalf("creating session: %s", err)
+		}
+		rw := httptest.NewRecorder()
+		handlerLogin(rw, request, settings, store, session)
+		return rw, session
+	}
+
+	request := httptest.NewRequest(http.MethodGet, "/login?next=/gorse/feeds",
+		nil)
+	session, err := sessionStore.New(request, "gorse")
+	if err != nil {
+		t.Fatalf("creating session: %s", err)
+	}
+	rw := httptest.NewRecorder()
+	handlerLoginForm(rw, request, settings, store, session)
+	if rw.Code != http.StatusOK ||
+		!strings.Contains(rw.Body.String(), `value="/gorse/feeds"`) {
+		t.Errorf("GET = status %d: %s, wanted the form", rw.Code,
+			rw.Body.String())
+	}
+
+	rw, session = login("user@example.com", "wrong password")
+	if rw.Code != http.StatusUnauthorized ||
+		!strings.Contains(rw.Body.String(), "Invalid email or password.") {
+		t.Errorf("POST wrong password = status %d: %s, wanted %d", rw.Code,
+			rw.Body.String(), http.StatusUnauthorized)
+	}
+	if _, ok := session.Values[sessionUserKey]; ok {
+		t.Errorf("session has a user after a failed login")
+	}
+
+	rw, session = login("User@Example.com", "password")
+	if rw.Code != http.StatusFound ||
+		rw.Header().Get("Location") != "/gorse/feeds" {
+		t.Fatalf("POST = status %d to %s, wanted %d to /gorse/feeds", rw.Code,
+			rw.Header().Get("Location"), http.StatusFound)
+	}
+	if session.Values[sessionUserKey] != userID {
+		t.Errorf("session user = %v, wanted %d", session.Values[sessionUserKey],
+			userID)
+	}
+	if !strings.Contains(rw.Header().Get("Set-Cookie"), "gorse=") {
+		t.Errorf("Set-Cookie = %q, wanted the session",
+			rw.Header().Get("Set-Cookie"))
+	}
+
+	// The cookie logs us in on later requests.
+	request = httptest.NewRequest(http.MethodGet, "/feeds", nil)
+	request.Header.Set("Cookie", rw.Header().Get("Set-Cookie"))
+	session, err = sessionStore.Get(request, "gorse")
+	if err != nil {
+		t.Fatalf("getting session: %s", err)
+	}
+	rw = httptest.NewRecorder()
+	handlerFeeds(rw, request, settings, store, session)
+	if rw.Code != http.StatusOK {
+		t.Errorf("GET /feeds = status %d, wanted %d", rw.Code, http.StatusOK)
+	}
+
+	request = httptest.NewRequest(http.MethodPost, "/logout", nil)
+	rw = httptest.NewRecorder()
+	handlerLogout(rw, request, settings, store, session)
+	if rw.Code != http.StatusFound ||
+		rw.Header().Get("Location") != "/gorse/login" {
+		t.Errorf("POST /logout = status %d to %s, wanted %d to /gorse/login",
+			rw.Code, rw.Header().Get("Location"), http.StatusFound)
+	}
+	if _, ok := session.Values[sessionUserKey]; ok {
+		t.Errorf("session has a user after logging out")
+	}
+
+	for i := 0; i < loginFreeFailures; i++ {
+		_, _ = login("user@example.com", fmt.Sprintf("wrong %d", i))
+	}
+	rw, _ = login("user@example.com", "password")
+	if rw.Code != http.StatusTooManyRequests ||
+		rw.Header().Get("Retry-After") == "" {
+		t.Errorf("POST locked out = status %d, wanted %d with Retry-After",
+			rw.Code, http.StatusTooManyRequests)
+	}
+
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// We slow down guessing passwords by tracking failed logins for each account
+// and for each IP address. After loginFreeFailures failures in a row we lock
+// it out for loginLockout, doubling each failure after that up to
+// loginMaxLockout. While locked out we refuse to check passwords at all.
+//
+// Tracking IP addresses stops one client trying many accounts. Tracking
+// accounts stops many clients trying one. Logging in successfully clears the
+// account's failures but not the IP address's, as otherwise someone with an
+// account could clear theirs while guessing others' passwords.
+//
+// We keep this in memory, so restarting forgets it.
+
+// loginFreeFailures is how many failed logins in a row we allow before locking
+// out.
+const loginFreeFailures = 5
+
+// loginLockout is how long we lock out after loginFreeFailures failures.
+const loginLockout = time.Minute
+
+// loginMaxLockout is the longest we lock out for.
+const loginMaxLockout = time.Hour
+
+// loginFailureExpiry is how long after the last failure we forget failures.
+const loginFailureExpiry = 24 * time.Hour
+
+// loginPruneSize is how many accounts and addresses we track before we look
+// for ones to forget.
+const loginPruneSize = 10000
+
+// loginFailure is the failed logins for an account or IP address.
+type loginFailure struct {
+	count       int
+	last        time.Time
+	lockedUntil time.Time
+}
+
+// loginLimiter tracks failed logins.
+type loginLimiter struct {
+	mu       sync.Mutex
+	failures map[string]*loginFailure
+
+	// now gives the current time. Tests set it.
+	now func() time.Time
+}
+
+// loginLimits is the loginLimiter for the logins we serve.
+var loginLimits = newLoginLimiter()
+
+func newLoginLimiter() *loginLimiter {
+	return &loginLimiter{
+		failures: map[string]*loginFailure{},
+		now:      time.Now,
+	}
+}
+
+// loginKeys gives the keys we track the failed logins of the request for the
+// email under.
+func loginKeys(request *http.Request, email string) []string {
+	ip, _, err := net.SplitHostPort(request.RemoteAddr)
+	if err != nil {
+		ip = request.RemoteAddr
+	}
+	return []string{
+		"email:" + strings.ToLower(strings.TrimSpace(email)),
+		"ip:" + ip,
+	}
+}
+
+// LockedOut checks whether any of the keys are locked out. If so we return
+// how long until they all aren't.
+func (l *loginLimiter) LockedOut(keys []string) (time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	var wait time.Duration
+	for _, key := range keys {
+		f, ok := l.failures[key]
+		if !ok {
+			continue
+		}
+		if d := f.lockedUntil.Sub(now); d > wait {
+			wait = d
+		}
+	}
+	return wait, wait > 0
+}
+
+// Failed records a failed login for each of the keys. We return the keys we
+// locked out because of it along with how long for.
+func (l *loginLimiter) Failed(keys []string) map[string]time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	if len(l.failures) >= loginPruneSize {
+		l.prune(now)
+	}
+
+	locked := map[string]time.Duration{}
+	for _, key := range keys {
+		f, ok := l.failures[key]
+		if !ok || now.Sub(f.last) > loginFailureExpiry {
+			f = &loginFailure{}
+			l.failures[key] = f
+		}
+		f.count++
+		f.last = now
+
+		if f.count < loginFreeFailures {
+			continue
+		}
+		lockout := loginLockout
+		for i := loginFreeFailures; i < f.count && lockout < loginMaxLockout; i++ {
+			lockout *= 2
+		}
+		if lockout > loginMaxLockout {
+			lockout = loginMaxLockout
+		}
+		f.lockedUntil = now.Add(lockout)
+		locked[key] = lockout
+	}
+	return locked
+}
+
+// Succeeded records a successful login for the account. We forget its
+// failures.
+func (l *loginLimiter) Succeeded(email string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delete(l.failures, "email:"+strings.ToLower(strings.TrimSpace(email)))
+}
+
+// prune forgets failures that expired and aren't locked out.
+func (l *loginLimiter) prune(now time.Time) {
+	for key, f := range l.failures {
+		if now.Sub(f.last) > loginFailureExpiry && now.After(f.lockedUntil) {
+			delete(l.failures, key)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestLoginLimiter(t *testing.T) {
+	now := time.Date(2021, 3, 4, 12, 0, 0, 0, time.UTC)
+	l := newLoginLimiter()
+	l.now = func() time.Time { return now }
+
+	keys := []string{"email:user@example.com", "ip:192.0.2.1"}
+
+	for i := 0; i < loginFreeFailures-1; i++ {
+		if locked := l.Failed(keys); len(locked) != 0 {
+			t.Fatalf("Failed() %d = %v, wanted no lockout", i+1, locked)
+		}
+	}
+	if _, locked := l.LockedOut(keys); locked {
+		t.Fatalf("LockedOut() before %d failures = true", loginFreeFailures)
+	}
+
+	locked := l.Failed(keys)
+	if len(locked) != 2 || locked[keys[0]] != loginLockout {
+		t.Fatalf("Failed() %d = %v, wanted both locked out for %s",
+			loginFreeFailures, locked, loginLockout)
+	}
+	if wait, locked := l.LockedOut(keys); !locked || wait != loginLockout {
+		t.Errorf("LockedOut() = %s, %t, wanted %s", wait, locked, loginLockout)
+	}
+
+	// Another address trying the account is locked out too.
+	if _, locked := l.LockedOut([]string{keys[0],
+		"ip:192.0.2.2"}); !locked {
+		t.Errorf("LockedOut() from another address = false, wanted true")
+	}
+
+	now = now.Add(loginLockout)
+	if _, locked := l.LockedOut(keys); locked {
+		t.Errorf("LockedOut() after the lockout = true, wanted false")
+	}
+
+	// Each failure after that doubles the lockout.
+	if locked := l.Failed(keys); locked[keys[0]] != 2*loginLockout {
+		t.Errorf("Failed() after the lockout = %v, wanted %s", locked,
+			2*loginLockout)
+	}
+	for i := 0; i < 10; i++ {
+		locked = l.Failed(keys)
+	}
+	if locked[keys[0]] != loginMaxLockout {
+		t.Errorf("Failed() many times = %v, wanted at most %s", locked,
+			loginMaxLockout)
+	}
+
+	// Logging in clears the account but not the address.
+	l.Succeeded("User@example.com")
+	if _, locked := l.LockedOut(keys[:1]); locked {
+		t.Errorf("LockedOut() of account after logging in = true, wanted false")
+	}
+	if _, locked := l.LockedOut(keys[1:]); !locked {
+		t.Errorf("LockedOut() of address after logging in = false, wanted true")
+	}
+
+	// We forget failures a while after the last.
+	now = now.Add(loginFailureExpiry + loginMaxLockout)
+	if locked := l.Failed(keys); len(locked) != 0 {
+		t.Errorf("Failed() after failures expire = %v, wanted no lockout", locked)
+	}
+}
+
+func TestLoginKeys(t *testing.T) {
+	request := httptest.NewRequest("GET", "/", nil)
+	request.RemoteAddr = "192.0.2.1:1234"
+	keys := loginKeys(request, " User@Example.com")
+	if len(keys) != 2 || keys[0] != "email:user@example.com" ||
+		keys[1] != "ip:192.0.2.1" {
+		t.Errorf("loginKeys() = %q, wanted the email and address", keys)
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gorilla/sessions"
+	"github.com/horgh/gorse"
+)
+
+// handlerMarkAllRead sets all of the user's unread items read at once. This is
+// for catching up without paging through every item.
+//
+// It implements the type RequestHandlerFunc.
+//
+// feed-id limits us to one of the feeds the user subscribes to.
+// before=YYYY-MM-DD limits us to items published before that day in the
+// display time zone. Items saved to read later stay saved.
+//
+// We go back to the list of items after, or the page of feeds if from=feeds.
+func handlerMarkAllRead(rw http.ResponseWriter, request *http.Request,
+	settings *Config, store gorse.Store, session *sessions.Session) {
+	if err := request.ParseForm(); err != nil {
+		logf(request, "Failed to parse form: %s", err)
+		if bodyTooLarge(err) {
+			send413Error(rw, tooLargeError(settings.maxFormBytes()))
+			return
+		}
+		send400Error(rw, "Failed to parse request")
+		return
+	}
+
+	var userID int
+	var feedID int64
+	if request.PostForm.Get("feed-id") != "" {
+		var feed gorse.DBFeed
+		var ok bool
+		userID, feed, ok = subscribedFeedForm(rw, request, settings, store,
+			session)
+		if !ok {
+			return
+		}
+		feedID = feed.ID
+	} else {
+		var ok bool
+		userID, ok = sessionUser(rw, request, settings, session)
+		if !ok {
+			return
+		}
+	}
+
+	var until time.Time
+	if before := request.PostForm.Get("before"); before != "" {
+		location, err := time.LoadLocation(settings.DisplayTimeZone)
+		if err != nil {
+			logf(request, "Failed to load time zone location [%s]: %s",
+				settings.DisplayTimeZone, err)
+			send500Error(rw, "Unable to load timezone information")
+			return
+		}
+
+		day, err := time.ParseInLocation("2006-01-02", before, location)
+		if err != nil {
+			logf(request, "Bad day: %s: %s", before, err)
+			send400Error(rw, "Bad day")
+			return
+		}
+
+		// Until includes items published at it. Postgres keeps times to the
+		// microsecond.
+		until = day.Add(-time.Microsecond)
+	}
+
+	ctx := gorse.WithActor(request.Context(), userID)
+
+	count, err := store.MarkAllRead(ctx, userID, feedID, until)
+	if err != nil {
+		logf(request, "Unable to mark all items read: %s", err)
+		send500Error(rw, "Unable to mark items read")
+		return
+	}
+
+	logf(request, "Set %d items read.", count)
+
+	session.AddFlash("Marked all read.")
+	if err := session.Save(request, rw); err != nil {
+		logf(request, "Unable to save session: %s", err)
+		send500Error(rw, "Failed to save your session.")
+		return
+	}
+
+	uri := settings.URIPrefix + "/?read-state=unread" +
+		listViewParams(request.PostForm)
+	if request.PostForm.Get("from") == "feeds" {
+		uri = feedsURL(settings, request.PostForm)
+	}
+
+	logf(request, "Redirecting to %s", uri)
+
+	http.Redirect(rw, request, uri, http.StatusFound)
+}
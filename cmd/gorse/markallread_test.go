@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/horgh/gorse"
+	"github.com/horgh/gorse/internal/gorsetest"
+	"github.com/horgh/rss"
+)
+
+func TestHandlerMarkAllReadIntegration(t *testing.T) {
+	for _, dbType := range gorsetest.Types {
+		t.Run(dbType, func(t *testing.T) {
+			testHandlerMarkAllReadIntegration(t, dbType)
+		})
+	}
+}
+
+func testHandlerMarkAllReadIntegration(t *testing.T, dbType string) {
+	ctx := context.Background()
+	store, _ := gorsetest.Store(t, dbType)
+
+	now := time.Now()
+	feed := func(name string, subscribers ...string) gorsetest.Feed {
+		return gorsetest.Feed{
+			DBFeed: gorse.DBFeed{
+				Name:                   name,
+				URI:                    "https://example.com/" + name,
+				UpdateFrequencySeconds: 3600,
+				Active:                 true,
+			},
+			Items: []rss.Item{
+				{Title: name + " old", Link: "https://example.com/" + name + "/old",
+					PubDate: now.Add(-10 * 24 * time.Hour)},
+				{Title: name + " new", Link: "https://example.com/" + name + "/new",
+					PubDate: now.Add(-time.Hour)},
+			},
+			Subscribers: subscribers,
+		}
+	}
+
+	loaded := gorsetest.Load(t, store, gorsetest.Fixture{
+		Users: []gorsetest.User{
+			{Email: "user@example.com", Password: "password"},
+		},
+		Feeds: []gorsetest.Feed{
+			feed("a", "user@example.com"),
+			feed("b", "user@example.com"),
+			feed("unsubscribed"),
+		},
+	})
+	userID := loaded.Users["user@example.com"]
+	a := loaded.Feeds["https://example.com/a"]
+	b := loaded.Feeds["https://example.com/b"]
+
+	settings := &Config{
+		URIPrefix:       "/gorse",
+		DisplayTimeZone: "UTC",
+	}
+
+	post := func(form url.Values) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodPost, "/mark_all_read",
+			strings.NewReader(form.Encode()))
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rw := httptest.NewRecorder()
+		handlerMarkAllRead(rw, request, settings, store,
+			loggedInSession(t, request, userID))
+		return rw
+	}
+
+	unreadCounts := func() map[int64]int {
+		counts, err := store.UnreadCounts(ctx, userID, time.Time{})
+		if err != nil {
+			t.Fatalf("UnreadCounts() = error %s", err)
+		}
+		return counts
+	}
+
+	tests := []struct {
+		name     string
+		form     url.Values
+		status   int
+		location string
+		a, b     int
+	}{
+		{"bad day", url.Values{"before": {"yesterday"}},
+			http.StatusBadRequest, "", 2, 2},
+		{"unknown feed", url.Values{"feed-id": {fmt.Sprintf("%d",
+			loaded.Feeds["https://example.com/unsubscribed"])}},
+			http.StatusBadRequest, "", 2, 2},
+		{"feed before a day", url.Values{
+			"feed-id": {fmt.Sprintf("%d", a)},
+			"before":  {now.AddDate(0, 0, -7).UTC().Format("2006-01-02")},
+			"sort":    {"errors"},
+			"from":    {"feeds"},
+		}, http.StatusFound, "/gorse/feeds?sort=errors", 1, 2},
+		{"feed", url.Values{"feed-id": {fmt.Sprintf("%d", a)}},
+			http.StatusFound, fmt.Sprintf("/gorse/?read-state=unread&feed-id=%d", a),
+			0, 2},
+		{"everything", url.Values{}, http.StatusFound, "/gorse/?read-state=unread",
+			0, 0},
+	}
+
+	for _, test := range tests {
+		rw := post(test.form)
+		if rw.Code != test.status {
+			t.Fatalf("%s: status = %d, wanted %d", test.name, rw.Code, test.status)
+		}
+		if location := rw.Header().Get("Location"); location != test.location {
+			t.Errorf("%s: Location = %s, wanted %s", test.name, location,
+				test.location)
+		}
+		if got := unreadCounts(); got[a] != test.a || got[b] != test.b {
+			t.Errorf("%s: UnreadCounts() = %v, wanted %d in a and %d in b",
+				test.name, got, test.a, test.b)
+		}
+	}
+}
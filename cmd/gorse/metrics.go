@@ -0,0 +1,101 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/sessions"
+	"github.com/horgh/gorse"
+)
+
+// handlerMetrics reports metrics about us in the Prometheus text format.
+//
+// It implements the type RequestHandlerFunc.
+//
+// Currently this is the state of the database connection pool. If requests
+// have to wait for connections, the pool is too small (DBMaxOpenConns) or
+// queries are slow.
+func (h HTTPHandler) handlerMetrics(rw http.ResponseWriter,
+	request *http.Request, settings *Config, store gorse.Store,
+	session *sessions.Session) {
+	rw.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+	if err := writeDBStats(rw, h.db.Stats()); err != nil {
+		logf(request, "Unable to write metrics: %s", err)
+	}
+}
+
+// writeDBStats writes the database pool's statistics in the Prometheus text
+// format.
+func writeDBStats(w io.Writer, stats sql.DBStats) error {
+	metrics := []struct {
+		name  string
+		kind  string
+		help  string
+		value float64
+	}{
+		{"gorse_db_max_open_connections", "gauge",
+			"Most connections the pool may have open. 0 is unlimited.",
+			float64(stats.MaxOpenConnections)},
+		{"gorse_db_open_connections", "gauge",
+			"Connections open, both in use and idle.",
+			float64(stats.OpenConnections)},
+		{"gorse_db_in_use_connections", "gauge",
+			"Connections in use.",
+			float64(stats.InUse)},
+		{"gorse_db_idle_connections", "gauge",
+			"Connections idle.",
+			float64(stats.Idle)},
+		{"gorse_db_wait_count_total", "counter",
+			"Times we waited for a connection.",
+			float64(stats.WaitCount)},
+		{"gorse_db_wait_duration_seconds_total", "counter",
+			"Time spent waiting for connections.",
+			stats.WaitDuration.Seconds()},
+		{"gorse_db_max_idle_closed_total", "counter",
+			"Connections closed due to the idle connection limit.",
+			float64(stats.MaxIdleClosed)},
+		{"gorse_db_max_idle_time_closed_total", "counter",
+			"Connections closed due to being idle too long.",
+			float64(stats.MaxIdleTimeClosed)},
+		{"gorse_db_max_lifetime_closed_total", "counter",
+			"Connections closed due to the connection lifetime limit.",
+			float64(stats.MaxLifetimeClosed)},
+	}
+
+	for _, m := range metrics {
+		if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s %g\n", m.name,
+			m.help, m.name, m.kind, m.name, m.value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// logDBStats logs the state of the database pool every interval if requests
+// waited for connections during it. This is forever.
+//
+// This way we hear about the pool running out of connections before requests
+// start failing.
+func logDBStats(db *sql.DB, interval time.Duration) {
+	last := db.Stats()
+
+	for range time.Tick(interval) {
+		stats := db.Stats()
+
+		if stats.WaitCount > last.WaitCount {
+			log.Printf("Database pool: %d waits for connections totalling %s in the "+
+				"last %s (open %d, in use %d, idle %d, max open %d)",
+				stats.WaitCount-last.WaitCount, stats.WaitDuration-last.WaitDuration,
+				interval, stats.OpenConnections, stats.InUse, stats.Idle,
+				stats.MaxOpenConnections)
+		}
+
+		last = stats
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteDBStats(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeDBStats(&buf, sql.DBStats{
+		MaxOpenConnections: 10,
+		OpenConnections:    4,
+		InUse:              3,
+		Idle:               1,
+		WaitCount:          7,
+		WaitDuration:       1500 * time.Millisecond,
+	}); err != nil {
+		t.Fatalf("writeDBStats() = error %s", err)
+	}
+
+	for _, want := range []string{
+		"# TYPE gorse_db_open_connections gauge\ngorse_db_open_connections 4\n",
+		"\ngorse_db_in_use_connections 3\n",
+		"# TYPE gorse_db_wait_count_total counter\ngorse_db_wait_count_total 7\n",
+		"\ngorse_db_wait_duration_seconds_total 1.5\n",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("writeDBStats() output is missing %q:\n%s", want,
+				buf.String())
+		}
+	}
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/gorilla/sessions"
+	"github.com/horgh/gorse"
+)
+
+// hideMuted sets the filter to leave out items containing phrases the user
+// muted, if they muted any. We check first because hiding them means we
+// can't count items using the unread counts. Muted regular expressions we
+// don't hide, as we mark items matching them read as they arrive.
+func hideMuted(ctx context.Context, store gorse.Store,
+	filter *gorse.ItemFilter) error {
+	mutes, err := store.ListMutedKeywords(ctx, filter.UserID)
+	if err != nil {
+		return err
+	}
+	filter.HideMuted = false
+	for _, m := range mutes {
+		if !m.Regexp {
+			filter.HideMuted = true
+			break
+		}
+	}
+	return nil
+}
+
+// muteKeyword mutes the phrase for the user with the email. option is
+// mark-read to also mark new items containing it read, regex to say the
+// phrase is a regular expression, or blank.
+func muteKeyword(ctx context.Context, settings *Config, email, phrase,
+	option string) error {
+	if option != "" && option != "mark-read" && option != "regex" {
+		return fmt.Errorf("say mark-read, regex, or nothing, not %s", option)
+	}
+
+	db, err := connectToDB(settings)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := db.Close(); err != nil {
+			log.Printf("Database close: %s", err)
+		}
+	}()
+
+	user, err := findUserByEmail(ctx, db, email)
+	if err != nil {
+		return err
+	}
+
+	return gorse.MuteKeyword(ctx, db, user.ID, phrase, option == "regex",
+		option == "mark-read")
+}
+
+// unmuteKeyword stops muting the phrase for the user with the email.
+func unmuteKeyword(ctx context.Context, settings *Config, email,
+	phrase string) error {
+	db, err := connectToDB(settings)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := db.Close(); err != nil {
+			log.Printf("Database close: %s", err)
+		}
+	}()
+
+	user, err := findUserByEmail(ctx, db, email)
+	if err != nil {
+		return err
+	}
+
+	if err := gorse.UnmuteKeyword(ctx, db, user.ID, phrase); err != nil {
+		if err == gorse.ErrNotFound {
+			return fmt.Errorf("%s did not mute %q", email, phrase)
+		}
+		return err
+	}
+	return nil
+}
+
+// listMutedKeywords writes the phrases the user with the email muted, one per
+// line.
+func listMutedKeywords(ctx context.Context, settings *Config, email string,
+	w io.Writer) error {
+	db, err := connectToDB(settings)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := db.Close(); err != nil {
+			log.Printf("Database close: %s", err)
+		}
+	}()
+
+	user, err := findUserByEmail(ctx, db, email)
+	if err != nil {
+		return err
+	}
+
+	mutes, err := gorse.ListMutedKeywords(ctx, db, user.ID)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range mutes {
+		action := "hide"
+		if m.Regexp {
+			action = "regex, mark read"
+		} else if m.MarkRead {
+			action = "mark read"
+		}
+		if _, err := fmt.Fprintf(w, "%q\t%s\n", m.Phrase, action); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// handlerMuted shows the phrases and regular expressions the user muted and
+// lets them mute and unmute them.
+//
+// It implements the type RequestHandlerFunc.
+func handlerMuted(rw http.ResponseWriter, request *http.Request,
+	settings *Config, store gorse.Store, session *sessions.Session) {
+	userID, ok := sessionUser(rw, request, settings, session)
+	if !ok {
+		return
+	}
+
+	user, err := store.GetUser(request.Context(), userID)
+	if err != nil {
+		logf(request, "Unable to look up user: %s", err)
+		send500Error(rw, "Unable to look up user")
+		return
+	}
+	locale := userLocale(request, user)
+
+	mutes, err := store.ListMutedKeywords(request.Context(), userID)
+	if err != nil {
+		logf(request, "Unable to look up muted keywords: %s", err)
+		send500Error(rw, "Unable to look up muted keywords")
+		return
+	}
+
+	type MutedPage struct {
+		Mutes            []gorse.MutedKeyword
+		MaxKeywordLength int
+		Path             string
+		UserID           int
+		ReadState        gorse.ReadState
+	}
+
+	if err := renderPage(settings, rw, locale, "_muted", MutedPage{
+		Mutes:            mutes,
+		MaxKeywordLength: gorse.MaxKeywordLength,
+		Path:             settings.URIPrefix,
+		UserID:           userID,
+		ReadState:        gorse.Unread,
+	}); err != nil {
+		logf(request, "Failure rendering page: %s", err)
+		send500Error(rw, "Failed to render page")
+		return
+	}
+}
+
+// handlerMute mutes the phrase in the form for the user. regex is 1 if it is
+// a regular expression, and mark-read is 1 to mark new items containing it
+// read.
+//
+// It implements the type RequestHandlerFunc.
+func handlerMute(rw http.ResponseWriter, request *http.Request,
+	settings *Config, store gorse.Store, session *sessions.Session) {
+	setMuted(rw, request, settings, store, session, true)
+}
+
+// handlerUnmute stops muting the phrase in the form for the user.
+//
+// It implements the type RequestHandlerFunc.
+func handlerUnmute(rw http.ResponseWriter, request *http.Request,
+	settings *Config, store gorse.Store, session *sessions.Session) {
+	setMuted(rw, request, settings, store, session, false)
+}
+
+// setMuted mutes or unmutes the phrase in the form.
+func setMuted(rw http.ResponseWriter, request *http.Request,
+	settings *Config, store gorse.Store, session *sessions.Session,
+	muted bool) {
+	if err := request.ParseForm(); err != nil {
+		logf(request, "Failed to parse form: %s", err)
+		if bodyTooLarge(err) {
+			send413Error(rw, tooLargeError(settings.maxFormBytes()))
+			return
+		}
+		send400Error(rw, "Failed to parse request")
+		return
+	}
+
+	userID, ok := sessionUser(rw, request, settings, session)
+	if !ok {
+		return
+	}
+
+	phrase := request.PostForm.Get("phrase")
+	isRegexp := request.PostForm.Get("regex") == "1"
+
+	var err error
+	if muted && isRegexp {
+		_, err = gorse.NormalizeMutedRegexp(phrase)
+	} else {
+		_, err = gorse.NormalizeKeyword(phrase)
+	}
+	if err != nil {
+		logf(request, "Bad phrase: %s", err)
+		send400Error(rw, fmt.Sprintf("Bad phrase: %s", err))
+		return
+	}
+
+	ctx := gorse.WithActor(request.Context(), userID)
+
+	if muted {
+		err = store.MuteKeyword(ctx, userID, phrase, isRegexp,
+			request.PostForm.Get("mark-read") == "1")
+	} else {
+		err = store.UnmuteKeyword(ctx, userID, phrase)
+	}
+	if err != nil {
+		if err == gorse.ErrNotFound {
+			logf(request, "User %d did not mute %q", userID, phrase)
+			send400Error(rw, "Unknown phrase")
+			return
+		}
+		logf(request, "Unable to set whether %q is muted: %s", phrase, err)
+		send500Error(rw, "Unable to update muted phrases")
+		return
+	}
+
+	logf(request, "Set %q muted: %t", phrase, muted)
+
+	uri := settings.URIPrefix + "/muted"
+
+	logf(request, "Redirecting to %s", uri)
+
+	http.Redirect(rw, request, uri, http.StatusFound)
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/sessions"
+	"github.com/horgh/gorse"
+	"github.com/horgh/gorse/internal/gorsetest"
+)
+
+func TestHandlerMuteIntegration(t *testing.T) {
+	for _, dbType := range gorsetest.Types {
+		t.Run(dbType, func(t *testing.T) {
+			testHandlerMuteIntegration(t, dbType)
+		})
+	}
+}
+
+func testHandlerMuteIntegration(t *testing.T, dbType string) {
+	ctx := context.Background()
+	store, _ := gorsetest.Store(t, dbType)
+
+	loaded := gorsetest.Load(t, store, gorsetest.Fixture{
+		Users: []gorsetest.User{
+			{Email: "user@example.com", Password: "password"},
+		},
+	})
+	userID := loaded.Users["user@example.com"]
+
+	settings := &Config{
+		URIPrefix:       "/gorse",
+		DisplayTimeZone: "UTC",
+		WebRoot:         "static",
+		TemplateDir:     "templates",
+	}
+
+	type handlerFunc func(http.ResponseWriter, *http.Request, *Config,
+		gorse.Store, *sessions.Session)
+
+	post := func(handler handlerFunc,
+		form url.Values) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodPost, "/mute",
+			strings.NewReader(form.Encode()))
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rw := httptest.NewRecorder()
+		handler(rw, request, settings, store, loggedInSession(t, request, userID))
+		return rw
+	}
+	mutedPage := func() string {
+		request := httptest.NewRequest(http.MethodGet, "/muted", nil)
+		rw := httptest.NewRecorder()
+		handlerMuted(rw, request, settings, store,
+			loggedInSession(t, request, userID))
+		if rw.Code != http.StatusOK {
+			t.Fatalf("GET /muted = status %d: %q, wanted %d", rw.Code,
+				rw.Body.String(), http.StatusOK)
+		}
+		return rw.Body.String()
+	}
+
+	for _, form := range []url.Values{
+		{"phrase": {" "}},
+		{"phrase": {strings.Repeat("x", gorse.MaxKeywordLength+1)}},
+		{"phrase": {"("}, "regex": {"1"}},
+	} {
+		if rw := post(handlerMute, form); rw.Code != http.StatusBadRequest {
+			t.Errorf("%v: status = %d, wanted %d", form, rw.Code,
+				http.StatusBadRequest)
+		}
+	}
+
+	for _, form := range []url.Values{
+		{"phrase": {"Big Story"}},
+		{"phrase": {`^Sponsored\b`}, "regex": {"1"}},
+	} {
+		rw := post(handlerMute, form)
+		if rw.Code != http.StatusFound {
+			t.Fatalf("%v: status = %d: %q, wanted %d", form, rw.Code,
+				rw.Body.String(), http.StatusFound)
+		}
+		if location := rw.Header().Get("Location"); location != "/gorse/muted" {
+			t.Errorf("Location = %s, wanted /gorse/muted", location)
+		}
+	}
+
+	mutes, err := store.ListMutedKeywords(ctx, userID)
+	if err != nil {
+		t.Fatalf("ListMutedKeywords() = error %s", err)
+	}
+	got := map[string]bool{}
+	for _, m := range mutes {
+		if m.Regexp != m.MarkRead {
+			t.Errorf("%q: regular expression %t, mark read %t, wanted the same",
+				m.Phrase, m.Regexp, m.MarkRead)
+		}
+		got[m.Phrase] = m.Regexp
+	}
+	if want := map[string]bool{"big story": false,
+		`^Sponsored\b`: true}; !reflect.DeepEqual(got, want) {
+		t.Errorf("muted %v, wanted %v", got, want)
+	}
+
+	body := mutedPage()
+	if !strings.Contains(body, "big story") ||
+		!strings.Contains(body, `<code>^Sponsored\b</code>`) {
+		t.Errorf("muted page = %q, wanted the phrases", body)
+	}
+
+	if rw := post(handlerUnmute, url.Values{
+		"phrase": {`^Sponsored\b`},
+	}); rw.Code != http.StatusFound {
+		t.Fatalf("status = %d, wanted %d", rw.Code, http.StatusFound)
+	}
+	if rw := post(handlerUnmute, url.Values{
+		"phrase": {`^Sponsored\b`},
+	}); rw.Code != http.StatusBadRequest {
+		t.Errorf("unmuting again: status = %d, wanted %d", rw.Code,
+			http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/sessions"
+	"github.com/horgh/gorse"
+)
+
+// nextItemJSON is an item as handlerNext describes it.
+type nextItemJSON struct {
+	ID              int64     `json:"id"`
+	FeedName        string    `json:"feed_name"`
+	Title           string    `json:"title"`
+	Link            string    `json:"link"`
+	PublicationDate time.Time `json:"publication_date"`
+	Description     string    `json:"description"`
+}
+
+// handlerNext lets a client show unread items one at a time, such as with a
+// key to go to the next. It marks the item the user is on read and responds
+// with the next unread item and how many are left:
+//
+//	{"item": {"id": 3, "feed_name": "Example", "title": "...", "link": "...",
+//	 "publication_date": "...", "description": "..."}, "unread": 12}
+//
+// item is null if there are no more.
+//
+// It implements the type RequestHandlerFunc.
+//
+// The request has the item-id of the item the user is on, which is blank to
+// start. order is newest (the default) or oldest, the order to go through the
+// items in. feed-id and highlights=1 limit us to items as handlerRandom does.
+//
+// The next item is the one after the current one in the order, so items
+// arriving or being read elsewhere don't make us skip any or go back. Once we
+// reach the end we start again from the beginning to pick up any we passed.
+// We do it all in one transaction so that what we say is unread is.
+func handlerNext(rw http.ResponseWriter, request *http.Request,
+	settings *Config, store gorse.Store, session *sessions.Session) {
+	if err := request.ParseForm(); err != nil {
+		logf(request, "Failed to parse form: %s", err)
+		if bodyTooLarge(err) {
+			sendJSONError(rw, http.StatusRequestEntityTooLarge,
+				tooLargeError(settings.maxFormBytes()))
+			return
+		}
+		sendJSONError(rw, http.StatusBadRequest, "Failed to parse request")
+		return
+	}
+
+	userID, ok := sessionUserJSON(rw, request, session)
+	if !ok {
+		return
+	}
+
+	var err error
+
+	var itemID int64
+	if itemIDStr := request.PostForm.Get("item-id"); itemIDStr != "" {
+		itemID, err = strconv.ParseInt(itemIDStr, 10, 64)
+		if err != nil {
+			logf(request, "Bad item ID: %s: %s", itemIDStr, err)
+			sendJSONError(rw, http.StatusBadRequest, "Bad item ID")
+			return
+		}
+	}
+
+	unread := gorse.Unread
+	filter := gorse.ItemFilter{
+		UserID:      userID,
+		State:       &unread,
+		Since:       unreadCutoff(),
+		Highlighted: request.PostForm.Get("highlights") == "1",
+		Subscribed:  true,
+	}
+
+	switch order := request.PostForm.Get("order"); order {
+	case "", "newest":
+	case "oldest":
+		filter.OldestFirst = true
+	default:
+		logf(request, "Bad order: %s", order)
+		sendJSONError(rw, http.StatusBadRequest, "Bad order")
+		return
+	}
+
+	if feedIDStr := request.PostForm.Get("feed-id"); feedIDStr != "" {
+		feedID, err := strconv.ParseInt(feedIDStr, 10, 64)
+		if err != nil || feedID <= 0 {
+			logf(request, "Bad feed ID: %s", feedIDStr)
+			sendJSONError(rw, http.StatusBadRequest, "Bad feed ID")
+			return
+		}
+		filter.FeedID = feedID
+	}
+
+	ctx := gorse.WithActor(request.Context(), userID)
+
+	if err := hideMuted(ctx, store, &filter); err != nil {
+		logf(request, "Unable to look up muted keywords: %s", err)
+		sendJSONError(rw, http.StatusInternalServerError,
+			"Unable to look up muted keywords")
+		return
+	}
+
+	if itemID != 0 {
+		if _, err := store.GetItem(ctx, itemID, userID); err != nil {
+			logf(request, "Unable to look up item %d: %s", itemID, err)
+			sendJSONError(rw, http.StatusBadRequest, "Unknown item")
+			return
+		}
+	}
+
+	var next *gorse.UserItem
+	var count int
+	if err := store.InTx(ctx, func(store gorse.Store) error {
+		var err error
+		next, count, err = nextItem(ctx, store, itemID, filter)
+		return err
+	}); err != nil {
+		logf(request, "Unable to go to the next item: %s", err)
+		sendJSONError(rw, http.StatusInternalServerError,
+			"Unable to go to the next item")
+		return
+	}
+
+	var item *nextItemJSON
+	if next != nil {
+		item = &nextItemJSON{
+			ID:              next.ID,
+			FeedName:        next.FeedName,
+			Title:           sanitiseItemText(next.Title),
+			Link:            next.Link,
+			PublicationDate: next.PublicationDate,
+			Description: string(itemDescription(gorse.DisplayFull,
+				next.Description)),
+		}
+		logf(request, "Next item is %d of %d unread", next.ID, count)
+	} else {
+		logf(request, "No more unread items")
+	}
+
+	sendJSON(request, rw, http.StatusOK, struct {
+		Item   *nextItemJSON `json:"item"`
+		Unread int           `json:"unread"`
+	}{item, count})
+}
+
+// nextItem marks the item read, if it's unread and not 0, and finds the
+// unread item after it. It also counts the unread items. It's nil if there
+// are none.
+func nextItem(ctx context.Context, store gorse.Store, itemID int64,
+	filter gorse.ItemFilter) (*gorse.UserItem, int, error) {
+	if itemID != 0 {
+		item, err := store.GetItem(ctx, itemID, filter.UserID)
+		if err != nil {
+			return nil, -1, err
+		}
+		if item.ReadState == gorse.Unread {
+			if err := markItemsRead(ctx, store, []int64{itemID},
+				filter.UserID); err != nil {
+				return nil, -1, err
+			}
+		}
+		cursor := item.Cursor()
+		filter.After = &cursor
+	}
+
+	count, err := store.CountItems(ctx, filter)
+	if err != nil {
+		return nil, -1, err
+	}
+	if count == 0 {
+		return nil, 0, nil
+	}
+
+	filter.Limit = 1
+	items, err := store.FindItems(ctx, filter)
+	if err != nil {
+		return nil, -1, err
+	}
+
+	// We're at the end. Start again.
+	if len(items) == 0 && filter.After != nil {
+		filter.After = nil
+		if items, err = store.FindItems(ctx, filter); err != nil {
+			return nil, -1, err
+		}
+	}
+
+	if len(items) == 0 {
+		return nil, count, nil
+	}
+	return &items[0], count, nil
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/sessions"
+	"github.com/horgh/gorse"
+	"github.com/horgh/gorse/internal/gorsetest"
+	"github.com/horgh/rss"
+)
+
+func TestHandlerNextIntegration(t *testing.T) {
+	for _, dbType := range gorsetest.Types {
+		t.Run(dbType, func(t *testing.T) {
+			testHandlerNextIntegration(t, dbType)
+		})
+	}
+}
+
+func testHandlerNextIntegration(t *testing.T, dbType string) {
+	store, _ := gorsetest.Store(t, dbType)
+
+	now := time.Now()
+	loaded := gorsetest.Load(t, store, gorsetest.Fixture{
+		Users: []gorsetest.User{
+			{Email: "user@example.com", Password: "password"},
+		},
+		Feeds: []gorsetest.Feed{
+			{
+				DBFeed: gorse.DBFeed{
+					Name:                   "Example",
+					URI:                    "https://example.com/feed",
+					UpdateFrequencySeconds: 3600,
+					Active:                 true,
+				},
+				Items: []rss.Item{
+					{Title: "A", Link: "https://example.com/a",
+						Description: "<p>First</p>", PubDate: now.Add(-3 * time.Hour)},
+					{Title: "B", Link: "https://example.com/b",
+						PubDate: now.Add(-2 * time.Hour)},
+					{Title: "C", Link: "https://example.com/c",
+						PubDate: now.Add(-time.Hour)},
+				},
+				Subscribers: []string{"user@example.com"},
+			},
+		},
+	})
+	userID := loaded.Users["user@example.com"]
+	ids := map[int64]string{}
+	for link, id := range loaded.Items {
+		ids[id] = link
+	}
+
+	settings := &Config{}
+	sessionStore := sessions.NewCookieStore([]byte(strings.Repeat("k", 32)))
+
+	post := func(form url.Values) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodPost, "/next",
+			strings.NewReader(form.Encode()))
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		session, err := sessionStore.New(request, "gorse")
+		if err != nil {
+			t.Fatalf("creating session: %s", err)
+		}
+		session.Values[sessionUserKey] = userID
+		rw := httptest.NewRecorder()
+		handlerNext(rw, request, settings, store, session)
+		return rw
+	}
+
+	current := ""
+	tests := []struct {
+		order  string
+		link   string
+		unread int
+	}{
+		{"oldest", "https://example.com/a", 3},
+		{"oldest", "https://example.com/b", 2},
+		// After B, newest first, there's only A, which we read. We start again.
+		{"newest", "https://example.com/c", 1},
+		{"newest", "", 0},
+	}
+	for _, test := range tests {
+		form := url.Values{"order": {test.order}}
+		if current != "" {
+			form.Set("item-id", fmt.Sprintf("%d", loaded.Items[current]))
+		}
+		rw := post(form)
+		if rw.Code != http.StatusOK {
+			t.Fatalf("POST %v = status %d: %s, wanted %d", form, rw.Code,
+				rw.Body.String(), http.StatusOK)
+		}
+
+		var response struct {
+			Item *struct {
+				ID          int64  `json:"id"`
+				Title       string `json:"title"`
+				Description string `json:"description"`
+			} `json:"item"`
+			Unread int `json:"unread"`
+		}
+		if err := json.Unmarshal(rw.Body.Bytes(), &response); err != nil {
+			t.Fatalf("POST %v = %s: %s", form, rw.Body.String(), err)
+		}
+
+		link := ""
+		if response.Item != nil {
+			link = ids[response.Item.ID]
+		}
+		if link != test.link || response.Unread != test.unread {
+			t.Fatalf("POST %v = %s, wanted %s with %d unread", form,
+				rw.Body.String(), test.link, test.unread)
+		}
+		if link == "https://example.com/a" && response.Item.Description != "First" {
+			t.Errorf("description = %q, wanted First", response.Item.Description)
+		}
+		current = link
+	}
+
+	for _, form := range []url.Values{
+		{"order": {"random"}},
+		{"item-id": {"999999"}},
+		{"feed-id": {"x"}},
+	} {
+		if rw := post(form); rw.Code != http.StatusBadRequest {
+			t.Errorf("POST %v = status %d, wanted %d", form, rw.Code,
+				http.StatusBadRequest)
+		}
+	}
+}
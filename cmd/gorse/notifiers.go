@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/horgh/gorse"
+	"github.com/horgh/gorse/internal/notify"
+)
+
+// parseNotifier makes a notifier posting to the service from settings such
+// as chat-id=123. See the add-notifier command. feed is the URI of the feed
+// to post the items of, which we leave to the caller to look up.
+func parseNotifier(service string, settings []string) (gorse.Notifier,
+	string, error) {
+	n := gorse.Notifier{Service: service}
+	feed := ""
+
+	for _, setting := range settings {
+		i := strings.Index(setting, "=")
+		if i == -1 {
+			return gorse.Notifier{}, "", fmt.Errorf(
+				"setting must be in the form key=value: %s", setting)
+		}
+		key, value := setting[:i], setting[i+1:]
+
+		switch key {
+		case "feed":
+			feed = value
+		case "match":
+			n.Match = value
+		case "url":
+			n.URL = value
+		case "token":
+			n.Token = value
+		case "chat-id":
+			n.ChatID = value
+		default:
+			return gorse.Notifier{}, "", fmt.Errorf("unknown setting: %s", key)
+		}
+	}
+
+	if err := notify.Check(n); err != nil {
+		return gorse.Notifier{}, "", err
+	}
+
+	return n, feed, nil
+}
+
+// addNotifier has us post new items to a chat for the user with the email.
+// settings are as parseNotifier takes.
+func addNotifier(ctx context.Context, settings *Config, email,
+	service string, notifierSettings []string, w io.Writer) error {
+	n, feedURI, err := parseNotifier(service, notifierSettings)
+	if err != nil {
+		return err
+	}
+
+	db, err := connectToDB(settings)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := db.Close(); err != nil {
+			log.Printf("Database close: %s", err)
+		}
+	}()
+
+	user, err := findUserByEmail(ctx, db, email)
+	if err != nil {
+		return err
+	}
+	n.UserID = user.ID
+
+	if feedURI != "" {
+		feed, err := gorse.GetFeedByURI(ctx, db, feedURI)
+		if err != nil {
+			if err == gorse.ErrNotFound {
+				return fmt.Errorf("there is no feed %s", feedURI)
+			}
+			return err
+		}
+		n.FeedID = feed.ID
+	}
+
+	id, err := gorse.AddNotifier(ctx, db, n)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "Added notifier %d.\n", id)
+	return err
+}
+
+// listNotifiers writes the notifiers of the user with the email, one per
+// line. We leave out their tokens.
+func listNotifiers(ctx context.Context, settings *Config, email string,
+	w io.Writer) error {
+	db, err := connectToDB(settings)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := db.Close(); err != nil {
+			log.Printf("Database close: %s", err)
+		}
+	}()
+
+	user, err := findUserByEmail(ctx, db, email)
+	if err != nil {
+		return err
+	}
+
+	notifiers, err := gorse.ListNotifiers(ctx, db, user.ID)
+	if err != nil {
+		return err
+	}
+
+	for _, n := range notifiers {
+		feed := "any feed"
+		if n.FeedID != 0 {
+			feed = fmt.Sprintf("feed %d", n.FeedID)
+		}
+		match := "every item"
+		if n.Match != "" {
+			match = fmt.Sprintf("items matching %q", n.Match)
+		}
+		if _, err := fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", n.ID,
+			notify.Name(n.Service), feed, match); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// removeNotifier stops us posting to a chat for the user with the email.
+func removeNotifier(ctx context.Context, settings *Config, email,
+	idStr string) error {
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid notifier ID: %s", idStr)
+	}
+
+	db, err := connectToDB(settings)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := db.Close(); err != nil {
+			log.Printf("Database close: %s", err)
+		}
+	}()
+
+	user, err := findUserByEmail(ctx, db, email)
+	if err != nil {
+		return err
+	}
+
+	if err := gorse.DeleteNotifier(ctx, db, user.ID, id); err != nil {
+		if err == gorse.ErrNotFound {
+			return fmt.Errorf("%s has no notifier %d", email, id)
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/horgh/gorse"
+)
+
+func TestParseNotifier(t *testing.T) {
+	tests := []struct {
+		Service  string
+		Settings []string
+		Want     gorse.Notifier
+		WantFeed string
+		OK       bool
+	}{
+		{
+			"telegram",
+			[]string{"token=123:abc", "chat-id=-100", "match=go 1.x=y"},
+			gorse.Notifier{Service: "telegram", Token: "123:abc", ChatID: "-100",
+				Match: "go 1.x=y"},
+			"",
+			true,
+		},
+		{
+			"slack",
+			[]string{"url=https://hooks.slack.com/x", "feed=https://example.com/f"},
+			gorse.Notifier{Service: "slack", URL: "https://hooks.slack.com/x"},
+			"https://example.com/f",
+			true,
+		},
+		{"slack", nil, gorse.Notifier{}, "", false},
+		{"telegram", []string{"token"}, gorse.Notifier{}, "", false},
+		{"slack", []string{"url=https://hooks.slack.com/x", "colour=red"},
+			gorse.Notifier{}, "", false},
+		{"irc", []string{"url=https://example.com"}, gorse.Notifier{}, "", false},
+	}
+
+	for _, test := range tests {
+		got, feed, err := parseNotifier(test.Service, test.Settings)
+		if !test.OK {
+			if err == nil {
+				t.Errorf("parseNotifier(%s, %q) succeeded, wanted an error",
+					test.Service, test.Settings)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseNotifier(%s, %q) = error %s", test.Service,
+				test.Settings, err)
+			continue
+		}
+		if got != test.Want || feed != test.WantFeed {
+			t.Errorf("parseNotifier(%s, %q) = %+v, %s, wanted %+v, %s",
+				test.Service, test.Settings, got, feed, test.Want, test.WantFeed)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/horgh/gorse"
+	"github.com/horgh/gorse/internal/poll"
+)
+
+// pollFeeds polls the feeds every interval as gorsepoll does when run from
+// cron. This lets a single process serve and poll. We poll until the context
+// ends. concurrency is how many hosts we poll at once, and dbTimeout how
+// long we wait on the database to record a feed.
+func pollFeeds(ctx context.Context, store gorse.Store,
+	interval time.Duration, concurrency int64, dbTimeout time.Duration) {
+	// Log only problems. Requests are logged to the same place.
+	config := &poll.Config{
+		Quiet:       1,
+		Concurrency: concurrency,
+		DBTimeout:   dbTimeout,
+	}
+
+	log.Printf("Polling feeds every %s", interval)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		feedsCtx, cancel := poll.WithDBTimeout(ctx, config)
+		feeds, err := store.ActiveFeeds(feedsCtx)
+		cancel()
+		if err != nil {
+			log.Printf("Unable to retrieve feeds to poll: %s", err)
+		} else if err := poll.ProcessFeeds(ctx, config, store, feeds, false,
+			false); err != nil {
+			log.Printf("Failed to poll feeds: %s", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
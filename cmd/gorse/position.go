@@ -0,0 +1,146 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gorilla/sessions"
+	"github.com/horgh/gorse"
+)
+
+// Our pages record where the user is in a list of items as they scroll, and
+// go back there when they open the list again, such as on another device.
+// These endpoints record and tell where they were. We respond with JSON.
+//
+// A view names the list, such as unread or read-later. The position is the
+// item at the top of the user's screen and how far past its top they were.
+
+// readingPositionJSON is how we describe a reading position:
+//
+//	{"view": "unread", "item_id": 12, "offset": 40,
+//	 "update_time": "2020-03-01T14:05:00Z"}
+type readingPositionJSON struct {
+	View       string    `json:"view"`
+	ItemID     int64     `json:"item_id"`
+	Offset     int       `json:"offset"`
+	UpdateTime time.Time `json:"update_time"`
+}
+
+// handlerGetPosition tells where the user was in the view. If we don't know,
+// we respond 404.
+//
+// It implements the type RequestHandlerFunc.
+func handlerGetPosition(rw http.ResponseWriter, request *http.Request,
+	settings *Config, store gorse.Store, session *sessions.Session) {
+	userID, ok := sessionUserJSON(rw, request, session)
+	if !ok {
+		return
+	}
+
+	view := request.URL.Query().Get("view")
+	if !validView(view) {
+		logf(request, "Bad view: %s", view)
+		sendJSONError(rw, http.StatusBadRequest, "Bad view")
+		return
+	}
+
+	position, err := store.GetReadingPosition(request.Context(), userID, view)
+	if err != nil {
+		if err == gorse.ErrNotFound {
+			sendJSONError(rw, http.StatusNotFound, "No position")
+			return
+		}
+		logf(request, "Unable to look up reading position: %s", err)
+		sendJSONError(rw, http.StatusInternalServerError,
+			"Unable to look up position")
+		return
+	}
+
+	sendJSON(request, rw, http.StatusOK, readingPositionJSON{
+		View:       position.View,
+		ItemID:     position.ItemID,
+		Offset:     position.Offset,
+		UpdateTime: position.UpdateTime,
+	})
+}
+
+// handlerSetPosition records where the user is in the view. The form has the
+// view, item-id, and offset. We respond with the position.
+//
+// It implements the type RequestHandlerFunc.
+func handlerSetPosition(rw http.ResponseWriter, request *http.Request,
+	settings *Config, store gorse.Store, session *sessions.Session) {
+	if err := request.ParseForm(); err != nil {
+		logf(request, "Failed to parse form: %s", err)
+		if bodyTooLarge(err) {
+			sendJSONError(rw, http.StatusRequestEntityTooLarge,
+				tooLargeError(settings.maxFormBytes()))
+			return
+		}
+		sendJSONError(rw, http.StatusBadRequest, "Failed to parse request")
+		return
+	}
+
+	userID, ok := sessionUserJSON(rw, request, session)
+	if !ok {
+		return
+	}
+
+	view := request.PostForm.Get("view")
+	if !validView(view) {
+		logf(request, "Bad view: %s", view)
+		sendJSONError(rw, http.StatusBadRequest, "Bad view")
+		return
+	}
+
+	itemIDStr := request.PostForm.Get("item-id")
+	itemID, err := strconv.ParseInt(itemIDStr, 10, 64)
+	if err != nil {
+		logf(request, "Bad item ID: %s: %s", itemIDStr, err)
+		sendJSONError(rw, http.StatusBadRequest, "Bad item ID")
+		return
+	}
+
+	offsetStr := request.PostForm.Get("offset")
+	offset, err := strconv.Atoi(offsetStr)
+	if err != nil || offset < 0 {
+		logf(request, "Bad offset: %s", offsetStr)
+		sendJSONError(rw, http.StatusBadRequest, "Bad offset")
+		return
+	}
+
+	if _, err := store.GetItem(request.Context(), itemID, userID); err != nil {
+		logf(request, "Unable to look up item %d: %s", itemID, err)
+		sendJSONError(rw, http.StatusBadRequest, "Unknown item")
+		return
+	}
+
+	position := gorse.ReadingPosition{
+		UserID:     userID,
+		View:       view,
+		ItemID:     itemID,
+		Offset:     offset,
+		UpdateTime: time.Now().UTC(),
+	}
+	if err := store.SetReadingPosition(request.Context(),
+		position); err != nil {
+		logf(request, "Unable to set reading position: %s", err)
+		sendJSONError(rw, http.StatusInternalServerError,
+			"Unable to record position")
+		return
+	}
+
+	sendJSON(request, rw, http.StatusOK, readingPositionJSON{
+		View:       position.View,
+		ItemID:     position.ItemID,
+		Offset:     position.Offset,
+		UpdateTime: position.UpdateTime,
+	})
+}
+
+// validView checks the name of a view is one we keep positions for.
+func validView(view string) bool {
+	return view != "" && utf8.RuneCountInString(view) <= gorse.MaxViewLength
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/sessions"
+	"github.com/horgh/gorse"
+	"github.com/horgh/gorse/internal/gorsetest"
+	"github.com/horgh/rss"
+)
+
+func TestHandlerPositionIntegration(t *testing.T) {
+	for _, dbType := range gorsetest.Types {
+		t.Run(dbType, func(t *testing.T) {
+			testHandlerPositionIntegration(t, dbType)
+		})
+	}
+}
+
+func testHandlerPositionIntegration(t *testing.T, dbType string) {
+	store, _ := gorsetest.Store(t, dbType)
+
+	loaded := gorsetest.Load(t, store, gorsetest.Fixture{
+		Users: []gorsetest.User{
+			{Email: "user@example.com", Password: "password"},
+		},
+		Feeds: []gorsetest.Feed{
+			{
+				DBFeed: gorse.DBFeed{
+					Name:                   "Example",
+					URI:                    "https://example.com/feed",
+					UpdateFrequencySeconds: 3600,
+					Active:                 true,
+				},
+				Items: []rss.Item{
+					{Title: "One", Link: "https://example.com/1", PubDate: time.Now()},
+				},
+				Subscribers: []string{"user@example.com"},
+			},
+		},
+	})
+	userID := loaded.Users["user@example.com"]
+	itemID := loaded.Items["https://example.com/1"]
+
+	settings := &Config{}
+	sessionStore := sessions.NewCookieStore([]byte(strings.Repeat("k", 32)))
+
+	serve := func(handler func(http.ResponseWriter, *http.Request, *Config,
+		gorse.Store, *sessions.Session), method, path string,
+		form url.Values) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(method, path,
+			strings.NewReader(form.Encode()))
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		session, err := sessionStore.New(request, "gorse")
+		if err != nil {
+			t.Fatalf("creating session: %s", err)
+		}
+		session.Values[sessionUserKey] = userID
+		rw := httptest.NewRecorder()
+		handler(rw, request, settings, store, session)
+		return rw
+	}
+
+	getPath := "/position?view=unread"
+
+	if rw := serve(handlerGetPosition, http.MethodGet, getPath,
+		nil); rw.Code != http.StatusNotFound {
+		t.Errorf("GET before recording = status %d, wanted %d", rw.Code,
+			http.StatusNotFound)
+	}
+
+	bad := []url.Values{
+		{"item-id": {fmt.Sprintf("%d", itemID)}, "offset": {"1"}},
+		{"view": {"unread"}, "item-id": {fmt.Sprintf("%d", itemID)},
+			"offset": {"-1"}},
+		{"view": {"unread"}, "item-id": {"999999"}, "offset": {"1"}},
+		{"view": {strings.Repeat("v", 101)},
+			"item-id": {fmt.Sprintf("%d", itemID)}, "offset": {"1"}},
+	}
+	for _, form := range bad {
+		if rw := serve(handlerSetPosition, http.MethodPost, "/position",
+			form); rw.Code != http.StatusBadRequest {
+			t.Errorf("POST %v = status %d, wanted %d", form, rw.Code,
+				http.StatusBadRequest)
+		}
+	}
+
+	rw := serve(handlerSetPosition, http.MethodPost, "/position", url.Values{
+		"view":    {"unread"},
+		"item-id": {fmt.Sprintf("%d", itemID)},
+		"offset":  {"120"},
+	})
+	if rw.Code != http.StatusOK {
+		t.Fatalf("POST = status %d, wanted %d: %s", rw.Code, http.StatusOK,
+			rw.Body.String())
+	}
+
+	rw = serve(handlerGetPosition, http.MethodGet, getPath, nil)
+	if rw.Code != http.StatusOK {
+		t.Fatalf("GET = status %d, wanted %d", rw.Code, http.StatusOK)
+	}
+	var position readingPositionJSON
+	if err := json.Unmarshal(rw.Body.Bytes(), &position); err != nil {
+		t.Fatalf("GET = %s, wanted JSON: %s", rw.Body.String(), err)
+	}
+	if position.View != "unread" || position.ItemID != itemID ||
+		position.Offset != 120 || position.UpdateTime.IsZero() {
+		t.Errorf("GET = %+v, wanted the position recorded", position)
+	}
+}
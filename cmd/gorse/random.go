@@ -0,0 +1,107 @@
+package main
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/sessions"
+	"github.com/horgh/gorse"
+)
+
+// handlerRandom redirects to the reader view of one of the user's unread
+// items, chosen at random. It's a way to chip away at a large backlog.
+//
+// It implements the type RequestHandlerFunc.
+//
+// feed-id limits us to that feed's items and highlights=1 to items with
+// phrases the user highlights. Like the list of unread items, we leave out
+// muted items. If there are no items, we go back to the list.
+func handlerRandom(rw http.ResponseWriter, request *http.Request,
+	settings *Config, store gorse.Store, session *sessions.Session) {
+	requestValues := request.URL.Query()
+
+	userID, ok := sessionUser(rw, request, settings, session)
+	if !ok {
+		return
+	}
+
+	unread := gorse.Unread
+	filter := gorse.ItemFilter{
+		UserID:      userID,
+		State:       &unread,
+		Since:       unreadCutoff(),
+		Highlighted: requestValues.Get("highlights") == "1",
+		Subscribed:  true,
+	}
+
+	if feedIDStr := requestValues.Get("feed-id"); feedIDStr != "" {
+		feedID, err := strconv.ParseInt(feedIDStr, 10, 64)
+		if err != nil || feedID <= 0 {
+			logf(request, "Bad feed ID: %s", feedIDStr)
+			send400Error(rw, "Bad feed ID")
+			return
+		}
+		filter.FeedID = feedID
+	}
+
+	if err := hideMuted(request.Context(), store, &filter); err != nil {
+		logf(request, "Unable to look up muted keywords: %s", err)
+		send500Error(rw, "Unable to look up muted keywords")
+		return
+	}
+
+	count, err := store.CountItems(request.Context(), filter)
+	if err != nil {
+		logf(request, "Unable to count unread items: %s", err)
+		send500Error(rw, "Unable to count items")
+		return
+	}
+
+	if count == 0 {
+		logf(request, "No unread items to choose from.")
+		session.AddFlash("No unread items found.")
+		if err := session.Save(request, rw); err != nil {
+			logf(request, "Unable to save session: %s", err)
+			send500Error(rw, "Failed to save your session.")
+			return
+		}
+		uri := settings.URIPrefix + "/"
+		logf(request, "Redirecting to %s", uri)
+		http.Redirect(rw, request, uri, http.StatusFound)
+		return
+	}
+
+	offset, err := rand.Int(rand.Reader, big.NewInt(int64(count)))
+	if err != nil {
+		logf(request, "Unable to choose an item: %s", err)
+		send500Error(rw, "Unable to choose an item")
+		return
+	}
+	filter.Limit = 1
+	filter.Offset = int(offset.Int64())
+
+	items, err := store.FindItems(request.Context(), filter)
+	if err != nil {
+		logf(request, "Unable to retrieve unread item: %s", err)
+		send500Error(rw, "Unable to retrieve items")
+		return
+	}
+
+	// The item we chose may have gone since we counted, such as if the user
+	// read it elsewhere. Trying again finds another.
+	if len(items) == 0 {
+		logf(request, "Item %d of %d is gone. Trying again.", filter.Offset,
+			count)
+		http.Redirect(rw, request, settings.URIPrefix+"/random?"+
+			request.URL.RawQuery, http.StatusFound)
+		return
+	}
+
+	uri := fmt.Sprintf("%s/reader?item-id=%d", settings.URIPrefix,
+		items[0].ID)
+	logf(request, "Redirecting to %s", uri)
+	http.Redirect(rw, request, uri, http.StatusFound)
+}
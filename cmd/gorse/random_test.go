@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/sessions"
+	"github.com/horgh/gorse"
+	"github.com/horgh/gorse/internal/gorsetest"
+	"github.com/horgh/rss"
+)
+
+func TestHandlerRandomIntegration(t *testing.T) {
+	for _, dbType := range gorsetest.Types {
+		t.Run(dbType, func(t *testing.T) {
+			testHandlerRandomIntegration(t, dbType)
+		})
+	}
+}
+
+func testHandlerRandomIntegration(t *testing.T, dbType string) {
+	ctx := context.Background()
+	store, _ := gorsetest.Store(t, dbType)
+
+	now := time.Now()
+	loaded := gorsetest.Load(t, store, gorsetest.Fixture{
+		Users: []gorsetest.User{
+			{Email: "user@example.com", Password: "password"},
+		},
+		Feeds: []gorsetest.Feed{
+			{
+				DBFeed: gorse.DBFeed{
+					Name:                   "One",
+					URI:                    "https://one.example.com/feed",
+					UpdateFrequencySeconds: 3600,
+					Active:                 true,
+				},
+				Items: []rss.Item{
+					{Title: "A", Link: "https://one.example.com/a",
+						PubDate: now.Add(-time.Hour)},
+					{Title: "B", Link: "https://one.example.com/b",
+						PubDate: now.Add(-2 * time.Hour)},
+				},
+				Subscribers: []string{"user@example.com"},
+			},
+			{
+				DBFeed: gorse.DBFeed{
+					Name:                   "Two",
+					URI:                    "https://two.example.com/feed",
+					UpdateFrequencySeconds: 3600,
+					Active:                 true,
+				},
+				Items: []rss.Item{
+					{Title: "C", Link: "https://two.example.com/c",
+						PubDate: now.Add(-time.Hour)},
+				},
+				Subscribers: []string{"user@example.com"},
+			},
+		},
+	})
+	userID := loaded.Users["user@example.com"]
+	two := loaded.Feeds["https://two.example.com/feed"]
+	itemC := loaded.Items["https://two.example.com/c"]
+
+	settings := &Config{URIPrefix: "/gorse"}
+	sessionStore := sessions.NewCookieStore([]byte(strings.Repeat("k", 32)))
+
+	get := func(query string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodGet,
+			"/random?"+query, nil)
+		session, err := sessionStore.New(request, "gorse")
+		if err != nil {
+			t.Fatalf("creating session: %s", err)
+		}
+		session.Values[sessionUserKey] = userID
+		rw := httptest.NewRecorder()
+		handlerRandom(rw, request, settings, store, session)
+		return rw
+	}
+
+	// Each unread item comes up.
+	seen := map[string]bool{}
+	for i := 0; i < 100 && len(seen) < 3; i++ {
+		rw := get("")
+		if rw.Code != http.StatusFound {
+			t.Fatalf("GET = status %d, wanted %d", rw.Code, http.StatusFound)
+		}
+		seen[rw.Header().Get("Location")] = true
+	}
+	if len(seen) != 3 {
+		t.Errorf("GET redirected to %v, wanted each of the 3 items", seen)
+	}
+
+	want := fmt.Sprintf("/gorse/reader?item-id=%d", itemC)
+	rw := get(fmt.Sprintf("feed-id=%d", two))
+	if rw.Code != http.StatusFound || rw.Header().Get("Location") != want {
+		t.Errorf("GET with feed = status %d to %s, wanted %d to %s", rw.Code,
+			rw.Header().Get("Location"), http.StatusFound, want)
+	}
+
+	if err := store.SetItemsReadState(ctx, []int64{itemC}, userID,
+		gorse.Read); err != nil {
+		t.Fatalf("SetItemsReadState() = error %s", err)
+	}
+	want = "/gorse/"
+	rw = get(fmt.Sprintf("feed-id=%d", two))
+	if rw.Code != http.StatusFound || rw.Header().Get("Location") != want {
+		t.Errorf("GET with nothing unread = status %d to %s, wanted %d to %s",
+			rw.Code, rw.Header().Get("Location"), http.StatusFound, want)
+	}
+
+	if rw := get("feed-id=x"); rw.Code != http.StatusBadRequest {
+		t.Errorf("GET with bad feed = status %d, wanted %d", rw.Code,
+			http.StatusBadRequest)
+	}
+}
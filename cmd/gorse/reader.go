@@ -0,0 +1,194 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/sessions"
+	"github.com/horgh/gorse"
+)
+
+// relatedItemsSize is how many related items the reader view lists.
+const relatedItemsSize = 10
+
+// handlerReader shows an item's article within gorse with only its main
+// content, as browsers' reader modes do.
+//
+// It implements the type RequestHandlerFunc.
+//
+// We fetch the article the first time someone asks for it and keep what we
+// found. With refresh=1 we fetch it again, such as if it changed.
+//
+// After the article we list related items, such as others about the same
+// story, so that the user can follow it across feeds.
+func handlerReader(rw http.ResponseWriter, request *http.Request,
+	settings *Config, store gorse.Store, session *sessions.Session) {
+	requestValues := request.URL.Query()
+
+	userID, ok := sessionUser(rw, request, settings, session)
+	if !ok {
+		return
+	}
+
+	itemIDStr := requestValues.Get("item-id")
+	itemID, err := strconv.ParseInt(itemIDStr, 10, 64)
+	if err != nil {
+		logf(request, "Bad item ID: %s: %s", itemIDStr, err)
+		send400Error(rw, "Bad item ID")
+		return
+	}
+
+	user, err := store.GetUser(request.Context(), userID)
+	if err != nil {
+		logf(request, "Unable to look up user: %s", err)
+		send500Error(rw, "Unable to look up user")
+		return
+	}
+
+	item, err := store.GetItem(request.Context(), itemID, userID)
+	if err != nil {
+		logf(request, "Unable to look up item %d: %s", itemID, err)
+		send500Error(rw, "Unable to look up item")
+		return
+	}
+
+	view, err := store.GetReaderView(request.Context(), itemID)
+	if err != nil && err != gorse.ErrNotFound {
+		logf(request, "Unable to look up reader view: %s", err)
+		send500Error(rw, "Unable to look up reader view")
+		return
+	}
+
+	// If we can't fetch the article we still show the page so that the user
+	// can follow the link to it.
+	fetchFailed := false
+	if view == nil || requestValues.Get("refresh") == "1" {
+		fetched, err := fetchReaderView(request, item)
+		if err != nil {
+			logf(request, "Unable to fetch reader view of item %d: %s", itemID,
+				err)
+			fetchFailed = true
+		} else {
+			if err := store.SetReaderView(request.Context(),
+				*fetched); err != nil {
+				logf(request, "Unable to record reader view: %s", err)
+				send500Error(rw, "Unable to record reader view")
+				return
+			}
+			view = fetched
+		}
+	}
+
+	relatedItems, err := store.RelatedItems(request.Context(), *item, userID,
+		relatedItemsSize)
+	if err != nil {
+		logf(request, "Unable to find related items: %s", err)
+		send500Error(rw, "Unable to find related items")
+		return
+	}
+
+	location, err := time.LoadLocation(settings.DisplayTimeZone)
+	if err != nil {
+		logf(request, "Failed to load time zone location [%s]: %s",
+			settings.DisplayTimeZone, err)
+		send500Error(rw, "Unable to load timezone information")
+		return
+	}
+
+	locale := userLocale(request, user)
+
+	type RelatedItem struct {
+		ID              int64
+		FeedName        string
+		Title           string
+		PublicationDate string
+		ReadState       gorse.ReadState
+	}
+
+	type ReaderPage struct {
+		Path        string
+		UserID      int
+		ReadState   gorse.ReadState
+		ItemID      int64
+		FeedName    string
+		Title       string
+		Link        string
+		FetchTime   string
+		FetchFailed bool
+		View        *gorse.ReaderView
+		Related     []RelatedItem
+	}
+
+	// The header links back to the list the item is likely in.
+	readState := gorse.Unread
+	if item.ReadState == gorse.ReadLater {
+		readState = gorse.ReadLater
+	}
+
+	page := ReaderPage{
+		Path:        settings.URIPrefix,
+		UserID:      userID,
+		ReadState:   readState,
+		ItemID:      itemID,
+		FeedName:    item.FeedName,
+		Title:       sanitiseItemText(item.Title),
+		Link:        item.Link,
+		FetchFailed: fetchFailed,
+		View:        view,
+	}
+	if view != nil {
+		// Images go through our proxy so that publishers don't see who reads
+		// what.
+		proxied := *view
+		proxied.Content = proxyImages(settings, view.Content)
+		page.View = &proxied
+
+		if view.Title != "" {
+			page.Title = view.Title
+		}
+		page.FetchTime, _ = formatDate(locale, user, view.FetchTime, location)
+	}
+
+	for _, related := range relatedItems {
+		pubDate, _ := formatDate(locale, user, related.PublicationDate, location)
+		page.Related = append(page.Related, RelatedItem{
+			ID:              related.ID,
+			FeedName:        related.FeedName,
+			Title:           sanitiseItemText(related.Title),
+			PublicationDate: pubDate,
+			ReadState:       related.ReadState,
+		})
+	}
+
+	if err := renderPage(settings, rw, locale, "_reader", page); err != nil {
+		logf(request, "Failure rendering page: %s", err)
+		send500Error(rw, "Failed to render page")
+		return
+	}
+}
+
+// fetchReaderView fetches the item's article and finds its main content.
+func fetchReaderView(request *http.Request,
+	item *gorse.UserItem) (*gorse.ReaderView, error) {
+	u, err := url.Parse(item.Link)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, fmt.Errorf("link is not an http or https URL: %s", item.Link)
+	}
+
+	body, contentType, err := fetchPage(request.Context(), item.Link)
+	if err != nil {
+		return nil, err
+	}
+
+	view, err := gorse.ExtractReaderView(body, contentType, item.Link)
+	if err != nil {
+		return nil, err
+	}
+	view.ItemID = item.ID
+	view.FetchTime = time.Now()
+
+	return &view, nil
+}
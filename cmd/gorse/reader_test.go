@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/sessions"
+	"github.com/horgh/gorse"
+	"github.com/horgh/gorse/internal/gorsetest"
+	"github.com/horgh/rss"
+)
+
+func TestHandlerReaderIntegration(t *testing.T) {
+	for _, dbType := range gorsetest.Types {
+		t.Run(dbType, func(t *testing.T) {
+			testHandlerReaderIntegration(t, dbType)
+		})
+	}
+}
+
+func testHandlerReaderIntegration(t *testing.T, dbType string) {
+	store, _ := gorsetest.Store(t, dbType)
+
+	story := "The first version."
+	fetches := 0
+	site := httptest.NewServer(http.HandlerFunc(
+		func(rw http.ResponseWriter, request *http.Request) {
+			fetches++
+			rw.Header().Set("Content-Type", "text/html; charset=utf-8")
+			_, _ = fmt.Fprintf(rw, `<title>Story</title><nav>Menu</nav>
+<article><p>%s</p><script>evil()</script></article>`, story)
+		}))
+	defer site.Close()
+
+	loaded := gorsetest.Load(t, store, gorsetest.Fixture{
+		Users: []gorsetest.User{
+			{Email: "user@example.com", Password: "password"},
+		},
+		Feeds: []gorsetest.Feed{
+			{
+				DBFeed: gorse.DBFeed{
+					Name:                   "Example",
+					URI:                    "https://example.com/feed",
+					UpdateFrequencySeconds: 3600,
+					Active:                 true,
+				},
+				Items: []rss.Item{
+					{Title: "Storm hits the coast", Link: site.URL + "/1",
+						PubDate: time.Now()},
+					{Title: "Cleanup after the storm", Link: site.URL + "/2",
+						PubDate: time.Now()},
+					{Title: "Bake sale", Link: site.URL + "/3", PubDate: time.Now()},
+				},
+				Subscribers: []string{"user@example.com"},
+			},
+		},
+	})
+	userID := loaded.Users["user@example.com"]
+	itemID := loaded.Items[site.URL+"/1"]
+
+	settings := &Config{
+		DisplayTimeZone: "UTC",
+		WebRoot:         "static",
+		TemplateDir:     "templates",
+	}
+	sessionStore := sessions.NewCookieStore([]byte(strings.Repeat("k", 32)))
+
+	read := func(query string) string {
+		request := httptest.NewRequest(http.MethodGet,
+			fmt.Sprintf("/reader?item-id=%d%s", itemID, query), nil)
+		session, err := sessionStore.New(request, "gorse")
+		if err != nil {
+			t.Fatalf("creating session: %s", err)
+		}
+		session.Values[sessionUserKey] = userID
+		rw := httptest.NewRecorder()
+		handlerReader(rw, request, settings, store, session)
+		if rw.Code != http.StatusOK {
+			t.Fatalf("handlerReader() = status %d, wanted %d: %s", rw.Code,
+				http.StatusOK, rw.Body.String())
+		}
+		return rw.Body.String()
+	}
+
+	body := read("")
+	if !strings.Contains(body, "<p>The first version.</p>") ||
+		strings.Contains(body, "Menu") || strings.Contains(body, "evil") {
+		t.Errorf("reader view = %s, wanted only the article", body)
+	}
+	if !strings.Contains(body, "Cleanup after the storm") ||
+		strings.Contains(body, "Bake sale") {
+		t.Errorf("reader view = %s, wanted the other story about the storm",
+			body)
+	}
+
+	// We show what we fetched before rather than fetching it again.
+	story = "The second version."
+	if body := read(""); !strings.Contains(body, "The first version.") ||
+		fetches != 1 {
+		t.Errorf("reader view fetched %d times, wanted 1: %s", fetches, body)
+	}
+
+	if body := read("&refresh=1"); !strings.Contains(body,
+		"The second version.") {
+		t.Errorf("refreshed reader view = %s, wanted the second version", body)
+	}
+
+	// If the site goes away we still have what we fetched.
+	site.Close()
+	if body := read("&refresh=1"); !strings.Contains(body,
+		"Unable to fetch the article.") ||
+		!strings.Contains(body, "The second version.") {
+		t.Errorf("reader view with the site down = %s, wanted the last version",
+			body)
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/sessions"
+	"github.com/horgh/gorse"
+)
+
+// recentlyReadSize is how many of the items the user most recently read we
+// show.
+const recentlyReadSize = 50
+
+// handlerRecentlyRead shows the items the user most recently marked read,
+// newest first, so that they can mark ones they didn't mean to unread again.
+//
+// It implements the type RequestHandlerFunc.
+func handlerRecentlyRead(rw http.ResponseWriter, request *http.Request,
+	settings *Config, store gorse.Store, session *sessions.Session) {
+	userID, ok := sessionUser(rw, request, settings, session)
+	if !ok {
+		return
+	}
+
+	user, err := store.GetUser(request.Context(), userID)
+	if err != nil {
+		logf(request, "Unable to look up user: %s", err)
+		send500Error(rw, "Unable to look up user")
+		return
+	}
+	locale := userLocale(request, user)
+
+	items, err := store.RecentlyRead(request.Context(), userID,
+		recentlyReadSize)
+	if err != nil {
+		logf(request, "Unable to retrieve recently read items: %s", err)
+		send500Error(rw, "Unable to retrieve items")
+		return
+	}
+
+	location, err := time.LoadLocation(settings.DisplayTimeZone)
+	if err != nil {
+		logf(request, "Failed to load time zone location [%s]: %s",
+			settings.DisplayTimeZone, err)
+		send500Error(rw, "Unable to load timezone information")
+		return
+	}
+
+	type HTMLItem struct {
+		ID           int64
+		FeedName     string
+		Title        string
+		Link         string
+		ReadTime     string
+		FullReadTime string
+	}
+
+	var htmlItems []HTMLItem
+	for _, item := range items {
+		readTime, fullReadTime := formatDate(locale, user, item.ReadTime,
+			location)
+		htmlItems = append(htmlItems, HTMLItem{
+			ID:           item.ID,
+			FeedName:     item.FeedName,
+			Title:        sanitiseItemText(item.Title),
+			Link:         item.Link,
+			ReadTime:     readTime,
+			FullReadTime: fullReadTime,
+		})
+	}
+
+	type RecentlyReadPage struct {
+		Items     []HTMLItem
+		Path      string
+		UserID    int
+		ReadState gorse.ReadState
+	}
+
+	if err := renderPage(settings, rw, locale, "_recently_read",
+		RecentlyReadPage{
+			Items:     htmlItems,
+			Path:      settings.URIPrefix,
+			UserID:    userID,
+			ReadState: gorse.Unread,
+		}); err != nil {
+		logf(request, "Failure rendering page: %s", err)
+		send500Error(rw, "Failed to render page")
+		return
+	}
+}
+
+// handlerMarkUnread marks an item the user read unread again. We go back to
+// the recently read items after.
+//
+// It implements the type RequestHandlerFunc.
+func handlerMarkUnread(rw http.ResponseWriter, request *http.Request,
+	settings *Config, store gorse.Store, session *sessions.Session) {
+	if err := request.ParseForm(); err != nil {
+		logf(request, "Failed to parse form: %s", err)
+		if bodyTooLarge(err) {
+			send413Error(rw, tooLargeError(settings.maxFormBytes()))
+			return
+		}
+		send400Error(rw, "Failed to parse request")
+		return
+	}
+
+	userID, ok := sessionUser(rw, request, settings, session)
+	if !ok {
+		return
+	}
+
+	itemIDStr := request.PostForm.Get("item-id")
+	itemID, err := strconv.ParseInt(itemIDStr, 10, 64)
+	if err != nil {
+		logf(request, "Bad item ID: %s: %s", itemIDStr, err)
+		send400Error(rw, "Bad item ID")
+		return
+	}
+
+	item, err := store.GetItem(request.Context(), itemID, userID)
+	if err != nil {
+		logf(request, "Unable to look up item %d: %s", itemID, err)
+		send400Error(rw, "Unknown item")
+		return
+	}
+
+	// It may have changed since the page showed it, such as if the user saved
+	// it to read later elsewhere. We leave it as it is then.
+	if item.ReadState == gorse.Read {
+		if err := store.SetItemsReadState(
+			gorse.WithActor(request.Context(), userID), []int64{itemID}, userID,
+			gorse.Unread); err != nil {
+			logf(request, "Unable to mark item %d unread: %s", itemID, err)
+			send500Error(rw, "Unable to update item")
+			return
+		}
+		logf(request, "Marked item %d unread", itemID)
+	}
+
+	uri := settings.URIPrefix + "/recent"
+
+	logf(request, "Redirecting to %s", uri)
+
+	http.Redirect(rw, request, uri, http.StatusFound)
+}
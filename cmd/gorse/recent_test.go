@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/sessions"
+	"github.com/horgh/gorse"
+	"github.com/horgh/gorse/internal/gorsetest"
+	"github.com/horgh/rss"
+)
+
+func TestHandlerRecentlyReadIntegration(t *testing.T) {
+	for _, dbType := range gorsetest.Types {
+		t.Run(dbType, func(t *testing.T) {
+			testHandlerRecentlyReadIntegration(t, dbType)
+		})
+	}
+}
+
+func testHandlerRecentlyReadIntegration(t *testing.T, dbType string) {
+	ctx := context.Background()
+	store, _ := gorsetest.Store(t, dbType)
+
+	loaded := gorsetest.Load(t, store, gorsetest.Fixture{
+		Users: []gorsetest.User{
+			{Email: "user@example.com", Password: "password"},
+		},
+		Feeds: []gorsetest.Feed{
+			{
+				DBFeed: gorse.DBFeed{
+					Name:                   "Example",
+					URI:                    "https://example.com/feed",
+					UpdateFrequencySeconds: 3600,
+					Active:                 true,
+				},
+				Items: []rss.Item{
+					{Title: "Oops <b>read</b>", Link: "https://example.com/1",
+						PubDate: time.Now()},
+				},
+				Subscribers: []string{"user@example.com"},
+			},
+		},
+	})
+	userID := loaded.Users["user@example.com"]
+	itemID := loaded.Items["https://example.com/1"]
+
+	if err := store.SetItemsReadState(ctx, []int64{itemID}, userID,
+		gorse.Read); err != nil {
+		t.Fatalf("SetItemsReadState() = error %s", err)
+	}
+
+	settings := &Config{
+		URIPrefix:       "/gorse",
+		DisplayTimeZone: "UTC",
+		WebRoot:         "static",
+		TemplateDir:     "templates",
+	}
+	sessionStore := sessions.NewCookieStore([]byte(strings.Repeat("k", 32)))
+
+	list := func() string {
+		request := httptest.NewRequest(http.MethodGet,
+			"/recent", nil)
+		session, err := sessionStore.New(request, "gorse")
+		if err != nil {
+			t.Fatalf("creating session: %s", err)
+		}
+		session.Values[sessionUserKey] = userID
+		rw := httptest.NewRecorder()
+		handlerRecentlyRead(rw, request, settings, store, session)
+		if rw.Code != http.StatusOK {
+			t.Fatalf("GET = status %d: %s, wanted %d", rw.Code, rw.Body.String(),
+				http.StatusOK)
+		}
+		return rw.Body.String()
+	}
+
+	body := list()
+	if !strings.Contains(body, "Oops read") ||
+		!strings.Contains(body, fmt.Sprintf(`name="item-id" value="%d"`,
+			itemID)) {
+		t.Errorf("page = %s, wanted the item we read", body)
+	}
+
+	form := url.Values{
+		"item-id": {fmt.Sprintf("%d", itemID)},
+	}
+	request := httptest.NewRequest(http.MethodPost, "/mark_unread",
+		strings.NewReader(form.Encode()))
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	session, err := sessionStore.New(request, "gorse")
+	if err != nil {
+		t.Fatalf("creating session: %s", err)
+	}
+	session.Values[sessionUserKey] = userID
+	rw := httptest.NewRecorder()
+	handlerMarkUnread(rw, request, settings, store, session)
+
+	want := "/gorse/recent"
+	if rw.Code != http.StatusFound || rw.Header().Get("Location") != want {
+		t.Fatalf("POST = status %d to %s, wanted %d to %s", rw.Code,
+			rw.Header().Get("Location"), http.StatusFound, want)
+	}
+
+	item, err := store.GetItem(ctx, itemID, userID)
+	if err != nil {
+		t.Fatalf("GetItem() = error %s", err)
+	}
+	if item.ReadState != gorse.Unread {
+		t.Errorf("item is %s, wanted %s", item.ReadState, gorse.Unread)
+	}
+	if body := list(); strings.Contains(body, "Oops read") {
+		t.Errorf("page = %s, wanted the item gone", body)
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"time"
+)
+
+// requestIDHeader carries the request's ID. We take it from a proxy in front
+// of us if it sends one so both logs show the same ID, and send it back in the
+// response.
+const requestIDHeader = "X-Request-ID"
+
+// Log levels. At debug we log each request's query parameters, the names of
+// its form parameters, and how long it took.
+const (
+	logLevelInfo  = "info"
+	logLevelDebug = "debug"
+)
+
+// validRequestID matches IDs we accept from a proxy. We restrict them as they
+// end up in our log and pages.
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+type requestLogKey struct{}
+
+// requestLog logs for a request. Each line starts with the request's ID.
+type requestLog struct {
+	id     string
+	debug  bool
+	logger *log.Logger
+
+	// userID is whose request it is, once a handler knows.
+	userID int
+}
+
+// newRequestID generates an ID for a request.
+func newRequestID() string {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		// We only use IDs to find log lines, so a clash would not be serious.
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(buf)
+}
+
+// withRequestLog sets up logging for the request. It returns the request
+// carrying it along with the request's ID.
+func withRequestLog(request *http.Request, debug bool) (*http.Request,
+	string) {
+	id := request.Header.Get(requestIDHeader)
+	if !validRequestID.MatchString(id) {
+		id = newRequestID()
+	}
+
+	l := &requestLog{
+		id:     id,
+		debug:  debug,
+		logger: log.New(log.Writer(), "["+id+"] ", log.Flags()|log.Lmsgprefix),
+	}
+
+	return request.WithContext(context.WithValue(request.Context(),
+		requestLogKey{}, l)), id
+}
+
+// logf logs as log.Printf does, noting the request's ID.
+func logf(request *http.Request, format string, args ...interface{}) {
+	ctxLogf(request.Context(), format, args...)
+}
+
+// ctxLogf logs as logf does for code that has only the request's context.
+func ctxLogf(ctx context.Context, format string, args ...interface{}) {
+	l, ok := ctx.Value(requestLogKey{}).(*requestLog)
+	if !ok {
+		log.Printf(format, args...)
+		return
+	}
+	l.logger.Printf(format, args...)
+}
+
+// debugf logs as logf does but only if we're logging at debug level.
+func debugf(request *http.Request, format string, args ...interface{}) {
+	l, ok := request.Context().Value(requestLogKey{}).(*requestLog)
+	if !ok || !l.debug {
+		return
+	}
+	l.logger.Printf(format, args...)
+}
+
+// paramNames gives the names of the parameters, sorted, without their values.
+// We log these rather than the values as some are passwords or other secrets.
+func paramNames(values url.Values) []string {
+	var names []string
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// statusRecorder records the status a handler responds with and how many
+// bytes of body it sends.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(p []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	n, err := r.ResponseWriter.Write(p)
+	r.bytes += int64(n)
+	return n, err
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRequestLog(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	tests := []struct {
+		Name      string
+		Header    string
+		Debug     bool
+		WantID    string
+		WantDebug bool
+	}{
+		{Name: "generated"},
+		{Name: "from proxy", Header: "abc-123", WantID: "abc-123"},
+		{Name: "bad from proxy", Header: "abc 123\n"},
+		{Name: "debug", Debug: true, WantDebug: true},
+	}
+
+	for _, test := range tests {
+		buf.Reset()
+
+		request := httptest.NewRequest(http.MethodGet, "/", nil)
+		if test.Header != "" {
+			request.Header.Set(requestIDHeader, test.Header)
+		}
+
+		request, id := withRequestLog(request, test.Debug)
+		if test.WantID != "" && id != test.WantID {
+			t.Errorf("%s: ID = %q, wanted %q", test.Name, id, test.WantID)
+		}
+		if !validRequestID.MatchString(id) {
+			t.Errorf("%s: ID = %q, wanted a valid ID", test.Name, id)
+		}
+
+		logf(request, "info")
+		debugf(request, "debug")
+
+		output := buf.String()
+		if !strings.Contains(output, "["+id+"] info") {
+			t.Errorf("%s: log = %q, wanted the info line with the ID", test.Name,
+				output)
+		}
+		if got := strings.Contains(output, "["+id+"] debug"); got !=
+			test.WantDebug {
+			t.Errorf("%s: log = %q, wanted debug line: %t", test.Name, output,
+				test.WantDebug)
+		}
+	}
+}
+
+func TestParamNames(t *testing.T) {
+	values := url.Values{
+		"user":     {"user@example.com"},
+		"password": {"secret"},
+		"next":     {"/", "/feeds"},
+	}
+	got := paramNames(values)
+	if want := []string{"next", "password", "user"}; !reflect.DeepEqual(got,
+		want) {
+		t.Errorf("paramNames(%v) = %v, wanted %v", values, got, want)
+	}
+	if strings.Contains(fmt.Sprint(got), "secret") {
+		t.Errorf("paramNames(%v) = %v, wanted no values", values, got)
+	}
+}
+
+func TestSend500ErrorRequestID(t *testing.T) {
+	rw := httptest.NewRecorder()
+	rw.Header().Set(requestIDHeader, "abc-123")
+
+	send500Error(rw, "Failed.")
+
+	if rw.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d, wanted %d", rw.Code,
+			http.StatusInternalServerError)
+	}
+	if !strings.Contains(rw.Body.String(), "Request ID: abc-123") {
+		t.Errorf("body = %q, wanted the request ID", rw.Body.String())
+	}
+}
@@ -0,0 +1,342 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/http/fcgi"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// When we start a new process to take over from us, we tell it which file
+// descriptors hold the listener and the pipe to tell us it's ready on through
+// these environment variables.
+const (
+	listenFDEnv = "GORSE_LISTEN_FD"
+	readyFDEnv  = "GORSE_READY_FD"
+)
+
+// replaceTimeout is how long we wait for a new process to be ready to serve
+// requests before giving up on it.
+const replaceTimeout = 30 * time.Second
+
+// shutdownTimeout is how long we wait for requests to finish when stopping.
+const shutdownTimeout = 30 * time.Second
+
+// server serves requests on a listener until we stop it.
+type server struct {
+	listener net.Listener
+	handler  http.Handler
+	fastCGI  bool
+
+	http *http.Server
+
+	// For HTTP we track the state of each connection.
+	mu    sync.Mutex
+	conns map[net.Conn]http.ConnState
+
+	// For FastCGI we count requests in progress as the fcgi package doesn't
+	// tell us about connections.
+	requests int64
+
+	stopping int32
+
+	// done closes when serve returns.
+	done chan struct{}
+}
+
+func newServer(listener net.Listener, handler http.Handler,
+	fastCGI bool) *server {
+	s := &server{
+		listener: listener,
+		handler:  handler,
+		fastCGI:  fastCGI,
+		conns:    map[net.Conn]http.ConnState{},
+		done:     make(chan struct{}),
+	}
+	s.http = &http.Server{
+		Handler:   handler,
+		ConnState: s.connState,
+	}
+	return s
+}
+
+// serve serves requests. It returns nil once we stop it.
+func (s *server) serve() error {
+	defer close(s.done)
+
+	var err error
+	if s.fastCGI {
+		err = fcgi.Serve(s.listener, s.track(s.handler))
+	} else {
+		err = s.http.Serve(s.listener)
+	}
+	if atomic.LoadInt32(&s.stopping) == 1 {
+		return nil
+	}
+	return err
+}
+
+func (s *server) connState(conn net.Conn, state http.ConnState) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if state == http.StateClosed || state == http.StateHijacked {
+		delete(s.conns, conn)
+		return
+	}
+	s.conns[conn] = state
+}
+
+// track wraps the handler to count the requests in progress.
+func (s *server) track(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&s.requests, 1)
+		defer atomic.AddInt64(&s.requests, -1)
+		handler.ServeHTTP(rw, r)
+	})
+}
+
+// busy counts the requests in progress. For HTTP this includes connections
+// we've accepted but not yet read a request from.
+func (s *server) busy() int64 {
+	if s.fastCGI {
+		return atomic.LoadInt64(&s.requests)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var n int64
+	for _, state := range s.conns {
+		if state == http.StateNew || state == http.StateActive {
+			n++
+		}
+	}
+	return n
+}
+
+// stop stops accepting connections and waits for requests in progress to
+// finish, or for the context to end. serve must have been called.
+//
+// We wait for requests ourselves rather than leaving it to the HTTP server's
+// Shutdown. Shutdown drops connections it hasn't yet read a request from,
+// and we may have just accepted one.
+func (s *server) stop(ctx context.Context) error {
+	if atomic.CompareAndSwapInt32(&s.stopping, 0, 1) {
+		if err := s.listener.Close(); err != nil {
+			return fmt.Errorf("unable to close listener: %s", err)
+		}
+	}
+
+	select {
+	case <-ctx.Done():
+		return fmt.Errorf("still accepting connections: %s", ctx.Err())
+	case <-s.done:
+	}
+
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for s.busy() > 0 {
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%d request(s) still in progress: %s", s.busy(),
+				ctx.Err())
+		case <-ticker.C:
+		}
+	}
+
+	// This closes idle connections.
+	if !s.fastCGI {
+		return s.http.Shutdown(ctx)
+	}
+	return nil
+}
+
+// serveUntilStopped serves requests until we receive SIGINT or SIGTERM, or
+// until a new process takes over from us after SIGUSR2. Either way we let
+// requests in progress finish.
+//
+// On SIGUSR2 we start the executable again with the same arguments and hand
+// it our listener. Once it's serving, we stop accepting connections. The
+// listener stays open throughout so no connection is refused. If the new
+// process fails to start, we keep serving.
+func serveUntilStopped(srv *server, stopPolling func()) error {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGUSR2, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	served := make(chan error, 1)
+	go func() {
+		served <- srv.serve()
+	}()
+
+	if err := notifyReady(); err != nil {
+		log.Printf("Unable to tell the process we're replacing that we're "+
+			"ready: %s", err)
+	}
+
+	for {
+		select {
+		case err := <-served:
+			return err
+		case sig := <-signals:
+			if sig == syscall.SIGUSR2 {
+				log.Printf("Received %s. Starting a new process to take over.", sig)
+				if err := startReplacement(srv.listener); err != nil {
+					log.Printf("Unable to start a new process, continuing to serve: %s",
+						err)
+					continue
+				}
+
+				// The socket is the new process's now.
+				if l, ok := srv.listener.(*net.UnixListener); ok {
+					l.SetUnlinkOnClose(false)
+				}
+			}
+
+			log.Printf("Received %s. Stopping once requests in progress finish.",
+				sig)
+			stopPolling()
+
+			ctx, cancel := context.WithTimeout(context.Background(),
+				shutdownTimeout)
+			err := srv.stop(ctx)
+			cancel()
+			if err != nil {
+				log.Printf("Stopping: %s", err)
+			}
+			return nil
+		}
+	}
+}
+
+// startReplacement starts a new process to take over serving requests on the
+// listener. We return once it's ready to serve.
+func startReplacement(listener net.Listener) error {
+	filer, ok := listener.(interface{ File() (*os.File, error) })
+	if !ok {
+		return fmt.Errorf("unable to pass on a %T", listener)
+	}
+	listenerFile, err := filer.File()
+	if err != nil {
+		return fmt.Errorf("unable to get the listener's file: %s", err)
+	}
+	defer func() {
+		_ = listenerFile.Close()
+	}()
+
+	readyR, readyW, err := os.Pipe()
+	if err != nil {
+		return fmt.Errorf("unable to create pipe: %s", err)
+	}
+	defer func() {
+		_ = readyR.Close()
+	}()
+
+	executable, err := os.Executable()
+	if err != nil {
+		_ = readyW.Close()
+		return fmt.Errorf("unable to find executable: %s", err)
+	}
+
+	// ExtraFiles start at descriptor 3.
+	cmd := exec.Command(executable, os.Args[1:]...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.ExtraFiles = []*os.File{listenerFile, readyW}
+	cmd.Env = append(os.Environ(), listenFDEnv+"=3", readyFDEnv+"=4")
+
+	err = cmd.Start()
+	_ = readyW.Close()
+	if err != nil {
+		return fmt.Errorf("unable to start %s: %s", executable, err)
+	}
+
+	// The new process writes to the pipe once it's serving. If it exits first,
+	// the read fails as nothing has the pipe open for writing any more.
+	ready := make(chan error, 1)
+	go func() {
+		_, err := readyR.Read(make([]byte, 1))
+		ready <- err
+	}()
+
+	select {
+	case err := <-ready:
+		if err != nil {
+			_ = cmd.Wait()
+			return fmt.Errorf("new process exited before it was ready: %s",
+				cmd.ProcessState)
+		}
+	case <-time.After(replaceTimeout):
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+		return fmt.Errorf("new process wasn't ready after %s", replaceTimeout)
+	}
+
+	log.Printf("New process %d is serving requests", cmd.Process.Pid)
+	return cmd.Process.Release()
+}
+
+// inheritedListener returns the listener the process we're replacing passed
+// us, if there is one.
+func inheritedListener() (net.Listener, error) {
+	fdString := os.Getenv(listenFDEnv)
+	if fdString == "" {
+		return nil, nil
+	}
+	// Don't pass it on if we start a process of our own.
+	if err := os.Unsetenv(listenFDEnv); err != nil {
+		return nil, fmt.Errorf("unable to unset %s: %s", listenFDEnv, err)
+	}
+
+	fd, err := strconv.Atoi(fdString)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %s", listenFDEnv, fdString)
+	}
+
+	file := os.NewFile(uintptr(fd), "listener")
+	listener, err := net.FileListener(file)
+	_ = file.Close()
+	if err != nil {
+		return nil, fmt.Errorf("unable to use inherited listener: %s", err)
+	}
+
+	// We're responsible for the socket now, so remove it when we stop.
+	if l, ok := listener.(*net.UnixListener); ok {
+		l.SetUnlinkOnClose(true)
+	}
+
+	return listener, nil
+}
+
+// notifyReady tells the process we're replacing, if any, that we're serving
+// requests so it can stop.
+func notifyReady() error {
+	fdString := os.Getenv(readyFDEnv)
+	if fdString == "" {
+		return nil
+	}
+	if err := os.Unsetenv(readyFDEnv); err != nil {
+		return fmt.Errorf("unable to unset %s: %s", readyFDEnv, err)
+	}
+
+	fd, err := strconv.Atoi(fdString)
+	if err != nil {
+		return fmt.Errorf("invalid %s: %s", readyFDEnv, fdString)
+	}
+
+	file := os.NewFile(uintptr(fd), "ready")
+	_, err = file.Write([]byte{1})
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
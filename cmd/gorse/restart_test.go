@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestInheritedListener(t *testing.T) {
+	listener, err := inheritedListener()
+	if err != nil || listener != nil {
+		t.Fatalf("inheritedListener() with nothing passed = %v, %v, wanted nil",
+			listener, err)
+	}
+
+	original, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unable to listen: %s", err)
+	}
+	defer func() {
+		_ = original.Close()
+	}()
+
+	file, err := original.(*net.TCPListener).File()
+	if err != nil {
+		t.Fatalf("unable to get file: %s", err)
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	// inheritedListener closes the descriptor it's given, so give it its own.
+	// Otherwise file closes it again, by then perhaps someone else's.
+	fd, err := syscall.Dup(int(file.Fd()))
+	if err != nil {
+		t.Fatalf("unable to duplicate descriptor: %s", err)
+	}
+
+	if err := os.Setenv(listenFDEnv, strconv.Itoa(fd)); err != nil {
+		t.Fatalf("unable to set environment: %s", err)
+	}
+	defer func() {
+		_ = os.Unsetenv(listenFDEnv)
+	}()
+
+	listener, err = inheritedListener()
+	if err != nil {
+		t.Fatalf("inheritedListener() = error %s", err)
+	}
+	defer func() {
+		_ = listener.Close()
+	}()
+
+	if listener.Addr().String() != original.Addr().String() {
+		t.Errorf("inheritedListener() = %s, wanted %s", listener.Addr(),
+			original.Addr())
+	}
+	if os.Getenv(listenFDEnv) != "" {
+		t.Errorf("%s is still set", listenFDEnv)
+	}
+}
+
+func TestServerStopFastCGI(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unable to listen: %s", err)
+	}
+
+	release := make(chan struct{})
+	started := make(chan struct{})
+	srv := newServer(listener, http.HandlerFunc(
+		func(rw http.ResponseWriter, r *http.Request) {
+			close(started)
+			<-release
+		}), true)
+
+	served := make(chan error, 1)
+	go func() {
+		served <- srv.serve()
+	}()
+
+	// Stand in for the fcgi package running a request.
+	done := make(chan struct{})
+	go func() {
+		srv.track(srv.handler).ServeHTTP(httptest.NewRecorder(),
+			httptest.NewRequest(http.MethodGet, "/", nil))
+		close(done)
+	}()
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(),
+		50*time.Millisecond)
+	defer cancel()
+	if err := srv.stop(ctx); err == nil {
+		t.Errorf("stop() with a request in progress = success, wanted error")
+	}
+
+	if err := <-served; err != nil {
+		t.Errorf("serve() = error %s, wanted nil once stopped", err)
+	}
+
+	close(release)
+	<-done
+	if err := srv.stop(context.Background()); err != nil {
+		t.Errorf("stop() = error %s", err)
+	}
+}
+
+func TestServerStopHTTP(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unable to listen: %s", err)
+	}
+
+	release := make(chan struct{})
+	started := make(chan struct{})
+	srv := newServer(listener, http.HandlerFunc(
+		func(rw http.ResponseWriter, r *http.Request) {
+			close(started)
+			<-release
+			_, _ = rw.Write([]byte("done"))
+		}), false)
+
+	served := make(chan error, 1)
+	go func() {
+		served <- srv.serve()
+	}()
+
+	responded := make(chan error, 1)
+	go func() {
+		resp, err := http.Get("http://" + listener.Addr().String() + "/")
+		if err == nil {
+			_ = resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				err = fmt.Errorf("status %d", resp.StatusCode)
+			}
+		}
+		responded <- err
+	}()
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(),
+		50*time.Millisecond)
+	defer cancel()
+	if err := srv.stop(ctx); err == nil {
+		t.Errorf("stop() with a request in progress = success, wanted error")
+	}
+
+	if err := <-served; err != nil {
+		t.Errorf("serve() = error %s, wanted nil once stopped", err)
+	}
+
+	close(release)
+	if err := srv.stop(context.Background()); err != nil {
+		t.Errorf("stop() = error %s", err)
+	}
+	if err := <-responded; err != nil {
+		t.Errorf("request in progress while stopping failed: %s", err)
+	}
+}
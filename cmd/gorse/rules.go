@@ -0,0 +1,285 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/sessions"
+	"github.com/horgh/gorse"
+)
+
+// ruleOption is a choice in the form for adding a rule. Label is the message
+// we translate to show it.
+type ruleOption struct {
+	Value string
+	Label string
+}
+
+// ruleFields are the fields a rule may look at.
+var ruleFields = []ruleOption{
+	{gorse.AnyField.String(), "Title, link, or description"},
+	{gorse.TitleField.String(), "Title"},
+	{gorse.LinkField.String(), "Link"},
+	{gorse.DescriptionField.String(), "Description"},
+}
+
+// ruleMatches are the ways a rule's pattern may match.
+var ruleMatches = []ruleOption{
+	{gorse.ContainsMatch.String(), "contains"},
+	{gorse.RegexpMatch.String(), "matches the regular expression"},
+}
+
+// ruleActions are what a rule may do.
+var ruleActions = []ruleOption{
+	{gorse.MarkReadAction.String(), "Mark read"},
+	{gorse.ReadLaterAction.String(), "Read later"},
+	{gorse.StarAction.String(), "Star"},
+	{gorse.TagAction.String(), "Tag"},
+}
+
+// ruleLabel gives the label of the option with the value.
+func ruleLabel(options []ruleOption, value string) string {
+	for _, o := range options {
+		if o.Value == value {
+			return o.Label
+		}
+	}
+	return value
+}
+
+// handlerRules shows the user's rules and lets them add and delete them.
+//
+// It implements the type RequestHandlerFunc.
+func handlerRules(rw http.ResponseWriter, request *http.Request,
+	settings *Config, store gorse.Store, session *sessions.Session) {
+	userID, ok := sessionUser(rw, request, settings, session)
+	if !ok {
+		return
+	}
+
+	user, err := store.GetUser(request.Context(), userID)
+	if err != nil {
+		logf(request, "Unable to look up user: %s", err)
+		send500Error(rw, "Unable to look up user")
+		return
+	}
+	locale := userLocale(request, user)
+
+	rules, err := store.ListRules(request.Context(), userID)
+	if err != nil {
+		logf(request, "Unable to look up rules: %s", err)
+		send500Error(rw, "Unable to look up rules")
+		return
+	}
+
+	feeds, err := store.ListSubscriptions(request.Context(), userID)
+	if err != nil {
+		logf(request, "Unable to retrieve subscriptions: %s", err)
+		send500Error(rw, "Unable to retrieve subscriptions")
+		return
+	}
+
+	// Rules may be for feeds the user no longer subscribes to. We still show
+	// them, without the feed's name.
+	feedNames := map[int64]string{}
+	for _, feed := range feeds {
+		feedNames[feed.ID] = feed.Name
+	}
+
+	type HTMLRule struct {
+		gorse.Rule
+		FeedName    string
+		FieldLabel  string
+		MatchLabel  string
+		ActionLabel string
+	}
+
+	var htmlRules []HTMLRule
+	for _, rule := range rules {
+		htmlRules = append(htmlRules, HTMLRule{
+			Rule:        rule,
+			FeedName:    feedNames[rule.FeedID],
+			FieldLabel:  ruleLabel(ruleFields, rule.Field.String()),
+			MatchLabel:  ruleLabel(ruleMatches, rule.Match.String()),
+			ActionLabel: ruleLabel(ruleActions, rule.Action.String()),
+		})
+	}
+
+	type RulesPage struct {
+		Rules                []HTMLRule
+		Feeds                []gorse.DBFeed
+		Fields               []ruleOption
+		Matches              []ruleOption
+		Actions              []ruleOption
+		MaxRulePatternLength int
+		MaxTagLength         int
+		Path                 string
+		UserID               int
+		ReadState            gorse.ReadState
+	}
+
+	if err := renderPage(settings, rw, locale, "_rules", RulesPage{
+		Rules:                htmlRules,
+		Feeds:                feeds,
+		Fields:               ruleFields,
+		Matches:              ruleMatches,
+		Actions:              ruleActions,
+		MaxRulePatternLength: gorse.MaxRulePatternLength,
+		MaxTagLength:         gorse.MaxTagLength,
+		Path:                 settings.URIPrefix,
+		UserID:               userID,
+		ReadState:            gorse.Unread,
+	}); err != nil {
+		logf(request, "Failure rendering page: %s", err)
+		send500Error(rw, "Failed to render page")
+		return
+	}
+}
+
+// handlerRuleAdd adds a rule for the user. The form has the field, match,
+// pattern, and action, as Rule names them, and the tag if the action is tag.
+// feed-id is the feed the rule is for, if any. It must be one the user
+// subscribes to.
+//
+// It implements the type RequestHandlerFunc.
+func handlerRuleAdd(rw http.ResponseWriter, request *http.Request,
+	settings *Config, store gorse.Store, session *sessions.Session) {
+	if err := request.ParseForm(); err != nil {
+		logf(request, "Failed to parse form: %s", err)
+		if bodyTooLarge(err) {
+			send413Error(rw, tooLargeError(settings.maxFormBytes()))
+			return
+		}
+		send400Error(rw, "Failed to parse request")
+		return
+	}
+
+	userID, ok := sessionUser(rw, request, settings, session)
+	if !ok {
+		return
+	}
+
+	rule := gorse.Rule{
+		UserID:  userID,
+		Pattern: request.PostForm.Get("pattern"),
+		Tag:     request.PostForm.Get("tag"),
+	}
+
+	var err error
+	if rule.Field, err = gorse.ParseRuleField(
+		request.PostForm.Get("field")); err != nil {
+		logf(request, "Bad field: %s", err)
+		send400Error(rw, "Bad field")
+		return
+	}
+	if rule.Match, err = gorse.ParseRuleMatch(
+		request.PostForm.Get("match")); err != nil {
+		logf(request, "Bad match: %s", err)
+		send400Error(rw, "Bad match")
+		return
+	}
+	if rule.Action, err = gorse.ParseRuleAction(
+		request.PostForm.Get("action")); err != nil {
+		logf(request, "Bad action: %s", err)
+		send400Error(rw, "Bad action")
+		return
+	}
+
+	if feedIDStr := request.PostForm.Get("feed-id"); feedIDStr != "" {
+		feedID, err := strconv.ParseInt(feedIDStr, 10, 64)
+		if err != nil {
+			logf(request, "Bad feed ID: %s: %s", feedIDStr, err)
+			send400Error(rw, "Bad feed ID")
+			return
+		}
+
+		feeds, err := store.ListSubscriptions(request.Context(), userID)
+		if err != nil {
+			logf(request, "Unable to retrieve subscriptions: %s", err)
+			send500Error(rw, "Unable to retrieve subscriptions")
+			return
+		}
+		for _, feed := range feeds {
+			if feed.ID == feedID {
+				rule.FeedID = feedID
+				break
+			}
+		}
+		if rule.FeedID == 0 {
+			logf(request, "User %d doesn't subscribe to feed %d", userID, feedID)
+			send400Error(rw, "Unknown feed")
+			return
+		}
+	}
+
+	if err := rule.Validate(); err != nil {
+		logf(request, "Bad rule: %s", err)
+		send400Error(rw, fmt.Sprintf("Bad rule: %s", err))
+		return
+	}
+
+	id, err := store.AddRule(gorse.WithActor(request.Context(), userID), rule)
+	if err != nil {
+		logf(request, "Unable to add rule: %s", err)
+		send500Error(rw, "Unable to add rule")
+		return
+	}
+
+	logf(request, "Added rule %d", id)
+
+	uri := settings.URIPrefix + "/rules"
+
+	logf(request, "Redirecting to %s", uri)
+
+	http.Redirect(rw, request, uri, http.StatusFound)
+}
+
+// handlerRuleDelete deletes the user's rule with the ID rule-id.
+//
+// It implements the type RequestHandlerFunc.
+func handlerRuleDelete(rw http.ResponseWriter, request *http.Request,
+	settings *Config, store gorse.Store, session *sessions.Session) {
+	if err := request.ParseForm(); err != nil {
+		logf(request, "Failed to parse form: %s", err)
+		if bodyTooLarge(err) {
+			send413Error(rw, tooLargeError(settings.maxFormBytes()))
+			return
+		}
+		send400Error(rw, "Failed to parse request")
+		return
+	}
+
+	userID, ok := sessionUser(rw, request, settings, session)
+	if !ok {
+		return
+	}
+
+	idStr := request.PostForm.Get("rule-id")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		logf(request, "Bad rule ID: %s: %s", idStr, err)
+		send400Error(rw, "Bad rule ID")
+		return
+	}
+
+	if err := store.DeleteRule(gorse.WithActor(request.Context(), userID),
+		userID, id); err != nil {
+		if err == gorse.ErrNotFound {
+			logf(request, "User %d has no rule %d", userID, id)
+			send400Error(rw, "Unknown rule")
+			return
+		}
+		logf(request, "Unable to delete rule %d: %s", id, err)
+		send500Error(rw, "Unable to delete rule")
+		return
+	}
+
+	logf(request, "Deleted rule %d", id)
+
+	uri := settings.URIPrefix + "/rules"
+
+	logf(request, "Redirecting to %s", uri)
+
+	http.Redirect(rw, request, uri, http.StatusFound)
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/sessions"
+	"github.com/horgh/gorse"
+	"github.com/horgh/gorse/internal/gorsetest"
+)
+
+func TestHandlerRulesIntegration(t *testing.T) {
+	for _, dbType := range gorsetest.Types {
+		t.Run(dbType, func(t *testing.T) {
+			testHandlerRulesIntegration(t, dbType)
+		})
+	}
+}
+
+func testHandlerRulesIntegration(t *testing.T, dbType string) {
+	ctx := context.Background()
+	store, _ := gorsetest.Store(t, dbType)
+
+	loaded := gorsetest.Load(t, store, gorsetest.Fixture{
+		Users: []gorsetest.User{
+			{Email: "user@example.com", Password: "password"},
+		},
+		Feeds: []gorsetest.Feed{
+			{
+				DBFeed: gorse.DBFeed{
+					Name:                   "Videos",
+					URI:                    "https://example.com/videos",
+					UpdateFrequencySeconds: 3600,
+					Active:                 true,
+				},
+				Subscribers: []string{"user@example.com"},
+			},
+			{
+				DBFeed: gorse.DBFeed{
+					Name:                   "Not mine",
+					URI:                    "https://example.com/other",
+					UpdateFrequencySeconds: 3600,
+					Active:                 true,
+				},
+			},
+		},
+	})
+	userID := loaded.Users["user@example.com"]
+	videos := loaded.Feeds["https://example.com/videos"]
+	other := loaded.Feeds["https://example.com/other"]
+
+	settings := &Config{
+		URIPrefix:       "/gorse",
+		DisplayTimeZone: "UTC",
+		WebRoot:         "static",
+		TemplateDir:     "templates",
+	}
+
+	type handlerFunc func(http.ResponseWriter, *http.Request, *Config,
+		gorse.Store, *sessions.Session)
+
+	post := func(handler handlerFunc,
+		form url.Values) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodPost, "/rule_add",
+			strings.NewReader(form.Encode()))
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rw := httptest.NewRecorder()
+		handler(rw, request, settings, store, loggedInSession(t, request, userID))
+		return rw
+	}
+	rulesPage := func() string {
+		request := httptest.NewRequest(http.MethodGet, "/rules", nil)
+		rw := httptest.NewRecorder()
+		handlerRules(rw, request, settings, store,
+			loggedInSession(t, request, userID))
+		if rw.Code != http.StatusOK {
+			t.Fatalf("GET /rules = status %d: %q, wanted %d", rw.Code,
+				rw.Body.String(), http.StatusOK)
+		}
+		return rw.Body.String()
+	}
+
+	valid := url.Values{
+		"feed-id": {fmt.Sprintf("%d", videos)},
+		"field":   {"link"},
+		"match":   {"contains"},
+		"pattern": {"youtube.com"},
+		"action":  {"tag"},
+		"tag":     {"Video"},
+	}
+	// with gives the valid form with the keys set to other values.
+	with := func(keyValues ...string) url.Values {
+		form := url.Values{}
+		for k, v := range valid {
+			form[k] = v
+		}
+		for i := 0; i+1 < len(keyValues); i += 2 {
+			form.Set(keyValues[i], keyValues[i+1])
+		}
+		return form
+	}
+
+	for _, form := range []url.Values{
+		with("feed-id", "x"),
+		with("feed-id", fmt.Sprintf("%d", other)),
+		with("field", "author"),
+		with("match", "glob"),
+		with("action", "delete"),
+		with("pattern", " "),
+		with("tag", ""),
+		with("match", "regex", "pattern", "("),
+	} {
+		if rw := post(handlerRuleAdd, form); rw.Code != http.StatusBadRequest {
+			t.Errorf("%v: status = %d, wanted %d", form, rw.Code,
+				http.StatusBadRequest)
+		}
+	}
+
+	if body := rulesPage(); !strings.Contains(body, "Nothing yet.") {
+		t.Errorf("rules page = %q, wanted no rules", body)
+	}
+
+	rw := post(handlerRuleAdd, valid)
+	if rw.Code != http.StatusFound {
+		t.Fatalf("status = %d: %q, wanted %d", rw.Code, rw.Body.String(),
+			http.StatusFound)
+	}
+	if location := rw.Header().Get("Location"); location != "/gorse/rules" {
+		t.Errorf("Location = %s, wanted /gorse/rules", location)
+	}
+
+	rules, err := store.ListRules(ctx, userID)
+	if err != nil {
+		t.Fatalf("ListRules() = error %s", err)
+	}
+	if len(rules) != 1 || rules[0].FeedID != videos ||
+		rules[0].Field != gorse.LinkField || rules[0].Tag != "video" {
+		t.Fatalf("ListRules() = %+v, wanted the rule", rules)
+	}
+
+	body := rulesPage()
+	if !strings.Contains(body, "Videos") ||
+		!strings.Contains(body, "<code>youtube.com</code>") ||
+		!strings.Contains(body, "Tag: video") {
+		t.Errorf("rules page = %q, wanted the rule", body)
+	}
+
+	id := fmt.Sprintf("%d", rules[0].ID)
+	if rw := post(handlerRuleDelete, url.Values{
+		"rule-id": {id},
+	}); rw.Code != http.StatusFound {
+		t.Fatalf("status = %d, wanted %d", rw.Code, http.StatusFound)
+	}
+	if rw := post(handlerRuleDelete, url.Values{
+		"rule-id": {id},
+	}); rw.Code != http.StatusBadRequest {
+		t.Errorf("deleting again: status = %d, wanted %d", rw.Code,
+			http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gorilla/sessions"
+	"github.com/horgh/gorse"
+)
+
+// maxPageBytes is how much of a page we read, such as to find its title or
+// its article.
+const maxPageBytes = 2 << 20
+
+// pageTimeout is how long we wait for a page. We'd rather save a link without
+// its title than keep the user waiting.
+const pageTimeout = 10 * time.Second
+
+// handlerSave saves a link to the user's Saved feed to read later. It takes
+// the link in the url parameter, and optionally its title in title, by GET or
+// POST. We fetch the page to find its title and description.
+//
+// It implements the type RequestHandlerFunc.
+//
+// A bookmarklet can save the page you're on:
+//
+//	javascript:location.href='https://example.com/gorse/save?url='+
+//	  encodeURIComponent(location.href)+'&title='+
+//	  encodeURIComponent(document.title)
+func handlerSave(rw http.ResponseWriter, request *http.Request,
+	settings *Config, store gorse.Store, session *sessions.Session) {
+	if err := request.ParseForm(); err != nil {
+		logf(request, "Failed to parse form: %s", err)
+		if bodyTooLarge(err) {
+			send413Error(rw, tooLargeError(settings.maxFormBytes()))
+			return
+		}
+		send400Error(rw, "Failed to parse request")
+		return
+	}
+
+	userID, ok := sessionUser(rw, request, settings, session)
+	if !ok {
+		return
+	}
+
+	rawURL := request.FormValue("url")
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") ||
+		u.Host == "" {
+		logf(request, "Not saving invalid URL: %s", rawURL)
+		send400Error(rw, "The URL to save must be an http or https URL")
+		return
+	}
+
+	if _, err := saveLink(request, store, userID, u.String(),
+		request.FormValue("title")); err != nil {
+		logf(request, "Unable to save link: %s", err)
+		send500Error(rw, "Unable to save link")
+		return
+	}
+
+	session.AddFlash("Saved.")
+
+	if err := session.Save(request, rw); err != nil {
+		logf(request, "Unable to save session: %s", err)
+		send500Error(rw, "Failed to save your session.")
+		return
+	}
+
+	uri := fmt.Sprintf("%s/?read-state=%s", settings.URIPrefix,
+		url.QueryEscape(gorse.ReadLater.String()))
+
+	logf(request, "Redirecting to %s", uri)
+
+	http.Redirect(rw, request, uri, http.StatusFound)
+}
+
+// saveLink saves the page at the URL to the user's Saved feed. We fetch the
+// page to find its title and description. If we can't, we use the title
+// given. It returns the item's ID.
+func saveLink(request *http.Request, store gorse.Store, userID int, pageURL,
+	title string) (int64, error) {
+	link, err := fetchSavedLink(request.Context(), pageURL)
+	if err != nil {
+		// We can still save the link without its title.
+		logf(request, "Unable to find title of %s: %s", pageURL, err)
+	}
+	if link.Title == "" {
+		link.Title = title
+	}
+
+	var id int64
+	if err := store.InTx(request.Context(), func(store gorse.Store) error {
+		var err error
+		id, err = gorse.SaveLink(request.Context(), store, userID, link)
+		return err
+	}); err != nil {
+		return -1, err
+	}
+
+	logf(request, "Saved %s for user ID [%d]", link.URL, userID)
+
+	return id, nil
+}
+
+// fetchSavedLink fetches the page at the URL and finds its title and
+// description. If we can't, we return the link with just its URL along with
+// the error.
+func fetchSavedLink(ctx context.Context, pageURL string) (gorse.SavedLink,
+	error) {
+	link := gorse.SavedLink{URL: pageURL}
+
+	body, contentType, err := fetchPage(ctx, pageURL)
+	if err != nil {
+		return link, err
+	}
+
+	return gorse.ParseSavedLink(body, contentType, pageURL)
+}
+
+// fetchPage fetches the HTML page at the URL, such as one being saved. It
+// returns the page along with the Content-Type it was served with.
+func fetchPage(ctx context.Context, pageURL string) ([]byte, string, error) {
+	body, contentType, err := fetchURL(ctx, pageURL)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil &&
+		mediaType != "text/html" && mediaType != "application/xhtml+xml" {
+		return nil, "", fmt.Errorf("page is %s, not HTML", mediaType)
+	}
+
+	return body, contentType, nil
+}
+
+// fetchURL fetches the URL whatever it serves, up to maxPageBytes. It returns
+// the body along with the Content-Type it was served with.
+func fetchURL(ctx context.Context, pageURL string) ([]byte, string, error) {
+	ctx, cancel := context.WithTimeout(ctx, pageTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, pageURL, nil)
+	if err != nil {
+		return nil, "", fmt.Errorf("creating request: %s", err)
+	}
+	req.Header.Set("User-Agent", "gorse")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("status %s", resp.Status)
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxPageBytes))
+	if err != nil {
+		return nil, "", fmt.Errorf("reading body: %s", err)
+	}
+
+	return body, resp.Header.Get("Content-Type"), nil
+}
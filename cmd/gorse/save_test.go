@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/sessions"
+	"github.com/horgh/gorse"
+	"github.com/horgh/gorse/internal/gorsetest"
+)
+
+func TestHandlerSaveIntegration(t *testing.T) {
+	for _, dbType := range gorsetest.Types {
+		t.Run(dbType, func(t *testing.T) {
+			testHandlerSaveIntegration(t, dbType)
+		})
+	}
+}
+
+func testHandlerSaveIntegration(t *testing.T, dbType string) {
+	store, _ := gorsetest.Store(t, dbType)
+
+	loaded := gorsetest.Load(t, store, gorsetest.Fixture{
+		Users: []gorsetest.User{
+			{Email: "user@example.com", Password: "password"},
+		},
+	})
+	userID := loaded.Users["user@example.com"]
+
+	page := httptest.NewServer(http.HandlerFunc(
+		func(rw http.ResponseWriter, request *http.Request) {
+			rw.Header().Set("Content-Type", "text/html; charset=utf-8")
+			_, _ = fmt.Fprint(rw, `<html><head><title>An article</title>
+<meta name="description" content="What it's about"></head></html>`)
+		}))
+	defer page.Close()
+
+	sessionStore := sessions.NewCookieStore([]byte(strings.Repeat("k", 32)))
+
+	save := func(method, pageURL string) *httptest.ResponseRecorder {
+		form := url.Values{}
+		form.Set("url", pageURL)
+		form.Set("title", "Title from the bookmarklet")
+
+		var request *http.Request
+		if method == http.MethodGet {
+			request = httptest.NewRequest(method, "/save?"+form.Encode(), nil)
+		} else {
+			request = httptest.NewRequest(method, "/save",
+				strings.NewReader(form.Encode()))
+			request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+
+		session, err := sessionStore.New(request, "gorse")
+		if err != nil {
+			t.Fatalf("creating session: %s", err)
+		}
+		session.Values[sessionUserKey] = userID
+
+		rw := httptest.NewRecorder()
+		handlerSave(rw, request, &Config{}, store, session)
+		return rw
+	}
+
+	rw := save(http.MethodGet, page.URL+"/article")
+	if rw.Code != http.StatusFound {
+		t.Fatalf("handlerSave() = status %d, wanted %d: %s", rw.Code,
+			http.StatusFound, rw.Body.String())
+	}
+	if location := rw.Header().Get("Location"); !strings.Contains(location,
+		"read-state=read-later") {
+		t.Errorf("handlerSave() redirected to %s, wanted read later", location)
+	}
+
+	// A page we can't fetch we save with the title we were given.
+	gone := "http://127.0.0.1:1/gone"
+	rw = save(http.MethodPost, gone)
+	if rw.Code != http.StatusFound {
+		t.Fatalf("handlerSave() of unreachable page = status %d, wanted %d: %s",
+			rw.Code, http.StatusFound, rw.Body.String())
+	}
+
+	readLater := gorse.ReadLater
+	items, err := store.FindItems(context.Background(), gorse.ItemFilter{
+		UserID: userID,
+		State:  &readLater,
+		Limit:  10,
+	})
+	if err != nil {
+		t.Fatalf("FindItems() = error %s", err)
+	}
+	titles := map[string]string{}
+	for _, item := range items {
+		titles[item.Link] = item.Title
+	}
+	if len(items) != 2 || titles[page.URL+"/article"] != "An article" ||
+		titles[gone] != "Title from the bookmarklet" {
+		t.Errorf("saved items = %v, wanted both with their titles", titles)
+	}
+
+	rw = save(http.MethodGet, "javascript:alert(1)")
+	if rw.Code != http.StatusBadRequest {
+		t.Errorf("handlerSave() of javascript URL = status %d, wanted %d",
+			rw.Code, http.StatusBadRequest)
+	}
+}
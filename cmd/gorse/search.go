@@ -0,0 +1,187 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/sessions"
+	"github.com/horgh/gorse"
+)
+
+// handlerSearch finds items with all of the words in q in their title or
+// description, best matches first.
+//
+// It implements the type RequestHandlerFunc.
+//
+// The search may be scoped. feed-id limits it to one feed, and read-state to
+// items in that state, such as read-later to search only the items the user
+// saved. The results have pages like the list of items, and the links to
+// other pages keep the scope.
+func handlerSearch(rw http.ResponseWriter, request *http.Request,
+	settings *Config, store gorse.Store, session *sessions.Session) {
+	requestValues := request.URL.Query()
+
+	userID, ok := sessionUser(rw, request, settings, session)
+	if !ok {
+		return
+	}
+
+	var err error
+
+	page := 1
+	if pageStr := requestValues.Get("page"); pageStr != "" {
+		if page, err = strconv.Atoi(pageStr); err != nil || page < 1 {
+			logf(request, "Bad page: %s", pageStr)
+			send400Error(rw, "Bad page")
+			return
+		}
+	}
+
+	filter := gorse.ItemFilter{
+		UserID:     userID,
+		Search:     strings.TrimSpace(requestValues.Get("q")),
+		Subscribed: true,
+		Limit:      pageSize,
+		Offset:     (page - 1) * pageSize,
+	}
+
+	if feedIDStr := requestValues.Get("feed-id"); feedIDStr != "" {
+		if filter.FeedID, err = strconv.ParseInt(feedIDStr, 10, 64); err != nil {
+			logf(request, "Bad feed ID: %s: %s", feedIDStr, err)
+			send400Error(rw, "Bad feed ID")
+			return
+		}
+	}
+
+	state := requestValues.Get("read-state")
+	if state != "" {
+		readState, err := gorse.ParseReadState(state)
+		if err != nil {
+			logf(request, "Bad read state: %s", state)
+			send400Error(rw, "Bad read state")
+			return
+		}
+		filter.State = &readState
+	}
+
+	user, err := store.GetUser(request.Context(), userID)
+	if err != nil {
+		logf(request, "Unable to look up user: %s", err)
+		send500Error(rw, "Unable to look up user")
+		return
+	}
+	locale := userLocale(request, user)
+
+	location, err := time.LoadLocation(settings.DisplayTimeZone)
+	if err != nil {
+		logf(request, "Failed to load time zone location [%s]: %s",
+			settings.DisplayTimeZone, err)
+		send500Error(rw, "Unable to load timezone information")
+		return
+	}
+
+	feeds, err := store.ListSubscriptions(request.Context(), userID)
+	if err != nil {
+		logf(request, "Unable to retrieve subscriptions: %s", err)
+		send500Error(rw, "Unable to retrieve subscriptions")
+		return
+	}
+
+	// Without words there's nothing to search for. We show the form.
+	var items []gorse.UserItem
+	total := 0
+	if filter.Search != "" {
+		if items, err = store.SearchItems(request.Context(), filter); err != nil {
+			logf(request, "Unable to search items: %s", err)
+			send500Error(rw, "Unable to search items")
+			return
+		}
+		if total, err = store.CountItems(request.Context(), filter); err != nil {
+			logf(request, "Unable to count items: %s", err)
+			send500Error(rw, "Unable to count items")
+			return
+		}
+	}
+
+	type HTMLItem struct {
+		ID                  int64
+		FeedName            string
+		Title               string
+		Link                string
+		PublicationDate     string
+		FullPublicationDate string
+		ReadState           string
+	}
+
+	var htmlItems []HTMLItem
+	for _, item := range items {
+		pubDate, fullPubDate := formatDate(locale, user, item.PublicationDate,
+			location)
+		htmlItems = append(htmlItems, HTMLItem{
+			ID:                  item.ID,
+			FeedName:            item.FeedName,
+			Title:               sanitiseItemText(item.Title),
+			Link:                item.Link,
+			PublicationDate:     pubDate,
+			FullPublicationDate: fullPubDate,
+			ReadState:           item.ReadState.String(),
+		})
+	}
+
+	type HTMLFeed struct {
+		ID       int64
+		Name     string
+		Selected bool
+	}
+
+	var htmlFeeds []HTMLFeed
+	for _, feed := range feeds {
+		htmlFeeds = append(htmlFeeds, HTMLFeed{
+			ID:       feed.ID,
+			Name:     feed.Name,
+			Selected: feed.ID == filter.FeedID,
+		})
+	}
+
+	nextPage := -1
+	if page < int(math.Ceil(float64(total)/float64(pageSize))) {
+		nextPage = page + 1
+	}
+
+	type SearchPage struct {
+		Query        string
+		FeedID       int64
+		Feeds        []HTMLFeed
+		State        string
+		Items        []HTMLItem
+		TotalItems   int
+		Page         int
+		NextPage     int
+		PreviousPage int
+		Path         string
+		UserID       int
+		ReadState    gorse.ReadState
+	}
+
+	if err := renderPage(settings, rw, locale, "_search", SearchPage{
+		Query:        filter.Search,
+		FeedID:       filter.FeedID,
+		Feeds:        htmlFeeds,
+		State:        state,
+		Items:        htmlItems,
+		TotalItems:   total,
+		Page:         page,
+		NextPage:     nextPage,
+		PreviousPage: page - 1,
+		Path:         settings.URIPrefix,
+		UserID:       userID,
+		ReadState:    gorse.Unread,
+	}); err != nil {
+		logf(request, "Failure rendering page: %s", err)
+		send500Error(rw, "Failed to render page")
+		return
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/sessions"
+	"github.com/horgh/gorse"
+	"github.com/horgh/gorse/internal/gorsetest"
+	"github.com/horgh/rss"
+)
+
+func TestHandlerSearchIntegration(t *testing.T) {
+	for _, dbType := range gorsetest.Types {
+		t.Run(dbType, func(t *testing.T) {
+			testHandlerSearchIntegration(t, dbType)
+		})
+	}
+}
+
+func testHandlerSearchIntegration(t *testing.T, dbType string) {
+	store, _ := gorsetest.Store(t, dbType)
+
+	now := time.Now()
+	var items []rss.Item
+	for i := 0; i < pageSize+1; i++ {
+		items = append(items, rss.Item{
+			Title:   fmt.Sprintf("Tomatoes %d", i),
+			Link:    fmt.Sprintf("https://example.com/gardening/%d", i),
+			PubDate: now.Add(-time.Duration(i) * time.Minute),
+		})
+	}
+
+	loaded := gorsetest.Load(t, store, gorsetest.Fixture{
+		Users: []gorsetest.User{
+			{Email: "user@example.com", Password: "password"},
+		},
+		Feeds: []gorsetest.Feed{
+			{
+				DBFeed: gorse.DBFeed{
+					Name:                   "Gardening",
+					URI:                    "https://example.com/gardening",
+					UpdateFrequencySeconds: 3600,
+					Active:                 true,
+				},
+				Items:       items,
+				Subscribers: []string{"user@example.com"},
+			},
+			{
+				DBFeed: gorse.DBFeed{
+					Name:                   "Cooking",
+					URI:                    "https://example.com/cooking",
+					UpdateFrequencySeconds: 3600,
+					Active:                 true,
+				},
+				Items: []rss.Item{
+					{
+						Title:   "Roasting tomatoes",
+						Link:    "https://example.com/cooking/1",
+						PubDate: now,
+					},
+				},
+				Subscribers: []string{"user@example.com"},
+			},
+		},
+	})
+	userID := loaded.Users["user@example.com"]
+	gardeningID := loaded.Feeds["https://example.com/gardening"]
+
+	settings := &Config{
+		URIPrefix:       "/gorse",
+		DisplayTimeZone: "UTC",
+		WebRoot:         "static",
+		TemplateDir:     "templates",
+	}
+	sessionStore := sessions.NewCookieStore([]byte(strings.Repeat("k", 32)))
+
+	get := func(query string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodGet,
+			"/search?"+query, nil)
+		session, err := sessionStore.New(request, "gorse")
+		if err != nil {
+			t.Fatalf("creating session: %s", err)
+		}
+		session.Values[sessionUserKey] = userID
+		rw := httptest.NewRecorder()
+		handlerSearch(rw, request, settings, store, session)
+		return rw
+	}
+
+	rw := get("q=tomatoes")
+	if rw.Code != http.StatusOK {
+		t.Fatalf("GET = status %d: %s, wanted %d", rw.Code, rw.Body.String(),
+			http.StatusOK)
+	}
+	if body := rw.Body.String(); !strings.Contains(body, "52 matching items.") {
+		t.Errorf("GET = %s, wanted items from both feeds", body)
+	}
+
+	rw = get(fmt.Sprintf("q=tomatoes&feed-id=%d", gardeningID))
+	if rw.Code != http.StatusOK {
+		t.Fatalf("GET feed = status %d: %s, wanted %d", rw.Code,
+			rw.Body.String(), http.StatusOK)
+	}
+	body := rw.Body.String()
+	next := fmt.Sprintf("q=tomatoes&amp;feed-id=%d&amp;read-state=&amp;page=2",
+		gardeningID)
+	if !strings.Contains(body, "51 matching items.") ||
+		strings.Contains(body, "Roasting") || !strings.Contains(body, next) {
+		t.Errorf("GET feed = %s, wanted the feed's items and a next page in it",
+			body)
+	}
+
+	rw = get(fmt.Sprintf("q=tomatoes&feed-id=%d&page=2", gardeningID))
+	if body := rw.Body.String(); rw.Code != http.StatusOK ||
+		!strings.Contains(body, ">Tomatoes 50<") {
+		t.Errorf("GET page 2 = status %d: %s, wanted the last item", rw.Code,
+			body)
+	}
+
+	rw = get("q=tomatoes&read-state=read-later")
+	if body := rw.Body.String(); rw.Code != http.StatusOK ||
+		!strings.Contains(body, "0 matching items.") {
+		t.Errorf("GET read later = status %d: %s, wanted no items", rw.Code,
+			body)
+	}
+
+	for _, query := range []string{"&read-state=saved", "&feed-id=x",
+		"&page=0"} {
+		if rw := get("q=tomatoes" + query); rw.Code != http.StatusBadRequest {
+			t.Errorf("GET %s = status %d, wanted %d", query, rw.Code,
+				http.StatusBadRequest)
+		}
+	}
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/sessions"
+	"github.com/horgh/gorse"
+	"github.com/horgh/gorse/internal/sendto"
+)
+
+// handlerSendTo sends an item to one of the user's integrations, such as
+// Pocket. If they set the integration to, we then set the item read.
+//
+// It implements the type RequestHandlerFunc.
+//
+// Like handlerUpdateReadFlags, we redirect back to the list of items after.
+func handlerSendTo(rw http.ResponseWriter, request *http.Request,
+	settings *Config, store gorse.Store, session *sessions.Session) {
+	if err := request.ParseForm(); err != nil {
+		logf(request, "Failed to parse form: %s", err)
+		if bodyTooLarge(err) {
+			send413Error(rw, tooLargeError(settings.maxFormBytes()))
+			return
+		}
+		send400Error(rw, "Failed to parse request")
+		return
+	}
+
+	userID, ok := sessionUser(rw, request, settings, session)
+	if !ok {
+		return
+	}
+
+	// The user is the one changing the item's state.
+	request = request.WithContext(gorse.WithActor(request.Context(), userID))
+
+	readState := gorse.Unread
+	if request.PostForm.Get("read-state") == "read-later" {
+		readState = gorse.ReadLater
+	}
+
+	itemIDStr := request.PostForm.Get("item-id")
+	itemID, err := strconv.ParseInt(itemIDStr, 10, 64)
+	if err != nil {
+		logf(request, "Bad item ID: %s: %s", itemIDStr, err)
+		send400Error(rw, "Bad item ID")
+		return
+	}
+
+	service := request.PostForm.Get("service")
+	integration, err := store.GetIntegration(request.Context(), userID,
+		service)
+	if err != nil {
+		if err == gorse.ErrNotFound {
+			logf(request, "User has no %s integration", service)
+			send400Error(rw, "You haven't set up sending to "+
+				sendto.Name(service))
+			return
+		}
+		logf(request, "Unable to look up integration: %s", err)
+		send500Error(rw, "Unable to look up integration")
+		return
+	}
+
+	item, err := store.GetItem(request.Context(), itemID, userID)
+	if err != nil {
+		logf(request, "Unable to look up item %d: %s", itemID, err)
+		send500Error(rw, "Unable to look up item")
+		return
+	}
+
+	if err := sendto.Send(request.Context(), http.DefaultClient, *integration,
+		item.Link, sanitiseItemText(item.Title)); err != nil {
+		logf(request, "Unable to send item %d to %s: %s", itemID, service, err)
+		send500Error(rw, "Unable to send to "+sendto.Name(service))
+		return
+	}
+
+	logf(request, "Sent item %d to %s", itemID, service)
+
+	if integration.MarkRead {
+		if err := markItemsRead(request.Context(), store, []int64{itemID},
+			userID); err != nil {
+			logf(request, "Unable to mark item read: %s", err)
+			send500Error(rw, "Unable to update read flags")
+			return
+		}
+	}
+
+	session.AddFlash("Sent.")
+
+	if err := session.Save(request, rw); err != nil {
+		logf(request, "Unable to save session: %s", err)
+		send500Error(rw, "Failed to save your session.")
+		return
+	}
+
+	uri := fmt.Sprintf("%s/?read-state=%s&page=%s",
+		settings.URIPrefix,
+		url.QueryEscape(readState.String()),
+		url.QueryEscape(request.PostForm.Get("page")),
+	)
+	uri += listViewParams(request.PostForm)
+
+	logf(request, "Redirecting to %s", uri)
+
+	http.Redirect(rw, request, uri, http.StatusFound)
+}
+
+// parseIntegration makes an integration with the service from settings such
+// as access-token=abc. See the set-integration command.
+func parseIntegration(service string, settings []string) (gorse.Integration,
+	error) {
+	integration := gorse.Integration{Service: service}
+
+	for _, setting := range settings {
+		i := strings.Index(setting, "=")
+		if i == -1 {
+			return gorse.Integration{}, fmt.Errorf(
+				"setting must be in the form key=value: %s", setting)
+		}
+		key, value := setting[:i], setting[i+1:]
+
+		switch key {
+		case "url":
+			integration.URL = value
+		case "client-id", "consumer-key":
+			integration.ClientID = value
+		case "client-secret":
+			integration.ClientSecret = value
+		case "username":
+			integration.Username = value
+		case "password":
+			integration.Password = value
+		case "access-token":
+			integration.AccessToken = value
+		case "mark-read":
+			markRead, err := strconv.ParseBool(value)
+			if err != nil {
+				return gorse.Integration{}, fmt.Errorf(
+					"mark-read must be true or false: %s", value)
+			}
+			integration.MarkRead = markRead
+		default:
+			return gorse.Integration{}, fmt.Errorf("unknown setting: %s", key)
+		}
+	}
+
+	if err := sendto.Check(integration); err != nil {
+		return gorse.Integration{}, err
+	}
+
+	return integration, nil
+}
+
+// setIntegration sets up the user with the email to send items to the
+// service. settings are as parseIntegration takes. It replaces any settings
+// they had for the service.
+func setIntegration(ctx context.Context, settings *Config, email,
+	service string, integrationSettings []string) error {
+	integration, err := parseIntegration(service, integrationSettings)
+	if err != nil {
+		return err
+	}
+
+	db, err := connectToDB(settings)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := db.Close(); err != nil {
+			log.Printf("Database close: %s", err)
+		}
+	}()
+
+	user, err := findUserByEmail(ctx, db, email)
+	if err != nil {
+		return err
+	}
+
+	integration.UserID = user.ID
+	return gorse.SetIntegration(ctx, db, integration)
+}
+
+// removeIntegration stops the user with the email sending items to the
+// service and forgets their settings for it.
+func removeIntegration(ctx context.Context, settings *Config, email,
+	service string) error {
+	db, err := connectToDB(settings)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := db.Close(); err != nil {
+			log.Printf("Database close: %s", err)
+		}
+	}()
+
+	user, err := findUserByEmail(ctx, db, email)
+	if err != nil {
+		return err
+	}
+
+	if err := gorse.DeleteIntegration(ctx, db, user.ID,
+		service); err != nil {
+		if err == gorse.ErrNotFound {
+			return fmt.Errorf("%s has no %s integration", email, service)
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/sessions"
+	"github.com/horgh/gorse"
+	"github.com/horgh/gorse/internal/gorsetest"
+	"github.com/horgh/rss"
+)
+
+func TestHandlerSendToIntegration(t *testing.T) {
+	for _, dbType := range gorsetest.Types {
+		t.Run(dbType, func(t *testing.T) {
+			testHandlerSendToIntegration(t, dbType)
+		})
+	}
+}
+
+func testHandlerSendToIntegration(t *testing.T, dbType string) {
+	ctx := context.Background()
+	store, _ := gorsetest.Store(t, dbType)
+
+	loaded := gorsetest.Load(t, store, gorsetest.Fixture{
+		Users: []gorsetest.User{
+			{Email: "user@example.com", Password: "password"},
+		},
+		Feeds: []gorsetest.Feed{
+			{
+				DBFeed: gorse.DBFeed{
+					Name:                   "Example",
+					URI:                    "https://example.com/feed",
+					UpdateFrequencySeconds: 3600,
+					Active:                 true,
+				},
+				Items: []rss.Item{
+					{Title: "One &amp; only", Link: "https://example.com/1",
+						PubDate: time.Now()},
+				},
+				Subscribers: []string{"user@example.com"},
+			},
+		},
+	})
+	userID := loaded.Users["user@example.com"]
+	itemID := loaded.Items["https://example.com/1"]
+
+	var sent map[string]string
+	pocket := httptest.NewServer(http.HandlerFunc(
+		func(rw http.ResponseWriter, request *http.Request) {
+			if err := json.NewDecoder(request.Body).Decode(&sent); err != nil {
+				t.Errorf("request is not JSON: %s", err)
+			}
+			_, _ = rw.Write([]byte(`{"status":1}`))
+		}))
+	defer pocket.Close()
+
+	sessionStore := sessions.NewCookieStore([]byte(strings.Repeat("k", 32)))
+
+	sendTo := func(service string) *httptest.ResponseRecorder {
+		form := url.Values{}
+		form.Set("item-id", fmt.Sprintf("%d", itemID))
+		form.Set("service", service)
+		form.Set("page", "2")
+
+		request := httptest.NewRequest(http.MethodPost, "/send_to",
+			strings.NewReader(form.Encode()))
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		session, err := sessionStore.New(request, "gorse")
+		if err != nil {
+			t.Fatalf("creating session: %s", err)
+		}
+		session.Values[sessionUserKey] = userID
+
+		rw := httptest.NewRecorder()
+		handlerSendTo(rw, request, &Config{}, store, session)
+		return rw
+	}
+
+	rw := sendTo("pocket")
+	if rw.Code != http.StatusBadRequest {
+		t.Errorf("handlerSendTo() without integration = status %d, wanted %d",
+			rw.Code, http.StatusBadRequest)
+	}
+
+	if err := store.SetIntegration(ctx, gorse.Integration{
+		UserID:      userID,
+		Service:     "pocket",
+		URL:         pocket.URL,
+		ClientID:    "key",
+		AccessToken: "token",
+		MarkRead:    true,
+	}); err != nil {
+		t.Fatalf("SetIntegration() = error %s", err)
+	}
+
+	rw = sendTo("pocket")
+	if rw.Code != http.StatusFound {
+		t.Fatalf("handlerSendTo() = status %d, wanted %d: %s", rw.Code,
+			http.StatusFound, rw.Body.String())
+	}
+	if location := rw.Header().Get("Location"); !strings.Contains(location,
+		"page=2") {
+		t.Errorf("handlerSendTo() redirected to %s, wanted back to page 2",
+			location)
+	}
+	if sent["url"] != "https://example.com/1" || sent["title"] != "One & only" {
+		t.Errorf("Pocket got %v, wanted the item", sent)
+	}
+
+	item, err := store.GetItem(ctx, itemID, userID)
+	if err != nil {
+		t.Fatalf("GetItem() = error %s", err)
+	}
+	if item.ReadState != gorse.Read {
+		t.Errorf("item is %s after sending, wanted %s", item.ReadState,
+			gorse.Read)
+	}
+}
+
+func TestParseIntegration(t *testing.T) {
+	tests := []struct {
+		Service  string
+		Settings []string
+		Want     gorse.Integration
+		OK       bool
+	}{
+		{
+			"pocket",
+			[]string{"consumer-key=k", "access-token=a=b", "mark-read=true"},
+			gorse.Integration{Service: "pocket", ClientID: "k",
+				AccessToken: "a=b", MarkRead: true},
+			true,
+		},
+		{
+			"wallabag",
+			[]string{"url=https://w.example.com", "client-id=i",
+				"client-secret=s", "username=u", "password=p"},
+			gorse.Integration{Service: "wallabag", URL: "https://w.example.com",
+				ClientID: "i", ClientSecret: "s", Username: "u", Password: "p"},
+			true,
+		},
+		{"pocket", []string{"consumer-key=k"}, gorse.Integration{}, false},
+		{"pocket", []string{"consumer-key"}, gorse.Integration{}, false},
+		{"pocket", []string{"consumer-key=k", "access-token=a", "colour=red"},
+			gorse.Integration{}, false},
+		{"pocket", []string{"consumer-key=k", "access-token=a", "mark-read=y"},
+			gorse.Integration{}, false},
+	}
+
+	for _, test := range tests {
+		got, err := parseIntegration(test.Service, test.Settings)
+		if !test.OK {
+			if err == nil {
+				t.Errorf("parseIntegration(%s, %q) succeeded, wanted an error",
+					test.Service, test.Settings)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseIntegration(%s, %q) = error %s", test.Service,
+				test.Settings, err)
+			continue
+		}
+		if got != test.Want {
+			t.Errorf("parseIntegration(%s, %q) = %+v, wanted %+v", test.Service,
+				test.Settings, got, test.Want)
+		}
+	}
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/sessions"
+	"github.com/horgh/gorse"
+	"github.com/horgh/rss"
+)
+
+// sharedFeedSize is how many items the feed of items a user starred has.
+const sharedFeedSize = 50
+
+// handlerSharedFeed serves the feed of items a user starred, if they publish
+// it, so that friends can follow what they find interesting. The path is
+// /shared/<token>.rss for RSS or /shared/<token>.atom for Atom.
+//
+// It implements the type RequestHandlerFunc.
+//
+// Anyone with the URL can see the feed, so we leave out what's private, such
+// as the user's notes.
+func handlerSharedFeed(rw http.ResponseWriter, request *http.Request,
+	settings *Config, store gorse.Store, session *sessions.Session) {
+	name := path.Base(request.URL.Path)
+	format := path.Ext(name)
+	token := strings.TrimSuffix(name, format)
+
+	user, err := store.UserByShareToken(request.Context(), token)
+	if err != nil {
+		if err == gorse.ErrNotFound {
+			logf(request, "No shared feed with the token.")
+			http.NotFound(rw, request)
+			return
+		}
+		logf(request, "Unable to look up user by share token: %s", err)
+		send500Error(rw, "Unable to look up feed")
+		return
+	}
+	setRequestUser(request, user.ID)
+
+	items, err := store.SharedItems(request.Context(), user.ID, sharedFeedSize)
+	if err != nil {
+		logf(request, "Unable to retrieve shared items: %s", err)
+		send500Error(rw, "Unable to retrieve items")
+		return
+	}
+
+	var itemIDs []int64
+	for _, item := range items {
+		itemIDs = append(itemIDs, item.ID)
+	}
+	enclosures, err := store.ItemEnclosures(request.Context(), itemIDs)
+	if err != nil {
+		logf(request, "Unable to retrieve enclosures: %s", err)
+		send500Error(rw, "Unable to retrieve items")
+		return
+	}
+	categories, err := store.ItemCategories(request.Context(), itemIDs)
+	if err != nil {
+		logf(request, "Unable to retrieve categories: %s", err)
+		send500Error(rw, "Unable to retrieve items")
+		return
+	}
+	contents, err := store.FullTextContents(request.Context(), itemIDs)
+	if err != nil {
+		logf(request, "Unable to retrieve full text contents: %s", err)
+		send500Error(rw, "Unable to retrieve items")
+		return
+	}
+
+	feed := gorse.Feed{
+		Title: "Starred items",
+		Link: requestBaseURL(request) + settings.URIPrefix +
+			request.URL.Path,
+		Description: "Items starred in gorse.",
+		PubDate:     time.Now(),
+	}
+	// Each item's author is the feed it's from, as we don't know more.
+	for _, item := range items {
+		feed.Items = append(feed.Items, gorse.Item{
+			Item: rss.Item{
+				Title:       sanitiseItemText(item.Title),
+				Link:        item.Link,
+				Description: item.Description,
+				PubDate:     item.PublicationDate,
+			},
+			Enclosures: enclosures[item.ID],
+			Categories: categories[item.ID],
+			Author:     item.FeedName,
+			Content:    contents[item.ID],
+		})
+	}
+
+	var buf bytes.Buffer
+	contentType := "application/rss+xml"
+	write := gorse.WriteRSS
+	if format == ".atom" {
+		contentType = "application/atom+xml"
+		write = gorse.WriteAtom
+	}
+	if err := write(&buf, feed); err != nil {
+		logf(request, "Unable to write shared feed: %s", err)
+		send500Error(rw, "Unable to write feed")
+		return
+	}
+
+	rw.Header().Set("Content-Type", contentType+"; charset=utf-8")
+	if _, err := rw.Write(buf.Bytes()); err != nil {
+		logf(request, "Unable to write shared feed response: %s", err)
+	}
+}
+
+// requestBaseURL is the scheme and host the request was to, such as
+// https://gorse.example.com.
+//
+// We may be behind a proxy that speaks TLS for us, so we believe
+// X-Forwarded-Proto. At worst we give the wrong scheme in a link.
+func requestBaseURL(request *http.Request) string {
+	scheme := "http"
+	if request.TLS != nil ||
+		request.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + request.Host
+}
+
+// handlerShareItem sets whether an item the user starred is in the feed of
+// items they starred. shared is 1 to put it in and 0 to leave it out.
+//
+// It implements the type RequestHandlerFunc.
+//
+// Like handlerUpdateReadFlags, we redirect back to the list of items after.
+func handlerShareItem(rw http.ResponseWriter, request *http.Request,
+	settings *Config, store gorse.Store, session *sessions.Session) {
+	if err := request.ParseForm(); err != nil {
+		logf(request, "Failed to parse form: %s", err)
+		if bodyTooLarge(err) {
+			send413Error(rw, tooLargeError(settings.maxFormBytes()))
+			return
+		}
+		send400Error(rw, "Failed to parse request")
+		return
+	}
+
+	userID, ok := sessionUser(rw, request, settings, session)
+	if !ok {
+		return
+	}
+
+	itemIDStr := request.PostForm.Get("item-id")
+	itemID, err := strconv.ParseInt(itemIDStr, 10, 64)
+	if err != nil {
+		logf(request, "Bad item ID: %s: %s", itemIDStr, err)
+		send400Error(rw, "Bad item ID")
+		return
+	}
+
+	shared := request.PostForm.Get("shared") == "1"
+
+	if err := store.SetItemShared(gorse.WithActor(request.Context(), userID),
+		itemID, userID, shared); err != nil {
+		if err == gorse.ErrNotFound {
+			logf(request, "Item %d is not starred", itemID)
+			send400Error(rw, "Only starred items can be shared")
+			return
+		}
+		logf(request, "Unable to set whether item %d is shared: %s", itemID, err)
+		send500Error(rw, "Unable to update item")
+		return
+	}
+
+	logf(request, "Set item %d shared: %t", itemID, shared)
+
+	uri := fmt.Sprintf("%s/?read-state=%s&page=%s",
+		settings.URIPrefix,
+		url.QueryEscape(listReadState(request.PostForm).String()),
+		url.QueryEscape(request.PostForm.Get("page")),
+	)
+	uri += listViewParams(request.PostForm)
+
+	logf(request, "Redirecting to %s", uri)
+
+	http.Redirect(rw, request, uri, http.StatusFound)
+}
+
+// newToken generates a token for the URL of a user's shared feed.
+func newToken() (string, error) {
+	// 256 bits. We use the URL safe alphabet so tokens can go in URLs as they
+	// are.
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("unable to generate token: %s", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// shareStarred starts or stops publishing the feed of items the user with the
+// email starred. on starts it, and off stops it. When starting, we print where
+// the feed is.
+//
+// Starting again gives the feed a new URL, such as if too many people have
+// the old one.
+func shareStarred(ctx context.Context, settings *Config, email,
+	onOff string) error {
+	var token string
+	switch onOff {
+	case "on":
+		var err error
+		if token, err = newToken(); err != nil {
+			return err
+		}
+	case "off":
+	default:
+		return fmt.Errorf("say on or off, not %s", onOff)
+	}
+
+	db, err := connectToDB(settings)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := db.Close(); err != nil {
+			log.Printf("Database close: %s", err)
+		}
+	}()
+
+	user, err := findUserByEmail(ctx, db, email)
+	if err != nil {
+		return err
+	}
+
+	if err := gorse.SetShareToken(ctx, db, user.ID, token); err != nil {
+		return err
+	}
+
+	if token == "" {
+		fmt.Println("Stopped publishing starred items.")
+		return nil
+	}
+	fmt.Printf("Publishing starred items at %s/shared/%s.rss, or .atom for "+
+		"Atom.\n", settings.URIPrefix, token)
+	return nil
+}
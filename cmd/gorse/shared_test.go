@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/sessions"
+	"github.com/horgh/gorse"
+	"github.com/horgh/gorse/internal/gorsetest"
+	"github.com/horgh/rss"
+)
+
+func TestHandlerSharedFeedIntegration(t *testing.T) {
+	for _, dbType := range gorsetest.Types {
+		t.Run(dbType, func(t *testing.T) {
+			testHandlerSharedFeedIntegration(t, dbType)
+		})
+	}
+}
+
+func testHandlerSharedFeedIntegration(t *testing.T, dbType string) {
+	ctx := context.Background()
+	store, _ := gorsetest.Store(t, dbType)
+
+	loaded := gorsetest.Load(t, store, gorsetest.Fixture{
+		Users: []gorsetest.User{
+			{Email: "user@example.com", Password: "password"},
+		},
+		Feeds: []gorsetest.Feed{
+			{
+				DBFeed: gorse.DBFeed{
+					Name:                   "Example",
+					URI:                    "https://example.com/feed",
+					UpdateFrequencySeconds: 3600,
+					Active:                 true,
+				},
+				Items: []rss.Item{
+					{Title: "One &amp; only", Link: "https://example.com/1",
+						PubDate: time.Now()},
+				},
+				Subscribers: []string{"user@example.com"},
+			},
+		},
+	})
+	userID := loaded.Users["user@example.com"]
+	one := loaded.Items["https://example.com/1"]
+
+	enclosures := []gorse.Enclosure{
+		{URL: "https://example.com/2.mp3", Type: "audio/mpeg", Length: 100},
+	}
+	two, err := store.AddItem(ctx, loaded.Feeds["https://example.com/feed"],
+		&gorse.Item{
+			Item: rss.Item{Title: "Two", Link: "https://example.com/2",
+				PubDate: time.Now()},
+			Enclosures: enclosures,
+			Categories: []string{"News"},
+		})
+	if err != nil {
+		t.Fatalf("AddItem() = error %s", err)
+	}
+
+	for _, id := range []int64{one, two} {
+		if err := store.SetItemStarred(ctx, id, userID, true); err != nil {
+			t.Fatalf("SetItemStarred() = error %s", err)
+		}
+	}
+	// Notes need a read state.
+	if err := store.SetItemsReadState(ctx, []int64{one}, userID,
+		gorse.Read); err != nil {
+		t.Fatalf("SetItemsReadState() = error %s", err)
+	}
+	if err := store.SetItemNote(ctx, one, userID, "Private"); err != nil {
+		t.Fatalf("SetItemNote() = error %s", err)
+	}
+	if err := store.SetShareToken(ctx, userID, "token"); err != nil {
+		t.Fatalf("SetShareToken() = error %s", err)
+	}
+
+	settings := &Config{URIPrefix: "/gorse"}
+	sessionStore := sessions.NewCookieStore([]byte(strings.Repeat("k", 32)))
+
+	serve := func(handler func(http.ResponseWriter, *http.Request, *Config,
+		gorse.Store, *sessions.Session), method, path string,
+		form url.Values) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(method, path,
+			strings.NewReader(form.Encode()))
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		session, err := sessionStore.New(request, "gorse")
+		if err != nil {
+			t.Fatalf("creating session: %s", err)
+		}
+		session.Values[sessionUserKey] = userID
+		rw := httptest.NewRecorder()
+		handler(rw, request, settings, store, session)
+		return rw
+	}
+
+	sharedFeed := func(path string) *gorse.Feed {
+		rw := serve(handlerSharedFeed, http.MethodGet, path, nil)
+		if rw.Code != http.StatusOK {
+			t.Fatalf("GET %s = status %d, wanted %d", path, rw.Code, http.StatusOK)
+		}
+		feed, err := gorse.ParseFeed(rw.Body.Bytes(), gorse.ParseOptions{
+			ContentType: rw.Header().Get("Content-Type"),
+		})
+		if err != nil {
+			t.Fatalf("GET %s = %s, wanted a feed: %s", path, rw.Body.String(), err)
+		}
+		if strings.Contains(rw.Body.String(), "Private") {
+			t.Errorf("GET %s = %s, wanted no notes", path, rw.Body.String())
+		}
+		return feed
+	}
+
+	for _, path := range []string{"/shared/token.rss", "/shared/token.atom"} {
+		feed := sharedFeed(path)
+		if feed.Link != "http://example.com/gorse"+path || len(feed.Items) != 2 {
+			t.Errorf("GET %s = %+v, wanted both items", path, feed)
+		}
+		for _, item := range feed.Items {
+			if item.Link == "https://example.com/1" && item.Title != "One & only" {
+				t.Errorf("GET %s has item %+v, wanted its title as text", path, item)
+			}
+			if item.Link == "https://example.com/2" &&
+				(!reflect.DeepEqual(item.Enclosures, enclosures) ||
+					!reflect.DeepEqual(item.Categories, []string{"News"})) {
+				t.Errorf("GET %s has item %+v, wanted its enclosure and category",
+					path, item)
+			}
+		}
+	}
+
+	// We don't parse authors. Each item's is its feed.
+	if rw := serve(handlerSharedFeed, http.MethodGet, "/shared/token.rss",
+		nil); strings.Count(rw.Body.String(),
+		"<dc:creator>Example</dc:creator>") != 2 {
+		t.Errorf("GET /shared/token.rss = %s, wanted each item's author",
+			rw.Body.String())
+	}
+
+	if rw := serve(handlerSharedFeed, http.MethodGet, "/shared/wrong.rss",
+		nil); rw.Code != http.StatusNotFound {
+		t.Errorf("GET with wrong token = status %d, wanted %d", rw.Code,
+			http.StatusNotFound)
+	}
+
+	rw := serve(handlerShareItem, http.MethodPost, "/share_item", url.Values{
+		"item-id": {fmt.Sprintf("%d", two)},
+		"starred": {"1"},
+		"shared":  {"0"},
+	})
+	if rw.Code != http.StatusFound {
+		t.Fatalf("handlerShareItem() = status %d, wanted %d", rw.Code,
+			http.StatusFound)
+	}
+	if location := rw.Header().Get("Location"); !strings.Contains(location,
+		"starred=1") {
+		t.Errorf("handlerShareItem() redirected to %s, wanted the starred list",
+			location)
+	}
+
+	if feed := sharedFeed("/shared/token.rss"); len(feed.Items) != 1 ||
+		feed.Items[0].Link != "https://example.com/1" {
+		t.Errorf("shared feed after leaving out item Two = %+v", feed.Items)
+	}
+}
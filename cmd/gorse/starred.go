@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/gorilla/sessions"
+	"github.com/horgh/gorse"
+)
+
+// handlerStarItem stars or unstars an item for the user. star is 1 to star it
+// and 0 to unstar it. Starred items are kept, and listed with starred=1.
+//
+// It implements the type RequestHandlerFunc.
+//
+// Like handlerUpdateReadFlags, we redirect back to the list of items after.
+func handlerStarItem(rw http.ResponseWriter, request *http.Request,
+	settings *Config, store gorse.Store, session *sessions.Session) {
+	if err := request.ParseForm(); err != nil {
+		logf(request, "Failed to parse form: %s", err)
+		if bodyTooLarge(err) {
+			send413Error(rw, tooLargeError(settings.maxFormBytes()))
+			return
+		}
+		send400Error(rw, "Failed to parse request")
+		return
+	}
+
+	userID, ok := sessionUser(rw, request, settings, session)
+	if !ok {
+		return
+	}
+
+	itemIDStr := request.PostForm.Get("item-id")
+	itemID, err := strconv.ParseInt(itemIDStr, 10, 64)
+	if err != nil {
+		logf(request, "Bad item ID: %s: %s", itemIDStr, err)
+		send400Error(rw, "Bad item ID")
+		return
+	}
+
+	starred := request.PostForm.Get("star") == "1"
+
+	if err := store.SetItemStarred(gorse.WithActor(request.Context(), userID),
+		itemID, userID, starred); err != nil {
+		if err == gorse.ErrNotFound {
+			logf(request, "No item %d", itemID)
+			send400Error(rw, "Unknown item")
+			return
+		}
+		logf(request, "Unable to set whether item %d is starred: %s", itemID,
+			err)
+		send500Error(rw, "Unable to update item")
+		return
+	}
+
+	logf(request, "Set item %d starred: %t", itemID, starred)
+
+	uri := fmt.Sprintf("%s/?read-state=%s&page=%s",
+		settings.URIPrefix,
+		url.QueryEscape(listReadState(request.PostForm).String()),
+		url.QueryEscape(request.PostForm.Get("page")),
+	)
+	if request.PostForm.Get("highlights") == "1" {
+		uri += "&highlights=1"
+	}
+	uri += listViewParams(request.PostForm)
+
+	logf(request, "Redirecting to %s", uri)
+
+	http.Redirect(rw, request, uri, http.StatusFound)
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/horgh/gorse"
+	"github.com/horgh/gorse/internal/gorsetest"
+	"github.com/horgh/rss"
+)
+
+func TestHandlerStarItemIntegration(t *testing.T) {
+	for _, dbType := range gorsetest.Types {
+		t.Run(dbType, func(t *testing.T) {
+			testHandlerStarItemIntegration(t, dbType)
+		})
+	}
+}
+
+func testHandlerStarItemIntegration(t *testing.T, dbType string) {
+	ctx := context.Background()
+	store, _ := gorsetest.Store(t, dbType)
+
+	now := time.Now()
+	loaded := gorsetest.Load(t, store, gorsetest.Fixture{
+		Users: []gorsetest.User{
+			{Email: "user@example.com", Password: "password"},
+		},
+		Feeds: []gorsetest.Feed{
+			{
+				DBFeed: gorse.DBFeed{
+					Name:                   "Example",
+					URI:                    "https://example.com/",
+					UpdateFrequencySeconds: 3600,
+					Active:                 true,
+				},
+				Items: []rss.Item{
+					{Title: "Keeper", Link: "https://example.com/keeper",
+						PubDate: now.Add(-time.Hour)},
+					{Title: "Other", Link: "https://example.com/other",
+						PubDate: now.Add(-time.Hour)},
+				},
+				Subscribers: []string{"user@example.com"},
+			},
+		},
+	})
+	userID := loaded.Users["user@example.com"]
+	keeper := loaded.Items["https://example.com/keeper"]
+
+	settings := &Config{
+		URIPrefix:       "/gorse",
+		DisplayTimeZone: "UTC",
+		WebRoot:         "static",
+		TemplateDir:     "templates",
+	}
+
+	post := func(form url.Values) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodPost, "/star_item",
+			strings.NewReader(form.Encode()))
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rw := httptest.NewRecorder()
+		handlerStarItem(rw, request, settings, store,
+			loggedInSession(t, request, userID))
+		return rw
+	}
+
+	for _, form := range []url.Values{
+		{"item-id": {"x"}, "star": {"1"}},
+		{"item-id": {"-1"}, "star": {"1"}},
+	} {
+		if rw := post(form); rw.Code != http.StatusBadRequest {
+			t.Errorf("%v: status = %d, wanted %d", form, rw.Code,
+				http.StatusBadRequest)
+		}
+	}
+
+	rw := post(url.Values{
+		"item-id":    {fmt.Sprintf("%d", keeper)},
+		"star":       {"1"},
+		"read-state": {"read-later"},
+		"page":       {"2"},
+		"starred":    {"1"},
+	})
+	if rw.Code != http.StatusFound {
+		t.Fatalf("status = %d, wanted %d", rw.Code, http.StatusFound)
+	}
+	want := "/gorse/?read-state=read-later&page=2&starred=1"
+	if location := rw.Header().Get("Location"); location != want {
+		t.Errorf("Location = %s, wanted %s", location, want)
+	}
+
+	item, err := store.GetItem(ctx, keeper, userID)
+	if err != nil {
+		t.Fatalf("GetItem() = error %s", err)
+	}
+	if !item.Starred || item.ReadState != gorse.Unread {
+		t.Errorf("GetItem() = %+v, wanted it starred and still unread", item)
+	}
+
+	// Those publishing their starred items can leave them out of the feed.
+	if err := store.SetShareToken(ctx, userID, "token"); err != nil {
+		t.Fatalf("SetShareToken() = error %s", err)
+	}
+
+	request := httptest.NewRequest(http.MethodGet, "/?starred=1", nil)
+	rw = httptest.NewRecorder()
+	handlerListItems(rw, request, settings, store,
+		loggedInSession(t, request, userID))
+	body := rw.Body.String()
+	if rw.Code != http.StatusOK {
+		t.Fatalf("status = %d: %q, wanted %d", rw.Code, body, http.StatusOK)
+	}
+	if !strings.Contains(body, "Keeper") || strings.Contains(body, "Other") {
+		t.Errorf("starred page = %q, wanted only the starred item", body)
+	}
+	if !strings.Contains(body, `title="Unstar"`) {
+		t.Errorf("starred page = %q, wanted a button to unstar the item", body)
+	}
+	if !strings.Contains(body, `form="unshare-item"`) {
+		t.Errorf("starred page = %q, wanted a button to leave the item out of "+
+			"the shared feed", body)
+	}
+
+	if rw := post(url.Values{
+		"item-id": {fmt.Sprintf("%d", keeper)},
+		"star":    {"0"},
+	}); rw.Code != http.StatusFound {
+		t.Fatalf("status = %d, wanted %d", rw.Code, http.StatusFound)
+	}
+	if item, err := store.GetItem(ctx, keeper, userID); err != nil ||
+		item.Starred {
+		t.Errorf("GetItem() = %+v, %v, wanted it unstarred", item, err)
+	}
+}
@@ -77,6 +77,168 @@ Gorse.set_none = function(item_li) {
 	}
 };
 
+// Where we are in the list is the item at the top of the screen and how far
+// past its top we are.
+Gorse.reading_position = function(items) {
+	for (var i = 0; i < items.length; i++) {
+		var li = items.item(i);
+		var rect = li.getBoundingClientRect();
+		if (rect.bottom > 0) {
+			return {
+				item_id: li.getAttribute('data-item-id'),
+				offset: Math.max(0, Math.round(-rect.top))
+			};
+		}
+	}
+	return null;
+};
+
+// Go back to where we were in the list, such as on another device, then
+// record where we are as we scroll. If the URL says where to go, we go there
+// instead.
+Gorse.sync_reading_position = function(items) {
+	var list = document.getElementById('items');
+	if (!list || !list.getAttribute('data-position') || items.length === 0) {
+		return;
+	}
+	var url = list.getAttribute('data-position');
+	var params = 'view=' + encodeURIComponent(list.getAttribute('data-view'));
+
+	var record = function() {
+		var position = Gorse.reading_position(items);
+		if (!position) {
+			return;
+		}
+		var xhr = new XMLHttpRequest();
+		xhr.open('POST', url);
+		xhr.setRequestHeader('Content-Type',
+			'application/x-www-form-urlencoded');
+		xhr.send(params + '&item-id=' + encodeURIComponent(position.item_id) +
+			'&offset=' + position.offset);
+	};
+
+	var listen = function() {
+		// Record once scrolling stops rather than on every step.
+		var timer = null;
+		window.addEventListener('scroll', function() {
+			if (timer !== null) {
+				window.clearTimeout(timer);
+			}
+			timer = window.setTimeout(record, 1000);
+		});
+	};
+
+	if (window.location.hash) {
+		listen();
+		return;
+	}
+
+	var xhr = new XMLHttpRequest();
+	xhr.open('GET', url + '?' + params);
+	xhr.onloadend = function() {
+		if (xhr.status === 200) {
+			try {
+				var position = JSON.parse(xhr.responseText);
+				var li = list.querySelector(
+					'li[data-item-id="' + position.item_id + '"]');
+				if (li) {
+					window.scrollTo(0, li.getBoundingClientRect().top +
+						window.pageYOffset + position.offset);
+				}
+			} catch (e) {
+				Gorse.log(e);
+			}
+		}
+		listen();
+	};
+	xhr.send();
+};
+
+// Mark an item read or saved to read later right away rather than when the
+// list is saved. action is read or read-later. If we can't, we fall back to
+// marking it in the form so saving the list does it.
+Gorse.mark_item = function(item_li, action) {
+	var list = document.getElementById('items');
+	var fallback = function() {
+		if (action === 'read') {
+			Gorse.set_read(item_li);
+			return;
+		}
+		Gorse.set_archive(item_li);
+	};
+	if (!list || !list.getAttribute('data-items')) {
+		fallback();
+		return;
+	}
+
+	var xhr = new XMLHttpRequest();
+	xhr.open('POST', list.getAttribute('data-items') + '/' +
+		encodeURIComponent(item_li.getAttribute('data-item-id')) + '/' + action);
+	xhr.onloadend = function() {
+		if (xhr.status !== 200) {
+			Gorse.log('marking item failed: ' + xhr.status);
+			fallback();
+			return;
+		}
+		// It's done, so the form has nothing to submit for it.
+		Gorse.set_none(item_li);
+		item_li.classList.add(action === 'read' ? 'read' : 'archive');
+	};
+	xhr.send();
+};
+
+// Keys to go through the list and mark items:
+// - j and k go to the next and previous item
+// - r marks the current item read, l saves it to read later
+// - Either moves on to the next item
+Gorse.listen_keys = function(items) {
+	var current = -1;
+
+	var go = function(i) {
+		if (i < 0 || i >= items.length) {
+			return;
+		}
+		if (current !== -1) {
+			items.item(current).classList.remove('current');
+		}
+		current = i;
+		var li = items.item(current);
+		li.classList.add('current');
+		li.scrollIntoView({block: 'nearest'});
+	};
+
+	document.addEventListener('keydown', function(evt) {
+		if (evt.ctrlKey || evt.altKey || evt.metaKey) {
+			return;
+		}
+		var tag = evt.target.tagName;
+		if (tag === 'INPUT' || tag === 'TEXTAREA' || tag === 'SELECT') {
+			return;
+		}
+
+		switch (evt.key) {
+			case 'j':
+				go(current + 1);
+				break;
+			case 'k':
+				go(current - 1);
+				break;
+			case 'r':
+			case 'l':
+				if (current === -1) {
+					return;
+				}
+				Gorse.mark_item(items.item(current),
+					evt.key === 'r' ? 'read' : 'read-later');
+				go(current + 1);
+				break;
+			default:
+				return;
+		}
+		evt.preventDefault();
+	});
+};
+
 document.addEventListener('DOMContentLoaded', function() {
 	// Add a click handler to all item rows.
 
@@ -92,6 +254,38 @@ document.addEventListener('DOMContentLoaded', function() {
 		})(li);
 	}
 
+	// Notes go with items saved to read later. Typing in one shouldn't toggle
+	// its item. Name each once edited so we only submit those that changed.
+
+	var notes = document.querySelectorAll("#items .note");
+
+	for (var i = 0; i < notes.length; i++) {
+		var note = notes.item(i);
+
+		(function(note) {
+			note.addEventListener('click', function(evt) {
+				evt.stopPropagation();
+			});
+			note.addEventListener('input', function() {
+				note.name = note.getAttribute('data-name');
+			});
+		})(note);
+	}
+
+	// Sending an item elsewhere or reading it shouldn't toggle it either.
+
+	var send_tos = document.querySelectorAll(
+		"#items .send-to, #items .reader-view, #items .epub");
+
+	for (var i = 0; i < send_tos.length; i++) {
+		send_tos.item(i).addEventListener('click', function(evt) {
+			evt.stopPropagation();
+		});
+	}
+
+	Gorse.sync_reading_position(items);
+	Gorse.listen_keys(items);
+
 	// When we click the save button, submit the form with our read elements.
 
 	var save_button = document.getElementById('update-flags-top');
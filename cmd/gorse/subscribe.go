@@ -0,0 +1,217 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gorilla/sessions"
+	"github.com/horgh/gorse"
+)
+
+// previewItems is how many of a feed's items we show before subscribing.
+const previewItems = 10
+
+// handlerSubscribeForm lets the user add a feed. They give the URL of the
+// feed or of a page linking to it, and we show what we find there before we
+// add anything: the feed's title, its format, its newest items, and any
+// problems we worked around parsing it. If it looks right they subscribe to
+// it with handlerSubscribe.
+//
+// If the page links to more than one feed, we show the first and offer the
+// others to look at instead. If it links to none, we look where sites
+// commonly put their feeds.
+//
+// It implements the type RequestHandlerFunc.
+func handlerSubscribeForm(rw http.ResponseWriter, request *http.Request,
+	settings *Config, store gorse.Store, session *sessions.Session) {
+	requestValues := request.URL.Query()
+
+	userID, ok := sessionUser(rw, request, settings, session)
+	if !ok {
+		return
+	}
+
+	user, err := store.GetUser(request.Context(), userID)
+	if err != nil {
+		logf(request, "Unable to look up user: %s", err)
+		send500Error(rw, "Unable to look up user")
+		return
+	}
+	locale := userLocale(request, user)
+
+	location, err := time.LoadLocation(settings.DisplayTimeZone)
+	if err != nil {
+		logf(request, "Failed to load time zone location [%s]: %s",
+			settings.DisplayTimeZone, err)
+		send500Error(rw, "Unable to load timezone information")
+		return
+	}
+
+	type HTMLItem struct {
+		Title           string
+		Link            string
+		PublicationDate string
+		FullPubDate     string
+	}
+
+	type Candidate struct {
+		URL     string
+		Name    string
+		Current bool
+	}
+
+	type SubscribePage struct {
+		URL        string
+		Error      string
+		Candidates []Candidate
+		FeedURL    string
+		Title      string
+		Type       string
+		Encoding   string
+		ItemCount  int
+		Items      []HTMLItem
+		Warnings   []string
+		Subscribed bool
+		Path       string
+		UserID     int
+		ReadState  gorse.ReadState
+	}
+
+	page := SubscribePage{
+		URL:       strings.TrimSpace(requestValues.Get("url")),
+		Path:      settings.URIPrefix,
+		UserID:    userID,
+		ReadState: gorse.Unread,
+	}
+
+	if page.URL != "" {
+		if pageURL, ok := subscribeURL(page.URL); !ok {
+			logf(request, "Invalid URL: %s", page.URL)
+			page.Error = "The URL must be an http or https URL."
+		} else if found, err := findFeeds(request, pageURL,
+			maxFoundFeeds); err != nil {
+			logf(request, "Unable to find feed of %s: %s", pageURL, err)
+			page.Error = "We couldn't find a feed there."
+		} else {
+			feedURL, feed := found[0].URL, found[0].Feed
+			if len(found) > 1 {
+				for i, f := range found {
+					page.Candidates = append(page.Candidates, Candidate{
+						URL:     f.URL,
+						Name:    f.Name,
+						Current: i == 0,
+					})
+				}
+			}
+
+			page.FeedURL = feedURL
+			page.Title = found[0].Name
+			page.Type = feed.Type
+			page.Encoding = feed.Encoding
+			page.ItemCount = len(feed.Items)
+			page.Warnings = feed.Warnings
+
+			for i, item := range feed.Items {
+				if i == previewItems {
+					break
+				}
+				htmlItem := HTMLItem{
+					Title: sanitiseItemText(item.Title),
+					Link:  item.Link,
+				}
+				if !item.PubDate.IsZero() {
+					htmlItem.PublicationDate, htmlItem.FullPubDate = formatDate(locale,
+						user, item.PubDate, location)
+				}
+				page.Items = append(page.Items, htmlItem)
+			}
+
+			feeds, err := store.ListSubscriptions(request.Context(), userID)
+			if err != nil {
+				logf(request, "Unable to retrieve subscriptions: %s", err)
+				send500Error(rw, "Unable to retrieve subscriptions")
+				return
+			}
+			for _, f := range feeds {
+				if f.URI == feedURL {
+					page.Subscribed = true
+				}
+			}
+		}
+	}
+
+	if err := renderPage(settings, rw, locale, "_subscribe", page); err != nil {
+		logf(request, "Failure rendering page: %s", err)
+		send500Error(rw, "Failed to render page")
+		return
+	}
+}
+
+// handlerSubscribe subscribes the user to the feed at the URL, adding the feed
+// if we don't have it. name is what to call it. This is the second step after
+// the user sees what's there with handlerSubscribeForm.
+//
+// It implements the type RequestHandlerFunc.
+func handlerSubscribe(rw http.ResponseWriter, request *http.Request,
+	settings *Config, store gorse.Store, session *sessions.Session) {
+	if err := request.ParseForm(); err != nil {
+		logf(request, "Failed to parse form: %s", err)
+		if bodyTooLarge(err) {
+			send413Error(rw, tooLargeError(settings.maxFormBytes()))
+			return
+		}
+		send400Error(rw, "Failed to parse request")
+		return
+	}
+
+	userID, ok := sessionUser(rw, request, settings, session)
+	if !ok {
+		return
+	}
+
+	feedURL, ok := subscribeURL(request.PostForm.Get("url"))
+	if !ok {
+		logf(request, "Invalid URL: %s", request.PostForm.Get("url"))
+		send400Error(rw, "The URL must be an http or https URL")
+		return
+	}
+	name := strings.TrimSpace(request.PostForm.Get("name"))
+
+	ctx := gorse.WithActor(request.Context(), userID)
+	if err := store.InTx(ctx, func(store gorse.Store) error {
+		_, _, err := gorse.SubscribeToFeed(ctx, store, userID, name, feedURL)
+		return err
+	}); err != nil {
+		logf(request, "Unable to subscribe to %s: %s", feedURL, err)
+		send500Error(rw, "Unable to subscribe to the feed")
+		return
+	}
+
+	logf(request, "Subscribed user ID [%d] to %s", userID, feedURL)
+
+	session.AddFlash("Subscribed.")
+	if err := session.Save(request, rw); err != nil {
+		logf(request, "Unable to save session: %s", err)
+		send500Error(rw, "Failed to save your session.")
+		return
+	}
+
+	uri := settings.URIPrefix + "/"
+
+	logf(request, "Redirecting to %s", uri)
+
+	http.Redirect(rw, request, uri, http.StatusFound)
+}
+
+// subscribeURL checks the URL is one we can fetch a feed from. We return it
+// normalized.
+func subscribeURL(rawURL string) (string, bool) {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") ||
+		u.Host == "" {
+		return "", false
+	}
+	return u.String(), true
+}
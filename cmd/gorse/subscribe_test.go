@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/sessions"
+	"github.com/horgh/gorse"
+	"github.com/horgh/gorse/internal/gorsetest"
+)
+
+func TestHandlerSubscribeIntegration(t *testing.T) {
+	for _, dbType := range gorsetest.Types {
+		t.Run(dbType, func(t *testing.T) {
+			testHandlerSubscribeIntegration(t, dbType)
+		})
+	}
+}
+
+func testHandlerSubscribeIntegration(t *testing.T, dbType string) {
+	ctx := context.Background()
+	store, _ := gorsetest.Store(t, dbType)
+
+	loaded := gorsetest.Load(t, store, gorsetest.Fixture{
+		Users: []gorsetest.User{
+			{Email: "user@example.com", Password: "password"},
+		},
+	})
+	userID := loaded.Users["user@example.com"]
+
+	site := httptest.NewServer(http.HandlerFunc(
+		func(rw http.ResponseWriter, request *http.Request) {
+			switch request.URL.Path {
+			case "/blog":
+				rw.Header().Set("Content-Type", "text/html")
+				_, _ = rw.Write([]byte(`<title>Blog</title>
+<link rel="alternate" type="application/rss+xml" href="/feed.xml">`))
+			case "/both":
+				rw.Header().Set("Content-Type", "text/html")
+				_, _ = rw.Write([]byte(`<title>Blog</title>
+<link rel="alternate" type="application/rss+xml" href="/feed.xml">
+<link rel="alternate" type="application/rss+xml" href="/gone.xml">
+<link rel="alternate" type="application/rss+xml" href="/comments.xml">`))
+			case "/about":
+				rw.Header().Set("Content-Type", "text/html")
+				_, _ = rw.Write([]byte(`<title>About</title>`))
+			case "/comments.xml":
+				rw.Header().Set("Content-Type", "application/rss+xml")
+				_, _ = rw.Write([]byte(`<?xml version="1.0"?>
+<rss version="2.0"><channel><title>Comments</title>
+<link>https://blog.example.com/</link><description>Comments</description>
+</channel></rss>`))
+			case "/feed.xml":
+				rw.Header().Set("Content-Type", "application/rss+xml")
+				_, _ = rw.Write([]byte(`<?xml version="1.0"?>
+<rss version="2.0"><channel><title>The Blog</title>
+<link>https://blog.example.com/</link><description>Posts</description>
+<item><title>First &lt;b&gt;post&lt;/b&gt;</title>
+<link>https://blog.example.com/1</link>
+<pubDate>Mon, 01 Mar 2021 10:00:00 +0000</pubDate></item>
+<item><title>Undated</title><link>https://blog.example.com/2</link></item>
+</channel></rss>`))
+			default:
+				http.NotFound(rw, request)
+			}
+		}))
+	defer site.Close()
+
+	settings := &Config{
+		URIPrefix:       "/gorse",
+		DisplayTimeZone: "UTC",
+		WebRoot:         "static",
+		TemplateDir:     "templates",
+	}
+	sessionStore := sessions.NewCookieStore([]byte(strings.Repeat("k", 32)))
+
+	preview := func(pageURL string) string {
+		request := httptest.NewRequest(http.MethodGet,
+			"/subscribe?url="+url.QueryEscape(pageURL), nil)
+		session, err := sessionStore.New(request, "gorse")
+		if err != nil {
+			t.Fatalf("creating session: %s", err)
+		}
+		session.Values[sessionUserKey] = userID
+		rw := httptest.NewRecorder()
+		handlerSubscribeForm(rw, request, settings, store, session)
+		if rw.Code != http.StatusOK {
+			t.Fatalf("GET %s = status %d: %s, wanted %d", pageURL, rw.Code,
+				rw.Body.String(), http.StatusOK)
+		}
+		return rw.Body.String()
+	}
+
+	subscribe := func(feedURL string) *httptest.ResponseRecorder {
+		form := url.Values{
+			"url":  {feedURL},
+			"name": {" My Blog "},
+		}
+		request := httptest.NewRequest(http.MethodPost, "/subscribe",
+			strings.NewReader(form.Encode()))
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		session, err := sessionStore.New(request, "gorse")
+		if err != nil {
+			t.Fatalf("creating session: %s", err)
+		}
+		session.Values[sessionUserKey] = userID
+		rw := httptest.NewRecorder()
+		handlerSubscribe(rw, request, settings, store, session)
+		return rw
+	}
+
+	feedURL := site.URL + "/feed.xml"
+
+	body := preview(site.URL + "/blog")
+	for _, want := range []string{
+		"The Blog",
+		feedURL,
+		"RSS",
+		">First post<",
+		"item 2 has no publication date we could parse",
+		`name="name" value="The Blog"`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("preview = %s, wanted it to contain %q", body, want)
+		}
+	}
+
+	if _, err := store.GetFeedByURI(ctx, feedURL); err != gorse.ErrNotFound {
+		t.Fatalf("GetFeedByURI() after preview = error %v, wanted not found",
+			err)
+	}
+
+	body = preview(site.URL + "/both")
+	for _, want := range []string{
+		"The page links to more than one feed:",
+		"<strong>The Blog</strong>",
+		">Comments</a>",
+		`name="name" value="The Blog"`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("preview of page with two feeds = %s, wanted it to contain %q",
+				body, want)
+		}
+	}
+	if strings.Contains(body, "gone.xml") {
+		t.Errorf("preview of page with two feeds = %s, wanted no missing feed",
+			body)
+	}
+
+	body = preview(site.URL + "/about")
+	if !strings.Contains(body, `name="url" value="`+feedURL+`"`) ||
+		strings.Contains(body, "more than one feed") {
+		t.Errorf("preview of page linking to no feeds = %s, wanted %s", body,
+			feedURL)
+	}
+
+	if body := preview(site.URL + "/missing"); !strings.Contains(body,
+		"We couldn&#39;t find a feed there.") {
+		t.Errorf("preview of missing page = %s, wanted an error", body)
+	}
+	if body := preview("ftp://example.com/feed"); !strings.Contains(body,
+		"The URL must be an http or https URL.") {
+		t.Errorf("preview of ftp URL = %s, wanted an error", body)
+	}
+
+	if rw := subscribe(feedURL); rw.Code != http.StatusFound {
+		t.Fatalf("POST = status %d: %s, wanted %d", rw.Code, rw.Body.String(),
+			http.StatusFound)
+	}
+
+	feeds, err := store.ListSubscriptions(ctx, userID)
+	if err != nil {
+		t.Fatalf("ListSubscriptions() = error %s", err)
+	}
+	if len(feeds) != 1 || feeds[0].URI != feedURL || feeds[0].Name != "My Blog" {
+		t.Errorf("subscriptions = %+v, wanted My Blog", feeds)
+	}
+
+	if body := preview(feedURL); !strings.Contains(body,
+		"You already subscribe to this feed.") ||
+		strings.Contains(body, `method="POST"`) {
+		t.Errorf("preview when subscribed = %s, wanted no subscribe form", body)
+	}
+
+	if rw := subscribe("javascript:alert(1)"); rw.Code != http.StatusBadRequest {
+		t.Errorf("POST bad URL = status %d, wanted %d", rw.Code,
+			http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/gorilla/sessions"
+	"github.com/horgh/gorse"
+)
+
+// handlerTagItem tags an item for the user. item-id is the item and item-tag
+// the tag. Items with a tag are listed with tag=<tag>, so tag is which tag's
+// items we go back to, if any.
+//
+// It implements the type RequestHandlerFunc.
+//
+// Like handlerStarItem, we redirect back to the list of items after.
+func handlerTagItem(rw http.ResponseWriter, request *http.Request,
+	settings *Config, store gorse.Store, session *sessions.Session) {
+	setItemTag(rw, request, settings, store, session, true)
+}
+
+// handlerUntagItem removes a tag from an item for the user. It takes the
+// same parameters as handlerTagItem.
+//
+// It implements the type RequestHandlerFunc.
+func handlerUntagItem(rw http.ResponseWriter, request *http.Request,
+	settings *Config, store gorse.Store, session *sessions.Session) {
+	setItemTag(rw, request, settings, store, session, false)
+}
+
+// setItemTag adds the tag to or removes it from the item in the form.
+func setItemTag(rw http.ResponseWriter, request *http.Request,
+	settings *Config, store gorse.Store, session *sessions.Session,
+	tagged bool) {
+	if err := request.ParseForm(); err != nil {
+		logf(request, "Failed to parse form: %s", err)
+		if bodyTooLarge(err) {
+			send413Error(rw, tooLargeError(settings.maxFormBytes()))
+			return
+		}
+		send400Error(rw, "Failed to parse request")
+		return
+	}
+
+	userID, ok := sessionUser(rw, request, settings, session)
+	if !ok {
+		return
+	}
+
+	itemIDStr := request.PostForm.Get("item-id")
+	itemID, err := strconv.ParseInt(itemIDStr, 10, 64)
+	if err != nil {
+		logf(request, "Bad item ID: %s: %s", itemIDStr, err)
+		send400Error(rw, "Bad item ID")
+		return
+	}
+
+	tag, err := gorse.NormalizeTag(request.PostForm.Get("item-tag"))
+	if err != nil {
+		logf(request, "Bad tag: %s", err)
+		send400Error(rw, fmt.Sprintf("Bad tag: %s", err))
+		return
+	}
+
+	ctx := gorse.WithActor(request.Context(), userID)
+
+	if tagged {
+		err = store.AddItemTag(ctx, itemID, userID, tag)
+	} else {
+		err = store.RemoveItemTag(ctx, itemID, userID, tag)
+	}
+	if err != nil {
+		if err == gorse.ErrNotFound {
+			logf(request, "No item %d", itemID)
+			send400Error(rw, "Unknown item")
+			return
+		}
+		logf(request, "Unable to set whether item %d has tag [%s]: %s", itemID,
+			tag, err)
+		send500Error(rw, "Unable to update item")
+		return
+	}
+
+	logf(request, "Set item %d tagged [%s]: %t", itemID, tag, tagged)
+
+	uri := fmt.Sprintf("%s/?read-state=%s&page=%s",
+		settings.URIPrefix,
+		url.QueryEscape(listReadState(request.PostForm).String()),
+		url.QueryEscape(request.PostForm.Get("page")),
+	)
+	if request.PostForm.Get("highlights") == "1" {
+		uri += "&highlights=1"
+	}
+	uri += listViewParams(request.PostForm)
+
+	logf(request, "Redirecting to %s", uri)
+
+	http.Redirect(rw, request, uri, http.StatusFound)
+}
+
+// handlerTags shows the user's tags, each linking to the items with it.
+//
+// It implements the type RequestHandlerFunc.
+func handlerTags(rw http.ResponseWriter, request *http.Request,
+	settings *Config, store gorse.Store, session *sessions.Session) {
+	userID, ok := sessionUser(rw, request, settings, session)
+	if !ok {
+		return
+	}
+
+	user, err := store.GetUser(request.Context(), userID)
+	if err != nil {
+		logf(request, "Unable to look up user: %s", err)
+		send500Error(rw, "Unable to look up user")
+		return
+	}
+	locale := userLocale(request, user)
+
+	tags, err := store.ListTags(request.Context(), userID)
+	if err != nil {
+		logf(request, "Unable to look up tags: %s", err)
+		send500Error(rw, "Unable to look up tags")
+		return
+	}
+
+	type TagsPage struct {
+		Tags      []gorse.TagCount
+		Path      string
+		UserID    int
+		ReadState gorse.ReadState
+	}
+
+	if err := renderPage(settings, rw, locale, "_tags", TagsPage{
+		Tags:      tags,
+		Path:      settings.URIPrefix,
+		UserID:    userID,
+		ReadState: gorse.Unread,
+	}); err != nil {
+		logf(request, "Failure rendering page: %s", err)
+		send500Error(rw, "Failed to render page")
+		return
+	}
+}
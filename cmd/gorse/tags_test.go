@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/sessions"
+	"github.com/horgh/gorse"
+	"github.com/horgh/gorse/internal/gorsetest"
+	"github.com/horgh/rss"
+)
+
+func TestHandlerTagItemIntegration(t *testing.T) {
+	for _, dbType := range gorsetest.Types {
+		t.Run(dbType, func(t *testing.T) {
+			testHandlerTagItemIntegration(t, dbType)
+		})
+	}
+}
+
+func testHandlerTagItemIntegration(t *testing.T, dbType string) {
+	ctx := context.Background()
+	store, _ := gorsetest.Store(t, dbType)
+
+	now := time.Now()
+	loaded := gorsetest.Load(t, store, gorsetest.Fixture{
+		Users: []gorsetest.User{
+			{Email: "user@example.com", Password: "password"},
+		},
+		Feeds: []gorsetest.Feed{
+			{
+				DBFeed: gorse.DBFeed{
+					Name:                   "Example",
+					URI:                    "https://example.com/",
+					UpdateFrequencySeconds: 3600,
+					Active:                 true,
+				},
+				Items: []rss.Item{
+					{Title: "Recipe", Link: "https://example.com/recipe",
+						PubDate: now.Add(-time.Hour)},
+					{Title: "Other", Link: "https://example.com/other",
+						PubDate: now.Add(-time.Hour)},
+				},
+				Subscribers: []string{"user@example.com"},
+			},
+		},
+	})
+	userID := loaded.Users["user@example.com"]
+	recipe := loaded.Items["https://example.com/recipe"]
+
+	settings := &Config{
+		URIPrefix:       "/gorse",
+		DisplayTimeZone: "UTC",
+		WebRoot:         "static",
+		TemplateDir:     "templates",
+	}
+
+	type handlerFunc func(http.ResponseWriter, *http.Request, *Config,
+		gorse.Store, *sessions.Session)
+
+	post := func(handler handlerFunc,
+		form url.Values) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodPost, "/tag_item",
+			strings.NewReader(form.Encode()))
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rw := httptest.NewRecorder()
+		handler(rw, request, settings, store, loggedInSession(t, request, userID))
+		return rw
+	}
+	get := func(handler handlerFunc, target string) string {
+		request := httptest.NewRequest(http.MethodGet, target, nil)
+		rw := httptest.NewRecorder()
+		handler(rw, request, settings, store, loggedInSession(t, request, userID))
+		if rw.Code != http.StatusOK {
+			t.Fatalf("GET %s = status %d: %q, wanted %d", target, rw.Code,
+				rw.Body.String(), http.StatusOK)
+		}
+		return rw.Body.String()
+	}
+
+	for _, form := range []url.Values{
+		{"item-id": {"x"}, "item-tag": {"food"}},
+		{"item-id": {"-1"}, "item-tag": {"food"}},
+		{"item-id": {fmt.Sprintf("%d", recipe)}, "item-tag": {" "}},
+		{"item-id": {fmt.Sprintf("%d", recipe)},
+			"item-tag": {strings.Repeat("x", gorse.MaxTagLength+1)}},
+	} {
+		if rw := post(handlerTagItem, form); rw.Code != http.StatusBadRequest {
+			t.Errorf("%v: status = %d, wanted %d", form, rw.Code,
+				http.StatusBadRequest)
+		}
+	}
+
+	rw := post(handlerTagItem, url.Values{
+		"item-id":    {fmt.Sprintf("%d", recipe)},
+		"item-tag":   {" Food  To Try "},
+		"read-state": {"read-later"},
+		"page":       {"2"},
+		"tag":        {"food to try"},
+	})
+	if rw.Code != http.StatusFound {
+		t.Fatalf("status = %d, wanted %d", rw.Code, http.StatusFound)
+	}
+	want := "/gorse/?read-state=read-later&page=2&tag=food+to+try"
+	if location := rw.Header().Get("Location"); location != want {
+		t.Errorf("Location = %s, wanted %s", location, want)
+	}
+
+	tags, err := store.ItemTags(ctx, userID, []int64{recipe})
+	if err != nil {
+		t.Fatalf("ItemTags() = error %s", err)
+	}
+	if want := map[int64][]string{recipe: {"food to try"}}; !reflect.DeepEqual(
+		tags, want) {
+		t.Errorf("ItemTags() = %v, wanted %v", tags, want)
+	}
+
+	// Tags list their items whatever their state.
+	if err := store.SetItemReadState(ctx, recipe, userID,
+		gorse.Read); err != nil {
+		t.Fatalf("SetItemReadState() = error %s", err)
+	}
+	body := get(handlerListItems, "/?tag=food+to+try")
+	if !strings.Contains(body, "Recipe") || strings.Contains(body, "Other") ||
+		!strings.Contains(body, "Showing items you tagged food to try.") {
+		t.Errorf("tag page = %q, wanted only the tagged item", body)
+	}
+	if !strings.Contains(body, `name="item-tag" value="food to try"`) {
+		t.Errorf("tag page = %q, wanted a button to remove the tag", body)
+	}
+	// Marking all read would mark items without the tag.
+	if body := get(handlerListItems,
+		"/?read-state=unread&tag=food+to+try"); strings.Contains(body,
+		`id="mark-all-read-form"`) {
+		t.Errorf("tag page = %q, wanted no mark all read form", body)
+	}
+
+	if body := get(handlerTags, "/tags"); !strings.Contains(body,
+		`<a href="/gorse?tag=food%20to%20try">food to try</a>`) ||
+		!strings.Contains(body, "(1)") {
+		t.Errorf("tags page = %q, wanted the tag and its count", body)
+	}
+
+	rw = post(handlerUntagItem, url.Values{
+		"item-id":  {fmt.Sprintf("%d", recipe)},
+		"item-tag": {"food to try"},
+	})
+	if rw.Code != http.StatusFound {
+		t.Fatalf("status = %d, wanted %d", rw.Code, http.StatusFound)
+	}
+	tags, err = store.ItemTags(ctx, userID, []int64{recipe})
+	if err != nil {
+		t.Fatalf("ItemTags() = error %s", err)
+	}
+	if len(tags) != 0 {
+		t.Errorf("ItemTags() after removing = %v, wanted none", tags)
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+
+	"github.com/horgh/gorse"
+)
+
+// createUser adds a user with the email who logs in with the password on the
+// first line of r. admin is admin to make them an admin.
+func createUser(ctx context.Context, settings *Config, email, admin string,
+	r io.Reader) error {
+	if admin != "" && admin != "admin" {
+		return fmt.Errorf("unknown option: %s. Use admin or nothing", admin)
+	}
+
+	password, err := readPassword(r)
+	if err != nil {
+		return err
+	}
+
+	db, err := connectToDB(settings)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := db.Close(); err != nil {
+			log.Printf("Database close: %s", err)
+		}
+	}()
+
+	store := gorse.NewSQLStore(db, settings.DBType)
+	_, err = store.CreateUser(ctx, email, password, admin == "admin")
+	return err
+}
+
+// setPassword sets the password of the user with the email to the first line
+// of r.
+func setPassword(ctx context.Context, settings *Config, email string,
+	r io.Reader) error {
+	password, err := readPassword(r)
+	if err != nil {
+		return err
+	}
+
+	db, err := connectToDB(settings)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := db.Close(); err != nil {
+			log.Printf("Database close: %s", err)
+		}
+	}()
+
+	user, err := findUserByEmail(ctx, db, email)
+	if err != nil {
+		return err
+	}
+
+	return gorse.NewSQLStore(db, settings.DBType).UpdatePassword(ctx, user.ID,
+		password)
+}
+
+// readPassword reads a password from the first line of r. We take it this way
+// rather than as an argument so that it doesn't show in the list of processes
+// or the shell's history.
+func readPassword(r io.Reader) (string, error) {
+	line, err := bufio.NewReader(r).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", fmt.Errorf("unable to read password: %s", err)
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
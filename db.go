@@ -0,0 +1,243 @@
+package gorse
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	// Register the PostgreSQL driver. The SQLite driver is registered in
+	// sqlite.go when building with the sqlite3 tag.
+	_ "github.com/lib/pq"
+)
+
+// The database backends we support.
+const (
+	// Postgres is the default backend.
+	Postgres = "postgres"
+
+	// SQLite stores everything in a single file. It is suitable for a single
+	// user install with no database server. Support for it requires building
+	// with the sqlite3 build tag (and cgo).
+	SQLite = "sqlite3"
+)
+
+// DBConfig holds how to connect to the database.
+type DBConfig struct {
+	// Type is the backend, Postgres or SQLite. Postgres if blank.
+	Type string
+
+	// For Postgres these are as usual. For SQLite, Name is the path to the
+	// database file and the others are unused.
+	User string
+	Pass string
+	Name string
+	Host string
+
+	// Connection pool limits. See the corresponding sql.DB methods. Zero means
+	// to use database/sql's default.
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+
+	// StatementTimeout is how long a statement may run before the database
+	// cancels it. Zero means no limit. Only Postgres supports this.
+	StatementTimeout time.Duration
+}
+
+// dialect holds what differs between the backends.
+//
+// Our queries are otherwise written to work on both. This means we stick to
+// $n placeholders, ON CONFLICT for upserts, and compute times such as cutoffs
+// in Go rather than using interval arithmetic.
+type dialect struct {
+	// driver is the database/sql driver name.
+	driver string
+
+	// dsn builds the data source name.
+	dsn func(DBConfig) string
+
+	// migrations is the directory holding the backend's migrations.
+	migrations string
+
+	// tableExists is a query taking a table name and returning whether it
+	// exists.
+	tableExists string
+
+	// lockMigrations is run at the start of each migration's transaction so
+	// that only one process migrates at a time. It may be blank if the backend
+	// serializes transactions anyway.
+	lockMigrations string
+
+	// now is the expression for the current time.
+	now string
+
+	// searchItems is a condition matching items with the search terms. It is a
+	// format string taking the terms' placeholder.
+	searchItems string
+
+	// searchRank orders items by how well they match the search terms, best
+	// first. It is a format string like searchItems. It may be blank if the
+	// backend can't rank matches.
+	searchRank string
+
+	// searchTerms turns what someone searched for into the terms for
+	// searchItems.
+	searchTerms func(string) string
+
+	// searchAnyItems and searchAnyRank are like searchItems and searchRank but
+	// match items with any of the terms rather than all of them.
+	searchAnyItems string
+	searchAnyRank  string
+
+	// searchAnyTerms turns words into the terms for searchAnyItems. The words
+	// have only letters and digits.
+	searchAnyTerms func([]string) string
+
+	// contains is a condition that the first string contains the second. It is
+	// a format string taking the two.
+	contains string
+
+	// readState is the expression for a read state. It is a format string
+	// taking the state as a quoted string. Postgres needs to be told the type
+	// when it can't tell from where the state goes.
+	readState string
+}
+
+var dialects = map[string]dialect{
+	Postgres: {
+		driver: "postgres",
+		dsn: func(c DBConfig) string {
+			dsn := fmt.Sprintf(
+				"user=%s password=%s dbname=%s host=%s connect_timeout=10",
+				c.User, c.Pass, c.Name, c.Host)
+			// The driver passes this on as a setting for each connection. This way
+			// it covers the whole of each query including reading its rows.
+			if c.StatementTimeout > 0 {
+				dsn += fmt.Sprintf(" statement_timeout=%d",
+					c.StatementTimeout.Milliseconds())
+			}
+			return dsn
+		},
+		migrations:     "migrations/postgres",
+		tableExists:    `SELECT to_regclass($1) IS NOT NULL`,
+		lockMigrations: `LOCK TABLE schema_migrations IN EXCLUSIVE MODE`,
+		now:            `NOW()`,
+		searchItems: `ri.search_vector @@ ` +
+			`plainto_tsquery('english', %[1]s)`,
+		searchRank: `ts_rank(ri.search_vector, ` +
+			`plainto_tsquery('english', %[1]s)) DESC`,
+		searchTerms: func(s string) string { return s },
+		searchAnyItems: `ri.search_vector @@ ` +
+			`to_tsquery('english', %[1]s)`,
+		searchAnyRank: `ts_rank(ri.search_vector, ` +
+			`to_tsquery('english', %[1]s)) DESC`,
+		searchAnyTerms: func(words []string) string {
+			return strings.Join(words, " | ")
+		},
+		contains:  `strpos(%s, %s) > 0`,
+		readState: `%s::read_state`,
+	},
+	SQLite: {
+		driver: "sqlite3",
+		// Take the write lock when beginning transactions. Otherwise concurrent
+		// transactions fail with "database is locked" when upgrading from a read
+		// lock. Wait for locks rather than failing immediately. Enforce foreign
+		// keys as Postgres does.
+		dsn: func(c DBConfig) string {
+			return c.Name + "?_txlock=immediate&_busy_timeout=10000&_foreign_keys=1"
+		},
+		migrations: "migrations/sqlite3",
+		tableExists: `SELECT COUNT(*) > 0 FROM sqlite_master
+			WHERE type = 'table' AND name = $1`,
+		now: `CURRENT_TIMESTAMP`,
+		searchItems: `ri.id IN (SELECT docid FROM rss_item_search
+			WHERE rss_item_search MATCH %[1]s)`,
+		searchTerms: sqliteSearchTerms,
+		searchAnyItems: `ri.id IN (SELECT docid FROM rss_item_search
+			WHERE rss_item_search MATCH %[1]s)`,
+		searchAnyTerms: func(words []string) string {
+			var terms []string
+			for _, word := range words {
+				terms = append(terms, sqliteSearchTerms(word))
+			}
+			return strings.Join(terms, " OR ")
+		},
+		contains:  `instr(%s, %s) > 0`,
+		readState: `%s`,
+	},
+}
+
+// sqliteSearchTerms quotes each word so that none have special meaning in a
+// full-text query. This gives us items having all of the words as Postgres's
+// plainto_tsquery() does.
+func sqliteSearchTerms(s string) string {
+	var terms []string
+	for _, word := range strings.Fields(s) {
+		terms = append(terms, `"`+strings.ReplaceAll(word, `"`, `""`)+`"`)
+	}
+	return strings.Join(terms, " ")
+}
+
+func lookupDialect(dbType string) (dialect, error) {
+	if dbType == "" {
+		dbType = Postgres
+	}
+
+	d, ok := dialects[dbType]
+	if !ok {
+		return dialect{}, fmt.Errorf("unknown database type: %s", dbType)
+	}
+
+	for _, driver := range sql.Drivers() {
+		if driver == d.driver {
+			return d, nil
+		}
+	}
+
+	return dialect{}, fmt.Errorf(
+		"support for database type %s is not built in (build with -tags %s)",
+		dbType, dbType)
+}
+
+// OpenDB opens a handle to the database. This is a pool of connections.
+func OpenDB(c DBConfig) (*sql.DB, error) {
+	d, err := lookupDialect(c.Type)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.StatementTimeout > 0 && c.Type == SQLite {
+		return nil, fmt.Errorf("SQLite does not support statement timeouts")
+	}
+
+	db, err := sql.Open(d.driver, d.dsn(c))
+	if err != nil {
+		return nil, fmt.Errorf("unable to open database: %s", err)
+	}
+
+	// The pool replaces connections that go bad, so we don't need to check
+	// them ourselves.
+	if c.MaxOpenConns > 0 {
+		db.SetMaxOpenConns(c.MaxOpenConns)
+	}
+	if c.MaxIdleConns > 0 {
+		db.SetMaxIdleConns(c.MaxIdleConns)
+	}
+	if c.ConnMaxLifetime > 0 {
+		db.SetConnMaxLifetime(c.ConnMaxLifetime)
+	}
+
+	return db, nil
+}
+
+func tableExists(ctx context.Context, db *sql.DB, d dialect,
+	name string) (bool, error) {
+	var exists bool
+	if err := db.QueryRowContext(ctx, d.tableExists, name).Scan(
+		&exists); err != nil {
+		return false, fmt.Errorf("unable to check for table %s: %s", name, err)
+	}
+	return exists, nil
+}
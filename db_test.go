@@ -0,0 +1,48 @@
+package gorse
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOpenDBPool(t *testing.T) {
+	db, err := OpenDB(DBConfig{
+		Type:            Postgres,
+		MaxOpenConns:    5,
+		ConnMaxLifetime: time.Minute,
+	})
+	if err != nil {
+		t.Fatalf("OpenDB() = error %s", err)
+	}
+	defer db.Close()
+
+	if n := db.Stats().MaxOpenConnections; n != 5 {
+		t.Errorf("MaxOpenConnections = %d, wanted 5", n)
+	}
+
+	db, err = OpenDB(DBConfig{Type: Postgres})
+	if err != nil {
+		t.Fatalf("OpenDB() = error %s", err)
+	}
+	defer db.Close()
+
+	if n := db.Stats().MaxOpenConnections; n != 0 {
+		t.Errorf("MaxOpenConnections = %d, wanted 0 (unlimited)", n)
+	}
+}
+
+func TestPostgresDSNStatementTimeout(t *testing.T) {
+	dsn := dialects[Postgres].dsn(DBConfig{
+		Name:             "gorse",
+		StatementTimeout: 30 * time.Second,
+	})
+	if !strings.HasSuffix(dsn, " statement_timeout=30000") {
+		t.Errorf("dsn = %s, wanted statement_timeout=30000", dsn)
+	}
+
+	dsn = dialects[Postgres].dsn(DBConfig{Name: "gorse"})
+	if strings.Contains(dsn, "statement_timeout") {
+		t.Errorf("dsn = %s, wanted no statement_timeout", dsn)
+	}
+}
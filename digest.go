@@ -0,0 +1,122 @@
+package gorse
+
+import (
+	"context"
+	"fmt"
+)
+
+// DigestFeed summarizes a feed's items in a period, such as the last day.
+type DigestFeed struct {
+	FeedID   int64
+	FeedName string
+
+	// Count is how many items the feed has in the period, and Unread how many
+	// of those the user hasn't read.
+	Count  int
+	Unread int
+
+	// Items are the feed's newest items in the period, newest first. They
+	// have only their ID, title, link, publication date, and read state.
+	Items []UserItem
+}
+
+// Digest summarizes the items matching the filter by feed, such as those
+// published in the last day. Feeds with the most items come first. perFeed
+// is the most items to include for each feed.
+//
+// The filter's State, After, Limit, and Offset don't apply. We count items in
+// every state.
+func Digest(ctx context.Context, db Querier, dbType string, filter ItemFilter,
+	perFeed int) ([]DigestFeed, error) {
+	d, err := lookupDialect(dbType)
+	if err != nil {
+		return nil, err
+	}
+
+	filter.State = nil
+	filter.After = nil
+	from, args := itemFilterSQL(d, filter)
+
+	query := `
+SELECT ri.rss_feed_id, rf.name, COUNT(*),
+SUM(CASE WHEN COALESCE(ris.state, 'unread') = 'unread' THEN 1 ELSE 0 END)
+` + from + `
+GROUP BY ri.rss_feed_id, rf.name
+ORDER BY COUNT(*) DESC, rf.name, ri.rss_feed_id
+`
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to query digest counts: %s", err)
+	}
+
+	var feeds []DigestFeed
+	byID := map[int64]*DigestFeed{}
+	for rows.Next() {
+		var feed DigestFeed
+		if err := rows.Scan(&feed.FeedID, &feed.FeedName, &feed.Count,
+			&feed.Unread); err != nil {
+			_ = rows.Close()
+			return nil, fmt.Errorf("failed to scan row: %s", err)
+		}
+		feeds = append(feeds, feed)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failure fetching rows: %s", err)
+	}
+
+	if len(feeds) == 0 || perFeed <= 0 {
+		return feeds, nil
+	}
+	for i := range feeds {
+		byID[feeds[i].FeedID] = &feeds[i]
+	}
+
+	// Each feed's newest items, numbering them within their feed.
+	args = append(args, perFeed)
+	query = fmt.Sprintf(`
+SELECT id, title, link, publication_date, rss_feed_id, state
+FROM (
+  SELECT ri.id, ri.title, ri.link, ri.publication_date, ri.rss_feed_id,
+  COALESCE(ris.state, 'unread') AS state,
+  ROW_NUMBER() OVER (PARTITION BY ri.rss_feed_id
+    ORDER BY ri.publication_date DESC, ri.id DESC) AS n
+  %s
+) numbered
+WHERE n <= $%d
+ORDER BY rss_feed_id, n
+`, from, len(args))
+
+	rows, err = db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to query digest items: %s", err)
+	}
+
+	for rows.Next() {
+		var item UserItem
+		var state string
+		if err := rows.Scan(&item.ID, &item.Title, &item.Link,
+			&item.PublicationDate, &item.RSSFeedID, &state); err != nil {
+			_ = rows.Close()
+			return nil, fmt.Errorf("failed to scan row: %s", err)
+		}
+		if item.ReadState, err = ParseReadState(state); err != nil {
+			_ = rows.Close()
+			return nil, err
+		}
+
+		feed, ok := byID[item.RSSFeedID]
+		if !ok {
+			continue
+		}
+		item.FeedName = feed.FeedName
+		feed.Items = append(feed.Items, item)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failure fetching rows: %s", err)
+	}
+
+	return feeds, nil
+}
@@ -0,0 +1,146 @@
+package gorse
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"net/url"
+	"path"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+	"golang.org/x/net/html/charset"
+)
+
+// DiscoveredFeed is a feed a page links to.
+type DiscoveredFeed struct {
+	URL   string
+	Title string
+}
+
+// discoverableTypes are the types of feed links we look for. These are the
+// formats ParseFeed understands.
+var discoverableTypes = map[string]struct{}{
+	"application/atom+xml":  {},
+	"application/feed+json": {},
+	"application/json":      {},
+	"application/rdf+xml":   {},
+	"application/rss+xml":   {},
+	"application/xml":       {},
+	"text/xml":              {},
+}
+
+// fallbackFeedPaths are where sites commonly put their feeds, most common
+// first.
+var fallbackFeedPaths = []string{
+	"feed",
+	"rss",
+	"rss.xml",
+	"atom.xml",
+	"feed.xml",
+	"index.xml",
+	"feed.json",
+}
+
+// DiscoverFeeds finds the feeds the HTML page at the URL links to, in the
+// order it lists them. contentType is the Content-Type the page was served
+// with, if any.
+//
+// This is feed autodiscovery as browsers do it: we look for link elements
+// with rel alternate and a feed type.
+func DiscoverFeeds(data []byte, contentType, pageURL string) ([]DiscoveredFeed,
+	error) {
+	reader, err := charset.NewReader(bytes.NewReader(data), contentType)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode HTML: %s", err)
+	}
+
+	doc, err := html.Parse(reader)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse HTML: %s", err)
+	}
+
+	base, err := url.Parse(pageURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid page URL: %s: %s", pageURL, err)
+	}
+	if href := findBaseHref(doc); href != "" {
+		if u, err := base.Parse(href); err == nil {
+			base = u
+		}
+	}
+
+	var feeds []DiscoveredFeed
+	seen := map[string]struct{}{}
+	for _, link := range findElements(doc, atom.Link) {
+		if !isFeedLink(link) {
+			continue
+		}
+
+		// readerURL only allows http and https URLs.
+		feedURL := readerURL(base, attr(link, "href"))
+		if feedURL == "" {
+			continue
+		}
+		if _, ok := seen[feedURL]; ok {
+			continue
+		}
+		seen[feedURL] = struct{}{}
+
+		feeds = append(feeds, DiscoveredFeed{
+			URL:   feedURL,
+			Title: strings.Join(strings.Fields(attr(link, "title")), " "),
+		})
+	}
+
+	return feeds, nil
+}
+
+// isFeedLink decides whether the link element links to a feed.
+func isFeedLink(link *html.Node) bool {
+	alternate := false
+	for _, rel := range strings.Fields(attr(link, "rel")) {
+		if strings.EqualFold(rel, "alternate") {
+			alternate = true
+		}
+	}
+	if !alternate {
+		return false
+	}
+
+	mediaType, _, err := mime.ParseMediaType(attr(link, "type"))
+	if err != nil {
+		return false
+	}
+	_, ok := discoverableTypes[mediaType]
+	return ok
+}
+
+// FallbackFeedURLs gives URLs to try for a site's feed when the page at the
+// URL doesn't link to one. These are the common places for feeds under the
+// page's path and then under the site's root. For https://example.com/blog
+// they start https://example.com/blog/feed and later https://example.com/feed.
+func FallbackFeedURLs(pageURL string) ([]string, error) {
+	u, err := url.Parse(pageURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid page URL: %s: %s", pageURL, err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("not an http or https URL: %s", pageURL)
+	}
+
+	dirs := []string{"/"}
+	if dir := path.Clean("/" + u.Path); dir != "/" {
+		dirs = []string{dir + "/", "/"}
+	}
+
+	var urls []string
+	for _, dir := range dirs {
+		for _, p := range fallbackFeedPaths {
+			feedURL := url.URL{Scheme: u.Scheme, Host: u.Host, Path: dir + p}
+			urls = append(urls, feedURL.String())
+		}
+	}
+	return urls, nil
+}
@@ -0,0 +1,85 @@
+package gorse
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiscoverFeeds(t *testing.T) {
+	tests := []struct {
+		Name string
+		HTML string
+		Want []DiscoveredFeed
+	}{
+		{
+			Name: "feeds",
+			HTML: `<html><head>
+<link rel="stylesheet" type="text/css" href="/style.css">
+<link rel="alternate" type="application/rss+xml" title=" Posts
+  (RSS) " href="/feed.rss">
+<link rel="Alternate" type="Application/Atom+XML; charset=utf-8"
+	href="https://feeds.example.com/atom">
+<link rel="alternate" type="application/rss+xml" href="feed.rss">
+<link rel="alternate" hreflang="fr" href="/fr/">
+<link rel="alternate" type="application/rss+xml" href="javascript:evil()">
+<link rel="alternate" type="application/feed+json" href="/feed.json">
+</head></html>`,
+			Want: []DiscoveredFeed{
+				{URL: "https://example.com/feed.rss", Title: "Posts (RSS)"},
+				{URL: "https://feeds.example.com/atom"},
+				{URL: "https://example.com/feed.json"},
+			},
+		},
+		{
+			Name: "base",
+			HTML: `<base href="https://cdn.example.com/blog/">
+<link rel="alternate" type="application/atom+xml" href="atom.xml">`,
+			Want: []DiscoveredFeed{
+				{URL: "https://cdn.example.com/blog/atom.xml"},
+			},
+		},
+		{
+			Name: "none",
+			HTML: `<title>No feeds</title>`,
+		},
+	}
+
+	for _, test := range tests {
+		feeds, err := DiscoverFeeds([]byte(test.HTML), "",
+			"https://example.com/posts")
+		if err != nil {
+			t.Errorf("%s: DiscoverFeeds() = error %s", test.Name, err)
+			continue
+		}
+		if !reflect.DeepEqual(feeds, test.Want) {
+			t.Errorf("%s: DiscoverFeeds() = %+v, wanted %+v", test.Name, feeds,
+				test.Want)
+		}
+	}
+}
+
+func TestFallbackFeedURLs(t *testing.T) {
+	urls, err := FallbackFeedURLs("https://example.com/blog/?page=2")
+	if err != nil {
+		t.Fatalf("FallbackFeedURLs() = error %s", err)
+	}
+	if len(urls) != 2*len(fallbackFeedPaths) ||
+		urls[0] != "https://example.com/blog/feed" ||
+		urls[len(fallbackFeedPaths)] != "https://example.com/feed" {
+		t.Errorf("FallbackFeedURLs() = %q, wanted the blog's then the site's",
+			urls)
+	}
+
+	urls, err = FallbackFeedURLs("http://example.com")
+	if err != nil {
+		t.Fatalf("FallbackFeedURLs() = error %s", err)
+	}
+	if len(urls) != len(fallbackFeedPaths) ||
+		urls[1] != "http://example.com/rss" {
+		t.Errorf("FallbackFeedURLs() = %q, wanted the site's", urls)
+	}
+
+	if _, err := FallbackFeedURLs("ftp://example.com/"); err == nil {
+		t.Errorf("FallbackFeedURLs() of ftp URL = no error, wanted one")
+	}
+}
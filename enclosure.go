@@ -0,0 +1,203 @@
+package gorse
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Enclosure is a media file that comes with an item, such as a podcast
+// episode's audio.
+type Enclosure struct {
+	URL string
+
+	// Type is the file's MIME type, such as audio/mpeg. Blank if the feed
+	// didn't say.
+	Type string
+
+	// Length is the file's size in bytes. 0 if the feed didn't say.
+	Length int64
+
+	// Duration is how long the file plays. 0 if the feed didn't say.
+	Duration time.Duration
+}
+
+// Audio says whether the enclosure is audio we can play.
+func (e Enclosure) Audio() bool {
+	return strings.HasPrefix(e.Type, "audio/")
+}
+
+// Video says whether the enclosure is video we can play.
+func (e Enclosure) Video() bool {
+	return strings.HasPrefix(e.Type, "video/")
+}
+
+// xmlEnclosure is an RSS enclosure element.
+type xmlEnclosure struct {
+	URL    string `xml:"url,attr"`
+	Type   string `xml:"type,attr"`
+	Length string `xml:"length,attr"`
+}
+
+// xmlLink is an Atom link element. RSS link elements decode to one with only
+// text, which we ignore.
+type xmlLink struct {
+	Rel    string `xml:"rel,attr"`
+	Href   string `xml:"href,attr"`
+	Type   string `xml:"type,attr"`
+	Length string `xml:"length,attr"`
+}
+
+// enclosures gives the item's enclosures.
+//
+// We take RSS enclosure elements and Atom links with rel="enclosure". The
+// iTunes duration element gives how long the item's enclosures play. We
+// resolve relative URLs against base, where the payload came from.
+func (e itemElement) enclosures(base *url.URL) []Enclosure {
+	duration := parseITunesDuration(e.Duration)
+
+	var enclosures []Enclosure
+	for _, enc := range e.Enclosures {
+		enclosures = appendEnclosure(enclosures, base, enc.URL, enc.Type,
+			parseEnclosureLength(enc.Length), duration)
+	}
+	for _, l := range e.Links {
+		if strings.ToLower(strings.TrimSpace(l.Rel)) != "enclosure" {
+			continue
+		}
+		enclosures = appendEnclosure(enclosures, base, l.Href, l.Type,
+			parseEnclosureLength(l.Length), duration)
+	}
+	return enclosures
+}
+
+// appendEnclosure appends an enclosure from the attributes describing it.
+//
+// We skip it if it has no URL, or the same URL as one we have.
+func appendEnclosure(enclosures []Enclosure, base *url.URL, ref,
+	mimeType string, length int64, duration time.Duration) []Enclosure {
+	u := resolveURL(base, strings.TrimSpace(ref))
+	if u == "" {
+		return enclosures
+	}
+	for _, e := range enclosures {
+		if e.URL == u {
+			return enclosures
+		}
+	}
+
+	if length < 0 {
+		length = 0
+	}
+	if duration < 0 {
+		duration = 0
+	}
+
+	return append(enclosures, Enclosure{
+		URL:      u,
+		Type:     strings.ToLower(strings.TrimSpace(mimeType)),
+		Length:   length,
+		Duration: duration,
+	})
+}
+
+// parseEnclosureLength parses an enclosure's length attribute. We go without
+// one we can't parse, as it is only a hint.
+func parseEnclosureLength(s string) int64 {
+	length, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+	if err != nil {
+		return 0
+	}
+	return length
+}
+
+// parseITunesDuration parses an itunes:duration value. It is a number of
+// seconds, or H:MM:SS or MM:SS.
+//
+// We return 0 if we can't parse it.
+func parseITunesDuration(s string) time.Duration {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0
+	}
+
+	var seconds int64
+	for _, part := range strings.Split(s, ":") {
+		n, err := strconv.ParseInt(part, 10, 64)
+		if err != nil || n < 0 {
+			return 0
+		}
+		seconds = seconds*60 + n
+	}
+
+	return time.Duration(seconds) * time.Second
+}
+
+// addItemEnclosures records the item's enclosures.
+func addItemEnclosures(ctx context.Context, db Querier, itemID int64,
+	enclosures []Enclosure) error {
+	query := `
+INSERT INTO rss_item_enclosure (item_id, url, type, length, duration_seconds)
+VALUES ($1, $2, $3, $4, $5)
+`
+
+	for _, e := range enclosures {
+		if _, err := db.ExecContext(ctx, query, itemID, e.URL, e.Type, e.Length,
+			int64(e.Duration/time.Second)); err != nil {
+			return fmt.Errorf("failed to add enclosure [%s] of item %d: %s", e.URL,
+				itemID, err)
+		}
+	}
+
+	return nil
+}
+
+// ItemEnclosures retrieves the enclosures of the items, by item ID. Items
+// without any aren't included.
+func ItemEnclosures(ctx context.Context, db Querier,
+	itemIDs []int64) (map[int64][]Enclosure, error) {
+	enclosures := map[int64][]Enclosure{}
+	if len(itemIDs) == 0 {
+		return enclosures, nil
+	}
+
+	placeholders := make([]string, len(itemIDs))
+	params := make([]interface{}, len(itemIDs))
+	for i, id := range itemIDs {
+		placeholders[i] = fmt.Sprintf("$%d", i+1)
+		params[i] = id
+	}
+
+	query := `
+SELECT item_id, url, type, length, duration_seconds
+FROM rss_item_enclosure
+WHERE item_id IN (` + strings.Join(placeholders, ", ") + `)
+ORDER BY id
+`
+
+	rows, err := db.QueryContext(ctx, query, params...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to query enclosures: %s", err)
+	}
+
+	for rows.Next() {
+		var id, seconds int64
+		var e Enclosure
+		if err := rows.Scan(&id, &e.URL, &e.Type, &e.Length,
+			&seconds); err != nil {
+			_ = rows.Close()
+			return nil, fmt.Errorf("failed to scan row: %s", err)
+		}
+		e.Duration = time.Duration(seconds) * time.Second
+		enclosures[id] = append(enclosures[id], e)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failure fetching rows: %s", err)
+	}
+
+	return enclosures, nil
+}
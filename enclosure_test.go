@@ -0,0 +1,153 @@
+package gorse
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseFeedEnclosures(t *testing.T) {
+	tests := []struct {
+		Name    string
+		Payload string
+		Want    [][]Enclosure
+	}{
+		{
+			Name: "RSS podcast",
+			Payload: `<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0" xmlns:itunes="http://www.itunes.com/dtds/podcast-1.0.dtd">
+<channel>
+<title>Podcast</title>
+<link>https://example.com/</link>
+<description>Podcast</description>
+<item>
+<title>Episode 2</title>
+<link>https://example.com/2</link>
+<enclosure url="/episodes/2.mp3" length="12345678" type="Audio/MPEG"/>
+<itunes:duration>1:02:03</itunes:duration>
+</item>
+<item>
+<title>Episode 1</title>
+<link>https://example.com/1</link>
+<enclosure url="https://cdn.example.com/1.mp4" length="unknown"
+	type="video/mp4"/>
+<itunes:duration>245</itunes:duration>
+</item>
+<item>
+<title>Notes</title>
+<link>https://example.com/notes</link>
+</item>
+</channel>
+</rss>`,
+			Want: [][]Enclosure{
+				{{
+					URL:      "https://example.com/episodes/2.mp3",
+					Type:     "audio/mpeg",
+					Length:   12345678,
+					Duration: time.Hour + 2*time.Minute + 3*time.Second,
+				}},
+				{{
+					URL:      "https://cdn.example.com/1.mp4",
+					Type:     "video/mp4",
+					Duration: 4*time.Minute + 5*time.Second,
+				}},
+				nil,
+			},
+		},
+		{
+			Name: "Atom",
+			Payload: `<?xml version="1.0" encoding="UTF-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom">
+<title>Podcast</title>
+<updated>2020-03-01T12:00:00Z</updated>
+<entry>
+<title>Episode 1</title>
+<link href="https://example.com/1"/>
+<link rel="enclosure" href="https://example.com/1.ogg" type="audio/ogg"
+	length="1000"/>
+<link rel="enclosure" href="https://example.com/1.ogg" type="audio/ogg"/>
+<updated>2020-03-01T12:00:00Z</updated>
+</entry>
+</feed>`,
+			Want: [][]Enclosure{
+				{{
+					URL:    "https://example.com/1.ogg",
+					Type:   "audio/ogg",
+					Length: 1000,
+				}},
+			},
+		},
+		{
+			Name: "JSON Feed",
+			Payload: `{
+	"version": "https://jsonfeed.org/version/1.1",
+	"title": "Podcast",
+	"items": [
+		{
+			"id": "1",
+			"url": "https://example.com/1",
+			"content_text": "Episode 1",
+			"attachments": [
+				{
+					"url": "1.m4a",
+					"mime_type": "audio/x-m4a",
+					"size_in_bytes": 2000,
+					"duration_in_seconds": 90
+				}
+			]
+		}
+	]
+}`,
+			Want: [][]Enclosure{
+				{{
+					URL:      "https://example.com/feeds/1.m4a",
+					Type:     "audio/x-m4a",
+					Length:   2000,
+					Duration: 90 * time.Second,
+				}},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			feed, err := ParseFeed([]byte(test.Payload), ParseOptions{
+				URL: "https://example.com/feeds/podcast",
+			})
+			if err != nil {
+				t.Fatalf("ParseFeed() = error %s", err)
+			}
+			if len(feed.Items) != len(test.Want) {
+				t.Fatalf("got %d items, wanted %d", len(feed.Items), len(test.Want))
+			}
+			for i, item := range feed.Items {
+				if !reflect.DeepEqual(item.Enclosures, test.Want[i]) {
+					t.Errorf("item %d enclosures = %+v, wanted %+v", i+1,
+						item.Enclosures, test.Want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestParseITunesDuration(t *testing.T) {
+	tests := []struct {
+		Input string
+		Want  time.Duration
+	}{
+		{"", 0},
+		{"90", 90 * time.Second},
+		{"4:05", 4*time.Minute + 5*time.Second},
+		{"01:02:03", time.Hour + 2*time.Minute + 3*time.Second},
+		{" 10:00 ", 10 * time.Minute},
+		{"1h", 0},
+		{"1::2", 0},
+	}
+
+	for _, test := range tests {
+		if got := parseITunesDuration(test.Input); got != test.Want {
+			t.Errorf("parseITunesDuration(%q) = %s, wanted %s", test.Input, got,
+				test.Want)
+		}
+	}
+}
@@ -0,0 +1,224 @@
+package gorse
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// We write feeds in the form the rss package does, but to a writer rather
+// than a file, and as Atom too. We also write what we know of items beyond
+// what the rss package does: their enclosures, categories, authors, and full
+// content.
+
+// contentNS is the namespace of the RSS content module, which gives the
+// encoded element for an item's full content.
+const contentNS = "http://purl.org/rss/1.0/modules/content/"
+
+// dcNS is the namespace of Dublin Core, which gives the creator element for
+// an item's author. RSS's own author element must be an email address, and we
+// have only names.
+const dcNS = "http://purl.org/dc/elements/1.1/"
+
+// rssXML is an RSS 2.0 document.
+type rssXML struct {
+	XMLName   xml.Name      `xml:"rss"`
+	Version   string        `xml:"version,attr"`
+	ContentNS string        `xml:"xmlns:content,attr"`
+	DCNS      string        `xml:"xmlns:dc,attr"`
+	Channel   rssChannelXML `xml:"channel"`
+}
+
+type rssChannelXML struct {
+	Title         string       `xml:"title"`
+	Link          string       `xml:"link"`
+	Description   string       `xml:"description"`
+	PubDate       string       `xml:"pubDate"`
+	LastBuildDate string       `xml:"lastBuildDate"`
+	Items         []rssItemXML `xml:"item"`
+}
+
+type rssItemXML struct {
+	Title       string            `xml:"title"`
+	Link        string            `xml:"link"`
+	Description string            `xml:"description"`
+	Content     string            `xml:"content:encoded,omitempty"`
+	Creator     string            `xml:"dc:creator,omitempty"`
+	Categories  []string          `xml:"category"`
+	Enclosures  []rssEnclosureXML `xml:"enclosure"`
+	PubDate     string            `xml:"pubDate"`
+	GUID        rssGUIDXML        `xml:"guid"`
+}
+
+// rssEnclosureXML is an RSS enclosure element. RSS requires each attribute,
+// so we say 0 if we don't know the length.
+type rssEnclosureXML struct {
+	URL    string `xml:"url,attr"`
+	Length int64  `xml:"length,attr"`
+	Type   string `xml:"type,attr"`
+}
+
+type rssGUIDXML struct {
+	IsPermaLink string `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+// WriteRSS writes the feed as RSS 2.0.
+//
+// An item's GUID is its link if it has no GUID. Its content is in the content
+// module's encoded element, and its author in Dublin Core's creator element.
+func WriteRSS(w io.Writer, feed Feed) error {
+	out := rssXML{
+		Version:   "2.0",
+		ContentNS: contentNS,
+		DCNS:      dcNS,
+		Channel: rssChannelXML{
+			Title:         feed.Title,
+			Link:          feed.Link,
+			Description:   feed.Description,
+			PubDate:       feed.PubDate.Format(time.RFC1123Z),
+			LastBuildDate: feed.PubDate.Format(time.RFC1123Z),
+		},
+	}
+
+	for _, item := range feed.Items {
+		guid := item.GUID
+		if guid == "" {
+			guid = item.Link
+		}
+		var enclosures []rssEnclosureXML
+		for _, enc := range item.Enclosures {
+			enclosures = append(enclosures, rssEnclosureXML{
+				URL:    enc.URL,
+				Length: enc.Length,
+				Type:   enc.Type,
+			})
+		}
+		out.Channel.Items = append(out.Channel.Items, rssItemXML{
+			Title:       item.Title,
+			Link:        item.Link,
+			Description: item.Description,
+			Content:     item.Content,
+			Creator:     item.Author,
+			Categories:  item.Categories,
+			Enclosures:  enclosures,
+			PubDate:     item.PubDate.Format(time.RFC1123Z),
+			// We can't tell if the GUIDs we have are links.
+			GUID: rssGUIDXML{IsPermaLink: "false", Value: guid},
+		})
+	}
+
+	return writeXML(w, out)
+}
+
+// atomXML is an Atom document.
+type atomXML struct {
+	XMLName xml.Name       `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string         `xml:"title"`
+	ID      string         `xml:"id"`
+	Links   []atomLinkXML  `xml:"link"`
+	Updated string         `xml:"updated"`
+	Author  atomAuthorXML  `xml:"author"`
+	Entries []atomEntryXML `xml:"entry"`
+}
+
+type atomLinkXML struct {
+	Rel    string `xml:"rel,attr,omitempty"`
+	Href   string `xml:"href,attr"`
+	Type   string `xml:"type,attr,omitempty"`
+	Length string `xml:"length,attr,omitempty"`
+}
+
+type atomAuthorXML struct {
+	Name string `xml:"name"`
+}
+
+type atomEntryXML struct {
+	Title      string            `xml:"title"`
+	ID         string            `xml:"id"`
+	Links      []atomLinkXML     `xml:"link"`
+	Updated    string            `xml:"updated"`
+	Author     *atomAuthorXML    `xml:"author"`
+	Categories []atomCategoryXML `xml:"category"`
+	Summary    *atomContentXML   `xml:"summary"`
+	Content    atomContentXML    `xml:"content"`
+}
+
+type atomCategoryXML struct {
+	Term string `xml:"term,attr"`
+}
+
+type atomContentXML struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"`
+}
+
+// WriteAtom writes the feed as Atom. The feed's Link is where the feed is,
+// and so is its ID. Entries' descriptions and content are HTML.
+//
+// An entry's ID is its GUID, or if it has none, its link. Atom wants these to
+// be URIs, so GUIDs should be.
+//
+// Atom has one content element, so if an entry has content, its description
+// is its summary. Its enclosures are links with rel="enclosure".
+func WriteAtom(w io.Writer, feed Feed) error {
+	out := atomXML{
+		Title:   feed.Title,
+		ID:      feed.Link,
+		Links:   []atomLinkXML{{Rel: "self", Href: feed.Link}},
+		Updated: feed.PubDate.UTC().Format(time.RFC3339),
+		Author:  atomAuthorXML{Name: feed.Title},
+	}
+
+	for _, item := range feed.Items {
+		id := item.GUID
+		if id == "" {
+			id = item.Link
+		}
+		entry := atomEntryXML{
+			Title:   item.Title,
+			ID:      id,
+			Links:   []atomLinkXML{{Href: item.Link}},
+			Updated: item.PubDate.UTC().Format(time.RFC3339),
+			Content: atomContentXML{Type: "html", Value: item.Description},
+		}
+		if item.Content != "" {
+			entry.Summary = &atomContentXML{Type: "html", Value: item.Description}
+			entry.Content.Value = item.Content
+		}
+		if item.Author != "" {
+			entry.Author = &atomAuthorXML{Name: item.Author}
+		}
+		for _, category := range item.Categories {
+			entry.Categories = append(entry.Categories,
+				atomCategoryXML{Term: category})
+		}
+		for _, enc := range item.Enclosures {
+			link := atomLinkXML{Rel: "enclosure", Href: enc.URL, Type: enc.Type}
+			if enc.Length > 0 {
+				link.Length = strconv.FormatInt(enc.Length, 10)
+			}
+			entry.Links = append(entry.Links, link)
+		}
+		out.Entries = append(out.Entries, entry)
+	}
+
+	return writeXML(w, out)
+}
+
+// writeXML writes the document with an XML header.
+func writeXML(w io.Writer, v interface{}) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return fmt.Errorf("unable to write XML: %s", err)
+	}
+
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(v); err != nil {
+		return fmt.Errorf("failed to marshal xml: %s", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,136 @@
+package gorse
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/horgh/rss"
+)
+
+func TestWriteFeed(t *testing.T) {
+	pubDate := time.Date(2020, 3, 1, 14, 5, 0, 0, time.UTC)
+	feed := Feed{
+		Title:       "Starred <items>",
+		Link:        "https://gorse.example.com/shared/token.xml",
+		Description: "What I found interesting",
+		PubDate:     pubDate,
+		Items: []Item{
+			{
+				Item: rss.Item{
+					Title:       "Coffee & cake",
+					Link:        "https://example.com/1?a=1&b=2",
+					Description: "<p>About <b>cake</b></p>",
+					PubDate:     pubDate,
+					GUID:        "https://example.com/guid/1",
+				},
+				Enclosures: []Enclosure{
+					{
+						URL:    "https://example.com/1.mp3?a=1&b=2",
+						Type:   "audio/mpeg",
+						Length: 1234,
+					},
+					{URL: "https://example.com/1.jpg"},
+				},
+				Categories: []string{"Food & drink", "Baking"},
+				Author:     "Example <Blog>",
+			},
+			{
+				Item: rss.Item{
+					Title:       "No GUID",
+					Link:        "https://example.com/2",
+					Description: "Short",
+					PubDate:     pubDate.Add(-time.Hour),
+				},
+				Content: "<p>The whole <i>article</i></p>",
+			},
+		},
+	}
+
+	writers := map[string]func(*bytes.Buffer) error{
+		"RSS":  func(buf *bytes.Buffer) error { return WriteRSS(buf, feed) },
+		"Atom": func(buf *bytes.Buffer) error { return WriteAtom(buf, feed) },
+	}
+
+	for name, write := range writers {
+		var buf bytes.Buffer
+		if err := write(&buf); err != nil {
+			t.Fatalf("Write%s() = error %s", name, err)
+		}
+
+		// The rss package can read what we write.
+		parsed, err := rss.ParseFeedXML(buf.Bytes())
+		if err != nil {
+			t.Fatalf("%s: ParseFeedXML() = error %s: %s", name, err, buf.String())
+		}
+
+		if parsed.Title != feed.Title || len(parsed.Items) != 2 {
+			t.Fatalf("%s: parsed %+v, wanted the feed", name, parsed)
+		}
+		for i, item := range feed.Items {
+			got := parsed.Items[i]
+			// The rss package reads Atom's content as the description, and there
+			// it's the item's content if it has any.
+			description := item.Description
+			if name == "Atom" && item.Content != "" {
+				description = item.Content
+			}
+			if got.Title != item.Title || got.Link != item.Link ||
+				got.Description != description ||
+				!got.PubDate.Equal(item.PubDate) {
+				t.Errorf("%s: item %d = %+v, wanted %+v", name, i, got, item)
+			}
+		}
+		if parsed.Items[1].GUID != "https://example.com/2" {
+			t.Errorf("%s: item without GUID has GUID %q, wanted its link", name,
+				parsed.Items[1].GUID)
+		}
+	}
+
+	// The rss package doesn't read the rest, so look for it.
+	var buf bytes.Buffer
+	if err := WriteRSS(&buf, feed); err != nil {
+		t.Fatalf("WriteRSS() = error %s", err)
+	}
+	for _, want := range []string{
+		`xmlns:content="http://purl.org/rss/1.0/modules/content/"`,
+		`xmlns:dc="http://purl.org/dc/elements/1.1/"`,
+		"<dc:creator>Example &lt;Blog&gt;</dc:creator>",
+		"<content:encoded>&lt;p&gt;The whole &lt;i&gt;article&lt;/i&gt;&lt;/p&gt;" +
+			"</content:encoded>",
+		"<category>Food &amp; drink</category>",
+		`<enclosure url="https://example.com/1.mp3?a=1&amp;b=2" length="1234" ` +
+			`type="audio/mpeg"></enclosure>`,
+		`<enclosure url="https://example.com/1.jpg" length="0" type="">` +
+			`</enclosure>`,
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("WriteRSS() = %s, wanted %s", buf.String(), want)
+		}
+	}
+	// RSS's author element is an email address.
+	if strings.Contains(buf.String(), "<author>") {
+		t.Errorf("WriteRSS() = %s, wanted no author element", buf.String())
+	}
+	if strings.Count(buf.String(), "<dc:creator>") != 1 {
+		t.Errorf("WriteRSS() = %s, wanted a creator only on the first item",
+			buf.String())
+	}
+
+	buf.Reset()
+	if err := WriteAtom(&buf, feed); err != nil {
+		t.Fatalf("WriteAtom() = error %s", err)
+	}
+	for _, want := range []string{
+		"<name>Example &lt;Blog&gt;</name>",
+		`<category term="Food &amp; drink"></category>`,
+		`<link rel="enclosure" href="https://example.com/1.mp3?a=1&amp;b=2" ` +
+			`type="audio/mpeg" length="1234"></link>`,
+		`<summary type="html">Short</summary>`,
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("WriteAtom() = %s, wanted %s", buf.String(), want)
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package gorse
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// ExportVersion is the version of the format ExportUser writes. It changes if
+// the format changes in a way readers would need to know about.
+const ExportVersion = 1
+
+// ExportedUser is the user in an export.
+type ExportedUser struct {
+	Email string `json:"email"`
+	Admin bool   `json:"admin"`
+}
+
+// ExportedFeed is a feed the user subscribes to in an export.
+type ExportedFeed struct {
+	ID                     int64  `json:"id"`
+	Name                   string `json:"name"`
+	URI                    string `json:"uri"`
+	UpdateFrequencySeconds int64  `json:"update_frequency_seconds"`
+	Archive                bool   `json:"archive"`
+	Active                 bool   `json:"active"`
+}
+
+// ExportedItem is an item the user set a state on in an export.
+type ExportedItem struct {
+	ID              int64     `json:"id"`
+	FeedID          int64     `json:"feed_id"`
+	FeedName        string    `json:"feed_name"`
+	Title           string    `json:"title"`
+	Description     string    `json:"description"`
+	Link            string    `json:"link"`
+	GUID            string    `json:"guid,omitempty"`
+	PublicationDate time.Time `json:"publication_date"`
+	State           string    `json:"state"`
+	Note            string    `json:"note,omitempty"`
+}
+
+// ExportedStateChange is a change the user made to an item's state in an
+// export.
+type ExportedStateChange struct {
+	ItemID   int64     `json:"item_id"`
+	OldState string    `json:"old_state"`
+	NewState string    `json:"new_state"`
+	Time     time.Time `json:"time"`
+}
+
+// ExportUser writes all of the user's data as a JSON object. This is the user,
+// the feeds they subscribe to, the items they set a state on along with their
+// states and notes, and the history of their state changes.
+//
+// Items they never set a state on are unread and aren't included. There can be
+// many items, so we write them as we read them rather than all at once.
+func ExportUser(ctx context.Context, db Querier, userID int,
+	w io.Writer) error {
+	user, err := GetUser(ctx, db, userID)
+	if err != nil {
+		return err
+	}
+
+	feeds, err := ListSubscriptions(ctx, db, userID)
+	if err != nil {
+		return err
+	}
+
+	changes, err := exportStateChanges(ctx, db, userID)
+	if err != nil {
+		return err
+	}
+
+	header := struct {
+		Version       int                   `json:"version"`
+		ExportTime    time.Time             `json:"export_time"`
+		User          ExportedUser          `json:"user"`
+		Subscriptions []ExportedFeed        `json:"subscriptions"`
+		StateChanges  []ExportedStateChange `json:"state_changes"`
+	}{
+		Version:       ExportVersion,
+		ExportTime:    time.Now().UTC(),
+		User:          ExportedUser{Email: user.Email, Admin: user.Admin},
+		Subscriptions: []ExportedFeed{},
+		StateChanges:  changes,
+	}
+	for _, feed := range feeds {
+		header.Subscriptions = append(header.Subscriptions, ExportedFeed{
+			ID:                     feed.ID,
+			Name:                   feed.Name,
+			URI:                    feed.URI,
+			UpdateFrequencySeconds: feed.UpdateFrequencySeconds,
+			Archive:                feed.Archive,
+			Active:                 feed.Active,
+		})
+	}
+
+	buf, err := json.Marshal(header)
+	if err != nil {
+		return fmt.Errorf("unable to encode export: %s", err)
+	}
+
+	// Leave the object open so we can add the items to it one at a time.
+	if _, err := fmt.Fprintf(w, "%s,\"items\":[", buf[:len(buf)-1]); err != nil {
+		return fmt.Errorf("unable to write export: %s", err)
+	}
+
+	query := `
+SELECT
+ri.id, ri.rss_feed_id, rf.name, ri.title, ri.description, ri.link, ri.guid,
+ri.publication_date, ris.state, COALESCE(ris.note, '')
+FROM rss_item_state ris
+JOIN rss_item ri ON ri.id = ris.item_id
+JOIN rss_feed rf ON rf.id = ri.rss_feed_id
+WHERE ris.user_id = $1
+ORDER BY ri.id
+`
+
+	rows, err := db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return fmt.Errorf("unable to query items: %s", err)
+	}
+
+	sep := "\n"
+	for rows.Next() {
+		var item ExportedItem
+		var guid *string
+		if err := rows.Scan(&item.ID, &item.FeedID, &item.FeedName, &item.Title,
+			&item.Description, &item.Link, &guid, &item.PublicationDate,
+			&item.State, &item.Note); err != nil {
+			_ = rows.Close()
+			return fmt.Errorf("failed to scan row: %s", err)
+		}
+		if guid != nil {
+			item.GUID = *guid
+		}
+		item.PublicationDate = item.PublicationDate.UTC()
+
+		buf, err := json.Marshal(item)
+		if err != nil {
+			_ = rows.Close()
+			return fmt.Errorf("unable to encode item: %s", err)
+		}
+		if _, err := fmt.Fprintf(w, "%s%s", sep, buf); err != nil {
+			_ = rows.Close()
+			return fmt.Errorf("unable to write export: %s", err)
+		}
+		sep = ",\n"
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failure fetching rows: %s", err)
+	}
+
+	if _, err := io.WriteString(w, "\n]}\n"); err != nil {
+		return fmt.Errorf("unable to write export: %s", err)
+	}
+
+	return nil
+}
+
+// exportStateChanges retrieves all of the user's state changes, oldest first.
+func exportStateChanges(ctx context.Context, db Querier,
+	userID int) ([]ExportedStateChange, error) {
+	query := `
+SELECT item_id, old_state, new_state, create_time
+FROM rss_item_state_history
+WHERE user_id = $1
+ORDER BY create_time, id
+`
+
+	rows, err := db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("unable to query state history: %s", err)
+	}
+
+	changes := []ExportedStateChange{}
+	for rows.Next() {
+		var change ExportedStateChange
+		if err := rows.Scan(&change.ItemID, &change.OldState, &change.NewState,
+			&change.Time); err != nil {
+			_ = rows.Close()
+			return nil, fmt.Errorf("failed to scan row: %s", err)
+		}
+		change.Time = change.Time.UTC()
+		changes = append(changes, change)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failure fetching rows: %s", err)
+	}
+
+	return changes, nil
+}
@@ -0,0 +1,685 @@
+package gorse
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"html"
+	"io"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/horgh/rss"
+	"golang.org/x/net/html/charset"
+)
+
+// Feed holds a feed we parsed or one we write.
+type Feed struct {
+	Title       string
+	Link        string
+	Description string
+	PubDate     time.Time
+
+	// Type is the format we parsed the feed as. e.g., RSS, RDF, Atom.
+	Type string
+
+	Items []Item
+
+	// Encoding is the name of the character encoding we decoded the payload
+	// from. This is useful for diagnosing feeds that declare the wrong encoding
+	// or none at all.
+	Encoding string
+
+	// Warnings describes problems we worked around while parsing. In strict
+	// mode any of these is an error instead.
+	Warnings []string
+}
+
+// Item holds an item/entry from a parsed feed.
+type Item struct {
+	rss.Item
+
+	// Raw is the item's element as it appeared in the payload, converted to
+	// UTF-8. We only set it if ParseOptions.KeepRaw is set.
+	Raw string
+
+	// Enclosures are the media files that come with the item.
+	Enclosures []Enclosure
+
+	// Categories are the categories or tags the feed gives the item.
+	Categories []string
+
+	// Author names who wrote the item. We don't parse it, but we write it in
+	// feeds we serve.
+	Author string
+
+	// Content is the item's full content as HTML, if we have more than its
+	// description. As with Author, we only write it.
+	Content string
+}
+
+// ParseOptions holds information about how to parse a feed.
+type ParseOptions struct {
+	// ContentType is the Content-Type header the payload was served with, if
+	// any. We use it as a hint if the payload's declared encoding looks wrong.
+	ContentType string
+
+	// URL is where the payload came from. We resolve relative links against it
+	// when we have to fall back to parsing HTML.
+	URL string
+
+	// MaxBytes is the largest payload we will parse. 0 means
+	// DefaultMaxFeedBytes.
+	MaxBytes int64
+
+	// MaxItems is the most items we accept in a feed. 0 means
+	// DefaultMaxFeedItems.
+	MaxItems int
+
+	// MaxDepth is the deepest we accept elements to be nested. 0 means
+	// DefaultMaxFeedDepth.
+	MaxDepth int
+
+	// KeepRaw causes us to set each item's Raw field. This lets us store items
+	// as they were so we can reprocess them later.
+	KeepRaw bool
+
+	// Strict causes us to fail if the feed violates its spec. Otherwise we
+	// recover where we can and record what we recovered from in the feed's
+	// Warnings.
+	Strict bool
+}
+
+const (
+	// DefaultMaxFeedBytes is the default for ParseOptions.MaxBytes.
+	DefaultMaxFeedBytes = 10 * 1024 * 1024
+
+	// DefaultMaxFeedItems is the default for ParseOptions.MaxItems.
+	DefaultMaxFeedItems = 1000
+
+	// DefaultMaxFeedDepth is the default for ParseOptions.MaxDepth.
+	DefaultMaxFeedDepth = 64
+)
+
+// ParseFeed takes a feed's raw payload and returns a struct describing the
+// feed.
+//
+// We support RSS, RDF, Atom, and JSON Feed. If the payload is none of those but
+// is an HTML page with h-entry microformats, we take the entries from it
+// instead.
+//
+// We refuse to parse payloads that exceed the limits in the options. This is
+// so that a hostile or broken feed can't make us use unbounded memory.
+func ParseFeed(data []byte, opts ParseOptions) (*Feed, error) {
+	opts = opts.withDefaults()
+
+	if int64(len(data)) > opts.MaxBytes {
+		return nil, fmt.Errorf("feed is too large: %d bytes (limit %d)", len(data),
+			opts.MaxBytes)
+	}
+
+	if looksLikeJSONFeed(data) {
+		feed, err := parseJSONFeed(data, opts)
+		if err != nil {
+			return nil, err
+		}
+		return checkParsedFeed(feed, opts)
+	}
+
+	isHTML := looksLikeHTML(data, opts.ContentType)
+
+	var feed *Feed
+	limitsErr := checkXMLLimits(data, opts)
+	err := limitsErr
+	if err == nil {
+		feed, err = parseFeedXML(data, opts.ContentType)
+	}
+
+	// The most common reason a feed is not well formed is unescaped ampersands
+	// or HTML entities XML does not know about. Try escaping those.
+	if err != nil && limitsErr == nil && !opts.Strict && !isHTML {
+		if repaired, changed := escapeEntities(data); changed {
+			if repairedFeed, repairedErr := parseFeedXML(repaired,
+				opts.ContentType); repairedErr == nil {
+				feed, err, data = repairedFeed, nil, repaired
+				feed.Warnings = append(feed.Warnings,
+					"feed is not well formed: it has unescaped ampersands or HTML entities")
+			}
+		}
+	}
+
+	if err == nil {
+		if err := setItemElements(feed, data, opts.URL); err != nil {
+			feed.Warnings = append(feed.Warnings,
+				fmt.Sprintf("unable to find enclosures and categories: %s", err))
+		}
+	}
+
+	if err == nil && opts.KeepRaw {
+		if err := setRawItems(feed, data); err != nil {
+			return nil, fmt.Errorf("unable to find raw items: %s", err)
+		}
+	}
+	if err != nil {
+		if !isHTML {
+			return nil, err
+		}
+
+		var htmlErr error
+		feed, htmlErr = parseHFeed(data, opts)
+		if htmlErr != nil {
+			return nil, fmt.Errorf("%s (as h-feed: %s)", err, htmlErr)
+		}
+	}
+
+	return checkParsedFeed(feed, opts)
+}
+
+// checkParsedFeed applies the limits and checks common to every format to a
+// feed we parsed.
+func checkParsedFeed(feed *Feed, opts ParseOptions) (*Feed, error) {
+	if len(feed.Items) > opts.MaxItems {
+		return nil, fmt.Errorf("feed has too many items: %d (limit %d)",
+			len(feed.Items), opts.MaxItems)
+	}
+
+	violations, notes := checkFeed(feed)
+	feed.Warnings = append(feed.Warnings, violations...)
+
+	if opts.Strict && len(feed.Warnings) > 0 {
+		return nil, fmt.Errorf("feed is not valid: %s",
+			strings.Join(feed.Warnings, "; "))
+	}
+
+	feed.Warnings = append(feed.Warnings, notes...)
+
+	return feed, nil
+}
+
+// checkFeed looks for problems in a parsed feed.
+//
+// We return a description of each spec violation, and separately of each
+// problem that's valid but that we'd rather not see, such as an item without
+// a link or publication date. RSS 2.0 makes both optional, so strict mode
+// allows them.
+func checkFeed(feed *Feed) ([]string, []string) {
+	var violations, notes []string
+
+	if feed.Title == "" {
+		violations = append(violations, "feed has no title")
+	}
+
+	links := map[string]struct{}{}
+	guids := map[string]struct{}{}
+
+	for i, item := range feed.Items {
+		if item.Link == "" {
+			notes = append(notes, fmt.Sprintf("item %d has no link", i+1))
+		} else {
+			if _, exists := links[item.Link]; exists {
+				notes = append(notes, fmt.Sprintf("item %d has a duplicate link: %s",
+					i+1, item.Link))
+			}
+			links[item.Link] = struct{}{}
+		}
+
+		if item.Title == "" && item.Description == "" {
+			violations = append(violations,
+				fmt.Sprintf("item %d has neither a title nor a description", i+1))
+		}
+
+		if item.PubDate.IsZero() {
+			notes = append(notes,
+				fmt.Sprintf("item %d has no publication date we could parse", i+1))
+		}
+
+		// A GUID identifies one item.
+		if item.GUID != "" {
+			if _, exists := guids[item.GUID]; exists {
+				violations = append(violations,
+					fmt.Sprintf("item %d has a duplicate GUID: %s", i+1, item.GUID))
+			}
+			guids[item.GUID] = struct{}{}
+		}
+	}
+
+	return violations, notes
+}
+
+// escapeEntities escapes ampersands that don't start a character or entity
+// reference XML knows about.
+//
+// We turn HTML entities (e.g., &nbsp;) into numeric character references and
+// escape bare ampersands. We leave CDATA sections and comments alone.
+//
+// We return whether we changed anything.
+func escapeEntities(data []byte) ([]byte, bool) {
+	var out bytes.Buffer
+	changed := false
+
+	for i := 0; i < len(data); {
+		if bytes.HasPrefix(data[i:], []byte("<![CDATA[")) ||
+			bytes.HasPrefix(data[i:], []byte("<!--")) {
+			end := []byte("]]>")
+			if data[i+1] == '!' && data[i+2] == '-' {
+				end = []byte("-->")
+			}
+
+			j := bytes.Index(data[i:], end)
+			if j == -1 {
+				out.Write(data[i:])
+				break
+			}
+			out.Write(data[i : i+j+len(end)])
+			i += j + len(end)
+			continue
+		}
+
+		if data[i] != '&' {
+			out.WriteByte(data[i])
+			i++
+			continue
+		}
+
+		ref := entityRefRE.Find(data[i:])
+		if ref == nil {
+			out.WriteString("&amp;")
+			changed = true
+			i++
+			continue
+		}
+
+		switch name := string(ref[1 : len(ref)-1]); {
+		case name[0] == '#', xmlEntities[name]:
+			out.Write(ref)
+		default:
+			unescaped := html.UnescapeString(string(ref))
+			if unescaped == string(ref) {
+				out.WriteString("&amp;")
+				out.Write(ref[1:])
+			} else {
+				for _, r := range unescaped {
+					fmt.Fprintf(&out, "&#%d;", r)
+				}
+			}
+			changed = true
+		}
+		i += len(ref)
+	}
+
+	return out.Bytes(), changed
+}
+
+var entityRefRE = regexp.MustCompile(`^&(#[0-9]+|#x[0-9a-fA-F]+|[A-Za-z][A-Za-z0-9]*);`)
+
+// xmlEntities are the entities XML predefines.
+var xmlEntities = map[string]bool{
+	"amp":  true,
+	"lt":   true,
+	"gt":   true,
+	"quot": true,
+	"apos": true,
+}
+
+// withDefaults fills in any unset limits.
+func (o ParseOptions) withDefaults() ParseOptions {
+	if o.MaxBytes <= 0 {
+		o.MaxBytes = DefaultMaxFeedBytes
+	}
+	if o.MaxItems <= 0 {
+		o.MaxItems = DefaultMaxFeedItems
+	}
+	if o.MaxDepth <= 0 {
+		o.MaxDepth = DefaultMaxFeedDepth
+	}
+	return o
+}
+
+// checkXMLLimits scans the payload's XML tokens before we decode it for real.
+//
+// We enforce the nesting and item limits here, before the rss package builds
+// up its structures. We also reject documents that declare entities. The XML
+// decoder does not expand them, but they have no place in a feed and are the
+// basis of entity expansion attacks.
+func checkXMLLimits(data []byte, opts ParseOptions) error {
+	d := xml.NewDecoder(bytes.NewReader(data))
+	d.CharsetReader = charset.NewReaderLabel
+	d.Strict = false
+
+	depth := 0
+	items := 0
+	for {
+		token, err := d.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			// Leave reporting malformed XML to the real decode.
+			return nil
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			depth++
+			if depth > opts.MaxDepth {
+				return fmt.Errorf("feed nests elements too deeply (limit %d)",
+					opts.MaxDepth)
+			}
+
+			name := strings.ToLower(t.Name.Local)
+			if name == "item" || name == "entry" {
+				items++
+				if items > opts.MaxItems {
+					return fmt.Errorf("feed has too many items (limit %d)",
+						opts.MaxItems)
+				}
+			}
+		case xml.EndElement:
+			depth--
+		case xml.Directive:
+			if bytes.Contains(bytes.ToUpper(t), []byte("ENTITY")) {
+				return fmt.Errorf("feed declares entities")
+			}
+		}
+	}
+}
+
+// parseFeedXML parses a payload in one of the XML formats.
+//
+// We first decode the payload as it asks to be decoded. If that fails, or if
+// the result looks like it would be mojibake, we sniff the encoding (byte order
+// marks, the Content-Type charset, meta tags, then byte heuristics) and try
+// again.
+func parseFeedXML(data []byte, contentType string) (*Feed, error) {
+	declared := declaredEncoding(data)
+
+	rssFeed, err := rss.ParseFeedXML(data)
+	if err == nil && !encodingLooksWrong(data, declared) {
+		return newFeed(rssFeed, declared), nil
+	}
+
+	enc, name, _ := charset.DetermineEncoding(data, contentType)
+
+	// If the payload is valid UTF-8 then trust that over the sniffed default.
+	// DetermineEncoding only looks at the first 1024 bytes.
+	if declared != "utf-8" && utf8.Valid(data) && hasHighBit(data) {
+		enc, name = charset.Lookup("utf-8")
+	}
+
+	// If the payload is plain ASCII then its encoding is not why it failed to
+	// parse, and neither is it if we'd decode it the same way again.
+	if err != nil && (!hasHighBit(data) || name == declared) {
+		return nil, err
+	}
+
+	decoded, decodeErr := enc.NewDecoder().Bytes(data)
+	if decodeErr != nil {
+		if err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("unable to decode feed as %s: %s", name, decodeErr)
+	}
+
+	rssFeed, sniffErr := rss.ParseFeedXML(stripEncodingDeclaration(decoded))
+	if sniffErr != nil {
+		if err != nil {
+			return nil, fmt.Errorf("%s (retried as %s: %s)", err, name, sniffErr)
+		}
+		return nil, fmt.Errorf("unable to parse feed as %s: %s", name, sniffErr)
+	}
+
+	feed := newFeed(rssFeed, name)
+	if declared == "" {
+		feed.Warnings = append(feed.Warnings, fmt.Sprintf(
+			"feed declares no encoding and is not UTF-8, decoded it as %s", name))
+	} else {
+		feed.Warnings = append(feed.Warnings, fmt.Sprintf(
+			"feed declares encoding %s, decoded it as %s", declared, name))
+	}
+
+	return feed, nil
+}
+
+// setRawItems sets each item's Raw field to its element in the payload.
+//
+// The rss package decodes items in document order, so we match the outermost
+// item/entry elements to the feed's items in order.
+func setRawItems(feed *Feed, data []byte) error {
+	data, err := payloadUTF8(feed, data)
+	if err != nil {
+		return err
+	}
+
+	d := xml.NewDecoder(bytes.NewReader(data))
+	d.Strict = false
+
+	var raws []string
+	depth := 0
+	itemDepth := -1
+	var start int64
+	for {
+		offset := d.InputOffset()
+		token, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			depth++
+			name := strings.ToLower(t.Name.Local)
+			if itemDepth == -1 && (name == "item" || name == "entry") {
+				itemDepth = depth
+				start = offset
+			}
+		case xml.EndElement:
+			if depth == itemDepth {
+				raws = append(raws, string(data[start:d.InputOffset()]))
+				itemDepth = -1
+			}
+			depth--
+		}
+	}
+
+	if len(raws) != len(feed.Items) {
+		return fmt.Errorf("found %d item elements but parsed %d items", len(raws),
+			len(feed.Items))
+	}
+
+	for i := range feed.Items {
+		feed.Items[i].Raw = raws[i]
+	}
+
+	return nil
+}
+
+// payloadUTF8 converts the payload to UTF-8 from the encoding we parsed the
+// feed as.
+func payloadUTF8(feed *Feed, data []byte) ([]byte, error) {
+	if feed.Encoding != "utf-8" {
+		enc, _ := charset.Lookup(feed.Encoding)
+		if enc == nil {
+			return nil, fmt.Errorf("unknown encoding: %s", feed.Encoding)
+		}
+
+		decoded, err := enc.NewDecoder().Bytes(data)
+		if err != nil {
+			return nil, fmt.Errorf("unable to decode as %s: %s", feed.Encoding,
+				err)
+		}
+		data = stripEncodingDeclaration(decoded)
+	}
+	return bytes.ToValidUTF8(data, []byte("\uFFFD")), nil
+}
+
+// itemElement holds what we decode from an item's element ourselves, as the
+// rss package doesn't.
+type itemElement struct {
+	Enclosures []xmlEnclosure `xml:"enclosure"`
+	Links      []xmlLink      `xml:"link"`
+	Categories []xmlCategory  `xml:"category"`
+
+	// Duration is the iTunes duration element. We don't check its namespace
+	// as feeds often forget to declare it.
+	Duration string `xml:"duration"`
+}
+
+// setItemElements sets what we take from each item's element in the payload
+// ourselves, its enclosures and categories. pageURL is where the payload came
+// from.
+func setItemElements(feed *Feed, data []byte, pageURL string) error {
+	base, err := url.Parse(pageURL)
+	if err != nil {
+		return fmt.Errorf("invalid feed URL: %s: %s", pageURL, err)
+	}
+
+	elements, err := decodeItemElements(feed, data)
+	if err != nil {
+		return err
+	}
+
+	for i, element := range elements {
+		feed.Items[i].Enclosures = element.enclosures(base)
+		feed.Items[i].Categories = element.categories()
+	}
+
+	return nil
+}
+
+// decodeItemElements decodes the feed's outermost item/entry elements, in
+// document order. As with setRawItems, they match the feed's items in order.
+func decodeItemElements(feed *Feed, data []byte) ([]itemElement, error) {
+	data, err := payloadUTF8(feed, data)
+	if err != nil {
+		return nil, err
+	}
+
+	d := xml.NewDecoder(bytes.NewReader(data))
+	d.Strict = false
+
+	var elements []itemElement
+	for {
+		token, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		name := strings.ToLower(start.Name.Local)
+		if name != "item" && name != "entry" {
+			continue
+		}
+
+		var element itemElement
+		if err := d.DecodeElement(&element, &start); err != nil {
+			return nil, err
+		}
+		elements = append(elements, element)
+	}
+
+	if len(elements) != len(feed.Items) {
+		return nil, fmt.Errorf("found %d item elements but parsed %d items",
+			len(elements), len(feed.Items))
+	}
+
+	return elements, nil
+}
+
+// newFeed converts the rss package's representation of a feed to ours.
+func newFeed(rssFeed *rss.Feed, encoding string) *Feed {
+	if encoding == "" {
+		encoding = "utf-8"
+	}
+
+	feed := &Feed{
+		Title:       rssFeed.Title,
+		Link:        rssFeed.Link,
+		Description: rssFeed.Description,
+		PubDate:     rssFeed.PubDate,
+		Type:        rssFeed.Type,
+		Encoding:    encoding,
+	}
+
+	for _, item := range rssFeed.Items {
+		feed.Items = append(feed.Items, Item{Item: item})
+	}
+
+	return feed
+}
+
+var utf8BOM = []byte{0xef, 0xbb, 0xbf}
+
+var encodingDeclRE = regexp.MustCompile(
+	`^(\s*<\?xml[^>]*?)\s+encoding\s*=\s*["']([^"']*)["']`)
+
+// declaredEncoding finds the encoding named in the payload's XML declaration.
+//
+// We return the canonical name of the encoding, or blank if there is no
+// declaration. If there is no declaration then XML says the payload is UTF-8.
+func declaredEncoding(data []byte) string {
+	if len(data) > 1024 {
+		data = data[:1024]
+	}
+	data = bytes.TrimPrefix(data, utf8BOM)
+
+	matches := encodingDeclRE.FindSubmatch(data)
+	if matches == nil {
+		return ""
+	}
+
+	label := string(matches[2])
+	if _, name := charset.Lookup(label); name != "" {
+		return name
+	}
+	return strings.ToLower(label)
+}
+
+// encodingLooksWrong decides whether decoding the payload as its declared
+// encoding probably gave us mojibake even though it parsed.
+//
+// There are two cases we catch:
+//
+// The payload declares UTF-8 (or nothing) but is not valid UTF-8. The rss
+// package replaces the invalid bytes, so parsing succeeds, but we lose text.
+//
+// The payload declares a legacy single byte encoding but is valid UTF-8 with
+// multi-byte characters. This is common with feeds generated from templates
+// that hard code ISO-8859-1.
+func encodingLooksWrong(data []byte, declared string) bool {
+	if declared == "" || declared == "utf-8" {
+		return !utf8.Valid(data)
+	}
+
+	return utf8.Valid(data) && hasHighBit(data)
+}
+
+// hasHighBit checks whether the payload has any non-ASCII bytes.
+func hasHighBit(data []byte) bool {
+	for _, c := range data {
+		if c >= 0x80 {
+			return true
+		}
+	}
+	return false
+}
+
+// stripEncodingDeclaration removes the encoding from the XML declaration.
+//
+// We do this after we convert the payload to UTF-8 ourselves. Otherwise the
+// XML decoder would try to convert it again.
+func stripEncodingDeclaration(data []byte) []byte {
+	data = bytes.TrimPrefix(data, utf8BOM)
+	return encodingDeclRE.ReplaceAll(data, []byte("$1"))
+}
@@ -0,0 +1,312 @@
+package gorse
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestParseFeedEncoding(t *testing.T) {
+	tests := []struct {
+		Name             string
+		Input            []byte
+		ContentType      string
+		WantedTitle      string
+		WantedEncoding   string
+		WantedParseError bool
+	}{
+		{
+			Name: "utf-8, no declaration",
+			Input: []byte(`<rss version="2.0"><channel><title>Test</title>` +
+				`<item><title>caf` + "é" + `</title>` +
+				`<link>https://example.com/1</link></item></channel></rss>`),
+			WantedTitle:    "café",
+			WantedEncoding: "utf-8",
+		},
+		{
+			Name: "utf-8, declared",
+			Input: []byte(`<?xml version="1.0" encoding="UTF-8"?>` +
+				`<rss version="2.0"><channel><title>Test</title>` +
+				`<item><title>caf` + "é" + `</title>` +
+				`<link>https://example.com/1</link></item></channel></rss>`),
+			WantedTitle:    "café",
+			WantedEncoding: "utf-8",
+		},
+		{
+			Name: "latin-1, no declaration",
+			Input: []byte(`<rss version="2.0"><channel><title>Test</title>` +
+				`<item><title>caf` + "\xe9" + `</title>` +
+				`<link>https://example.com/1</link></item></channel></rss>`),
+			WantedTitle:    "café",
+			WantedEncoding: "windows-1252",
+		},
+		{
+			Name: "latin-1, declared as utf-8",
+			Input: []byte(`<?xml version="1.0" encoding="utf-8"?>` +
+				`<rss version="2.0"><channel><title>Test</title>` +
+				`<item><title>caf` + "\xe9" + `</title>` +
+				`<link>https://example.com/1</link></item></channel></rss>`),
+			WantedTitle:    "café",
+			WantedEncoding: "windows-1252",
+		},
+		{
+			Name: "utf-8, declared as latin-1",
+			Input: []byte(`<?xml version="1.0" encoding="ISO-8859-1"?>` +
+				`<rss version="2.0"><channel><title>Test</title>` +
+				`<item><title>caf` + "é" + `</title>` +
+				`<link>https://example.com/1</link></item></channel></rss>`),
+			WantedTitle:    "café",
+			WantedEncoding: "utf-8",
+		},
+		{
+			Name: "koi8-r, no declaration, charset in header",
+			Input: []byte(`<rss version="2.0"><channel><title>Test</title>` +
+				`<item><title>` + "\xf0\xd2\xc9\xd7\xc5\xd4" + `</title>` +
+				`<link>https://example.com/1</link></item></channel></rss>`),
+			ContentType:    "application/rss+xml; charset=koi8-r",
+			WantedTitle:    "Привет",
+			WantedEncoding: "koi8-r",
+		},
+		{
+			Name:             "not a feed",
+			Input:            []byte(`<html><body>hi</body></html>`),
+			WantedParseError: true,
+		},
+	}
+
+	for _, test := range tests {
+		feed, err := ParseFeed(test.Input,
+			ParseOptions{ContentType: test.ContentType})
+		if err != nil {
+			if !test.WantedParseError {
+				t.Errorf("%s: ParseFeed() = error %s", test.Name, err)
+			}
+			continue
+		}
+
+		if test.WantedParseError {
+			t.Errorf("%s: ParseFeed() succeeded, wanted error", test.Name)
+			continue
+		}
+
+		if feed.Encoding != test.WantedEncoding {
+			t.Errorf("%s: encoding = %s, wanted %s", test.Name, feed.Encoding,
+				test.WantedEncoding)
+		}
+
+		if len(feed.Items) != 1 {
+			t.Errorf("%s: got %d items, wanted 1", test.Name, len(feed.Items))
+			continue
+		}
+
+		if feed.Items[0].Title != test.WantedTitle {
+			t.Errorf("%s: title = %q, wanted %q", test.Name, feed.Items[0].Title,
+				test.WantedTitle)
+		}
+	}
+}
+
+func TestParseFeedLimits(t *testing.T) {
+	manyItems := `<rss version="2.0"><channel><title>Test</title>`
+	for i := 0; i < 5; i++ {
+		manyItems += fmt.Sprintf(`<item><link>https://example.com/%d</link></item>`,
+			i)
+	}
+	manyItems += `</channel></rss>`
+
+	deep := `<rss version="2.0"><channel><title>Test</title><item>` +
+		strings.Repeat("<a>", 100) + strings.Repeat("</a>", 100) +
+		`<link>https://example.com/1</link></item></channel></rss>`
+
+	entities := `<?xml version="1.0"?>
+<!DOCTYPE rss [
+	<!ENTITY a "aaaaaaaaaa">
+	<!ENTITY b "&a;&a;&a;&a;&a;&a;&a;&a;&a;&a;">
+]>
+<rss version="2.0"><channel><title>&b;</title>
+<item><link>https://example.com/1</link></item></channel></rss>`
+
+	tests := []struct {
+		Name        string
+		Input       string
+		Options     ParseOptions
+		WantedError bool
+	}{
+		{"within item limit", manyItems, ParseOptions{MaxItems: 5}, false},
+		{"over item limit", manyItems, ParseOptions{MaxItems: 4}, true},
+		{"within byte limit", manyItems,
+			ParseOptions{MaxBytes: int64(len(manyItems))}, false},
+		{"over byte limit", manyItems,
+			ParseOptions{MaxBytes: int64(len(manyItems) - 1)}, true},
+		{"default depth", deep, ParseOptions{}, true},
+		{"raised depth", deep, ParseOptions{MaxDepth: 200}, false},
+		{"entity declarations", entities, ParseOptions{}, true},
+	}
+
+	for _, test := range tests {
+		_, err := ParseFeed([]byte(test.Input), test.Options)
+		if err != nil && !test.WantedError {
+			t.Errorf("%s: ParseFeed() = error %s", test.Name, err)
+		}
+		if err == nil && test.WantedError {
+			t.Errorf("%s: ParseFeed() succeeded, wanted error", test.Name)
+		}
+	}
+}
+
+func FuzzParseFeed(f *testing.F) {
+	f.Add([]byte(`<rss version="2.0"><channel><title>Test</title>` +
+		`<item><title>Hi</title><link>https://example.com/1</link>` +
+		`<pubDate>Sun, 30 Jun 2013 21:26:26 +0000</pubDate></item>` +
+		`</channel></rss>`))
+	f.Add([]byte(`<?xml version="1.0" encoding="ISO-8859-1"?>` +
+		`<feed xmlns="http://www.w3.org/2005/Atom"><title>Test</title>` +
+		`<entry><id>1</id><link href="https://example.com/1"/></entry></feed>`))
+	f.Add([]byte(`<!DOCTYPE html><html><body><article class="h-entry">` +
+		`<a class="u-url p-name" href="/1">Hi</a></article></body></html>`))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		opts := ParseOptions{
+			URL:      "https://example.com/",
+			MaxBytes: 64 * 1024,
+			MaxItems: 50,
+			MaxDepth: 32,
+		}
+
+		feed, err := ParseFeed(data, opts)
+		if err != nil {
+			return
+		}
+
+		if len(feed.Items) > opts.MaxItems {
+			t.Errorf("got %d items, limit is %d", len(feed.Items), opts.MaxItems)
+		}
+	})
+}
+
+func TestParseFeedKeepRaw(t *testing.T) {
+	tests := []struct {
+		Name       string
+		Input      string
+		WantedRaws []string
+	}{
+		{
+			Name: "rss",
+			Input: `<?xml version="1.0" encoding="ISO-8859-1"?>` +
+				`<rss version="2.0"><channel><title>Test</title>` +
+				`<item><title>caf` + "\xe9" + `</title>` +
+				`<link>https://example.com/1</link></item>` +
+				`<item><link>https://example.com/2</link><x:y xmlns:x="z"/></item>` +
+				`</channel></rss>`,
+			WantedRaws: []string{
+				`<item><title>café</title><link>https://example.com/1</link></item>`,
+				`<item><link>https://example.com/2</link><x:y xmlns:x="z"/></item>`,
+			},
+		},
+		{
+			Name: "atom",
+			Input: `<feed xmlns="http://www.w3.org/2005/Atom"><title>Test</title>` +
+				`<entry><id>1</id><link href="https://example.com/1"/></entry>` +
+				`</feed>`,
+			WantedRaws: []string{
+				`<entry><id>1</id><link href="https://example.com/1"/></entry>`,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		feed, err := ParseFeed([]byte(test.Input), ParseOptions{KeepRaw: true})
+		if err != nil {
+			t.Errorf("%s: ParseFeed() = error %s", test.Name, err)
+			continue
+		}
+
+		if len(feed.Items) != len(test.WantedRaws) {
+			t.Errorf("%s: got %d items, wanted %d", test.Name, len(feed.Items),
+				len(test.WantedRaws))
+			continue
+		}
+
+		for i, item := range feed.Items {
+			if item.Raw != test.WantedRaws[i] {
+				t.Errorf("%s: item %d raw = %q, wanted %q", test.Name, i, item.Raw,
+					test.WantedRaws[i])
+			}
+		}
+	}
+}
+
+func TestParseFeedStrictness(t *testing.T) {
+	tests := []struct {
+		Name              string
+		Input             string
+		WantedTitle       string
+		WantedWarnings    int
+		WantedStrictError bool
+	}{
+		{
+			Name: "valid",
+			Input: `<rss version="2.0"><channel><title>Test</title>` +
+				`<item><title>A &amp; B</title><link>https://example.com/1</link>` +
+				`<pubDate>Sun, 30 Jun 2013 21:26:26 +0000</pubDate></item>` +
+				`</channel></rss>`,
+			WantedTitle: "A & B",
+		},
+		{
+			Name: "bare ampersand and html entity",
+			Input: `<rss version="2.0"><channel><title>Test</title>` +
+				`<item><title>A & B&nbsp;C</title>` +
+				`<description><![CDATA[x &amp; y]]></description>` +
+				`<link>https://example.com/1</link>` +
+				`<pubDate>Sun, 30 Jun 2013 21:26:26 +0000</pubDate></item>` +
+				`</channel></rss>`,
+			WantedTitle:       "A & B\u00a0C",
+			WantedWarnings:    1,
+			WantedStrictError: true,
+		},
+		{
+			// RSS 2.0 doesn't require these.
+			Name: "missing link and date",
+			Input: `<rss version="2.0"><channel><title>Test</title>` +
+				`<item><title>Hi</title></item>` +
+				`</channel></rss>`,
+			WantedTitle:    "Hi",
+			WantedWarnings: 2,
+		},
+		{
+			Name: "missing title and description",
+			Input: `<rss version="2.0"><channel><title>Test</title>` +
+				`<item><link>https://example.com/1</link>` +
+				`<pubDate>Sun, 30 Jun 2013 21:26:26 +0000</pubDate></item>` +
+				`</channel></rss>`,
+			WantedWarnings:    1,
+			WantedStrictError: true,
+		},
+	}
+
+	for _, test := range tests {
+		feed, err := ParseFeed([]byte(test.Input), ParseOptions{})
+		if err != nil {
+			t.Errorf("%s: ParseFeed() = error %s", test.Name, err)
+			continue
+		}
+
+		if len(feed.Warnings) != test.WantedWarnings {
+			t.Errorf("%s: got warnings %q, wanted %d", test.Name, feed.Warnings,
+				test.WantedWarnings)
+		}
+
+		if len(feed.Items) != 1 || feed.Items[0].Title != test.WantedTitle {
+			t.Errorf("%s: items = %+v, wanted one titled %q", test.Name, feed.Items,
+				test.WantedTitle)
+		}
+
+		_, err = ParseFeed([]byte(test.Input), ParseOptions{Strict: true})
+		if err != nil && !test.WantedStrictError {
+			t.Errorf("%s: strict ParseFeed() = error %s", test.Name, err)
+		}
+		if err == nil && test.WantedStrictError {
+			t.Errorf("%s: strict ParseFeed() succeeded, wanted error", test.Name)
+		}
+	}
+}
@@ -0,0 +1,408 @@
+package gorse
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// MinUpdateFrequencySeconds is the most often we poll a feed.
+const MinUpdateFrequencySeconds = 60
+
+// ErrNotFound means what we looked up does not exist.
+var ErrNotFound = errors.New("not found")
+
+// ItemRetention is what to do with a feed's items when deleting it.
+type ItemRetention int
+
+const (
+	// KeepItems leaves the items as they are. They come back if the feed is
+	// restored.
+	KeepItems ItemRetention = iota
+
+	// ArchiveItems marks the items read for every user who hasn't read them.
+	// We keep them, but they don't come back as unread if the feed is restored.
+	ArchiveItems
+
+	// PurgeItems deletes the items along with their read states. We keep items
+	// anyone starred.
+	PurgeItems
+)
+
+// String gives the name ParseItemRetention takes.
+func (r ItemRetention) String() string {
+	switch r {
+	case KeepItems:
+		return "keep"
+	case ArchiveItems:
+		return "archive"
+	case PurgeItems:
+		return "purge"
+	default:
+		return "unknown"
+	}
+}
+
+// ParseItemRetention turns keep, archive, or purge into an ItemRetention.
+func ParseItemRetention(s string) (ItemRetention, error) {
+	switch s {
+	case "keep":
+		return KeepItems, nil
+	case "archive":
+		return ArchiveItems, nil
+	case "purge":
+		return PurgeItems, nil
+	default:
+		return -1, fmt.Errorf("unknown item retention: %s", s)
+	}
+}
+
+// CreateFeed adds a feed. It returns the feed's ID.
+//
+// The feed's ID and last update time are ignored.
+func CreateFeed(ctx context.Context, db Querier, feed DBFeed) (int64, error) {
+	if err := normalizeFeed(&feed); err != nil {
+		return -1, err
+	}
+
+	query := `
+INSERT INTO rss_feed
+(name, uri, update_frequency_seconds, archive, active)
+VALUES ($1, $2, $3, $4, $5)
+RETURNING id
+`
+
+	var id int64
+	if err := db.QueryRowContext(ctx, query, feed.Name, feed.URI,
+		feed.UpdateFrequencySeconds, feed.Archive, feed.Active).Scan(
+		&id); err != nil {
+		return -1, fmt.Errorf("unable to add feed: %s: %s", feed.Name, err)
+	}
+
+	return id, nil
+}
+
+// UpdateFeed changes the feed with the feed's ID to match it.
+//
+// The last update time is ignored.
+func UpdateFeed(ctx context.Context, db Querier, feed DBFeed) error {
+	if err := normalizeFeed(&feed); err != nil {
+		return err
+	}
+
+	// A new URI is a different feed as far as caching goes, so we forget its
+	// ETag and Last-Modified.
+	query := `
+UPDATE rss_feed SET
+name = $1, uri = $2, update_frequency_seconds = $3, archive = $4, active = $5,
+etag = CASE WHEN uri = $2 THEN etag ELSE '' END,
+last_modified = CASE WHEN uri = $2 THEN last_modified ELSE '' END
+WHERE id = $6
+`
+
+	result, err := db.ExecContext(ctx, query, feed.Name, feed.URI,
+		feed.UpdateFrequencySeconds, feed.Archive, feed.Active, feed.ID)
+	if err != nil {
+		return fmt.Errorf("unable to update feed ID [%d]: %s", feed.ID, err)
+	}
+
+	return requireOneRow(result)
+}
+
+// DeactivateFeed stops the feed being polled. We keep its items.
+func DeactivateFeed(ctx context.Context, db Querier, feedID int64) error {
+	query := `UPDATE rss_feed SET active = false WHERE id = $1`
+
+	result, err := db.ExecContext(ctx, query, feedID)
+	if err != nil {
+		return fmt.Errorf("unable to deactivate feed ID [%d]: %s", feedID, err)
+	}
+
+	return requireOneRow(result)
+}
+
+// DeleteFeed deletes the feed. We stop polling it and its items no longer
+// show. What happens to the items depends on retention.
+//
+// The feed itself stays so that it can be restored. Run this in a transaction
+// so that we don't delete it partway.
+func DeleteFeed(ctx context.Context, db Querier, feedID int64,
+	retention ItemRetention) error {
+	query := `UPDATE rss_feed SET deleted = true WHERE id = $1`
+
+	result, err := db.ExecContext(ctx, query, feedID)
+	if err != nil {
+		return fmt.Errorf("unable to delete feed ID [%d]: %s", feedID, err)
+	}
+	if err := requireOneRow(result); err != nil {
+		return err
+	}
+
+	switch retention {
+	case KeepItems:
+		return nil
+	case ArchiveItems:
+		return archiveFeedItems(ctx, db, feedID)
+	case PurgeItems:
+		// We keep items anyone starred.
+		if _, err := db.ExecContext(ctx, `
+DELETE FROM rss_item WHERE rss_feed_id = $1 AND
+  NOT EXISTS (SELECT 1 FROM rss_item_star WHERE item_id = rss_item.id)`,
+			feedID); err != nil {
+			return fmt.Errorf("unable to delete items of feed ID [%d]: %s", feedID,
+				err)
+		}
+		if _, err := db.ExecContext(ctx,
+			`DELETE FROM rss_unread_count WHERE feed_id = $1`, feedID); err != nil {
+			return fmt.Errorf("unable to delete unread counts of feed ID [%d]: %s",
+				feedID, err)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown item retention: %d", retention)
+	}
+}
+
+// archiveFeedItems marks the feed's items read for each user who hasn't read
+// them. We leave those they saved to read later.
+func archiveFeedItems(ctx context.Context, db Querier, feedID int64) error {
+	users, err := ListUsers(ctx, db)
+	if err != nil {
+		return err
+	}
+
+	query := `
+SELECT ri.id
+FROM rss_item ri
+LEFT JOIN rss_item_state ris ON ris.item_id = ri.id AND ris.user_id = $1
+WHERE ri.rss_feed_id = $2 AND COALESCE(ris.state, 'unread') = 'unread'
+`
+
+	for _, user := range users {
+		rows, err := db.QueryContext(ctx, query, user.ID, feedID)
+		if err != nil {
+			return fmt.Errorf("unable to query unread items: %s", err)
+		}
+
+		var ids []int64
+		for rows.Next() {
+			var id int64
+			if err := rows.Scan(&id); err != nil {
+				_ = rows.Close()
+				return fmt.Errorf("failed to scan row: %s", err)
+			}
+			ids = append(ids, id)
+		}
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("failure fetching rows: %s", err)
+		}
+
+		if err := DBSetItemsReadState(ctx, db, ids, user.ID, Read); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// RestoreFeed undoes deleting the feed. Items we kept show again. It doesn't
+// make the feed active if it isn't.
+func RestoreFeed(ctx context.Context, db Querier, feedID int64) error {
+	query := `UPDATE rss_feed SET deleted = false WHERE id = $1`
+
+	result, err := db.ExecContext(ctx, query, feedID)
+	if err != nil {
+		return fmt.Errorf("unable to restore feed ID [%d]: %s", feedID, err)
+	}
+
+	return requireOneRow(result)
+}
+
+// GetFeedByURI retrieves the feed with the URI. It returns ErrNotFound if
+// there isn't one.
+//
+// This finds deleted feeds too. URIs are unique, so we must restore a deleted
+// feed rather than add it again.
+func GetFeedByURI(ctx context.Context, db Querier, uri string) (*DBFeed,
+	error) {
+	query := `
+SELECT
+id, name, uri, update_frequency_seconds, last_update_time, archive, active,
+deleted, etag, last_modified, full_text
+FROM rss_feed
+WHERE uri = $1
+`
+
+	feed, err := scanFeed(db.QueryRowContext(ctx, query,
+		strings.TrimSpace(uri)))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to look up feed: %s: %s", uri, err)
+	}
+
+	return feed, nil
+}
+
+// scanFeed scans a row holding the columns GetFeedByURI selects.
+func scanFeed(row interface{ Scan(...interface{}) error }) (*DBFeed, error) {
+	feed := &DBFeed{}
+	var nt sql.NullTime
+
+	if err := row.Scan(&feed.ID, &feed.Name, &feed.URI,
+		&feed.UpdateFrequencySeconds, &nt, &feed.Archive, &feed.Active,
+		&feed.Deleted, &feed.ETag, &feed.LastModified,
+		&feed.FullText); err != nil {
+		return nil, err
+	}
+
+	if nt.Valid {
+		feed.LastUpdateTime = &nt.Time
+	}
+
+	return feed, nil
+}
+
+// normalizeFeed checks the feed is one we can poll and tidies it up.
+func normalizeFeed(feed *DBFeed) error {
+	feed.Name = strings.TrimSpace(feed.Name)
+	if feed.Name == "" {
+		return fmt.Errorf("feed name is blank")
+	}
+
+	feed.URI = strings.TrimSpace(feed.URI)
+	u, err := url.Parse(feed.URI)
+	if err != nil {
+		return fmt.Errorf("invalid feed URI: %s: %s", feed.URI, err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("feed URI must be an http or https URL: %s", feed.URI)
+	}
+
+	if feed.UpdateFrequencySeconds < MinUpdateFrequencySeconds {
+		return fmt.Errorf("update frequency must be at least %d seconds",
+			MinUpdateFrequencySeconds)
+	}
+
+	return nil
+}
+
+// requireOneRow checks that the statement changed a row. It returns
+// ErrNotFound if not.
+func requireOneRow(result sql.Result) error {
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("unable to check rows affected: %s", err)
+	}
+	if rows == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// RetentionPolicy is how long we keep a feed's items before pruning them.
+//
+// We keep items published in the last Days days as well as the newest Items
+// items. 0 turns that rule off. With both off, we keep items forever. Whatever
+// the policy, we keep items anyone starred.
+type RetentionPolicy struct {
+	Days  int
+	Items int
+}
+
+// Forever says whether we keep items forever.
+func (p RetentionPolicy) Forever() bool {
+	return p.Days == 0 && p.Items == 0
+}
+
+// String describes the policy.
+func (p RetentionPolicy) String() string {
+	switch {
+	case p.Forever():
+		return "keep forever"
+	case p.Items == 0:
+		return fmt.Sprintf("keep %d days", p.Days)
+	case p.Days == 0:
+		return fmt.Sprintf("keep %d items", p.Items)
+	default:
+		return fmt.Sprintf("keep %d days and %d items", p.Days, p.Items)
+	}
+}
+
+// FeedRetention retrieves the feed's retention policy. It returns ErrNotFound
+// if there is no such feed.
+func FeedRetention(ctx context.Context, db Querier,
+	feedID int64) (RetentionPolicy, error) {
+	query := `SELECT retention_days, retention_items FROM rss_feed WHERE id = $1`
+
+	var policy RetentionPolicy
+	err := db.QueryRowContext(ctx, query, feedID).Scan(&policy.Days,
+		&policy.Items)
+	if err == sql.ErrNoRows {
+		return policy, ErrNotFound
+	}
+	if err != nil {
+		return policy, fmt.Errorf("unable to look up retention of feed ID [%d]: %s",
+			feedID, err)
+	}
+
+	return policy, nil
+}
+
+// FeedRetentions retrieves the retention policies of the feeds that don't keep
+// their items forever, by feed ID.
+func FeedRetentions(ctx context.Context,
+	db Querier) (map[int64]RetentionPolicy, error) {
+	query := `
+SELECT id, retention_days, retention_items FROM rss_feed
+WHERE retention_days > 0 OR retention_items > 0
+`
+
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("unable to query retention policies: %s", err)
+	}
+
+	policies := map[int64]RetentionPolicy{}
+	for rows.Next() {
+		var id int64
+		var policy RetentionPolicy
+		if err := rows.Scan(&id, &policy.Days, &policy.Items); err != nil {
+			_ = rows.Close()
+			return nil, fmt.Errorf("failed to scan row: %s", err)
+		}
+		policies[id] = policy
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failure fetching rows: %s", err)
+	}
+
+	return policies, nil
+}
+
+// SetFeedRetention sets the feed's retention policy. It returns ErrNotFound if
+// there is no such feed.
+func SetFeedRetention(ctx context.Context, db Querier, feedID int64,
+	policy RetentionPolicy) error {
+	if policy.Days < 0 || policy.Items < 0 {
+		return fmt.Errorf("retention must not be negative")
+	}
+
+	query := `
+UPDATE rss_feed SET retention_days = $1, retention_items = $2
+WHERE id = $3
+`
+
+	result, err := db.ExecContext(ctx, query, policy.Days, policy.Items, feedID)
+	if err != nil {
+		return fmt.Errorf("unable to set retention of feed ID [%d]: %s", feedID,
+			err)
+	}
+
+	return requireOneRow(result)
+}
@@ -0,0 +1,64 @@
+package gorse
+
+import "testing"
+
+func TestNormalizeFeed(t *testing.T) {
+	tests := []struct {
+		name    string
+		feed    DBFeed
+		want    DBFeed
+		wantErr bool
+	}{
+		{
+			name: "valid",
+			feed: DBFeed{Name: " Example ", URI: " https://example.com/feed ",
+				UpdateFrequencySeconds: 3600},
+			want: DBFeed{Name: "Example", URI: "https://example.com/feed",
+				UpdateFrequencySeconds: 3600},
+		},
+		{
+			name: "blank name",
+			feed: DBFeed{Name: " ", URI: "https://example.com/feed",
+				UpdateFrequencySeconds: 3600},
+			wantErr: true,
+		},
+		{
+			name: "not http",
+			feed: DBFeed{Name: "Example", URI: "file:///etc/passwd",
+				UpdateFrequencySeconds: 3600},
+			wantErr: true,
+		},
+		{
+			name: "no host",
+			feed: DBFeed{Name: "Example", URI: "https:///feed",
+				UpdateFrequencySeconds: 3600},
+			wantErr: true,
+		},
+		{
+			name: "too frequent",
+			feed: DBFeed{Name: "Example", URI: "https://example.com/feed",
+				UpdateFrequencySeconds: 1},
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			feed := test.feed
+			err := normalizeFeed(&feed)
+			if test.wantErr {
+				if err == nil {
+					t.Errorf("normalizeFeed(%+v) succeeded", test.feed)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("normalizeFeed(%+v) = error %s", test.feed, err)
+			}
+			if feed != test.want {
+				t.Errorf("normalizeFeed(%+v) = %+v, wanted %+v", test.feed, feed,
+					test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,453 @@
+package gorse
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// RateWindow is how far back we look to find how often a feed publishes.
+const RateWindow = 30 * 24 * time.Hour
+
+// FeedStats describes the items we have from a feed.
+type FeedStats struct {
+	// Items is how many items we have from the feed.
+	Items int
+
+	// Archived is how many of them we marked read when we recorded them
+	// because the feed was in archive mode.
+	Archived int
+
+	// RecentItems is how many of them the feed published in the RateWindow
+	// before we looked.
+	RecentItems int
+
+	// Oldest is the publication date of the oldest of them. It is zero if there
+	// are none.
+	Oldest time.Time
+}
+
+// ItemsPerDay estimates how many items a day the feed publishes from those it
+// published recently. If we have items going back less than the RateWindow,
+// such as for a feed we just added, we count from the oldest.
+func (s FeedStats) ItemsPerDay() float64 {
+	if s.RecentItems == 0 {
+		return 0
+	}
+
+	window := RateWindow
+	if age := time.Since(s.Oldest); age < window {
+		window = age
+	}
+
+	days := window.Hours() / 24
+	if days < 1 {
+		days = 1
+	}
+	return float64(s.RecentItems) / days
+}
+
+// suggestedFrequencies are the update frequencies we suggest, in seconds,
+// from most to least often.
+var suggestedFrequencies = []int64{
+	15 * 60,
+	30 * 60,
+	60 * 60,
+	2 * 60 * 60,
+	3 * 60 * 60,
+	6 * 60 * 60,
+	12 * 60 * 60,
+	24 * 60 * 60,
+}
+
+// SuggestUpdateFrequency suggests how often in seconds to poll a feed that
+// publishes the number of items a day. We poll about as often as it publishes
+// so that we show its items soon after they appear, but no more often than
+// every 15 minutes, and at least daily.
+func SuggestUpdateFrequency(itemsPerDay float64) int64 {
+	if itemsPerDay <= 0 {
+		return suggestedFrequencies[len(suggestedFrequencies)-1]
+	}
+
+	interval := int64(24 * 60 * 60 / itemsPerDay)
+	suggested := suggestedFrequencies[0]
+	for _, f := range suggestedFrequencies {
+		if f <= interval {
+			suggested = f
+		}
+	}
+	return suggested
+}
+
+// SetFeedUpdateFrequency sets how often in seconds we poll the feed. It
+// returns ErrNotFound if there is no such feed.
+func SetFeedUpdateFrequency(ctx context.Context, db Querier, feedID int64,
+	seconds int64) error {
+	if seconds < MinUpdateFrequencySeconds {
+		return fmt.Errorf("update frequency must be at least %d seconds",
+			MinUpdateFrequencySeconds)
+	}
+
+	query := `UPDATE rss_feed SET update_frequency_seconds = $1 WHERE id = $2`
+
+	result, err := db.ExecContext(ctx, query, seconds, feedID)
+	if err != nil {
+		return fmt.Errorf("unable to set update frequency of feed ID [%d]: %s",
+			feedID, err)
+	}
+
+	return requireOneRow(result)
+}
+
+// SetFeedArchive sets whether the feed is in archive mode. It returns
+// ErrNotFound if there is no such feed.
+func SetFeedArchive(ctx context.Context, db Querier, feedID int64,
+	archive bool) error {
+	query := `UPDATE rss_feed SET archive = $1 WHERE id = $2`
+
+	result, err := db.ExecContext(ctx, query, archive, feedID)
+	if err != nil {
+		return fmt.Errorf("unable to set archive mode of feed ID [%d]: %s",
+			feedID, err)
+	}
+
+	return requireOneRow(result)
+}
+
+// SetFeedFullText sets whether we fetch the articles of the feed's new items.
+// It returns ErrNotFound if there is no such feed.
+func SetFeedFullText(ctx context.Context, db Querier, feedID int64,
+	fullText bool) error {
+	query := `UPDATE rss_feed SET full_text = $1 WHERE id = $2`
+
+	result, err := db.ExecContext(ctx, query, fullText, feedID)
+	if err != nil {
+		return fmt.Errorf("unable to set full text mode of feed ID [%d]: %s",
+			feedID, err)
+	}
+
+	return requireOneRow(result)
+}
+
+// SetItemsArchived records that we marked the items read when we recorded
+// them because their feed was in archive mode.
+//
+// Like DBSetItemsReadState, we update at most maxReadStateBatch items per
+// statement.
+func SetItemsArchived(ctx context.Context, db Querier, ids []int64) error {
+	for len(ids) > 0 {
+		batch := ids
+		if len(batch) > maxReadStateBatch {
+			batch = batch[:maxReadStateBatch]
+		}
+		ids = ids[len(batch):]
+
+		placeholders := make([]string, len(batch))
+		params := make([]interface{}, len(batch))
+		for i, id := range batch {
+			placeholders[i] = fmt.Sprintf("$%d", i+1)
+			params[i] = id
+		}
+
+		query := `
+UPDATE rss_item SET archived = true
+WHERE id IN (` + strings.Join(placeholders, ", ") + `)
+`
+
+		if _, err := db.ExecContext(ctx, query, params...); err != nil {
+			return fmt.Errorf("unable to set %d items archived: %s", len(batch),
+				err)
+		}
+	}
+
+	return nil
+}
+
+// SubscriptionStats describes the items of each feed the user subscribes to,
+// by feed ID.
+func SubscriptionStats(ctx context.Context, db Querier,
+	userID int) (map[int64]FeedStats, error) {
+	query := `
+SELECT rfs.feed_id, COUNT(ri.id),
+COALESCE(SUM(CASE WHEN ri.archived THEN 1 ELSE 0 END), 0),
+COALESCE(SUM(CASE WHEN ri.publication_date > $1 THEN 1 ELSE 0 END), 0)
+FROM rss_feed_subscription rfs
+LEFT JOIN rss_item ri ON ri.rss_feed_id = rfs.feed_id
+WHERE rfs.user_id = $2
+GROUP BY rfs.feed_id
+`
+
+	rows, err := db.QueryContext(ctx, query, time.Now().Add(-RateWindow),
+		userID)
+	if err != nil {
+		return nil, fmt.Errorf("unable to query feed stats: %s", err)
+	}
+
+	stats := map[int64]FeedStats{}
+	for rows.Next() {
+		var feedID int64
+		var s FeedStats
+		if err := rows.Scan(&feedID, &s.Items, &s.Archived,
+			&s.RecentItems); err != nil {
+			_ = rows.Close()
+			return nil, fmt.Errorf("failed to scan row: %s", err)
+		}
+		stats[feedID] = s
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failure fetching rows: %s", err)
+	}
+
+	// Not MIN() as SQLite then gives us a string rather than a time.
+	query = `
+SELECT rss_feed_id, publication_date
+FROM (
+  SELECT ri.rss_feed_id, ri.publication_date,
+  ROW_NUMBER() OVER (PARTITION BY ri.rss_feed_id
+    ORDER BY ri.publication_date) AS n
+  FROM rss_item ri
+  JOIN rss_feed_subscription rfs ON rfs.feed_id = ri.rss_feed_id
+  WHERE rfs.user_id = $1
+) oldest
+WHERE n = 1
+`
+
+	rows, err = db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("unable to query oldest items: %s", err)
+	}
+
+	for rows.Next() {
+		var feedID int64
+		var oldest time.Time
+		if err := rows.Scan(&feedID, &oldest); err != nil {
+			_ = rows.Close()
+			return nil, fmt.Errorf("failed to scan row: %s", err)
+		}
+		s := stats[feedID]
+		s.Oldest = oldest
+		stats[feedID] = s
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failure fetching rows: %s", err)
+	}
+
+	return stats, nil
+}
+
+// FeedSummary describes a feed the user subscribes to for an overview of
+// their feeds.
+type FeedSummary struct {
+	DBFeed
+
+	// Unread is how many of the feed's items the user has unread.
+	Unread int
+
+	// ErrorCount is how many times in a row polling the feed failed. It is 0
+	// if the last poll succeeded.
+	ErrorCount int
+
+	// LastError says why polling the feed last failed. It is blank if the last
+	// poll succeeded.
+	LastError string
+}
+
+// FeedSort is how to order an overview of feeds.
+type FeedSort int
+
+const (
+	// FeedSortName orders feeds by name.
+	FeedSortName FeedSort = iota
+
+	// FeedSortUnread orders feeds with the most unread items first.
+	FeedSortUnread
+
+	// FeedSortUpdated orders feeds we polled longest ago first, after those we
+	// never polled. These are the feeds we may be having trouble with.
+	FeedSortUpdated
+
+	// FeedSortErrors orders feeds failing the most times in a row first.
+	FeedSortErrors
+)
+
+// String gives the name ParseFeedSort takes.
+func (s FeedSort) String() string {
+	switch s {
+	case FeedSortName:
+		return "name"
+	case FeedSortUnread:
+		return "unread"
+	case FeedSortUpdated:
+		return "updated"
+	case FeedSortErrors:
+		return "errors"
+	default:
+		return "unknown"
+	}
+}
+
+// ParseFeedSort turns name, unread, updated, or errors into a FeedSort.
+func ParseFeedSort(s string) (FeedSort, error) {
+	switch s {
+	case "name":
+		return FeedSortName, nil
+	case "unread":
+		return FeedSortUnread, nil
+	case "updated":
+		return FeedSortUpdated, nil
+	case "errors":
+		return FeedSortErrors, nil
+	default:
+		return -1, fmt.Errorf("unknown feed sort: %s", s)
+	}
+}
+
+// feedSortOrders are the ORDER BY clauses of each FeedSort. Each ends with
+// the name and ID so the order is the same every time, letting us page
+// through feeds.
+var feedSortOrders = map[FeedSort]string{
+	FeedSortName:   `rf.name, rf.id`,
+	FeedSortUnread: `unread DESC, rf.name, rf.id`,
+	// NULLs come first in SQLite and last in Postgres, so we order them
+	// ourselves.
+	FeedSortUpdated: `rf.last_update_time IS NOT NULL, rf.last_update_time, ` +
+		`rf.name, rf.id`,
+	FeedSortErrors: `rf.error_count DESC, rf.name, rf.id`,
+}
+
+// FeedOverview retrieves summaries of the feeds the user subscribes to in the
+// order. Limit is the most to retrieve, and offset skips that many first.
+// Deleted feeds aren't included.
+//
+// We count unread items using the unread counts, so this is the count of all
+// of them however old.
+func FeedOverview(ctx context.Context, db Querier, userID int, sort FeedSort,
+	limit, offset int) ([]FeedSummary, error) {
+	order, ok := feedSortOrders[sort]
+	if !ok {
+		return nil, fmt.Errorf("unknown feed sort: %d", sort)
+	}
+
+	query := `
+SELECT
+rf.id, rf.name, rf.uri, rf.update_frequency_seconds, rf.last_update_time,
+rf.archive, rf.active, rf.deleted, COALESCE(uc.unread, 0) AS unread,
+rf.error_count, rf.last_error, rf.full_text
+FROM rss_feed rf
+JOIN rss_feed_subscription rfs ON rfs.feed_id = rf.id
+LEFT JOIN (
+  SELECT feed_id, SUM(unread_count) AS unread
+  FROM rss_unread_count
+  WHERE user_id = $1
+  GROUP BY feed_id
+) uc ON uc.feed_id = rf.id
+WHERE rfs.user_id = $1 AND rf.deleted = false
+ORDER BY ` + order + `
+LIMIT $2 OFFSET $3
+`
+
+	rows, err := db.QueryContext(ctx, query, userID, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("unable to query feed overview: %s", err)
+	}
+
+	var summaries []FeedSummary
+	for rows.Next() {
+		var s FeedSummary
+		var nt sql.NullTime
+		if err := rows.Scan(&s.ID, &s.Name, &s.URI, &s.UpdateFrequencySeconds,
+			&nt, &s.Archive, &s.Active, &s.Deleted, &s.Unread, &s.ErrorCount,
+			&s.LastError, &s.FullText); err != nil {
+			_ = rows.Close()
+			return nil, fmt.Errorf("failed to scan row: %s", err)
+		}
+		if nt.Valid {
+			s.LastUpdateTime = &nt.Time
+		}
+		summaries = append(summaries, s)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failure fetching rows: %s", err)
+	}
+
+	return summaries, nil
+}
+
+// CountSubscriptions counts the feeds the user subscribes to. Deleted feeds
+// aren't included.
+func CountSubscriptions(ctx context.Context, db Querier, userID int) (int,
+	error) {
+	query := `
+SELECT COUNT(*)
+FROM rss_feed rf
+JOIN rss_feed_subscription rfs ON rfs.feed_id = rf.id
+WHERE rfs.user_id = $1 AND rf.deleted = false
+`
+
+	var count int
+	if err := db.QueryRowContext(ctx, query, userID).Scan(&count); err != nil {
+		return -1, fmt.Errorf("unable to count subscriptions: %s", err)
+	}
+
+	return count, nil
+}
+
+// CountFailingFeeds counts the feeds the user subscribes to that polling
+// failed for at least minErrors times in a row. Deleted feeds and those we
+// don't poll aren't included.
+func CountFailingFeeds(ctx context.Context, db Querier, userID,
+	minErrors int) (int, error) {
+	query := `
+SELECT COUNT(*)
+FROM rss_feed rf
+JOIN rss_feed_subscription rfs ON rfs.feed_id = rf.id
+WHERE rfs.user_id = $1 AND rf.deleted = false AND rf.active = true AND
+rf.error_count >= $2
+`
+
+	var count int
+	if err := db.QueryRowContext(ctx, query, userID,
+		minErrors).Scan(&count); err != nil {
+		return -1, fmt.Errorf("unable to count failing feeds: %s", err)
+	}
+
+	return count, nil
+}
+
+// SetFeedError records that polling the feed failed and why. It returns
+// ErrNotFound if there is no such feed.
+func SetFeedError(ctx context.Context, db Querier, feedID int64,
+	message string) error {
+	query := `
+UPDATE rss_feed SET error_count = error_count + 1, last_error = $1
+WHERE id = $2
+`
+
+	result, err := db.ExecContext(ctx, query, message, feedID)
+	if err != nil {
+		return fmt.Errorf("unable to record error of feed ID [%d]: %s", feedID,
+			err)
+	}
+
+	return requireOneRow(result)
+}
+
+// SetFeedValidators records the ETag and Last-Modified headers the feed was
+// served with. It returns ErrNotFound if there is no such feed.
+func SetFeedValidators(ctx context.Context, db Querier, feedID int64, etag,
+	lastModified string) error {
+	query := `UPDATE rss_feed SET etag = $1, last_modified = $2 WHERE id = $3`
+
+	result, err := db.ExecContext(ctx, query, etag, lastModified, feedID)
+	if err != nil {
+		return fmt.Errorf("unable to record validators of feed ID [%d]: %s",
+			feedID, err)
+	}
+
+	return requireOneRow(result)
+}
@@ -0,0 +1,63 @@
+package gorse
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFeedStatsItemsPerDay(t *testing.T) {
+	tests := []struct {
+		Name   string
+		Stats  FeedStats
+		Wanted float64
+	}{
+		{"no items", FeedStats{}, 0},
+		{
+			"older than the window",
+			FeedStats{RecentItems: 60, Oldest: time.Now().Add(-365 * 24 *
+				time.Hour)},
+			2,
+		},
+		{
+			"newer than the window",
+			FeedStats{RecentItems: 10, Oldest: time.Now().Add(-5 * 24 *
+				time.Hour)},
+			2,
+		},
+		{
+			"less than a day",
+			FeedStats{RecentItems: 3, Oldest: time.Now().Add(-time.Hour)},
+			3,
+		},
+	}
+
+	for _, test := range tests {
+		got := test.Stats.ItemsPerDay()
+		if got < test.Wanted-0.01 || got > test.Wanted+0.01 {
+			t.Errorf("%s: ItemsPerDay() = %f, wanted %f", test.Name, got,
+				test.Wanted)
+		}
+	}
+}
+
+func TestSuggestUpdateFrequency(t *testing.T) {
+	tests := []struct {
+		ItemsPerDay float64
+		Wanted      int64
+	}{
+		{0, 24 * 60 * 60},
+		{0.1, 24 * 60 * 60},
+		{1, 24 * 60 * 60},
+		{2, 12 * 60 * 60},
+		{5, 3 * 60 * 60},
+		{24, 60 * 60},
+		{1000, 15 * 60},
+	}
+
+	for _, test := range tests {
+		if got := SuggestUpdateFrequency(test.ItemsPerDay); got != test.Wanted {
+			t.Errorf("SuggestUpdateFrequency(%f) = %d, wanted %d", test.ItemsPerDay,
+				got, test.Wanted)
+		}
+	}
+}
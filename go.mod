@@ -1,6 +1,6 @@
 module github.com/horgh/gorse
 
-go 1.12
+go 1.18
 
 require (
 	github.com/DATA-DOG/go-sqlmock v1.3.3
@@ -9,5 +9,13 @@ require (
 	github.com/horgh/config v0.0.0-20190101204049-770bc48a3bdf
 	github.com/horgh/rss v0.0.0-20200313015236-fa38e8cb52c5
 	github.com/lib/pq v1.3.0
-	github.com/pkg/errors v0.9.1
+	github.com/mattn/go-sqlite3 v1.14.15
+	golang.org/x/crypto v0.0.0-20200302210943-78000ba7a073
+	golang.org/x/net v0.0.0-20200301022130-244492dfa37a
+)
+
+require (
+	github.com/gorilla/securecookie v1.1.1 // indirect
+	github.com/pkg/errors v0.9.1 // indirect
+	golang.org/x/text v0.3.2 // indirect
 )
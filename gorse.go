@@ -3,9 +3,12 @@
 package gorse
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
+	"strings"
 	"time"
+	"unicode/utf8"
 )
 
 // ReadState holds an item's state (rss_item_state table, read_state type).
@@ -31,25 +34,289 @@ type DBItem struct {
 	GUID            *string
 }
 
-// DBSetItemReadState sets the item's read state for the user.
-func DBSetItemReadState(db *sql.DB, id int64, userID int,
+// DBSetItemReadState sets the item's read state for the user. See
+// DBSetItemsReadState.
+func DBSetItemReadState(ctx context.Context, db Querier, id int64, userID int,
 	state ReadState) error {
-	// Upsert.
+	return DBSetItemsReadState(ctx, db, []int64{id}, userID, state)
+}
+
+// maxReadStateBatch is the most items we set the state of in one statement.
+// This keeps us well under the databases' limits on the number of parameters.
+const maxReadStateBatch = 500
+
+// DBSetItemsReadState sets the read state of each of the items for the user.
+//
+// We upsert many rows per statement rather than running a statement per item.
+//
+// We record each item whose state changes in the state history. Run this in a
+// transaction so the history's old states and the unread counts are certain to
+// be right.
+func DBSetItemsReadState(ctx context.Context, db Querier, ids []int64,
+	userID int, state ReadState) error {
+	// A statement can't affect the same row twice.
+	seen := map[int64]struct{}{}
+	var unique []int64
+	for _, id := range ids {
+		if _, ok := seen[id]; ok {
+			continue
+		}
+		seen[id] = struct{}{}
+		unique = append(unique, id)
+	}
+
+	for len(unique) > 0 {
+		batch := unique
+		if len(batch) > maxReadStateBatch {
+			batch = batch[:maxReadStateBatch]
+		}
+		unique = unique[len(batch):]
+
+		if err := lockItemStates(ctx, db, batch, userID); err != nil {
+			return err
+		}
+
+		oldStates, err := itemReadStates(ctx, db, batch, userID)
+		if err != nil {
+			return err
+		}
+
+		var values []string
+		var params []interface{}
+		for _, id := range batch {
+			n := len(params)
+			values = append(values, fmt.Sprintf("($%d, $%d, $%d)", n+1, n+2, n+3))
+			params = append(params, userID, id, state.String())
+		}
+
+		query := `
+INSERT INTO rss_item_state
+(user_id, item_id, state)
+VALUES ` + strings.Join(values, ", ") + `
+ON CONFLICT (user_id, item_id) DO UPDATE
+SET state = EXCLUDED.state
+`
+		if _, err := db.ExecContext(ctx, query, params...); err != nil {
+			return fmt.Errorf("unable to set read state on %d items: %s",
+				len(batch), err)
+		}
+
+		if err := recordStateChanges(ctx, db, batch, userID, oldStates,
+			state); err != nil {
+			return err
+		}
+
+		if err := adjustUnreadCounts(ctx, db, batch, userID, oldStates,
+			state); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// lockItemStates locks the user's state rows of the items until the
+// transaction ends. Without this, two transactions could both read an item as
+// unread and both take it off the unread counts when marking it read.
+//
+// Items without a state we give an unread row so there is a row to lock. A
+// conflicting upsert locks the existing row even though its WHERE leaves it
+// unchanged. This works the same way in Postgres and SQLite, where writes take
+// the database's lock anyway.
+func lockItemStates(ctx context.Context, db Querier, ids []int64,
+	userID int) error {
+	var values []string
+	var params []interface{}
+	for _, id := range ids {
+		n := len(params)
+		values = append(values, fmt.Sprintf("($%d, $%d, $%d)", n+1, n+2, n+3))
+		params = append(params, userID, id, Unread.String())
+	}
+
 	query := `
 INSERT INTO rss_item_state
 (user_id, item_id, state)
-VALUES($1, $2, $3)
+VALUES ` + strings.Join(values, ", ") + `
 ON CONFLICT (user_id, item_id) DO UPDATE
-SET state = $4
+SET state = rss_item_state.state
+WHERE false
 `
-	_, err := db.Exec(query, userID, id, state.String(), state.String())
+	if _, err := db.ExecContext(ctx, query, params...); err != nil {
+		return fmt.Errorf("unable to lock read states of %d items: %s",
+			len(ids), err)
+	}
+
+	return nil
+}
+
+// itemReadStates looks up the user's states for the items. Items without a
+// state are unread.
+func itemReadStates(ctx context.Context, db Querier, ids []int64,
+	userID int) (map[int64]ReadState, error) {
+	placeholders := make([]string, len(ids))
+	params := []interface{}{userID}
+	for i, id := range ids {
+		params = append(params, id)
+		placeholders[i] = fmt.Sprintf("$%d", len(params))
+	}
+
+	query := `
+SELECT item_id, state FROM rss_item_state
+WHERE user_id = $1 AND item_id IN (` + strings.Join(placeholders, ", ") + `)
+`
+
+	rows, err := db.QueryContext(ctx, query, params...)
 	if err != nil {
-		return fmt.Errorf("unable to set read state on item: %d: %s", id, err)
+		return nil, fmt.Errorf("unable to query read states: %s", err)
+	}
+
+	states := map[int64]ReadState{}
+	for _, id := range ids {
+		states[id] = Unread
+	}
+
+	for rows.Next() {
+		var id int64
+		var s string
+		if err := rows.Scan(&id, &s); err != nil {
+			_ = rows.Close()
+			return nil, fmt.Errorf("failed to scan row: %s", err)
+		}
+
+		state, err := ParseReadState(s)
+		if err != nil {
+			_ = rows.Close()
+			return nil, err
+		}
+		states[id] = state
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failure fetching rows: %s", err)
+	}
+
+	return states, nil
+}
+
+// recordStateChanges adds the items whose state changed to the state history.
+func recordStateChanges(ctx context.Context, db Querier, ids []int64,
+	userID int, oldStates map[int64]ReadState, state ReadState) error {
+	var values []string
+	var params []interface{}
+	for _, id := range ids {
+		if oldStates[id] == state {
+			continue
+		}
+		n := len(params)
+		values = append(values, fmt.Sprintf("($%d, $%d, $%d, $%d)", n+1, n+2,
+			n+3, n+4))
+		params = append(params, id, userID, oldStates[id].String(),
+			state.String())
+	}
+
+	if len(values) == 0 {
+		return nil
+	}
+
+	query := `
+INSERT INTO rss_item_state_history
+(item_id, user_id, old_state, new_state)
+VALUES ` + strings.Join(values, ", ")
+
+	if _, err := db.ExecContext(ctx, query, params...); err != nil {
+		return fmt.Errorf("unable to record state changes of %d items: %s",
+			len(values), err)
 	}
 
 	return nil
 }
 
+// MaxNoteLength is the most characters a note on an item may have.
+const MaxNoteLength = 500
+
+// SetItemNote sets the user's note on the item. A blank note removes it.
+//
+// The item must have a state for the user, such as being saved to read later.
+// If not, we return ErrNotFound.
+func SetItemNote(ctx context.Context, db Querier, itemID int64, userID int,
+	note string) error {
+	note = strings.TrimSpace(note)
+	if utf8.RuneCountInString(note) > MaxNoteLength {
+		return fmt.Errorf("note is longer than %d characters", MaxNoteLength)
+	}
+
+	var n *string
+	if note != "" {
+		n = &note
+	}
+
+	query := `
+UPDATE rss_item_state SET note = $1
+WHERE user_id = $2 AND item_id = $3
+`
+
+	result, err := db.ExecContext(ctx, query, n, userID, itemID)
+	if err != nil {
+		return fmt.Errorf("unable to set note on item: %d: %s", itemID, err)
+	}
+
+	return requireOneRow(result)
+}
+
+// StateChange is a change to a user's state for an item.
+type StateChange struct {
+	ItemID   int64
+	UserID   int
+	OldState ReadState
+	NewState ReadState
+	Time     time.Time
+}
+
+// StateChanges retrieves the user's most recent state changes, newest first.
+func StateChanges(ctx context.Context, db Querier, userID,
+	limit int) ([]StateChange, error) {
+	query := `
+SELECT item_id, user_id, old_state, new_state, create_time
+FROM rss_item_state_history
+WHERE user_id = $1
+ORDER BY create_time DESC, id DESC
+LIMIT $2
+`
+
+	rows, err := db.QueryContext(ctx, query, userID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("unable to query state history: %s", err)
+	}
+
+	var changes []StateChange
+	for rows.Next() {
+		var change StateChange
+		var oldState, newState string
+		if err := rows.Scan(&change.ItemID, &change.UserID, &oldState, &newState,
+			&change.Time); err != nil {
+			_ = rows.Close()
+			return nil, fmt.Errorf("failed to scan row: %s", err)
+		}
+
+		if change.OldState, err = ParseReadState(oldState); err != nil {
+			_ = rows.Close()
+			return nil, err
+		}
+		if change.NewState, err = ParseReadState(newState); err != nil {
+			_ = rows.Close()
+			return nil, err
+		}
+
+		changes = append(changes, change)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failure fetching rows: %s", err)
+	}
+
+	return changes, nil
+}
+
 // Turn read state into the enumerated type in the database (read_state).
 func (s ReadState) String() string {
 	if s == Unread {
@@ -61,9 +328,24 @@ func (s ReadState) String() string {
 	return "read-later"
 }
 
+// ParseReadState turns the enumerated type in the database (read_state) into
+// a read state.
+func ParseReadState(s string) (ReadState, error) {
+	switch s {
+	case "unread":
+		return Unread, nil
+	case "read":
+		return Read, nil
+	case "read-later":
+		return ReadLater, nil
+	}
+	return Unread, fmt.Errorf("invalid read state: %s", s)
+}
+
 // FindItemByLink retrieves an item's information from the database by feed and
 // link. Link is unique per feed.
-func FindItemByLink(db *sql.DB, feedID int64, link string) (*DBItem, error) {
+func FindItemByLink(ctx context.Context, db Querier, feedID int64,
+	link string) (*DBItem, error) {
 	query := `
 SELECT
 id, title, description, link, rss_feed_id, publication_date, guid
@@ -72,7 +354,7 @@ WHERE rss_feed_id = $1 AND
 link = $2
 `
 
-	row := db.QueryRow(query, feedID, link)
+	row := db.QueryRowContext(ctx, query, feedID, link)
 	item := &DBItem{}
 	if err := row.Scan(
 		&item.ID,
@@ -88,3 +370,183 @@ link = $2
 
 	return item, nil
 }
+
+// addItem records a new item from a feed, along with its enclosures and
+// categories, and counts it unread for every user. Users who muted a phrase
+// it contains may have us mark it read instead, and we apply users' rules to
+// it. Run it in a transaction so that all of this happens or none of it does.
+func addItem(ctx context.Context, db Querier, feedID int64,
+	item *Item) (int64, error) {
+	query := `
+INSERT INTO rss_item
+(title, description, link, publication_date, rss_feed_id, guid, raw)
+VALUES($1, $2, $3, $4, $5, $6, $7)
+RETURNING id
+`
+
+	var guid *string
+	if item.GUID != "" {
+		guid = &item.GUID
+	}
+	var raw *string
+	if item.Raw != "" {
+		raw = &item.Raw
+	}
+
+	// UTC so that times compare correctly in SQLite where they are strings.
+	var id int64
+	if err := db.QueryRowContext(ctx, query, item.Title, item.Description,
+		item.Link, item.PubDate.UTC(), feedID, guid, raw).Scan(&id); err != nil {
+		return -1, fmt.Errorf("failed to add item with title [%s]: %s",
+			item.Title, err)
+	}
+
+	if err := addItemEnclosures(ctx, db, id, item.Enclosures); err != nil {
+		return -1, err
+	}
+
+	if err := addItemCategories(ctx, db, id, item.Categories); err != nil {
+		return -1, err
+	}
+
+	if err := addUnreadItem(ctx, db, feedID, item.PubDate); err != nil {
+		return -1, err
+	}
+
+	if err := markMutedItemRead(ctx, db, id, item); err != nil {
+		return -1, err
+	}
+
+	if err := applyItemRules(ctx, db, feedID, id, item); err != nil {
+		return -1, err
+	}
+
+	return id, nil
+}
+
+// UpsertResult says what UpsertItem did.
+type UpsertResult int
+
+const (
+	// ItemUnchanged means we had the item as it is.
+	ItemUnchanged UpsertResult = iota
+
+	// ItemCreated means we didn't have the item and added it.
+	ItemCreated
+
+	// ItemModified means we had the item and updated it to match.
+	ItemModified
+)
+
+func (r UpsertResult) String() string {
+	switch r {
+	case ItemUnchanged:
+		return "unchanged"
+	case ItemCreated:
+		return "created"
+	case ItemModified:
+		return "modified"
+	default:
+		return fmt.Sprintf("unknown upsert result %d", int(r))
+	}
+}
+
+// UpsertItem adds the item to the feed or updates the one we have to match
+// it. It returns the item's ID and what it did.
+//
+// We find the one we have by GUID if the item has one, and otherwise or
+// failing that by link. Updating changes the title, description, link, and
+// GUID, along with the raw XML if the item has it. We keep the publication
+// date we first saw so that the item keeps its place and counts towards the
+// same unread counts. Users' states on the item are unaffected.
+//
+// Adding counts the item unread for every user. Run this in a transaction so
+// that both happen or neither does.
+func UpsertItem(ctx context.Context, db Querier, feedID int64,
+	item *Item) (int64, UpsertResult, error) {
+	existing, err := findItemToUpsert(ctx, db, feedID, item)
+	if err != nil {
+		return -1, ItemUnchanged, err
+	}
+
+	if existing == nil {
+		id, err := addItem(ctx, db, feedID, item)
+		if err != nil {
+			return -1, ItemUnchanged, err
+		}
+		return id, ItemCreated, nil
+	}
+
+	if existing.Title == item.Title &&
+		existing.Description == item.Description &&
+		existing.Link == item.Link &&
+		(item.GUID == "" ||
+			(existing.GUID != nil && *existing.GUID == item.GUID)) {
+		return existing.ID, ItemUnchanged, nil
+	}
+
+	query := `
+UPDATE rss_item
+SET title = $1, description = $2, link = $3, guid = COALESCE($4, guid),
+raw = COALESCE($5, raw)
+WHERE id = $6
+`
+
+	var guid *string
+	if item.GUID != "" {
+		guid = &item.GUID
+	}
+	var raw *string
+	if item.Raw != "" {
+		raw = &item.Raw
+	}
+
+	if _, err := db.ExecContext(ctx, query, item.Title, item.Description,
+		item.Link, guid, raw, existing.ID); err != nil {
+		return -1, ItemUnchanged, fmt.Errorf(
+			"failed to update item ID [%d] with title [%s]: %s", existing.ID,
+			item.Title, err)
+	}
+
+	return existing.ID, ItemModified, nil
+}
+
+// findItemToUpsert finds the item we have that UpsertItem should update. It
+// returns nil if we don't have one.
+func findItemToUpsert(ctx context.Context, db Querier, feedID int64,
+	item *Item) (*DBItem, error) {
+	query := `
+SELECT id, title, description, link, rss_feed_id, publication_date, guid
+FROM rss_item
+WHERE rss_feed_id = $1 AND `
+
+	// Column and value pairs, in the order to try them.
+	lookups := [][2]string{{"link", item.Link}}
+	if item.GUID != "" {
+		lookups = append([][2]string{{"guid", item.GUID}}, lookups...)
+	}
+
+	for _, lookup := range lookups {
+		dbItem := &DBItem{}
+		err := db.QueryRowContext(ctx, query+lookup[0]+` = $2`, feedID,
+			lookup[1]).Scan(
+			&dbItem.ID,
+			&dbItem.Title,
+			&dbItem.Description,
+			&dbItem.Link,
+			&dbItem.RSSFeedID,
+			&dbItem.PublicationDate,
+			&dbItem.GUID,
+		)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to look up item by %s: %s", lookup[0],
+				err)
+		}
+		return dbItem, nil
+	}
+
+	return nil, nil
+}
@@ -0,0 +1,106 @@
+package gorse
+
+import (
+	"context"
+	"database/sql/driver"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestDBSetItemsReadState(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("unable to open mock db: %s", err)
+	}
+	defer db.Close()
+
+	var ids []int64
+	for i := int64(1); i <= maxReadStateBatch+1; i++ {
+		ids = append(ids, i)
+	}
+	// A duplicate. We only set it once.
+	ids = append(ids, 1)
+
+	// Midnight of January 2nd in UTC. Days are UTC whatever the zone.
+	pubDate := time.Date(2020, 1, 1, 16, 0, 0, 0,
+		time.FixedZone("PST", -8*60*60))
+
+	var firstLockArgs, firstArgs, firstHistoryArgs []driver.Value
+	for _, id := range ids[:maxReadStateBatch] {
+		firstLockArgs = append(firstLockArgs, 3, id, "unread")
+		firstArgs = append(firstArgs, 3, id, "read")
+		// Item 1 is already read so its state doesn't change.
+		if id != 1 {
+			firstHistoryArgs = append(firstHistoryArgs, id, 3, "unread", "read")
+		}
+	}
+
+	// We lock the rows before reading the old states.
+	mock.ExpectExec(`INSERT INTO rss_item_state \(user_id, item_id, state\) ` +
+		`VALUES \(\$1, \$2, \$3\), .* ON CONFLICT .* WHERE false`).
+		WithArgs(firstLockArgs...).
+		WillReturnResult(sqlmock.NewResult(0, maxReadStateBatch-1))
+	mock.ExpectQuery(`SELECT item_id, state FROM rss_item_state ` +
+		`WHERE user_id = \$1 AND item_id IN \(\$2, \$3, .*\)`).
+		WillReturnRows(sqlmock.NewRows([]string{"item_id", "state"}).
+			AddRow(1, "read"))
+	mock.ExpectExec(`INSERT INTO rss_item_state \(user_id, item_id, state\) ` +
+		`VALUES \(\$1, \$2, \$3\), \(\$4, \$5, \$6\), .* ON CONFLICT`).
+		WithArgs(firstArgs...).
+		WillReturnResult(sqlmock.NewResult(0, maxReadStateBatch))
+	mock.ExpectExec(`INSERT INTO rss_item_state_history ` +
+		`\(item_id, user_id, old_state, new_state\) ` +
+		`VALUES \(\$1, \$2, \$3, \$4\), `).
+		WithArgs(firstHistoryArgs...).
+		WillReturnResult(sqlmock.NewResult(0, maxReadStateBatch-1))
+	// The items that were unread count against their feeds and days.
+	mock.ExpectQuery(`SELECT rss_feed_id, publication_date FROM rss_item ` +
+		`WHERE id IN \(\$1, \$2, .*\)`).
+		WillReturnRows(sqlmock.NewRows([]string{"rss_feed_id",
+			"publication_date"}).
+			AddRow(5, pubDate).
+			AddRow(5, pubDate.Add(time.Hour)))
+	mock.ExpectExec(`INSERT INTO rss_unread_count `+
+		`\(user_id, feed_id, publication_day, unread_count\) `+
+		`VALUES \(\$1, \$2, \$3, \$4\) ON CONFLICT`).
+		WithArgs(3, int64(5), "2020-01-02", -2).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	mock.ExpectExec(`INSERT INTO rss_item_state \(user_id, item_id, state\) `+
+		`VALUES \(\$1, \$2, \$3\) ON CONFLICT .* WHERE false`).
+		WithArgs(3, int64(maxReadStateBatch+1), "unread").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`SELECT item_id, state FROM rss_item_state `+
+		`WHERE user_id = \$1 AND item_id IN \(\$2\)`).
+		WithArgs(3, int64(maxReadStateBatch+1)).
+		WillReturnRows(sqlmock.NewRows([]string{"item_id", "state"}))
+	mock.ExpectExec(`INSERT INTO rss_item_state \(user_id, item_id, state\) `+
+		`VALUES \(\$1, \$2, \$3\) ON CONFLICT`).
+		WithArgs(3, int64(maxReadStateBatch+1), "read").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO rss_item_state_history `+
+		`\(item_id, user_id, old_state, new_state\) `+
+		`VALUES \(\$1, \$2, \$3, \$4\)$`).
+		WithArgs(int64(maxReadStateBatch+1), 3, "unread", "read").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`SELECT rss_feed_id, publication_date FROM rss_item ` +
+		`WHERE id IN \(\$1\)`).
+		WithArgs(int64(maxReadStateBatch + 1)).
+		WillReturnRows(sqlmock.NewRows([]string{"rss_feed_id",
+			"publication_date"}).
+			AddRow(5, pubDate))
+	mock.ExpectExec(`INSERT INTO rss_unread_count `).
+		WithArgs(3, int64(5), "2020-01-02", -1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	if err := DBSetItemsReadState(context.Background(), db, ids, 3,
+		Read); err != nil {
+		t.Fatalf("DBSetItemsReadState() = error %s", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
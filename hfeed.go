@@ -0,0 +1,336 @@
+package gorse
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/horgh/rss"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+	"golang.org/x/net/html/charset"
+)
+
+// parseHFeed extracts h-entry items from an HTML page.
+//
+// This lets us follow sites that have no XML feed at all but mark up their
+// posts using microformats. See http://microformats.org/wiki/h-entry.
+//
+// We take each h-entry's p-name as its title, u-url as its link, dt-published
+// as its publication date, p-summary (or failing that e-content) as its
+// description, and u-uid as its GUID.
+//
+// We resolve relative links against the page's URL, opts.URL.
+func parseHFeed(data []byte, opts ParseOptions) (*Feed, error) {
+	_, encoding, _ := charset.DetermineEncoding(data, opts.ContentType)
+
+	reader, err := charset.NewReader(bytes.NewReader(data), opts.ContentType)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode HTML: %s", err)
+	}
+
+	doc, err := html.Parse(reader)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse HTML: %s", err)
+	}
+
+	base, err := url.Parse(opts.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid page URL: %s: %s", opts.URL, err)
+	}
+	if href := findBaseHref(doc); href != "" {
+		if u, err := base.Parse(href); err == nil {
+			base = u
+		}
+	}
+
+	entries := findByClass(doc, "h-entry")
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("no h-entry elements found")
+	}
+
+	feed := &Feed{
+		Link:     base.String(),
+		Type:     "h-feed",
+		Encoding: encoding,
+	}
+
+	if hFeeds := findByClass(doc, "h-feed"); len(hFeeds) > 0 {
+		if names := findByClass(hFeeds[0], "p-name"); len(names) > 0 &&
+			!hasAncestorClass(names[0], "h-entry", hFeeds[0]) {
+			feed.Title = textContent(names[0])
+		}
+	}
+	if feed.Title == "" {
+		if title := findElement(doc, atom.Title); title != nil {
+			feed.Title = textContent(title)
+		}
+	}
+
+	for _, entry := range entries {
+		item := rss.Item{
+			Title: firstProperty(entry, "p-name", textContent),
+			Link: firstProperty(entry, "u-url", func(n *html.Node) string {
+				return resolveURL(base, urlProperty(n))
+			}),
+			GUID: firstProperty(entry, "u-uid", func(n *html.Node) string {
+				return resolveURL(base, urlProperty(n))
+			}),
+			PubDate: parseMicroformatTime(
+				firstProperty(entry, "dt-published", timeProperty)),
+			Description: firstProperty(entry, "p-summary", textContent),
+		}
+
+		if item.Description == "" {
+			item.Description = firstProperty(entry, "e-content", textContent)
+		}
+
+		// An entry's name defaults to all of its text. That's not much of a
+		// title, so fall back to its summary if there is one.
+		if item.Title == "" {
+			item.Title = item.Description
+		}
+
+		raw := ""
+		if opts.KeepRaw {
+			var b bytes.Buffer
+			if err := html.Render(&b, entry); err != nil {
+				return nil, fmt.Errorf("unable to render h-entry: %s", err)
+			}
+			raw = b.String()
+		}
+
+		feed.Items = append(feed.Items, Item{Item: item, Raw: raw})
+	}
+
+	return feed, nil
+}
+
+// looksLikeHTML decides whether a payload is worth trying to parse as HTML.
+func looksLikeHTML(data []byte, contentType string) bool {
+	if strings.HasPrefix(strings.ToLower(contentType), "text/html") {
+		return true
+	}
+
+	if len(data) > 1024 {
+		data = data[:1024]
+	}
+	data = bytes.ToLower(data)
+	return bytes.Contains(data, []byte("<!doctype html")) ||
+		bytes.Contains(data, []byte("<html"))
+}
+
+// findByClass finds all elements under (and including) n with the given class.
+//
+// We don't descend into matching elements. This means we find the outermost
+// h-entry elements and not any nested in them (such as replies).
+func findByClass(n *html.Node, class string) []*html.Node {
+	if n.Type == html.ElementNode && hasClass(n, class) {
+		return []*html.Node{n}
+	}
+
+	var found []*html.Node
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		found = append(found, findByClass(c, class)...)
+	}
+	return found
+}
+
+// hasAncestorClass checks whether any element between n and stop has the
+// class.
+func hasAncestorClass(n *html.Node, class string, stop *html.Node) bool {
+	for p := n.Parent; p != nil && p != stop; p = p.Parent {
+		if p.Type == html.ElementNode && hasClass(p, class) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasClass(n *html.Node, class string) bool {
+	for _, field := range strings.Fields(attr(n, "class")) {
+		if field == class {
+			return true
+		}
+	}
+	return false
+}
+
+func attr(n *html.Node, name string) string {
+	for _, a := range n.Attr {
+		if a.Key == name {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+// findElement finds the first element of the given type under n.
+func findElement(n *html.Node, a atom.Atom) *html.Node {
+	if n.Type == html.ElementNode && n.DataAtom == a {
+		return n
+	}
+
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if found := findElement(c, a); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+func findBaseHref(doc *html.Node) string {
+	base := findElement(doc, atom.Base)
+	if base == nil {
+		return ""
+	}
+	return attr(base, "href")
+}
+
+// firstProperty finds the first element under the entry with the property
+// class and returns its value as decided by the value function.
+//
+// We skip properties belonging to nested microformats (e.g., the p-name of an
+// h-card author).
+func firstProperty(entry *html.Node, class string,
+	value func(*html.Node) string) string {
+	var find func(*html.Node) string
+	find = func(n *html.Node) string {
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type != html.ElementNode {
+				continue
+			}
+
+			if hasClass(c, class) {
+				return value(c)
+			}
+
+			if isMicroformatRoot(c) {
+				continue
+			}
+
+			if v := find(c); v != "" {
+				return v
+			}
+		}
+		return ""
+	}
+	return find(entry)
+}
+
+// isMicroformatRoot checks whether the element starts a nested microformat.
+func isMicroformatRoot(n *html.Node) bool {
+	for _, field := range strings.Fields(attr(n, "class")) {
+		if strings.HasPrefix(field, "h-") {
+			return true
+		}
+	}
+	return false
+}
+
+// urlProperty finds the value of a u-* property.
+func urlProperty(n *html.Node) string {
+	switch n.DataAtom {
+	case atom.A, atom.Area, atom.Link:
+		return attr(n, "href")
+	case atom.Img, atom.Audio, atom.Video, atom.Source:
+		return attr(n, "src")
+	case atom.Object:
+		return attr(n, "data")
+	}
+	return strings.TrimSpace(textContent(n))
+}
+
+// timeProperty finds the value of a dt-* property.
+func timeProperty(n *html.Node) string {
+	if v := attr(n, "datetime"); v != "" {
+		return v
+	}
+	if v := attr(n, "title"); n.DataAtom == atom.Abbr && v != "" {
+		return v
+	}
+	return strings.TrimSpace(textContent(n))
+}
+
+// inlineElements are elements that don't separate words in their text.
+var inlineElements = map[atom.Atom]struct{}{
+	atom.A:      {},
+	atom.Abbr:   {},
+	atom.B:      {},
+	atom.Cite:   {},
+	atom.Code:   {},
+	atom.Em:     {},
+	atom.I:      {},
+	atom.Mark:   {},
+	atom.Q:      {},
+	atom.S:      {},
+	atom.Small:  {},
+	atom.Span:   {},
+	atom.Strong: {},
+	atom.Sub:    {},
+	atom.Sup:    {},
+	atom.Time:   {},
+	atom.U:      {},
+}
+
+// textContent collects the text of an element, collapsing whitespace.
+func textContent(n *html.Node) string {
+	var b strings.Builder
+	var collect func(*html.Node)
+	collect = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			b.WriteString(n.Data)
+			return
+		}
+		if n.DataAtom == atom.Script || n.DataAtom == atom.Style {
+			return
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			collect(c)
+		}
+		if _, ok := inlineElements[n.DataAtom]; !ok {
+			b.WriteString(" ")
+		}
+	}
+	collect(n)
+	return strings.Join(strings.Fields(b.String()), " ")
+}
+
+func resolveURL(base *url.URL, ref string) string {
+	if ref == "" {
+		return ""
+	}
+	u, err := base.Parse(ref)
+	if err != nil {
+		return ref
+	}
+	return u.String()
+}
+
+// parseMicroformatTime parses a dt-published value.
+//
+// We return the zero time if we can't parse it. This is the same as what the
+// rss package does for items without publication dates.
+func parseMicroformatTime(s string) time.Time {
+	layouts := []string{
+		time.RFC3339,
+		"2006-01-02T15:04:05-0700",
+		"2006-01-02T15:04-07:00",
+		"2006-01-02T15:04:05",
+		"2006-01-02 15:04:05-07:00",
+		"2006-01-02 15:04:05",
+		"2006-01-02T15:04",
+		"2006-01-02",
+	}
+
+	for _, layout := range layouts {
+		t, err := time.ParseInLocation(layout, s, time.UTC)
+		if err == nil {
+			return t.In(time.UTC)
+		}
+	}
+
+	return time.Time{}
+}
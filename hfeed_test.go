@@ -0,0 +1,83 @@
+package gorse
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseFeedHFeed(t *testing.T) {
+	page := []byte(`<!DOCTYPE html>
+<html>
+<head><title>My Blog</title></head>
+<body>
+<div class="h-feed">
+	<h1 class="p-name">Posts</h1>
+	<article class="h-entry">
+		<h2 class="p-name">First post</h2>
+		<a class="u-url" href="/2020/first">permalink</a>
+		<time class="dt-published" datetime="2020-03-01T10:00:00Z">March 1</time>
+		<div class="h-card p-author"><span class="p-name">Alice</span></div>
+		<p class="p-summary">The first one.</p>
+	</article>
+	<article class="h-entry">
+		<a class="u-url u-uid" href="https://example.com/2020/second">
+			<span class="p-name">Second post</span>
+		</a>
+		<time class="dt-published" datetime="2020-03-02">March 2</time>
+		<div class="e-content"><p>Some <b>content</b>.</p></div>
+	</article>
+</div>
+</body>
+</html>
+`)
+
+	feed, err := ParseFeed(page, ParseOptions{
+		ContentType: "text/html; charset=utf-8",
+		URL:         "https://example.com/blog/",
+	})
+	if err != nil {
+		t.Fatalf("ParseFeed() = error %s", err)
+	}
+
+	if feed.Type != "h-feed" {
+		t.Errorf("type = %s, wanted h-feed", feed.Type)
+	}
+	if feed.Title != "Posts" {
+		t.Errorf("title = %q, wanted Posts", feed.Title)
+	}
+
+	if len(feed.Items) != 2 {
+		t.Fatalf("got %d items, wanted 2", len(feed.Items))
+	}
+
+	first := feed.Items[0]
+	if first.Title != "First post" {
+		t.Errorf("first title = %q", first.Title)
+	}
+	if first.Link != "https://example.com/2020/first" {
+		t.Errorf("first link = %q", first.Link)
+	}
+	if first.Description != "The first one." {
+		t.Errorf("first description = %q", first.Description)
+	}
+	if !first.PubDate.Equal(time.Date(2020, 3, 1, 10, 0, 0, 0, time.UTC)) {
+		t.Errorf("first publication date = %s", first.PubDate)
+	}
+	if first.GUID != "" {
+		t.Errorf("first GUID = %q, wanted none", first.GUID)
+	}
+
+	second := feed.Items[1]
+	if second.Title != "Second post" {
+		t.Errorf("second title = %q", second.Title)
+	}
+	if second.GUID != "https://example.com/2020/second" {
+		t.Errorf("second GUID = %q", second.GUID)
+	}
+	if second.Description != "Some content." {
+		t.Errorf("second description = %q", second.Description)
+	}
+	if !second.PubDate.Equal(time.Date(2020, 3, 2, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("second publication date = %s", second.PubDate)
+	}
+}
@@ -0,0 +1,109 @@
+package gorse
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Users may highlight words and phrases they watch for, such as a project
+// they follow. Items containing them get a badge, and users can list only
+// those items. This is the opposite of muting.
+
+// Highlight is a word or phrase a user watches for.
+type Highlight struct {
+	ID     int64
+	UserID int
+
+	// Phrase is what items must contain, ignoring case, to be highlighted. See
+	// NormalizeKeyword for its form.
+	Phrase string
+
+	CreateTime time.Time
+}
+
+// Matches decides whether an item with the title and description contains
+// the phrase.
+func (h Highlight) Matches(title, description string) bool {
+	return containsKeyword(title, description, h.Phrase)
+}
+
+// AddHighlight highlights the phrase for the user. It's fine if they already
+// highlight it.
+func AddHighlight(ctx context.Context, db Querier, userID int,
+	phrase string) error {
+	phrase, err := NormalizeKeyword(phrase)
+	if err != nil {
+		return err
+	}
+
+	query := `
+INSERT INTO rss_highlight_keyword (user_id, phrase)
+VALUES ($1, $2)
+ON CONFLICT (user_id, phrase) DO NOTHING
+`
+
+	if _, err := db.ExecContext(ctx, query, userID, phrase); err != nil {
+		return fmt.Errorf("unable to highlight %q for user %d: %s", phrase,
+			userID, err)
+	}
+
+	return nil
+}
+
+// RemoveHighlight stops highlighting the phrase for the user. It returns
+// ErrNotFound if they didn't highlight it.
+func RemoveHighlight(ctx context.Context, db Querier, userID int,
+	phrase string) error {
+	phrase, err := NormalizeKeyword(phrase)
+	if err != nil {
+		return err
+	}
+
+	query := `
+DELETE FROM rss_highlight_keyword
+WHERE user_id = $1 AND phrase = $2
+`
+
+	result, err := db.ExecContext(ctx, query, userID, phrase)
+	if err != nil {
+		return fmt.Errorf("unable to remove highlight %q of user %d: %s", phrase,
+			userID, err)
+	}
+
+	return requireOneRow(result)
+}
+
+// ListHighlights retrieves the phrases the user highlights in alphabetical
+// order.
+func ListHighlights(ctx context.Context, db Querier,
+	userID int) ([]Highlight, error) {
+	query := `
+SELECT id, user_id, phrase, create_time
+FROM rss_highlight_keyword
+WHERE user_id = $1
+ORDER BY phrase
+`
+
+	rows, err := db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("unable to query highlights: %s", err)
+	}
+
+	var highlights []Highlight
+	for rows.Next() {
+		var h Highlight
+		if err := rows.Scan(&h.ID, &h.UserID, &h.Phrase,
+			&h.CreateTime); err != nil {
+			_ = rows.Close()
+			return nil, fmt.Errorf("failed to scan row: %s", err)
+		}
+		highlights = append(highlights, h)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failure fetching rows: %s", err)
+	}
+
+	return highlights, nil
+}
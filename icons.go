@@ -0,0 +1,99 @@
+package gorse
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// FeedIcon is a feed's icon, such as its site's favicon.
+type FeedIcon struct {
+	FeedID int64
+
+	// Data is the image.
+	Data []byte
+
+	// ContentType is the image's MIME type.
+	ContentType string
+
+	// ETag is the ETag of the response we fetched the icon in. It is blank if
+	// there wasn't one.
+	ETag string
+
+	// FetchTime is when we last fetched the icon, or found it hadn't changed.
+	FetchTime time.Time
+}
+
+// GetFeedIcon retrieves the feed's icon. It returns ErrNotFound if we don't
+// have one.
+func GetFeedIcon(ctx context.Context, db Querier, feedID int64) (*FeedIcon,
+	error) {
+	query := `
+SELECT data, content_type, COALESCE(etag, ''), fetch_time
+FROM rss_feed_icon
+WHERE feed_id = $1
+`
+
+	icon := &FeedIcon{FeedID: feedID}
+	err := db.QueryRowContext(ctx, query, feedID).Scan(&icon.Data,
+		&icon.ContentType, &icon.ETag, &icon.FetchTime)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to look up icon of feed ID [%d]: %s",
+			feedID, err)
+	}
+	icon.FetchTime = icon.FetchTime.UTC()
+
+	return icon, nil
+}
+
+// SetFeedIcon records the icon, replacing any the feed had.
+func SetFeedIcon(ctx context.Context, db Querier, icon FeedIcon) error {
+	if len(icon.Data) == 0 {
+		return fmt.Errorf("icon of feed ID [%d] is empty", icon.FeedID)
+	}
+	if icon.ContentType == "" {
+		return fmt.Errorf("icon of feed ID [%d] has no content type",
+			icon.FeedID)
+	}
+
+	query := `
+INSERT INTO rss_feed_icon (feed_id, data, content_type, etag, fetch_time)
+VALUES ($1, $2, $3, $4, $5)
+ON CONFLICT (feed_id) DO UPDATE
+SET data = EXCLUDED.data, content_type = EXCLUDED.content_type,
+etag = EXCLUDED.etag, fetch_time = EXCLUDED.fetch_time
+`
+
+	var etag *string
+	if icon.ETag != "" {
+		etag = &icon.ETag
+	}
+
+	if _, err := db.ExecContext(ctx, query, icon.FeedID, icon.Data,
+		icon.ContentType, etag, icon.FetchTime.UTC()); err != nil {
+		return fmt.Errorf("unable to set icon of feed ID [%d]: %s", icon.FeedID,
+			err)
+	}
+
+	return nil
+}
+
+// SetFeedIconFetched records that we fetched the feed's icon at the time and
+// found it hadn't changed. It returns ErrNotFound if we don't have an icon for
+// the feed.
+func SetFeedIconFetched(ctx context.Context, db Querier, feedID int64,
+	fetchTime time.Time) error {
+	query := `UPDATE rss_feed_icon SET fetch_time = $1 WHERE feed_id = $2`
+
+	result, err := db.ExecContext(ctx, query, fetchTime.UTC(), feedID)
+	if err != nil {
+		return fmt.Errorf("unable to update icon of feed ID [%d]: %s", feedID,
+			err)
+	}
+
+	return requireOneRow(result)
+}
@@ -0,0 +1,286 @@
+package gorse
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/horgh/rss"
+)
+
+// ImportedItem is an item from another reader's export along with the state
+// the user had it in there.
+type ImportedItem struct {
+	FeedName string
+	FeedURI  string
+
+	Title           string
+	Description     string
+	Link            string
+	PublicationDate time.Time
+
+	// State is Read or Unread, or ReadLater for items the user starred.
+	State ReadState
+
+	// Note is the user's note on the item, if any.
+	Note string
+}
+
+// ImportResult says what ImportItems did.
+type ImportResult struct {
+	// FeedsAdded is how many feeds we didn't have.
+	FeedsAdded int
+
+	// ItemsAdded is how many items we didn't have.
+	ItemsAdded int
+}
+
+// ParseImport parses an export from another reader. We support the entries
+// Miniflux's API returns (GET /v1/entries) and Tiny Tiny RSS's article export
+// (the import_export plugin). We tell which it is by whether it's JSON or XML.
+func ParseImport(r io.Reader) ([]ImportedItem, error) {
+	br := bufio.NewReader(r)
+	for {
+		c, err := br.ReadByte()
+		if err != nil {
+			return nil, fmt.Errorf("unable to read export: %s", err)
+		}
+		// Skip leading whitespace and any byte order mark.
+		if strings.IndexByte(" \t\r\n\xef\xbb\xbf", c) != -1 {
+			continue
+		}
+		if err := br.UnreadByte(); err != nil {
+			return nil, fmt.Errorf("unable to read export: %s", err)
+		}
+
+		switch c {
+		case '{':
+			return ParseMinifluxEntries(br)
+		case '<':
+			return ParseTTRSSArticles(br)
+		default:
+			return nil, fmt.Errorf("export is neither JSON nor XML")
+		}
+	}
+}
+
+// ParseMinifluxEntries parses entries as Miniflux's API returns them, such as
+// from GET /v1/entries. Entries Miniflux removed aren't included.
+func ParseMinifluxEntries(r io.Reader) ([]ImportedItem, error) {
+	var export struct {
+		Entries []struct {
+			Title       string    `json:"title"`
+			URL         string    `json:"url"`
+			Content     string    `json:"content"`
+			PublishedAt time.Time `json:"published_at"`
+			Status      string    `json:"status"`
+			Starred     bool      `json:"starred"`
+			Feed        struct {
+				Title   string `json:"title"`
+				FeedURL string `json:"feed_url"`
+			} `json:"feed"`
+		} `json:"entries"`
+	}
+	if err := json.NewDecoder(r).Decode(&export); err != nil {
+		return nil, fmt.Errorf("unable to parse Miniflux entries: %s", err)
+	}
+
+	var items []ImportedItem
+	for _, entry := range export.Entries {
+		item := ImportedItem{
+			FeedName:        entry.Feed.Title,
+			FeedURI:         entry.Feed.FeedURL,
+			Title:           entry.Title,
+			Description:     entry.Content,
+			Link:            entry.URL,
+			PublicationDate: entry.PublishedAt,
+		}
+
+		switch {
+		case entry.Starred:
+			item.State = ReadLater
+		case entry.Status == "read":
+			item.State = Read
+		case entry.Status == "unread":
+			item.State = Unread
+		case entry.Status == "removed":
+			continue
+		default:
+			return nil, fmt.Errorf("unknown Miniflux entry status: %s",
+				entry.Status)
+		}
+
+		items = append(items, item)
+	}
+
+	return items, nil
+}
+
+// ParseTTRSSArticles parses articles as Tiny Tiny RSS's import_export plugin
+// exports them. It exports only articles the user starred, published, or
+// archived, so each is either starred (ReadLater) or Read.
+func ParseTTRSSArticles(r io.Reader) ([]ImportedItem, error) {
+	var export struct {
+		Articles []struct {
+			GUID      string `xml:"guid"`
+			Title     string `xml:"title"`
+			Content   string `xml:"content"`
+			Marked    int    `xml:"marked"`
+			Note      string `xml:"note"`
+			Link      string `xml:"link"`
+			FeedTitle string `xml:"feed_title"`
+			FeedURL   string `xml:"feed_url"`
+			Updated   string `xml:"updated"`
+		} `xml:"article"`
+	}
+	if err := xml.NewDecoder(r).Decode(&export); err != nil {
+		return nil, fmt.Errorf("unable to parse Tiny Tiny RSS articles: %s", err)
+	}
+
+	var items []ImportedItem
+	for _, article := range export.Articles {
+		updated, err := parseTTRSSTime(article.Updated)
+		if err != nil {
+			return nil, err
+		}
+
+		// We leave out the GUID. Tiny Tiny RSS prefixes GUIDs with the owner and
+		// a hash of the feed URL, so they don't match the feed's.
+		item := ImportedItem{
+			FeedName:        article.FeedTitle,
+			FeedURI:         article.FeedURL,
+			Title:           article.Title,
+			Description:     article.Content,
+			Link:            article.Link,
+			PublicationDate: updated,
+			State:           Read,
+			Note:            strings.TrimSpace(article.Note),
+		}
+		if article.Marked != 0 {
+			item.State = ReadLater
+		}
+
+		items = append(items, item)
+	}
+
+	return items, nil
+}
+
+// parseTTRSSTime parses a time from Tiny Tiny RSS. It's as the database gave
+// it, so it depends on the database. Times without a zone are UTC.
+func parseTTRSSTime(s string) (time.Time, error) {
+	for _, layout := range []string{
+		"2006-01-02 15:04:05.999999999Z07",
+		"2006-01-02 15:04:05.999999999",
+		time.RFC3339Nano,
+	} {
+		if t, err := time.Parse(layout, strings.TrimSpace(s)); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid article time: %s", s)
+}
+
+// ImportItems records items from another reader's export for the user. We add
+// the feeds and items we don't have and subscribe the user to the feeds. We
+// set the user's state for each item to what it was in the export, along with
+// any note.
+//
+// Run this in a transaction so that an import either happens or doesn't.
+func ImportItems(ctx context.Context, store Store, userID int,
+	items []ImportedItem) (ImportResult, error) {
+	var result ImportResult
+	feedIDs := map[string]int64{}
+	itemIDs := map[ReadState][]int64{}
+	notes := map[int64]string{}
+
+	for _, item := range items {
+		if item.Link == "" {
+			return result, fmt.Errorf("item has blank link: %s", item.Title)
+		}
+
+		feedID, ok := feedIDs[item.FeedURI]
+		if !ok {
+			var added bool
+			var err error
+			feedID, added, err = SubscribeToFeed(ctx, store, userID, item.FeedName,
+				item.FeedURI)
+			if err != nil {
+				return result, err
+			}
+			if added {
+				result.FeedsAdded++
+			}
+			feedIDs[item.FeedURI] = feedID
+		}
+
+		id, added, err := importItem(ctx, store, feedID, item)
+		if err != nil {
+			return result, err
+		}
+		if added {
+			result.ItemsAdded++
+		}
+
+		itemIDs[item.State] = append(itemIDs[item.State], id)
+		if item.Note != "" {
+			notes[id] = truncateNote(item.Note)
+		}
+	}
+
+	for state, ids := range itemIDs {
+		if err := store.SetItemsReadState(ctx, ids, userID, state); err != nil {
+			return result, err
+		}
+	}
+
+	for id, note := range notes {
+		if err := store.SetItemNote(ctx, id, userID, note); err != nil {
+			return result, err
+		}
+	}
+
+	return result, nil
+}
+
+// importItem finds the item in the feed by its link or adds it if we don't
+// have it. It returns the item's ID and whether we added it.
+func importItem(ctx context.Context, store Store, feedID int64,
+	item ImportedItem) (int64, bool, error) {
+	exists, err := store.ItemExistsByLink(ctx, feedID, item.Link)
+	if err != nil {
+		return -1, false, err
+	}
+	if exists {
+		dbItem, err := store.FindItemByLink(ctx, feedID, item.Link)
+		if err != nil {
+			return -1, false, err
+		}
+		return dbItem.ID, false, nil
+	}
+
+	id, err := store.AddItem(ctx, feedID, &Item{Item: rss.Item{
+		Title:       item.Title,
+		Link:        item.Link,
+		Description: item.Description,
+		PubDate:     item.PublicationDate,
+	}})
+	if err != nil {
+		return -1, false, err
+	}
+	return id, true, nil
+}
+
+// truncateNote shortens a note to the longest we keep.
+func truncateNote(note string) string {
+	runes := []rune(strings.TrimSpace(note))
+	if len(runes) > MaxNoteLength {
+		return string(runes[:MaxNoteLength])
+	}
+	return string(runes)
+}
@@ -0,0 +1,82 @@
+package gorse
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseImport(t *testing.T) {
+	miniflux := `
+{"total": 3, "entries": [
+  {"id": 1, "status": "read", "title": "One", "url": "https://example.com/1",
+   "content": "<p>Hi</p>", "published_at": "2020-01-02T03:04:05Z",
+   "starred": false,
+   "feed": {"title": "Example", "feed_url": "https://example.com/feed"}},
+  {"id": 2, "status": "unread", "title": "Two", "url": "https://example.com/2",
+   "published_at": "2020-01-02T03:04:05Z", "starred": true,
+   "feed": {"title": "Example", "feed_url": "https://example.com/feed"}},
+  {"id": 3, "status": "removed", "title": "Three",
+   "url": "https://example.com/3", "published_at": "2020-01-02T03:04:05Z",
+   "feed": {"title": "Example", "feed_url": "https://example.com/feed"}}
+]}`
+
+	items, err := ParseImport(strings.NewReader(miniflux))
+	if err != nil {
+		t.Fatalf("ParseImport() Miniflux = error %s", err)
+	}
+	if len(items) != 2 ||
+		items[0].State != Read || items[0].Description != "<p>Hi</p>" ||
+		items[0].FeedURI != "https://example.com/feed" ||
+		!items[0].PublicationDate.Equal(
+			time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)) ||
+		items[1].State != ReadLater || items[1].Link != "https://example.com/2" {
+		t.Errorf("ParseImport() Miniflux = %+v", items)
+	}
+
+	ttrss := "\xef\xbb\xbf" + `<?xml version="1.0" encoding="utf-8"?>
+<articles schema-version="137">
+<article>
+<guid><![CDATA[{"ver":2,"uid":"1","hash":"SHA1:abc"}]]></guid>
+<title><![CDATA[One]]></title>
+<content><![CDATA[<p>Hi</p>]]></content>
+<marked>1</marked>
+<published>0</published>
+<score>0</score>
+<note><![CDATA[ Good ]]></note>
+<link><![CDATA[https://example.com/1]]></link>
+<tag_cache><![CDATA[]]></tag_cache>
+<label_cache><![CDATA[]]></label_cache>
+<feed_title><![CDATA[Example]]></feed_title>
+<feed_url><![CDATA[https://example.com/feed]]></feed_url>
+<updated><![CDATA[2020-01-02 03:04:05]]></updated>
+</article>
+<article>
+<title><![CDATA[Two]]></title>
+<marked>0</marked>
+<link><![CDATA[https://example.com/2]]></link>
+<feed_title><![CDATA[Example]]></feed_title>
+<feed_url><![CDATA[https://example.com/feed]]></feed_url>
+<updated><![CDATA[2020-01-02 03:04:05.123+01]]></updated>
+</article>
+</articles>`
+
+	items, err = ParseImport(strings.NewReader(ttrss))
+	if err != nil {
+		t.Fatalf("ParseImport() Tiny Tiny RSS = error %s", err)
+	}
+	if len(items) != 2 ||
+		items[0].State != ReadLater || items[0].Note != "Good" ||
+		items[0].Title != "One" || items[0].FeedName != "Example" ||
+		!items[0].PublicationDate.Equal(
+			time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)) ||
+		items[1].State != Read ||
+		!items[1].PublicationDate.Equal(
+			time.Date(2020, 1, 2, 2, 4, 5, 123000000, time.UTC)) {
+		t.Errorf("ParseImport() Tiny Tiny RSS = %+v", items)
+	}
+
+	if _, err := ParseImport(strings.NewReader("feeds")); err == nil {
+		t.Error("ParseImport() of something else succeeded")
+	}
+}
@@ -0,0 +1,2716 @@
+package gorse_test
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/horgh/gorse"
+	"github.com/horgh/gorse/internal/gorsetest"
+	"github.com/horgh/rss"
+)
+
+// TestStoreIntegration runs through what the poller and the web interface do
+// with a real database of each type.
+func TestStoreIntegration(t *testing.T) {
+	for _, dbType := range gorsetest.Types {
+		t.Run(dbType, func(t *testing.T) {
+			testStoreIntegration(t, dbType)
+		})
+	}
+}
+
+func testStoreIntegration(t *testing.T, dbType string) {
+	ctx := context.Background()
+	store, _ := gorsetest.Store(t, dbType)
+
+	now := time.Now()
+	loaded := gorsetest.Load(t, store, gorsetest.Fixture{
+		Users: []gorsetest.User{
+			{Email: "user@example.com", Password: "password"},
+		},
+		Feeds: []gorsetest.Feed{
+			{
+				DBFeed: gorse.DBFeed{
+					Name:                   "Polling",
+					URI:                    "https://example.com/polling",
+					UpdateFrequencySeconds: 3600,
+					Active:                 true,
+				},
+				Items: []rss.Item{
+					{
+						Title:       "Polling feeds",
+						Link:        "https://example.com/polling/1",
+						Description: "How we poll feeds",
+						PubDate:     now.Add(-2 * time.Hour),
+					},
+					{
+						Title:       "Archiving",
+						Link:        "https://example.com/polling/2",
+						Description: "How we archive items",
+						PubDate:     now.Add(-time.Hour),
+					},
+				},
+				Subscribers: []string{"user@example.com"},
+			},
+			{
+				DBFeed: gorse.DBFeed{
+					Name:                   "Other",
+					URI:                    "https://example.com/other",
+					UpdateFrequencySeconds: 3600,
+					Active:                 true,
+				},
+				Items: []rss.Item{
+					{
+						Title:   "Something else",
+						Link:    "https://example.com/other/1",
+						PubDate: now.Add(-40 * 24 * time.Hour),
+					},
+				},
+			},
+		},
+	})
+	userID := loaded.Users["user@example.com"]
+	pollingID := loaded.Feeds["https://example.com/polling"]
+	otherID := loaded.Feeds["https://example.com/other"]
+
+	feeds, err := store.ActiveFeeds(ctx)
+	if err != nil {
+		t.Fatalf("ActiveFeeds() = error %s", err)
+	}
+	if len(feeds) != 2 || feeds[0].ID != otherID || feeds[1].ID != pollingID {
+		t.Errorf("ActiveFeeds() = %+v, wanted Other then Polling", feeds)
+	}
+
+	newest, err := store.NewestItemTime(ctx, pollingID)
+	if err != nil {
+		t.Fatalf("NewestItemTime() = error %s", err)
+	}
+	if want := now.Add(-time.Hour); newest.Unix() != want.Unix() {
+		t.Errorf("NewestItemTime() = %s, wanted %s", newest, want)
+	}
+
+	unread := gorse.Unread
+	items, err := store.FindItems(ctx, gorse.ItemFilter{
+		UserID:     userID,
+		State:      &unread,
+		Subscribed: true,
+	})
+	if err != nil {
+		t.Fatalf("FindItems() = error %s", err)
+	}
+	if len(items) != 2 || items[0].Link != "https://example.com/polling/2" {
+		t.Errorf("FindItems() = %+v, wanted the subscribed feed's items newest "+
+			"first", items)
+	}
+
+	items, err = store.SearchItems(ctx, gorse.ItemFilter{
+		UserID: userID,
+		Search: "archive",
+	})
+	if err != nil {
+		t.Fatalf("SearchItems() = error %s", err)
+	}
+	if len(items) != 1 || items[0].Link != "https://example.com/polling/2" {
+		t.Errorf("SearchItems() = %+v, wanted the archiving item", items)
+	}
+
+	pollingItemID := loaded.Items["https://example.com/polling/1"]
+	if err := store.SetItemsReadState(ctx, []int64{pollingItemID}, userID,
+		gorse.Read); err != nil {
+		t.Fatalf("SetItemsReadState() = error %s", err)
+	}
+
+	counts, err := store.UnreadCounts(ctx, userID, now.AddDate(0, -1, 0))
+	if err != nil {
+		t.Fatalf("UnreadCounts() = error %s", err)
+	}
+	if len(counts) != 1 || counts[pollingID] != 1 {
+		t.Errorf("UnreadCounts() = %v, wanted 1 for feed %d", counts, pollingID)
+	}
+
+	count, err := store.CountItems(ctx, gorse.ItemFilter{
+		UserID: userID,
+		State:  &unread,
+	})
+	if err != nil {
+		t.Fatalf("CountItems() = error %s", err)
+	}
+	if count != 2 {
+		t.Errorf("CountItems() = %d, wanted 2", count)
+	}
+
+	item, err := store.GetItem(ctx, pollingItemID, userID)
+	if err != nil {
+		t.Fatalf("GetItem() = error %s", err)
+	}
+	if item.ReadState != gorse.Read {
+		t.Errorf("GetItem() state = %s, wanted %s", item.ReadState, gorse.Read)
+	}
+
+	if err := store.DeleteFeed(ctx, otherID, gorse.PurgeItems); err != nil {
+		t.Fatalf("DeleteFeed() = error %s", err)
+	}
+
+	count, err = store.CountItems(ctx, gorse.ItemFilter{
+		UserID: userID,
+		State:  &unread,
+	})
+	if err != nil {
+		t.Fatalf("CountItems() = error %s", err)
+	}
+	if count != 1 {
+		t.Errorf("CountItems() after deleting feed = %d, wanted 1", count)
+	}
+}
+
+func TestUsersIntegration(t *testing.T) {
+	for _, dbType := range gorsetest.Types {
+		t.Run(dbType, func(t *testing.T) {
+			testUsersIntegration(t, dbType)
+		})
+	}
+}
+
+// Adding and updating users fires the triggers on rss_user, such as the one
+// lowercasing email addresses.
+func testUsersIntegration(t *testing.T, dbType string) {
+	ctx := context.Background()
+	store, db := gorsetest.Store(t, dbType)
+
+	user, err := store.CreateUser(ctx, "User@Example.com", "password1", false)
+	if err != nil {
+		t.Fatalf("CreateUser() = error %s", err)
+	}
+	if user.Email != "user@example.com" {
+		t.Errorf("created user has email %s, wanted user@example.com",
+			user.Email)
+	}
+
+	if err := store.UpdatePassword(ctx, user.ID, "password2"); err != nil {
+		t.Fatalf("UpdatePassword() = error %s", err)
+	}
+	if _, err := store.AuthenticateUser(ctx, "user@example.com",
+		"password2"); err != nil {
+		t.Errorf("AuthenticateUser() with the new password = error %s", err)
+	}
+
+	if err := store.UpdateLocale(ctx, user.ID, "fr", true); err != nil {
+		t.Fatalf("UpdateLocale() = error %s", err)
+	}
+
+	// Only the triggers lowercase an email address we set directly.
+	if _, err := db.ExecContext(ctx, `UPDATE rss_user SET email = $1
+WHERE id = $2`, "Other@Example.COM", user.ID); err != nil {
+		t.Fatalf("updating email = error %s", err)
+	}
+	if _, err := db.ExecContext(ctx, `INSERT INTO rss_user (email)
+VALUES ($1)`, "Third@Example.com"); err != nil {
+		t.Fatalf("adding user = error %s", err)
+	}
+
+	got, err := store.GetUser(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("GetUser() = error %s", err)
+	}
+	if got.Email != "other@example.com" || got.Locale != "fr" ||
+		!got.RelativeDates {
+		t.Errorf("GetUser() = %s %s %t, wanted other@example.com fr true",
+			got.Email, got.Locale, got.RelativeDates)
+	}
+
+	var count int
+	if err := db.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM rss_user WHERE email = $1`,
+		"third@example.com").Scan(&count); err != nil {
+		t.Fatalf("counting users = error %s", err)
+	}
+	if count != 1 {
+		t.Errorf("found %d users with email third@example.com, wanted 1", count)
+	}
+}
+
+func TestUpsertItemIntegration(t *testing.T) {
+	for _, dbType := range gorsetest.Types {
+		t.Run(dbType, func(t *testing.T) {
+			testUpsertItemIntegration(t, dbType)
+		})
+	}
+}
+
+func testUpsertItemIntegration(t *testing.T, dbType string) {
+	ctx := context.Background()
+	store, _ := gorsetest.Store(t, dbType)
+
+	pubDate := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	loaded := gorsetest.Load(t, store, gorsetest.Fixture{
+		Users: []gorsetest.User{
+			{Email: "user@example.com", Password: "password"},
+		},
+		Feeds: []gorsetest.Feed{
+			{
+				DBFeed: gorse.DBFeed{
+					Name:                   "Example",
+					URI:                    "https://example.com/feed",
+					UpdateFrequencySeconds: 3600,
+					Active:                 true,
+				},
+				Items: []rss.Item{
+					{
+						Title:   "By link",
+						Link:    "https://example.com/1",
+						PubDate: pubDate,
+					},
+					{
+						Title:   "By GUID",
+						Link:    "https://example.com/2",
+						GUID:    "2",
+						PubDate: pubDate,
+					},
+				},
+			},
+		},
+	})
+	userID := loaded.Users["user@example.com"]
+	feedID := loaded.Feeds["https://example.com/feed"]
+
+	tests := []struct {
+		Name       string
+		Item       rss.Item
+		WantID     int64
+		WantResult gorse.UpsertResult
+	}{
+		{
+			Name: "unchanged",
+			Item: rss.Item{Title: "By link", Link: "https://example.com/1",
+				PubDate: time.Now()},
+			WantID:     loaded.Items["https://example.com/1"],
+			WantResult: gorse.ItemUnchanged,
+		},
+		{
+			Name: "new title",
+			Item: rss.Item{Title: "By link, edited", Link: "https://example.com/1",
+				PubDate: time.Now()},
+			WantID:     loaded.Items["https://example.com/1"],
+			WantResult: gorse.ItemModified,
+		},
+		{
+			Name: "gained a GUID",
+			Item: rss.Item{Title: "By link, edited", Link: "https://example.com/1",
+				GUID: "1", PubDate: time.Now()},
+			WantID:     loaded.Items["https://example.com/1"],
+			WantResult: gorse.ItemModified,
+		},
+		{
+			Name: "new link",
+			Item: rss.Item{Title: "By GUID", Link: "https://example.com/2b",
+				GUID: "2", PubDate: time.Now()},
+			WantID:     loaded.Items["https://example.com/2"],
+			WantResult: gorse.ItemModified,
+		},
+		{
+			Name: "new",
+			Item: rss.Item{Title: "New", Link: "https://example.com/3",
+				GUID: "3", PubDate: time.Now()},
+			WantResult: gorse.ItemCreated,
+		},
+	}
+
+	for _, test := range tests {
+		id, result, err := store.UpsertItem(ctx, feedID,
+			&gorse.Item{Item: test.Item})
+		if err != nil {
+			t.Errorf("%s: UpsertItem() = error %s", test.Name, err)
+			continue
+		}
+		if result != test.WantResult {
+			t.Errorf("%s: UpsertItem() = %s, wanted %s", test.Name, result,
+				test.WantResult)
+		}
+		if test.WantID != 0 && id != test.WantID {
+			t.Errorf("%s: UpsertItem() = item ID %d, wanted %d", test.Name, id,
+				test.WantID)
+		}
+
+		item, err := store.GetItem(ctx, id, userID)
+		if err != nil {
+			t.Errorf("%s: GetItem() = error %s", test.Name, err)
+			continue
+		}
+		if item.Title != test.Item.Title || item.Link != test.Item.Link {
+			t.Errorf("%s: item = %+v, wanted it to match %+v", test.Name, item,
+				test.Item)
+		}
+		if test.WantResult != gorse.ItemCreated &&
+			!item.PublicationDate.Equal(pubDate) {
+			t.Errorf("%s: publication date = %s, wanted %s unchanged", test.Name,
+				item.PublicationDate, pubDate)
+		}
+	}
+
+	// Search sees the new title.
+	items, err := store.SearchItems(ctx, gorse.ItemFilter{
+		UserID: userID,
+		Search: "edited",
+	})
+	if err != nil {
+		t.Fatalf("SearchItems() = error %s", err)
+	}
+	if len(items) != 1 || items[0].ID != loaded.Items["https://example.com/1"] {
+		t.Errorf("SearchItems() = %+v, wanted the edited item", items)
+	}
+
+	unread := gorse.Unread
+	count, err := store.CountItems(ctx, gorse.ItemFilter{
+		UserID: userID,
+		State:  &unread,
+	})
+	if err != nil {
+		t.Fatalf("CountItems() = error %s", err)
+	}
+	if count != 3 {
+		t.Errorf("CountItems() = %d, wanted 3", count)
+	}
+}
+
+func TestSaveLinkIntegration(t *testing.T) {
+	for _, dbType := range gorsetest.Types {
+		t.Run(dbType, func(t *testing.T) {
+			testSaveLinkIntegration(t, dbType)
+		})
+	}
+}
+
+func testSaveLinkIntegration(t *testing.T, dbType string) {
+	ctx := context.Background()
+	store, _ := gorsetest.Store(t, dbType)
+
+	loaded := gorsetest.Load(t, store, gorsetest.Fixture{
+		Users: []gorsetest.User{
+			{Email: "saver@example.com", Password: "password"},
+			{Email: "other@example.com", Password: "password"},
+		},
+	})
+	saverID := loaded.Users["saver@example.com"]
+	otherID := loaded.Users["other@example.com"]
+
+	link := gorse.SavedLink{URL: "https://example.com/article", Title: "Article"}
+	var id int64
+	for i := 0; i < 2; i++ {
+		if err := store.InTx(ctx, func(store gorse.Store) error {
+			var err error
+			id, err = gorse.SaveLink(ctx, store, saverID, link)
+			return err
+		}); err != nil {
+			t.Fatalf("SaveLink() = error %s", err)
+		}
+	}
+
+	readLater := gorse.ReadLater
+	items, err := store.FindItems(ctx, gorse.ItemFilter{
+		UserID: saverID,
+		State:  &readLater,
+		Limit:  10,
+	})
+	if err != nil {
+		t.Fatalf("FindItems() = error %s", err)
+	}
+	if len(items) != 1 || items[0].ID != id || items[0].Title != "Article" {
+		t.Errorf("FindItems() = %+v, wanted the saved link once", items)
+	}
+
+	// Only the user who saved it sees it.
+	unread := gorse.Unread
+	for _, state := range []*gorse.ReadState{&unread, &readLater} {
+		count, err := store.CountItems(ctx, gorse.ItemFilter{
+			UserID: otherID,
+			State:  state,
+		})
+		if err != nil {
+			t.Fatalf("CountItems() = error %s", err)
+		}
+		if count != 0 {
+			t.Errorf("CountItems(%s) for another user = %d, wanted 0", state, count)
+		}
+	}
+
+	if err := store.InTx(ctx, func(store gorse.Store) error {
+		_, err := gorse.SaveLink(ctx, store, saverID,
+			gorse.SavedLink{URL: "javascript:alert(1)"})
+		return err
+	}); err == nil {
+		t.Error("SaveLink() with a javascript URL succeeded")
+	}
+}
+
+func TestUserIntegrationsIntegration(t *testing.T) {
+	for _, dbType := range gorsetest.Types {
+		t.Run(dbType, func(t *testing.T) {
+			testUserIntegrationsIntegration(t, dbType)
+		})
+	}
+}
+
+func testUserIntegrationsIntegration(t *testing.T, dbType string) {
+	ctx := context.Background()
+	store, _ := gorsetest.Store(t, dbType)
+
+	loaded := gorsetest.Load(t, store, gorsetest.Fixture{
+		Users: []gorsetest.User{
+			{Email: "user@example.com", Password: "password"},
+		},
+	})
+	userID := loaded.Users["user@example.com"]
+
+	if _, err := store.GetIntegration(ctx, userID,
+		"pocket"); err != gorse.ErrNotFound {
+		t.Fatalf("GetIntegration() before setting = error %v, wanted %s", err,
+			gorse.ErrNotFound)
+	}
+
+	wallabag := gorse.Integration{
+		UserID:       userID,
+		Service:      "wallabag",
+		URL:          "https://wallabag.example.com",
+		ClientID:     "id",
+		ClientSecret: "secret",
+		Username:     "user",
+		Password:     "password",
+	}
+	pocket := gorse.Integration{
+		UserID:      userID,
+		Service:     "pocket",
+		ClientID:    "key",
+		AccessToken: "old",
+	}
+	for _, integration := range []gorse.Integration{wallabag, pocket} {
+		if err := store.SetIntegration(ctx, integration); err != nil {
+			t.Fatalf("SetIntegration() = error %s", err)
+		}
+	}
+
+	// Setting it again replaces it.
+	pocket.AccessToken = "new"
+	pocket.MarkRead = true
+	if err := store.SetIntegration(ctx, pocket); err != nil {
+		t.Fatalf("SetIntegration() = error %s", err)
+	}
+
+	got, err := store.GetIntegration(ctx, userID, "pocket")
+	if err != nil {
+		t.Fatalf("GetIntegration() = error %s", err)
+	}
+	if *got != pocket {
+		t.Errorf("GetIntegration() = %+v, wanted %+v", *got, pocket)
+	}
+
+	integrations, err := store.ListIntegrations(ctx, userID)
+	if err != nil {
+		t.Fatalf("ListIntegrations() = error %s", err)
+	}
+	if len(integrations) != 2 || integrations[0] != pocket ||
+		integrations[1] != wallabag {
+		t.Errorf("ListIntegrations() = %+v, wanted pocket then wallabag",
+			integrations)
+	}
+
+	if err := store.DeleteIntegration(ctx, userID, "pocket"); err != nil {
+		t.Fatalf("DeleteIntegration() = error %s", err)
+	}
+	if err := store.DeleteIntegration(ctx, userID,
+		"pocket"); err != gorse.ErrNotFound {
+		t.Errorf("DeleteIntegration() again = error %v, wanted %s", err,
+			gorse.ErrNotFound)
+	}
+}
+
+func TestReaderViewIntegration(t *testing.T) {
+	for _, dbType := range gorsetest.Types {
+		t.Run(dbType, func(t *testing.T) {
+			testReaderViewIntegration(t, dbType)
+		})
+	}
+}
+
+func testReaderViewIntegration(t *testing.T, dbType string) {
+	ctx := context.Background()
+	store, _ := gorsetest.Store(t, dbType)
+
+	loaded := gorsetest.Load(t, store, gorsetest.Fixture{
+		Feeds: []gorsetest.Feed{
+			{
+				DBFeed: gorse.DBFeed{
+					Name:                   "Example",
+					URI:                    "https://example.com/feed",
+					UpdateFrequencySeconds: 3600,
+					Active:                 true,
+				},
+				Items: []rss.Item{
+					{Title: "One", Link: "https://example.com/1", PubDate: time.Now()},
+				},
+			},
+		},
+	})
+	itemID := loaded.Items["https://example.com/1"]
+
+	if _, err := store.GetReaderView(ctx, itemID); err != gorse.ErrNotFound {
+		t.Fatalf("GetReaderView() before setting = error %v, wanted %s", err,
+			gorse.ErrNotFound)
+	}
+
+	view := gorse.ReaderView{
+		ItemID:    itemID,
+		Title:     "Old",
+		Content:   "<p>Old</p>",
+		FetchTime: time.Date(2020, 3, 1, 14, 5, 0, 0, time.UTC),
+	}
+	if err := store.SetReaderView(ctx, view); err != nil {
+		t.Fatalf("SetReaderView() = error %s", err)
+	}
+
+	// Setting it again replaces it.
+	view.Title = "New"
+	view.Content = "<p>New</p>"
+	view.FetchTime = view.FetchTime.Add(time.Hour)
+	if err := store.SetReaderView(ctx, view); err != nil {
+		t.Fatalf("SetReaderView() = error %s", err)
+	}
+
+	got, err := store.GetReaderView(ctx, itemID)
+	if err != nil {
+		t.Fatalf("GetReaderView() = error %s", err)
+	}
+	if got.Title != view.Title || got.Content != view.Content ||
+		!got.FetchTime.Equal(view.FetchTime) {
+		t.Errorf("GetReaderView() = %+v, wanted %+v", *got, view)
+	}
+}
+
+func TestNotifiersIntegration(t *testing.T) {
+	for _, dbType := range gorsetest.Types {
+		t.Run(dbType, func(t *testing.T) {
+			testNotifiersIntegration(t, dbType)
+		})
+	}
+}
+
+func testNotifiersIntegration(t *testing.T, dbType string) {
+	ctx := context.Background()
+	store, _ := gorsetest.Store(t, dbType)
+
+	feed := func(name string, subscribers ...string) gorsetest.Feed {
+		return gorsetest.Feed{
+			DBFeed: gorse.DBFeed{
+				Name:                   name,
+				URI:                    "https://example.com/" + name,
+				UpdateFrequencySeconds: 3600,
+				Active:                 true,
+			},
+			Subscribers: subscribers,
+		}
+	}
+	loaded := gorsetest.Load(t, store, gorsetest.Fixture{
+		Users: []gorsetest.User{
+			{Email: "one@example.com", Password: "password"},
+			{Email: "two@example.com", Password: "password"},
+		},
+		Feeds: []gorsetest.Feed{
+			feed("a", "one@example.com"),
+			feed("b", "two@example.com"),
+		},
+	})
+	oneID := loaded.Users["one@example.com"]
+	twoID := loaded.Users["two@example.com"]
+	a, err := store.GetFeedByURI(ctx, "https://example.com/a")
+	if err != nil {
+		t.Fatalf("GetFeedByURI() = error %s", err)
+	}
+	b, err := store.GetFeedByURI(ctx, "https://example.com/b")
+	if err != nil {
+		t.Fatalf("GetFeedByURI() = error %s", err)
+	}
+
+	// One user hears about any of their feeds, the other about a feed they
+	// don't subscribe to.
+	anyFeed := gorse.Notifier{UserID: oneID, Service: "slack",
+		URL: "https://hooks.example.com/1"}
+	feedA := gorse.Notifier{UserID: twoID, FeedID: a.ID, Match: "fish",
+		Service: "telegram", Token: "t", ChatID: "c"}
+	for _, n := range []*gorse.Notifier{&anyFeed, &feedA} {
+		if n.ID, err = store.AddNotifier(ctx, *n); err != nil {
+			t.Fatalf("AddNotifier() = error %s", err)
+		}
+	}
+
+	notifiers, err := store.FeedNotifiers(ctx, a.ID)
+	if err != nil {
+		t.Fatalf("FeedNotifiers() = error %s", err)
+	}
+	if len(notifiers) != 2 || notifiers[0] != anyFeed ||
+		notifiers[1] != feedA {
+		t.Errorf("FeedNotifiers(a) = %+v, wanted both", notifiers)
+	}
+
+	notifiers, err = store.FeedNotifiers(ctx, b.ID)
+	if err != nil {
+		t.Fatalf("FeedNotifiers() = error %s", err)
+	}
+	if len(notifiers) != 0 {
+		t.Errorf("FeedNotifiers(b) = %+v, wanted none", notifiers)
+	}
+
+	if err := store.DeleteNotifier(ctx, oneID,
+		feedA.ID); err != gorse.ErrNotFound {
+		t.Errorf("DeleteNotifier() of another user's = error %v, wanted %s", err,
+			gorse.ErrNotFound)
+	}
+	if err := store.DeleteNotifier(ctx, twoID, feedA.ID); err != nil {
+		t.Fatalf("DeleteNotifier() = error %s", err)
+	}
+
+	notifiers, err = store.ListNotifiers(ctx, twoID)
+	if err != nil {
+		t.Fatalf("ListNotifiers() = error %s", err)
+	}
+	if len(notifiers) != 0 {
+		t.Errorf("ListNotifiers() after deleting = %+v, wanted none", notifiers)
+	}
+}
+
+func TestSharedItemsIntegration(t *testing.T) {
+	for _, dbType := range gorsetest.Types {
+		t.Run(dbType, func(t *testing.T) {
+			testSharedItemsIntegration(t, dbType)
+		})
+	}
+}
+
+func testSharedItemsIntegration(t *testing.T, dbType string) {
+	ctx := context.Background()
+	store, _ := gorsetest.Store(t, dbType)
+
+	loaded := gorsetest.Load(t, store, gorsetest.Fixture{
+		Users: []gorsetest.User{
+			{Email: "user@example.com", Password: "password"},
+		},
+		Feeds: []gorsetest.Feed{
+			{
+				DBFeed: gorse.DBFeed{
+					Name:                   "Example",
+					URI:                    "https://example.com/feed",
+					UpdateFrequencySeconds: 3600,
+					Active:                 true,
+				},
+				Items: []rss.Item{
+					{Title: "One", Link: "https://example.com/1", PubDate: time.Now()},
+					{Title: "Two", Link: "https://example.com/2", PubDate: time.Now()},
+					{Title: "Three", Link: "https://example.com/3",
+						PubDate: time.Now()},
+				},
+				Subscribers: []string{"user@example.com"},
+			},
+		},
+	})
+	userID := loaded.Users["user@example.com"]
+	one := loaded.Items["https://example.com/1"]
+	two := loaded.Items["https://example.com/2"]
+
+	if _, err := store.UserByShareToken(ctx, "token"); err != gorse.ErrNotFound {
+		t.Errorf("UserByShareToken() before sharing = error %v, wanted %s", err,
+			gorse.ErrNotFound)
+	}
+	if err := store.SetShareToken(ctx, userID, "token"); err != nil {
+		t.Fatalf("SetShareToken() = error %s", err)
+	}
+	user, err := store.UserByShareToken(ctx, "token")
+	if err != nil {
+		t.Fatalf("UserByShareToken() = error %s", err)
+	}
+	if user.ID != userID || user.ShareToken != "token" {
+		t.Errorf("UserByShareToken() = %+v, wanted the user", user)
+	}
+
+	// Only starred items are shared, not those saved to read later.
+	for _, id := range []int64{one, two} {
+		if err := store.SetItemStarred(ctx, id, userID, true); err != nil {
+			t.Fatalf("SetItemStarred() = error %s", err)
+		}
+	}
+	three := loaded.Items["https://example.com/3"]
+	if err := store.SetItemsReadState(ctx, []int64{three}, userID,
+		gorse.ReadLater); err != nil {
+		t.Fatalf("SetItemsReadState() = error %s", err)
+	}
+	if err := store.SetItemShared(ctx, two, userID, false); err != nil {
+		t.Fatalf("SetItemShared() = error %s", err)
+	}
+	if err := store.SetItemShared(ctx, three, userID,
+		false); err != gorse.ErrNotFound {
+		t.Errorf("SetItemShared() of an item not starred = error %v, wanted %s",
+			err, gorse.ErrNotFound)
+	}
+
+	items, err := store.SharedItems(ctx, userID, 10)
+	if err != nil {
+		t.Fatalf("SharedItems() = error %s", err)
+	}
+	if len(items) != 1 || items[0].ID != one {
+		t.Errorf("SharedItems() = %+v, wanted item One", items)
+	}
+
+	item, err := store.GetItem(ctx, two, userID)
+	if err != nil {
+		t.Fatalf("GetItem() = error %s", err)
+	}
+	if !item.Unshared {
+		t.Errorf("GetItem() = %+v, wanted it unshared", item)
+	}
+
+	if err := store.SetShareToken(ctx, userID, ""); err != nil {
+		t.Fatalf("SetShareToken() = error %s", err)
+	}
+	if _, err := store.UserByShareToken(ctx, "token"); err != gorse.ErrNotFound {
+		t.Errorf("UserByShareToken() after stopping = error %v, wanted %s", err,
+			gorse.ErrNotFound)
+	}
+}
+
+func TestReadingPositionIntegration(t *testing.T) {
+	for _, dbType := range gorsetest.Types {
+		t.Run(dbType, func(t *testing.T) {
+			testReadingPositionIntegration(t, dbType)
+		})
+	}
+}
+
+func testReadingPositionIntegration(t *testing.T, dbType string) {
+	ctx := context.Background()
+	store, _ := gorsetest.Store(t, dbType)
+
+	loaded := gorsetest.Load(t, store, gorsetest.Fixture{
+		Users: []gorsetest.User{
+			{Email: "user@example.com", Password: "password"},
+		},
+		Feeds: []gorsetest.Feed{
+			{
+				DBFeed: gorse.DBFeed{
+					Name:                   "Example",
+					URI:                    "https://example.com/feed",
+					UpdateFrequencySeconds: 3600,
+					Active:                 true,
+				},
+				Items: []rss.Item{
+					{Title: "One", Link: "https://example.com/1", PubDate: time.Now()},
+					{Title: "Two", Link: "https://example.com/2", PubDate: time.Now()},
+				},
+				Subscribers: []string{"user@example.com"},
+			},
+		},
+	})
+	userID := loaded.Users["user@example.com"]
+
+	if _, err := store.GetReadingPosition(ctx, userID,
+		"unread"); err != gorse.ErrNotFound {
+		t.Errorf("GetReadingPosition() before setting = error %v, wanted %s",
+			err, gorse.ErrNotFound)
+	}
+
+	// Setting again replaces where the user was.
+	updateTime := time.Date(2020, 3, 1, 14, 5, 0, 0, time.UTC)
+	for _, link := range []string{"https://example.com/1",
+		"https://example.com/2"} {
+		if err := store.SetReadingPosition(ctx, gorse.ReadingPosition{
+			UserID:     userID,
+			View:       "unread",
+			ItemID:     loaded.Items[link],
+			Offset:     40,
+			UpdateTime: updateTime,
+		}); err != nil {
+			t.Fatalf("SetReadingPosition() = error %s", err)
+		}
+	}
+
+	position, err := store.GetReadingPosition(ctx, userID, "unread")
+	if err != nil {
+		t.Fatalf("GetReadingPosition() = error %s", err)
+	}
+	if position.ItemID != loaded.Items["https://example.com/2"] ||
+		position.Offset != 40 || !position.UpdateTime.Equal(updateTime) {
+		t.Errorf("GetReadingPosition() = %+v, wanted item Two", position)
+	}
+
+	// Views are separate.
+	if _, err := store.GetReadingPosition(ctx, userID,
+		"read-later"); err != gorse.ErrNotFound {
+		t.Errorf("GetReadingPosition() of another view = error %v, wanted %s",
+			err, gorse.ErrNotFound)
+	}
+
+	if err := store.SetReadingPosition(ctx, gorse.ReadingPosition{
+		UserID: userID,
+		View:   "unread",
+		ItemID: position.ItemID,
+		Offset: -1,
+	}); err == nil {
+		t.Error("SetReadingPosition() with a negative offset succeeded")
+	}
+}
+
+func TestRelatedItemsIntegration(t *testing.T) {
+	for _, dbType := range gorsetest.Types {
+		t.Run(dbType, func(t *testing.T) {
+			testRelatedItemsIntegration(t, dbType)
+		})
+	}
+}
+
+func testRelatedItemsIntegration(t *testing.T, dbType string) {
+	ctx := context.Background()
+	store, _ := gorsetest.Store(t, dbType)
+
+	loaded := gorsetest.Load(t, store, gorsetest.Fixture{
+		Users: []gorsetest.User{
+			{Email: "user@example.com", Password: "password"},
+		},
+		Feeds: []gorsetest.Feed{
+			{
+				DBFeed: gorse.DBFeed{
+					Name:                   "Local",
+					URI:                    "https://local.example.com/feed",
+					UpdateFrequencySeconds: 3600,
+					Active:                 true,
+				},
+				Items: []rss.Item{
+					{Title: "Storm hits the coast",
+						Link: "https://local.example.com/1", PubDate: time.Now()},
+					{Title: "Bake sale", Link: "https://local.example.com/2",
+						PubDate: time.Now()},
+				},
+				Subscribers: []string{"user@example.com"},
+			},
+			{
+				DBFeed: gorse.DBFeed{
+					Name:                   "National",
+					URI:                    "https://national.example.com/feed",
+					UpdateFrequencySeconds: 3600,
+					Active:                 true,
+				},
+				Items: []rss.Item{
+					{Title: "Towns clean up after storms",
+						Link:    "https://national.example.com/cleanup",
+						PubDate: time.Now()},
+				},
+				Subscribers: []string{"user@example.com"},
+			},
+			{
+				DBFeed: gorse.DBFeed{
+					Name:                   "Unsubscribed",
+					URI:                    "https://other.example.com/feed",
+					UpdateFrequencySeconds: 3600,
+					Active:                 true,
+				},
+				Items: []rss.Item{
+					{Title: "Coast storm", Link: "https://other.example.com/1",
+						PubDate: time.Now()},
+				},
+			},
+		},
+	})
+	userID := loaded.Users["user@example.com"]
+	storm := loaded.Items["https://national.example.com/cleanup"]
+
+	// Read items are related too. Words match other forms of themselves.
+	if err := store.SetItemsReadState(ctx, []int64{storm}, userID,
+		gorse.Read); err != nil {
+		t.Fatalf("SetItemsReadState() = error %s", err)
+	}
+
+	item, err := store.GetItem(ctx, loaded.Items["https://local.example.com/1"],
+		userID)
+	if err != nil {
+		t.Fatalf("GetItem() = error %s", err)
+	}
+
+	items, err := store.RelatedItems(ctx, *item, userID, 10)
+	if err != nil {
+		t.Fatalf("RelatedItems() = error %s", err)
+	}
+	if len(items) != 1 || items[0].ID != storm ||
+		items[0].ReadState != gorse.Read {
+		t.Errorf("RelatedItems() = %+v, wanted the other story about the storm",
+			items)
+	}
+}
+
+func TestFeedDisplayIntegration(t *testing.T) {
+	for _, dbType := range gorsetest.Types {
+		t.Run(dbType, func(t *testing.T) {
+			testFeedDisplayIntegration(t, dbType)
+		})
+	}
+}
+
+func testFeedDisplayIntegration(t *testing.T, dbType string) {
+	ctx := context.Background()
+	store, _ := gorsetest.Store(t, dbType)
+
+	loaded := gorsetest.Load(t, store, gorsetest.Fixture{
+		Users: []gorsetest.User{
+			{Email: "user@example.com", Password: "password"},
+		},
+		Feeds: []gorsetest.Feed{
+			{
+				DBFeed: gorse.DBFeed{
+					Name:                   "Headlines",
+					URI:                    "https://headlines.example.com/feed",
+					UpdateFrequencySeconds: 3600,
+					Active:                 true,
+				},
+				Subscribers: []string{"user@example.com"},
+			},
+			{
+				DBFeed: gorse.DBFeed{
+					Name:                   "Essays",
+					URI:                    "https://essays.example.com/feed",
+					UpdateFrequencySeconds: 3600,
+					Active:                 true,
+				},
+			},
+		},
+	})
+	userID := loaded.Users["user@example.com"]
+	headlines := loaded.Feeds["https://headlines.example.com/feed"]
+
+	modes, err := store.FeedDisplayModes(ctx, userID)
+	if err != nil {
+		t.Fatalf("FeedDisplayModes() = error %s", err)
+	}
+	if len(modes) != 0 {
+		t.Errorf("FeedDisplayModes() = %v, wanted feeds in full", modes)
+	}
+
+	if err := store.SetFeedDisplay(ctx, userID, headlines,
+		gorse.DisplayTitle); err != nil {
+		t.Fatalf("SetFeedDisplay() = error %s", err)
+	}
+	if err := store.SetFeedDisplay(ctx, userID,
+		loaded.Feeds["https://essays.example.com/feed"],
+		gorse.DisplaySummary); err != gorse.ErrNotFound {
+		t.Errorf("SetFeedDisplay() of a feed the user doesn't subscribe to = "+
+			"error %v, wanted %s", err, gorse.ErrNotFound)
+	}
+
+	modes, err = store.FeedDisplayModes(ctx, userID)
+	if err != nil {
+		t.Fatalf("FeedDisplayModes() = error %s", err)
+	}
+	if len(modes) != 1 || modes[headlines] != gorse.DisplayTitle {
+		t.Errorf("FeedDisplayModes() = %v, wanted only headlines' titles", modes)
+	}
+}
+
+func TestMutedKeywordsIntegration(t *testing.T) {
+	for _, dbType := range gorsetest.Types {
+		t.Run(dbType, func(t *testing.T) {
+			testMutedKeywordsIntegration(t, dbType)
+		})
+	}
+}
+
+func testMutedKeywordsIntegration(t *testing.T, dbType string) {
+	ctx := context.Background()
+	store, _ := gorsetest.Store(t, dbType)
+
+	now := time.Now()
+	loaded := gorsetest.Load(t, store, gorsetest.Fixture{
+		Users: []gorsetest.User{
+			{Email: "hider@example.com", Password: "password"},
+			{Email: "reader@example.com", Password: "password"},
+		},
+		Feeds: []gorsetest.Feed{
+			{
+				DBFeed: gorse.DBFeed{
+					Name:                   "News",
+					URI:                    "https://news.example.com/feed",
+					UpdateFrequencySeconds: 3600,
+					Active:                 true,
+				},
+				Items: []rss.Item{
+					{
+						Title:       "Election results are in",
+						Link:        "https://news.example.com/1",
+						Description: "Who won",
+						PubDate:     now.Add(-2 * time.Hour),
+					},
+					{
+						Title:       "Bake sale",
+						Link:        "https://news.example.com/2",
+						Description: "Cakes for the ELECTION fund",
+						PubDate:     now.Add(-time.Hour),
+					},
+					{
+						Title:       "New library opens",
+						Link:        "https://news.example.com/3",
+						Description: "Books",
+						PubDate:     now.Add(-time.Hour),
+					},
+				},
+				Subscribers: []string{"hider@example.com", "reader@example.com"},
+			},
+		},
+	})
+	hider := loaded.Users["hider@example.com"]
+	reader := loaded.Users["reader@example.com"]
+
+	if err := store.MuteKeyword(ctx, hider, "  Election ", false,
+		false); err != nil {
+		t.Fatalf("MuteKeyword() = error %s", err)
+	}
+	if err := store.MuteKeyword(ctx, reader, "Storm warning", false,
+		true); err != nil {
+		t.Fatalf("MuteKeyword() = error %s", err)
+	}
+	if err := store.MuteKeyword(ctx, reader, "", false, true); err == nil {
+		t.Errorf("MuteKeyword() of a blank phrase succeeded")
+	}
+
+	mutes, err := store.ListMutedKeywords(ctx, hider)
+	if err != nil {
+		t.Fatalf("ListMutedKeywords() = error %s", err)
+	}
+	if len(mutes) != 1 || mutes[0].Phrase != "election" || mutes[0].MarkRead {
+		t.Errorf("ListMutedKeywords() = %+v, wanted election hidden", mutes)
+	}
+
+	unread := gorse.Unread
+	filter := gorse.ItemFilter{UserID: hider, State: &unread, HideMuted: true}
+	items, err := store.FindItems(ctx, filter)
+	if err != nil {
+		t.Fatalf("FindItems() = error %s", err)
+	}
+	if len(items) != 1 || items[0].Link != "https://news.example.com/3" {
+		t.Errorf("FindItems() = %+v, wanted only the item without the phrase",
+			items)
+	}
+	count, err := store.CountItems(ctx, filter)
+	if err != nil {
+		t.Fatalf("CountItems() = error %s", err)
+	}
+	if count != 1 {
+		t.Errorf("CountItems() = %d, wanted 1", count)
+	}
+
+	// New items with a phrase the user has us mark read arrive read for them
+	// and only them.
+	id, err := store.AddItem(ctx, loaded.Feeds["https://news.example.com/feed"],
+		&gorse.Item{Item: rss.Item{
+			Title:       "STORM WARNING for the coast",
+			Link:        "https://news.example.com/4",
+			Description: "Wind",
+			PubDate:     now,
+		}})
+	if err != nil {
+		t.Fatalf("AddItem() = error %s", err)
+	}
+	for userID, want := range map[int]gorse.ReadState{
+		reader: gorse.Read,
+		hider:  gorse.Unread,
+	} {
+		item, err := store.GetItem(ctx, id, userID)
+		if err != nil {
+			t.Fatalf("GetItem() = error %s", err)
+		}
+		if item.ReadState != want {
+			t.Errorf("user %d has item in state %s, wanted %s", userID,
+				item.ReadState, want)
+		}
+	}
+	count, err = store.CountItems(ctx, gorse.ItemFilter{UserID: reader,
+		State: &unread})
+	if err != nil {
+		t.Fatalf("CountItems() = error %s", err)
+	}
+	if count != 3 {
+		t.Errorf("CountItems() = %d, wanted 3 without the item we marked read",
+			count)
+	}
+
+	// Regular expressions keep their case, and new items matching them arrive
+	// read whether or not we're asked to.
+	if err := store.MuteKeyword(ctx, hider, `^\S+ SALE\b`, true,
+		false); err != nil {
+		t.Fatalf("MuteKeyword() = error %s", err)
+	}
+	if err := store.MuteKeyword(ctx, hider, "(", true, true); err == nil {
+		t.Errorf("MuteKeyword() of an invalid regular expression succeeded")
+	}
+	mutes, err = store.ListMutedKeywords(ctx, hider)
+	if err != nil {
+		t.Fatalf("ListMutedKeywords() = error %s", err)
+	}
+	var regexps []gorse.MutedKeyword
+	for _, m := range mutes {
+		if m.Regexp {
+			regexps = append(regexps, m)
+		}
+	}
+	if len(regexps) != 1 || regexps[0].Phrase != `^\S+ SALE\b` ||
+		!regexps[0].MarkRead {
+		t.Fatalf("ListMutedKeywords() = %+v, wanted the regular expression",
+			mutes)
+	}
+	id, err = store.AddItem(ctx, loaded.Feeds["https://news.example.com/feed"],
+		&gorse.Item{Item: rss.Item{
+			Title:   "Garage sale today",
+			Link:    "https://news.example.com/5",
+			PubDate: now,
+		}})
+	if err != nil {
+		t.Fatalf("AddItem() = error %s", err)
+	}
+	for userID, want := range map[int]gorse.ReadState{
+		hider:  gorse.Read,
+		reader: gorse.Unread,
+	} {
+		item, err := store.GetItem(ctx, id, userID)
+		if err != nil {
+			t.Fatalf("GetItem() = error %s", err)
+		}
+		if item.ReadState != want {
+			t.Errorf("user %d has item in state %s, wanted %s", userID,
+				item.ReadState, want)
+		}
+	}
+	if err := store.UnmuteKeyword(ctx, hider, ` ^\S+ SALE\b `); err != nil {
+		t.Fatalf("UnmuteKeyword() of the regular expression = error %s", err)
+	}
+
+	if err := store.UnmuteKeyword(ctx, hider, "ELECTION"); err != nil {
+		t.Fatalf("UnmuteKeyword() = error %s", err)
+	}
+	if err := store.UnmuteKeyword(ctx, hider,
+		"election"); err != gorse.ErrNotFound {
+		t.Errorf("UnmuteKeyword() of a phrase not muted = error %v, wanted %s",
+			err, gorse.ErrNotFound)
+	}
+}
+
+func TestHighlightsIntegration(t *testing.T) {
+	for _, dbType := range gorsetest.Types {
+		t.Run(dbType, func(t *testing.T) {
+			testHighlightsIntegration(t, dbType)
+		})
+	}
+}
+
+func testHighlightsIntegration(t *testing.T, dbType string) {
+	ctx := context.Background()
+	store, _ := gorsetest.Store(t, dbType)
+
+	now := time.Now()
+	loaded := gorsetest.Load(t, store, gorsetest.Fixture{
+		Users: []gorsetest.User{
+			{Email: "user@example.com", Password: "password"},
+			{Email: "other@example.com", Password: "password"},
+		},
+		Feeds: []gorsetest.Feed{
+			{
+				DBFeed: gorse.DBFeed{
+					Name:                   "News",
+					URI:                    "https://news.example.com/feed",
+					UpdateFrequencySeconds: 3600,
+					Active:                 true,
+				},
+				Items: []rss.Item{
+					{
+						Title:       "Rust 2.0 released",
+						Link:        "https://news.example.com/1",
+						Description: "Big changes",
+						PubDate:     now.Add(-2 * time.Hour),
+					},
+					{
+						Title:       "Weekly links",
+						Link:        "https://news.example.com/2",
+						Description: "Including one about rust prevention",
+						PubDate:     now.Add(-time.Hour),
+					},
+					{
+						Title:       "New library opens",
+						Link:        "https://news.example.com/3",
+						Description: "Books",
+						PubDate:     now.Add(-time.Hour),
+					},
+				},
+				Subscribers: []string{"user@example.com", "other@example.com"},
+			},
+		},
+	})
+	userID := loaded.Users["user@example.com"]
+	other := loaded.Users["other@example.com"]
+
+	for _, phrase := range []string{"Rust", "rust "} {
+		if err := store.AddHighlight(ctx, userID, phrase); err != nil {
+			t.Fatalf("AddHighlight(%q) = error %s", phrase, err)
+		}
+	}
+
+	highlights, err := store.ListHighlights(ctx, userID)
+	if err != nil {
+		t.Fatalf("ListHighlights() = error %s", err)
+	}
+	if len(highlights) != 1 || highlights[0].Phrase != "rust" {
+		t.Errorf("ListHighlights() = %+v, wanted rust once", highlights)
+	}
+
+	unread := gorse.Unread
+	filter := gorse.ItemFilter{UserID: userID, State: &unread,
+		Highlighted: true}
+	items, err := store.FindItems(ctx, filter)
+	if err != nil {
+		t.Fatalf("FindItems() = error %s", err)
+	}
+	if len(items) != 2 || items[0].Link != "https://news.example.com/2" ||
+		items[1].Link != "https://news.example.com/1" {
+		t.Errorf("FindItems() = %+v, wanted the items with the phrase", items)
+	}
+	count, err := store.CountItems(ctx, filter)
+	if err != nil {
+		t.Fatalf("CountItems() = error %s", err)
+	}
+	if count != 2 {
+		t.Errorf("CountItems() = %d, wanted 2", count)
+	}
+
+	// Other users' highlights are their own.
+	filter.UserID = other
+	count, err = store.CountItems(ctx, filter)
+	if err != nil {
+		t.Fatalf("CountItems() = error %s", err)
+	}
+	if count != 0 {
+		t.Errorf("CountItems() for another user = %d, wanted 0", count)
+	}
+
+	if err := store.RemoveHighlight(ctx, userID, "RUST"); err != nil {
+		t.Fatalf("RemoveHighlight() = error %s", err)
+	}
+	if err := store.RemoveHighlight(ctx, userID,
+		"rust"); err != gorse.ErrNotFound {
+		t.Errorf("RemoveHighlight() of a phrase not highlighted = error %v, "+
+			"wanted %s", err, gorse.ErrNotFound)
+	}
+}
+
+func TestRecentlyReadIntegration(t *testing.T) {
+	for _, dbType := range gorsetest.Types {
+		t.Run(dbType, func(t *testing.T) {
+			testRecentlyReadIntegration(t, dbType)
+		})
+	}
+}
+
+func testRecentlyReadIntegration(t *testing.T, dbType string) {
+	ctx := context.Background()
+	store, _ := gorsetest.Store(t, dbType)
+
+	now := time.Now()
+	loaded := gorsetest.Load(t, store, gorsetest.Fixture{
+		Users: []gorsetest.User{
+			{Email: "user@example.com", Password: "password"},
+		},
+		Feeds: []gorsetest.Feed{
+			{
+				DBFeed: gorse.DBFeed{
+					Name:                   "Example",
+					URI:                    "https://example.com/feed",
+					UpdateFrequencySeconds: 3600,
+					Active:                 true,
+				},
+				Items: []rss.Item{
+					{Title: "A", Link: "https://example.com/a", PubDate: now},
+					{Title: "B", Link: "https://example.com/b", PubDate: now},
+					{Title: "C", Link: "https://example.com/c", PubDate: now},
+				},
+				Subscribers: []string{"user@example.com"},
+			},
+		},
+	})
+	userID := loaded.Users["user@example.com"]
+	a := loaded.Items["https://example.com/a"]
+	b := loaded.Items["https://example.com/b"]
+	c := loaded.Items["https://example.com/c"]
+
+	for _, step := range []struct {
+		id    int64
+		state gorse.ReadState
+	}{
+		{a, gorse.Read},
+		{b, gorse.Read},
+		{c, gorse.Read},
+		{b, gorse.Unread},
+		{c, gorse.ReadLater},
+		{b, gorse.Read},
+	} {
+		if err := store.SetItemsReadState(ctx, []int64{step.id}, userID,
+			step.state); err != nil {
+			t.Fatalf("SetItemsReadState() = error %s", err)
+		}
+	}
+
+	items, err := store.RecentlyRead(ctx, userID, 10)
+	if err != nil {
+		t.Fatalf("RecentlyRead() = error %s", err)
+	}
+	if len(items) != 2 || items[0].ID != b || items[1].ID != a ||
+		items[0].ReadTime.IsZero() {
+		t.Errorf("RecentlyRead() = %+v, wanted B then A", items)
+	}
+
+	if items, err = store.RecentlyRead(ctx, userID, 1); err != nil ||
+		len(items) != 1 {
+		t.Errorf("RecentlyRead() with limit 1 = %+v, %v, wanted one item", items,
+			err)
+	}
+}
+
+func TestDigestIntegration(t *testing.T) {
+	for _, dbType := range gorsetest.Types {
+		t.Run(dbType, func(t *testing.T) {
+			testDigestIntegration(t, dbType)
+		})
+	}
+}
+
+func testDigestIntegration(t *testing.T, dbType string) {
+	ctx := context.Background()
+	store, _ := gorsetest.Store(t, dbType)
+
+	now := time.Now()
+	loaded := gorsetest.Load(t, store, gorsetest.Fixture{
+		Users: []gorsetest.User{
+			{Email: "user@example.com", Password: "password"},
+		},
+		Feeds: []gorsetest.Feed{
+			{
+				DBFeed: gorse.DBFeed{
+					Name:                   "Busy",
+					URI:                    "https://busy.example.com/feed",
+					UpdateFrequencySeconds: 3600,
+					Active:                 true,
+				},
+				Items: []rss.Item{
+					{Title: "B1", Link: "https://busy.example.com/1",
+						PubDate: now.Add(-3 * time.Hour)},
+					{Title: "B2", Link: "https://busy.example.com/2",
+						PubDate: now.Add(-2 * time.Hour)},
+					{Title: "B3", Link: "https://busy.example.com/3",
+						PubDate: now.Add(-time.Hour)},
+					{Title: "Old", Link: "https://busy.example.com/old",
+						PubDate: now.Add(-48 * time.Hour)},
+				},
+				Subscribers: []string{"user@example.com"},
+			},
+			{
+				DBFeed: gorse.DBFeed{
+					Name:                   "Quiet",
+					URI:                    "https://quiet.example.com/feed",
+					UpdateFrequencySeconds: 3600,
+					Active:                 true,
+				},
+				Items: []rss.Item{
+					{Title: "Q1", Link: "https://quiet.example.com/1",
+						PubDate: now.Add(-time.Hour)},
+				},
+				Subscribers: []string{"user@example.com"},
+			},
+		},
+	})
+	userID := loaded.Users["user@example.com"]
+
+	if err := store.SetItemsReadState(ctx,
+		[]int64{loaded.Items["https://busy.example.com/3"]}, userID,
+		gorse.Read); err != nil {
+		t.Fatalf("SetItemsReadState() = error %s", err)
+	}
+
+	feeds, err := store.Digest(ctx, gorse.ItemFilter{
+		UserID: userID,
+		Since:  now.Add(-24 * time.Hour),
+		Until:  now,
+	}, 2)
+	if err != nil {
+		t.Fatalf("Digest() = error %s", err)
+	}
+	if len(feeds) != 2 {
+		t.Fatalf("Digest() = %+v, wanted 2 feeds", feeds)
+	}
+
+	busy := feeds[0]
+	if busy.FeedName != "Busy" || busy.Count != 3 || busy.Unread != 2 ||
+		len(busy.Items) != 2 || busy.Items[0].Title != "B3" ||
+		busy.Items[0].ReadState != gorse.Read || busy.Items[1].Title != "B2" {
+		t.Errorf("Digest() busy feed = %+v, wanted 3 items, 2 unread, B3 and B2",
+			busy)
+	}
+	quiet := feeds[1]
+	if quiet.FeedName != "Quiet" || quiet.Count != 1 || quiet.Unread != 1 ||
+		len(quiet.Items) != 1 || quiet.Items[0].PublicationDate.IsZero() {
+		t.Errorf("Digest() quiet feed = %+v, wanted its one item", quiet)
+	}
+
+	feeds, err = store.Digest(ctx, gorse.ItemFilter{
+		UserID: userID,
+		Since:  now.Add(-72 * time.Hour),
+		Until:  now.Add(-24 * time.Hour),
+	}, 2)
+	if err != nil {
+		t.Fatalf("Digest() = error %s", err)
+	}
+	if len(feeds) != 1 || feeds[0].Count != 1 ||
+		feeds[0].Items[0].Title != "Old" {
+		t.Errorf("Digest() of days ago = %+v, wanted the old item", feeds)
+	}
+}
+
+func TestFeedArchiveIntegration(t *testing.T) {
+	for _, dbType := range gorsetest.Types {
+		t.Run(dbType, func(t *testing.T) {
+			testFeedArchiveIntegration(t, dbType)
+		})
+	}
+}
+
+func testFeedArchiveIntegration(t *testing.T, dbType string) {
+	ctx := context.Background()
+	store, _ := gorsetest.Store(t, dbType)
+
+	loaded := gorsetest.Load(t, store, gorsetest.Fixture{
+		Users: []gorsetest.User{
+			{Email: "user@example.com", Password: "password"},
+		},
+		Feeds: []gorsetest.Feed{
+			{
+				DBFeed: gorse.DBFeed{
+					Name:                   "Example",
+					URI:                    "https://example.com/feed",
+					UpdateFrequencySeconds: 3600,
+					Active:                 true,
+				},
+				Items: []rss.Item{
+					{Title: "One", Link: "https://example.com/1", PubDate: time.Now()},
+					{Title: "Two", Link: "https://example.com/2", PubDate: time.Now()},
+					{Title: "Three", Link: "https://example.com/3",
+						PubDate: time.Now()},
+				},
+				Subscribers: []string{"user@example.com"},
+			},
+			{
+				DBFeed: gorse.DBFeed{
+					Name:                   "Empty",
+					URI:                    "https://empty.example.com/feed",
+					UpdateFrequencySeconds: 3600,
+					Active:                 true,
+				},
+				Subscribers: []string{"user@example.com"},
+			},
+		},
+	})
+	userID := loaded.Users["user@example.com"]
+	feedID := loaded.Feeds["https://example.com/feed"]
+	emptyID := loaded.Feeds["https://empty.example.com/feed"]
+
+	if err := store.SetFeedArchive(ctx, feedID, true); err != nil {
+		t.Fatalf("SetFeedArchive() = error %s", err)
+	}
+	feed, err := store.GetFeedByURI(ctx, "https://example.com/feed")
+	if err != nil {
+		t.Fatalf("GetFeedByURI() = error %s", err)
+	}
+	if !feed.Archive {
+		t.Errorf("feed archive = false after turning it on")
+	}
+
+	if err := store.SetFeedArchive(ctx, -1, true); err != gorse.ErrNotFound {
+		t.Errorf("SetFeedArchive() of missing feed = error %v, wanted %s", err,
+			gorse.ErrNotFound)
+	}
+
+	if err := store.SetItemsArchived(ctx, []int64{
+		loaded.Items["https://example.com/1"],
+		loaded.Items["https://example.com/2"],
+	}); err != nil {
+		t.Fatalf("SetItemsArchived() = error %s", err)
+	}
+
+	stats, err := store.SubscriptionStats(ctx, userID)
+	if err != nil {
+		t.Fatalf("SubscriptionStats() = error %s", err)
+	}
+	if got := stats[feedID]; got.Items != 3 || got.Archived != 2 {
+		t.Errorf("SubscriptionStats() of feed = %+v, wanted 3 items, 2 archived",
+			got)
+	}
+	if got := stats[emptyID]; got != (gorse.FeedStats{}) {
+		t.Errorf("SubscriptionStats() of empty feed = %+v, wanted none", got)
+	}
+}
+
+func TestFeedUpdateFrequencyIntegration(t *testing.T) {
+	for _, dbType := range gorsetest.Types {
+		t.Run(dbType, func(t *testing.T) {
+			testFeedUpdateFrequencyIntegration(t, dbType)
+		})
+	}
+}
+
+func testFeedUpdateFrequencyIntegration(t *testing.T, dbType string) {
+	ctx := context.Background()
+	store, _ := gorsetest.Store(t, dbType)
+
+	now := time.Now()
+	loaded := gorsetest.Load(t, store, gorsetest.Fixture{
+		Users: []gorsetest.User{
+			{Email: "user@example.com", Password: "password"},
+		},
+		Feeds: []gorsetest.Feed{
+			{
+				DBFeed: gorse.DBFeed{
+					Name:                   "Example",
+					URI:                    "https://example.com/feed",
+					UpdateFrequencySeconds: 3600,
+					Active:                 true,
+				},
+				Items: []rss.Item{
+					{Title: "Old", Link: "https://example.com/old",
+						PubDate: now.Add(-60 * 24 * time.Hour)},
+					{Title: "One", Link: "https://example.com/1",
+						PubDate: now.Add(-10 * 24 * time.Hour)},
+					{Title: "Two", Link: "https://example.com/2",
+						PubDate: now.Add(-time.Hour)},
+				},
+				Subscribers: []string{"user@example.com"},
+			},
+		},
+	})
+	userID := loaded.Users["user@example.com"]
+	feedID := loaded.Feeds["https://example.com/feed"]
+
+	stats, err := store.SubscriptionStats(ctx, userID)
+	if err != nil {
+		t.Fatalf("SubscriptionStats() = error %s", err)
+	}
+	got := stats[feedID]
+	oldest := now.Add(-60 * 24 * time.Hour)
+	if got.Items != 3 || got.RecentItems != 2 ||
+		got.Oldest.Sub(oldest) > time.Second ||
+		oldest.Sub(got.Oldest) > time.Second {
+		t.Errorf("SubscriptionStats() = %+v, wanted 3 items, 2 recent, and the "+
+			"oldest 60 days ago", got)
+	}
+
+	if err := store.SetFeedUpdateFrequency(ctx, feedID, 7200); err != nil {
+		t.Fatalf("SetFeedUpdateFrequency() = error %s", err)
+	}
+	feed, err := store.GetFeedByURI(ctx, "https://example.com/feed")
+	if err != nil {
+		t.Fatalf("GetFeedByURI() = error %s", err)
+	}
+	if feed.UpdateFrequencySeconds != 7200 {
+		t.Errorf("update frequency = %d, wanted 7200",
+			feed.UpdateFrequencySeconds)
+	}
+
+	if err := store.SetFeedUpdateFrequency(ctx, feedID, 1); err == nil {
+		t.Errorf("SetFeedUpdateFrequency() of 1 second = no error, wanted one")
+	}
+	if err := store.SetFeedUpdateFrequency(ctx, -1,
+		3600); err != gorse.ErrNotFound {
+		t.Errorf("SetFeedUpdateFrequency() of missing feed = error %v, wanted %s",
+			err, gorse.ErrNotFound)
+	}
+}
+
+func TestFeedValidatorsIntegration(t *testing.T) {
+	for _, dbType := range gorsetest.Types {
+		t.Run(dbType, func(t *testing.T) {
+			testFeedValidatorsIntegration(t, dbType)
+		})
+	}
+}
+
+func testFeedValidatorsIntegration(t *testing.T, dbType string) {
+	ctx := context.Background()
+	store, _ := gorsetest.Store(t, dbType)
+
+	loaded := gorsetest.Load(t, store, gorsetest.Fixture{
+		Feeds: []gorsetest.Feed{
+			{
+				DBFeed: gorse.DBFeed{
+					Name:                   "Example",
+					URI:                    "https://example.com/feed",
+					UpdateFrequencySeconds: 3600,
+					Active:                 true,
+				},
+			},
+		},
+	})
+	feedID := loaded.Feeds["https://example.com/feed"]
+
+	lastModified := "Mon, 02 Jan 2006 15:04:05 GMT"
+	if err := store.SetFeedValidators(ctx, feedID, `"v1"`,
+		lastModified); err != nil {
+		t.Fatalf("SetFeedValidators() = error %s", err)
+	}
+	if err := store.SetFeedValidators(ctx, -1, `"v1"`,
+		lastModified); err != gorse.ErrNotFound {
+		t.Errorf("SetFeedValidators() of missing feed = error %v, wanted %s", err,
+			gorse.ErrNotFound)
+	}
+
+	feeds, err := store.ActiveFeeds(ctx)
+	if err != nil {
+		t.Fatalf("ActiveFeeds() = error %s", err)
+	}
+	if len(feeds) != 1 || feeds[0].ETag != `"v1"` ||
+		feeds[0].LastModified != lastModified {
+		t.Fatalf("ActiveFeeds() = %+v, wanted the validators", feeds)
+	}
+
+	// Changing only the name keeps them.
+	feed := feeds[0]
+	feed.Name = "Renamed"
+	if err := store.UpdateFeed(ctx, feed); err != nil {
+		t.Fatalf("UpdateFeed() = error %s", err)
+	}
+	got, err := store.GetFeedByURI(ctx, "https://example.com/feed")
+	if err != nil {
+		t.Fatalf("GetFeedByURI() = error %s", err)
+	}
+	if got.ETag != `"v1"` || got.LastModified != lastModified {
+		t.Errorf("GetFeedByURI() = %+v, wanted the validators kept", got)
+	}
+
+	// A new URI is a different feed, so we forget them.
+	feed.URI = "https://example.com/new"
+	if err := store.UpdateFeed(ctx, feed); err != nil {
+		t.Fatalf("UpdateFeed() = error %s", err)
+	}
+	got, err = store.GetFeedByURI(ctx, "https://example.com/new")
+	if err != nil {
+		t.Fatalf("GetFeedByURI() = error %s", err)
+	}
+	if got.ETag != "" || got.LastModified != "" {
+		t.Errorf("GetFeedByURI() = %+v, wanted the validators forgotten", got)
+	}
+}
+
+func TestMarkAllReadIntegration(t *testing.T) {
+	for _, dbType := range gorsetest.Types {
+		t.Run(dbType, func(t *testing.T) {
+			testMarkAllReadIntegration(t, dbType)
+		})
+	}
+}
+
+func testMarkAllReadIntegration(t *testing.T, dbType string) {
+	ctx := context.Background()
+	store, _ := gorsetest.Store(t, dbType)
+
+	now := time.Now()
+	loaded := gorsetest.Load(t, store, gorsetest.Fixture{
+		Users: []gorsetest.User{
+			{Email: "user@example.com", Password: "password"},
+			{Email: "other@example.com", Password: "password"},
+		},
+		Feeds: []gorsetest.Feed{
+			{
+				DBFeed: gorse.DBFeed{
+					Name:                   "A",
+					URI:                    "https://example.com/a",
+					UpdateFrequencySeconds: 3600,
+					Active:                 true,
+				},
+				Items: []rss.Item{
+					{Title: "A old", Link: "https://example.com/a/old",
+						PubDate: now.Add(-10 * 24 * time.Hour)},
+					{Title: "A new", Link: "https://example.com/a/new",
+						PubDate: now.Add(-time.Hour)},
+					{Title: "A saved", Link: "https://example.com/a/saved",
+						PubDate: now.Add(-time.Hour)},
+				},
+				Subscribers: []string{"user@example.com", "other@example.com"},
+			},
+			{
+				DBFeed: gorse.DBFeed{
+					Name:                   "B",
+					URI:                    "https://example.com/b",
+					UpdateFrequencySeconds: 3600,
+					Active:                 true,
+				},
+				Items: []rss.Item{
+					{Title: "B old", Link: "https://example.com/b/old",
+						PubDate: now.Add(-10 * 24 * time.Hour)},
+					{Title: "B new", Link: "https://example.com/b/new",
+						PubDate: now.Add(-time.Hour)},
+				},
+				Subscribers: []string{"user@example.com", "other@example.com"},
+			},
+		},
+	})
+	userID := loaded.Users["user@example.com"]
+	a := loaded.Feeds["https://example.com/a"]
+	b := loaded.Feeds["https://example.com/b"]
+
+	saved := loaded.Items["https://example.com/a/saved"]
+	if err := store.SetItemsReadState(ctx, []int64{saved}, userID,
+		gorse.ReadLater); err != nil {
+		t.Fatalf("SetItemsReadState() = error %s", err)
+	}
+
+	markAllRead := func(feedID int64, until time.Time, want int64) {
+		t.Helper()
+		count, err := store.MarkAllRead(ctx, userID, feedID, until)
+		if err != nil {
+			t.Fatalf("MarkAllRead() = error %s", err)
+		}
+		if count != want {
+			t.Errorf("MarkAllRead() = %d, wanted %d", count, want)
+		}
+	}
+
+	unreadCounts := func(userID int) map[int64]int {
+		t.Helper()
+		counts, err := store.UnreadCounts(ctx, userID, time.Time{})
+		if err != nil {
+			t.Fatalf("UnreadCounts() = error %s", err)
+		}
+		return counts
+	}
+
+	// Only the feed's items, and only those published before a week ago.
+	markAllRead(a, now.Add(-7*24*time.Hour), 1)
+	if got := unreadCounts(userID); got[a] != 1 || got[b] != 2 {
+		t.Errorf("UnreadCounts() = %v, wanted 1 in A and 2 in B", got)
+	}
+
+	// The rest of the feed's.
+	markAllRead(a, time.Time{}, 1)
+	// Everything left.
+	markAllRead(0, time.Time{}, 2)
+	markAllRead(0, time.Time{}, 0)
+
+	if got := unreadCounts(userID); len(got) != 0 {
+		t.Errorf("UnreadCounts() = %v, wanted none", got)
+	}
+	if got := unreadCounts(loaded.Users["other@example.com"]); got[a] != 3 ||
+		got[b] != 2 {
+		t.Errorf("UnreadCounts() of other user = %v, wanted them all", got)
+	}
+
+	item, err := store.GetItem(ctx, saved, userID)
+	if err != nil {
+		t.Fatalf("GetItem() = error %s", err)
+	}
+	if item.ReadState != gorse.ReadLater {
+		t.Errorf("saved item is %s, wanted it left saved", item.ReadState)
+	}
+
+	changes, err := store.StateChanges(ctx, userID, 10)
+	if err != nil {
+		t.Fatalf("StateChanges() = error %s", err)
+	}
+	read := 0
+	for _, change := range changes {
+		if change.OldState == gorse.Unread && change.NewState == gorse.Read {
+			read++
+		}
+	}
+	if len(changes) != 5 || read != 4 {
+		t.Errorf("StateChanges() = %+v, wanted 4 items set read after saving one",
+			changes)
+	}
+}
+
+// TestConcurrentReadStatesIntegration checks that setting the same item's state
+// at the same time in several transactions changes the unread counts once.
+func TestConcurrentReadStatesIntegration(t *testing.T) {
+	for _, dbType := range gorsetest.Types {
+		t.Run(dbType, func(t *testing.T) {
+			testConcurrentReadStatesIntegration(t, dbType)
+		})
+	}
+}
+
+func testConcurrentReadStatesIntegration(t *testing.T, dbType string) {
+	ctx := context.Background()
+	store, _ := gorsetest.Store(t, dbType)
+
+	now := time.Now()
+	loaded := gorsetest.Load(t, store, gorsetest.Fixture{
+		Users: []gorsetest.User{
+			{Email: "user@example.com", Password: "password"},
+		},
+		Feeds: []gorsetest.Feed{
+			{
+				DBFeed: gorse.DBFeed{
+					Name:                   "A",
+					URI:                    "https://example.com/a",
+					UpdateFrequencySeconds: 3600,
+					Active:                 true,
+				},
+				Items: []rss.Item{
+					{Title: "A 1", Link: "https://example.com/a/1",
+						PubDate: now.Add(-time.Hour)},
+					{Title: "A 2", Link: "https://example.com/a/2",
+						PubDate: now.Add(-time.Hour)},
+				},
+				Subscribers: []string{"user@example.com"},
+			},
+		},
+	})
+	userID := loaded.Users["user@example.com"]
+	a := loaded.Feeds["https://example.com/a"]
+	item := loaded.Items["https://example.com/a/1"]
+
+	const writers = 10
+	var wg sync.WaitGroup
+	errs := make(chan error, writers)
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- store.SetItemsReadState(ctx, []int64{item}, userID,
+				gorse.Read)
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("SetItemsReadState() = error %s", err)
+		}
+	}
+
+	counts, err := store.UnreadCounts(ctx, userID, time.Time{})
+	if err != nil {
+		t.Fatalf("UnreadCounts() = error %s", err)
+	}
+	if counts[a] != 1 {
+		t.Errorf("UnreadCounts() = %v, wanted 1 in A", counts)
+	}
+
+	changes, err := store.StateChanges(ctx, userID, 10)
+	if err != nil {
+		t.Fatalf("StateChanges() = error %s", err)
+	}
+	if len(changes) != 1 {
+		t.Errorf("StateChanges() = %+v, wanted the item set read once", changes)
+	}
+}
+
+func TestScopedSearchIntegration(t *testing.T) {
+	for _, dbType := range gorsetest.Types {
+		t.Run(dbType, func(t *testing.T) {
+			testScopedSearchIntegration(t, dbType)
+		})
+	}
+}
+
+func testScopedSearchIntegration(t *testing.T, dbType string) {
+	ctx := context.Background()
+	store, _ := gorsetest.Store(t, dbType)
+
+	now := time.Now()
+	loaded := gorsetest.Load(t, store, gorsetest.Fixture{
+		Users: []gorsetest.User{
+			{Email: "user@example.com", Password: "password"},
+		},
+		Feeds: []gorsetest.Feed{
+			{
+				DBFeed: gorse.DBFeed{
+					Name:                   "Gardening",
+					URI:                    "https://example.com/gardening",
+					UpdateFrequencySeconds: 3600,
+					Active:                 true,
+				},
+				Items: []rss.Item{
+					{
+						Title:   "Planting tomatoes",
+						Link:    "https://example.com/gardening/1",
+						PubDate: now.Add(-time.Hour),
+					},
+					{
+						Title:   "Tomatoes in pots",
+						Link:    "https://example.com/gardening/2",
+						PubDate: now.Add(-2 * time.Hour),
+					},
+				},
+				Subscribers: []string{"user@example.com"},
+			},
+			{
+				DBFeed: gorse.DBFeed{
+					Name:                   "Cooking",
+					URI:                    "https://example.com/cooking",
+					UpdateFrequencySeconds: 3600,
+					Active:                 true,
+				},
+				Items: []rss.Item{
+					{
+						Title:   "Roasting tomatoes",
+						Link:    "https://example.com/cooking/1",
+						PubDate: now.Add(-3 * time.Hour),
+					},
+				},
+				Subscribers: []string{"user@example.com"},
+			},
+		},
+	})
+	userID := loaded.Users["user@example.com"]
+	gardeningID := loaded.Feeds["https://example.com/gardening"]
+	saved := loaded.Items["https://example.com/gardening/2"]
+
+	if err := store.SetItemsReadState(ctx, []int64{saved}, userID,
+		gorse.ReadLater); err != nil {
+		t.Fatalf("SetItemsReadState() = error %s", err)
+	}
+
+	filter := gorse.ItemFilter{
+		UserID: userID,
+		Search: "tomatoes",
+		FeedID: gardeningID,
+	}
+	items, err := store.SearchItems(ctx, filter)
+	if err != nil {
+		t.Fatalf("SearchItems() = error %s", err)
+	}
+	if len(items) != 2 {
+		t.Errorf("SearchItems() in one feed = %+v, wanted its 2 items", items)
+	}
+	count, err := store.CountItems(ctx, filter)
+	if err != nil {
+		t.Fatalf("CountItems() = error %s", err)
+	}
+	if count != 2 {
+		t.Errorf("CountItems() in one feed = %d, wanted 2", count)
+	}
+
+	readLater := gorse.ReadLater
+	filter.State = &readLater
+	if items, err = store.SearchItems(ctx, filter); err != nil {
+		t.Fatalf("SearchItems() = error %s", err)
+	}
+	if len(items) != 1 || items[0].ID != saved {
+		t.Errorf("SearchItems() in read later items = %+v, wanted the saved item",
+			items)
+	}
+
+	filter = gorse.ItemFilter{
+		UserID: userID,
+		Search: "tomatoes",
+		Limit:  2,
+		Offset: 2,
+	}
+	if items, err = store.SearchItems(ctx, filter); err != nil {
+		t.Fatalf("SearchItems() = error %s", err)
+	}
+	if len(items) != 1 {
+		t.Errorf("SearchItems() second page = %+v, wanted 1 item", items)
+	}
+	if count, err = store.CountItems(ctx, filter); err != nil {
+		t.Fatalf("CountItems() = error %s", err)
+	}
+	if count != 3 {
+		t.Errorf("CountItems() of all feeds = %d, wanted 3", count)
+	}
+}
+
+func TestFeedOverviewIntegration(t *testing.T) {
+	for _, dbType := range gorsetest.Types {
+		t.Run(dbType, func(t *testing.T) {
+			testFeedOverviewIntegration(t, dbType)
+		})
+	}
+}
+
+func testFeedOverviewIntegration(t *testing.T, dbType string) {
+	ctx := context.Background()
+	store, _ := gorsetest.Store(t, dbType)
+
+	now := time.Now()
+	feed := func(name string, items int) gorsetest.Feed {
+		f := gorsetest.Feed{
+			DBFeed: gorse.DBFeed{
+				Name:                   name,
+				URI:                    "https://example.com/" + name,
+				UpdateFrequencySeconds: 3600,
+				Active:                 true,
+			},
+			Subscribers: []string{"user@example.com"},
+		}
+		for i := 0; i < items; i++ {
+			f.Items = append(f.Items, rss.Item{
+				Title:   fmt.Sprintf("%s %d", name, i),
+				Link:    fmt.Sprintf("https://example.com/%s/%d", name, i),
+				PubDate: now.Add(-time.Duration(i) * time.Hour),
+			})
+		}
+		return f
+	}
+
+	loaded := gorsetest.Load(t, store, gorsetest.Fixture{
+		Users: []gorsetest.User{
+			{Email: "user@example.com", Password: "password"},
+		},
+		Feeds: []gorsetest.Feed{
+			feed("a", 1),
+			feed("b", 3),
+			feed("c", 2),
+		},
+	})
+	userID := loaded.Users["user@example.com"]
+	a := loaded.Feeds["https://example.com/a"]
+	b := loaded.Feeds["https://example.com/b"]
+	c := loaded.Feeds["https://example.com/c"]
+
+	if err := store.SetFeedUpdated(ctx, a, now.Add(-time.Hour)); err != nil {
+		t.Fatalf("SetFeedUpdated() = error %s", err)
+	}
+	if err := store.SetFeedUpdated(ctx, b, now.Add(-2*time.Hour)); err != nil {
+		t.Fatalf("SetFeedUpdated() = error %s", err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := store.SetFeedError(ctx, a, "timeout"); err != nil {
+			t.Fatalf("SetFeedError() = error %s", err)
+		}
+	}
+	if err := store.SetFeedError(ctx, -1, "timeout"); err != gorse.ErrNotFound {
+		t.Errorf("SetFeedError() of missing feed = error %v, wanted %s", err,
+			gorse.ErrNotFound)
+	}
+	if err := store.SetItemsReadState(ctx, []int64{
+		loaded.Items["https://example.com/b/0"],
+		loaded.Items["https://example.com/b/1"],
+	}, userID, gorse.Read); err != nil {
+		t.Fatalf("SetItemsReadState() = error %s", err)
+	}
+
+	ids := func(summaries []gorse.FeedSummary) []int64 {
+		var ids []int64
+		for _, s := range summaries {
+			ids = append(ids, s.ID)
+		}
+		return ids
+	}
+
+	for _, test := range []struct {
+		sort gorse.FeedSort
+		want []int64
+	}{
+		{gorse.FeedSortName, []int64{a, b, c}},
+		{gorse.FeedSortUnread, []int64{c, a, b}},
+		{gorse.FeedSortUpdated, []int64{c, b, a}},
+		{gorse.FeedSortErrors, []int64{a, b, c}},
+	} {
+		summaries, err := store.FeedOverview(ctx, userID, test.sort, 10, 0)
+		if err != nil {
+			t.Fatalf("FeedOverview(%s) = error %s", test.sort, err)
+		}
+		if got := ids(summaries); fmt.Sprint(got) != fmt.Sprint(test.want) {
+			t.Errorf("FeedOverview(%s) = %v, wanted %v", test.sort, got, test.want)
+		}
+	}
+
+	summaries, err := store.FeedOverview(ctx, userID, gorse.FeedSortName, 2, 0)
+	if err != nil {
+		t.Fatalf("FeedOverview() = error %s", err)
+	}
+	if len(summaries) != 2 || summaries[0].Unread != 1 ||
+		summaries[0].ErrorCount != 2 || summaries[0].LastError != "timeout" ||
+		summaries[0].LastUpdateTime == nil || summaries[1].Unread != 1 {
+		t.Errorf("FeedOverview() first page = %+v, wanted a then b", summaries)
+	}
+	if summaries, err = store.FeedOverview(ctx, userID, gorse.FeedSortName, 2,
+		2); err != nil || fmt.Sprint(ids(summaries)) != fmt.Sprint([]int64{c}) {
+		t.Errorf("FeedOverview() second page = %+v, %v, wanted c", summaries, err)
+	}
+
+	count, err := store.CountSubscriptions(ctx, userID)
+	if err != nil || count != 3 {
+		t.Errorf("CountSubscriptions() = %d, %v, wanted 3", count, err)
+	}
+
+	for minErrors, want := range map[int]int{2: 1, 3: 0} {
+		count, err := store.CountFailingFeeds(ctx, userID, minErrors)
+		if err != nil || count != want {
+			t.Errorf("CountFailingFeeds(%d) = %d, %v, wanted %d", minErrors, count,
+				err, want)
+		}
+	}
+
+	// Polling succeeding clears the errors.
+	if err := store.SetFeedUpdated(ctx, a, now); err != nil {
+		t.Fatalf("SetFeedUpdated() = error %s", err)
+	}
+	if summaries, err = store.FeedOverview(ctx, userID, gorse.FeedSortErrors,
+		1, 0); err != nil || len(summaries) != 1 ||
+		summaries[0].ErrorCount != 0 || summaries[0].LastError != "" {
+		t.Errorf("FeedOverview() after polling = %+v, %v, wanted no errors",
+			summaries, err)
+	}
+}
+
+func TestItemStarredIntegration(t *testing.T) {
+	for _, dbType := range gorsetest.Types {
+		t.Run(dbType, func(t *testing.T) {
+			testItemStarredIntegration(t, dbType)
+		})
+	}
+}
+
+func testItemStarredIntegration(t *testing.T, dbType string) {
+	ctx := context.Background()
+	store, _ := gorsetest.Store(t, dbType)
+
+	now := time.Now()
+	loaded := gorsetest.Load(t, store, gorsetest.Fixture{
+		Users: []gorsetest.User{
+			{Email: "user@example.com", Password: "password"},
+			{Email: "other@example.com", Password: "password"},
+		},
+		Feeds: []gorsetest.Feed{
+			{
+				DBFeed: gorse.DBFeed{
+					Name:                   "A",
+					URI:                    "https://example.com/a",
+					UpdateFrequencySeconds: 3600,
+					Active:                 true,
+				},
+				Items: []rss.Item{
+					{Title: "Keep", Link: "https://example.com/a/keep",
+						PubDate: now.Add(-time.Hour)},
+					{Title: "Drop", Link: "https://example.com/a/drop",
+						PubDate: now.Add(-time.Hour)},
+				},
+				Subscribers: []string{"user@example.com", "other@example.com"},
+			},
+		},
+	})
+	userID := loaded.Users["user@example.com"]
+	keep := loaded.Items["https://example.com/a/keep"]
+	drop := loaded.Items["https://example.com/a/drop"]
+
+	starred := func(userID int) []int64 {
+		t.Helper()
+		items, err := store.FindItems(ctx, gorse.ItemFilter{
+			UserID:  userID,
+			Starred: true,
+		})
+		if err != nil {
+			t.Fatalf("FindItems() = error %s", err)
+		}
+		var ids []int64
+		for _, item := range items {
+			if !item.Starred {
+				t.Errorf("starred item %d says it isn't", item.ID)
+			}
+			ids = append(ids, item.ID)
+		}
+		return ids
+	}
+
+	// Starring twice is fine.
+	for i := 0; i < 2; i++ {
+		if err := store.SetItemStarred(ctx, keep, userID, true); err != nil {
+			t.Fatalf("SetItemStarred() = error %s", err)
+		}
+	}
+	if err := store.SetItemStarred(ctx, -1, userID,
+		true); err != gorse.ErrNotFound {
+		t.Errorf("SetItemStarred() of no item = error %v, wanted ErrNotFound",
+			err)
+	}
+
+	if ids := starred(userID); !reflect.DeepEqual(ids, []int64{keep}) {
+		t.Errorf("starred = %v, wanted %d", ids, keep)
+	}
+	if ids := starred(loaded.Users["other@example.com"]); len(ids) != 0 {
+		t.Errorf("other user's starred = %v, wanted none", ids)
+	}
+
+	// Starring doesn't change the read state.
+	item, err := store.GetItem(ctx, keep, userID)
+	if err != nil {
+		t.Fatalf("GetItem() = error %s", err)
+	}
+	if !item.Starred || item.ReadState != gorse.Unread {
+		t.Errorf("GetItem() = %+v, wanted it starred and unread", item)
+	}
+
+	// Purging the feed's items keeps the starred one, and it still lists.
+	if err := store.DeleteFeed(ctx, loaded.Feeds["https://example.com/a"],
+		gorse.PurgeItems); err != nil {
+		t.Fatalf("DeleteFeed() = error %s", err)
+	}
+	if _, err := store.GetItem(ctx, drop, userID); err != gorse.ErrNotFound {
+		t.Errorf("GetItem() of purged item = error %v, wanted ErrNotFound", err)
+	}
+	if ids := starred(userID); !reflect.DeepEqual(ids, []int64{keep}) {
+		t.Errorf("starred after purging = %v, wanted %d", ids, keep)
+	}
+
+	if err := store.SetItemStarred(ctx, keep, userID, false); err != nil {
+		t.Fatalf("SetItemStarred() = error %s", err)
+	}
+	if ids := starred(userID); len(ids) != 0 {
+		t.Errorf("starred after unstarring = %v, wanted none", ids)
+	}
+}
+
+func TestItemEnclosuresIntegration(t *testing.T) {
+	for _, dbType := range gorsetest.Types {
+		t.Run(dbType, func(t *testing.T) {
+			testItemEnclosuresIntegration(t, dbType)
+		})
+	}
+}
+
+func testItemEnclosuresIntegration(t *testing.T, dbType string) {
+	ctx := context.Background()
+	store, _ := gorsetest.Store(t, dbType)
+
+	loaded := gorsetest.Load(t, store, gorsetest.Fixture{
+		Feeds: []gorsetest.Feed{
+			{
+				DBFeed: gorse.DBFeed{
+					Name:                   "Podcast",
+					URI:                    "https://example.com/podcast",
+					UpdateFrequencySeconds: 3600,
+					Active:                 true,
+				},
+				Items: []rss.Item{
+					{Title: "Notes", Link: "https://example.com/notes",
+						PubDate: time.Now()},
+				},
+			},
+		},
+	})
+	notes := loaded.Items["https://example.com/notes"]
+
+	enclosures := []gorse.Enclosure{
+		{
+			URL:      "https://example.com/1.mp3",
+			Type:     "audio/mpeg",
+			Length:   12345678,
+			Duration: time.Hour + 2*time.Minute + 3*time.Second,
+		},
+		{URL: "https://example.com/1.pdf"},
+	}
+	feedID := loaded.Feeds["https://example.com/podcast"]
+	episode, err := store.AddItem(ctx, feedID, &gorse.Item{
+		Item: rss.Item{
+			Title:   "Episode 1",
+			Link:    "https://example.com/1",
+			PubDate: time.Now(),
+		},
+		Enclosures: enclosures,
+	})
+	if err != nil {
+		t.Fatalf("AddItem() = error %s", err)
+	}
+
+	got, err := store.ItemEnclosures(ctx, []int64{episode, notes})
+	if err != nil {
+		t.Fatalf("ItemEnclosures() = error %s", err)
+	}
+	want := map[int64][]gorse.Enclosure{episode: enclosures}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ItemEnclosures() = %+v, wanted %+v", got, want)
+	}
+}
+
+func TestItemCategoriesIntegration(t *testing.T) {
+	for _, dbType := range gorsetest.Types {
+		t.Run(dbType, func(t *testing.T) {
+			testItemCategoriesIntegration(t, dbType)
+		})
+	}
+}
+
+func testItemCategoriesIntegration(t *testing.T, dbType string) {
+	ctx := context.Background()
+	store, _ := gorsetest.Store(t, dbType)
+
+	loaded := gorsetest.Load(t, store, gorsetest.Fixture{
+		Users: []gorsetest.User{
+			{Email: "user@example.com", Password: "password"},
+		},
+		Feeds: []gorsetest.Feed{
+			{
+				DBFeed: gorse.DBFeed{
+					Name:                   "Blog",
+					URI:                    "https://example.com/feed",
+					UpdateFrequencySeconds: 3600,
+					Active:                 true,
+				},
+				Subscribers: []string{"user@example.com"},
+			},
+		},
+	})
+	userID := loaded.Users["user@example.com"]
+	feedID := loaded.Feeds["https://example.com/feed"]
+
+	add := func(link string, categories ...string) int64 {
+		t.Helper()
+		id, err := store.AddItem(ctx, feedID, &gorse.Item{
+			Item: rss.Item{
+				Title:   link,
+				Link:    link,
+				PubDate: time.Now(),
+			},
+			Categories: categories,
+		})
+		if err != nil {
+			t.Fatalf("AddItem() = error %s", err)
+		}
+		return id
+	}
+	both := add("https://example.com/1", "SQL", "Go")
+	goOnly := add("https://example.com/2", "Go")
+	none := add("https://example.com/3")
+
+	got, err := store.ItemCategories(ctx, []int64{both, goOnly, none})
+	if err != nil {
+		t.Fatalf("ItemCategories() = error %s", err)
+	}
+	want := map[int64][]string{both: {"Go", "SQL"}, goOnly: {"Go"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ItemCategories() = %v, wanted %v", got, want)
+	}
+
+	for category, want := range map[string][]int64{
+		"Go":  {goOnly, both},
+		"SQL": {both},
+		"go":  nil,
+	} {
+		filter := gorse.ItemFilter{UserID: userID, Category: category}
+		items, err := store.FindItems(ctx, filter)
+		if err != nil {
+			t.Fatalf("FindItems() = error %s", err)
+		}
+		var ids []int64
+		for _, item := range items {
+			ids = append(ids, item.ID)
+		}
+		if !reflect.DeepEqual(ids, want) {
+			t.Errorf("FindItems() in %s = %v, wanted %v", category, ids, want)
+		}
+
+		count, err := store.CountItems(ctx, filter)
+		if err != nil {
+			t.Fatalf("CountItems() = error %s", err)
+		}
+		if count != len(want) {
+			t.Errorf("CountItems() in %s = %d, wanted %d", category, count,
+				len(want))
+		}
+	}
+
+	// Unread items in a category we can't count using the unread counts, as
+	// they don't know about categories.
+	unread := gorse.Unread
+	for _, category := range []string{"Go", "SQL"} {
+		filter := gorse.ItemFilter{UserID: userID, State: &unread,
+			Category: category}
+		items, err := store.FindItems(ctx, filter)
+		if err != nil {
+			t.Fatalf("FindItems() = error %s", err)
+		}
+		count, err := store.CountItems(ctx, filter)
+		if err != nil {
+			t.Fatalf("CountItems() = error %s", err)
+		}
+		if count != len(items) {
+			t.Errorf("CountItems() of unread in %s = %d, wanted %d as FindItems() "+
+				"found", category, count, len(items))
+		}
+	}
+}
+
+func TestItemTagsIntegration(t *testing.T) {
+	for _, dbType := range gorsetest.Types {
+		t.Run(dbType, func(t *testing.T) {
+			testItemTagsIntegration(t, dbType)
+		})
+	}
+}
+
+func testItemTagsIntegration(t *testing.T, dbType string) {
+	ctx := context.Background()
+	store, _ := gorsetest.Store(t, dbType)
+
+	now := time.Now()
+	loaded := gorsetest.Load(t, store, gorsetest.Fixture{
+		Users: []gorsetest.User{
+			{Email: "user@example.com", Password: "password"},
+			{Email: "other@example.com", Password: "password"},
+		},
+		Feeds: []gorsetest.Feed{
+			{
+				DBFeed: gorse.DBFeed{
+					Name:                   "A",
+					URI:                    "https://example.com/a",
+					UpdateFrequencySeconds: 3600,
+					Active:                 true,
+				},
+				Items: []rss.Item{
+					{Title: "One", Link: "https://example.com/a/1",
+						PubDate: now.Add(-time.Hour)},
+					{Title: "Two", Link: "https://example.com/a/2",
+						PubDate: now.Add(-2 * time.Hour)},
+				},
+				Subscribers: []string{"user@example.com", "other@example.com"},
+			},
+		},
+	})
+	userID := loaded.Users["user@example.com"]
+	otherID := loaded.Users["other@example.com"]
+	one := loaded.Items["https://example.com/a/1"]
+	two := loaded.Items["https://example.com/a/2"]
+
+	for _, tag := range []struct {
+		ItemID int64
+		UserID int
+		Tag    string
+	}{
+		{one, userID, "work"},
+		{one, userID, "work"},
+		{one, userID, "recipes"},
+		{two, userID, "work"},
+		{two, otherID, "later"},
+	} {
+		if err := store.AddItemTag(ctx, tag.ItemID, tag.UserID,
+			tag.Tag); err != nil {
+			t.Fatalf("AddItemTag(%d, %s) = error %s", tag.ItemID, tag.Tag, err)
+		}
+	}
+	if err := store.AddItemTag(ctx, 999999, userID,
+		"work"); err != gorse.ErrNotFound {
+		t.Errorf("AddItemTag() of an unknown item = error %v, wanted %s", err,
+			gorse.ErrNotFound)
+	}
+
+	// Reading a tagged item keeps it in its tag.
+	if err := store.SetItemReadState(ctx, two, userID, gorse.Read); err != nil {
+		t.Fatalf("SetItemReadState() = error %s", err)
+	}
+
+	tags, err := store.ItemTags(ctx, userID, []int64{one, two})
+	if err != nil {
+		t.Fatalf("ItemTags() = error %s", err)
+	}
+	wantTags := map[int64][]string{one: {"recipes", "work"}, two: {"work"}}
+	if !reflect.DeepEqual(tags, wantTags) {
+		t.Errorf("ItemTags() = %v, wanted %v", tags, wantTags)
+	}
+
+	counts, err := store.ListTags(ctx, userID)
+	if err != nil {
+		t.Fatalf("ListTags() = error %s", err)
+	}
+	wantCounts := []gorse.TagCount{{Tag: "recipes", Items: 1},
+		{Tag: "work", Items: 2}}
+	if !reflect.DeepEqual(counts, wantCounts) {
+		t.Errorf("ListTags() = %+v, wanted %+v", counts, wantCounts)
+	}
+
+	tagged := func(tag string) []int64 {
+		t.Helper()
+		items, err := store.FindItems(ctx, gorse.ItemFilter{UserID: userID,
+			Tag: tag})
+		if err != nil {
+			t.Fatalf("FindItems() = error %s", err)
+		}
+		var ids []int64
+		for _, item := range items {
+			ids = append(ids, item.ID)
+		}
+		return ids
+	}
+	if got := tagged("work"); !reflect.DeepEqual(got, []int64{one, two}) {
+		t.Errorf("items tagged work = %v, wanted %v", got, []int64{one, two})
+	}
+	if got := tagged("later"); got != nil {
+		t.Errorf("items tagged later = %v, wanted none of the other user's", got)
+	}
+
+	if err := store.RemoveItemTag(ctx, one, userID, "work"); err != nil {
+		t.Fatalf("RemoveItemTag() = error %s", err)
+	}
+	if got := tagged("work"); !reflect.DeepEqual(got, []int64{two}) {
+		t.Errorf("items tagged work after removing = %v, wanted %v", got,
+			[]int64{two})
+	}
+
+	// The unread counts don't know about tags either.
+	unread := gorse.Unread
+	for _, tag := range []string{"work", "recipes", "later"} {
+		filter := gorse.ItemFilter{UserID: userID, State: &unread, Tag: tag}
+		items, err := store.FindItems(ctx, filter)
+		if err != nil {
+			t.Fatalf("FindItems() = error %s", err)
+		}
+		count, err := store.CountItems(ctx, filter)
+		if err != nil {
+			t.Fatalf("CountItems() = error %s", err)
+		}
+		if count != len(items) {
+			t.Errorf("CountItems() of unread tagged %s = %d, wanted %d as "+
+				"FindItems() found", tag, count, len(items))
+		}
+	}
+}
+
+func TestItemRulesIntegration(t *testing.T) {
+	for _, dbType := range gorsetest.Types {
+		t.Run(dbType, func(t *testing.T) {
+			testItemRulesIntegration(t, dbType)
+		})
+	}
+}
+
+func testItemRulesIntegration(t *testing.T, dbType string) {
+	ctx := context.Background()
+	store, _ := gorsetest.Store(t, dbType)
+
+	loaded := gorsetest.Load(t, store, gorsetest.Fixture{
+		Users: []gorsetest.User{
+			{Email: "user@example.com", Password: "password"},
+			{Email: "other@example.com", Password: "password"},
+		},
+		Feeds: []gorsetest.Feed{
+			{
+				DBFeed: gorse.DBFeed{
+					Name:                   "A",
+					URI:                    "https://example.com/a",
+					UpdateFrequencySeconds: 3600,
+					Active:                 true,
+				},
+				Subscribers: []string{"user@example.com", "other@example.com"},
+			},
+			{
+				DBFeed: gorse.DBFeed{
+					Name:                   "B",
+					URI:                    "https://example.com/b",
+					UpdateFrequencySeconds: 3600,
+					Active:                 true,
+				},
+				Subscribers: []string{"user@example.com"},
+			},
+		},
+	})
+	userID := loaded.Users["user@example.com"]
+	otherID := loaded.Users["other@example.com"]
+	feedA := loaded.Feeds["https://example.com/a"]
+	feedB := loaded.Feeds["https://example.com/b"]
+
+	for _, rule := range []gorse.Rule{
+		{UserID: userID, Field: gorse.TitleField, Match: gorse.RegexpMatch,
+			Pattern: "sponsored", Action: gorse.MarkReadAction},
+		{UserID: userID, Field: gorse.LinkField, Match: gorse.ContainsMatch,
+			Pattern: "youtube.com", Action: gorse.TagAction, Tag: "Video"},
+		{UserID: userID, FeedID: feedB, Field: gorse.AnyField,
+			Match: gorse.ContainsMatch, Pattern: "go", Action: gorse.ReadLaterAction},
+		{UserID: userID, FeedID: feedB, Field: gorse.TitleField,
+			Match: gorse.ContainsMatch, Pattern: "release", Action: gorse.StarAction},
+	} {
+		if _, err := store.AddRule(ctx, rule); err != nil {
+			t.Fatalf("AddRule(%+v) = error %s", rule, err)
+		}
+	}
+	if _, err := store.AddRule(ctx, gorse.Rule{UserID: userID,
+		Match: gorse.RegexpMatch, Pattern: "("}); err == nil {
+		t.Errorf("AddRule() of an invalid regular expression succeeded")
+	}
+
+	rules, err := store.ListRules(ctx, userID)
+	if err != nil {
+		t.Fatalf("ListRules() = error %s", err)
+	}
+	if len(rules) != 4 || rules[0].Pattern != "sponsored" ||
+		rules[1].Tag != "video" || rules[2].FeedID != feedB ||
+		rules[3].Action != gorse.StarAction {
+		t.Fatalf("ListRules() = %+v, wanted the 4 rules in order", rules)
+	}
+
+	add := func(feedID int64, title, link string) int64 {
+		id, err := store.AddItem(ctx, feedID, &gorse.Item{Item: rss.Item{
+			Title:   title,
+			Link:    link,
+			PubDate: time.Now(),
+		}})
+		if err != nil {
+			t.Fatalf("AddItem() = error %s", err)
+		}
+		return id
+	}
+	sponsored := add(feedA, "SPONSORED: laptops", "https://example.com/a/1")
+	video := add(feedA, "A talk", "https://www.youtube.com/watch?v=1")
+	// The feed B rules don't apply to feed A.
+	plain := add(feedA, "Go release notes", "https://example.com/a/2")
+	release := add(feedB, "Go release notes", "https://example.com/b/1")
+
+	tests := []struct {
+		ItemID  int64
+		UserID  int
+		State   gorse.ReadState
+		Starred bool
+		Tags    []string
+	}{
+		{sponsored, userID, gorse.Read, false, nil},
+		{sponsored, otherID, gorse.Unread, false, nil},
+		{video, userID, gorse.Unread, false, []string{"video"}},
+		{video, otherID, gorse.Unread, false, nil},
+		{plain, userID, gorse.Unread, false, nil},
+		{release, userID, gorse.ReadLater, true, nil},
+	}
+	for _, test := range tests {
+		item, err := store.GetItem(ctx, test.ItemID, test.UserID)
+		if err != nil {
+			t.Fatalf("GetItem() = error %s", err)
+		}
+		if item.ReadState != test.State || item.Starred != test.Starred {
+			t.Errorf("user %d has item %d in state %s starred %t, wanted %s %t",
+				test.UserID, test.ItemID, item.ReadState, item.Starred, test.State,
+				test.Starred)
+		}
+		tags, err := store.ItemTags(ctx, test.UserID, []int64{test.ItemID})
+		if err != nil {
+			t.Fatalf("ItemTags() = error %s", err)
+		}
+		if !reflect.DeepEqual(tags[test.ItemID], test.Tags) {
+			t.Errorf("user %d has item %d tagged %v, wanted %v", test.UserID,
+				test.ItemID, tags[test.ItemID], test.Tags)
+		}
+	}
+
+	if err := store.DeleteRule(ctx, otherID,
+		rules[0].ID); err != gorse.ErrNotFound {
+		t.Errorf("DeleteRule() of another user's rule = error %v, wanted %s",
+			err, gorse.ErrNotFound)
+	}
+	if err := store.DeleteRule(ctx, userID, rules[0].ID); err != nil {
+		t.Fatalf("DeleteRule() = error %s", err)
+	}
+	sponsored = add(feedA, "Sponsored: phones", "https://example.com/a/3")
+	item, err := store.GetItem(ctx, sponsored, userID)
+	if err != nil {
+		t.Fatalf("GetItem() = error %s", err)
+	}
+	if item.ReadState != gorse.Unread {
+		t.Errorf("item is in state %s after deleting the rule, wanted unread",
+			item.ReadState)
+	}
+}
@@ -0,0 +1,152 @@
+package gorse
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// Integration is a service a user sends items to, such as Pocket, along with
+// their credentials for it.
+//
+// Which of the credentials a service needs depends on the service. See the
+// sendto package.
+type Integration struct {
+	UserID int
+
+	// Service is the service's name, such as pocket.
+	Service string
+
+	// URL is where the service is. This is for services people host
+	// themselves, such as Wallabag.
+	URL string
+
+	// ClientID and ClientSecret identify the application to the service.
+	// Pocket calls the client ID the consumer key.
+	ClientID     string
+	ClientSecret string
+
+	// Username and Password are the user's login to the service.
+	Username string
+	Password string
+
+	// AccessToken authorizes us to act for the user.
+	AccessToken string
+
+	// Whether to set items read once we send them.
+	MarkRead bool
+}
+
+// ListIntegrations retrieves the user's integrations ordered by service.
+func ListIntegrations(ctx context.Context, db Querier,
+	userID int) ([]Integration, error) {
+	query := `
+SELECT service, url, client_id, client_secret, username, password,
+access_token, mark_read
+FROM rss_user_integration
+WHERE user_id = $1
+ORDER BY service
+`
+
+	rows, err := db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("unable to query integrations of user %d: %s",
+			userID, err)
+	}
+
+	var integrations []Integration
+	for rows.Next() {
+		integration := Integration{UserID: userID}
+		if err := rows.Scan(&integration.Service, &integration.URL,
+			&integration.ClientID, &integration.ClientSecret,
+			&integration.Username, &integration.Password,
+			&integration.AccessToken, &integration.MarkRead); err != nil {
+			_ = rows.Close()
+			return nil, fmt.Errorf("failed to scan row: %s", err)
+		}
+		integrations = append(integrations, integration)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failure fetching rows: %s", err)
+	}
+
+	return integrations, nil
+}
+
+// GetIntegration retrieves the user's integration with the service. It
+// returns ErrNotFound if they don't have one.
+func GetIntegration(ctx context.Context, db Querier, userID int,
+	service string) (*Integration, error) {
+	query := `
+SELECT url, client_id, client_secret, username, password, access_token,
+mark_read
+FROM rss_user_integration
+WHERE user_id = $1 AND service = $2
+`
+
+	integration := &Integration{UserID: userID, Service: service}
+	err := db.QueryRowContext(ctx, query, userID, service).Scan(
+		&integration.URL, &integration.ClientID, &integration.ClientSecret,
+		&integration.Username, &integration.Password, &integration.AccessToken,
+		&integration.MarkRead)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to look up %s integration of user %d: %s",
+			service, userID, err)
+	}
+
+	return integration, nil
+}
+
+// SetIntegration records the integration, replacing any the user had with the
+// service.
+func SetIntegration(ctx context.Context, db Querier,
+	integration Integration) error {
+	if integration.Service == "" {
+		return fmt.Errorf("integration of user %d has no service",
+			integration.UserID)
+	}
+
+	query := `
+INSERT INTO rss_user_integration
+(user_id, service, url, client_id, client_secret, username, password,
+access_token, mark_read)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+ON CONFLICT (user_id, service) DO UPDATE
+SET url = EXCLUDED.url, client_id = EXCLUDED.client_id,
+client_secret = EXCLUDED.client_secret, username = EXCLUDED.username,
+password = EXCLUDED.password, access_token = EXCLUDED.access_token,
+mark_read = EXCLUDED.mark_read
+`
+
+	if _, err := db.ExecContext(ctx, query, integration.UserID,
+		integration.Service, integration.URL, integration.ClientID,
+		integration.ClientSecret, integration.Username, integration.Password,
+		integration.AccessToken, integration.MarkRead); err != nil {
+		return fmt.Errorf("unable to set %s integration of user %d: %s",
+			integration.Service, integration.UserID, err)
+	}
+
+	return nil
+}
+
+// DeleteIntegration removes the user's integration with the service. It
+// returns ErrNotFound if they don't have one.
+func DeleteIntegration(ctx context.Context, db Querier, userID int,
+	service string) error {
+	query := `
+DELETE FROM rss_user_integration
+WHERE user_id = $1 AND service = $2
+`
+
+	result, err := db.ExecContext(ctx, query, userID, service)
+	if err != nil {
+		return fmt.Errorf("unable to delete %s integration of user %d: %s",
+			service, userID, err)
+	}
+
+	return requireOneRow(result)
+}
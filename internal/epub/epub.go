@@ -0,0 +1,314 @@
+// Package epub writes EPUB books so that items can be read offline on an
+// e-reader.
+//
+// We write EPUB 3 with an NCX table of contents as well so that older readers,
+// such as Kindles, find their way around too. Each chapter is one article.
+package epub
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/rand"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"text/template"
+	"time"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// Book is what goes in an EPUB.
+type Book struct {
+	Title string
+
+	// Language is the book's language, such as en. Blank means en.
+	Language string
+
+	// Date is when the book was made.
+	Date time.Time
+
+	Chapters []Chapter
+}
+
+// Chapter is an article in a book.
+type Chapter struct {
+	Title string
+
+	// Source is where the article is from, such as its feed's name. Optional.
+	Source string
+
+	// Link is the URL of the article. Optional.
+	Link string
+
+	// HTML is the article's content. It's a fragment, such as a reader view's
+	// content. We make it XHTML as EPUB needs.
+	HTML string
+}
+
+// Write writes the book as an EPUB.
+func Write(w io.Writer, book Book) error {
+	if len(book.Chapters) == 0 {
+		return fmt.Errorf("book has no chapters")
+	}
+
+	id, err := uuid()
+	if err != nil {
+		return err
+	}
+
+	language := book.Language
+	if language == "" {
+		language = "en"
+	}
+
+	type chapter struct {
+		Chapter
+		File string
+		Body string
+	}
+	var chapters []chapter
+	for i, c := range book.Chapters {
+		body, err := xhtml(c.HTML)
+		if err != nil {
+			return fmt.Errorf("chapter %d: %s", i+1, err)
+		}
+		if c.Title == "" {
+			c.Title = fmt.Sprintf("Chapter %d", i+1)
+		}
+		chapters = append(chapters, chapter{
+			Chapter: c,
+			File:    fmt.Sprintf("chapter-%d.xhtml", i+1),
+			Body:    body,
+		})
+	}
+
+	data := struct {
+		ID       string
+		Title    string
+		Language string
+		Modified string
+		Chapters []chapter
+	}{
+		ID:       id,
+		Title:    book.Title,
+		Language: language,
+		Modified: book.Date.UTC().Format("2006-01-02T15:04:05Z"),
+		Chapters: chapters,
+	}
+
+	z := zip.NewWriter(w)
+
+	// The mimetype must come first and be uncompressed so that readers can
+	// tell what the file is from its start.
+	mimetype, err := z.CreateHeader(&zip.FileHeader{
+		Name:     "mimetype",
+		Method:   zip.Store,
+		Modified: book.Date,
+	})
+	if err != nil {
+		return fmt.Errorf("writing mimetype: %s", err)
+	}
+	if _, err := io.WriteString(mimetype, "application/epub+zip"); err != nil {
+		return fmt.Errorf("writing mimetype: %s", err)
+	}
+
+	type file struct {
+		name     string
+		template *template.Template
+		data     interface{}
+	}
+	files := []file{
+		{"META-INF/container.xml", containerTemplate, nil},
+		{"OEBPS/content.opf", packageTemplate, data},
+		{"OEBPS/nav.xhtml", navTemplate, data},
+		{"OEBPS/toc.ncx", ncxTemplate, data},
+	}
+	for _, c := range chapters {
+		files = append(files, file{"OEBPS/" + c.File, chapterTemplate, struct {
+			Language string
+			chapter
+		}{language, c}})
+	}
+
+	for _, f := range files {
+		fw, err := z.CreateHeader(&zip.FileHeader{
+			Name:     f.name,
+			Method:   zip.Deflate,
+			Modified: book.Date,
+		})
+		if err != nil {
+			return fmt.Errorf("writing %s: %s", f.name, err)
+		}
+		if err := f.template.Execute(fw, f.data); err != nil {
+			return fmt.Errorf("writing %s: %s", f.name, err)
+		}
+	}
+
+	if err := z.Close(); err != nil {
+		return fmt.Errorf("writing zip: %s", err)
+	}
+	return nil
+}
+
+// uuid makes a random UUID to identify a book.
+func uuid() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("unable to generate ID: %s", err)
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("urn:uuid:%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8],
+		b[8:10], b[10:]), nil
+}
+
+// xhtml makes the HTML fragment XHTML.
+//
+// We drop images. They'd be fetched from the web, which the reader may not be
+// able to do, and EPUB wants everything in the book.
+func xhtml(fragment string) (string, error) {
+	nodes, err := html.ParseFragment(strings.NewReader(fragment), &html.Node{
+		Type:     html.ElementNode,
+		Data:     "body",
+		DataAtom: atom.Body,
+	})
+	if err != nil {
+		return "", fmt.Errorf("unable to parse HTML: %s", err)
+	}
+
+	var buf bytes.Buffer
+	for _, n := range nodes {
+		if n.Type == html.ElementNode && n.DataAtom == atom.Img {
+			continue
+		}
+		removeImages(n)
+		// Render writes void elements such as <br/> as XML wants.
+		if err := html.Render(&buf, n); err != nil {
+			return "", fmt.Errorf("unable to write HTML: %s", err)
+		}
+	}
+	return buf.String(), nil
+}
+
+// removeImages removes the img elements under n.
+func removeImages(n *html.Node) {
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling
+		if c.Type == html.ElementNode && c.DataAtom == atom.Img {
+			n.RemoveChild(c)
+		} else {
+			removeImages(c)
+		}
+		c = next
+	}
+}
+
+// escape escapes the text for XML.
+func escape(s string) string {
+	var b strings.Builder
+	_ = xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+var funcs = template.FuncMap{
+	"x": escape,
+	// NCX counts from one.
+	"inc": func(i int) int { return i + 1 },
+}
+
+var containerTemplate = template.Must(template.New("container").Parse(
+	`<?xml version="1.0" encoding="UTF-8"?>
+<container version="1.0"
+  xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+<rootfiles>
+<rootfile full-path="OEBPS/content.opf"
+  media-type="application/oebps-package+xml"/>
+</rootfiles>
+</container>
+`))
+
+var packageTemplate = template.Must(template.New("package").Funcs(funcs).Parse(
+	`<?xml version="1.0" encoding="UTF-8"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0"
+  unique-identifier="id">
+<metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+<dc:identifier id="id">{{x .ID}}</dc:identifier>
+<dc:title>{{x .Title}}</dc:title>
+<dc:language>{{x .Language}}</dc:language>
+<dc:creator>gorse</dc:creator>
+<meta property="dcterms:modified">{{x .Modified}}</meta>
+</metadata>
+<manifest>
+<item id="nav" href="nav.xhtml" media-type="application/xhtml+xml"
+  properties="nav"/>
+<item id="ncx" href="toc.ncx" media-type="application/x-dtbncx+xml"/>
+{{- range $i, $c := .Chapters}}
+<item id="chapter-{{$i}}" href="{{$c.File}}"
+  media-type="application/xhtml+xml"/>
+{{- end}}
+</manifest>
+<spine toc="ncx">
+{{- range $i, $c := .Chapters}}
+<itemref idref="chapter-{{$i}}"/>
+{{- end}}
+</spine>
+</package>
+`))
+
+var navTemplate = template.Must(template.New("nav").Funcs(funcs).Parse(
+	`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml"
+  xmlns:epub="http://www.idpf.org/2007/ops"
+  lang="{{x .Language}}" xml:lang="{{x .Language}}">
+<head><title>{{x .Title}}</title></head>
+<body>
+<nav epub:type="toc" id="toc">
+<h1>{{x .Title}}</h1>
+<ol>
+{{- range .Chapters}}
+<li><a href="{{x .File}}">{{x .Title}}</a></li>
+{{- end}}
+</ol>
+</nav>
+</body>
+</html>
+`))
+
+var ncxTemplate = template.Must(template.New("ncx").Funcs(funcs).Parse(
+	`<?xml version="1.0" encoding="UTF-8"?>
+<ncx xmlns="http://www.daisy.org/z3986/2005/ncx/" version="2005-1">
+<head><meta name="dtb:uid" content="{{x .ID}}"/></head>
+<docTitle><text>{{x .Title}}</text></docTitle>
+<navMap>
+{{- range $i, $c := .Chapters}}
+<navPoint id="point-{{$i}}" playOrder="{{inc $i}}">
+<navLabel><text>{{x $c.Title}}</text></navLabel>
+<content src="{{x $c.File}}"/>
+</navPoint>
+{{- end}}
+</navMap>
+</ncx>
+`))
+
+var chapterTemplate = template.Must(template.New("chapter").Funcs(funcs).Parse(
+	`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml"
+  lang="{{x .Language}}" xml:lang="{{x .Language}}">
+<head><title>{{x .Title}}</title></head>
+<body>
+<h1>{{x .Title}}</h1>
+{{- if .Source}}
+<p><i>{{x .Source}}</i></p>
+{{- end}}
+{{- if .Link}}
+<p><a href="{{x .Link}}">{{x .Link}}</a></p>
+{{- end}}
+{{.Body}}
+</body>
+</html>
+`))
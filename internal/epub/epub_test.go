@@ -0,0 +1,106 @@
+package epub
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWrite(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Write(&buf, Book{
+		Title: "Read later",
+		Date:  time.Date(2020, 3, 1, 14, 5, 0, 0, time.UTC),
+		Chapters: []Chapter{
+			{
+				Title:  "Coffee & <cake>",
+				Source: "Example",
+				Link:   "https://example.com/1?a=1&b=2",
+				HTML: `<p>One<br>two &amp; three</p>` +
+					`<p><img src="https://example.com/a.png">Pictured</p>` +
+					`<img src="https://example.com/b.png">`,
+			},
+			{HTML: "Plain text"},
+		},
+	}); err != nil {
+		t.Fatalf("Write() = error %s", err)
+	}
+
+	r, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("Write() wrote an invalid zip: %s", err)
+	}
+
+	if len(r.File) == 0 || r.File[0].Name != "mimetype" ||
+		r.File[0].Method != zip.Store {
+		t.Fatalf("Write() did not write the mimetype first uncompressed")
+	}
+
+	files := map[string]string{}
+	for _, f := range r.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatalf("opening %s: %s", f.Name, err)
+		}
+		data, err := ioutil.ReadAll(rc)
+		_ = rc.Close()
+		if err != nil {
+			t.Fatalf("reading %s: %s", f.Name, err)
+		}
+		files[f.Name] = string(data)
+
+		if f.Name == "mimetype" {
+			continue
+		}
+
+		// Everything else must be well-formed XML.
+		decoder := xml.NewDecoder(bytes.NewReader(data))
+		decoder.Strict = true
+		decoder.Entity = xml.HTMLEntity
+		for {
+			if _, err := decoder.Token(); err != nil {
+				if err != io.EOF {
+					t.Errorf("%s is not well-formed: %s: %s", f.Name, err, data)
+				}
+				break
+			}
+		}
+	}
+
+	if files["mimetype"] != "application/epub+zip" {
+		t.Errorf("mimetype = %q", files["mimetype"])
+	}
+
+	for _, name := range []string{"META-INF/container.xml", "OEBPS/content.opf",
+		"OEBPS/nav.xhtml", "OEBPS/toc.ncx", "OEBPS/chapter-1.xhtml",
+		"OEBPS/chapter-2.xhtml"} {
+		if _, ok := files[name]; !ok {
+			t.Errorf("Write() did not write %s", name)
+		}
+	}
+
+	chapter := files["OEBPS/chapter-1.xhtml"]
+	for _, want := range []string{"<h1>Coffee &amp; &lt;cake&gt;</h1>",
+		"<br/>", "two &amp; three", "Pictured", "Example",
+		`href="https://example.com/1?a=1&amp;b=2"`} {
+		if !strings.Contains(chapter, want) {
+			t.Errorf("chapter 1 = %s, wanted %s", chapter, want)
+		}
+	}
+	if strings.Contains(chapter, "<img") {
+		t.Errorf("chapter 1 = %s, wanted no images", chapter)
+	}
+
+	if nav := files["OEBPS/nav.xhtml"]; !strings.Contains(nav, "Chapter 2") {
+		t.Errorf("nav = %s, wanted the untitled chapter named", nav)
+	}
+
+	if err := Write(&buf, Book{Title: "Empty"}); err == nil {
+		t.Error("Write() with no chapters succeeded")
+	}
+}
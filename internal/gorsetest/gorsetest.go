@@ -0,0 +1,265 @@
+// Package gorsetest sets up databases for integration tests.
+//
+// Tests get a throwaway database with the migrations applied and load the
+// users, feeds, and items they need into it. This lets them run against a real
+// database rather than matching queries with sqlmock.
+//
+// Postgres tests connect to a server given by the environment:
+//
+//	GORSE_TEST_PG_HOST  the host. Postgres tests are skipped if it's blank.
+//	GORSE_TEST_PG_USER  the user. It must be able to create databases.
+//	GORSE_TEST_PG_PASS  the user's password. Required.
+//	GORSE_TEST_PG_DB    the database to connect to while creating each test's
+//	                    database. postgres if blank.
+//
+// The usual libpq variables such as PGSSLMODE apply too. For example, with a
+// server in a container:
+//
+//	docker run -d -p 5432:5432 -e POSTGRES_PASSWORD=gorse postgres
+//	GORSE_TEST_PG_HOST=localhost GORSE_TEST_PG_USER=postgres \
+//	  GORSE_TEST_PG_PASS=gorse PGSSLMODE=disable go test ./...
+//
+// SQLite tests need building with the sqlite3 tag and are otherwise skipped.
+package gorsetest
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/horgh/gorse"
+	"github.com/horgh/rss"
+)
+
+// Types are the database types Open supports. Tests can run against each in
+// turn.
+var Types = []string{gorse.Postgres, gorse.SQLite}
+
+// dbCount numbers the Postgres databases we create so that each test in a
+// process gets its own.
+var dbCount int64
+
+// Open creates a database of the type with the migrations applied. We remove
+// it when the test finishes. If the type isn't available the test is skipped.
+func Open(t testing.TB, dbType string) *sql.DB {
+	t.Helper()
+
+	switch dbType {
+	case gorse.Postgres:
+		return openPostgres(t)
+	case gorse.SQLite:
+		return openSQLite(t)
+	default:
+		t.Fatalf("unknown database type: %s", dbType)
+		return nil
+	}
+}
+
+// Store opens a database as Open does and returns a store using it.
+func Store(t testing.TB, dbType string) (*gorse.SQLStore, *sql.DB) {
+	t.Helper()
+
+	db := Open(t, dbType)
+	store := gorse.NewSQLStore(db, dbType)
+	t.Cleanup(func() {
+		if err := store.Close(); err != nil {
+			t.Errorf("closing store: %s", err)
+		}
+	})
+
+	return store, db
+}
+
+func openPostgres(t testing.TB) *sql.DB {
+	t.Helper()
+
+	config := gorse.DBConfig{
+		Type: gorse.Postgres,
+		Host: os.Getenv("GORSE_TEST_PG_HOST"),
+		User: os.Getenv("GORSE_TEST_PG_USER"),
+		Pass: os.Getenv("GORSE_TEST_PG_PASS"),
+		Name: os.Getenv("GORSE_TEST_PG_DB"),
+	}
+	if config.Host == "" {
+		t.Skip("GORSE_TEST_PG_HOST is not set")
+	}
+	if config.Name == "" {
+		config.Name = "postgres"
+	}
+
+	admin, err := gorse.OpenDB(config)
+	if err != nil {
+		t.Fatalf("unable to connect to Postgres: %s", err)
+	}
+
+	// Database names can't be parameters. This one is only digits and
+	// underscores.
+	config.Name = fmt.Sprintf("gorse_test_%d_%d", os.Getpid(),
+		atomic.AddInt64(&dbCount, 1))
+	if _, err := admin.Exec(`DROP DATABASE IF EXISTS ` +
+		config.Name); err != nil {
+		_ = admin.Close()
+		t.Fatalf("unable to drop database %s: %s", config.Name, err)
+	}
+	// Postgres only creates a database with an encoding other than its
+	// template's from template0. The default, template1, may not be UTF8.
+	if _, err := admin.Exec(`CREATE DATABASE ` + config.Name +
+		` TEMPLATE template0 ENCODING 'UTF8'`); err != nil {
+		_ = admin.Close()
+		t.Fatalf("unable to create database %s: %s", config.Name, err)
+	}
+
+	db, err := gorse.OpenDB(config)
+	if err != nil {
+		_ = admin.Close()
+		t.Fatalf("unable to connect to Postgres: %s", err)
+	}
+
+	// Cleanups run last added first, so we close the test's connections before
+	// dropping the database.
+	t.Cleanup(func() {
+		if _, err := admin.Exec(`DROP DATABASE ` + config.Name); err != nil {
+			t.Errorf("unable to drop database %s: %s", config.Name, err)
+		}
+		if err := admin.Close(); err != nil {
+			t.Errorf("closing database: %s", err)
+		}
+	})
+	t.Cleanup(func() {
+		if err := db.Close(); err != nil {
+			t.Errorf("closing database: %s", err)
+		}
+	})
+
+	migrate(t, db, gorse.Postgres)
+	return db
+}
+
+func openSQLite(t testing.TB) *sql.DB {
+	t.Helper()
+
+	if !driverRegistered("sqlite3") {
+		t.Skip("SQLite needs building with the sqlite3 tag")
+	}
+
+	db, err := gorse.OpenDB(gorse.DBConfig{
+		Type: gorse.SQLite,
+		Name: filepath.Join(t.TempDir(), "gorse.db"),
+	})
+	if err != nil {
+		t.Fatalf("unable to open SQLite database: %s", err)
+	}
+	t.Cleanup(func() {
+		if err := db.Close(); err != nil {
+			t.Errorf("closing database: %s", err)
+		}
+	})
+
+	migrate(t, db, gorse.SQLite)
+	return db
+}
+
+func driverRegistered(name string) bool {
+	for _, driver := range sql.Drivers() {
+		if driver == name {
+			return true
+		}
+	}
+	return false
+}
+
+func migrate(t testing.TB, db *sql.DB, dbType string) {
+	t.Helper()
+
+	if _, err := gorse.Migrate(context.Background(), db, dbType); err != nil {
+		t.Fatalf("Migrate() = error %s", err)
+	}
+}
+
+// Fixture is data for a test to start with.
+type Fixture struct {
+	Users []User
+	Feeds []Feed
+}
+
+// User is a user in a fixture.
+type User struct {
+	Email    string
+	Password string
+	Admin    bool
+}
+
+// Feed is a feed in a fixture along with its items.
+type Feed struct {
+	gorse.DBFeed
+
+	Items []rss.Item
+
+	// Subscribers are the emails of the users subscribed to the feed.
+	Subscribers []string
+}
+
+// Loaded holds the IDs of what Load added.
+type Loaded struct {
+	// Users by email.
+	Users map[string]int
+
+	// Feeds by URI.
+	Feeds map[string]int64
+
+	// Items by link. Fixtures should give each item a different link.
+	Items map[string]int64
+}
+
+// Load adds the fixture's users, feeds, and items to the store. Items are
+// unread for every user.
+func Load(t testing.TB, store gorse.Store, fixture Fixture) *Loaded {
+	t.Helper()
+
+	ctx := context.Background()
+	loaded := &Loaded{
+		Users: map[string]int{},
+		Feeds: map[string]int64{},
+		Items: map[string]int64{},
+	}
+
+	for _, u := range fixture.Users {
+		user, err := store.CreateUser(ctx, u.Email, u.Password, u.Admin)
+		if err != nil {
+			t.Fatalf("unable to add user %s: %s", u.Email, err)
+		}
+		loaded.Users[u.Email] = user.ID
+	}
+
+	for _, f := range fixture.Feeds {
+		feedID, err := store.CreateFeed(ctx, f.DBFeed)
+		if err != nil {
+			t.Fatalf("unable to add feed %s: %s", f.URI, err)
+		}
+		loaded.Feeds[f.URI] = feedID
+
+		for _, item := range f.Items {
+			id, err := store.AddItem(ctx, feedID, &gorse.Item{Item: item})
+			if err != nil {
+				t.Fatalf("unable to add item %s: %s", item.Link, err)
+			}
+			loaded.Items[item.Link] = id
+		}
+
+		for _, email := range f.Subscribers {
+			userID, ok := loaded.Users[email]
+			if !ok {
+				t.Fatalf("feed %s subscriber %s is not a fixture user", f.URI, email)
+			}
+			if err := store.Subscribe(ctx, userID, feedID); err != nil {
+				t.Fatalf("unable to subscribe %s to %s: %s", email, f.URI, err)
+			}
+		}
+	}
+
+	return loaded
+}
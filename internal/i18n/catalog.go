@@ -0,0 +1,394 @@
+package i18n
+
+import "time"
+
+// locales holds the locales we have by tag.
+var locales = map[string]*Locale{
+	"en": {
+		Tag:  "en",
+		Name: "English",
+		// The messages are in English already. We keep the date format we've
+		// always shown.
+		dateLayout: time.RFC1123Z,
+		one:        func(n int) bool { return n == 1 },
+	},
+
+	"de": {
+		Tag:        "de",
+		Name:       "Deutsch",
+		dateLayout: "{weekday}, 2. {month} 2006, 15:04",
+		weekdays:   [7]string{"So.", "Mo.", "Di.", "Mi.", "Do.", "Fr.", "Sa."},
+		months: [12]string{"Jan.", "Feb.", "März", "Apr.", "Mai", "Juni", "Juli",
+			"Aug.", "Sept.", "Okt.", "Nov.", "Dez."},
+		one: func(n int) bool { return n == 1 },
+		messages: map[string]string{
+			"Save":                           "Speichern",
+			"Saved.":                         "Gespeichert.",
+			"Sent.":                          "Gesendet.",
+			"Send to %s":                     "An %s senden",
+			"Email":                          "E-Mail",
+			"Email items to":                 "Einträge per E-Mail an",
+			"Download EPUB":                  "EPUB herunterladen",
+			"Send to Kindle":                 "An Kindle senden",
+			"Kindle address":                 "Kindle-Adresse",
+			"Sent to your Kindle.":           "An deinen Kindle gesendet.",
+			"Share":                          "Teilen",
+			"Don't share":                    "Nicht teilen",
+			"Shared feed:":                   "Geteilter Feed:",
+			"Reader view":                    "Leseansicht",
+			"Fetched %s":                     "Abgerufen %s",
+			"Compact":                        "Kompakt",
+			"Expanded":                       "Ausführlich",
+			"Highlight":                      "Markiert",
+			"Highlights":                     "Markierte",
+			"All unread":                     "Alle ungelesenen",
+			"Random item":                    "Zufälliger Eintrag",
+			"Recently read":                  "Zuletzt gelesen",
+			"Mark unread":                    "Als ungelesen markieren",
+			"Digest":                         "Übersicht",
+			"Show day":                       "Tag anzeigen",
+			"Last 24 hours":                  "Letzte 24 Stunden",
+			"Last 24 hours: %d items.":       "Letzte 24 Stunden: %d Einträge.",
+			"%s: %d items.":                  "%s: %d Einträge.",
+			"%d items, %d unread":            "%d Einträge, %d ungelesen",
+			"and %d more":                    "und %d weitere",
+			"Add feed":                       "Feed hinzufügen",
+			"Preview":                        "Vorschau",
+			"URL":                            "URL",
+			"Format":                         "Format",
+			"Items":                          "Einträge",
+			"Name":                           "Name",
+			"Subscribe":                      "Abonnieren",
+			"Subscribed.":                    "Abonniert.",
+			"We couldn't find a feed there.": "Dort gibt es keinen Feed.",
+			"Feeds":                          "Feeds",
+			"Archive mode":                   "Archivmodus",
+			"On":                             "An",
+			"Off":                            "Aus",
+			"Turn on":                        "Einschalten",
+			"Turn off":                       "Ausschalten",
+			"Not polled":                     "Wird nicht abgerufen",
+			"Checked every":                  "Abgerufen alle",
+			"%.1f a day":                     "%.1f pro Tag",
+			"minutes":                        "Minuten",
+			"Suggest":                        "Vorschlagen",
+			"Download":                       "Herunterladen",
+			"Search":                         "Suchen",
+			"All feeds":                      "Alle Feeds",
+			"All items":                      "Alle Einträge",
+			"Read later":                     "Später lesen",
+			"Read":                           "Gelesen",
+			"%d matching items.":             "%d passende Einträge.",
+			"%d feeds.":                      "%d Feeds.",
+			"Sort by":                        "Sortieren nach",
+			"Last checked":                   "Zuletzt abgerufen",
+			"Errors":                         "Fehler",
+			"%d unread":                      "%d ungelesen",
+			"Never":                          "Nie",
+			"Failed %d times in a row":       "%d-mal in Folge fehlgeschlagen",
+			"Polling":                        "Abrufen",
+			"Edit":                           "Bearbeiten",
+			"Delete":                         "Löschen",
+			"Keep its items":                 "Einträge behalten",
+			"Mark its items read":            "Einträge als gelesen markieren",
+			"Delete its items":               "Einträge löschen",
+			"Log in":                         "Anmelden",
+			"Log out":                        "Abmelden",
+			"Password":                       "Passwort",
+			"Invalid email or password.":     "Falsche E-Mail oder Passwort.",
+			"Published before":               "Veröffentlicht vor",
+			"Mark all unread items read":     "Ungelesene als gelesen markieren",
+			"Mark read":                      "Als gelesen markieren",
+			"Marked all read.":               "Alle als gelesen markiert.",
+			"Showing only %s.":               "Nur %s.",
+			"Starred":                        "Markiert",
+			"Unstar":                         "Markierung entfernen",
+			"Star to keep":                   "Zum Behalten markieren",
+			"Save to use the suggestion.":    "Zum Übernehmen speichern.",
+			"%d marked read by archive mode": "%d vom Archivmodus gelesen",
+			"Fetch again":                    "Erneut abrufen",
+			"Related items":                  "Ähnliche Einträge",
+			"Unable to fetch the article.":   "Artikel nicht abrufbar.",
+			"Showing %d/%d feed items.":      "%d/%d Einträge werden angezeigt.",
+			"Archived":                       "Archiviert",
+			"Unread":                         "Ungelesen",
+			"Mark all read":                  "Alle als gelesen markieren",
+			"Export":                         "Exportieren",
+			"No title":                       "Kein Titel",
+			"Note on why you're saving this": "Notiz, warum du das speicherst",
+			"No unread items found.":         "Keine ungelesenen Einträge.",
+			"Previous page":                  "Vorherige Seite",
+			"Next page":                      "Nächste Seite",
+			"Audit log":                      "Prüfprotokoll",
+			"The most recent administrative actions, newest first.": "Die " +
+				"letzten administrativen Aktionen, die neuesten zuerst.",
+			"The items you most recently marked read, newest first.": "Die " +
+				"zuletzt als gelesen markierten Einträge, die neuesten zuerst.",
+			"We found problems with the feed:": "Wir haben Probleme " +
+				"mit dem Feed gefunden:",
+			"You already subscribe to this feed.": "Du hast diesen " +
+				"Feed bereits abonniert.",
+			"The URL must be an http or https URL.": "Die URL muss " +
+				"eine http- oder https-URL sein.",
+			"Archive mode marks a feed's new items read as we fetch them.": "Der " +
+				"Archivmodus markiert neue Einträge eines Feeds beim Abrufen " +
+				"als gelesen.",
+			"We still keep them, so you can find them later.": "Wir " +
+				"behalten sie trotzdem, damit du sie später finden kannst.",
+			"Too many failed logins. Try again later.": "Zu viele " +
+				"fehlgeschlagene Anmeldungen. Versuche es später noch einmal.",
+			"Time":                         "Zeit",
+			"By":                           "Von",
+			"Action":                       "Aktion",
+			"Details":                      "Details",
+			"Nothing yet.":                 "Noch nichts.",
+			"just now":                     "gerade eben",
+			"%d minute ago|%d minutes ago": "vor %d Minute|vor %d Minuten",
+			"%d hour ago|%d hours ago":     "vor %d Stunde|vor %d Stunden",
+			"%d day ago|%d days ago":       "vor %d Tag|vor %d Tagen",
+			"The page links to more than one feed:": "Die Seite verweist " +
+				"auf mehrere Feeds:",
+			"%d of your feeds keep failing to update.": "%d Ihrer Feeds " +
+				"lassen sich wiederholt nicht aktualisieren.",
+			"Full text": "Volltext",
+			"Full text mode fetches the articles of a feed's new items.": "Der " +
+				"Volltextmodus ruft die Artikel neuer Einträge eines Feeds ab.",
+			"Showing only items in %s.": "Nur Einträge in %s.",
+			"All categories":            "Alle Kategorien",
+			"Tags":                      "Schlagwörter",
+			"Each tag lists the items you gave it, whatever their state.": "Jedes " +
+				"Schlagwort listet die Einträge, denen Sie es gegeben haben, egal " +
+				"in welchem Zustand.",
+			"Showing items you tagged %s.": "Einträge mit dem Schlagwort %s.",
+			"All tags":                     "Alle Schlagwörter",
+			"Remove tag":                   "Schlagwort entfernen",
+			"Add tag":                      "Schlagwort hinzufügen",
+			"Rules":                        "Regeln",
+			"Rules act on new items when they arrive.": "Regeln wirken " +
+				"auf neue Einträge, wenn sie ankommen.",
+			"Patterns ignore case.": "Muster beachten keine " +
+				"Groß- und Kleinschreibung.",
+			"Feed":                           "Feed",
+			"If":                             "Wenn",
+			"Then":                           "Dann",
+			"Any feed":                       "Jeder Feed",
+			"Feed %d":                        "Feed %d",
+			"Add rule":                       "Regel hinzufügen",
+			"Add":                            "Hinzufügen",
+			"Title, link, or description":    "Titel, Link oder Beschreibung",
+			"Title":                          "Titel",
+			"Link":                           "Link",
+			"Description":                    "Beschreibung",
+			"contains":                       "enthält",
+			"matches the regular expression": "passt auf den regulären Ausdruck",
+			"Star":                           "Markieren",
+			"Tag":                            "Schlagwort",
+			"Muted":                          "Stummgeschaltet",
+			"Unread items containing a muted phrase are hidden.": "Ungelesene " +
+				"Einträge mit einem stummgeschalteten Ausdruck werden ausgeblendet.",
+			"New items matching a muted regular expression arrive read.": "Neue " +
+				"Einträge, auf die ein stummgeschalteter regulärer Ausdruck " +
+				"passt, kommen als gelesen an.",
+			"Phrase":              "Ausdruck",
+			"New items":           "Neue Einträge",
+			"Hide":                "Ausblenden",
+			"Unmute":              "Stummschaltung aufheben",
+			"Mute":                "Stummschalten",
+			"Regular expression":  "Regulärer Ausdruck",
+			"Mark new items read": "Neue Einträge als gelesen markieren",
+		},
+	},
+
+	"fr": {
+		Tag:        "fr",
+		Name:       "Français",
+		dateLayout: "{weekday} 2 {month} 2006 15:04",
+		weekdays: [7]string{"dim.", "lun.", "mar.", "mer.", "jeu.", "ven.",
+			"sam."},
+		months: [12]string{"janv.", "févr.", "mars", "avr.", "mai", "juin",
+			"juil.", "août", "sept.", "oct.", "nov.", "déc."},
+		// French uses the singular for 0 as well.
+		one: func(n int) bool { return n <= 1 },
+		messages: map[string]string{
+			"Save":                         "Enregistrer",
+			"Saved.":                       "Enregistré.",
+			"Sent.":                        "Envoyé.",
+			"Send to %s":                   "Envoyer à %s",
+			"Email":                        "Courriel",
+			"Email items to":               "Envoyer les articles à",
+			"Download EPUB":                "Télécharger en EPUB",
+			"Send to Kindle":               "Envoyer au Kindle",
+			"Kindle address":               "Adresse Kindle",
+			"Sent to your Kindle.":         "Envoyé à votre Kindle.",
+			"Share":                        "Partager",
+			"Don't share":                  "Ne pas partager",
+			"Shared feed:":                 "Flux partagé :",
+			"Reader view":                  "Mode lecture",
+			"Fetched %s":                   "Récupéré %s",
+			"Compact":                      "Compact",
+			"Expanded":                     "Détaillé",
+			"Highlight":                    "Surveillé",
+			"Highlights":                   "Surveillés",
+			"All unread":                   "Tous les non lus",
+			"Random item":                  "Article au hasard",
+			"Recently read":                "Lus récemment",
+			"Mark unread":                  "Marquer comme non lu",
+			"Digest":                       "Résumé",
+			"Show day":                     "Afficher le jour",
+			"Last 24 hours":                "Dernières 24 heures",
+			"Last 24 hours: %d items.":     "Dernières 24 heures : %d articles.",
+			"%s: %d items.":                "%s : %d articles.",
+			"%d items, %d unread":          "%d articles, %d non lus",
+			"and %d more":                  "et %d de plus",
+			"Add feed":                     "Ajouter un flux",
+			"Preview":                      "Aperçu",
+			"URL":                          "URL",
+			"Format":                       "Format",
+			"Items":                        "Articles",
+			"Name":                         "Nom",
+			"Subscribe":                    "S'abonner",
+			"Subscribed.":                  "Abonné.",
+			"Feeds":                        "Flux",
+			"Archive mode":                 "Mode archive",
+			"On":                           "Activé",
+			"Off":                          "Désactivé",
+			"Turn on":                      "Activer",
+			"Turn off":                     "Désactiver",
+			"Not polled":                   "Non récupéré",
+			"Checked every":                "Récupéré toutes les",
+			"%.1f a day":                   "%.1f par jour",
+			"minutes":                      "minutes",
+			"Suggest":                      "Suggérer",
+			"Download":                     "Télécharger",
+			"Search":                       "Rechercher",
+			"All feeds":                    "Tous les flux",
+			"All items":                    "Tous les articles",
+			"Read later":                   "À lire plus tard",
+			"Read":                         "Lus",
+			"%d matching items.":           "%d articles correspondants.",
+			"%d feeds.":                    "%d flux.",
+			"Sort by":                      "Trier par",
+			"Last checked":                 "Dernière récupération",
+			"Errors":                       "Erreurs",
+			"%d unread":                    "%d non lus",
+			"Never":                        "Jamais",
+			"Failed %d times in a row":     "%d échecs d'affilée",
+			"Polling":                      "Récupération",
+			"Edit":                         "Modifier",
+			"Delete":                       "Supprimer",
+			"Keep its items":               "Garder ses articles",
+			"Mark its items read":          "Marquer ses articles lus",
+			"Delete its items":             "Supprimer ses articles",
+			"Log in":                       "Se connecter",
+			"Log out":                      "Se déconnecter",
+			"Password":                     "Mot de passe",
+			"Invalid email or password.":   "Courriel ou mot de passe invalide.",
+			"Published before":             "Publié avant",
+			"Mark all unread items read":   "Marquer tous les non lus comme lus",
+			"Mark read":                    "Marquer comme lu",
+			"Marked all read.":             "Tout est marqué comme lu.",
+			"Showing only %s.":             "Seulement %s.",
+			"Starred":                      "Favoris",
+			"Unstar":                       "Retirer des favoris",
+			"Star to keep":                 "Ajouter aux favoris",
+			"Fetch again":                  "Récupérer à nouveau",
+			"Related items":                "Articles similaires",
+			"Unable to fetch the article.": "Impossible de récupérer l'article.",
+			"Showing %d/%d feed items.":    "Affichage de %d/%d articles.",
+			"Archived":                     "Archivés",
+			"Unread":                       "Non lus",
+			"Mark all read":                "Tout marquer comme lu",
+			"Export":                       "Exporter",
+			"No title":                     "Sans titre",
+			"Note on why you're saving this": "Note sur la raison de cet " +
+				"enregistrement",
+			"No unread items found.": "Aucun article non lu.",
+			"Previous page":          "Page précédente",
+			"Next page":              "Page suivante",
+			"Audit log":              "Journal d'audit",
+			"The most recent administrative actions, newest first.": "Les " +
+				"dernières actions d'administration, les plus récentes d'abord.",
+			"The items you most recently marked read, newest first.": "Les " +
+				"articles marqués comme lus récemment, les plus récents d'abord.",
+			"We found problems with the feed:": "Nous avons trouvé " +
+				"des problèmes dans le flux :",
+			"You already subscribe to this feed.": "Vous êtes déjà " +
+				"abonné à ce flux.",
+			"The URL must be an http or https URL.": "L'URL doit être " +
+				"une URL http ou https.",
+			"Archive mode marks a feed's new items read as we fetch them.": "Le " +
+				"mode archive marque les nouveaux articles d'un flux comme lus " +
+				"dès leur récupération.",
+			"We still keep them, so you can find them later.": "Nous les " +
+				"conservons quand même, pour que vous puissiez les retrouver.",
+			"Too many failed logins. Try again later.": "Trop de " +
+				"connexions échouées. Réessayez plus tard.",
+			"%d marked read by archive mode": "%d lus par le " +
+				"mode archive",
+			"Save to use the suggestion.": "Enregistrez pour utiliser " +
+				"la suggestion.",
+			"We couldn't find a feed there.": "Aucun flux trouvé à " +
+				"cette adresse.",
+			"Time":                         "Heure",
+			"By":                           "Par",
+			"Action":                       "Action",
+			"Details":                      "Détails",
+			"Nothing yet.":                 "Rien pour l'instant.",
+			"just now":                     "à l'instant",
+			"%d minute ago|%d minutes ago": "il y a %d minute|il y a %d minutes",
+			"%d hour ago|%d hours ago":     "il y a %d heure|il y a %d heures",
+			"%d day ago|%d days ago":       "il y a %d jour|il y a %d jours",
+			"The page links to more than one feed:": "La page renvoie à " +
+				"plusieurs flux :",
+			"%d of your feeds keep failing to update.": "%d de vos flux " +
+				"échouent à se mettre à jour à répétition.",
+			"Full text": "Texte intégral",
+			"Full text mode fetches the articles of a feed's new items.": "Le " +
+				"mode texte intégral récupère les pages des nouveaux " +
+				"articles d'un flux.",
+			"Showing only items in %s.": "Seulement les articles dans %s.",
+			"All categories":            "Toutes les catégories",
+			"Tags":                      "Étiquettes",
+			"Each tag lists the items you gave it, whatever their state.": "Chaque " +
+				"étiquette liste les articles auxquels vous l'avez donnée, quel " +
+				"que soit leur état.",
+			"Showing items you tagged %s.": "Articles étiquetés %s.",
+			"All tags":                     "Toutes les étiquettes",
+			"Remove tag":                   "Retirer l'étiquette",
+			"Add tag":                      "Ajouter une étiquette",
+			"Rules":                        "Règles",
+			"Rules act on new items when they arrive.": "Les règles " +
+				"s'appliquent aux nouveaux articles à leur arrivée.",
+			"Patterns ignore case.":       "Les motifs ignorent la casse.",
+			"Feed":                        "Flux",
+			"If":                          "Si",
+			"Then":                        "Alors",
+			"Any feed":                    "Tous les flux",
+			"Feed %d":                     "Flux %d",
+			"Add rule":                    "Ajouter une règle",
+			"Add":                         "Ajouter",
+			"Title, link, or description": "Titre, lien ou description",
+			"Title":                       "Titre",
+			"Link":                        "Lien",
+			"Description":                 "Description",
+			"contains":                    "contient",
+			"matches the regular expression": "correspond à " +
+				"l'expression régulière",
+			"Star":  "Mettre en favori",
+			"Tag":   "Étiquette",
+			"Muted": "Masqués",
+			"Unread items containing a muted phrase are hidden.": "Les " +
+				"articles non lus contenant une expression masquée sont cachés.",
+			"New items matching a muted regular expression arrive read.": "Les " +
+				"nouveaux articles correspondant à une expression régulière " +
+				"masquée arrivent lus.",
+			"Phrase":              "Expression",
+			"New items":           "Nouveaux articles",
+			"Hide":                "Masquer",
+			"Unmute":              "Ne plus masquer",
+			"Mute":                "Masquer",
+			"Regular expression":  "Expression régulière",
+			"Mark new items read": "Marquer les nouveaux articles comme lus",
+		},
+	},
+}
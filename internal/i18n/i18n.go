@@ -0,0 +1,194 @@
+// Package i18n presents the interface in the user's language.
+//
+// Each locale has a catalog of messages. The messages are keyed by their
+// English text, so a message missing from a catalog shows in English. Locales
+// also say how to format dates.
+//
+// To add a locale, add it to locales in catalog.go.
+package i18n
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Default is the locale we use when we don't know which the user wants.
+const Default = "en"
+
+// Locale is how to present things in one language.
+type Locale struct {
+	// Tag identifies the locale, such as fr.
+	Tag string
+
+	// Name is the locale's name in its own language.
+	Name string
+
+	// dateLayout is a time layout for dates. It may contain {weekday} and
+	// {month} where the abbreviated day and month names go. This is so we can
+	// use names other than the English ones time.Format knows.
+	dateLayout string
+
+	// weekdays and months are the abbreviated names starting with Sunday and
+	// January.
+	weekdays [7]string
+	months   [12]string
+
+	// one says whether to use the singular form for the number.
+	one func(n int) bool
+
+	// messages maps English messages to this locale's. A message with a number
+	// has the singular and plural forms separated by |.
+	messages map[string]string
+}
+
+// Lookup finds the locale with the tag. The tag may have a region, such as
+// fr-CA, in which case we give the locale for its language if we have it.
+func Lookup(tag string) (*Locale, bool) {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	if l, ok := locales[tag]; ok {
+		return l, true
+	}
+	if i := strings.IndexAny(tag, "-_"); i > 0 {
+		if l, ok := locales[tag[:i]]; ok {
+			return l, true
+		}
+	}
+	return nil, false
+}
+
+// Tags lists the tags of the locales we have.
+func Tags() []string {
+	var tags []string
+	for tag := range locales {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+// Negotiate picks the locale to use from an Accept-Language header, such as
+// "fr-CA,fr;q=0.9,en;q=0.8". It gives the default locale if we have none of
+// those asked for.
+func Negotiate(acceptLanguage string) *Locale {
+	type choice struct {
+		tag     string
+		quality float64
+	}
+
+	var choices []choice
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		fields := strings.Split(part, ";")
+		c := choice{tag: strings.TrimSpace(fields[0]), quality: 1}
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if !strings.HasPrefix(param, "q=") {
+				continue
+			}
+			q, err := strconv.ParseFloat(param[2:], 64)
+			if err != nil {
+				q = 0
+			}
+			c.quality = q
+		}
+		if c.tag != "" && c.quality > 0 {
+			choices = append(choices, c)
+		}
+	}
+
+	// Stable so that equal qualities keep the order the client gave.
+	sort.SliceStable(choices, func(i, j int) bool {
+		return choices[i].quality > choices[j].quality
+	})
+
+	for _, c := range choices {
+		if l, ok := Lookup(c.tag); ok {
+			return l
+		}
+	}
+	return locales[Default]
+}
+
+// T translates the message, and formats it with the arguments as fmt.Sprintf
+// does.
+//
+// If the message has a singular and plural form separated by |, such as "%d
+// item|%d items", we choose by the first argument, which must be an int.
+func (l *Locale) T(message string, args ...interface{}) string {
+	if translated, ok := l.messages[message]; ok {
+		message = translated
+	}
+
+	if i := strings.Index(message, "|"); i != -1 {
+		n, ok := firstInt(args)
+		if ok && l.one(n) {
+			message = message[:i]
+		} else {
+			message = message[i+1:]
+		}
+	}
+
+	if len(args) == 0 {
+		return message
+	}
+	return fmt.Sprintf(message, args...)
+}
+
+func firstInt(args []interface{}) (int, bool) {
+	if len(args) == 0 {
+		return 0, false
+	}
+	n, ok := args[0].(int)
+	return n, ok
+}
+
+// FormatDate formats the time as a date and time.
+func (l *Locale) FormatDate(t time.Time) string {
+	var b strings.Builder
+	layout := l.dateLayout
+	for layout != "" {
+		i := strings.Index(layout, "{")
+		if i == -1 {
+			b.WriteString(t.Format(layout))
+			break
+		}
+		if i > 0 {
+			b.WriteString(t.Format(layout[:i]))
+		}
+		layout = layout[i:]
+
+		switch {
+		case strings.HasPrefix(layout, "{weekday}"):
+			b.WriteString(l.weekdays[t.Weekday()])
+			layout = layout[len("{weekday}"):]
+		case strings.HasPrefix(layout, "{month}"):
+			b.WriteString(l.months[t.Month()-1])
+			layout = layout[len("{month}"):]
+		default:
+			b.WriteString("{")
+			layout = layout[1:]
+		}
+	}
+	return b.String()
+}
+
+// FormatRelative formats the time relative to now, such as "2 hours ago".
+// Times more than a month ago we format as FormatDate does, as a count of days
+// is no longer helpful.
+func (l *Locale) FormatRelative(t, now time.Time) string {
+	d := now.Sub(t)
+	switch {
+	case d < time.Minute:
+		return l.T("just now")
+	case d < time.Hour:
+		return l.T("%d minute ago|%d minutes ago", int(d/time.Minute))
+	case d < 24*time.Hour:
+		return l.T("%d hour ago|%d hours ago", int(d/time.Hour))
+	case d < 30*24*time.Hour:
+		return l.T("%d day ago|%d days ago", int(d/(24*time.Hour)))
+	default:
+		return l.FormatDate(t)
+	}
+}
@@ -0,0 +1,134 @@
+package i18n
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		AcceptLanguage string
+		Tag            string
+	}{
+		{"", "en"},
+		{"fr", "fr"},
+		{"fr-CA,fr;q=0.9,en;q=0.8", "fr"},
+		{"es,de;q=0.5,fr;q=0.4", "de"},
+		{"en;q=0.5,de", "de"},
+		{"de;q=0,fr;q=0.1", "fr"},
+		{"es, pt", "en"},
+	}
+
+	for _, test := range tests {
+		if l := Negotiate(test.AcceptLanguage); l.Tag != test.Tag {
+			t.Errorf("Negotiate(%q) = %s, wanted %s", test.AcceptLanguage, l.Tag,
+				test.Tag)
+		}
+	}
+}
+
+func TestT(t *testing.T) {
+	fr, _ := Lookup("fr")
+	en, _ := Lookup("en")
+
+	tests := []struct {
+		Locale  *Locale
+		Message string
+		Args    []interface{}
+		Want    string
+	}{
+		{en, "Mark all read", nil, "Mark all read"},
+		{fr, "Mark all read", nil, "Tout marquer comme lu"},
+		{fr, "Not in the catalog", nil, "Not in the catalog"},
+		{fr, "Showing %d/%d feed items.", []interface{}{3, 10},
+			"Affichage de 3/10 articles."},
+		{en, "%d hour ago|%d hours ago", []interface{}{1}, "1 hour ago"},
+		{en, "%d hour ago|%d hours ago", []interface{}{0}, "0 hours ago"},
+		{fr, "%d hour ago|%d hours ago", []interface{}{0}, "il y a 0 heure"},
+		{fr, "%d hour ago|%d hours ago", []interface{}{2}, "il y a 2 heures"},
+	}
+
+	for _, test := range tests {
+		if got := test.Locale.T(test.Message, test.Args...); got != test.Want {
+			t.Errorf("%s: T(%q, %v) = %q, wanted %q", test.Locale.Tag,
+				test.Message, test.Args, got, test.Want)
+		}
+	}
+}
+
+func TestFormatDate(t *testing.T) {
+	date := time.Date(2020, 3, 1, 14, 5, 0, 0, time.UTC)
+
+	tests := []struct {
+		Tag  string
+		Want string
+	}{
+		{"en", "Sun, 01 Mar 2020 14:05:00 +0000"},
+		{"de", "So., 1. März 2020, 14:05"},
+		{"fr", "dim. 1 mars 2020 14:05"},
+	}
+
+	for _, test := range tests {
+		l, ok := Lookup(test.Tag)
+		if !ok {
+			t.Fatalf("Lookup(%s) found nothing", test.Tag)
+		}
+		if got := l.FormatDate(date); got != test.Want {
+			t.Errorf("%s: FormatDate() = %q, wanted %q", test.Tag, got, test.Want)
+		}
+	}
+}
+
+func TestFormatRelative(t *testing.T) {
+	now := time.Date(2020, 3, 1, 14, 5, 0, 0, time.UTC)
+	en, _ := Lookup("en-GB")
+
+	tests := []struct {
+		Ago  time.Duration
+		Want string
+	}{
+		{-time.Minute, "just now"},
+		{30 * time.Second, "just now"},
+		{time.Minute, "1 minute ago"},
+		{2*time.Hour + 30*time.Minute, "2 hours ago"},
+		{3 * 24 * time.Hour, "3 days ago"},
+		{90 * 24 * time.Hour, "Mon, 02 Dec 2019 14:05:00 +0000"},
+	}
+
+	for _, test := range tests {
+		if got := en.FormatRelative(now.Add(-test.Ago), now); got != test.Want {
+			t.Errorf("FormatRelative(%s ago) = %q, wanted %q", test.Ago, got,
+				test.Want)
+		}
+	}
+}
+
+// Each locale translates the same messages so that none is left partly in
+// English.
+func TestCatalogsTranslateSameMessages(t *testing.T) {
+	en := locales[Default]
+	for _, tag := range Tags() {
+		l := locales[tag]
+		if l == en {
+			continue
+		}
+		for _, other := range Tags() {
+			if other == tag || locales[other] == en {
+				continue
+			}
+			for message := range locales[other].messages {
+				if _, ok := l.messages[message]; !ok {
+					t.Errorf("%s has no translation of %q, which %s has", tag,
+						message, other)
+				}
+			}
+		}
+		for message, translated := range l.messages {
+			if strings.Count(message, "|") != strings.Count(translated, "|") {
+				t.Errorf("%s: %q has different plural forms to %q", tag, translated,
+					message)
+			}
+		}
+	}
+}
@@ -0,0 +1,240 @@
+// Package notify posts new items to chats, such as on Telegram or Slack, so
+// that people hear about items they care about as they arrive.
+//
+// The poller posts each feed's new items after it updates the feed. We post
+// the items from one update in one message rather than one message each so
+// that a busy feed doesn't flood the chat.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/horgh/gorse"
+)
+
+// Services we can post to.
+const (
+	Slack    = "slack"
+	Telegram = "telegram"
+)
+
+// telegramURL is where Telegram's Bot API is if the notifier doesn't say.
+const telegramURL = "https://api.telegram.org"
+
+// timeout is how long we wait for a service.
+const timeout = 10 * time.Second
+
+// maxResponseBytes is how much of a service's response we read.
+const maxResponseBytes = 1 << 20
+
+// maxItems is the most items we list in one message. We say how many more
+// there are after them.
+const maxItems = 10
+
+// maxTitleLength is the most characters of an item's title we show.
+const maxTitleLength = 200
+
+// services holds the name of each service to show people.
+var services = map[string]string{
+	Slack:    "Slack",
+	Telegram: "Telegram",
+}
+
+// Services lists the services we can post to.
+func Services() []string {
+	var names []string
+	for service := range services {
+		names = append(names, service)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Name gives the name of the service to show people, such as Telegram.
+func Name(service string) string {
+	if name, ok := services[service]; ok {
+		return name
+	}
+	return service
+}
+
+// Check checks the notifier has what we need to post to its service.
+func Check(n gorse.Notifier) error {
+	var missing []string
+	switch n.Service {
+	case Slack:
+		if n.URL == "" {
+			missing = append(missing, "url")
+		}
+	case Telegram:
+		if n.Token == "" {
+			missing = append(missing, "token")
+		}
+		if n.ChatID == "" {
+			missing = append(missing, "chat-id")
+		}
+	default:
+		return fmt.Errorf("unknown service: %s. Use one of %s", n.Service,
+			strings.Join(Services(), ", "))
+	}
+
+	if n.URL != "" {
+		u, err := url.Parse(n.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") ||
+			u.Host == "" {
+			return fmt.Errorf("%s URL must be an http or https URL: %s",
+				Name(n.Service), n.URL)
+		}
+	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf("%s needs %s", Name(n.Service),
+			strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// Message writes the message announcing the feed's new items. We list the
+// title and link of the first few.
+func Message(feedName string, items []gorse.Item) string {
+	var b strings.Builder
+	if len(items) == 1 {
+		fmt.Fprintf(&b, "New item in %s:\n", feedName)
+	} else {
+		fmt.Fprintf(&b, "%d new items in %s:\n", len(items), feedName)
+	}
+
+	for i, item := range items {
+		if i == maxItems {
+			fmt.Fprintf(&b, "\n...and %d more.\n", len(items)-maxItems)
+			break
+		}
+		fmt.Fprintf(&b, "\n%s\n%s\n", itemTitle(&item), item.Link)
+	}
+
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// itemTitle gives the item's title as plain text on one line.
+func itemTitle(item *gorse.Item) string {
+	title := strings.Join(strings.Fields(html.UnescapeString(item.Title)), " ")
+	if title == "" {
+		return "(No title)"
+	}
+	if runes := []rune(title); len(runes) > maxTitleLength {
+		title = string(runes[:maxTitleLength]) + "..."
+	}
+	return title
+}
+
+// Send posts the text to the notifier's chat.
+func Send(ctx context.Context, client *http.Client, n gorse.Notifier,
+	text string) error {
+	if err := Check(n); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	switch n.Service {
+	case Telegram:
+		return sendToTelegram(ctx, client, n, text)
+	default:
+		return sendToSlack(ctx, client, n, text)
+	}
+}
+
+// sendToSlack posts the text to a Slack incoming webhook. We don't have Slack
+// unfurl the links as there could be many.
+//
+// See https://api.slack.com/messaging/webhooks.
+func sendToSlack(ctx context.Context, client *http.Client, n gorse.Notifier,
+	text string) error {
+	return postJSON(ctx, client, n.URL, map[string]interface{}{
+		"text":         text,
+		"unfurl_links": false,
+		"unfurl_media": false,
+	})
+}
+
+// sendToTelegram posts the text to a Telegram chat as a bot.
+//
+// See https://core.telegram.org/bots/api#sendmessage.
+func sendToTelegram(ctx context.Context, client *http.Client,
+	n gorse.Notifier, text string) error {
+	baseURL := telegramURL
+	if n.URL != "" {
+		baseURL = n.URL
+	}
+
+	return postJSON(ctx, client,
+		strings.TrimRight(baseURL, "/")+"/bot"+n.Token+"/sendMessage",
+		map[string]interface{}{
+			"chat_id":                  n.ChatID,
+			"text":                     text,
+			"disable_web_page_preview": true,
+		})
+}
+
+// postJSON posts the value as JSON to the URL. Any status but 200 is an
+// error.
+func postJSON(ctx context.Context, client *http.Client, target string,
+	v interface{}) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("encoding request: %s", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target,
+		bytes.NewReader(body))
+	if err != nil {
+		// The URL may hold a token so we don't include the error.
+		return fmt.Errorf("unable to create request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "gorse")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		// As above, we leave out the URL.
+		if err, ok := err.(*url.Error); ok {
+			return err.Err
+		}
+		return err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	respBody, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxResponseBytes))
+	if err != nil {
+		return fmt.Errorf("reading response: %s", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		// Telegram explains errors in a description. Slack responds with text.
+		var explained struct {
+			Description string `json:"description"`
+		}
+		if json.Unmarshal(respBody, &explained) == nil &&
+			explained.Description != "" {
+			return fmt.Errorf("status %s: %s", resp.Status, explained.Description)
+		}
+		return fmt.Errorf("status %s: %s", resp.Status,
+			strings.TrimSpace(string(respBody)))
+	}
+
+	return nil
+}
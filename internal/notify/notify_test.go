@@ -0,0 +1,117 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/horgh/gorse"
+	"github.com/horgh/rss"
+)
+
+func TestMessage(t *testing.T) {
+	one := []gorse.Item{
+		{Item: rss.Item{Title: "Fish &amp;\n chips",
+			Link: "https://example.com/1"}},
+	}
+	if got, want := Message("Example", one), "New item in Example:\n\n"+
+		"Fish & chips\nhttps://example.com/1"; got != want {
+		t.Errorf("Message() = %q, wanted %q", got, want)
+	}
+
+	var many []gorse.Item
+	for i := 0; i < maxItems+3; i++ {
+		many = append(many, gorse.Item{Item: rss.Item{
+			Title: fmt.Sprintf("Item %d", i),
+			Link:  fmt.Sprintf("https://example.com/%d", i),
+		}})
+	}
+	got := Message("Example", many)
+	if !strings.HasPrefix(got, "13 new items in Example:") ||
+		!strings.Contains(got, "Item 9") || strings.Contains(got, "Item 10") ||
+		!strings.HasSuffix(got, "...and 3 more.") {
+		t.Errorf("Message() of many items = %q, wanted the first %d then a count",
+			got, maxItems)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		Notifier gorse.Notifier
+		OK       bool
+	}{
+		{gorse.Notifier{Service: Slack, URL: "https://hooks.slack.com/x"}, true},
+		{gorse.Notifier{Service: Slack}, false},
+		{gorse.Notifier{Service: Slack, URL: "file:///etc/passwd"}, false},
+		{gorse.Notifier{Service: Telegram, Token: "t", ChatID: "-100"}, true},
+		{gorse.Notifier{Service: Telegram, Token: "t"}, false},
+		{gorse.Notifier{Service: "irc"}, false},
+	}
+
+	for _, test := range tests {
+		err := Check(test.Notifier)
+		if test.OK && err != nil {
+			t.Errorf("Check(%+v) = error %s", test.Notifier, err)
+		}
+		if !test.OK && err == nil {
+			t.Errorf("Check(%+v) succeeded, wanted an error", test.Notifier)
+		}
+	}
+}
+
+func TestSend(t *testing.T) {
+	var path string
+	var got map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(
+		func(rw http.ResponseWriter, request *http.Request) {
+			path = request.URL.Path
+			got = nil
+			if err := json.NewDecoder(request.Body).Decode(&got); err != nil {
+				t.Errorf("request is not JSON: %s", err)
+			}
+			if got["chat_id"] == "wrong" {
+				rw.WriteHeader(http.StatusBadRequest)
+				_, _ = rw.Write([]byte(
+					`{"ok":false,"description":"Bad Request: chat not found"}`))
+				return
+			}
+			_, _ = rw.Write([]byte(`{"ok":true}`))
+		}))
+	defer server.Close()
+
+	telegram := gorse.Notifier{
+		Service: Telegram,
+		URL:     server.URL,
+		Token:   "123:abc",
+		ChatID:  "-100",
+	}
+	if err := Send(context.Background(), server.Client(), telegram,
+		"Hi"); err != nil {
+		t.Fatalf("Send() to Telegram = error %s", err)
+	}
+	if path != "/bot123:abc/sendMessage" || got["chat_id"] != "-100" ||
+		got["text"] != "Hi" {
+		t.Errorf("Telegram got %v at %s, wanted the text for the chat", got,
+			path)
+	}
+
+	telegram.ChatID = "wrong"
+	err := Send(context.Background(), server.Client(), telegram, "Hi")
+	if err == nil || !strings.Contains(err.Error(), "chat not found") {
+		t.Errorf("Send() to the wrong chat = error %v, wanted Telegram's reason",
+			err)
+	}
+
+	slack := gorse.Notifier{Service: Slack, URL: server.URL + "/hook"}
+	if err := Send(context.Background(), server.Client(), slack,
+		"Hi"); err != nil {
+		t.Fatalf("Send() to Slack = error %s", err)
+	}
+	if path != "/hook" || got["text"] != "Hi" {
+		t.Errorf("Slack got %v at %s, wanted the text at the webhook", got, path)
+	}
+}
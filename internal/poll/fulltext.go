@@ -0,0 +1,118 @@
+package poll
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/horgh/gorse"
+)
+
+// maxFullTextItems is the most articles we fetch for a feed each time we poll
+// it. Feeds sometimes publish many items at once and we don't want to hammer
+// their hosts.
+const maxFullTextItems = 20
+
+// maxArticleBytes is how much of an article we read.
+const maxArticleBytes = 2 << 20
+
+// articleTimeout is how long we wait for an article.
+const articleTimeout = 10 * time.Second
+
+// fetchFullText fetches the articles the feed's new items link to, keeping
+// their main content as the items' reader views. This is for feeds in full
+// text mode, whose items are only summaries.
+//
+// Failing to fetch an article doesn't fail the update. We log it, and the user
+// can still open the item's reader view, which tries again. If the context
+// ends we leave the rest.
+func (p *poller) fetchFullText(ctx context.Context, feed *gorse.DBFeed,
+	items []gorse.Item) {
+	for i, item := range items {
+		if ctx.Err() != nil {
+			return
+		}
+		if i == maxFullTextItems {
+			log.Printf("Fetched the articles of only %d of %d items of feed [%s]",
+				maxFullTextItems, len(items), feed.Name)
+			return
+		}
+
+		dbCtx, cancel := WithDBTimeout(ctx, p.config)
+		dbItem, err := p.store.FindItemByLink(dbCtx, feed.ID, item.Link)
+		cancel()
+		if err != nil {
+			log.Printf("Unable to look up item [%s] of feed [%s]: %s", item.Link,
+				feed.Name, err)
+			continue
+		}
+
+		view, err := fetchArticle(ctx, item.Link)
+		if err != nil {
+			log.Printf("Unable to fetch article of item [%s] of feed [%s]: %s",
+				item.Link, feed.Name, err)
+			continue
+		}
+		view.ItemID = dbItem.ID
+		view.FetchTime = time.Now()
+
+		dbCtx, cancel = WithDBTimeout(ctx, p.config)
+		p.storeMu.Lock()
+		err = p.store.SetReaderView(dbCtx, view)
+		p.storeMu.Unlock()
+		cancel()
+		if err != nil {
+			log.Printf("Unable to record article of item [%s] of feed [%s]: %s",
+				item.Link, feed.Name, err)
+			continue
+		}
+
+		if p.config.Quiet == 0 {
+			log.Printf("Fetched article of item [%s] of feed [%s]", item.Link,
+				feed.Name)
+		}
+	}
+}
+
+// fetchArticle fetches the page at the link and finds its main content.
+func fetchArticle(ctx context.Context, link string) (gorse.ReaderView,
+	error) {
+	u, err := url.Parse(link)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return gorse.ReaderView{}, fmt.Errorf(
+			"link is not an http or https URL: %s", link)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, articleTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, link, nil)
+	if err != nil {
+		return gorse.ReaderView{}, fmt.Errorf("creating request: %s", err)
+	}
+	req.Header.Set("User-Agent", "curl/7.74.0")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return gorse.ReaderView{}, err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		return gorse.ReaderView{}, fmt.Errorf("status %s", resp.Status)
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxArticleBytes))
+	if err != nil {
+		return gorse.ReaderView{}, fmt.Errorf("reading body: %s", err)
+	}
+
+	return gorse.ExtractReaderView(body, resp.Header.Get("Content-Type"), link)
+}
@@ -0,0 +1,977 @@
+// Package poll fetches feeds and records their new items.
+//
+// gorsepoll runs it periodically through something like cron. gorse can also
+// run it itself on a schedule. See its PollIntervalSeconds setting.
+package poll
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/horgh/gorse"
+	"github.com/horgh/gorse/internal/notify"
+	"github.com/horgh/rss"
+)
+
+// Config holds how we poll.
+type Config struct {
+	Quiet int64
+
+	// Limits on what we accept from a feed. 0 means use the default.
+	MaxFeedBytes int64
+	MaxFeedItems int64
+
+	// Whether to store each item's raw XML (1) or not (0).
+	StoreRawItems int64
+
+	// How many hosts to poll feeds from at once. 0 means 1.
+	Concurrency int64
+
+	// How many times to try fetching a feed in one run when it fails for a
+	// reason that may pass, such as a timeout or a 503. 0 means use the
+	// default.
+	FetchAttempts int64
+
+	// How long to wait before trying a feed again the first time. We double
+	// it each time after. 0 means use the default.
+	RetryBackoff time.Duration
+
+	// Whether to change a feed's URI to where it permanently redirects (1) or
+	// only log that it moved (0).
+	UpdateMovedFeeds int64
+
+	// How long we wait on the database to record a feed, or for one of the
+	// other things we look up or record. If a connection stops responding, we
+	// give up rather than waiting forever. 0 means no limit.
+	DBTimeout time.Duration
+}
+
+// defaultFetchAttempts is how many times we try fetching a feed in one run
+// unless configured otherwise.
+const defaultFetchAttempts = 3
+
+// defaultRetryBackoff is how long we wait before trying a feed again the first
+// time unless configured otherwise.
+const defaultRetryBackoff = 5 * time.Second
+
+// maxRedirects is how many redirects we follow fetching a feed. This is what
+// net/http follows by default.
+const maxRedirects = 10
+
+// ProcessFeeds processes each feed that needs to be updated.
+//
+// We look at every feed, and retrieve it if it needs to be updated.
+//
+// We store the new retrieved information and update the feed's details if we
+// retrieved it.
+//
+// We poll up to config.Concurrency hosts at once. Feeds on the same host we
+// poll one after the other so as not to hammer it. Most of polling is waiting
+// on the network, so this is where polling in parallel helps. We record what
+// we fetch one feed at a time so that we never have two feeds writing to the
+// database at once. Item recording relies on seeing what is already there.
+//
+// When the context ends we stop polling once the feeds we're recording are
+// recorded. Feeds we didn't get to we poll next time. This is not an error.
+//
+// If there was an error, we return an error, otherwise we return nil.
+func ProcessFeeds(ctx context.Context, config *Config, store gorse.Store,
+	feeds []gorse.DBFeed, ignorePollTimes, ignorePublicationTimes bool) error {
+	var due []gorse.DBFeed
+	for _, feed := range feeds {
+		if shouldUpdateFeed(config, &feed, ignorePollTimes) {
+			due = append(due, feed)
+		}
+	}
+
+	p := &poller{
+		config:                 config,
+		store:                  store,
+		ignorePublicationTimes: ignorePublicationTimes,
+	}
+
+	hosts := feedsByHost(due)
+
+	workers := int(config.Concurrency)
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > len(hosts) {
+		workers = len(hosts)
+	}
+
+	queue := make(chan []gorse.DBFeed)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for hostFeeds := range queue {
+				for i := range hostFeeds {
+					if p.failed() || ctx.Err() != nil {
+						break
+					}
+					p.pollFeed(ctx, &hostFeeds[i])
+				}
+			}
+		}()
+	}
+
+	for _, hostFeeds := range hosts {
+		queue <- hostFeeds
+	}
+	close(queue)
+	wg.Wait()
+
+	if p.err != nil {
+		return p.err
+	}
+
+	if ctx.Err() != nil {
+		log.Printf("Stopped polling after updating %d/%d feed(s).", p.updated,
+			len(feeds))
+		return nil
+	}
+
+	if config.Quiet == 0 {
+		log.Printf("Updated %d/%d feed(s).", p.updated, len(feeds))
+	}
+
+	return nil
+}
+
+// feedsByHost groups the feeds by the host of their URI. We keep the feeds'
+// order, both of the groups and within them.
+func feedsByHost(feeds []gorse.DBFeed) [][]gorse.DBFeed {
+	var hosts [][]gorse.DBFeed
+	index := map[string]int{}
+
+	for _, feed := range feeds {
+		host := feed.URI
+		if u, err := url.Parse(feed.URI); err == nil && u.Host != "" {
+			host = strings.ToLower(u.Host)
+		}
+
+		i, ok := index[host]
+		if !ok {
+			i = len(hosts)
+			index[host] = i
+			hosts = append(hosts, nil)
+		}
+		hosts[i] = append(hosts[i], feed)
+	}
+
+	return hosts
+}
+
+// poller polls feeds for ProcessFeeds. Its methods may be called from several
+// goroutines at once.
+type poller struct {
+	config                 *Config
+	store                  gorse.Store
+	ignorePublicationTimes bool
+
+	// storeMu is held while we record a feed.
+	storeMu sync.Mutex
+
+	// mu protects updated and err.
+	mu sync.Mutex
+
+	// updated is how many feeds we updated.
+	updated int
+
+	// err is the first error that stops us polling, if any. We stop polling
+	// feeds after it.
+	err error
+}
+
+// failed checks whether we hit an error that stops us polling.
+func (p *poller) failed() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.err != nil
+}
+
+// fail records an error that stops us polling.
+func (p *poller) fail(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.err == nil {
+		p.err = err
+	}
+}
+
+// pollFeed fetches and records the feed.
+//
+// If fetching the feed fails for a reason that may pass, we try again a few
+// times first. See fetchFeed. We record a feed failing to update against the
+// feed, and move on. Failing to record that stops us polling. If the feed
+// permanently redirects, see moveFeed. If it is in full text mode, see
+// fetchFullText.
+//
+// If the context ends while we fetch the feed, or while we wait for another
+// feed to be recorded, we leave the feed for next time. Once we start
+// recording it we finish, so that stopping doesn't lose its items. Only
+// config.DBTimeout cuts recording short.
+func (p *poller) pollFeed(ctx context.Context, feed *gorse.DBFeed) {
+	if p.config.Quiet == 0 {
+		log.Printf("Updating feed [%s]", feed.Name)
+	}
+
+	// Track when we update the feed. We want a time just before we do so as we
+	// will only accept items after this time next time. This is the time when
+	// we poll.
+	updateTime := time.Now()
+
+	// When ignoring publication times we want to look at all of the feed's
+	// items again, so we fetch it even if it hasn't changed.
+	fetched, err := fetchFeed(ctx, p.config, feed, !p.ignorePublicationTimes)
+	if ctx.Err() != nil {
+		return
+	}
+	if err != nil {
+		err = fmt.Errorf("failed to retrieve feed: %s", err)
+	}
+
+	p.storeMu.Lock()
+	if ctx.Err() != nil {
+		p.storeMu.Unlock()
+		return
+	}
+	pollCtx := ctx
+	ctx = uncancelled{ctx}
+	recordCtx, cancelRecord := WithDBTimeout(ctx, p.config)
+	defer cancelRecord()
+
+	var recorded []gorse.Item
+	if err == nil && fetched.notModified {
+		// There's nothing new, but we did poll it successfully.
+		if p.config.Quiet == 0 {
+			log.Printf("Feed [%s] is not modified", feed.Name)
+		}
+	} else if err == nil {
+		recorded, err = p.recordFeed(recordCtx, feed, fetched)
+	}
+	if err != nil {
+		log.Printf("Failed to update feed: %s: %s", feed.Name, err)
+		// Record it so the user can see which feeds are having trouble.
+		if err := p.store.SetFeedError(recordCtx, feed.ID,
+			err.Error()); err != nil {
+			p.fail(fmt.Errorf("failed to record error of feed [%s]: %s", feed.Name,
+				err))
+		}
+		p.storeMu.Unlock()
+		return
+	}
+
+	// Record that we have performed an update of this feed. Do this after we
+	// have successfully updated the feed so as to ensure we try repeatedly in
+	// case of transient errors e.g. if network is down.
+	if err := p.store.SetFeedUpdated(recordCtx, feed.ID,
+		updateTime); err != nil {
+		p.fail(fmt.Errorf("failed to record update on feed [%s]: %s", feed.Name,
+			err))
+		p.storeMu.Unlock()
+		return
+	}
+
+	if fetched.movedTo != "" && fetched.movedTo != feed.URI {
+		p.moveFeed(recordCtx, feed, fetched.movedTo)
+	}
+
+	p.storeMu.Unlock()
+
+	if p.config.Quiet == 0 {
+		log.Printf("Updated feed [%s]", feed.Name)
+	}
+
+	// We set the items of feeds we poll the first time or that archive read,
+	// so there's nothing new to tell anyone.
+	if len(recorded) > 0 && feed.LastUpdateTime != nil && !feed.Archive {
+		notifyFeedItems(ctx, p.config, p.store, feed, recorded)
+
+		// Nor are their articles worth fetching. Stopping stops fetching these.
+		if feed.FullText {
+			p.fetchFullText(pollCtx, feed, recorded)
+		}
+	}
+
+	p.mu.Lock()
+	p.updated++
+	p.mu.Unlock()
+}
+
+// moveFeed deals with the feed permanently redirecting to the URI. We change
+// the feed's URI to it if config.UpdateMovedFeeds says to, unless another feed
+// has it. Otherwise we only log it so the user can decide. Failing to change
+// it doesn't stop us polling as we can keep following the redirect.
+func (p *poller) moveFeed(ctx context.Context, feed *gorse.DBFeed,
+	uri string) {
+	if p.config.UpdateMovedFeeds == 0 {
+		log.Printf("Feed [%s] moved permanently from %s to %s", feed.Name,
+			feed.URI, uri)
+		return
+	}
+
+	other, err := p.store.GetFeedByURI(ctx, uri)
+	if err == nil {
+		log.Printf("Feed [%s] moved permanently from %s to %s, but feed [%s] "+
+			"has that URI. Leaving it.", feed.Name, feed.URI, uri, other.Name)
+		return
+	}
+	if err != gorse.ErrNotFound {
+		log.Printf("Unable to look up feed with URI %s: %s", uri, err)
+		return
+	}
+
+	moved := *feed
+	moved.URI = uri
+	if err := p.store.UpdateFeed(ctx, moved); err != nil {
+		log.Printf("Unable to change URI of feed [%s] to %s: %s", feed.Name, uri,
+			err)
+		return
+	}
+
+	log.Printf("Feed [%s] moved permanently from %s to %s. Changed its URI.",
+		feed.Name, feed.URI, uri)
+}
+
+// recordFeed records the items of the feed we fetched along with the headers
+// to ask for it only if it changed next time.
+//
+// We record the headers only once we've recorded the items. Otherwise if
+// recording them failed we would not get to try again until the feed changed.
+func (p *poller) recordFeed(ctx context.Context, feed *gorse.DBFeed,
+	fetched *fetchedFeed) ([]gorse.Item, error) {
+	recorded, err := updateFeed(ctx, p.config, p.store, feed, fetched.body,
+		fetched.contentType, p.ignorePublicationTimes)
+	if err != nil {
+		return nil, err
+	}
+
+	if fetched.etag != feed.ETag || fetched.lastModified != feed.LastModified {
+		if err := p.store.SetFeedValidators(ctx, feed.ID, fetched.etag,
+			fetched.lastModified); err != nil {
+			return nil, fmt.Errorf("unable to record feed validators: %s", err)
+		}
+	}
+
+	return recorded, nil
+}
+
+// Check if we need to update. We may be always forcing an update. If not, we
+// decide based on when we last updated the feed.
+func shouldUpdateFeed(config *Config, feed *gorse.DBFeed,
+	ignorePollTimes bool) bool {
+	// Poll no matter what.
+	if ignorePollTimes {
+		return true
+	}
+
+	// Never updated.
+	if feed.LastUpdateTime == nil {
+		return true
+	}
+
+	timeSince := time.Since(*feed.LastUpdateTime)
+
+	return int64(timeSince.Seconds()) >= feed.UpdateFrequencySeconds
+}
+
+// updateFeed parses and stores the new items in a feed we fetched. xmlData is
+// the feed body (XML, generally) and contentType what it was served as.
+//
+// We should have already determined we need to perform an update.
+//
+// We return the items we recorded.
+func updateFeed(ctx context.Context, config *Config, store gorse.Store,
+	feed *gorse.DBFeed, xmlData []byte, contentType string,
+	ignorePublicationTimes bool) ([]gorse.Item, error) {
+	// We track the latest payload each time we fetch it. This is mainly so that
+	// I have a sample set to examine/test with.
+	//
+	// It is possible the payload isn't a valid feed at this point or that we
+	// could not process it. This is intentional. I want to be able to inspect
+	// the payload if it failed.
+	if err := store.SetFeedPayload(ctx, feed.ID, xmlData); err != nil {
+		return nil, fmt.Errorf("unable to store payload to database: %s", err)
+	}
+
+	channel, err := gorse.ParseFeed(xmlData,
+		parseOptions(config, feed, contentType, false))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse XML of feed: %s", err)
+	}
+
+	if config.Quiet == 0 {
+		log.Printf("Fetched %d item(s) for feed [%s] (%s, %s)", len(channel.Items),
+			feed.Name, channel.Type, channel.Encoding)
+		for _, warning := range channel.Warnings {
+			log.Printf("Feed [%s]: %s", feed.Name, warning)
+		}
+	}
+
+	// Determine when we accept items starting from. This is the most recent
+	// item's publication time, or the zero time if we have no items yet. See
+	// shouldRecordItem() for more information on this.
+	cutoffTime, err := store.NewestItemTime(ctx, feed.ID)
+	if err != nil {
+		return nil, fmt.Errorf("unable to determine feed cutoff time: %s: %s",
+			feed.Name, err)
+	}
+
+	if config.Quiet == 0 {
+		log.Printf("Feed [%s] cutoff time: %s", feed.Name, cutoffTime)
+	}
+
+	if err := sanityCheckFeed(channel.Items); err != nil {
+		return nil, fmt.Errorf("sanity checks failed for feed %s: %s", feed.Name,
+			err)
+	}
+
+	// Record each item in the feed.
+
+	recorded, err := recordFeedItems(ctx, config, store, feed,
+		channel.Items, cutoffTime, ignorePublicationTimes)
+	if err != nil {
+		return nil, err
+	}
+	recordedCount := len(recorded)
+
+	if config.Quiet == 0 {
+		log.Printf("Added %d/%d item(s) from feed [%s]", recordedCount,
+			len(channel.Items), feed.Name)
+	}
+
+	// Log if we recorded all items we received. Why? Because this may indicate
+	// that we missed some through not polling frequently enough.
+	if recordedCount == len(channel.Items) {
+		log.Printf("Warning: recorded all items from feed [%s] (%d/%d)", feed.Name,
+			recordedCount, len(channel.Items))
+	}
+
+	return recorded, nil
+}
+
+// notifyFeedItems posts the feed's new items to the chats of the notifiers
+// that want them. Each notifier gets one message with the items it matches.
+//
+// We've recorded the items by now, so failing to post them doesn't fail the
+// update. We log it instead.
+func notifyFeedItems(ctx context.Context, config *Config, store gorse.Store,
+	feed *gorse.DBFeed, items []gorse.Item) {
+	dbCtx, cancel := WithDBTimeout(ctx, config)
+	notifiers, err := store.FeedNotifiers(dbCtx, feed.ID)
+	cancel()
+	if err != nil {
+		log.Printf("Unable to look up notifiers of feed [%s]: %s", feed.Name, err)
+		return
+	}
+
+	for _, n := range notifiers {
+		var matching []gorse.Item
+		for i := range items {
+			if n.Matches(&items[i]) {
+				matching = append(matching, items[i])
+			}
+		}
+		if len(matching) == 0 {
+			continue
+		}
+
+		if err := notify.Send(ctx, http.DefaultClient, n,
+			notify.Message(feed.Name, matching)); err != nil {
+			log.Printf("Unable to post %d item(s) from feed [%s] to %s notifier "+
+				"%d: %s", len(matching), feed.Name, n.Service, n.ID, err)
+			continue
+		}
+
+		if config.Quiet == 0 {
+			log.Printf("Posted %d item(s) from feed [%s] to %s notifier %d",
+				len(matching), feed.Name, n.Service, n.ID)
+		}
+	}
+}
+
+// parseOptions decides how we parse a feed's payload.
+//
+// When we poll we parse leniently. We want the items even if the feed is a
+// bit broken. When we validate we parse strictly.
+func parseOptions(config *Config, feed *gorse.DBFeed, contentType string,
+	strict bool) gorse.ParseOptions {
+	return gorse.ParseOptions{
+		ContentType: contentType,
+		URL:         feed.URI,
+		MaxBytes:    config.MaxFeedBytes,
+		MaxItems:    int(config.MaxFeedItems),
+		KeepRaw:     config.StoreRawItems == 1,
+		Strict:      strict,
+	}
+}
+
+// ValidateFeeds fetches each feed and parses it strictly, reporting any
+// problems. We don't record anything.
+//
+// We return an error if any feed is not valid.
+func ValidateFeeds(ctx context.Context, config *Config,
+	feeds []gorse.DBFeed) error {
+	invalid := 0
+
+	for _, feed := range feeds {
+		fetched, err := retrieveFeed(ctx, config, &feed, false)
+		if err != nil {
+			log.Printf("Feed [%s]: %s", feed.Name, err)
+			invalid++
+			continue
+		}
+
+		channel, err := gorse.ParseFeed(fetched.body,
+			parseOptions(config, &feed, fetched.contentType, true))
+		if err != nil {
+			log.Printf("Feed [%s]: %s", feed.Name, err)
+			invalid++
+			continue
+		}
+
+		log.Printf("Feed [%s] is valid (%s, %s, %d item(s))", feed.Name,
+			channel.Type, channel.Encoding, len(channel.Items))
+	}
+
+	if invalid > 0 {
+		return fmt.Errorf("%d/%d feed(s) are not valid", invalid, len(feeds))
+	}
+
+	return nil
+}
+
+// fetchedFeed is what we got when we fetched a feed.
+type fetchedFeed struct {
+	// The raw feed content and the Content-Type header it was served with. The
+	// latter helps us decode the body if it does not declare its encoding
+	// correctly.
+	body        []byte
+	contentType string
+
+	// The ETag and Last-Modified headers it was served with.
+	etag         string
+	lastModified string
+
+	// Whether the feed is unchanged since we last fetched it. We have no body
+	// then.
+	notModified bool
+
+	// Where the feed moved to if every redirect we followed fetching it was
+	// permanent. It is blank if there were none.
+	movedTo string
+}
+
+// fetchFeed fetches the feed with retrieveFeed. If that fails for a reason
+// that may pass, we try again up to config.FetchAttempts times in all, waiting
+// config.RetryBackoff before the first retry and twice as long each time
+// after.
+func fetchFeed(ctx context.Context, config *Config, feed *gorse.DBFeed,
+	conditional bool) (*fetchedFeed, error) {
+	attempts := int(config.FetchAttempts)
+	if attempts <= 0 {
+		attempts = defaultFetchAttempts
+	}
+	backoff := config.RetryBackoff
+	if backoff <= 0 {
+		backoff = defaultRetryBackoff
+	}
+
+	for attempt := 1; ; attempt++ {
+		fetched, err := retrieveFeed(ctx, config, feed, conditional)
+		var transient *transientError
+		if err == nil || attempt >= attempts || !errors.As(err, &transient) ||
+			ctx.Err() != nil {
+			return fetched, err
+		}
+
+		if config.Quiet == 0 {
+			log.Printf("Failed to fetch feed [%s], trying again in %s: %s",
+				feed.Name, backoff, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// transientError is an error fetching a feed that may pass if we try again,
+// such as a timeout or the host being overloaded.
+type transientError struct {
+	err error
+}
+
+func (e *transientError) Error() string {
+	return e.err.Error()
+}
+
+// retrieveFeed fetches the raw feed content.
+//
+// If conditional is set, we ask for the feed only if it changed since we last
+// fetched it, going by the ETag and Last-Modified headers it was served with
+// then. This saves the host sending it again, and hosts are less likely to
+// throttle us.
+func retrieveFeed(ctx context.Context, config *Config, feed *gorse.DBFeed,
+	conditional bool) (*fetchedFeed, error) {
+	// Retrieve the feed via an HTTP call.
+
+	// NOTE: We set up a http.Transport to use TLS settings. Then we set the
+	// transport on the http.Client, and then make the request.
+	//
+	// We have to do it in this round about way rather than simply http.Get()
+	// or the like in order to pass through the TLS setting it appears.
+	//
+	// I don't actually have any TLS settings any more. I used to disable
+	// verification (one of my sites had a valid certificate).
+
+	tlsConfig := &tls.Config{}
+
+	httpTransport := &http.Transport{
+		TLSClientConfig: tlsConfig,
+	}
+
+	// If every redirect is permanent, the feed has moved.
+	movedTo := ""
+	permanent := true
+
+	httpClient := &http.Client{
+		Transport: httpTransport,
+		Timeout:   time.Second * 10,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxRedirects {
+				return fmt.Errorf("stopped after %d redirects", maxRedirects)
+			}
+			if req.Response == nil ||
+				!permanentRedirect(req.Response.StatusCode) {
+				permanent = false
+			}
+			movedTo = ""
+			if permanent {
+				movedTo = req.URL.String()
+			}
+			return nil
+		},
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, feed.URI, nil)
+	if err != nil {
+		return nil, fmt.Errorf("creating request: %w", err)
+	}
+
+	req.Header.Set("User-Agent", "curl/7.74.0")
+
+	if conditional && feed.ETag != "" {
+		req.Header.Set("If-None-Match", feed.ETag)
+	}
+	if conditional && feed.LastModified != "" {
+		req.Header.Set("If-Modified-Since", feed.LastModified)
+	}
+
+	httpResponse, err := httpClient.Do(req)
+	if err != nil {
+		return nil, &transientError{fmt.Errorf(
+			"HTTP request for feed failed. (%s): %s", feed.Name, err)}
+	}
+
+	defer func() {
+		if err := httpResponse.Body.Close(); err != nil {
+			log.Printf("HTTP response body close: %s", err)
+		}
+	}()
+
+	if conditional && httpResponse.StatusCode == http.StatusNotModified {
+		return &fetchedFeed{notModified: true, movedTo: movedTo}, nil
+	}
+
+	if httpResponse.StatusCode >= 400 {
+		err := fmt.Errorf("HTTP status %s", httpResponse.Status)
+		if transientStatus(httpResponse.StatusCode) {
+			return nil, &transientError{err}
+		}
+		return nil, err
+	}
+
+	// While we will be decoding XML, and the XML package can read directly from
+	// an io.Reader, I read it all in here for simplicity so that this fetch
+	// function does not need to worry about anything to do with XML.
+	//
+	// Read at most one byte more than we are willing to parse so we can tell if
+	// the body was too large without reading all of it.
+	maxBytes := config.MaxFeedBytes
+	if maxBytes <= 0 {
+		maxBytes = gorse.DefaultMaxFeedBytes
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(httpResponse.Body, maxBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read HTTP body: %s", err)
+	}
+
+	if int64(len(body)) > maxBytes {
+		return nil, fmt.Errorf("HTTP body is larger than %d bytes", maxBytes)
+	}
+
+	return &fetchedFeed{
+		body:         body,
+		contentType:  httpResponse.Header.Get("Content-Type"),
+		etag:         httpResponse.Header.Get("ETag"),
+		lastModified: httpResponse.Header.Get("Last-Modified"),
+		movedTo:      movedTo,
+	}, nil
+}
+
+// permanentRedirect decides whether an HTTP status says what we asked for
+// has moved for good.
+func permanentRedirect(status int) bool {
+	return status == http.StatusMovedPermanently ||
+		status == http.StatusPermanentRedirect
+}
+
+// transientStatus decides whether an HTTP status says the host can't serve
+// the feed right now rather than that it won't.
+func transientStatus(status int) bool {
+	switch status {
+	case http.StatusTooManyRequests, http.StatusInternalServerError,
+		http.StatusBadGateway, http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// Run some checks on a feed.
+//
+// I require some fields (link, even though it's optional). Check this.
+//
+// I also assume GUID and Link fields are unique in a feed. Check this.
+func sanityCheckFeed(items []gorse.Item) error {
+	links := map[string]struct{}{}
+	guids := map[string]struct{}{}
+
+	for _, item := range items {
+		// Sanity check the item's information. We require at least a link to be
+		// set. Description may be blank. We also permit title to be blank. Per spec
+		// all item elements are optional.
+		if item.Link == "" {
+			return fmt.Errorf("item has blank link: %s", item.Title)
+		}
+
+		if _, exists := links[item.Link]; exists {
+			return fmt.Errorf("feed has two items with the same link: %s", item.Link)
+		}
+
+		links[item.Link] = struct{}{}
+
+		if item.GUID == "" {
+			continue
+		}
+
+		if _, exists := guids[item.GUID]; exists {
+			return fmt.Errorf("feed has two items with the same GUID: %s", item.GUID)
+		}
+
+		guids[item.GUID] = struct{}{}
+	}
+
+	return nil
+}
+
+// recordFeedItems inserts the feed's new items into the database.
+//
+// We record them all in one transaction. This means we either record all of
+// them or none, and set their state along with them.
+//
+// We return the items we recorded.
+func recordFeedItems(ctx context.Context, config *Config, store gorse.Store,
+	feed *gorse.DBFeed, items []gorse.Item, cutoffTime time.Time,
+	ignorePublicationTimes bool) ([]gorse.Item, error) {
+	var ids []int64
+	var recordedItems []gorse.Item
+
+	if err := store.InTx(ctx, func(store gorse.Store) error {
+		for _, item := range items {
+			id, recorded, err := recordFeedItem(ctx, config, store, feed, &item,
+				cutoffTime, ignorePublicationTimes)
+			if err != nil {
+				return fmt.Errorf(
+					"failed to record feed item title [%s] for feed [%s]: %s",
+					item.Title, feed.Name, err)
+			}
+
+			if recorded {
+				ids = append(ids, id)
+				recordedItems = append(recordedItems, item)
+			}
+		}
+
+		// On first poll we set all items polled as read. Otherwise when adding a
+		// feed we get a bunch of old items all at once which is not very nice.
+		//
+		// Also if the feed is set to archive mode then it goes directly to read.
+		// We note which those are so that the user can see how many archive
+		// mode read for them.
+		if len(ids) > 0 && (feed.LastUpdateTime == nil || feed.Archive) {
+			// We are currently single user.
+			userID := 1
+			if err := store.SetItemsReadState(ctx, ids, userID,
+				gorse.Read); err != nil {
+				return fmt.Errorf("failure setting items read state: %s", err)
+			}
+		}
+		if len(ids) > 0 && feed.Archive {
+			if err := store.SetItemsArchived(ctx, ids); err != nil {
+				return fmt.Errorf("failure setting items archived: %s", err)
+			}
+		}
+
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return recordedItems, nil
+}
+
+// recordFeedItem inserts the feed item into the database.
+//
+// Return the item's ID, whether we actually performed an insert, and if there
+// was an error.
+func recordFeedItem(ctx context.Context, config *Config, store gorse.Store,
+	feed *gorse.DBFeed, item *gorse.Item, cutoffTime time.Time,
+	ignorePublicationTimes bool) (int64, bool, error) {
+	record, err := shouldRecordItem(ctx, config, store, feed, &item.Item,
+		cutoffTime, ignorePublicationTimes)
+	if err != nil {
+		return -1, false, fmt.Errorf("unable to decide whether to record item: %s",
+			err)
+	}
+
+	if !record {
+		return -1, false, nil
+	}
+
+	id, err := store.AddItem(ctx, feed.ID, item)
+	if err != nil {
+		return -1, false, err
+	}
+
+	if config.Quiet == 0 {
+		log.Printf("Added item with title [%s] to feed [%s]", item.Title, feed.Name)
+	}
+
+	return id, true, nil
+}
+
+// Decide whether we should record the feed item into the database.
+//
+// If we've never polled a feed yet then we always need to record it.
+//
+// Check whether we have it recorded. Look up both by GUID and by link. If it's
+// present either way then say we have it already.
+//
+// If we don't have it and if it has a GUID, record it. Trust the GUID.
+//
+// If there's no GUID then decide using the publication date.
+//
+// The item's publication date must be on or after the cut off time. The cut
+// off time is the publication date of the newest item we have from the feed.
+//
+// We skip items based on publication date because occasionally feeds mass
+// update their links. There is a risk of mass adding items due to that.
+func shouldRecordItem(ctx context.Context, config *Config, store gorse.Items,
+	feed *gorse.DBFeed, item *rss.Item, cutoffTime time.Time,
+	ignorePublicationTimes bool) (bool, error) {
+	// Have we never polled the feed yet? By definition then we need to record all
+	// its items.
+	if feed.LastUpdateTime == nil {
+		return true, nil
+	}
+
+	exists, err := store.ItemExistsByLink(ctx, feed.ID, item.Link)
+	if err != nil {
+		return false, fmt.Errorf("failed to check if item exists by link: %s", err)
+	}
+
+	if exists {
+		return false, nil
+	}
+
+	if item.GUID != "" {
+		exists, err := store.ItemExistsByGUID(ctx, feed.ID, item.GUID)
+		if err != nil {
+			return false, fmt.Errorf("failed to check if item exists by guid: %s",
+				err)
+		}
+
+		if exists {
+			log.Printf("Item exists by GUID but not by link: %s: %s", feed.Name,
+				item.Title)
+			return false, nil
+		}
+	}
+
+	// It looks like we don't have it stored. Potentially store it.
+
+	// If it has a GUID then rely on it over publication date.
+	if item.GUID != "" {
+		return true, nil
+	}
+
+	// Decide based on its publication date.
+
+	if ignorePublicationTimes {
+		return true, nil
+	}
+
+	if item.PubDate.Before(cutoffTime) {
+		// I want to always log that this happened, not only in verbose mode. I want
+		// to see if there are items that are missed due to using a hard cutoff as
+		// I may need to reconsider it if so.
+		log.Printf(
+			"Skipping recording item from feed [%s] due to its publication time (%s, cutoff time is %s): %s: %s",
+			feed.Name, item.PubDate, cutoffTime, item.Title, item.Link)
+		return false, nil
+	}
+
+	return true, nil
+}
+
+// WithDBTimeout gives a context for waiting on the database that ends after
+// config.DBTimeout, if there is a limit. Programs polling use it to look up
+// the feeds to poll too.
+func WithDBTimeout(ctx context.Context, config *Config) (context.Context,
+	context.CancelFunc) {
+	if config.DBTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, config.DBTimeout)
+}
+
+// uncancelled is a context with the values of another but that never ends. We
+// use it to finish recording a feed after we're asked to stop.
+type uncancelled struct {
+	context.Context
+}
+
+func (uncancelled) Deadline() (time.Time, bool) { return time.Time{}, false }
+
+func (uncancelled) Done() <-chan struct{} { return nil }
+
+func (uncancelled) Err() error { return nil }
@@ -0,0 +1,1494 @@
+package poll
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/horgh/gorse"
+	"github.com/horgh/gorse/internal/gorsetest"
+	"github.com/horgh/rss"
+)
+
+// Item does not exist. No GUID. Publication date is too old. No record.
+func TestShouldRecordItem0(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("unable to open mock db: %s", err)
+	}
+
+	defer func() {
+		if err := db.Close(); err != nil {
+			t.Errorf("closing db failed: %s", err)
+		}
+	}()
+
+	rows0 := sqlmock.NewRows([]string{"id"})
+	mock.ExpectPrepare(
+		`SELECT id FROM rss_item WHERE rss_feed_id = \$1 AND link = \$2`).
+		ExpectQuery().
+		WillReturnRows(rows0)
+
+	mock.ExpectClose()
+
+	config := &Config{Quiet: 1}
+	lastUpdateTime := time.Now()
+	feed := &gorse.DBFeed{LastUpdateTime: &lastUpdateTime}
+	cutoffTime := time.Now()
+	item := &rss.Item{
+		PubDate: cutoffTime.Add(-time.Duration(10) * time.Hour),
+	}
+	ignorePublicationTimes := false
+
+	record, err := shouldRecordItem(context.Background(), config,
+		gorse.NewSQLStore(db, gorse.Postgres), feed, item, cutoffTime,
+		ignorePublicationTimes)
+	if err != nil {
+		t.Fatalf("checking whether to record raised error: %s", err)
+	}
+
+	want := false
+	if record != want {
+		t.Errorf("record = %#v, wanted %#v", record, want)
+	}
+}
+
+// Item does not exist. No GUID. Publication date is too old. Force record.
+func TestShouldRecordItem1(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("unable to open mock db: %s", err)
+	}
+
+	defer func() {
+		if err := db.Close(); err != nil {
+			t.Errorf("closing db failed: %s", err)
+		}
+	}()
+
+	rows0 := sqlmock.NewRows([]string{"id"})
+	mock.ExpectPrepare(
+		`SELECT id FROM rss_item WHERE rss_feed_id = \$1 AND link = \$2`).
+		ExpectQuery().
+		WillReturnRows(rows0)
+
+	mock.ExpectClose()
+
+	config := &Config{Quiet: 1}
+	lastUpdateTime := time.Now()
+	feed := &gorse.DBFeed{LastUpdateTime: &lastUpdateTime}
+	cutoffTime := time.Now()
+	item := &rss.Item{
+		PubDate: cutoffTime.Add(-time.Duration(10) * time.Hour),
+	}
+	ignorePublicationTimes := true
+
+	record, err := shouldRecordItem(context.Background(), config,
+		gorse.NewSQLStore(db, gorse.Postgres), feed, item, cutoffTime,
+		ignorePublicationTimes)
+	if err != nil {
+		t.Fatalf("checking whether to record raised error: %s", err)
+	}
+
+	want := true
+	if record != want {
+		t.Errorf("record = %#v, wanted %#v", record, want)
+	}
+}
+
+// Item does not exist. No GUID. Publication date is okay. Record.
+func TestShouldRecordItem2(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("unable to open mock db: %s", err)
+	}
+
+	defer func() {
+		if err := db.Close(); err != nil {
+			t.Errorf("closing db failed: %s", err)
+		}
+	}()
+
+	rows0 := sqlmock.NewRows([]string{"id"})
+	mock.ExpectPrepare(
+		`SELECT id FROM rss_item WHERE rss_feed_id = \$1 AND link = \$2`).
+		ExpectQuery().
+		WillReturnRows(rows0)
+
+	mock.ExpectClose()
+
+	config := &Config{Quiet: 1}
+	lastUpdateTime := time.Now()
+	feed := &gorse.DBFeed{LastUpdateTime: &lastUpdateTime}
+	cutoffTime := time.Now()
+	item := &rss.Item{
+		PubDate: cutoffTime.Add(time.Duration(10) * time.Hour),
+	}
+	ignorePublicationTimes := false
+
+	record, err := shouldRecordItem(context.Background(), config,
+		gorse.NewSQLStore(db, gorse.Postgres), feed, item, cutoffTime,
+		ignorePublicationTimes)
+	if err != nil {
+		t.Fatalf("checking whether to record raised error: %s", err)
+	}
+
+	want := true
+	if record != want {
+		t.Errorf("record = %#v, wanted %#v", record, want)
+	}
+}
+
+// Item does not exist. GUID. Record.
+func TestShouldRecordItem3(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("unable to open mock db: %s", err)
+	}
+
+	defer func() {
+		if err := db.Close(); err != nil {
+			t.Errorf("closing db failed: %s", err)
+		}
+	}()
+
+	rows0 := sqlmock.NewRows([]string{"id"})
+	mock.ExpectPrepare(
+		`SELECT id FROM rss_item WHERE rss_feed_id = \$1 AND link = \$2`).
+		ExpectQuery().
+		WillReturnRows(rows0)
+
+	rows1 := sqlmock.NewRows([]string{"id"})
+	mock.ExpectPrepare(
+		`SELECT id FROM rss_item WHERE rss_feed_id = \$1 AND guid = \$2`).
+		ExpectQuery().
+		WillReturnRows(rows1)
+
+	mock.ExpectClose()
+
+	config := &Config{Quiet: 1}
+	lastUpdateTime := time.Now()
+	feed := &gorse.DBFeed{LastUpdateTime: &lastUpdateTime}
+	cutoffTime := time.Now()
+	item := &rss.Item{
+		GUID:    "test-guid",
+		PubDate: cutoffTime.Add(time.Duration(10) * time.Hour),
+	}
+	ignorePublicationTimes := false
+
+	record, err := shouldRecordItem(context.Background(), config,
+		gorse.NewSQLStore(db, gorse.Postgres), feed, item, cutoffTime,
+		ignorePublicationTimes)
+	if err != nil {
+		t.Fatalf("checking whether to record raised error: %s", err)
+	}
+
+	want := true
+	if record != want {
+		t.Errorf("record = %#v, wanted %#v", record, want)
+	}
+}
+
+// Item exists by GUID. No record.
+func TestShouldRecordItem4(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("unable to open mock db: %s", err)
+	}
+
+	defer func() {
+		if err := db.Close(); err != nil {
+			t.Errorf("closing db failed: %s", err)
+		}
+	}()
+
+	rows0 := sqlmock.NewRows([]string{"id"})
+	mock.ExpectPrepare(
+		`SELECT id FROM rss_item WHERE rss_feed_id = \$1 AND link = \$2`).
+		ExpectQuery().
+		WillReturnRows(rows0)
+
+	rows1 := sqlmock.NewRows([]string{"id"})
+	rows1.AddRow(1)
+	mock.ExpectPrepare(
+		`SELECT id FROM rss_item WHERE rss_feed_id = \$1 AND guid = \$2`).
+		ExpectQuery().
+		WillReturnRows(rows1)
+
+	mock.ExpectClose()
+
+	config := &Config{Quiet: 1}
+	lastUpdateTime := time.Now()
+	feed := &gorse.DBFeed{LastUpdateTime: &lastUpdateTime}
+	cutoffTime := time.Now()
+	item := &rss.Item{
+		GUID:    "test-guid",
+		PubDate: cutoffTime.Add(time.Duration(10) * time.Hour),
+	}
+	ignorePublicationTimes := false
+
+	record, err := shouldRecordItem(context.Background(), config,
+		gorse.NewSQLStore(db, gorse.Postgres), feed, item, cutoffTime,
+		ignorePublicationTimes)
+	if err != nil {
+		t.Fatalf("checking whether to record raised error: %s", err)
+	}
+
+	want := false
+	if record != want {
+		t.Errorf("record = %#v, wanted %#v", record, want)
+	}
+}
+
+// Item exists by link. No record.
+func TestShouldRecordItem5(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("unable to open mock db: %s", err)
+	}
+
+	defer func() {
+		if err := db.Close(); err != nil {
+			t.Errorf("closing db failed: %s", err)
+		}
+	}()
+
+	rows0 := sqlmock.NewRows([]string{"id"})
+	rows0.AddRow(1)
+	mock.ExpectPrepare(
+		`SELECT id FROM rss_item WHERE rss_feed_id = \$1 AND link = \$2`).
+		ExpectQuery().
+		WillReturnRows(rows0)
+
+	mock.ExpectClose()
+
+	config := &Config{Quiet: 1}
+	lastUpdateTime := time.Now()
+	feed := &gorse.DBFeed{LastUpdateTime: &lastUpdateTime}
+	cutoffTime := time.Now()
+	item := &rss.Item{
+		GUID:    "test-guid",
+		PubDate: cutoffTime.Add(time.Duration(10) * time.Hour),
+	}
+	ignorePublicationTimes := false
+
+	record, err := shouldRecordItem(context.Background(), config,
+		gorse.NewSQLStore(db, gorse.Postgres), feed, item, cutoffTime,
+		ignorePublicationTimes)
+	if err != nil {
+		t.Fatalf("checking whether to record raised error: %s", err)
+	}
+
+	want := false
+	if record != want {
+		t.Errorf("record = %#v, wanted %#v", record, want)
+	}
+}
+
+// fakeStore is a gorse.Store holding items in memory. It implements only what
+// recording items needs.
+type fakeStore struct {
+	gorse.Store
+
+	items    []gorse.Item
+	states   map[int64]gorse.ReadState
+	archived map[int64]bool
+}
+
+func (s *fakeStore) InTx(ctx context.Context,
+	fn func(gorse.Store) error) error {
+	return fn(s)
+}
+
+func (s *fakeStore) AddItem(ctx context.Context, feedID int64,
+	item *gorse.Item) (int64, error) {
+	s.items = append(s.items, *item)
+	return int64(len(s.items)), nil
+}
+
+func (s *fakeStore) ItemExistsByLink(ctx context.Context, feedID int64,
+	link string) (bool, error) {
+	for _, item := range s.items {
+		if item.Link == link {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (s *fakeStore) ItemExistsByGUID(ctx context.Context, feedID int64,
+	guid string) (bool, error) {
+	for _, item := range s.items {
+		if item.GUID == guid {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (s *fakeStore) SetItemsReadState(ctx context.Context, itemIDs []int64,
+	userID int, state gorse.ReadState) error {
+	for _, id := range itemIDs {
+		s.states[id] = state
+	}
+	return nil
+}
+
+func (s *fakeStore) SetItemsArchived(ctx context.Context,
+	itemIDs []int64) error {
+	for _, id := range itemIDs {
+		s.archived[id] = true
+	}
+	return nil
+}
+
+func TestRecordFeedItems(t *testing.T) {
+	lastUpdateTime := time.Now()
+
+	tests := []struct {
+		Name           string
+		Feed           gorse.DBFeed
+		WantedRead     bool
+		WantedArchived bool
+	}{
+		{
+			Name:       "first poll",
+			Feed:       gorse.DBFeed{},
+			WantedRead: true,
+		},
+		{
+			Name: "polled before",
+			Feed: gorse.DBFeed{LastUpdateTime: &lastUpdateTime},
+		},
+		{
+			Name: "archive",
+			Feed: gorse.DBFeed{LastUpdateTime: &lastUpdateTime,
+				Archive: true},
+			WantedRead:     true,
+			WantedArchived: true,
+		},
+	}
+
+	for _, test := range tests {
+		store := &fakeStore{
+			states:   map[int64]gorse.ReadState{},
+			archived: map[int64]bool{},
+		}
+		items := []gorse.Item{
+			{Item: rss.Item{Link: "https://example.com/1", PubDate: time.Now()}},
+			{Item: rss.Item{Link: "https://example.com/2", PubDate: time.Now()}},
+		}
+
+		recorded, err := recordFeedItems(context.Background(), &Config{Quiet: 1},
+			store, &test.Feed, items, time.Time{}, false)
+		if err != nil {
+			t.Errorf("%s: recordFeedItems() = error %s", test.Name, err)
+			continue
+		}
+
+		if len(recorded) != len(items) {
+			t.Errorf("%s: recorded %d, wanted %d", test.Name, len(recorded),
+				len(items))
+		}
+
+		for id := int64(1); id <= int64(len(items)); id++ {
+			if store.archived[id] != test.WantedArchived {
+				t.Errorf("%s: item %d archived = %t, wanted %t", test.Name, id,
+					store.archived[id], test.WantedArchived)
+			}
+
+			state, ok := store.states[id]
+			if !test.WantedRead {
+				if ok {
+					t.Errorf("%s: item %d state set to %s, wanted none", test.Name, id,
+						state)
+				}
+				continue
+			}
+			if !ok || state != gorse.Read {
+				t.Errorf("%s: item %d state = %s (set: %t), wanted %s", test.Name, id,
+					state, ok, gorse.Read)
+			}
+		}
+
+		// Recording them again does nothing as we have them.
+		if test.Feed.LastUpdateTime == nil {
+			continue
+		}
+		recorded, err = recordFeedItems(context.Background(), &Config{Quiet: 1},
+			store, &test.Feed, items, time.Time{}, false)
+		if err != nil {
+			t.Errorf("%s: second recordFeedItems() = error %s", test.Name, err)
+			continue
+		}
+		if len(recorded) != 0 {
+			t.Errorf("%s: second recordFeedItems() recorded %d, wanted 0",
+				test.Name, len(recorded))
+		}
+	}
+}
+
+func TestRecordFeedItemsIntegration(t *testing.T) {
+	for _, dbType := range gorsetest.Types {
+		t.Run(dbType, func(t *testing.T) {
+			testRecordFeedItemsIntegration(t, dbType)
+		})
+	}
+}
+
+func testRecordFeedItemsIntegration(t *testing.T, dbType string) {
+	ctx := context.Background()
+	store, _ := gorsetest.Store(t, dbType)
+
+	// We're single user. The poller sets states for user 1.
+	loaded := gorsetest.Load(t, store, gorsetest.Fixture{
+		Users: []gorsetest.User{
+			{Email: "user@example.com", Password: "password"},
+		},
+		Feeds: []gorsetest.Feed{
+			{
+				DBFeed: gorse.DBFeed{
+					Name:                   "Example",
+					URI:                    "https://example.com/feed",
+					UpdateFrequencySeconds: 3600,
+					Active:                 true,
+				},
+			},
+		},
+	})
+	userID := loaded.Users["user@example.com"]
+	if userID != 1 {
+		t.Fatalf("user ID = %d, wanted 1", userID)
+	}
+
+	now := time.Now()
+	items := []gorse.Item{
+		{Item: rss.Item{Title: "One", Link: "https://example.com/1",
+			PubDate: now.Add(-time.Hour)}},
+		{Item: rss.Item{Title: "Two", Link: "https://example.com/2",
+			PubDate: now}},
+	}
+
+	feeds, err := store.ActiveFeeds(ctx)
+	if err != nil {
+		t.Fatalf("ActiveFeeds() = error %s", err)
+	}
+	if len(feeds) != 1 {
+		t.Fatalf("ActiveFeeds() = %d feeds, wanted 1", len(feeds))
+	}
+
+	// The first poll records them all as read.
+	recorded, err := recordFeedItems(ctx, &Config{Quiet: 1}, store, &feeds[0],
+		items, time.Time{}, false)
+	if err != nil {
+		t.Fatalf("recordFeedItems() = error %s", err)
+	}
+	if len(recorded) != 2 {
+		t.Errorf("recordFeedItems() recorded %d, wanted 2", len(recorded))
+	}
+
+	if err := store.SetFeedUpdated(ctx, feeds[0].ID, now); err != nil {
+		t.Fatalf("SetFeedUpdated() = error %s", err)
+	}
+	feeds, err = store.ActiveFeeds(ctx)
+	if err != nil {
+		t.Fatalf("ActiveFeeds() = error %s", err)
+	}
+
+	// Later polls record only new items, and leave them unread.
+	items = append(items, gorse.Item{Item: rss.Item{Title: "Three",
+		Link: "https://example.com/3", GUID: "3", PubDate: now}})
+	cutoffTime, err := store.NewestItemTime(ctx, feeds[0].ID)
+	if err != nil {
+		t.Fatalf("NewestItemTime() = error %s", err)
+	}
+	recorded, err = recordFeedItems(ctx, &Config{Quiet: 1}, store, &feeds[0],
+		items, cutoffTime, false)
+	if err != nil {
+		t.Fatalf("recordFeedItems() = error %s", err)
+	}
+	if len(recorded) != 1 {
+		t.Errorf("recordFeedItems() recorded %d, wanted 1", len(recorded))
+	}
+
+	unread := gorse.Unread
+	found, err := store.FindItems(ctx, gorse.ItemFilter{
+		UserID: userID,
+		State:  &unread,
+	})
+	if err != nil {
+		t.Fatalf("FindItems() = error %s", err)
+	}
+	if len(found) != 1 || found[0].Link != "https://example.com/3" {
+		t.Errorf("FindItems() = %+v, wanted only the new item unread", found)
+	}
+}
+
+func TestProcessFeedsIntegration(t *testing.T) {
+	for _, dbType := range gorsetest.Types {
+		t.Run(dbType, func(t *testing.T) {
+			testProcessFeedsIntegration(t, dbType)
+		})
+	}
+}
+
+func testProcessFeedsIntegration(t *testing.T, dbType string) {
+	server := httptest.NewServer(http.HandlerFunc(
+		func(rw http.ResponseWriter, r *http.Request) {
+			rw.Header().Set("Content-Type", "application/rss+xml")
+			_, _ = io.WriteString(rw, `<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0">
+<channel>
+<title>Example</title>
+<link>https://example.com/</link>
+<description>Example</description>
+<item>
+<title>One</title>
+<link>https://example.com/1</link>
+<pubDate>Mon, 02 Jan 2006 15:04:05 GMT</pubDate>
+</item>
+<item>
+<title>Two</title>
+<link>https://example.com/2</link>
+<pubDate>Tue, 03 Jan 2006 15:04:05 GMT</pubDate>
+</item>
+</channel>
+</rss>
+`)
+		}))
+	defer server.Close()
+
+	ctx := context.Background()
+	store, _ := gorsetest.Store(t, dbType)
+
+	loaded := gorsetest.Load(t, store, gorsetest.Fixture{
+		Users: []gorsetest.User{
+			{Email: "user@example.com", Password: "password"},
+		},
+		Feeds: []gorsetest.Feed{
+			{
+				DBFeed: gorse.DBFeed{
+					Name:                   "Example",
+					URI:                    server.URL,
+					UpdateFrequencySeconds: 3600,
+					Active:                 true,
+				},
+			},
+		},
+	})
+
+	feeds, err := store.ActiveFeeds(ctx)
+	if err != nil {
+		t.Fatalf("ActiveFeeds() = error %s", err)
+	}
+
+	if err := ProcessFeeds(ctx, &Config{Quiet: 1}, store, feeds, false,
+		false); err != nil {
+		t.Fatalf("ProcessFeeds() = error %s", err)
+	}
+
+	items, err := store.FindItems(ctx, gorse.ItemFilter{
+		UserID: loaded.Users["user@example.com"],
+	})
+	if err != nil {
+		t.Fatalf("FindItems() = error %s", err)
+	}
+	if len(items) != 2 || items[0].Title != "Two" ||
+		items[0].ReadState != gorse.Read {
+		t.Errorf("FindItems() = %+v, wanted both items read, newest first", items)
+	}
+
+	// We polled it, so we don't again until its update frequency passes.
+	feeds, err = store.ActiveFeeds(ctx)
+	if err != nil {
+		t.Fatalf("ActiveFeeds() = error %s", err)
+	}
+	if len(feeds) != 1 || feeds[0].LastUpdateTime == nil {
+		t.Fatalf("ActiveFeeds() = %+v, wanted the feed updated", feeds)
+	}
+	if shouldUpdateFeed(&Config{}, &feeds[0], false) {
+		t.Errorf("shouldUpdateFeed() = true right after polling")
+	}
+}
+
+func TestProcessFeedsErrorIntegration(t *testing.T) {
+	for _, dbType := range gorsetest.Types {
+		t.Run(dbType, func(t *testing.T) {
+			testProcessFeedsErrorIntegration(t, dbType)
+		})
+	}
+}
+
+func testProcessFeedsErrorIntegration(t *testing.T, dbType string) {
+	server := httptest.NewServer(http.HandlerFunc(
+		func(rw http.ResponseWriter, r *http.Request) {
+			_, _ = io.WriteString(rw, "not a feed")
+		}))
+	defer server.Close()
+
+	ctx := context.Background()
+	store, _ := gorsetest.Store(t, dbType)
+
+	loaded := gorsetest.Load(t, store, gorsetest.Fixture{
+		Users: []gorsetest.User{
+			{Email: "user@example.com", Password: "password"},
+		},
+		Feeds: []gorsetest.Feed{
+			{
+				DBFeed: gorse.DBFeed{
+					Name:                   "Example",
+					URI:                    server.URL,
+					UpdateFrequencySeconds: 3600,
+					Active:                 true,
+				},
+				Subscribers: []string{"user@example.com"},
+			},
+		},
+	})
+
+	for i := 0; i < 2; i++ {
+		feeds, err := store.ActiveFeeds(ctx)
+		if err != nil {
+			t.Fatalf("ActiveFeeds() = error %s", err)
+		}
+		if err := ProcessFeeds(ctx, &Config{Quiet: 1}, store, feeds, false,
+			false); err != nil {
+			t.Fatalf("ProcessFeeds() = error %s", err)
+		}
+	}
+
+	summaries, err := store.FeedOverview(ctx,
+		loaded.Users["user@example.com"], gorse.FeedSortErrors, 1, 0)
+	if err != nil {
+		t.Fatalf("FeedOverview() = error %s", err)
+	}
+	if len(summaries) != 1 || summaries[0].ErrorCount != 2 ||
+		!strings.Contains(summaries[0].LastError, "parse") ||
+		summaries[0].LastUpdateTime != nil {
+		t.Errorf("FeedOverview() = %+v, wanted the feed failing twice",
+			summaries)
+	}
+}
+
+func TestProcessFeedsRetryIntegration(t *testing.T) {
+	for _, dbType := range gorsetest.Types {
+		t.Run(dbType, func(t *testing.T) {
+			testProcessFeedsRetryIntegration(t, dbType)
+		})
+	}
+}
+
+func testProcessFeedsRetryIntegration(t *testing.T, dbType string) {
+	var mu sync.Mutex
+	requests := map[string]int{}
+	server := httptest.NewServer(http.HandlerFunc(
+		func(rw http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			requests[r.URL.Path]++
+			n := requests[r.URL.Path]
+			mu.Unlock()
+
+			switch {
+			case r.URL.Path == "/gone":
+				http.NotFound(rw, r)
+			case r.URL.Path == "/down" || n == 1:
+				http.Error(rw, "try later", http.StatusServiceUnavailable)
+			default:
+				rw.Header().Set("Content-Type", "application/rss+xml")
+				_, _ = io.WriteString(rw, `<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0">
+<channel>
+<title>Example</title>
+<link>https://example.com/</link>
+<description>Example</description>
+<item>
+<title>One</title>
+<link>https://example.com/1</link>
+<pubDate>Mon, 02 Jan 2006 15:04:05 GMT</pubDate>
+</item>
+</channel>
+</rss>
+`)
+			}
+		}))
+	defer server.Close()
+
+	ctx := context.Background()
+	store, _ := gorsetest.Store(t, dbType)
+
+	var fixtureFeeds []gorsetest.Feed
+	for _, path := range []string{"/blip", "/down", "/gone"} {
+		fixtureFeeds = append(fixtureFeeds, gorsetest.Feed{
+			DBFeed: gorse.DBFeed{
+				Name:                   path,
+				URI:                    server.URL + path,
+				UpdateFrequencySeconds: 3600,
+				Active:                 true,
+			},
+			Subscribers: []string{"user@example.com"},
+		})
+	}
+	loaded := gorsetest.Load(t, store, gorsetest.Fixture{
+		Users: []gorsetest.User{
+			{Email: "user@example.com", Password: "password"},
+		},
+		Feeds: fixtureFeeds,
+	})
+
+	feeds, err := store.ActiveFeeds(ctx)
+	if err != nil {
+		t.Fatalf("ActiveFeeds() = error %s", err)
+	}
+	config := &Config{Quiet: 1, FetchAttempts: 3, RetryBackoff: time.Millisecond}
+	if err := ProcessFeeds(ctx, config, store, feeds, false,
+		false); err != nil {
+		t.Fatalf("ProcessFeeds() = error %s", err)
+	}
+
+	// We try again after a 503 but not after a 404.
+	want := map[string]int{"/blip": 2, "/down": 3, "/gone": 1}
+	if fmt.Sprint(requests) != fmt.Sprint(want) {
+		t.Errorf("requests = %v, wanted %v", requests, want)
+	}
+
+	summaries, err := store.FeedOverview(ctx,
+		loaded.Users["user@example.com"], gorse.FeedSortName, 10, 0)
+	if err != nil {
+		t.Fatalf("FeedOverview() = error %s", err)
+	}
+	lastErrors := map[string]string{}
+	for _, s := range summaries {
+		if s.ErrorCount > 1 {
+			t.Errorf("feed %s failed %d times, wanted once a run", s.Name,
+				s.ErrorCount)
+		}
+		lastErrors[s.Name] = s.LastError
+	}
+	if lastErrors["/blip"] != "" ||
+		!strings.Contains(lastErrors["/down"], "503") ||
+		!strings.Contains(lastErrors["/gone"], "404") {
+		t.Errorf("last errors = %q, wanted /down and /gone failing", lastErrors)
+	}
+}
+
+func TestProcessFeedsMovedIntegration(t *testing.T) {
+	for _, dbType := range gorsetest.Types {
+		t.Run(dbType, func(t *testing.T) {
+			testProcessFeedsMovedIntegration(t, dbType)
+		})
+	}
+}
+
+func testProcessFeedsMovedIntegration(t *testing.T, dbType string) {
+	server := httptest.NewServer(http.HandlerFunc(
+		func(rw http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/old":
+				http.Redirect(rw, r, "/older", http.StatusMovedPermanently)
+			case "/older":
+				http.Redirect(rw, r, "/new", http.StatusPermanentRedirect)
+			case "/temporary":
+				http.Redirect(rw, r, "/old", http.StatusFound)
+			case "/taken":
+				http.Redirect(rw, r, "/other", http.StatusMovedPermanently)
+			default:
+				rw.Header().Set("Content-Type", "application/rss+xml")
+				_, _ = io.WriteString(rw, `<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0">
+<channel>
+<title>Example</title>
+<link>https://example.com/</link>
+<description>Example</description>
+<item>
+<title>One</title>
+<link>https://example.com`+r.URL.Path+`/1</link>
+<pubDate>Mon, 02 Jan 2006 15:04:05 GMT</pubDate>
+</item>
+</channel>
+</rss>
+`)
+			}
+		}))
+	defer server.Close()
+
+	ctx := context.Background()
+	store, _ := gorsetest.Store(t, dbType)
+
+	var fixtureFeeds []gorsetest.Feed
+	for _, path := range []string{"/old", "/temporary", "/taken", "/other"} {
+		fixtureFeeds = append(fixtureFeeds, gorsetest.Feed{
+			DBFeed: gorse.DBFeed{
+				Name:                   path,
+				URI:                    server.URL + path,
+				UpdateFrequencySeconds: 3600,
+				Active:                 true,
+			},
+			Subscribers: []string{"user@example.com"},
+		})
+	}
+	loaded := gorsetest.Load(t, store, gorsetest.Fixture{
+		Users: []gorsetest.User{
+			{Email: "user@example.com", Password: "password"},
+		},
+		Feeds: fixtureFeeds,
+	})
+
+	poll := func(config *Config) map[int64]string {
+		feeds, err := store.ActiveFeeds(ctx)
+		if err != nil {
+			t.Fatalf("ActiveFeeds() = error %s", err)
+		}
+		if err := ProcessFeeds(ctx, config, store, feeds, true,
+			false); err != nil {
+			t.Fatalf("ProcessFeeds() = error %s", err)
+		}
+
+		summaries, err := store.FeedOverview(ctx,
+			loaded.Users["user@example.com"], gorse.FeedSortName, 10, 0)
+		if err != nil {
+			t.Fatalf("FeedOverview() = error %s", err)
+		}
+		uris := map[int64]string{}
+		for _, s := range summaries {
+			if s.ErrorCount != 0 {
+				t.Errorf("feed %s failed: %s", s.Name, s.LastError)
+			}
+			uris[s.ID] = s.URI
+		}
+		return uris
+	}
+
+	want := map[int64]string{}
+	for uri, id := range loaded.Feeds {
+		want[id] = uri
+	}
+
+	// By default we only log that a feed moved.
+	if got := poll(&Config{Quiet: 1}); !reflect.DeepEqual(got, want) {
+		t.Errorf("URIs = %v, wanted them unchanged %v", got, want)
+	}
+
+	// Only every redirect being permanent means the feed moved, and we leave
+	// feeds moving to another feed's URI.
+	want[loaded.Feeds[server.URL+"/old"]] = server.URL + "/new"
+	if got := poll(&Config{Quiet: 1,
+		UpdateMovedFeeds: 1}); !reflect.DeepEqual(got, want) {
+		t.Errorf("URIs = %v, wanted %v", got, want)
+	}
+}
+
+func TestProcessFeedsFullTextIntegration(t *testing.T) {
+	for _, dbType := range gorsetest.Types {
+		t.Run(dbType, func(t *testing.T) {
+			testProcessFeedsFullTextIntegration(t, dbType)
+		})
+	}
+}
+
+func testProcessFeedsFullTextIntegration(t *testing.T, dbType string) {
+	var mu sync.Mutex
+	paths := []string{"/1"}
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(
+		func(rw http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			defer mu.Unlock()
+
+			if r.URL.Path != "/feed" {
+				rw.Header().Set("Content-Type", "text/html; charset=utf-8")
+				_, _ = io.WriteString(rw, `<html><body><nav>Menu</nav>
+<article><p>The full story of `+r.URL.Path+`.</p></article></body></html>`)
+				return
+			}
+
+			rw.Header().Set("Content-Type", "application/rss+xml")
+			_, _ = io.WriteString(rw, `<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0">
+<channel>
+<title>Example</title>
+<link>`+server.URL+`/</link>
+<description>Example</description>
+`)
+			for _, path := range paths {
+				_, _ = io.WriteString(rw, `<item>
+<title>`+path+`</title>
+<link>`+server.URL+path+`</link>
+<description>A summary.</description>
+<pubDate>Mon, 02 Jan 2006 15:04:05 GMT</pubDate>
+</item>
+`)
+			}
+			_, _ = io.WriteString(rw, "</channel>\n</rss>\n")
+		}))
+	defer server.Close()
+
+	ctx := context.Background()
+	store, _ := gorsetest.Store(t, dbType)
+
+	loaded := gorsetest.Load(t, store, gorsetest.Fixture{
+		Users: []gorsetest.User{
+			{Email: "user@example.com", Password: "password"},
+		},
+		Feeds: []gorsetest.Feed{
+			{
+				DBFeed: gorse.DBFeed{
+					Name:                   "Example",
+					URI:                    server.URL + "/feed",
+					UpdateFrequencySeconds: 3600,
+					Active:                 true,
+				},
+				Subscribers: []string{"user@example.com"},
+			},
+		},
+	})
+	feedID := loaded.Feeds[server.URL+"/feed"]
+
+	if err := store.SetFeedFullText(ctx, feedID, true); err != nil {
+		t.Fatalf("SetFeedFullText() = error %s", err)
+	}
+
+	poll := func() {
+		feeds, err := store.ActiveFeeds(ctx)
+		if err != nil {
+			t.Fatalf("ActiveFeeds() = error %s", err)
+		}
+		if err := ProcessFeeds(ctx, &Config{Quiet: 1}, store, feeds, true,
+			false); err != nil {
+			t.Fatalf("ProcessFeeds() = error %s", err)
+		}
+	}
+
+	itemID := func(path string) int64 {
+		item, err := store.FindItemByLink(ctx, feedID, server.URL+path)
+		if err != nil {
+			t.Fatalf("FindItemByLink(%s) = error %s", path, err)
+		}
+		return item.ID
+	}
+
+	// The items of the first poll are set read, so we don't fetch theirs.
+	poll()
+	if _, err := store.GetReaderView(ctx,
+		itemID("/1")); err != gorse.ErrNotFound {
+		t.Errorf("GetReaderView(/1) = error %v, wanted %s", err,
+			gorse.ErrNotFound)
+	}
+
+	mu.Lock()
+	paths = append(paths, "/2")
+	mu.Unlock()
+
+	poll()
+	view, err := store.GetReaderView(ctx, itemID("/2"))
+	if err != nil {
+		t.Fatalf("GetReaderView(/2) = error %s", err)
+	}
+	content := string(view.Content)
+	if !strings.Contains(content, "The full story of /2.") ||
+		strings.Contains(content, "Menu") {
+		t.Errorf("reader view of /2 = %s, wanted the article", content)
+	}
+
+	contents, err := store.FullTextContents(ctx, []int64{itemID("/1"),
+		itemID("/2")})
+	if err != nil {
+		t.Fatalf("FullTextContents() = error %s", err)
+	}
+	if len(contents) != 1 || contents[itemID("/2")] != content {
+		t.Errorf("FullTextContents() = %v, wanted only the article of /2",
+			contents)
+	}
+}
+
+func TestProcessFeedsNotModifiedIntegration(t *testing.T) {
+	for _, dbType := range gorsetest.Types {
+		t.Run(dbType, func(t *testing.T) {
+			testProcessFeedsNotModifiedIntegration(t, dbType)
+		})
+	}
+}
+
+func testProcessFeedsNotModifiedIntegration(t *testing.T, dbType string) {
+	lastModified := "Mon, 02 Jan 2006 15:04:05 GMT"
+
+	// We serve the feed only to requests that don't already have it.
+	var mu sync.Mutex
+	var served, notModified int
+	server := httptest.NewServer(http.HandlerFunc(
+		func(rw http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			defer mu.Unlock()
+
+			if r.Header.Get("If-None-Match") == `"v1"` &&
+				r.Header.Get("If-Modified-Since") == lastModified {
+				notModified++
+				rw.WriteHeader(http.StatusNotModified)
+				return
+			}
+			served++
+
+			rw.Header().Set("Content-Type", "application/rss+xml")
+			rw.Header().Set("ETag", `"v1"`)
+			rw.Header().Set("Last-Modified", lastModified)
+			_, _ = io.WriteString(rw, `<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0">
+<channel>
+<title>Example</title>
+<link>https://example.com/</link>
+<description>Example</description>
+<item>
+<title>One</title>
+<link>https://example.com/1</link>
+<pubDate>Mon, 02 Jan 2006 15:04:05 GMT</pubDate>
+</item>
+</channel>
+</rss>
+`)
+		}))
+	defer server.Close()
+
+	ctx := context.Background()
+	store, _ := gorsetest.Store(t, dbType)
+
+	// We mark the first poll's items read for the first user.
+	gorsetest.Load(t, store, gorsetest.Fixture{
+		Users: []gorsetest.User{
+			{Email: "user@example.com", Password: "password"},
+		},
+		Feeds: []gorsetest.Feed{
+			{
+				DBFeed: gorse.DBFeed{
+					Name:                   "Example",
+					URI:                    server.URL,
+					UpdateFrequencySeconds: 3600,
+					Active:                 true,
+				},
+			},
+		},
+	})
+
+	var updated []time.Time
+	for i := 0; i < 2; i++ {
+		feeds, err := store.ActiveFeeds(ctx)
+		if err != nil {
+			t.Fatalf("ActiveFeeds() = error %s", err)
+		}
+		if err := ProcessFeeds(ctx, &Config{Quiet: 1}, store, feeds, true,
+			false); err != nil {
+			t.Fatalf("ProcessFeeds() = error %s", err)
+		}
+
+		feeds, err = store.ActiveFeeds(ctx)
+		if err != nil {
+			t.Fatalf("ActiveFeeds() = error %s", err)
+		}
+		if len(feeds) != 1 || feeds[0].LastUpdateTime == nil ||
+			feeds[0].ETag != `"v1"` || feeds[0].LastModified != lastModified {
+			t.Fatalf("ActiveFeeds() = %+v, wanted the feed updated with its "+
+				"validators", feeds)
+		}
+		updated = append(updated, *feeds[0].LastUpdateTime)
+	}
+
+	if served != 1 || notModified != 1 {
+		t.Errorf("served the feed %d time(s) and not modified %d time(s), "+
+			"wanted once each", served, notModified)
+	}
+	if !updated[1].After(updated[0]) {
+		t.Errorf("last update time went from %s to %s, wanted it later",
+			updated[0], updated[1])
+	}
+
+	// When ignoring publication times we want the feed again.
+	feeds, err := store.ActiveFeeds(ctx)
+	if err != nil {
+		t.Fatalf("ActiveFeeds() = error %s", err)
+	}
+	if err := ProcessFeeds(ctx, &Config{Quiet: 1}, store, feeds, true,
+		true); err != nil {
+		t.Fatalf("ProcessFeeds() = error %s", err)
+	}
+	if served != 2 {
+		t.Errorf("served the feed %d time(s), wanted 2", served)
+	}
+}
+
+func TestFeedsByHost(t *testing.T) {
+	feeds := []gorse.DBFeed{
+		{ID: 1, URI: "https://example.com/a"},
+		{ID: 2, URI: "https://example.org/a"},
+		{ID: 3, URI: "https://EXAMPLE.com/b"},
+		{ID: 4, URI: "https://example.com:8443/a"},
+		{ID: 5, URI: "not a url"},
+	}
+
+	var got [][]int64
+	for _, hostFeeds := range feedsByHost(feeds) {
+		var ids []int64
+		for _, feed := range hostFeeds {
+			ids = append(ids, feed.ID)
+		}
+		got = append(got, ids)
+	}
+
+	want := [][]int64{{1, 3}, {2}, {4}, {5}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("feedsByHost() = %v, wanted %v", got, want)
+	}
+}
+
+func TestWithDBTimeout(t *testing.T) {
+	ctx, cancel := WithDBTimeout(context.Background(), &Config{})
+	if _, ok := ctx.Deadline(); ok {
+		t.Errorf("without a DBTimeout the context has a deadline")
+	}
+	cancel()
+	if ctx.Err() == nil {
+		t.Errorf("cancelling the context didn't cancel it")
+	}
+
+	start := time.Now()
+	ctx, cancel = WithDBTimeout(context.Background(),
+		&Config{DBTimeout: time.Minute})
+	defer cancel()
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		t.Fatalf("with a DBTimeout the context has no deadline")
+	}
+	if deadline.Before(start.Add(time.Minute)) ||
+		deadline.After(time.Now().Add(time.Minute)) {
+		t.Errorf("deadline is %s, wanted a minute after %s", deadline, start)
+	}
+}
+
+func TestProcessFeedsConcurrentIntegration(t *testing.T) {
+	for _, dbType := range gorsetest.Types {
+		t.Run(dbType, func(t *testing.T) {
+			testProcessFeedsConcurrentIntegration(t, dbType)
+		})
+	}
+}
+
+func testProcessFeedsConcurrentIntegration(t *testing.T, dbType string) {
+	// We track how many requests each server and both together have in
+	// flight at once.
+	var mu sync.Mutex
+	inFlight, maxInFlight := 0, 0
+	serverInFlight := map[string]int{}
+	serverMaxInFlight := map[string]int{}
+
+	handler := func(name string) http.HandlerFunc {
+		return func(rw http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			inFlight++
+			if inFlight > maxInFlight {
+				maxInFlight = inFlight
+			}
+			serverInFlight[name]++
+			if serverInFlight[name] > serverMaxInFlight[name] {
+				serverMaxInFlight[name] = serverInFlight[name]
+			}
+			mu.Unlock()
+
+			time.Sleep(100 * time.Millisecond)
+
+			mu.Lock()
+			inFlight--
+			serverInFlight[name]--
+			mu.Unlock()
+
+			link := "https://example.com/" + name + r.URL.Path
+			rw.Header().Set("Content-Type", "application/rss+xml")
+			_, _ = io.WriteString(rw, `<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0">
+<channel>
+<title>Example</title>
+<link>https://example.com/</link>
+<description>Example</description>
+<item>
+<title>One</title>
+<link>`+link+`/1</link>
+<pubDate>Mon, 02 Jan 2006 15:04:05 GMT</pubDate>
+</item>
+</channel>
+</rss>
+`)
+		}
+	}
+
+	serverA := httptest.NewServer(handler("a"))
+	defer serverA.Close()
+	serverB := httptest.NewServer(handler("b"))
+	defer serverB.Close()
+
+	ctx := context.Background()
+	store, _ := gorsetest.Store(t, dbType)
+
+	var fixtureFeeds []gorsetest.Feed
+	for i, uri := range []string{
+		serverA.URL + "/1",
+		serverA.URL + "/2",
+		serverB.URL + "/1",
+	} {
+		fixtureFeeds = append(fixtureFeeds, gorsetest.Feed{
+			DBFeed: gorse.DBFeed{
+				Name:                   fmt.Sprintf("Example %d", i),
+				URI:                    uri,
+				UpdateFrequencySeconds: 3600,
+				Active:                 true,
+			},
+		})
+	}
+
+	loaded := gorsetest.Load(t, store, gorsetest.Fixture{
+		Users: []gorsetest.User{
+			{Email: "user@example.com", Password: "password"},
+		},
+		Feeds: fixtureFeeds,
+	})
+
+	feeds, err := store.ActiveFeeds(ctx)
+	if err != nil {
+		t.Fatalf("ActiveFeeds() = error %s", err)
+	}
+
+	if err := ProcessFeeds(ctx, &Config{Quiet: 1, Concurrency: 4}, store,
+		feeds, false, false); err != nil {
+		t.Fatalf("ProcessFeeds() = error %s", err)
+	}
+
+	if maxInFlight != 2 {
+		t.Errorf("polled %d feed(s) at once, wanted 2", maxInFlight)
+	}
+	for name, max := range serverMaxInFlight {
+		if max != 1 {
+			t.Errorf("polled %d feed(s) from server %s at once, wanted 1", max,
+				name)
+		}
+	}
+
+	items, err := store.FindItems(ctx, gorse.ItemFilter{
+		UserID: loaded.Users["user@example.com"],
+	})
+	if err != nil {
+		t.Fatalf("FindItems() = error %s", err)
+	}
+	if len(items) != 3 {
+		t.Errorf("FindItems() = %+v, wanted an item from each feed", items)
+	}
+
+	feeds, err = store.ActiveFeeds(ctx)
+	if err != nil {
+		t.Fatalf("ActiveFeeds() = error %s", err)
+	}
+	for _, feed := range feeds {
+		if feed.LastUpdateTime == nil {
+			t.Errorf("feed [%s] was not updated", feed.Name)
+		}
+	}
+}
+
+func TestProcessFeedsStopIntegration(t *testing.T) {
+	for _, dbType := range gorsetest.Types {
+		t.Run(dbType, func(t *testing.T) {
+			testProcessFeedsStopIntegration(t, dbType)
+		})
+	}
+}
+
+func testProcessFeedsStopIntegration(t *testing.T, dbType string) {
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+
+	// We're stopped while fetching the second feed, so we should record the
+	// first and never fetch the third.
+	var mu sync.Mutex
+	var requested []string
+	server := httptest.NewServer(http.HandlerFunc(
+		func(rw http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			requested = append(requested, r.URL.Path)
+			mu.Unlock()
+
+			if r.URL.Path == "/2" {
+				stop()
+				<-r.Context().Done()
+				return
+			}
+
+			rw.Header().Set("Content-Type", "application/rss+xml")
+			_, _ = io.WriteString(rw, `<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0">
+<channel>
+<title>Example</title>
+<item>
+<title>One</title>
+<link>https://example.com`+r.URL.Path+`/1</link>
+<pubDate>Mon, 02 Jan 2006 15:04:05 GMT</pubDate>
+</item>
+</channel>
+</rss>
+`)
+		}))
+	defer server.Close()
+
+	store, _ := gorsetest.Store(t, dbType)
+
+	var fixtureFeeds []gorsetest.Feed
+	for i := 1; i <= 3; i++ {
+		fixtureFeeds = append(fixtureFeeds, gorsetest.Feed{
+			DBFeed: gorse.DBFeed{
+				Name:                   fmt.Sprintf("Example %d", i),
+				URI:                    fmt.Sprintf("%s/%d", server.URL, i),
+				UpdateFrequencySeconds: 3600,
+				Active:                 true,
+			},
+			Subscribers: []string{"user@example.com"},
+		})
+	}
+
+	loaded := gorsetest.Load(t, store, gorsetest.Fixture{
+		Users: []gorsetest.User{
+			{Email: "user@example.com", Password: "password"},
+		},
+		Feeds: fixtureFeeds,
+	})
+
+	feeds, err := store.ActiveFeeds(context.Background())
+	if err != nil {
+		t.Fatalf("ActiveFeeds() = error %s", err)
+	}
+
+	if err := ProcessFeeds(ctx, &Config{Quiet: 1}, store, feeds, false,
+		false); err != nil {
+		t.Fatalf("ProcessFeeds() = error %s", err)
+	}
+
+	if !reflect.DeepEqual(requested, []string{"/1", "/2"}) {
+		t.Errorf("requested %q, wanted /1 and /2", requested)
+	}
+
+	summaries, err := store.FeedOverview(context.Background(),
+		loaded.Users["user@example.com"], gorse.FeedSortName, 3, 0)
+	if err != nil {
+		t.Fatalf("FeedOverview() = error %s", err)
+	}
+	if len(summaries) != 3 {
+		t.Fatalf("FeedOverview() = %+v, wanted 3 feeds", summaries)
+	}
+	for _, summary := range summaries {
+		updated := summary.Name == "Example 1"
+		if (summary.LastUpdateTime != nil) != updated ||
+			summary.ErrorCount != 0 {
+			t.Errorf("feed [%s] = %+v, wanted updated %t and no errors",
+				summary.Name, summary, updated)
+		}
+	}
+}
+
+func TestNotifyFeedItemsIntegration(t *testing.T) {
+	for _, dbType := range gorsetest.Types {
+		t.Run(dbType, func(t *testing.T) {
+			testNotifyFeedItemsIntegration(t, dbType)
+		})
+	}
+}
+
+func testNotifyFeedItemsIntegration(t *testing.T, dbType string) {
+	items := `<item><title>One</title><link>https://example.com/1</link>
+<guid>1</guid></item>`
+	feedServer := httptest.NewServer(http.HandlerFunc(
+		func(rw http.ResponseWriter, r *http.Request) {
+			rw.Header().Set("Content-Type", "application/rss+xml")
+			_, _ = io.WriteString(rw, `<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0"><channel><title>Example</title>
+<link>https://example.com/</link><description>Example</description>
+`+items+`</channel></rss>`)
+		}))
+	defer feedServer.Close()
+
+	var messages []string
+	slack := httptest.NewServer(http.HandlerFunc(
+		func(rw http.ResponseWriter, r *http.Request) {
+			var message struct {
+				Text string `json:"text"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&message); err != nil {
+				t.Errorf("request is not JSON: %s", err)
+			}
+			messages = append(messages, message.Text)
+			_, _ = io.WriteString(rw, "ok")
+		}))
+	defer slack.Close()
+
+	ctx := context.Background()
+	store, _ := gorsetest.Store(t, dbType)
+
+	loaded := gorsetest.Load(t, store, gorsetest.Fixture{
+		Users: []gorsetest.User{
+			{Email: "user@example.com", Password: "password"},
+		},
+		Feeds: []gorsetest.Feed{
+			{
+				DBFeed: gorse.DBFeed{
+					Name:                   "Example",
+					URI:                    feedServer.URL,
+					UpdateFrequencySeconds: 3600,
+					Active:                 true,
+				},
+				Subscribers: []string{"user@example.com"},
+			},
+		},
+	})
+
+	if _, err := store.AddNotifier(ctx, gorse.Notifier{
+		UserID:  loaded.Users["user@example.com"],
+		Match:   "fish",
+		Service: "slack",
+		URL:     slack.URL,
+	}); err != nil {
+		t.Fatalf("AddNotifier() = error %s", err)
+	}
+
+	poll := func() {
+		feeds, err := store.ActiveFeeds(ctx)
+		if err != nil {
+			t.Fatalf("ActiveFeeds() = error %s", err)
+		}
+		if err := ProcessFeeds(ctx, &Config{Quiet: 1}, store, feeds, true,
+			false); err != nil {
+			t.Fatalf("ProcessFeeds() = error %s", err)
+		}
+	}
+
+	// We don't post what we find the first time we poll a feed.
+	poll()
+	if len(messages) != 0 {
+		t.Errorf("posted %q after the first poll, wanted nothing", messages)
+	}
+
+	items += `<item><title>Fish</title><link>https://example.com/2</link>
+<guid>2</guid></item>
+<item><title>Chips</title><link>https://example.com/3</link>
+<guid>3</guid></item>
+<item><title>Two</title><link>https://example.com/4</link>
+<description>About fish</description><guid>4</guid></item>`
+	poll()
+	if len(messages) != 1 ||
+		!strings.HasPrefix(messages[0], "2 new items in Example") ||
+		!strings.Contains(messages[0], "https://example.com/2") ||
+		strings.Contains(messages[0], "Chips") ||
+		!strings.Contains(messages[0], "https://example.com/4") {
+		t.Errorf("posted %q, wanted one message with the items about fish",
+			messages)
+	}
+}
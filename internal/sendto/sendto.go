@@ -0,0 +1,260 @@
+// Package sendto sends items to services for reading later, such as Pocket
+// and Wallabag. This is for people whose long-form reading happens there
+// rather than in gorse.
+package sendto
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/horgh/gorse"
+)
+
+// Services we can send to.
+const (
+	Pocket   = "pocket"
+	Wallabag = "wallabag"
+)
+
+// pocketURL is where Pocket's API is if the integration doesn't say.
+const pocketURL = "https://getpocket.com"
+
+// timeout is how long we wait for a service.
+const timeout = 10 * time.Second
+
+// maxResponseBytes is how much of a service's response we read.
+const maxResponseBytes = 1 << 20
+
+// services holds the name of each service to show people.
+var services = map[string]string{
+	Pocket:   "Pocket",
+	Wallabag: "Wallabag",
+}
+
+// Services lists the services we can send to.
+func Services() []string {
+	var names []string
+	for service := range services {
+		names = append(names, service)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Name gives the name of the service to show people, such as Pocket.
+func Name(service string) string {
+	if name, ok := services[service]; ok {
+		return name
+	}
+	return service
+}
+
+// Check checks the integration has what we need to send to its service.
+func Check(integration gorse.Integration) error {
+	var missing []string
+	switch integration.Service {
+	case Pocket:
+		if integration.ClientID == "" {
+			missing = append(missing, "consumer-key")
+		}
+		if integration.AccessToken == "" {
+			missing = append(missing, "access-token")
+		}
+	case Wallabag:
+		if integration.URL == "" {
+			missing = append(missing, "url")
+		}
+		if integration.ClientID == "" {
+			missing = append(missing, "client-id")
+		}
+		if integration.ClientSecret == "" {
+			missing = append(missing, "client-secret")
+		}
+		if integration.Username == "" {
+			missing = append(missing, "username")
+		}
+		if integration.Password == "" {
+			missing = append(missing, "password")
+		}
+	default:
+		return fmt.Errorf("unknown service: %s. Use one of %s",
+			integration.Service, strings.Join(Services(), ", "))
+	}
+
+	if integration.URL != "" {
+		u, err := url.Parse(integration.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") ||
+			u.Host == "" {
+			return fmt.Errorf("%s URL must be an http or https URL: %s",
+				Name(integration.Service), integration.URL)
+		}
+	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf("%s needs %s", Name(integration.Service),
+			strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// Send sends the link to the integration's service.
+func Send(ctx context.Context, client *http.Client,
+	integration gorse.Integration, link, title string) error {
+	if err := Check(integration); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	switch integration.Service {
+	case Pocket:
+		return sendToPocket(ctx, client, integration, link, title)
+	default:
+		return sendToWallabag(ctx, client, integration, link, title)
+	}
+}
+
+// sendToPocket adds the link to the user's Pocket list.
+//
+// See https://getpocket.com/developer/docs/v3/add.
+func sendToPocket(ctx context.Context, client *http.Client,
+	integration gorse.Integration, link, title string) error {
+	body, err := json.Marshal(map[string]string{
+		"url":          link,
+		"title":        title,
+		"consumer_key": integration.ClientID,
+		"access_token": integration.AccessToken,
+	})
+	if err != nil {
+		return fmt.Errorf("encoding request: %s", err)
+	}
+
+	baseURL := pocketURL
+	if integration.URL != "" {
+		baseURL = integration.URL
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost,
+		strings.TrimRight(baseURL, "/")+"/v3/add", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("creating request: %s", err)
+	}
+	req.Header.Set("Content-Type", "application/json; charset=UTF-8")
+	req.Header.Set("X-Accept", "application/json")
+
+	// Pocket explains errors in a header rather than the body.
+	_, err = do(client, req, func(resp *http.Response) string {
+		return resp.Header.Get("X-Error")
+	})
+	return err
+}
+
+// sendToWallabag adds the link to the user's Wallabag entries.
+//
+// Wallabag's API needs an access token. We get a new one each time with the
+// user's login rather than keeping it and its refresh token. Sending is rare
+// enough that this is no burden.
+//
+// See https://doc.wallabag.org/en/developer/api/oauth.html.
+func sendToWallabag(ctx context.Context, client *http.Client,
+	integration gorse.Integration, link, title string) error {
+	baseURL := strings.TrimRight(integration.URL, "/")
+
+	form := url.Values{}
+	form.Set("grant_type", "password")
+	form.Set("client_id", integration.ClientID)
+	form.Set("client_secret", integration.ClientSecret)
+	form.Set("username", integration.Username)
+	form.Set("password", integration.Password)
+
+	req, err := newFormRequest(ctx, baseURL+"/oauth/v2/token", form)
+	if err != nil {
+		return err
+	}
+
+	body, err := do(client, req, nil)
+	if err != nil {
+		return fmt.Errorf("unable to get access token: %s", err)
+	}
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.Unmarshal(body, &token); err != nil {
+		return fmt.Errorf("unable to decode access token: %s", err)
+	}
+	if token.AccessToken == "" {
+		return fmt.Errorf("no access token in response")
+	}
+
+	form = url.Values{}
+	form.Set("url", link)
+	if title != "" {
+		form.Set("title", title)
+	}
+
+	req, err = newFormRequest(ctx, baseURL+"/api/entries.json", form)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token.AccessToken)
+
+	if _, err := do(client, req, nil); err != nil {
+		return fmt.Errorf("unable to add entry: %s", err)
+	}
+	return nil
+}
+
+// newFormRequest makes a request to POST the form to the URL.
+func newFormRequest(ctx context.Context, target string,
+	form url.Values) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target,
+		strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("creating request: %s", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	return req, nil
+}
+
+// do makes the request and returns the response body. Any status but 200 is
+// an error. explain, if set, gives why the service says the request failed.
+func do(client *http.Client, req *http.Request,
+	explain func(*http.Response) string) ([]byte, error) {
+	req.Header.Set("User-Agent", "gorse")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxResponseBytes))
+	if err != nil {
+		return nil, fmt.Errorf("reading response: %s", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		if explain != nil {
+			if reason := explain(resp); reason != "" {
+				return nil, fmt.Errorf("status %s: %s", resp.Status, reason)
+			}
+		}
+		return nil, fmt.Errorf("status %s", resp.Status)
+	}
+
+	return body, nil
+}
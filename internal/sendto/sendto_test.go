@@ -0,0 +1,134 @@
+package sendto
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/horgh/gorse"
+)
+
+func TestSendToPocket(t *testing.T) {
+	var got map[string]string
+	server := httptest.NewServer(http.HandlerFunc(
+		func(rw http.ResponseWriter, request *http.Request) {
+			if request.URL.Path != "/v3/add" {
+				t.Errorf("request to %s, wanted /v3/add", request.URL.Path)
+			}
+			if err := json.NewDecoder(request.Body).Decode(&got); err != nil {
+				t.Errorf("request is not JSON: %s", err)
+			}
+			if got["access_token"] != "token" {
+				rw.Header().Set("X-Error", "Invalid access token")
+				rw.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			_, _ = rw.Write([]byte(`{"status":1}`))
+		}))
+	defer server.Close()
+
+	integration := gorse.Integration{
+		Service:     Pocket,
+		URL:         server.URL,
+		ClientID:    "key",
+		AccessToken: "token",
+	}
+
+	if err := Send(context.Background(), server.Client(), integration,
+		"https://example.com/a", "A"); err != nil {
+		t.Fatalf("Send() = error %s", err)
+	}
+	if got["url"] != "https://example.com/a" || got["title"] != "A" ||
+		got["consumer_key"] != "key" {
+		t.Errorf("Pocket got %v, wanted the link with our consumer key", got)
+	}
+
+	integration.AccessToken = "wrong"
+	err := Send(context.Background(), server.Client(), integration,
+		"https://example.com/a", "A")
+	if err == nil || !strings.Contains(err.Error(), "Invalid access token") {
+		t.Errorf("Send() with wrong token = error %v, wanted Pocket's reason",
+			err)
+	}
+}
+
+func TestSendToWallabag(t *testing.T) {
+	var entry string
+	server := httptest.NewServer(http.HandlerFunc(
+		func(rw http.ResponseWriter, request *http.Request) {
+			if err := request.ParseForm(); err != nil {
+				t.Errorf("ParseForm() = error %s", err)
+			}
+			switch request.URL.Path {
+			case "/oauth/v2/token":
+				if request.PostForm.Get("grant_type") != "password" ||
+					request.PostForm.Get("password") != "secret" {
+					rw.WriteHeader(http.StatusBadRequest)
+					return
+				}
+				_, _ = rw.Write([]byte(`{"access_token":"abc"}`))
+			case "/api/entries.json":
+				if request.Header.Get("Authorization") != "Bearer abc" {
+					rw.WriteHeader(http.StatusUnauthorized)
+					return
+				}
+				entry = request.PostForm.Get("url")
+				_, _ = rw.Write([]byte(`{"id":1}`))
+			default:
+				rw.WriteHeader(http.StatusNotFound)
+			}
+		}))
+	defer server.Close()
+
+	integration := gorse.Integration{
+		Service:      Wallabag,
+		URL:          server.URL + "/",
+		ClientID:     "id",
+		ClientSecret: "client secret",
+		Username:     "user",
+		Password:     "secret",
+	}
+
+	if err := Send(context.Background(), server.Client(), integration,
+		"https://example.com/b", "B"); err != nil {
+		t.Fatalf("Send() = error %s", err)
+	}
+	if entry != "https://example.com/b" {
+		t.Errorf("Wallabag got entry %q, wanted the link", entry)
+	}
+
+	integration.Password = "wrong"
+	if err := Send(context.Background(), server.Client(), integration,
+		"https://example.com/b", "B"); err == nil {
+		t.Error("Send() with wrong password succeeded")
+	}
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		Integration gorse.Integration
+		OK          bool
+	}{
+		{gorse.Integration{Service: Pocket, ClientID: "k", AccessToken: "t"},
+			true},
+		{gorse.Integration{Service: Pocket, ClientID: "k"}, false},
+		{gorse.Integration{Service: Wallabag, URL: "https://w.example.com",
+			ClientID: "i", ClientSecret: "s", Username: "u", Password: "p"}, true},
+		{gorse.Integration{Service: Wallabag, URL: "w.example.com",
+			ClientID: "i", ClientSecret: "s", Username: "u", Password: "p"}, false},
+		{gorse.Integration{Service: "instapaper"}, false},
+	}
+
+	for _, test := range tests {
+		err := Check(test.Integration)
+		if test.OK && err != nil {
+			t.Errorf("Check(%+v) = error %s", test.Integration, err)
+		}
+		if !test.OK && err == nil {
+			t.Errorf("Check(%+v) succeeded, wanted an error", test.Integration)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+// Package version reports which build of gorse is running.
+//
+// Builds set these with the linker, such as:
+//
+//	go build -ldflags "-X github.com/horgh/gorse/internal/version.Version=1.0 \
+//	  -X github.com/horgh/gorse/internal/version.Commit=$(git rev-parse HEAD) \
+//	  -X github.com/horgh/gorse/internal/version.BuildDate=$(date -u +%FT%TZ)"
+//
+// cmd/gorse's Makefile does this.
+package version
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+)
+
+// These describe the build. They are blank unless set when building.
+var (
+	Version   string
+	Commit    string
+	BuildDate string
+)
+
+// Info is what we know about the build.
+type Info struct {
+	Version   string
+	Commit    string
+	BuildDate string
+	GoVersion string
+}
+
+// Get returns what we know about the build. If the version wasn't set when
+// building, we use the module version Go recorded, such as when installed
+// with go install.
+func Get() Info {
+	info := Info{
+		Version:   Version,
+		Commit:    Commit,
+		BuildDate: BuildDate,
+		GoVersion: runtime.Version(),
+	}
+
+	if info.Version == "" {
+		if build, ok := debug.ReadBuildInfo(); ok {
+			info.Version = build.Main.Version
+		}
+	}
+
+	for _, s := range []*string{&info.Version, &info.Commit, &info.BuildDate} {
+		if *s == "" {
+			*s = "unknown"
+		}
+	}
+
+	return info
+}
+
+// String describes the build on one line.
+func (i Info) String() string {
+	return fmt.Sprintf("%s (commit %s, built %s with %s)", i.Version, i.Commit,
+		i.BuildDate, i.GoVersion)
+}
@@ -0,0 +1,24 @@
+package version
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGet(t *testing.T) {
+	Version, Commit, BuildDate = "1.2.3", "abc123", "2020-01-02T03:04:05Z"
+	defer func() {
+		Version, Commit, BuildDate = "", "", ""
+	}()
+
+	info := Get()
+	want := "1.2.3 (commit abc123, built 2020-01-02T03:04:05Z with go"
+	if got := info.String(); !strings.HasPrefix(got, want) {
+		t.Errorf("String() = %q, wanted it to start with %q", got, want)
+	}
+
+	Commit = ""
+	if info := Get(); info.Commit != "unknown" {
+		t.Errorf("Get() commit = %q, wanted unknown", info.Commit)
+	}
+}
@@ -0,0 +1,364 @@
+package gorse
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ItemFilter decides which items FindItems, SearchItems, and CountItems find.
+//
+// Zero values mean not to filter on that field. We never find items of deleted
+// feeds unless the user starred them.
+type ItemFilter struct {
+	// UserID is the user whose read states we look at. Required.
+	UserID int
+
+	// State limits us to items the user has in this state. Items the user has
+	// not set a state on are unread.
+	State *ReadState
+
+	// FeedID limits us to items from this feed.
+	FeedID int64
+
+	// Category limits us to items the feed put in this category.
+	Category string
+
+	// Tag limits us to items the user tagged with this tag.
+	Tag string
+
+	// Starred limits us to items the user starred. We find these even if their
+	// feed is deleted, as starring them is asking to keep them.
+	Starred bool
+
+	// Subscribed limits us to items from feeds the user subscribes to.
+	Subscribed bool
+
+	// Since and Until limit us to items published after Since and at or before
+	// Until.
+	Since time.Time
+	Until time.Time
+
+	// Search limits us to items with all of these words in their title or
+	// description. It uses the database's full-text index, so words match other
+	// forms of themselves, such as "poll" matching "polling".
+	Search string
+
+	// SearchAny is like Search but limits us to items with any of these words
+	// rather than all of them. The words may have only letters and digits. Only
+	// one of Search and SearchAny may be set.
+	SearchAny []string
+
+	// HideMuted leaves out items containing any of the user's muted phrases.
+	// It ignores muted regular expressions.
+	HideMuted bool
+
+	// Highlighted limits us to items containing any of the user's highlighted
+	// phrases.
+	Highlighted bool
+
+	// After limits us to items that come after this one in our ordering. This
+	// lets us page through items while new ones arrive.
+	After *ItemCursor
+
+	// OldestFirst reverses our ordering so that the oldest items come first.
+	// After then limits us to items newer than the cursor.
+	OldestFirst bool
+
+	// Limit is the most items to find. Offset skips this many items first and
+	// only applies with a Limit. Neither applies when counting.
+	Limit  int
+	Offset int
+}
+
+// ItemCursor is a position in a list of items.
+//
+// Items are ordered newest first by publication date, and by ID if their
+// publication dates are the same.
+type ItemCursor struct {
+	PublicationDate time.Time
+	ID              int64
+}
+
+// Cursor gives the position of the item in a list of items.
+func (i UserItem) Cursor() ItemCursor {
+	return ItemCursor{PublicationDate: i.PublicationDate, ID: i.ID}
+}
+
+// FindItems retrieves the items matching the filter, newest first unless the
+// filter says oldest first.
+func FindItems(ctx context.Context, db Querier, dbType string,
+	filter ItemFilter) ([]UserItem, error) {
+	d, err := lookupDialect(dbType)
+	if err != nil {
+		return nil, err
+	}
+
+	return findItems(ctx, db, d, filter, false)
+}
+
+// SearchItems retrieves the items matching the filter, best matches for the
+// filter's Search or SearchAny first. One of them is required.
+//
+// Items that match equally well are newest first. SQLite can't tell how well
+// items match, so there they are all newest first.
+//
+// As the order doesn't follow publication dates, After isn't supported. Page
+// through the results with Limit and Offset instead.
+func SearchItems(ctx context.Context, db Querier, dbType string,
+	filter ItemFilter) ([]UserItem, error) {
+	if strings.TrimSpace(filter.Search) == "" && len(filter.SearchAny) == 0 {
+		return nil, fmt.Errorf("no search terms")
+	}
+	if filter.Search != "" && len(filter.SearchAny) > 0 {
+		return nil, fmt.Errorf("search for all or any words, not both")
+	}
+	for _, word := range filter.SearchAny {
+		if !isSearchWord(word) {
+			return nil, fmt.Errorf("invalid search word: %s", word)
+		}
+	}
+	if filter.After != nil {
+		return nil, fmt.Errorf("searching does not support cursors")
+	}
+
+	d, err := lookupDialect(dbType)
+	if err != nil {
+		return nil, err
+	}
+
+	return findItems(ctx, db, d, filter, true)
+}
+
+func findItems(ctx context.Context, db Querier, d dialect, filter ItemFilter,
+	rank bool) ([]UserItem, error) {
+	from, args := itemFilterSQL(d, filter)
+
+	order := "ri.publication_date DESC, ri.id DESC"
+	if filter.OldestFirst {
+		order = "ri.publication_date, ri.id"
+	}
+	searchRank := d.searchRank
+	if len(filter.SearchAny) > 0 {
+		searchRank = d.searchAnyRank
+	}
+	if rank && searchRank != "" {
+		// The search terms are always the second parameter.
+		order = fmt.Sprintf(searchRank, "$2") + ", " + order
+	}
+
+	query := `
+SELECT
+ri.id,
+ri.title,
+ri.description,
+ri.link,
+ri.publication_date,
+ri.guid,
+ri.rss_feed_id,
+rf.name,
+COALESCE(ris.state, 'unread'),
+COALESCE(ris.note, ''),
+` + itemUnsharedSQL + `,
+` + itemStarredSQL + `
+` + from + `
+ORDER BY ` + order
+
+	// SQLite requires a LIMIT with an OFFSET, and there's no way to say no limit
+	// that both it and Postgres accept. Hence Offset needs Limit.
+	if filter.Limit > 0 {
+		args = append(args, filter.Limit)
+		query += fmt.Sprintf("\nLIMIT $%d", len(args))
+
+		if filter.Offset > 0 {
+			args = append(args, filter.Offset)
+			query += fmt.Sprintf("\nOFFSET $%d", len(args))
+		}
+	}
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error querying: %s", err)
+	}
+
+	var items []UserItem
+	for rows.Next() {
+		var item UserItem
+		var state string
+		if err := rows.Scan(
+			&item.ID,
+			&item.Title,
+			&item.Description,
+			&item.Link,
+			&item.PublicationDate,
+			&item.GUID,
+			&item.RSSFeedID,
+			&item.FeedName,
+			&state,
+			&item.Note,
+			&item.Unshared,
+			&item.Starred,
+		); err != nil {
+			_ = rows.Close()
+			return nil, fmt.Errorf("error scanning row: %s", err)
+		}
+
+		readState, err := ParseReadState(state)
+		if err != nil {
+			_ = rows.Close()
+			return nil, err
+		}
+		item.ReadState = readState
+
+		items = append(items, item)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error retrieving rows: %s", err)
+	}
+
+	return items, nil
+}
+
+// CountItems counts the items matching the filter.
+//
+// We count unread items using the unread counts where we can. This is when
+// the filter has no Search, SearchAny, or Until.
+func CountItems(ctx context.Context, db Querier, dbType string,
+	filter ItemFilter) (int, error) {
+	d, err := lookupDialect(dbType)
+	if err != nil {
+		return -1, err
+	}
+
+	filter.After = nil
+
+	if usesUnreadCounts(filter) {
+		counts, err := countUnread(ctx, db, d, filter)
+		if err != nil {
+			return -1, err
+		}
+
+		count := 0
+		for _, c := range counts {
+			count += c
+		}
+		return count, nil
+	}
+
+	from, args := itemFilterSQL(d, filter)
+
+	query := `SELECT COUNT(*) ` + from
+
+	var count int
+	if err := db.QueryRowContext(ctx, query, args...).Scan(&count); err != nil {
+		return -1, fmt.Errorf("error scanning row: %s", err)
+	}
+
+	return count, nil
+}
+
+// itemStarredSQL decides whether the user ($1) starred the item (ri).
+const itemStarredSQL = `EXISTS (SELECT 1 FROM rss_item_star rist
+  WHERE rist.item_id = ri.id AND rist.user_id = $1)`
+
+// itemUnsharedSQL decides whether the user ($1) left the item (ri) out of the
+// feed of items they starred.
+const itemUnsharedSQL = `EXISTS (SELECT 1 FROM rss_item_star rist
+  WHERE rist.item_id = ri.id AND rist.user_id = $1 AND rist.unshared)`
+
+// itemFilterSQL builds the FROM and WHERE clauses selecting the items matching
+// the filter. It returns them along with their parameters.
+func itemFilterSQL(d dialect, filter ItemFilter) (string, []interface{}) {
+	var where []string
+	args := []interface{}{filter.UserID}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	// Search first so that its parameter is always $2. We need to refer to it
+	// again when ranking.
+	if filter.Search != "" {
+		where = append(where, fmt.Sprintf(d.searchItems,
+			arg(d.searchTerms(filter.Search))))
+	} else if len(filter.SearchAny) > 0 {
+		where = append(where, fmt.Sprintf(d.searchAnyItems,
+			arg(d.searchAnyTerms(filter.SearchAny))))
+	}
+
+	if filter.State != nil {
+		where = append(where, "COALESCE(ris.state, 'unread') = "+
+			arg(filter.State.String()))
+	}
+
+	if filter.FeedID != 0 {
+		where = append(where, "ri.rss_feed_id = "+arg(filter.FeedID))
+	}
+
+	if filter.Category != "" {
+		where = append(where, `EXISTS (SELECT 1 FROM rss_item_category ric
+  WHERE ric.item_id = ri.id AND ric.category = `+arg(filter.Category)+`)`)
+	}
+
+	if filter.Tag != "" {
+		where = append(where, `EXISTS (SELECT 1 FROM rss_item_tag rit
+  WHERE rit.item_id = ri.id AND rit.user_id = $1 AND
+  rit.tag = `+arg(filter.Tag)+`)`)
+	}
+
+	// Starred items we keep showing after their feed is deleted.
+	deleted := " AND rf.deleted = false"
+	if filter.Starred {
+		where = append(where, itemStarredSQL)
+		deleted = ""
+	}
+
+	// We can't match regular expressions in the database. We mark items
+	// matching muted ones read as they arrive instead.
+	if filter.HideMuted {
+		where = append(where, "NOT "+keywordSQL(d,
+			"(SELECT user_id, phrase FROM rss_muted_keyword WHERE NOT is_regexp)"))
+	}
+
+	if filter.Highlighted {
+		where = append(where, keywordSQL(d, "rss_highlight_keyword"))
+	}
+
+	// UTC so that times compare correctly in SQLite where they are strings.
+	if !filter.Since.IsZero() {
+		where = append(where, "ri.publication_date > "+arg(filter.Since.UTC()))
+	}
+	if !filter.Until.IsZero() {
+		where = append(where, "ri.publication_date <= "+arg(filter.Until.UTC()))
+	}
+
+	if filter.After != nil {
+		date := arg(filter.After.PublicationDate.UTC())
+		cmp := "<"
+		if filter.OldestFirst {
+			cmp = ">"
+		}
+		where = append(where, fmt.Sprintf(
+			"(ri.publication_date %[1]s %[2]s OR "+
+				"(ri.publication_date = %[2]s AND ri.id %[1]s %[3]s))",
+			cmp, date, arg(filter.After.ID)))
+	}
+
+	from := `
+FROM rss_item ri
+JOIN rss_feed rf ON rf.id = ri.rss_feed_id` + deleted + ` AND
+  (rf.user_id IS NULL OR rf.user_id = $1)
+LEFT JOIN rss_item_state ris ON ris.item_id = ri.id AND ris.user_id = $1`
+	if filter.Subscribed {
+		from += `
+JOIN rss_feed_subscription rfs ON rfs.feed_id = ri.rss_feed_id AND
+  rfs.user_id = $1`
+	}
+	if len(where) > 0 {
+		from += "\nWHERE " + strings.Join(where, " AND ")
+	}
+
+	return from, args
+}
@@ -0,0 +1,177 @@
+package gorse
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestFindItems(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("unable to open mock db: %s", err)
+	}
+	defer db.Close()
+
+	since := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	pubDate := since.Add(time.Hour)
+	state := ReadLater
+
+	mock.ExpectQuery(`FROM rss_item ri .*`+
+		`LEFT JOIN rss_item_state ris ON ris.item_id = ri.id `+
+		`AND ris.user_id = \$1\s+`+
+		`WHERE ri.search_vector @@ plainto_tsquery\('english', \$2\) `+
+		`AND COALESCE\(ris.state, 'unread'\) = \$3 `+
+		`AND ri.rss_feed_id = \$4 `+
+		`AND ri.publication_date > \$5 `+
+		`AND \(ri.publication_date < \$6 OR \(ri.publication_date = \$6 `+
+		`AND ri.id < \$7\)\)\s+`+
+		`ORDER BY ri.publication_date DESC, ri.id DESC\s+`+
+		`LIMIT \$8\s+OFFSET \$9`).
+		WithArgs(2, "100% poll", "read-later", int64(4), since, pubDate,
+			int64(10), 5, 20).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "description",
+			"link", "publication_date", "guid", "rss_feed_id", "name", "state",
+			"note", "unshared", "starred"}).
+			AddRow(9, "Title", "Description", "https://example.com/", pubDate, nil, 4,
+				"Feed", "read-later", "Why", false, true))
+
+	items, err := FindItems(context.Background(), db, Postgres, ItemFilter{
+		UserID: 2,
+		State:  &state,
+		FeedID: 4,
+		Since:  since,
+		Search: "100% poll",
+		After:  &ItemCursor{PublicationDate: pubDate, ID: 10},
+		Limit:  5,
+		Offset: 20,
+	})
+	if err != nil {
+		t.Fatalf("FindItems() = error %s", err)
+	}
+	if len(items) != 1 || items[0].ID != 9 || items[0].FeedName != "Feed" ||
+		items[0].ReadState != ReadLater || items[0].Note != "Why" ||
+		!items[0].Starred {
+		t.Errorf("FindItems() = %+v", items)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestCountItems(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("unable to open mock db: %s", err)
+	}
+	defer db.Close()
+
+	// The cursor, limit, and offset don't affect counts.
+	mock.ExpectQuery(`SELECT COUNT\(\*\)\s+FROM rss_item ri .*` +
+		`AND ris.user_id = \$1$`).
+		WithArgs(2).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(7))
+
+	count, err := CountItems(context.Background(), db, Postgres, ItemFilter{
+		UserID: 2,
+		After:  &ItemCursor{ID: 10},
+		Limit:  5,
+		Offset: 20,
+	})
+	if err != nil || count != 7 {
+		t.Errorf("CountItems() = %d, %v, wanted 7", count, err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSearchItems(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("unable to open mock db: %s", err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+
+	if _, err := SearchItems(ctx, db, Postgres, ItemFilter{
+		UserID: 2,
+	}); err == nil {
+		t.Error("SearchItems() without search terms succeeded")
+	}
+	if _, err := SearchItems(ctx, db, Postgres, ItemFilter{
+		UserID: 2,
+		Search: "poll",
+		After:  &ItemCursor{ID: 10},
+	}); err == nil {
+		t.Error("SearchItems() with a cursor succeeded")
+	}
+
+	mock.ExpectQuery(`WHERE ri.search_vector @@ `+
+		`plainto_tsquery\('english', \$2\)\s+`+
+		`ORDER BY ts_rank\(ri.search_vector, `+
+		`plainto_tsquery\('english', \$2\)\) DESC, `+
+		`ri.publication_date DESC, ri.id DESC\s+LIMIT \$3$`).
+		WithArgs(2, "poll", 5).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "description",
+			"link", "publication_date", "guid", "rss_feed_id", "name", "state",
+			"note"}))
+
+	if _, err := SearchItems(ctx, db, Postgres, ItemFilter{
+		UserID: 2,
+		Search: "poll",
+		Limit:  5,
+	}); err != nil {
+		t.Fatalf("SearchItems() = error %s", err)
+	}
+
+	mock.ExpectQuery(`WHERE ri.search_vector @@ `+
+		`to_tsquery\('english', \$2\)\s+`+
+		`ORDER BY ts_rank\(ri.search_vector, `+
+		`to_tsquery\('english', \$2\)\) DESC, `).
+		WithArgs(2, "storm | coast").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "description",
+			"link", "publication_date", "guid", "rss_feed_id", "name", "state",
+			"note"}))
+
+	if _, err := SearchItems(ctx, db, Postgres, ItemFilter{
+		UserID:    2,
+		SearchAny: []string{"storm", "coast"},
+	}); err != nil {
+		t.Fatalf("SearchItems() with any words = error %s", err)
+	}
+
+	if _, err := SearchItems(ctx, db, Postgres, ItemFilter{
+		UserID:    2,
+		SearchAny: []string{"storm", "coast|sea"},
+	}); err == nil {
+		t.Error("SearchItems() with an operator in a word succeeded")
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSQLiteSearchTerms(t *testing.T) {
+	tests := []struct {
+		input  string
+		output string
+	}{
+		{"poll", `"poll"`},
+		{" feed  poll ", `"feed" "poll"`},
+		{`OR "quoted" -not*`, `"OR" """quoted""" "-not*"`},
+	}
+
+	for _, test := range tests {
+		if got := sqliteSearchTerms(test.input); got != test.output {
+			t.Errorf("sqliteSearchTerms(%q) = %s, wanted %s", test.input, got,
+				test.output)
+		}
+	}
+}
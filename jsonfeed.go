@@ -0,0 +1,203 @@
+package gorse
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/horgh/rss"
+)
+
+// jsonFeedVersionPrefix starts the version of every JSON Feed document.
+const jsonFeedVersionPrefix = "https://jsonfeed.org/version/"
+
+// jsonFeedVersions are the versions of JSON Feed we know. We parse others the
+// same way, but say we did.
+var jsonFeedVersions = map[string]struct{}{
+	jsonFeedVersionPrefix + "1":   {},
+	jsonFeedVersionPrefix + "1.1": {},
+}
+
+// jsonFeed is the top level object of a JSON Feed document. We only decode the
+// fields we use.
+type jsonFeed struct {
+	Version     string            `json:"version"`
+	Title       string            `json:"title"`
+	HomePageURL string            `json:"home_page_url"`
+	Description string            `json:"description"`
+	Items       []json.RawMessage `json:"items"`
+}
+
+// jsonFeedItem is an item in a JSON Feed document.
+type jsonFeedItem struct {
+	ID            jsonFeedID `json:"id"`
+	URL           string     `json:"url"`
+	ExternalURL   string     `json:"external_url"`
+	Title         string     `json:"title"`
+	ContentHTML   string     `json:"content_html"`
+	ContentText   string     `json:"content_text"`
+	Summary       string     `json:"summary"`
+	DatePublished string     `json:"date_published"`
+	DateModified  string     `json:"date_modified"`
+
+	Attachments []jsonFeedAttachment `json:"attachments"`
+	Tags        []string             `json:"tags"`
+}
+
+// jsonFeedAttachment is a file that comes with an item, like an enclosure.
+type jsonFeedAttachment struct {
+	URL               string  `json:"url"`
+	MIMEType          string  `json:"mime_type"`
+	SizeInBytes       int64   `json:"size_in_bytes"`
+	DurationInSeconds float64 `json:"duration_in_seconds"`
+}
+
+// jsonFeedID is an item's id. The spec says it is a string, but version 1
+// feeds often give a number.
+type jsonFeedID string
+
+// UnmarshalJSON decodes an id that is a string or a number.
+func (id *jsonFeedID) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*id = jsonFeedID(s)
+		return nil
+	}
+
+	var n json.Number
+	if err := json.Unmarshal(data, &n); err != nil {
+		return fmt.Errorf("id is neither a string nor a number: %s", data)
+	}
+	*id = jsonFeedID(n.String())
+	return nil
+}
+
+// parseJSONFeed parses a JSON Feed document. See https://jsonfeed.org.
+//
+// We take each item's url as its link (or failing that external_url),
+// content_html, content_text, or summary as its description in that order,
+// date_published (or failing that date_modified) as its publication date, and
+// id as its GUID. Its attachments are its enclosures and its tags its
+// categories.
+//
+// We resolve relative links against the feed's home page, or failing that
+// where the payload came from, opts.URL.
+func parseJSONFeed(data []byte, opts ParseOptions) (*Feed, error) {
+	var doc jsonFeed
+	if err := json.Unmarshal(jsonPayload(data), &doc); err != nil {
+		return nil, fmt.Errorf("unable to parse JSON Feed: %s", err)
+	}
+
+	if !strings.HasPrefix(doc.Version, jsonFeedVersionPrefix) {
+		return nil, fmt.Errorf("not a JSON Feed: version is %q", doc.Version)
+	}
+
+	base, err := url.Parse(opts.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid feed URL: %s: %s", opts.URL, err)
+	}
+	homePage := strings.TrimSpace(doc.HomePageURL)
+	if homePage != "" {
+		if u, err := base.Parse(homePage); err == nil {
+			base = u
+			homePage = u.String()
+		}
+	}
+
+	feed := &Feed{
+		Title:       strings.TrimSpace(doc.Title),
+		Link:        homePage,
+		Description: strings.TrimSpace(doc.Description),
+		Type:        "JSON Feed",
+		Encoding:    "utf-8",
+	}
+
+	if _, ok := jsonFeedVersions[doc.Version]; !ok {
+		feed.Warnings = append(feed.Warnings,
+			fmt.Sprintf("unknown JSON Feed version: %s", doc.Version))
+	}
+
+	for i, raw := range doc.Items {
+		var entry jsonFeedItem
+		if err := json.Unmarshal(raw, &entry); err != nil {
+			return nil, fmt.Errorf("unable to parse item %d: %s", i+1, err)
+		}
+
+		link := strings.TrimSpace(entry.URL)
+		if link == "" {
+			link = strings.TrimSpace(entry.ExternalURL)
+		}
+
+		item := rss.Item{
+			Title:       strings.TrimSpace(entry.Title),
+			Link:        resolveURL(base, link),
+			Description: jsonFeedDescription(entry),
+			PubDate:     parseJSONFeedTime(entry.DatePublished),
+			GUID:        strings.TrimSpace(string(entry.ID)),
+		}
+		if item.PubDate.IsZero() {
+			item.PubDate = parseJSONFeedTime(entry.DateModified)
+		}
+
+		var enclosures []Enclosure
+		for _, a := range entry.Attachments {
+			enclosures = appendEnclosure(enclosures, base, a.URL, a.MIMEType,
+				a.SizeInBytes, time.Duration(a.DurationInSeconds*float64(time.Second)))
+		}
+
+		var rawItem string
+		if opts.KeepRaw {
+			rawItem = string(raw)
+		}
+
+		feed.Items = append(feed.Items, Item{
+			Item:       item,
+			Raw:        rawItem,
+			Enclosures: enclosures,
+			Categories: cleanCategories(entry.Tags),
+		})
+	}
+
+	return feed, nil
+}
+
+// jsonFeedDescription picks the item's description. Plain text content is
+// escaped as we treat descriptions as HTML.
+func jsonFeedDescription(entry jsonFeedItem) string {
+	if s := strings.TrimSpace(entry.ContentHTML); s != "" {
+		return s
+	}
+	if s := strings.TrimSpace(entry.ContentText); s != "" {
+		return html.EscapeString(s)
+	}
+	return html.EscapeString(strings.TrimSpace(entry.Summary))
+}
+
+// parseJSONFeedTime parses a date. The spec says dates are RFC 3339.
+//
+// We return the zero time if we can't parse it, as parseMicroformatTime does.
+func parseJSONFeedTime(s string) time.Time {
+	t, err := time.Parse(time.RFC3339, strings.TrimSpace(s))
+	if err != nil {
+		return time.Time{}
+	}
+	return t.In(time.UTC)
+}
+
+// looksLikeJSONFeed decides whether a payload is worth trying to parse as JSON
+// Feed. We go by the payload rather than the Content-Type as servers often
+// send feeds with the wrong one.
+func looksLikeJSONFeed(data []byte) bool {
+	return bytes.HasPrefix(jsonPayload(data), []byte("{"))
+}
+
+// jsonPayload drops any byte order mark and leading whitespace. JSON doesn't
+// allow a byte order mark but some servers send one anyway.
+func jsonPayload(data []byte) []byte {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	return bytes.TrimLeft(data, " \t\r\n")
+}
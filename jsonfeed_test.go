@@ -0,0 +1,136 @@
+package gorse
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseFeedJSONFeed(t *testing.T) {
+	payload := []byte("\xef\xbb\xbf" + `{
+	"version": "https://jsonfeed.org/version/1.1",
+	"title": " My Blog ",
+	"home_page_url": "https://example.com/blog/",
+	"feed_url": "https://example.com/blog/feed.json",
+	"items": [
+		{
+			"id": "https://example.com/blog/first",
+			"url": "first",
+			"title": "First post",
+			"content_html": "<p>The <b>first</b> one.</p>",
+			"date_published": "2020-03-01T12:00:00+02:00"
+		},
+		{
+			"id": 2,
+			"external_url": "https://elsewhere.example.com/article",
+			"content_text": "Fish & chips",
+			"date_modified": "2020-03-02T00:00:00Z"
+		},
+		{
+			"id": "3",
+			"url": "https://example.com/blog/third",
+			"summary": "Just a summary",
+			"date_published": "March 3"
+		}
+	]
+}`)
+
+	feed, err := ParseFeed(payload, ParseOptions{
+		ContentType: "application/feed+json",
+		URL:         "https://example.com/blog/feed.json",
+		KeepRaw:     true,
+	})
+	if err != nil {
+		t.Fatalf("ParseFeed() = error %s", err)
+	}
+
+	if feed.Type != "JSON Feed" {
+		t.Errorf("type = %s, wanted JSON Feed", feed.Type)
+	}
+	if feed.Title != "My Blog" {
+		t.Errorf("title = %q, wanted My Blog", feed.Title)
+	}
+	if feed.Link != "https://example.com/blog/" {
+		t.Errorf("link = %q", feed.Link)
+	}
+
+	if len(feed.Items) != 3 {
+		t.Fatalf("got %d items, wanted 3", len(feed.Items))
+	}
+
+	first := feed.Items[0]
+	if first.Title != "First post" {
+		t.Errorf("first title = %q", first.Title)
+	}
+	if first.Link != "https://example.com/blog/first" {
+		t.Errorf("first link = %q", first.Link)
+	}
+	if first.GUID != "https://example.com/blog/first" {
+		t.Errorf("first GUID = %q", first.GUID)
+	}
+	if first.Description != "<p>The <b>first</b> one.</p>" {
+		t.Errorf("first description = %q", first.Description)
+	}
+	if !first.PubDate.Equal(time.Date(2020, 3, 1, 10, 0, 0, 0, time.UTC)) {
+		t.Errorf("first publication date = %s", first.PubDate)
+	}
+	if !strings.Contains(first.Raw, `"title": "First post"`) {
+		t.Errorf("first raw = %q", first.Raw)
+	}
+
+	second := feed.Items[1]
+	if second.GUID != "2" {
+		t.Errorf("second GUID = %q, wanted 2", second.GUID)
+	}
+	if second.Link != "https://elsewhere.example.com/article" {
+		t.Errorf("second link = %q", second.Link)
+	}
+	if second.Description != "Fish &amp; chips" {
+		t.Errorf("second description = %q", second.Description)
+	}
+	if !second.PubDate.Equal(time.Date(2020, 3, 2, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("second publication date = %s", second.PubDate)
+	}
+
+	third := feed.Items[2]
+	if third.Description != "Just a summary" {
+		t.Errorf("third description = %q", third.Description)
+	}
+	if !third.PubDate.IsZero() {
+		t.Errorf("third publication date = %s, wanted none", third.PubDate)
+	}
+
+	want := "item 3 has no publication date we could parse"
+	found := false
+	for _, warning := range feed.Warnings {
+		if warning == want {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("warnings = %q, wanted %q", feed.Warnings, want)
+	}
+}
+
+func TestParseFeedJSONFeedErrors(t *testing.T) {
+	tests := []struct {
+		Name  string
+		Input string
+		Want  string
+	}{
+		{"not json", `{"version": `, "unable to parse JSON Feed"},
+		{"not a feed", `{"version": "1.0"}`, "not a JSON Feed"},
+		{"bad item", `{"version": "https://jsonfeed.org/version/1",
+			"items": [{"id": true}]}`, "unable to parse item 1"},
+		{"too many items", `{"version": "https://jsonfeed.org/version/1",
+			"items": [{"id": "1"}, {"id": "2"}]}`, "too many items"},
+	}
+
+	for _, test := range tests {
+		_, err := ParseFeed([]byte(test.Input), ParseOptions{MaxItems: 1})
+		if err == nil || !strings.Contains(err.Error(), test.Want) {
+			t.Errorf("%s: ParseFeed() = error %v, wanted %q", test.Name, err,
+				test.Want)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package gorse
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Users may list words and phrases to mute or to highlight. We match them in
+// items' titles and descriptions in the same way for both.
+
+// MaxKeywordLength is the most characters a muted or highlighted phrase may
+// have.
+const MaxKeywordLength = 200
+
+// NormalizeKeyword puts the phrase in the form we store it in. This is
+// lowercase with single spaces between words. It is an error if the phrase is
+// blank or too long.
+func NormalizeKeyword(phrase string) (string, error) {
+	phrase = strings.ToLower(strings.Join(strings.Fields(phrase), " "))
+	if phrase == "" {
+		return "", fmt.Errorf("phrase is blank")
+	}
+	if len([]rune(phrase)) > MaxKeywordLength {
+		return "", fmt.Errorf("phrase is longer than %d characters",
+			MaxKeywordLength)
+	}
+	return phrase, nil
+}
+
+// containsKeyword decides whether an item with the title and description
+// contains the phrase, ignoring case. The phrase must be normalized.
+//
+// This is like Notifier.Matches. keywordSQL matches in the same way in the
+// database, except that SQLite only ignores the case of ASCII letters.
+func containsKeyword(title, description, phrase string) bool {
+	return strings.Contains(strings.ToLower(title), phrase) ||
+		strings.Contains(strings.ToLower(description), phrase)
+}
+
+// regexpIgnoringCase compiles the regular expression so it ignores case.
+func regexpIgnoringCase(pattern string) (*regexp.Regexp, error) {
+	return regexp.Compile("(?i)" + pattern)
+}
+
+// keywordSQL is a condition that the item ri contains any of the user's
+// phrases in the table. The user is $1.
+func keywordSQL(d dialect, table string) string {
+	return fmt.Sprintf(`EXISTS (
+  SELECT 1 FROM %[1]s kw
+  WHERE kw.user_id = $1 AND
+    (%[2]s OR %[3]s))`,
+		table,
+		fmt.Sprintf(d.contains, "LOWER(ri.title)", "kw.phrase"),
+		fmt.Sprintf(d.contains, "LOWER(ri.description)", "kw.phrase"))
+}
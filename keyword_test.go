@@ -0,0 +1,69 @@
+package gorse
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/horgh/rss"
+)
+
+func TestNormalizeKeyword(t *testing.T) {
+	tests := []struct {
+		phrase string
+		want   string
+		ok     bool
+	}{
+		{"Election", "election", true},
+		{"  big   NEWS\tstory ", "big news story", true},
+		{"Été", "été", true},
+		{" \t", "", false},
+		{strings.Repeat("é", MaxKeywordLength), strings.Repeat("é",
+			MaxKeywordLength), true},
+		{strings.Repeat("a", MaxKeywordLength+1), "", false},
+	}
+
+	for _, test := range tests {
+		got, err := NormalizeKeyword(test.phrase)
+		if !test.ok {
+			if err == nil {
+				t.Errorf("NormalizeKeyword(%q) succeeded, wanted an error",
+					test.phrase)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("NormalizeKeyword(%q) = error %s", test.phrase, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("NormalizeKeyword(%q) = %q, wanted %q", test.phrase, got,
+				test.want)
+		}
+	}
+
+	m := MutedKeyword{Phrase: "big news"}
+	for _, item := range []rss.Item{
+		{Title: "The BIG News today"},
+		{Title: "Today", Description: "<p>Some big news</p>"},
+	} {
+		if !m.Matches(&Item{Item: item}) {
+			t.Errorf("%q does not match %+v, wanted it to", m.Phrase, item)
+		}
+	}
+	if m.Matches(&Item{Item: rss.Item{Title: "Big", Description: "news"}}) {
+		t.Errorf("%q matches words apart, wanted it not to", m.Phrase)
+	}
+
+	m = MutedKeyword{Phrase: `^big\b`, Regexp: true}
+	if !m.Matches(&Item{Item: rss.Item{Title: "BIG news"}}) {
+		t.Errorf("%q does not match, wanted it to", m.Phrase)
+	}
+	if m.Matches(&Item{Item: rss.Item{Title: "Bigger news"}}) {
+		t.Errorf("%q matches, wanted it not to", m.Phrase)
+	}
+	m = MutedKeyword{Phrase: "(", Regexp: true}
+	if m.Matches(&Item{Item: rss.Item{Title: "("}}) {
+		t.Errorf("invalid regular expression %q matches, wanted it not to",
+			m.Phrase)
+	}
+}
@@ -0,0 +1,120 @@
+package gorse
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// MarkAllRead sets all of the user's unread items read. If feedID is not 0,
+// only the feed's items. If until is not zero, only items published at or
+// before it. We leave items saved to read later alone.
+//
+// We return how many items we set read.
+//
+// Rather than setting the items' states a batch at a time as
+// DBSetItemsReadState does, we set them all with one statement. There may be
+// many thousands. We record them in the state history and adjust the unread
+// counts as it does though. Run this in a transaction so that these agree.
+func MarkAllRead(ctx context.Context, db Querier, dbType string, userID int,
+	feedID int64, until time.Time) (int64, error) {
+	d, err := lookupDialect(dbType)
+	if err != nil {
+		return -1, err
+	}
+
+	unread := Unread
+	from, args := itemFilterSQL(d, ItemFilter{
+		UserID:     userID,
+		State:      &unread,
+		FeedID:     feedID,
+		Until:      until,
+		Subscribed: true,
+	})
+
+	// We set only the items we count here. Items arriving while we work are
+	// left unread.
+	var maxID sql.NullInt64
+	if err := db.QueryRowContext(ctx, `SELECT MAX(ri.id) `+from,
+		args...).Scan(&maxID); err != nil {
+		return -1, fmt.Errorf("unable to look up unread items: %s", err)
+	}
+	if !maxID.Valid {
+		return 0, nil
+	}
+	args = append(args, maxID.Int64)
+	from += fmt.Sprintf(" AND ri.id <= $%d", len(args))
+
+	counts, total, err := countItemsByDay(ctx, db, userID,
+		`SELECT ri.rss_feed_id, ri.publication_date `+from, args)
+	if err != nil {
+		return -1, err
+	}
+
+	oldState := fmt.Sprintf(d.readState, "'"+Unread.String()+"'")
+	newState := fmt.Sprintf(d.readState, "'"+Read.String()+"'")
+
+	query := `
+INSERT INTO rss_item_state_history
+(item_id, user_id, old_state, new_state)
+SELECT ri.id, $1, ` + oldState + `, ` + newState + from
+
+	if _, err := db.ExecContext(ctx, query, args...); err != nil {
+		return -1, fmt.Errorf("unable to record state changes: %s", err)
+	}
+
+	// The WHERE in from is needed for SQLite to parse ON CONFLICT after a
+	// SELECT. We always have one as we limit the state.
+	query = `
+INSERT INTO rss_item_state
+(user_id, item_id, state)
+SELECT $1, ri.id, ` + newState + from + `
+ON CONFLICT (user_id, item_id) DO UPDATE
+SET state = EXCLUDED.state
+`
+
+	if _, err := db.ExecContext(ctx, query, args...); err != nil {
+		return -1, fmt.Errorf("unable to set items read: %s", err)
+	}
+
+	for key := range counts {
+		counts[key] = -counts[key]
+	}
+	if err := addUnreadCounts(ctx, db, counts); err != nil {
+		return -1, err
+	}
+
+	return total, nil
+}
+
+// countItemsByDay runs a query selecting items' feed IDs and publication
+// dates and counts them for the user the way the unread counts do. We return
+// the counts along with the total.
+func countItemsByDay(ctx context.Context, db Querier, userID int,
+	query string, args []interface{}) (map[unreadCountKey]int, int64, error) {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, -1, fmt.Errorf("unable to query items: %s", err)
+	}
+
+	counts := map[unreadCountKey]int{}
+	var total int64
+	for rows.Next() {
+		var feedID int64
+		var pubDate time.Time
+		if err := rows.Scan(&feedID, &pubDate); err != nil {
+			_ = rows.Close()
+			return nil, -1, fmt.Errorf("failed to scan row: %s", err)
+		}
+		counts[unreadCountKey{userID: userID, feedID: feedID,
+			day: publicationDay(pubDate)}]++
+		total++
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, -1, fmt.Errorf("failure fetching rows: %s", err)
+	}
+
+	return counts, total, nil
+}
@@ -0,0 +1,252 @@
+package gorse
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+//go:embed migrations/*/*.sql
+var migrationFiles embed.FS
+
+// Migration is a versioned change to the database schema.
+type Migration struct {
+	// Version orders the migrations. Each is applied once.
+	Version int
+
+	// Name describes the migration. It comes from the file name.
+	Name string
+
+	SQL string
+}
+
+var migrationFileRE = regexp.MustCompile(`^(\d+)_(\w+)\.sql$`)
+
+// Migrations returns the migrations we know about for the database type
+// ordered by version.
+//
+// Migrations are the files in the type's migrations directory, e.g.
+// migrations/postgres. They are named <version>_<name>.sql, e.g.
+// 0001_initial.sql. Each type has the same versions so that its schema stays
+// the same as the others.
+func Migrations(dbType string) ([]Migration, error) {
+	if dbType == "" {
+		dbType = Postgres
+	}
+
+	d, ok := dialects[dbType]
+	if !ok {
+		return nil, fmt.Errorf("unknown database type: %s", dbType)
+	}
+
+	return readMigrations(d)
+}
+
+func readMigrations(d dialect) ([]Migration, error) {
+	entries, err := migrationFiles.ReadDir(d.migrations)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read migrations: %s", err)
+	}
+
+	var migrations []Migration
+	for _, entry := range entries {
+		matches := migrationFileRE.FindStringSubmatch(entry.Name())
+		if matches == nil {
+			return nil, fmt.Errorf("invalid migration file name: %s", entry.Name())
+		}
+
+		version, err := strconv.Atoi(matches[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration version: %s: %s", entry.Name(),
+				err)
+		}
+
+		buf, err := migrationFiles.ReadFile(path.Join(d.migrations, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("unable to read migration: %s: %s", entry.Name(),
+				err)
+		}
+
+		migrations = append(migrations, Migration{
+			Version: version,
+			Name:    matches[2],
+			SQL:     string(buf),
+		})
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	for i := 1; i < len(migrations); i++ {
+		if migrations[i].Version == migrations[i-1].Version {
+			return nil, fmt.Errorf("duplicate migration version: %d",
+				migrations[i].Version)
+		}
+	}
+
+	return migrations, nil
+}
+
+// Migrate brings the database's schema up to date by applying each migration
+// that has not yet been applied.
+//
+// We track applied migrations in the schema_migrations table. Each migration
+// runs in its own transaction along with recording that it ran. We lock the
+// table while doing so (or take SQLite's write lock), so gorse and gorsepoll
+// starting at the same time won't both apply a migration.
+//
+// If the database has the gorse schema from before we tracked migrations, we
+// record the initial migration as applied rather than running it.
+//
+// We return the migrations we applied.
+func Migrate(ctx context.Context, db *sql.DB, dbType string) ([]Migration,
+	error) {
+	d, err := lookupDialect(dbType)
+	if err != nil {
+		return nil, err
+	}
+
+	migrations, err := readMigrations(d)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := createMigrationsTable(ctx, db, d); err != nil {
+		return nil, err
+	}
+
+	var applied []Migration
+	for _, migration := range migrations {
+		ran, err := applyMigration(ctx, db, d, migration)
+		if err != nil {
+			return applied, fmt.Errorf("migration %d (%s) failed: %s",
+				migration.Version, migration.Name, err)
+		}
+		if ran {
+			applied = append(applied, migration)
+		}
+	}
+
+	return applied, nil
+}
+
+// SchemaVersion returns the version of the newest migration applied to the
+// database. It is 0 if none have been.
+func SchemaVersion(ctx context.Context, db *sql.DB) (int, error) {
+	query := `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`
+
+	var version int
+	if err := db.QueryRowContext(ctx, query).Scan(&version); err != nil {
+		return -1, fmt.Errorf("unable to look up schema version: %s", err)
+	}
+
+	return version, nil
+}
+
+func createMigrationsTable(ctx context.Context, db *sql.DB, d dialect) error {
+	exists, err := tableExists(ctx, db, d, "schema_migrations")
+	if err != nil {
+		return err
+	}
+	if exists {
+		return nil
+	}
+
+	hasSchema, err := tableExists(ctx, db, d, "rss_feed")
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("unable to begin transaction: %s", err)
+	}
+
+	query := fmt.Sprintf(`
+CREATE TABLE IF NOT EXISTS schema_migrations (
+  version      INTEGER NOT NULL,
+  name         VARCHAR NOT NULL,
+  applied_time TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT %s,
+  PRIMARY KEY (version)
+)
+`, d.now)
+	if _, err := tx.ExecContext(ctx, query); err != nil {
+		_ = tx.Rollback()
+		return fmt.Errorf("unable to create schema_migrations table: %s", err)
+	}
+
+	if hasSchema {
+		if _, err := tx.ExecContext(ctx,
+			`INSERT INTO schema_migrations (version, name) VALUES (1, 'initial')
+			ON CONFLICT DO NOTHING`,
+		); err != nil {
+			_ = tx.Rollback()
+			return fmt.Errorf("unable to record existing schema: %s", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("unable to commit: %s", err)
+	}
+
+	return nil
+}
+
+// applyMigration runs the migration if it has not been applied yet.
+//
+// We return whether we ran it.
+func applyMigration(ctx context.Context, db *sql.DB, d dialect,
+	migration Migration) (bool, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, fmt.Errorf("unable to begin transaction: %s", err)
+	}
+
+	if d.lockMigrations != "" {
+		if _, err := tx.ExecContext(ctx, d.lockMigrations); err != nil {
+			_ = tx.Rollback()
+			return false, fmt.Errorf("unable to lock schema_migrations: %s", err)
+		}
+	}
+
+	var count int
+	if err := tx.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM schema_migrations WHERE version = $1`,
+		migration.Version,
+	).Scan(&count); err != nil {
+		_ = tx.Rollback()
+		return false, fmt.Errorf("unable to check if migration applied: %s", err)
+	}
+
+	if count > 0 {
+		if err := tx.Rollback(); err != nil {
+			return false, fmt.Errorf("unable to roll back: %s", err)
+		}
+		return false, nil
+	}
+
+	if _, err := tx.ExecContext(ctx, migration.SQL); err != nil {
+		_ = tx.Rollback()
+		return false, err
+	}
+
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO schema_migrations (version, name) VALUES ($1, $2)`,
+		migration.Version, migration.Name,
+	); err != nil {
+		_ = tx.Rollback()
+		return false, fmt.Errorf("unable to record migration: %s", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("unable to commit: %s", err)
+	}
+
+	return true, nil
+}
@@ -0,0 +1,4 @@
+-- Let users log in. Users without a password can't until one is set.
+ALTER TABLE rss_user ADD COLUMN IF NOT EXISTS password_hash VARCHAR;
+ALTER TABLE rss_user ADD COLUMN IF NOT EXISTS admin BOOLEAN NOT NULL
+  DEFAULT false;
@@ -0,0 +1,27 @@
+-- Index items' text so we can search them without scanning every item.
+--
+-- Titles count for more than descriptions when ranking matches.
+ALTER TABLE rss_item ADD COLUMN IF NOT EXISTS search_vector TSVECTOR;
+
+CREATE OR REPLACE FUNCTION trigger_set_rss_item_search_vector()
+RETURNS TRIGGER
+AS $$
+BEGIN
+  NEW.search_vector =
+    setweight(to_tsvector('english', NEW.title), 'A') ||
+    setweight(to_tsvector('english', NEW.description), 'B');
+  return NEW;
+END
+$$
+LANGUAGE plpgsql;
+
+CREATE TRIGGER biu_rss_item_search_vector
+BEFORE INSERT OR UPDATE OF title, description ON rss_item
+FOR EACH ROW EXECUTE PROCEDURE trigger_set_rss_item_search_vector();
+
+UPDATE rss_item SET search_vector =
+  setweight(to_tsvector('english', title), 'A') ||
+  setweight(to_tsvector('english', description), 'B');
+
+CREATE INDEX IF NOT EXISTS rss_item_search_vector_idx ON rss_item
+USING GIN (search_vector);
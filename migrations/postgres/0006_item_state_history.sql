@@ -0,0 +1,17 @@
+-- Each change to a user's state for an item. Setting an item to the state it
+-- was already in is not a change.
+CREATE TABLE rss_item_state_history (
+  id          SERIAL NOT NULL,
+  item_id     INTEGER NOT NULL REFERENCES rss_item(id)
+              ON DELETE CASCADE ON UPDATE CASCADE,
+  user_id     INTEGER NOT NULL REFERENCES rss_user(id)
+              ON DELETE CASCADE ON UPDATE CASCADE,
+  -- Unread if the item had no state.
+  old_state   read_state NOT NULL,
+  new_state   read_state NOT NULL,
+  create_time TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+  PRIMARY KEY (id)
+);
+
+CREATE INDEX ON rss_item_state_history (user_id, create_time);
+CREATE INDEX ON rss_item_state_history (item_id);
@@ -0,0 +1,20 @@
+-- The feeds each user subscribes to.
+CREATE TABLE rss_feed_subscription (
+  id          SERIAL NOT NULL,
+  user_id     INTEGER NOT NULL REFERENCES rss_user(id)
+              ON DELETE CASCADE ON UPDATE CASCADE,
+  feed_id     INTEGER NOT NULL REFERENCES rss_feed(id)
+              ON DELETE CASCADE ON UPDATE CASCADE,
+  create_time TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+  UNIQUE (user_id, feed_id),
+  PRIMARY KEY (id)
+);
+
+CREATE INDEX ON rss_feed_subscription (feed_id);
+
+-- Until now everyone saw every feed.
+INSERT INTO rss_feed_subscription (user_id, feed_id)
+SELECT u.id, f.id
+FROM rss_user u
+CROSS JOIN rss_feed f
+WHERE f.deleted = false;
@@ -0,0 +1,14 @@
+-- Administrative actions: changes to feeds and users, and setting the states
+-- of many items at once. The actor is who did it. There is none for actions
+-- we take ourselves, such as the poller's.
+CREATE TABLE rss_audit_log (
+  id          SERIAL NOT NULL,
+  actor_id    INTEGER REFERENCES rss_user(id)
+              ON DELETE SET NULL ON UPDATE CASCADE,
+  action      VARCHAR NOT NULL,
+  details     VARCHAR NOT NULL,
+  create_time TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+  PRIMARY KEY (id)
+);
+
+CREATE INDEX ON rss_audit_log (create_time);
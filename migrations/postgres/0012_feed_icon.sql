@@ -0,0 +1,11 @@
+-- Each feed's icon, such as its site's favicon. etag is from the response we
+-- fetched the icon in, if there was one, so we can ask whether it changed.
+CREATE TABLE rss_feed_icon (
+  feed_id      INTEGER NOT NULL REFERENCES rss_feed(id)
+               ON DELETE CASCADE ON UPDATE CASCADE,
+  data         BYTEA NOT NULL,
+  content_type VARCHAR NOT NULL,
+  etag         VARCHAR,
+  fetch_time   TIMESTAMP WITH TIME ZONE NOT NULL,
+  PRIMARY KEY (feed_id)
+);
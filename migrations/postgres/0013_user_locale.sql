@@ -0,0 +1,6 @@
+-- Each user's language for the interface and dates, such as fr. Blank to go by
+-- their browser. relative_dates shows times such as "2 hours ago" instead.
+ALTER TABLE rss_user ADD COLUMN IF NOT EXISTS locale VARCHAR NOT NULL
+  DEFAULT '';
+ALTER TABLE rss_user ADD COLUMN IF NOT EXISTS relative_dates BOOLEAN NOT NULL
+  DEFAULT false;
@@ -0,0 +1,5 @@
+-- A feed belonging to one user, such as the one holding the links they save
+-- themselves. Only they see its items. NULL for feeds everyone sees.
+ALTER TABLE rss_feed ADD COLUMN IF NOT EXISTS user_id INTEGER
+  REFERENCES rss_user(id) ON DELETE CASCADE ON UPDATE CASCADE;
+CREATE INDEX IF NOT EXISTS rss_feed_user_id_idx ON rss_feed (user_id);
@@ -0,0 +1,16 @@
+-- Services each user sends items to, such as Pocket, and their credentials
+-- for the service. Which credentials a service needs depends on the service.
+-- mark_read says to set items read once sent.
+CREATE TABLE rss_user_integration (
+  user_id       INTEGER NOT NULL REFERENCES rss_user(id)
+                ON DELETE CASCADE ON UPDATE CASCADE,
+  service       VARCHAR NOT NULL,
+  url           VARCHAR NOT NULL DEFAULT '',
+  client_id     VARCHAR NOT NULL DEFAULT '',
+  client_secret VARCHAR NOT NULL DEFAULT '',
+  username      VARCHAR NOT NULL DEFAULT '',
+  password      VARCHAR NOT NULL DEFAULT '',
+  access_token  VARCHAR NOT NULL DEFAULT '',
+  mark_read     BOOLEAN NOT NULL DEFAULT false,
+  PRIMARY KEY (user_id, service)
+);
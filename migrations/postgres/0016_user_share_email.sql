@@ -0,0 +1,4 @@
+-- Where each user emails items they share unless they say otherwise. Blank
+-- if they haven't said.
+ALTER TABLE rss_user ADD COLUMN IF NOT EXISTS share_email VARCHAR NOT NULL
+  DEFAULT '';
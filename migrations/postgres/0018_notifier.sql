@@ -0,0 +1,20 @@
+-- Chats we post new items to, such as on Telegram or Slack. feed_id is the
+-- feed whose items we post, or NULL for any feed the user subscribes to. We
+-- only post items whose title or description contains match, unless it's
+-- blank. Which of url, token, and chat_id a service needs depends on the
+-- service.
+CREATE TABLE rss_notifier (
+  id          SERIAL NOT NULL,
+  user_id     INTEGER NOT NULL REFERENCES rss_user(id)
+              ON DELETE CASCADE ON UPDATE CASCADE,
+  feed_id     INTEGER REFERENCES rss_feed(id)
+              ON DELETE CASCADE ON UPDATE CASCADE,
+  match       VARCHAR NOT NULL DEFAULT '',
+  service     VARCHAR NOT NULL,
+  url         VARCHAR NOT NULL DEFAULT '',
+  token       VARCHAR NOT NULL DEFAULT '',
+  chat_id     VARCHAR NOT NULL DEFAULT '',
+  PRIMARY KEY (id)
+);
+
+CREATE INDEX ON rss_notifier (user_id);
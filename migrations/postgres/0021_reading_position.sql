@@ -0,0 +1,13 @@
+-- Where each user was in each list of items they read, such as their unread
+-- items, so that they can carry on from there on another device. The position
+-- is the item at the top of their screen and how far past its top they were.
+CREATE TABLE rss_reading_position (
+  user_id     INTEGER NOT NULL REFERENCES rss_user(id)
+              ON DELETE CASCADE ON UPDATE CASCADE,
+  view        VARCHAR NOT NULL,
+  item_id     INTEGER NOT NULL REFERENCES rss_item(id)
+              ON DELETE CASCADE ON UPDATE CASCADE,
+  item_offset INTEGER NOT NULL,
+  update_time TIMESTAMP WITH TIME ZONE NOT NULL,
+  PRIMARY KEY (user_id, view)
+);
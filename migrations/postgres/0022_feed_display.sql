@@ -0,0 +1,4 @@
+-- How each user's lists show items from each feed they subscribe to: their
+-- full description, a summary of it, or only their title.
+ALTER TABLE rss_feed_subscription ADD COLUMN display VARCHAR NOT NULL
+  DEFAULT 'full' CHECK (display IN ('full', 'summary', 'title'));
@@ -0,0 +1,3 @@
+-- Whether the user's lists show items as one line each, without their
+-- descriptions, rather than expanded.
+ALTER TABLE rss_user ADD COLUMN compact_list BOOLEAN NOT NULL DEFAULT false;
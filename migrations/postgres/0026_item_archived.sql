@@ -0,0 +1,4 @@
+-- Whether we marked the item read when we recorded it because its feed was in
+-- archive mode.
+ALTER TABLE rss_item ADD COLUMN IF NOT EXISTS archived BOOLEAN NOT NULL
+  DEFAULT false;
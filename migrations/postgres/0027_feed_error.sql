@@ -0,0 +1,6 @@
+-- How many times in a row polling the feed failed, and why it last did. We
+-- reset these when polling succeeds.
+ALTER TABLE rss_feed ADD COLUMN IF NOT EXISTS error_count INTEGER NOT NULL
+  DEFAULT 0;
+ALTER TABLE rss_feed ADD COLUMN IF NOT EXISTS last_error VARCHAR NOT NULL
+  DEFAULT '';
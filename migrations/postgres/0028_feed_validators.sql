@@ -0,0 +1,7 @@
+-- The ETag and Last-Modified headers the feed was last served with. We send
+-- them back when we poll so that the host can tell us the feed hasn't changed
+-- rather than sending it again.
+ALTER TABLE rss_feed ADD COLUMN IF NOT EXISTS etag VARCHAR NOT NULL
+  DEFAULT '';
+ALTER TABLE rss_feed ADD COLUMN IF NOT EXISTS last_modified VARCHAR NOT NULL
+  DEFAULT '';
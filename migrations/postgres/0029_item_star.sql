@@ -0,0 +1,12 @@
+-- Items users starred to keep. This is apart from their read state, so items
+-- can be starred whether they're unread, read, or saved to read later.
+CREATE TABLE rss_item_star (
+  user_id     INTEGER NOT NULL REFERENCES rss_user(id)
+              ON DELETE CASCADE ON UPDATE CASCADE,
+  item_id     INTEGER NOT NULL REFERENCES rss_item(id)
+              ON DELETE CASCADE ON UPDATE CASCADE,
+  create_time TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+  PRIMARY KEY (user_id, item_id)
+);
+
+CREATE INDEX rss_item_star_item_id_idx ON rss_item_star (item_id);
@@ -0,0 +1,15 @@
+-- Media files items come with, such as a podcast episode's audio. type is
+-- the MIME type the feed gave, length is the size in bytes, and
+-- duration_seconds is how long it plays. Each is 0 or blank if the feed
+-- didn't say.
+CREATE TABLE rss_item_enclosure (
+  id               SERIAL NOT NULL,
+  item_id          INTEGER NOT NULL REFERENCES rss_item(id)
+                   ON DELETE CASCADE ON UPDATE CASCADE,
+  url              VARCHAR NOT NULL,
+  type             VARCHAR NOT NULL DEFAULT '',
+  length           BIGINT NOT NULL DEFAULT 0,
+  duration_seconds INTEGER NOT NULL DEFAULT 0,
+  PRIMARY KEY (id),
+  UNIQUE (item_id, url)
+);
@@ -0,0 +1,10 @@
+-- The categories or tags feeds give their items, as the feed wrote them. We
+-- list items in a category by looking them up here.
+CREATE TABLE rss_item_category (
+  item_id  INTEGER NOT NULL REFERENCES rss_item(id)
+           ON DELETE CASCADE ON UPDATE CASCADE,
+  category VARCHAR NOT NULL,
+  PRIMARY KEY (item_id, category)
+);
+
+CREATE INDEX rss_item_category_category_idx ON rss_item_category (category);
@@ -0,0 +1,13 @@
+-- Tags users put on items to organize them, such as the items they saved to
+-- read later. Tags are in lowercase.
+CREATE TABLE rss_item_tag (
+  user_id     INTEGER NOT NULL REFERENCES rss_user(id)
+              ON DELETE CASCADE ON UPDATE CASCADE,
+  item_id     INTEGER NOT NULL REFERENCES rss_item(id)
+              ON DELETE CASCADE ON UPDATE CASCADE,
+  tag         VARCHAR NOT NULL,
+  create_time TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+  PRIMARY KEY (user_id, item_id, tag)
+);
+
+CREATE INDEX rss_item_tag_item_id_idx ON rss_item_tag (item_id);
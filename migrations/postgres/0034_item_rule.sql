@@ -0,0 +1,21 @@
+-- Rules users have us apply to new items when they arrive. A rule matches
+-- items whose field (title, link, description, or any of them) contains the
+-- pattern, ignoring case, or matches it as a regular expression. If feed_id is
+-- set, it matches only that feed's items. action is what we do to matching
+-- items: mark them read or read later, star them, or give them the tag.
+CREATE TABLE rss_item_rule (
+  id          SERIAL NOT NULL,
+  user_id     INTEGER NOT NULL REFERENCES rss_user(id)
+              ON DELETE CASCADE ON UPDATE CASCADE,
+  feed_id     INTEGER REFERENCES rss_feed(id)
+              ON DELETE CASCADE ON UPDATE CASCADE,
+  field       VARCHAR NOT NULL,
+  match_type  VARCHAR NOT NULL,
+  pattern     VARCHAR NOT NULL,
+  action      VARCHAR NOT NULL,
+  tag         VARCHAR NOT NULL DEFAULT '',
+  create_time TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+  PRIMARY KEY (id)
+);
+
+CREATE INDEX rss_item_rule_user_id_idx ON rss_item_rule (user_id);
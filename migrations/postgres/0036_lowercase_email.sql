@@ -0,0 +1,12 @@
+-- The trigger lowercasing users' email addresses referred to email rather
+-- than NEW.email. PL/pgSQL can't resolve that, so adding or updating a user
+-- failed.
+CREATE OR REPLACE FUNCTION trigger_lowercase_email()
+RETURNS TRIGGER
+AS $$
+BEGIN
+  NEW.email := LOWER(NEW.email);
+  RETURN NEW;
+END
+$$
+LANGUAGE plpgsql;
@@ -0,0 +1,145 @@
+-- The same schema as migrations/postgres/0001_initial.sql.
+--
+-- SQLite has no enum types and triggers can't modify the row being written, so
+-- those parts differ.
+
+-- Track each feed to work with.
+CREATE TABLE rss_feed (
+  id                       INTEGER NOT NULL,
+  name                     VARCHAR NOT NULL,
+  uri                      VARCHAR NOT NULL,
+  update_frequency_seconds INTEGER NOT NULL,
+
+  -- Whether the poller actually polls this.
+  active                   BOOLEAN NOT NULL DEFAULT true,
+
+  last_update_time         TIMESTAMP,
+  create_time              TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  update_time              TIMESTAMP,
+  last_payload             BLOB,
+
+  -- Whether new items go directly to read state.
+  archive                  BOOLEAN NOT NULL,
+
+  UNIQUE (name),
+  UNIQUE (uri),
+  PRIMARY KEY (id)
+);
+
+CREATE INDEX rss_feed_active_idx ON rss_feed (active);
+
+CREATE TRIGGER au_rss_feed
+AFTER UPDATE ON rss_feed
+FOR EACH ROW WHEN NEW.update_time IS OLD.update_time
+BEGIN
+  UPDATE rss_feed SET update_time = CURRENT_TIMESTAMP WHERE id = NEW.id;
+END;
+
+-- Track RSS feed items.
+CREATE TABLE rss_item (
+  id               INTEGER NOT NULL,
+  -- HTML encoded.
+  title            VARCHAR NOT NULL,
+  -- HTML encoded.
+  description      VARCHAR NOT NULL,
+  -- HTML encoded.
+  link             VARCHAR NOT NULL,
+  rss_feed_id      INTEGER NOT NULL REFERENCES rss_feed(id)
+                   ON UPDATE CASCADE ON DELETE CASCADE,
+  publication_date TIMESTAMP NOT NULL,
+  create_time      TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  update_time      TIMESTAMP,
+  guid             VARCHAR,
+
+  -- It is possible to have same title/description I suppose.
+  UNIQUE (rss_feed_id, link),
+  UNIQUE (rss_feed_id, guid),
+  PRIMARY KEY (id)
+);
+
+CREATE TRIGGER au_rss_item
+AFTER UPDATE ON rss_item
+FOR EACH ROW WHEN NEW.update_time IS OLD.update_time
+BEGIN
+  UPDATE rss_item SET update_time = CURRENT_TIMESTAMP WHERE id = NEW.id;
+END;
+
+CREATE INDEX rss_item_publication_date_idx ON rss_item (publication_date);
+
+-- A user. Each user subscribes to feeds.
+CREATE TABLE rss_user (
+  id          INTEGER NOT NULL,
+  email       VARCHAR NOT NULL,
+  create_time TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  update_time TIMESTAMP,
+
+  -- Ensure lowercase after insert.
+  UNIQUE (email),
+  PRIMARY KEY (id)
+);
+
+CREATE TRIGGER ai_rss_user
+AFTER INSERT ON rss_user
+FOR EACH ROW WHEN NEW.email != LOWER(NEW.email)
+BEGIN
+  UPDATE rss_user SET email = LOWER(NEW.email) WHERE id = NEW.id;
+END;
+
+CREATE TRIGGER au_rss_user
+AFTER UPDATE ON rss_user
+FOR EACH ROW WHEN NEW.update_time IS OLD.update_time
+BEGIN
+  UPDATE rss_user SET email = LOWER(NEW.email),
+  update_time = CURRENT_TIMESTAMP WHERE id = NEW.id;
+END;
+
+-- Each user can flag an rss item as being in one state: unread, read, or
+-- read-later.
+-- We assume if an item is not in this table that it is unread.
+CREATE TABLE rss_item_state (
+  id          INTEGER NOT NULL,
+  state       VARCHAR NOT NULL
+              CHECK (state IN ('unread', 'read', 'read-later')),
+  item_id     INTEGER NOT NULL REFERENCES rss_item(id)
+              ON DELETE CASCADE ON UPDATE CASCADE,
+  user_id     INTEGER NOT NULL REFERENCES rss_user(id)
+              ON DELETE CASCADE ON UPDATE CASCADE,
+  create_time TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  update_time TIMESTAMP,
+  UNIQUE (user_id, item_id),
+  PRIMARY KEY (id)
+);
+
+CREATE TRIGGER au_rss_item_state
+AFTER UPDATE ON rss_item_state
+FOR EACH ROW WHEN NEW.update_time IS OLD.update_time
+BEGIN
+  UPDATE rss_item_state SET update_time = CURRENT_TIMESTAMP WHERE id = NEW.id;
+END;
+
+CREATE INDEX rss_item_state_item_id_idx ON rss_item_state (item_id);
+
+-- Table to hold items we mark read after having archived them. This means
+-- that they were more interesting and were probably clicked and read. Record
+-- them here to be able to refer to them more easily in the future.
+CREATE TABLE rss_item_read_after_archive (
+  id          INTEGER NOT NULL,
+  user_id     INTEGER NOT NULL REFERENCES rss_user(id)
+              ON DELETE CASCADE ON UPDATE CASCADE,
+  -- Not foreign keys so that we can clear out rss_item and keep these.
+  rss_feed_id INTEGER NOT NULL,
+  rss_item_id INTEGER NOT NULL,
+  create_time TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  update_time TIMESTAMP,
+
+  UNIQUE (user_id, rss_feed_id, rss_item_id),
+  PRIMARY KEY (id)
+);
+
+CREATE TRIGGER au_rss_item_read_after_archive
+AFTER UPDATE ON rss_item_read_after_archive
+FOR EACH ROW WHEN NEW.update_time IS OLD.update_time
+BEGIN
+  UPDATE rss_item_read_after_archive SET update_time = CURRENT_TIMESTAMP
+  WHERE id = NEW.id;
+END;
@@ -0,0 +1,2 @@
+-- Store each item's element as it was in the feed.
+ALTER TABLE rss_item ADD COLUMN raw VARCHAR;
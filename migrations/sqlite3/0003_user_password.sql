@@ -0,0 +1,3 @@
+-- Let users log in. Users without a password can't until one is set.
+ALTER TABLE rss_user ADD COLUMN password_hash VARCHAR;
+ALTER TABLE rss_user ADD COLUMN admin BOOLEAN NOT NULL DEFAULT false;
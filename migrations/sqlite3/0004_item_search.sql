@@ -0,0 +1,36 @@
+-- Index items' text so we can search them without scanning every item.
+--
+-- This is an external content table. It holds only the index and refers to
+-- rss_item for the text. Triggers keep it up to date.
+CREATE VIRTUAL TABLE rss_item_search USING fts4(
+  content="rss_item",
+  title,
+  description,
+  tokenize=porter
+);
+
+CREATE TRIGGER bu_rss_item_search BEFORE UPDATE OF title, description
+ON rss_item
+BEGIN
+  DELETE FROM rss_item_search WHERE docid = OLD.id;
+END;
+
+CREATE TRIGGER bd_rss_item_search BEFORE DELETE ON rss_item
+BEGIN
+  DELETE FROM rss_item_search WHERE docid = OLD.id;
+END;
+
+CREATE TRIGGER au_rss_item_search AFTER UPDATE OF title, description
+ON rss_item
+BEGIN
+  INSERT INTO rss_item_search (docid, title, description)
+  VALUES (NEW.id, NEW.title, NEW.description);
+END;
+
+CREATE TRIGGER ai_rss_item_search AFTER INSERT ON rss_item
+BEGIN
+  INSERT INTO rss_item_search (docid, title, description)
+  VALUES (NEW.id, NEW.title, NEW.description);
+END;
+
+INSERT INTO rss_item_search (rss_item_search) VALUES ('rebuild');
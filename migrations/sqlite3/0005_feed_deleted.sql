@@ -0,0 +1,3 @@
+-- Whether the feed was deleted. We keep deleted feeds so they can be restored
+-- along with any items we kept. We don't show their items.
+ALTER TABLE rss_feed ADD COLUMN deleted BOOLEAN NOT NULL DEFAULT false;
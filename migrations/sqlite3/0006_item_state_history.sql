@@ -0,0 +1,21 @@
+-- Each change to a user's state for an item. Setting an item to the state it
+-- was already in is not a change.
+CREATE TABLE rss_item_state_history (
+  id          INTEGER NOT NULL,
+  item_id     INTEGER NOT NULL REFERENCES rss_item(id)
+              ON DELETE CASCADE ON UPDATE CASCADE,
+  user_id     INTEGER NOT NULL REFERENCES rss_user(id)
+              ON DELETE CASCADE ON UPDATE CASCADE,
+  -- Unread if the item had no state.
+  old_state   VARCHAR NOT NULL
+              CHECK (old_state IN ('unread', 'read', 'read-later')),
+  new_state   VARCHAR NOT NULL
+              CHECK (new_state IN ('unread', 'read', 'read-later')),
+  create_time TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (id)
+);
+
+CREATE INDEX rss_item_state_history_user_id_create_time_idx
+ON rss_item_state_history (user_id, create_time);
+CREATE INDEX rss_item_state_history_item_id_idx
+ON rss_item_state_history (item_id);
@@ -0,0 +1,2 @@
+-- A note about the item, such as why the user saved it to read later.
+ALTER TABLE rss_item_state ADD COLUMN note VARCHAR;
@@ -0,0 +1,21 @@
+-- The feeds each user subscribes to.
+CREATE TABLE rss_feed_subscription (
+  id          INTEGER NOT NULL,
+  user_id     INTEGER NOT NULL REFERENCES rss_user(id)
+              ON DELETE CASCADE ON UPDATE CASCADE,
+  feed_id     INTEGER NOT NULL REFERENCES rss_feed(id)
+              ON DELETE CASCADE ON UPDATE CASCADE,
+  create_time TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  UNIQUE (user_id, feed_id),
+  PRIMARY KEY (id)
+);
+
+CREATE INDEX rss_feed_subscription_feed_id_idx
+ON rss_feed_subscription (feed_id);
+
+-- Until now everyone saw every feed.
+INSERT INTO rss_feed_subscription (user_id, feed_id)
+SELECT u.id, f.id
+FROM rss_user u
+CROSS JOIN rss_feed f
+WHERE f.deleted = false;
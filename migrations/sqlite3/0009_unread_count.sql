@@ -0,0 +1,25 @@
+-- How many of each feed's items each user has unread, by the UTC day the items
+-- were published. We keep these up to date as we add items and users set
+-- states so that counting unread items doesn't need to look at every item.
+--
+-- Counting by day lets us count items published since a time. Only the
+-- items of the day the time falls in need counting individually.
+CREATE TABLE rss_unread_count (
+  user_id         INTEGER NOT NULL REFERENCES rss_user(id)
+                  ON DELETE CASCADE ON UPDATE CASCADE,
+  feed_id         INTEGER NOT NULL REFERENCES rss_feed(id)
+                  ON DELETE CASCADE ON UPDATE CASCADE,
+  -- YYYY-MM-DD.
+  publication_day VARCHAR NOT NULL,
+  unread_count    INTEGER NOT NULL,
+  PRIMARY KEY (user_id, feed_id, publication_day)
+);
+
+INSERT INTO rss_unread_count
+(user_id, feed_id, publication_day, unread_count)
+SELECT u.id, ri.rss_feed_id, DATE(ri.publication_date), COUNT(*)
+FROM rss_user u
+CROSS JOIN rss_item ri
+LEFT JOIN rss_item_state ris ON ris.item_id = ri.id AND ris.user_id = u.id
+WHERE COALESCE(ris.state, 'unread') = 'unread'
+GROUP BY u.id, ri.rss_feed_id, DATE(ri.publication_date);
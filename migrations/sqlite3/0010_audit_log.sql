@@ -0,0 +1,14 @@
+-- Administrative actions: changes to feeds and users, and setting the states
+-- of many items at once. The actor is who did it. There is none for actions
+-- we take ourselves, such as the poller's.
+CREATE TABLE rss_audit_log (
+  id          INTEGER NOT NULL,
+  actor_id    INTEGER REFERENCES rss_user(id)
+              ON DELETE SET NULL ON UPDATE CASCADE,
+  action      VARCHAR NOT NULL,
+  details     VARCHAR NOT NULL,
+  create_time TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (id)
+);
+
+CREATE INDEX rss_audit_log_create_time_idx ON rss_audit_log (create_time);
@@ -0,0 +1,7 @@
+-- How long to keep each feed's items. We keep items published in the last
+-- retention_days days as well as the newest retention_items items. 0 turns
+-- that rule off. With both off we keep items forever.
+ALTER TABLE rss_feed ADD COLUMN retention_days INTEGER NOT NULL DEFAULT 0
+  CHECK (retention_days >= 0);
+ALTER TABLE rss_feed ADD COLUMN retention_items INTEGER NOT NULL DEFAULT 0
+  CHECK (retention_items >= 0);
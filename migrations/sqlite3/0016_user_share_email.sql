@@ -0,0 +1,3 @@
+-- Where each user emails items they share unless they say otherwise. Blank
+-- if they haven't said.
+ALTER TABLE rss_user ADD COLUMN share_email VARCHAR NOT NULL DEFAULT '';
@@ -0,0 +1,10 @@
+-- The main content of items' articles, fetched from their links when someone
+-- asks to read them within gorse. content is HTML we made safe to show.
+CREATE TABLE rss_item_reader_view (
+  item_id    INTEGER NOT NULL REFERENCES rss_item(id)
+             ON DELETE CASCADE ON UPDATE CASCADE,
+  title      VARCHAR NOT NULL,
+  content    VARCHAR NOT NULL,
+  fetch_time TIMESTAMP NOT NULL,
+  PRIMARY KEY (item_id)
+);
@@ -0,0 +1,3 @@
+-- Where to email books of each user's items to read later, such as their
+-- Kindle's address. Blank if they haven't said.
+ALTER TABLE rss_user ADD COLUMN kindle_email VARCHAR NOT NULL DEFAULT '';
@@ -0,0 +1,7 @@
+-- The token in the URL of the feed of items each user starred, if they
+-- publish one. NULL if they don't.
+ALTER TABLE rss_user ADD COLUMN share_token VARCHAR;
+CREATE UNIQUE INDEX rss_user_share_token_idx ON rss_user (share_token);
+
+-- Whether the user left the item out of the feed of items they starred.
+ALTER TABLE rss_item_state ADD COLUMN unshared BOOLEAN NOT NULL DEFAULT false;
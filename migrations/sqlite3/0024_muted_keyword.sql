@@ -0,0 +1,14 @@
+-- Words and phrases users don't want to see. We hide unread items whose
+-- title or description contains one, ignoring case. If mark_read is set, we
+-- also mark new items containing it read when they arrive. We store phrases
+-- in lowercase.
+CREATE TABLE rss_muted_keyword (
+  id          INTEGER NOT NULL,
+  user_id     INTEGER NOT NULL REFERENCES rss_user(id)
+              ON DELETE CASCADE ON UPDATE CASCADE,
+  phrase      VARCHAR NOT NULL,
+  mark_read   BOOLEAN NOT NULL DEFAULT false,
+  create_time TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (id),
+  UNIQUE (user_id, phrase)
+);
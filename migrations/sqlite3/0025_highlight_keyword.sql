@@ -0,0 +1,12 @@
+-- Words and phrases users watch for. We mark items whose title or description
+-- contains one, ignoring case, and can list only those items. We store
+-- phrases in lowercase.
+CREATE TABLE rss_highlight_keyword (
+  id          INTEGER NOT NULL,
+  user_id     INTEGER NOT NULL REFERENCES rss_user(id)
+              ON DELETE CASCADE ON UPDATE CASCADE,
+  phrase      VARCHAR NOT NULL,
+  create_time TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (id),
+  UNIQUE (user_id, phrase)
+);
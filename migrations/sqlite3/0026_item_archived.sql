@@ -0,0 +1,3 @@
+-- Whether we marked the item read when we recorded it because its feed was in
+-- archive mode.
+ALTER TABLE rss_item ADD COLUMN archived BOOLEAN NOT NULL DEFAULT false;
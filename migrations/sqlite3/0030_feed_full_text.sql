@@ -0,0 +1,4 @@
+-- Whether we fetch the article each of the feed's new items links to when we
+-- poll it, for feeds whose items are only summaries. We keep what we fetch as
+-- the item's reader view.
+ALTER TABLE rss_feed ADD COLUMN full_text BOOLEAN NOT NULL DEFAULT false;
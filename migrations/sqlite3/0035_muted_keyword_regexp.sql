@@ -0,0 +1,5 @@
+-- Whether the muted phrase is a regular expression. We keep regular
+-- expressions as users give them rather than in lowercase, and always mark
+-- new items matching them read.
+ALTER TABLE rss_muted_keyword
+ADD COLUMN is_regexp BOOLEAN NOT NULL DEFAULT false;
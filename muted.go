@@ -0,0 +1,209 @@
+package gorse
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Users may mute words and phrases they don't want to see, such as during a
+// big news story. We hide unread items containing them. Users may also have
+// us mark new items containing them read when they arrive, so they don't
+// linger in counts or in other views.
+//
+// Users may mute regular expressions too. We can only match those when items
+// arrive, so we always mark new items matching them read.
+
+// MutedKeyword is a word or phrase a user doesn't want to see.
+type MutedKeyword struct {
+	ID     int64
+	UserID int
+
+	// Phrase is what items must contain, ignoring case, to be muted. See
+	// NormalizeKeyword for its form. If Regexp is set, it is instead a regular
+	// expression items must match, ignoring case.
+	Phrase string
+
+	// Regexp is whether Phrase is a regular expression.
+	Regexp bool
+
+	// MarkRead is whether we mark new items containing the phrase read when
+	// they arrive rather than only hiding them. It is always set for regular
+	// expressions.
+	MarkRead bool
+
+	CreateTime time.Time
+}
+
+// Matches decides whether the item contains the phrase, or matches it if it
+// is a regular expression. A regular expression that doesn't compile matches
+// nothing.
+func (m MutedKeyword) Matches(item *Item) bool {
+	if !m.Regexp {
+		return containsKeyword(item.Title, item.Description, m.Phrase)
+	}
+
+	re, err := regexpIgnoringCase(m.Phrase)
+	if err != nil {
+		return false
+	}
+	return re.MatchString(item.Title) || re.MatchString(item.Description)
+}
+
+// NormalizeMutedRegexp puts the regular expression in the form we store it
+// in. This is without surrounding whitespace. Unlike phrases, we keep its
+// case as that can change its meaning. It is an error if it is blank, too
+// long, or doesn't compile.
+func NormalizeMutedRegexp(expr string) (string, error) {
+	expr = strings.TrimSpace(expr)
+	if expr == "" {
+		return "", fmt.Errorf("regular expression is blank")
+	}
+	if len([]rune(expr)) > MaxKeywordLength {
+		return "", fmt.Errorf("regular expression is longer than %d characters",
+			MaxKeywordLength)
+	}
+	if _, err := regexpIgnoringCase(expr); err != nil {
+		return "", fmt.Errorf("invalid regular expression: %s", err)
+	}
+	return expr, nil
+}
+
+// MuteKeyword mutes the phrase for the user. If isRegexp is set, the phrase is
+// a regular expression, and we always mark new items matching it read. If
+// they already muted it, we update whether we mark new items containing it
+// read.
+func MuteKeyword(ctx context.Context, db Querier, userID int, phrase string,
+	isRegexp, markRead bool) error {
+	var err error
+	if isRegexp {
+		phrase, err = NormalizeMutedRegexp(phrase)
+		markRead = true
+	} else {
+		phrase, err = NormalizeKeyword(phrase)
+	}
+	if err != nil {
+		return err
+	}
+
+	query := `
+INSERT INTO rss_muted_keyword (user_id, phrase, is_regexp, mark_read)
+VALUES ($1, $2, $3, $4)
+ON CONFLICT (user_id, phrase) DO UPDATE
+SET is_regexp = EXCLUDED.is_regexp, mark_read = EXCLUDED.mark_read
+`
+
+	if _, err := db.ExecContext(ctx, query, userID, phrase, isRegexp,
+		markRead); err != nil {
+		return fmt.Errorf("unable to mute %q for user %d: %s", phrase, userID,
+			err)
+	}
+
+	return nil
+}
+
+// UnmuteKeyword stops muting the phrase or regular expression for the user.
+// It returns ErrNotFound if they didn't mute it.
+func UnmuteKeyword(ctx context.Context, db Querier, userID int,
+	phrase string) error {
+	normalized, err := NormalizeKeyword(phrase)
+	if err != nil {
+		return err
+	}
+
+	query := `
+DELETE FROM rss_muted_keyword
+WHERE user_id = $1 AND
+((NOT is_regexp AND phrase = $2) OR (is_regexp AND phrase = $3))
+`
+
+	result, err := db.ExecContext(ctx, query, userID, normalized,
+		strings.TrimSpace(phrase))
+	if err != nil {
+		return fmt.Errorf("unable to unmute %q for user %d: %s", phrase, userID,
+			err)
+	}
+
+	return requireOneRow(result)
+}
+
+// ListMutedKeywords retrieves the phrases the user muted in alphabetical
+// order.
+func ListMutedKeywords(ctx context.Context, db Querier,
+	userID int) ([]MutedKeyword, error) {
+	query := `
+SELECT id, user_id, phrase, is_regexp, mark_read, create_time
+FROM rss_muted_keyword
+WHERE user_id = $1
+ORDER BY phrase
+`
+
+	rows, err := db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("unable to query muted keywords: %s", err)
+	}
+
+	var mutes []MutedKeyword
+	for rows.Next() {
+		var m MutedKeyword
+		if err := rows.Scan(&m.ID, &m.UserID, &m.Phrase, &m.Regexp, &m.MarkRead,
+			&m.CreateTime); err != nil {
+			_ = rows.Close()
+			return nil, fmt.Errorf("failed to scan row: %s", err)
+		}
+		mutes = append(mutes, m)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failure fetching rows: %s", err)
+	}
+
+	return mutes, nil
+}
+
+// markMutedItemRead marks the new item read for each user who muted a phrase
+// it contains and asked us to mark such items read, or a regular expression
+// it matches.
+func markMutedItemRead(ctx context.Context, db Querier, itemID int64,
+	item *Item) error {
+	query := `
+SELECT user_id, phrase, is_regexp
+FROM rss_muted_keyword
+WHERE mark_read
+ORDER BY user_id
+`
+
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return fmt.Errorf("unable to query muted keywords: %s", err)
+	}
+
+	var userIDs []int
+	for rows.Next() {
+		var m MutedKeyword
+		if err := rows.Scan(&m.UserID, &m.Phrase, &m.Regexp); err != nil {
+			_ = rows.Close()
+			return fmt.Errorf("failed to scan row: %s", err)
+		}
+		if !m.Matches(item) {
+			continue
+		}
+		if len(userIDs) > 0 && userIDs[len(userIDs)-1] == m.UserID {
+			continue
+		}
+		userIDs = append(userIDs, m.UserID)
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failure fetching rows: %s", err)
+	}
+
+	for _, userID := range userIDs {
+		if err := DBSetItemReadState(ctx, db, itemID, userID, Read); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,153 @@
+package gorse
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// Notifier is a chat we post new items to, such as on Telegram or Slack.
+//
+// Which of URL, Token, and ChatID a service needs depends on the service. See
+// the notify package.
+type Notifier struct {
+	ID     int64
+	UserID int
+
+	// FeedID is the feed whose new items we post. 0 means any feed the user
+	// subscribes to.
+	FeedID int64
+
+	// Match is text an item's title or description must contain, ignoring
+	// case, for us to post it. Blank means every item.
+	Match string
+
+	// Service is the service's name, such as slack.
+	Service string
+
+	// URL is where to post. For Slack this is the webhook. For Telegram it's
+	// the Bot API if it's not the usual one.
+	URL string
+
+	// Token authorizes us to post, such as a Telegram bot's token.
+	Token string
+
+	// ChatID is the chat to post to, such as on Telegram.
+	ChatID string
+}
+
+// Matches decides whether the item is one we post.
+func (n Notifier) Matches(item *Item) bool {
+	if n.Match == "" {
+		return true
+	}
+	match := strings.ToLower(n.Match)
+	return strings.Contains(strings.ToLower(item.Title), match) ||
+		strings.Contains(strings.ToLower(item.Description), match)
+}
+
+// AddNotifier records the notifier. It returns the notifier's ID.
+func AddNotifier(ctx context.Context, db Querier, n Notifier) (int64, error) {
+	if n.Service == "" {
+		return -1, fmt.Errorf("notifier of user %d has no service", n.UserID)
+	}
+
+	var feedID sql.NullInt64
+	if n.FeedID != 0 {
+		feedID = sql.NullInt64{Int64: n.FeedID, Valid: true}
+	}
+
+	query := `
+INSERT INTO rss_notifier
+(user_id, feed_id, match, service, url, token, chat_id)
+VALUES ($1, $2, $3, $4, $5, $6, $7)
+RETURNING id
+`
+
+	var id int64
+	if err := db.QueryRowContext(ctx, query, n.UserID, feedID, n.Match,
+		n.Service, n.URL, n.Token, n.ChatID).Scan(&id); err != nil {
+		return -1, fmt.Errorf("unable to add %s notifier of user %d: %s",
+			n.Service, n.UserID, err)
+	}
+
+	return id, nil
+}
+
+// ListNotifiers retrieves the user's notifiers in the order they added them.
+func ListNotifiers(ctx context.Context, db Querier, userID int) ([]Notifier,
+	error) {
+	query := `
+SELECT id, user_id, feed_id, match, service, url, token, chat_id
+FROM rss_notifier
+WHERE user_id = $1
+ORDER BY id
+`
+
+	return queryNotifiers(ctx, db, query, userID)
+}
+
+// FeedNotifiers retrieves the notifiers that post the feed's new items. These
+// are those for the feed and those for any feed of users subscribing to it.
+func FeedNotifiers(ctx context.Context, db Querier, feedID int64) ([]Notifier,
+	error) {
+	query := `
+SELECT rn.id, rn.user_id, rn.feed_id, rn.match, rn.service, rn.url,
+rn.token, rn.chat_id
+FROM rss_notifier rn
+WHERE rn.feed_id = $1 OR
+  (rn.feed_id IS NULL AND EXISTS (
+    SELECT 1 FROM rss_feed_subscription rfs
+    WHERE rfs.user_id = rn.user_id AND rfs.feed_id = $1))
+ORDER BY rn.id
+`
+
+	return queryNotifiers(ctx, db, query, feedID)
+}
+
+// queryNotifiers runs a query selecting notifiers.
+func queryNotifiers(ctx context.Context, db Querier, query string,
+	arg interface{}) ([]Notifier, error) {
+	rows, err := db.QueryContext(ctx, query, arg)
+	if err != nil {
+		return nil, fmt.Errorf("unable to query notifiers: %s", err)
+	}
+
+	var notifiers []Notifier
+	for rows.Next() {
+		var n Notifier
+		var feedID sql.NullInt64
+		if err := rows.Scan(&n.ID, &n.UserID, &feedID, &n.Match, &n.Service,
+			&n.URL, &n.Token, &n.ChatID); err != nil {
+			_ = rows.Close()
+			return nil, fmt.Errorf("failed to scan row: %s", err)
+		}
+		n.FeedID = feedID.Int64
+		notifiers = append(notifiers, n)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failure fetching rows: %s", err)
+	}
+
+	return notifiers, nil
+}
+
+// DeleteNotifier removes the user's notifier. It returns ErrNotFound if they
+// don't have it.
+func DeleteNotifier(ctx context.Context, db Querier, userID int,
+	id int64) error {
+	query := `
+DELETE FROM rss_notifier
+WHERE user_id = $1 AND id = $2
+`
+
+	result, err := db.ExecContext(ctx, query, userID, id)
+	if err != nil {
+		return fmt.Errorf("unable to delete notifier %d of user %d: %s", id,
+			userID, err)
+	}
+
+	return requireOneRow(result)
+}
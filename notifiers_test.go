@@ -0,0 +1,29 @@
+package gorse
+
+import (
+	"testing"
+
+	"github.com/horgh/rss"
+)
+
+func TestNotifierMatches(t *testing.T) {
+	item := &Item{Item: rss.Item{Title: "Fish and chips",
+		Description: "<p>With <b>Vinegar</b></p>"}}
+
+	tests := []struct {
+		Match string
+		Want  bool
+	}{
+		{"", true},
+		{"FISH", true},
+		{"vinegar", true},
+		{"salt", false},
+	}
+
+	for _, test := range tests {
+		if got := (Notifier{Match: test.Match}).Matches(item); got != test.Want {
+			t.Errorf("Matches() with match %q = %t, wanted %t", test.Match, got,
+				test.Want)
+		}
+	}
+}
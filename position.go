@@ -0,0 +1,86 @@
+package gorse
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+	"unicode/utf8"
+)
+
+// MaxViewLength is the longest name of a view we keep reading positions for.
+const MaxViewLength = 100
+
+// ReadingPosition is where a user was in a list of items, such as their
+// unread items, so that they can carry on from there on another device.
+type ReadingPosition struct {
+	UserID int
+
+	// View names the list, such as unread or read-later.
+	View string
+
+	// ItemID is the item at the top of the user's screen.
+	ItemID int64
+
+	// Offset is how far past the top of the item the user had scrolled, in
+	// pixels.
+	Offset int
+
+	// UpdateTime is when the user was there.
+	UpdateTime time.Time
+}
+
+// GetReadingPosition retrieves where the user was in the view. It returns
+// ErrNotFound if we don't know.
+func GetReadingPosition(ctx context.Context, db Querier, userID int,
+	view string) (*ReadingPosition, error) {
+	query := `
+SELECT item_id, item_offset, update_time
+FROM rss_reading_position
+WHERE user_id = $1 AND view = $2
+`
+
+	position := &ReadingPosition{UserID: userID, View: view}
+	err := db.QueryRowContext(ctx, query, userID, view).Scan(&position.ItemID,
+		&position.Offset, &position.UpdateTime)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to look up reading position of user %d: %s",
+			userID, err)
+	}
+	position.UpdateTime = position.UpdateTime.UTC()
+
+	return position, nil
+}
+
+// SetReadingPosition records where the user is in the view, replacing where
+// they were.
+func SetReadingPosition(ctx context.Context, db Querier,
+	position ReadingPosition) error {
+	if position.View == "" ||
+		utf8.RuneCountInString(position.View) > MaxViewLength {
+		return fmt.Errorf("view must be 1 to %d characters", MaxViewLength)
+	}
+	if position.Offset < 0 {
+		return fmt.Errorf("offset must not be negative")
+	}
+
+	query := `
+INSERT INTO rss_reading_position
+(user_id, view, item_id, item_offset, update_time)
+VALUES ($1, $2, $3, $4, $5)
+ON CONFLICT (user_id, view) DO UPDATE
+SET item_id = EXCLUDED.item_id, item_offset = EXCLUDED.item_offset,
+update_time = EXCLUDED.update_time
+`
+
+	if _, err := db.ExecContext(ctx, query, position.UserID, position.View,
+		position.ItemID, position.Offset, position.UpdateTime.UTC()); err != nil {
+		return fmt.Errorf("unable to set reading position of user %d: %s",
+			position.UserID, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,97 @@
+package gorse
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// ReadAfterArchive is an item a user read after saving it to read later. We
+// record these in rss_item_read_after_archive.
+type ReadAfterArchive struct {
+	ID     int64
+	UserID int
+	FeedID int64
+	ItemID int64
+
+	// Title, Link, and FeedName are blank if the item or feed no longer
+	// exists. The record doesn't refer to them with foreign keys.
+	Title    string
+	Link     string
+	FeedName string
+
+	// Time is when the user read it.
+	Time time.Time
+}
+
+// ReadAfterArchives retrieves the items the user read after saving them to
+// read later, most recently read first.
+//
+// limit is the most to retrieve. offset skips this many first and only applies
+// with a limit. See FindItems.
+func ReadAfterArchives(ctx context.Context, db Querier, userID, limit,
+	offset int) ([]ReadAfterArchive, error) {
+	query := `
+SELECT
+rira.id, rira.user_id, rira.rss_feed_id, rira.rss_item_id,
+COALESCE(ri.title, ''), COALESCE(ri.link, ''), COALESCE(rf.name, ''),
+rira.create_time
+FROM rss_item_read_after_archive rira
+LEFT JOIN rss_item ri ON ri.id = rira.rss_item_id
+LEFT JOIN rss_feed rf ON rf.id = rira.rss_feed_id
+WHERE rira.user_id = $1
+ORDER BY rira.create_time DESC, rira.id DESC`
+	args := []interface{}{userID}
+
+	if limit > 0 {
+		args = append(args, limit)
+		query += fmt.Sprintf("\nLIMIT $%d", len(args))
+
+		if offset > 0 {
+			args = append(args, offset)
+			query += fmt.Sprintf("\nOFFSET $%d", len(args))
+		}
+	}
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to query items read after archive: %s",
+			err)
+	}
+
+	var records []ReadAfterArchive
+	for rows.Next() {
+		var record ReadAfterArchive
+		if err := rows.Scan(&record.ID, &record.UserID, &record.FeedID,
+			&record.ItemID, &record.Title, &record.Link, &record.FeedName,
+			&record.Time); err != nil {
+			_ = rows.Close()
+			return nil, fmt.Errorf("failed to scan row: %s", err)
+		}
+		record.Time = record.Time.UTC()
+		records = append(records, record)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failure fetching rows: %s", err)
+	}
+
+	return records, nil
+}
+
+// CountReadAfterArchives counts the items the user read after saving them to
+// read later.
+func CountReadAfterArchives(ctx context.Context, db Querier,
+	userID int) (int, error) {
+	query := `
+SELECT COUNT(*) FROM rss_item_read_after_archive WHERE user_id = $1
+`
+
+	var count int
+	if err := db.QueryRowContext(ctx, query, userID).Scan(&count); err != nil {
+		return -1, fmt.Errorf("unable to count items read after archive: %s",
+			err)
+	}
+
+	return count, nil
+}
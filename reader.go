@@ -0,0 +1,376 @@
+package gorse
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"html/template"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+	"golang.org/x/net/html/charset"
+)
+
+// ReaderView is the main content of an item's article, fetched from its link
+// so that it can be read within gorse. This is what browsers' reader modes
+// show.
+type ReaderView struct {
+	ItemID int64
+
+	// Title is the article's title.
+	Title string
+
+	// Content is the article's content as HTML. We allow only elements and
+	// attributes we know to be safe, so it can go in our pages as is.
+	Content template.HTML
+
+	// FetchTime is when we fetched the article.
+	FetchTime time.Time
+}
+
+// GetReaderView retrieves the reader view of the item. It returns ErrNotFound
+// if we don't have one.
+func GetReaderView(ctx context.Context, db Querier, itemID int64) (*ReaderView,
+	error) {
+	query := `
+SELECT title, content, fetch_time
+FROM rss_item_reader_view
+WHERE item_id = $1
+`
+
+	view := &ReaderView{ItemID: itemID}
+	var content string
+	err := db.QueryRowContext(ctx, query, itemID).Scan(&view.Title, &content,
+		&view.FetchTime)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to look up reader view of item ID [%d]: %s",
+			itemID, err)
+	}
+	view.Content = template.HTML(content)
+	view.FetchTime = view.FetchTime.UTC()
+
+	return view, nil
+}
+
+// SetReaderView records the reader view, replacing any the item had.
+func SetReaderView(ctx context.Context, db Querier, view ReaderView) error {
+	query := `
+INSERT INTO rss_item_reader_view (item_id, title, content, fetch_time)
+VALUES ($1, $2, $3, $4)
+ON CONFLICT (item_id) DO UPDATE
+SET title = EXCLUDED.title, content = EXCLUDED.content,
+fetch_time = EXCLUDED.fetch_time
+`
+
+	if _, err := db.ExecContext(ctx, query, view.ItemID, view.Title,
+		string(view.Content), view.FetchTime.UTC()); err != nil {
+		return fmt.Errorf("unable to set reader view of item ID [%d]: %s",
+			view.ItemID, err)
+	}
+
+	return nil
+}
+
+// FullTextContents retrieves the articles we fetched for those of the items
+// whose feeds are in full text mode, by item ID. Items we don't have the
+// article of aren't included.
+func FullTextContents(ctx context.Context, db Querier,
+	itemIDs []int64) (map[int64]string, error) {
+	contents := map[int64]string{}
+	if len(itemIDs) == 0 {
+		return contents, nil
+	}
+
+	placeholders := make([]string, len(itemIDs))
+	params := make([]interface{}, len(itemIDs))
+	for i, id := range itemIDs {
+		placeholders[i] = fmt.Sprintf("$%d", i+1)
+		params[i] = id
+	}
+
+	query := `
+SELECT rirv.item_id, rirv.content
+FROM rss_item_reader_view rirv
+JOIN rss_item ri ON ri.id = rirv.item_id
+JOIN rss_feed rf ON rf.id = ri.rss_feed_id
+WHERE rirv.item_id IN (` + strings.Join(placeholders, ", ") + `) AND
+rf.full_text = true
+`
+
+	rows, err := db.QueryContext(ctx, query, params...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to query full text of items: %s", err)
+	}
+
+	for rows.Next() {
+		var id int64
+		var content string
+		if err := rows.Scan(&id, &content); err != nil {
+			_ = rows.Close()
+			return nil, fmt.Errorf("failed to scan row: %s", err)
+		}
+		contents[id] = content
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failure fetching rows: %s", err)
+	}
+
+	return contents, nil
+}
+
+// ExtractReaderView finds the main content of the HTML page at the URL.
+// contentType is the Content-Type the page was served with, if any.
+//
+// We look for an article or main element, and failing that, the element with
+// the most paragraph text in it. This is a simpler version of what
+// Readability does. We then drop everything but basic formatting, links, and
+// images, and resolve their URLs against the page's.
+func ExtractReaderView(data []byte, contentType,
+	pageURL string) (ReaderView, error) {
+	reader, err := charset.NewReader(bytes.NewReader(data), contentType)
+	if err != nil {
+		return ReaderView{}, fmt.Errorf("unable to decode HTML: %s", err)
+	}
+
+	doc, err := html.Parse(reader)
+	if err != nil {
+		return ReaderView{}, fmt.Errorf("unable to parse HTML: %s", err)
+	}
+
+	base, err := url.Parse(pageURL)
+	if err != nil {
+		return ReaderView{}, fmt.Errorf("invalid page URL: %s: %s", pageURL, err)
+	}
+	if href := findBaseHref(doc); href != "" {
+		if u, err := base.Parse(href); err == nil {
+			base = u
+		}
+	}
+
+	link, err := ParseSavedLink(data, contentType, pageURL)
+	if err != nil {
+		return ReaderView{}, err
+	}
+
+	removeClutter(doc)
+
+	root := mainContent(doc)
+	if root == nil {
+		return ReaderView{}, fmt.Errorf("no content found")
+	}
+
+	var b strings.Builder
+	for c := root.FirstChild; c != nil; c = c.NextSibling {
+		writeReaderHTML(&b, c, base)
+	}
+
+	content := strings.TrimSpace(b.String())
+	if content == "" {
+		return ReaderView{}, fmt.Errorf("no content found")
+	}
+
+	return ReaderView{
+		Title:   link.Title,
+		Content: template.HTML(content),
+	}, nil
+}
+
+// clutterElements are elements that are never part of an article's content.
+var clutterElements = map[atom.Atom]struct{}{
+	atom.Aside:    {},
+	atom.Button:   {},
+	atom.Footer:   {},
+	atom.Form:     {},
+	atom.Header:   {},
+	atom.Iframe:   {},
+	atom.Nav:      {},
+	atom.Noscript: {},
+	atom.Object:   {},
+	atom.Script:   {},
+	atom.Style:    {},
+	atom.Svg:      {},
+	atom.Template: {},
+}
+
+// removeClutter removes elements that are never part of an article's
+// content, such as navigation and scripts.
+func removeClutter(n *html.Node) {
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling
+		if _, ok := clutterElements[c.DataAtom]; ok &&
+			c.Type == html.ElementNode {
+			n.RemoveChild(c)
+		} else {
+			removeClutter(c)
+		}
+		c = next
+	}
+}
+
+// mainContent finds the element holding the page's main content.
+func mainContent(doc *html.Node) *html.Node {
+	// Sites marking up their content tell us where it is. There may be more
+	// than one article, such as for comments, so we take the one with the most
+	// text.
+	var best *html.Node
+	bestLength := 0
+	for _, a := range []atom.Atom{atom.Article, atom.Main} {
+		for _, n := range findElements(doc, a) {
+			if length := len(textContent(n)); length > bestLength {
+				best, bestLength = n, length
+			}
+		}
+		if best != nil {
+			return best
+		}
+	}
+
+	// Otherwise score each element by the paragraph text in it. Paragraphs
+	// count fully towards their parent and half towards its parent. Short
+	// paragraphs are usually captions or bylines so we skip them.
+	scores := map[*html.Node]int{}
+	for _, p := range findElements(doc, atom.P) {
+		length := len(textContent(p))
+		if length < 25 || p.Parent == nil {
+			continue
+		}
+		scores[p.Parent] += length
+		if p.Parent.Parent != nil {
+			scores[p.Parent.Parent] += length / 2
+		}
+	}
+
+	bestScore := 0
+	for n, score := range scores {
+		if score > bestScore {
+			best, bestScore = n, score
+		}
+	}
+	if best != nil {
+		return best
+	}
+
+	return findElement(doc, atom.Body)
+}
+
+// findElements finds every element of the given type under n.
+func findElements(n *html.Node, a atom.Atom) []*html.Node {
+	var found []*html.Node
+	var find func(*html.Node)
+	find = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.DataAtom == a {
+			found = append(found, n)
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			find(c)
+		}
+	}
+	find(n)
+	return found
+}
+
+// readerElements are the elements we keep in a reader view, along with the
+// attributes we keep on each. We keep the content of elements not listed but
+// not the elements themselves.
+var readerElements = map[atom.Atom][]string{
+	atom.A:          {"href"},
+	atom.B:          nil,
+	atom.Blockquote: nil,
+	atom.Br:         nil,
+	atom.Code:       nil,
+	atom.Dd:         nil,
+	atom.Dl:         nil,
+	atom.Dt:         nil,
+	atom.Em:         nil,
+	atom.Figcaption: nil,
+	atom.Figure:     nil,
+	atom.H1:         nil,
+	atom.H2:         nil,
+	atom.H3:         nil,
+	atom.H4:         nil,
+	atom.H5:         nil,
+	atom.H6:         nil,
+	atom.Hr:         nil,
+	atom.I:          nil,
+	atom.Img:        {"src", "alt"},
+	atom.Li:         nil,
+	atom.Ol:         nil,
+	atom.P:          nil,
+	atom.Pre:        nil,
+	atom.Strong:     nil,
+	atom.Sub:        nil,
+	atom.Sup:        nil,
+	atom.Table:      nil,
+	atom.Tbody:      nil,
+	atom.Td:         nil,
+	atom.Th:         nil,
+	atom.Thead:      nil,
+	atom.Tr:         nil,
+	atom.Ul:         nil,
+}
+
+// voidElements have no content or end tag.
+var voidElements = map[atom.Atom]struct{}{
+	atom.Br:  {},
+	atom.Hr:  {},
+	atom.Img: {},
+}
+
+// writeReaderHTML writes the node as HTML with only the elements and
+// attributes in readerElements.
+func writeReaderHTML(b *strings.Builder, n *html.Node, base *url.URL) {
+	switch n.Type {
+	case html.TextNode:
+		b.WriteString(html.EscapeString(n.Data))
+		return
+	case html.ElementNode:
+	default:
+		return
+	}
+
+	attrs, keep := readerElements[n.DataAtom]
+	if keep {
+		b.WriteString("<" + n.DataAtom.String())
+		for _, name := range attrs {
+			value := attr(n, name)
+			if name == "href" || name == "src" {
+				value = readerURL(base, value)
+			}
+			if value == "" {
+				continue
+			}
+			b.WriteString(" " + name + `="` + html.EscapeString(value) + `"`)
+		}
+		b.WriteString(">")
+	}
+
+	if _, ok := voidElements[n.DataAtom]; ok {
+		return
+	}
+
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		writeReaderHTML(b, c, base)
+	}
+
+	if keep {
+		b.WriteString("</" + n.DataAtom.String() + ">")
+	}
+}
+
+// readerURL resolves the URL against the page's. We allow only http and https
+// URLs so that a page can't give us a javascript: link.
+func readerURL(base *url.URL, ref string) string {
+	u, err := url.Parse(resolveURL(base, strings.TrimSpace(ref)))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return ""
+	}
+	return u.String()
+}
@@ -0,0 +1,79 @@
+package gorse
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExtractReaderView(t *testing.T) {
+	tests := []struct {
+		Name    string
+		HTML    string
+		Title   string
+		Want    []string
+		NotWant []string
+	}{
+		{
+			Name: "article",
+			HTML: `<html><head><title>A page</title></head><body>
+<nav><a href="/">Home</a></nav>
+<article><p>Short</p></article>
+<article><h1>Heading</h1><p class="x" onclick="evil()">The <b>story</b>.</p>
+<script>evil()</script></article>
+<footer>Copyright</footer>
+</body></html>`,
+			Title:   "A page",
+			Want:    []string{"<h1>Heading</h1>", "<p>The <b>story</b>.</p>"},
+			NotWant: []string{"Home", "Short", "evil", "class", "Copyright"},
+		},
+		{
+			Name: "paragraphs",
+			HTML: `<body><div class="sidebar"><p>Links</p></div>
+<div class="post"><div>
+<p>This is the first paragraph of the post.</p>
+<p>This is the second paragraph of the post.</p>
+</div></div></body>`,
+			Want:    []string{"first paragraph", "second paragraph"},
+			NotWant: []string{"Links", "<div"},
+		},
+		{
+			Name: "urls",
+			HTML: `<article><p><a href="/other">Relative</a>
+<a href="javascript:evil()">Script</a>
+<img src="pic.png" alt="A &quot;pic&quot;" width="1"></p></article>`,
+			Want: []string{`<a href="https://example.com/other">Relative</a>`,
+				"<a>Script</a>",
+				`<img src="https://example.com/posts/pic.png" alt="A &#34;pic&#34;">`},
+			NotWant: []string{"javascript", "width"},
+		},
+	}
+
+	for _, test := range tests {
+		view, err := ExtractReaderView([]byte(test.HTML), "",
+			"https://example.com/posts/1")
+		if err != nil {
+			t.Errorf("%s: ExtractReaderView() = error %s", test.Name, err)
+			continue
+		}
+		if view.Title != test.Title {
+			t.Errorf("%s: title = %q, wanted %q", test.Name, view.Title, test.Title)
+		}
+		for _, want := range test.Want {
+			if !strings.Contains(string(view.Content), want) {
+				t.Errorf("%s: content = %s, wanted it to contain %s", test.Name,
+					view.Content, want)
+			}
+		}
+		for _, notWant := range test.NotWant {
+			if strings.Contains(string(view.Content), notWant) {
+				t.Errorf("%s: content = %s, wanted it not to contain %s", test.Name,
+					view.Content, notWant)
+			}
+		}
+	}
+
+	if _, err := ExtractReaderView([]byte(`<html></html>`), "",
+		"https://example.com/"); err == nil {
+		t.Errorf("ExtractReaderView() of an empty page succeeded, wanted an error")
+	}
+}
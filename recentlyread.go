@@ -0,0 +1,81 @@
+package gorse
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// ReadItem is an item a user read and when they did.
+type ReadItem struct {
+	UserItem
+
+	// ReadTime is when the user marked it read.
+	ReadTime time.Time
+}
+
+// RecentlyRead retrieves the items the user most recently marked read,
+// newest first, using the state history. It leaves out those they've since
+// set to another state. limit is the most to retrieve.
+//
+// This lets users find items they marked read by mistake.
+func RecentlyRead(ctx context.Context, db Querier, userID,
+	limit int) ([]ReadItem, error) {
+	query := `
+SELECT
+ri.id,
+ri.title,
+ri.description,
+ri.link,
+ri.publication_date,
+ri.guid,
+ri.rss_feed_id,
+rf.name,
+COALESCE(ris.note, ''),
+risn.create_time
+FROM rss_item_state_history risn
+JOIN rss_item_state ris ON ris.item_id = risn.item_id AND
+  ris.user_id = risn.user_id AND ris.state = 'read'
+JOIN rss_item ri ON ri.id = risn.item_id
+JOIN rss_feed rf ON rf.id = ri.rss_feed_id AND rf.deleted = false
+WHERE risn.user_id = $1 AND risn.new_state = 'read' AND
+  NOT EXISTS (
+    SELECT 1 FROM rss_item_state_history later
+    WHERE later.user_id = risn.user_id AND later.item_id = risn.item_id AND
+      later.id > risn.id)
+ORDER BY risn.create_time DESC, risn.id DESC
+LIMIT $2
+`
+
+	rows, err := db.QueryContext(ctx, query, userID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("unable to query recently read items: %s", err)
+	}
+
+	var items []ReadItem
+	for rows.Next() {
+		item := ReadItem{UserItem: UserItem{ReadState: Read}}
+		if err := rows.Scan(
+			&item.ID,
+			&item.Title,
+			&item.Description,
+			&item.Link,
+			&item.PublicationDate,
+			&item.GUID,
+			&item.RSSFeedID,
+			&item.FeedName,
+			&item.Note,
+			&item.ReadTime,
+		); err != nil {
+			_ = rows.Close()
+			return nil, fmt.Errorf("failed to scan row: %s", err)
+		}
+		items = append(items, item)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failure fetching rows: %s", err)
+	}
+
+	return items, nil
+}
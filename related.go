@@ -0,0 +1,110 @@
+package gorse
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"unicode"
+)
+
+// Items about the same story across feeds tend to share words in their titles
+// and in the slugs of their links. We find items related to one by searching
+// for items with any of those words, best matches first.
+//
+// We don't keep items' categories, so we can't compare those.
+
+// maxRelatedWords is the most words we search for. Long titles otherwise make
+// for slow searches that match everything.
+const maxRelatedWords = 12
+
+// relatedStopWords are words too common to say anything about what an item is
+// about. Postgres drops these itself but SQLite doesn't.
+var relatedStopWords = map[string]bool{
+	"about": true, "after": true, "all": true, "also": true, "and": true,
+	"are": true, "article": true, "articles": true, "been": true,
+	"before": true, "blog": true, "but": true, "can": true, "com": true,
+	"could": true, "did": true, "does": true, "for": true, "from": true,
+	"had": true, "has": true, "have": true, "her": true, "his": true,
+	"how": true, "htm": true, "html": true, "index": true, "into": true,
+	"its": true, "more": true, "new": true, "news": true, "not": true,
+	"now": true, "off": true, "one": true, "our": true, "out": true,
+	"over": true, "php": true, "post": true, "posts": true, "says": true,
+	"she": true, "that": true, "the": true, "their": true, "them": true,
+	"then": true, "there": true, "these": true, "they": true, "this": true,
+	"was": true, "were": true, "what": true, "when": true, "where": true,
+	"which": true, "who": true, "why": true, "will": true, "with": true,
+	"would": true, "www": true, "you": true, "your": true,
+}
+
+// RelatedItems retrieves items from feeds the user subscribes to that share
+// words with the item's title or link, read or not, best matches first. limit
+// is the most to retrieve. The item itself is not one of them.
+func RelatedItems(ctx context.Context, db Querier, dbType string,
+	item UserItem, userID, limit int) ([]UserItem, error) {
+	words := relatedWords(item.Title, item.Link)
+	if len(words) == 0 {
+		return nil, nil
+	}
+
+	// One more in case the item is one of them.
+	items, err := SearchItems(ctx, db, dbType, ItemFilter{
+		UserID:     userID,
+		Subscribed: true,
+		SearchAny:  words,
+		Limit:      limit + 1,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var related []UserItem
+	for _, i := range items {
+		if i.ID != item.ID && len(related) < limit {
+			related = append(related, i)
+		}
+	}
+
+	return related, nil
+}
+
+// relatedWords picks the words to search for from a title and link. Words from
+// the title come first. From the link we take only its path. We leave out
+// short words, numbers, and stop words.
+func relatedWords(title, link string) []string {
+	text := title
+	if u, err := url.Parse(link); err == nil {
+		text += " " + u.Path
+	}
+
+	seen := map[string]bool{}
+	var words []string
+	for _, word := range strings.FieldsFunc(strings.ToLower(text),
+		func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) },
+	) {
+		if len([]rune(word)) < 3 || relatedStopWords[word] || seen[word] ||
+			strings.IndexFunc(word, unicode.IsLetter) == -1 {
+			continue
+		}
+		seen[word] = true
+		words = append(words, word)
+		if len(words) == maxRelatedWords {
+			break
+		}
+	}
+
+	return words
+}
+
+// isSearchWord checks the word has only letters and digits. These have no
+// special meaning in full-text queries.
+func isSearchWord(word string) bool {
+	if word == "" {
+		return false
+	}
+	for _, r := range word {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,37 @@
+package gorse
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRelatedWords(t *testing.T) {
+	tests := []struct {
+		title string
+		link  string
+		words []string
+	}{
+		{
+			"The storm hits the coast",
+			"https://news.example.com/2020/03/storm-coast-cleanup.html?id=7",
+			[]string{"storm", "hits", "coast", "cleanup"},
+		},
+		{"C'est l'été à Montréal", "", []string{"est", "été", "montréal"}},
+		{"", "not a url\x7f", nil},
+		{
+			"one two three four five six seven eight nine ten eleven twelve " +
+				"thirteen",
+			"",
+			[]string{"two", "three", "four", "five", "six", "seven", "eight",
+				"nine", "ten", "eleven", "twelve", "thirteen"},
+		},
+	}
+
+	for _, test := range tests {
+		got := relatedWords(test.title, test.link)
+		if !reflect.DeepEqual(got, test.words) {
+			t.Errorf("relatedWords(%q, %q) = %q, wanted %q", test.title,
+				test.link, got, test.words)
+		}
+	}
+}
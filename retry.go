@@ -0,0 +1,99 @@
+package gorse
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// RetryPolicy says how to retry database operations that fail for transient
+// reasons, such as the connection dropping or the database choosing our
+// transaction to abort in a deadlock.
+type RetryPolicy struct {
+	// Attempts is how many times to try. 1 or less means to not retry.
+	Attempts int
+
+	// Backoff is how long to wait before trying again the first time. It
+	// doubles each time after that.
+	Backoff time.Duration
+}
+
+// DefaultRetryPolicy rides out a momentary problem with the database without
+// holding things up for long.
+var DefaultRetryPolicy = RetryPolicy{
+	Attempts: 3,
+	Backoff:  100 * time.Millisecond,
+}
+
+// run runs the function, running it again while it fails and retryable says
+// the error is worth retrying, up to the policy's attempts.
+func (p RetryPolicy) run(ctx context.Context, fn func() error,
+	retryable func(error) bool) error {
+	backoff := p.Backoff
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= p.Attempts || !retryable(err) {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// transientError decides whether the error is one where trying again may
+// work and the statement had no effect, so running it again can't repeat
+// it.
+//
+// For Postgres these are the driver finding the connection bad before it sent
+// the statement, errors the server gives for connection problems, including
+// it shutting down, and transactions aborted due to serialization failures or
+// deadlocks.
+//
+// SQLite waits for locks itself (see its DSN), so nothing is transient there.
+func transientError(err error) bool {
+	if errors.Is(err, driver.ErrBadConn) {
+		return true
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		switch pqErr.Code.Class() {
+		case "08": // connection_exception
+			return true
+		}
+		switch pqErr.Code {
+		case "40001", // serialization_failure
+			"40P01", // deadlock_detected
+			"57P01", // admin_shutdown
+			"57P03": // cannot_connect_now
+			return true
+		}
+	}
+
+	return false
+}
+
+// connectionLost decides whether the error is the connection failing while we
+// used it. Trying again may work, but the statement may have taken effect
+// before the connection went. Only statements that change nothing are safe to
+// run again, along with whole transactions, which the database rolls back.
+func connectionLost(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// readOnly decides whether the query only reads, making it safe to run again.
+func readOnly(query string) bool {
+	return strings.HasPrefix(strings.ToUpper(strings.TrimSpace(query)),
+		"SELECT")
+}
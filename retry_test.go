@@ -0,0 +1,157 @@
+package gorse
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+)
+
+func TestTransientError(t *testing.T) {
+	tests := []struct {
+		Err  error
+		Want bool
+	}{
+		{&pq.Error{Code: "08006"}, true},
+		{&pq.Error{Code: "40001"}, true},
+		{&pq.Error{Code: "40P01"}, true},
+		{&pq.Error{Code: "57P01"}, true},
+		{&pq.Error{Code: "23505"}, false},
+		{driver.ErrBadConn, true},
+		{&net.OpError{Op: "read", Err: errors.New("reset")}, false},
+		{errors.New("failed"), false},
+	}
+
+	for _, test := range tests {
+		if got := transientError(test.Err); got != test.Want {
+			t.Errorf("transientError(%v) = %t, wanted %t", test.Err, got,
+				test.Want)
+		}
+	}
+}
+
+func TestRetryPolicyRun(t *testing.T) {
+	policy := RetryPolicy{Attempts: 3, Backoff: time.Millisecond}
+	transient := &pq.Error{Code: "40001"}
+
+	tests := []struct {
+		Name      string
+		Errs      []error
+		WantCalls int
+		WantErr   bool
+	}{
+		{"success", []error{nil}, 1, false},
+		{"retried", []error{transient, nil}, 2, false},
+		{"gives up", []error{transient, transient, transient}, 3, true},
+		{"not transient", []error{errors.New("failed"), nil}, 1, true},
+	}
+
+	for _, test := range tests {
+		calls := 0
+		err := policy.run(context.Background(), func() error {
+			calls++
+			return test.Errs[calls-1]
+		}, transientError)
+		if calls != test.WantCalls {
+			t.Errorf("%s: %d calls, wanted %d", test.Name, calls, test.WantCalls)
+		}
+		if (err != nil) != test.WantErr {
+			t.Errorf("%s: run() = %v, wanted error: %t", test.Name, err,
+				test.WantErr)
+		}
+	}
+}
+
+func TestSQLStoreRetries(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("unable to open mock db: %s", err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	store := NewSQLStore(db, Postgres)
+	store.SetRetryPolicy(RetryPolicy{Attempts: 2, Backoff: time.Millisecond})
+
+	// Queries outside of transactions are retried on their own.
+	prepared := mock.ExpectPrepare(
+		`SELECT id FROM rss_item WHERE rss_feed_id = \$1 AND link = \$2`)
+	prepared.ExpectQuery().WithArgs(1, "a").
+		WillReturnError(&pq.Error{Code: "08006"})
+	prepared.ExpectQuery().WithArgs(1, "a").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(2))
+
+	exists, err := store.ItemExistsByLink(ctx, 1, "a")
+	if err != nil || !exists {
+		t.Errorf("ItemExistsByLink() = %t, %v, wanted true", exists, err)
+	}
+
+	// Losing the connection, we retry queries that only read.
+	lost := &net.OpError{Op: "read", Err: errors.New("connection reset")}
+	prepared = mock.ExpectPrepare(
+		`SELECT id FROM rss_item WHERE rss_feed_id = \$1 AND guid = \$2`)
+	prepared.ExpectQuery().WithArgs(1, "b").WillReturnError(lost)
+	prepared.ExpectQuery().WithArgs(1, "b").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(3))
+
+	exists, err = store.ItemExistsByGUID(ctx, 1, "b")
+	if err != nil || !exists {
+		t.Errorf("ItemExistsByGUID() = %t, %v, wanted true", exists, err)
+	}
+
+	// But not others. They may have taken effect before the connection went.
+	mock.ExpectPrepare(`UPDATE rss_feed SET last_payload`).ExpectExec().
+		WillReturnError(lost)
+
+	// Trying again would fail differently, as the mock doesn't expect it.
+	err = store.SetFeedPayload(ctx, 1, []byte("x"))
+	if err == nil || !strings.Contains(err.Error(), "connection reset") {
+		t.Errorf("SetFeedPayload() = %v, wanted the connection reset", err)
+	}
+
+	// Transactions are retried as a whole.
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE rss_feed`).
+		WillReturnError(&pq.Error{Code: "40P01"})
+	mock.ExpectRollback()
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE rss_feed`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	calls := 0
+	if err := store.inTx(ctx, func(tx *SQLStore) error {
+		calls++
+		_, err := tx.db.uncached().ExecContext(ctx,
+			`UPDATE rss_feed SET active = false`)
+		return err
+	}); err != nil {
+		t.Errorf("inTx() = error %s", err)
+	}
+	if calls != 2 {
+		t.Errorf("inTx() ran the function %d times, wanted 2", calls)
+	}
+
+	// Except those run with InTx.
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE rss_feed`).
+		WillReturnError(&pq.Error{Code: "40P01"})
+	mock.ExpectRollback()
+
+	if err := store.InTx(ctx, func(tx Store) error {
+		_, err := tx.(*SQLStore).db.uncached().ExecContext(ctx,
+			`UPDATE rss_feed SET active = false`)
+		return err
+	}); err == nil {
+		t.Errorf("InTx() = success, wanted error")
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,407 @@
+package gorse
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Users may have us act on new items when they arrive by giving rules. Each
+// rule matches items by a pattern in one of their fields, optionally only in
+// one feed, and says what to do with them, such as marking them read or
+// tagging them. This is like muting a phrase and asking us to mark items
+// containing it read, but more general.
+
+// MaxRulePatternLength is the most characters a rule's pattern may have.
+const MaxRulePatternLength = 200
+
+// RuleField is which of an item's fields a rule looks at.
+type RuleField int
+
+const (
+	// AnyField matches if any of the title, link, or description matches.
+	AnyField RuleField = iota
+
+	// TitleField is the item's title.
+	TitleField
+
+	// LinkField is the item's link.
+	LinkField
+
+	// DescriptionField is the item's description.
+	DescriptionField
+)
+
+// String gives the name ParseRuleField takes.
+func (f RuleField) String() string {
+	switch f {
+	case AnyField:
+		return "any"
+	case TitleField:
+		return "title"
+	case LinkField:
+		return "link"
+	case DescriptionField:
+		return "description"
+	default:
+		return "unknown"
+	}
+}
+
+// ParseRuleField turns any, title, link, or description into a RuleField.
+func ParseRuleField(s string) (RuleField, error) {
+	switch s {
+	case "any":
+		return AnyField, nil
+	case "title":
+		return TitleField, nil
+	case "link":
+		return LinkField, nil
+	case "description":
+		return DescriptionField, nil
+	default:
+		return -1, fmt.Errorf("unknown rule field: %s", s)
+	}
+}
+
+// RuleMatch is how a rule's pattern matches a field.
+type RuleMatch int
+
+const (
+	// ContainsMatch matches if the field contains the pattern, ignoring case.
+	ContainsMatch RuleMatch = iota
+
+	// RegexpMatch matches if the pattern, a regular expression, matches the
+	// field, ignoring case.
+	RegexpMatch
+)
+
+// String gives the name ParseRuleMatch takes.
+func (m RuleMatch) String() string {
+	switch m {
+	case ContainsMatch:
+		return "contains"
+	case RegexpMatch:
+		return "regex"
+	default:
+		return "unknown"
+	}
+}
+
+// ParseRuleMatch turns contains or regex into a RuleMatch.
+func ParseRuleMatch(s string) (RuleMatch, error) {
+	switch s {
+	case "contains":
+		return ContainsMatch, nil
+	case "regex":
+		return RegexpMatch, nil
+	default:
+		return -1, fmt.Errorf("unknown rule match: %s", s)
+	}
+}
+
+// RuleAction is what a rule does to the items it matches.
+type RuleAction int
+
+const (
+	// MarkReadAction marks the item read.
+	MarkReadAction RuleAction = iota
+
+	// ReadLaterAction saves the item to read later.
+	ReadLaterAction
+
+	// StarAction stars the item.
+	StarAction
+
+	// TagAction gives the item the rule's tag.
+	TagAction
+)
+
+// String gives the name ParseRuleAction takes.
+func (a RuleAction) String() string {
+	switch a {
+	case MarkReadAction:
+		return "read"
+	case ReadLaterAction:
+		return "read-later"
+	case StarAction:
+		return "star"
+	case TagAction:
+		return "tag"
+	default:
+		return "unknown"
+	}
+}
+
+// ParseRuleAction turns read, read-later, star, or tag into a RuleAction.
+func ParseRuleAction(s string) (RuleAction, error) {
+	switch s {
+	case "read":
+		return MarkReadAction, nil
+	case "read-later":
+		return ReadLaterAction, nil
+	case "star":
+		return StarAction, nil
+	case "tag":
+		return TagAction, nil
+	default:
+		return -1, fmt.Errorf("unknown rule action: %s", s)
+	}
+}
+
+// Rule says what to do with a user's new items that match a pattern.
+type Rule struct {
+	ID     int64
+	UserID int
+
+	// FeedID is the feed whose items the rule matches. 0 means the items of
+	// any feed the user subscribes to.
+	FeedID int64
+
+	Field   RuleField
+	Match   RuleMatch
+	Pattern string
+	Action  RuleAction
+
+	// Tag is the tag TagAction gives items. It is blank for other actions.
+	Tag string
+
+	CreateTime time.Time
+}
+
+// Validate checks the rule makes sense, and puts its pattern and tag in the
+// form we store them in.
+func (r *Rule) Validate() error {
+	r.Pattern = strings.TrimSpace(r.Pattern)
+	if r.Pattern == "" {
+		return fmt.Errorf("pattern is blank")
+	}
+	if len([]rune(r.Pattern)) > MaxRulePatternLength {
+		return fmt.Errorf("pattern is longer than %d characters",
+			MaxRulePatternLength)
+	}
+
+	if r.Field.String() == "unknown" {
+		return fmt.Errorf("unknown rule field: %d", r.Field)
+	}
+
+	switch r.Match {
+	case ContainsMatch:
+	case RegexpMatch:
+		if _, err := regexpIgnoringCase(r.Pattern); err != nil {
+			return fmt.Errorf("pattern is not a valid regular expression: %s", err)
+		}
+	default:
+		return fmt.Errorf("unknown rule match: %d", r.Match)
+	}
+
+	switch r.Action {
+	case MarkReadAction, ReadLaterAction, StarAction:
+		r.Tag = ""
+	case TagAction:
+		tag, err := NormalizeTag(r.Tag)
+		if err != nil {
+			return err
+		}
+		r.Tag = tag
+	default:
+		return fmt.Errorf("unknown rule action: %d", r.Action)
+	}
+
+	return nil
+}
+
+// Matches decides whether the rule matches the item from the feed.
+//
+// A regular expression that doesn't compile matches nothing. Validate keeps
+// us from storing one.
+func (r Rule) Matches(feedID int64, item *Item) bool {
+	if r.FeedID != 0 && r.FeedID != feedID {
+		return false
+	}
+
+	var fields []string
+	switch r.Field {
+	case AnyField:
+		fields = []string{item.Title, item.Link, item.Description}
+	case TitleField:
+		fields = []string{item.Title}
+	case LinkField:
+		fields = []string{item.Link}
+	case DescriptionField:
+		fields = []string{item.Description}
+	}
+
+	var re *regexp.Regexp
+	if r.Match == RegexpMatch {
+		var err error
+		if re, err = regexpIgnoringCase(r.Pattern); err != nil {
+			return false
+		}
+	}
+
+	pattern := strings.ToLower(r.Pattern)
+	for _, field := range fields {
+		if re != nil {
+			if re.MatchString(field) {
+				return true
+			}
+			continue
+		}
+		if strings.Contains(strings.ToLower(field), pattern) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// AddRule validates the rule and records it. It returns the rule's ID.
+func AddRule(ctx context.Context, db Querier, rule Rule) (int64, error) {
+	if err := rule.Validate(); err != nil {
+		return -1, err
+	}
+
+	var feedID *int64
+	if rule.FeedID != 0 {
+		feedID = &rule.FeedID
+	}
+
+	query := `
+INSERT INTO rss_item_rule
+(user_id, feed_id, field, match_type, pattern, action, tag)
+VALUES ($1, $2, $3, $4, $5, $6, $7)
+RETURNING id
+`
+
+	var id int64
+	if err := db.QueryRowContext(ctx, query, rule.UserID, feedID,
+		rule.Field.String(), rule.Match.String(), rule.Pattern,
+		rule.Action.String(), rule.Tag).Scan(&id); err != nil {
+		return -1, fmt.Errorf("unable to add rule for user %d: %s", rule.UserID,
+			err)
+	}
+
+	return id, nil
+}
+
+// DeleteRule removes the user's rule. It returns ErrNotFound if they don't
+// have it.
+func DeleteRule(ctx context.Context, db Querier, userID int, id int64) error {
+	query := `DELETE FROM rss_item_rule WHERE user_id = $1 AND id = $2`
+
+	result, err := db.ExecContext(ctx, query, userID, id)
+	if err != nil {
+		return fmt.Errorf("unable to delete rule %d: %s", id, err)
+	}
+
+	return requireOneRow(result)
+}
+
+// ListRules retrieves the user's rules in the order they added them.
+func ListRules(ctx context.Context, db Querier, userID int) ([]Rule, error) {
+	query := `
+SELECT id, user_id, feed_id, field, match_type, pattern, action, tag,
+create_time
+FROM rss_item_rule
+WHERE user_id = $1
+ORDER BY id
+`
+
+	return queryRules(ctx, db, query, userID)
+}
+
+// applyItemRules acts on the new item from the feed for each rule that
+// matches it. We apply the rules of users who subscribe to the feed, in the
+// order they added them, so if several set the read state the last wins.
+func applyItemRules(ctx context.Context, db Querier, feedID, itemID int64,
+	item *Item) error {
+	query := `
+SELECT r.id, r.user_id, r.feed_id, r.field, r.match_type, r.pattern,
+r.action, r.tag, r.create_time
+FROM rss_item_rule r
+JOIN rss_feed_subscription s ON s.user_id = r.user_id AND s.feed_id = $1
+WHERE r.feed_id IS NULL OR r.feed_id = $1
+ORDER BY r.user_id, r.id
+`
+
+	rules, err := queryRules(ctx, db, query, feedID)
+	if err != nil {
+		return err
+	}
+
+	for _, rule := range rules {
+		if !rule.Matches(feedID, item) {
+			continue
+		}
+		if err := applyItemRule(ctx, db, rule, itemID); err != nil {
+			return fmt.Errorf("unable to apply rule %d to item %d: %s", rule.ID,
+				itemID, err)
+		}
+	}
+
+	return nil
+}
+
+// applyItemRule does the rule's action to the item.
+func applyItemRule(ctx context.Context, db Querier, rule Rule,
+	itemID int64) error {
+	switch rule.Action {
+	case MarkReadAction:
+		return DBSetItemReadState(ctx, db, itemID, rule.UserID, Read)
+	case ReadLaterAction:
+		return DBSetItemReadState(ctx, db, itemID, rule.UserID, ReadLater)
+	case StarAction:
+		return SetItemStarred(ctx, db, itemID, rule.UserID, true)
+	case TagAction:
+		return AddItemTag(ctx, db, itemID, rule.UserID, rule.Tag)
+	default:
+		return fmt.Errorf("unknown rule action: %d", rule.Action)
+	}
+}
+
+// queryRules runs the query for rules and scans them.
+func queryRules(ctx context.Context, db Querier, query string,
+	params ...interface{}) ([]Rule, error) {
+	rows, err := db.QueryContext(ctx, query, params...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to query rules: %s", err)
+	}
+
+	var rules []Rule
+	for rows.Next() {
+		var r Rule
+		var feedID sql.NullInt64
+		var field, match, action string
+		if err := rows.Scan(&r.ID, &r.UserID, &feedID, &field, &match,
+			&r.Pattern, &action, &r.Tag, &r.CreateTime); err != nil {
+			_ = rows.Close()
+			return nil, fmt.Errorf("failed to scan row: %s", err)
+		}
+		r.FeedID = feedID.Int64
+
+		if r.Field, err = ParseRuleField(field); err != nil {
+			_ = rows.Close()
+			return nil, err
+		}
+		if r.Match, err = ParseRuleMatch(match); err != nil {
+			_ = rows.Close()
+			return nil, err
+		}
+		if r.Action, err = ParseRuleAction(action); err != nil {
+			_ = rows.Close()
+			return nil, err
+		}
+
+		rules = append(rules, r)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failure fetching rows: %s", err)
+	}
+
+	return rules, nil
+}
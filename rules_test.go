@@ -0,0 +1,171 @@
+package gorse
+
+import (
+	"testing"
+
+	"github.com/horgh/rss"
+)
+
+func TestRuleMatches(t *testing.T) {
+	item := &Item{Item: rss.Item{
+		Title:       "Sponsored: The Best Laptops",
+		Link:        "https://www.youtube.com/watch?v=1",
+		Description: "<p>Our picks</p>",
+	}}
+
+	tests := []struct {
+		Name   string
+		Rule   Rule
+		FeedID int64
+		Want   bool
+	}{
+		{
+			Name: "title contains, ignoring case",
+			Rule: Rule{Field: TitleField, Match: ContainsMatch,
+				Pattern: "SPONSORED"},
+			Want: true,
+		},
+		{
+			Name: "title doesn't contain",
+			Rule: Rule{Field: TitleField, Match: ContainsMatch, Pattern: "phones"},
+		},
+		{
+			Name: "link contains",
+			Rule: Rule{Field: LinkField, Match: ContainsMatch,
+				Pattern: "youtube.com"},
+			Want: true,
+		},
+		{
+			Name: "only the field we look at",
+			Rule: Rule{Field: DescriptionField, Match: ContainsMatch,
+				Pattern: "youtube.com"},
+		},
+		{
+			Name: "any field",
+			Rule: Rule{Field: AnyField, Match: ContainsMatch, Pattern: "our picks"},
+			Want: true,
+		},
+		{
+			Name: "regular expression, ignoring case",
+			Rule: Rule{Field: TitleField, Match: RegexpMatch,
+				Pattern: `^sponsored\b`},
+			Want: true,
+		},
+		{
+			Name: "regular expression doesn't match",
+			Rule: Rule{Field: TitleField, Match: RegexpMatch, Pattern: `laptops$x`},
+		},
+		{
+			Name: "invalid regular expression",
+			Rule: Rule{Field: TitleField, Match: RegexpMatch, Pattern: `(`},
+		},
+		{
+			Name: "the feed",
+			Rule: Rule{FeedID: 2, Field: TitleField, Match: ContainsMatch,
+				Pattern: "laptops"},
+			FeedID: 2,
+			Want:   true,
+		},
+		{
+			Name: "another feed",
+			Rule: Rule{FeedID: 2, Field: TitleField, Match: ContainsMatch,
+				Pattern: "laptops"},
+			FeedID: 3,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			got := test.Rule.Matches(test.FeedID, item)
+			if got != test.Want {
+				t.Errorf("%+v.Matches() = %t, wanted %t", test.Rule, got, test.Want)
+			}
+		})
+	}
+}
+
+func TestRuleValidate(t *testing.T) {
+	tests := []struct {
+		Name  string
+		Rule  Rule
+		Want  Rule
+		Error bool
+	}{
+		{
+			Name: "trims pattern and drops tag",
+			Rule: Rule{Match: ContainsMatch, Pattern: " ads ", Action: StarAction,
+				Tag: "x"},
+			Want: Rule{Match: ContainsMatch, Pattern: "ads", Action: StarAction},
+		},
+		{
+			Name: "normalizes tag",
+			Rule: Rule{Match: ContainsMatch, Pattern: "ads", Action: TagAction,
+				Tag: " Video  Clips "},
+			Want: Rule{Match: ContainsMatch, Pattern: "ads", Action: TagAction,
+				Tag: "video clips"},
+		},
+		{
+			Name:  "blank pattern",
+			Rule:  Rule{Match: ContainsMatch, Pattern: " "},
+			Error: true,
+		},
+		{
+			Name:  "invalid regular expression",
+			Rule:  Rule{Match: RegexpMatch, Pattern: "("},
+			Error: true,
+		},
+		{
+			Name:  "tag without a tag",
+			Rule:  Rule{Match: ContainsMatch, Pattern: "ads", Action: TagAction},
+			Error: true,
+		},
+		{
+			Name:  "unknown action",
+			Rule:  Rule{Match: ContainsMatch, Pattern: "ads", Action: 99},
+			Error: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			rule := test.Rule
+			err := rule.Validate()
+			if test.Error {
+				if err == nil {
+					t.Errorf("%+v.Validate() succeeded, wanted error", test.Rule)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("%+v.Validate() = error %s", test.Rule, err)
+			}
+			if rule != test.Want {
+				t.Errorf("%+v.Validate() gave %+v, wanted %+v", test.Rule, rule,
+					test.Want)
+			}
+		})
+	}
+}
+
+func TestParseRuleNames(t *testing.T) {
+	for _, f := range []RuleField{AnyField, TitleField, LinkField,
+		DescriptionField} {
+		if got, err := ParseRuleField(f.String()); err != nil || got != f {
+			t.Errorf("ParseRuleField(%s) = %d, %v", f, got, err)
+		}
+	}
+	for _, m := range []RuleMatch{ContainsMatch, RegexpMatch} {
+		if got, err := ParseRuleMatch(m.String()); err != nil || got != m {
+			t.Errorf("ParseRuleMatch(%s) = %d, %v", m, got, err)
+		}
+	}
+	for _, a := range []RuleAction{MarkReadAction, ReadLaterAction, StarAction,
+		TagAction} {
+		if got, err := ParseRuleAction(a.String()); err != nil || got != a {
+			t.Errorf("ParseRuleAction(%s) = %d, %v", a, got, err)
+		}
+	}
+	if _, err := ParseRuleAction("delete"); err == nil {
+		t.Errorf("ParseRuleAction(delete) succeeded")
+	}
+}
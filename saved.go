@@ -0,0 +1,176 @@
+package gorse
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/horgh/rss"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+	"golang.org/x/net/html/charset"
+)
+
+// SavedLink is a page a user saved to read later, such as with a bookmarklet,
+// rather than an item from a feed.
+type SavedLink struct {
+	URL         string
+	Title       string
+	Description string
+}
+
+// savedFeedURI identifies the user's Saved feed. It's not a URL we poll.
+func savedFeedURI(userID int) string {
+	return fmt.Sprintf("gorse:saved:%d", userID)
+}
+
+// SavedFeed retrieves the ID of the feed holding the links the user saved,
+// creating it if they don't have one. It belongs to the user so only they see
+// its items. We don't poll it.
+func SavedFeed(ctx context.Context, db Querier, userID int) (int64, error) {
+	var id int64
+	err := db.QueryRowContext(ctx, `SELECT id FROM rss_feed WHERE user_id = $1`,
+		userID).Scan(&id)
+	if err == nil {
+		return id, nil
+	}
+	if err != sql.ErrNoRows {
+		return -1, fmt.Errorf("unable to look up saved feed for user %d: %s",
+			userID, err)
+	}
+
+	user, err := GetUser(ctx, db, userID)
+	if err != nil {
+		return -1, err
+	}
+
+	// Feed names are unique.
+	query := `
+INSERT INTO rss_feed
+(name, uri, update_frequency_seconds, archive, active, user_id)
+VALUES ($1, $2, $3, false, false, $4)
+RETURNING id
+`
+	if err := db.QueryRowContext(ctx, query, "Saved by "+user.Email,
+		savedFeedURI(userID), MinUpdateFrequencySeconds, userID).Scan(
+		&id); err != nil {
+		return -1, fmt.Errorf("unable to add saved feed for user %d: %s", userID,
+			err)
+	}
+
+	if err := Subscribe(ctx, db, userID, id); err != nil {
+		return -1, err
+	}
+
+	return id, nil
+}
+
+// SaveLink adds the link to the user's Saved feed and sets it to read later.
+// If they saved it before, we set it to read later again. It returns the
+// item's ID.
+//
+// Run this in a transaction.
+func SaveLink(ctx context.Context, store Store, userID int,
+	link SavedLink) (int64, error) {
+	u, err := url.Parse(link.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") ||
+		u.Host == "" {
+		return -1, fmt.Errorf("link must be an http or https URL: %s", link.URL)
+	}
+
+	feedID, err := store.SavedFeed(ctx, userID)
+	if err != nil {
+		return -1, err
+	}
+
+	exists, err := store.ItemExistsByLink(ctx, feedID, link.URL)
+	if err != nil {
+		return -1, err
+	}
+
+	var id int64
+	if exists {
+		item, err := store.FindItemByLink(ctx, feedID, link.URL)
+		if err != nil {
+			return -1, err
+		}
+		id = item.ID
+	} else {
+		title := link.Title
+		if strings.TrimSpace(title) == "" {
+			title = link.URL
+		}
+		if id, err = store.AddItem(ctx, feedID, &Item{Item: rss.Item{
+			Title:       title,
+			Link:        link.URL,
+			Description: link.Description,
+			PubDate:     time.Now(),
+			GUID:        link.URL,
+		}}); err != nil {
+			return -1, err
+		}
+	}
+
+	if err := store.SetItemReadState(ctx, id, userID, ReadLater); err != nil {
+		return -1, err
+	}
+
+	return id, nil
+}
+
+// ParseSavedLink finds the title and description of the HTML page at the URL.
+// contentType is the Content-Type the page was served with, if any. We prefer
+// Open Graph metadata as sites write it to describe the page when shared.
+func ParseSavedLink(data []byte, contentType, pageURL string) (SavedLink,
+	error) {
+	link := SavedLink{URL: pageURL}
+
+	reader, err := charset.NewReader(bytes.NewReader(data), contentType)
+	if err != nil {
+		return link, fmt.Errorf("unable to decode HTML: %s", err)
+	}
+
+	doc, err := html.Parse(reader)
+	if err != nil {
+		return link, fmt.Errorf("unable to parse HTML: %s", err)
+	}
+
+	var ogTitle, metaDescription, ogDescription string
+	var visit func(*html.Node)
+	visit = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.DataAtom == atom.Meta {
+			content := strings.Join(strings.Fields(attr(n, "content")), " ")
+			switch {
+			case attr(n, "property") == "og:title" && ogTitle == "":
+				ogTitle = content
+			case attr(n, "property") == "og:description" && ogDescription == "":
+				ogDescription = content
+			case strings.EqualFold(attr(n, "name"), "description") &&
+				metaDescription == "":
+				metaDescription = content
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			visit(c)
+		}
+	}
+	visit(doc)
+
+	link.Title = ogTitle
+	if link.Title == "" {
+		if title := findElement(doc, atom.Title); title != nil {
+			link.Title = textContent(title)
+		}
+	}
+
+	link.Description = ogDescription
+	if link.Description == "" {
+		link.Description = metaDescription
+	}
+
+	return link, nil
+}
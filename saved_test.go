@@ -0,0 +1,52 @@
+package gorse
+
+import "testing"
+
+func TestParseSavedLink(t *testing.T) {
+	tests := []struct {
+		Name        string
+		HTML        string
+		ContentType string
+		Want        SavedLink
+	}{
+		{
+			Name: "title",
+			HTML: `<html><head><title>
+  A   page </title>
+<meta name="Description" content="About it"></head></html>`,
+			Want: SavedLink{Title: "A page", Description: "About it"},
+		},
+		{
+			Name: "open graph",
+			HTML: `<title>Site | A page</title>
+<meta name="description" content="Generic">
+<meta property="og:title" content="A page">
+<meta property="og:description" content="What it says">`,
+			Want: SavedLink{Title: "A page", Description: "What it says"},
+		},
+		{
+			Name:        "encoding",
+			HTML:        "<title>Caf\xe9</title>",
+			ContentType: "text/html; charset=iso-8859-1",
+			Want:        SavedLink{Title: "Café"},
+		},
+		{
+			Name: "nothing",
+			HTML: `<p>Hi</p>`,
+		},
+	}
+
+	for _, test := range tests {
+		link, err := ParseSavedLink([]byte(test.HTML), test.ContentType,
+			"https://example.com/")
+		if err != nil {
+			t.Errorf("%s: ParseSavedLink() = error %s", test.Name, err)
+			continue
+		}
+		test.Want.URL = "https://example.com/"
+		if link != test.Want {
+			t.Errorf("%s: ParseSavedLink() = %+v, wanted %+v", test.Name, link,
+				test.Want)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package gorse
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ReadSecret returns a secret such as a password. It's either the value given
+// directly in a config file, or if path is set, the contents of that file.
+// This lets secrets come from files such as systemd credentials or Kubernetes
+// secrets rather than sitting in the config file.
+//
+// We expand environment variables in the path, such as
+// $CREDENTIALS_DIRECTORY, and remove any trailing newline from the file.
+func ReadSecret(value, path string) (string, error) {
+	if path == "" {
+		return value, nil
+	}
+	if value != "" {
+		return "", fmt.Errorf(
+			"the secret is set both directly and as the file %s. Set only one",
+			path)
+	}
+
+	path = os.ExpandEnv(path)
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("unable to read secret: %s", err)
+	}
+
+	secret := strings.TrimRight(string(buf), "\r\n")
+	if secret == "" {
+		return "", fmt.Errorf("secret file %s is empty", path)
+	}
+	return secret, nil
+}
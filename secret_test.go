@@ -0,0 +1,51 @@
+package gorse
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadSecret(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, contents string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(contents), 0600); err != nil {
+			t.Fatalf("unable to write %s: %s", path, err)
+		}
+		return path
+	}
+
+	secretPath := write("secret", "hunter2\n")
+	write("empty", "\n")
+
+	if err := os.Setenv("GORSE_TEST_SECRETS", dir); err != nil {
+		t.Fatalf("unable to set environment: %s", err)
+	}
+	defer func() {
+		_ = os.Unsetenv("GORSE_TEST_SECRETS")
+	}()
+
+	tests := []struct {
+		Value   string
+		Path    string
+		Want    string
+		WantErr bool
+	}{
+		{Value: "direct", Want: "direct"},
+		{Value: "", Want: ""},
+		{Path: secretPath, Want: "hunter2"},
+		{Path: "$GORSE_TEST_SECRETS/secret", Want: "hunter2"},
+		{Value: "direct", Path: secretPath, WantErr: true},
+		{Path: filepath.Join(dir, "missing"), WantErr: true},
+		{Path: filepath.Join(dir, "empty"), WantErr: true},
+	}
+
+	for _, test := range tests {
+		got, err := ReadSecret(test.Value, test.Path)
+		if (err != nil) != test.WantErr || got != test.Want {
+			t.Errorf("ReadSecret(%q, %q) = %q, %v, wanted %q (error: %t)",
+				test.Value, test.Path, got, err, test.Want, test.WantErr)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package gorse
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// Users may publish the items they star as a feed so that friends can follow
+// what they find interesting. The feed's URL has a token in it so that only
+// people the user gives it to find it. Users can leave items out of it.
+
+// SetShareToken sets the token in the URL of the feed of items the user
+// starred. Blank stops publishing it. It returns ErrNotFound if there is no
+// such user.
+func SetShareToken(ctx context.Context, db Querier, userID int,
+	token string) error {
+	var t *string
+	if token != "" {
+		t = &token
+	}
+
+	query := `UPDATE rss_user SET share_token = $1 WHERE id = $2`
+
+	result, err := db.ExecContext(ctx, query, t, userID)
+	if err != nil {
+		return fmt.Errorf("unable to set share token for user %d: %s", userID,
+			err)
+	}
+
+	return requireOneRow(result)
+}
+
+// UserByShareToken retrieves the user publishing the feed with the token. It
+// returns ErrNotFound if no one is.
+func UserByShareToken(ctx context.Context, db Querier,
+	token string) (*User, error) {
+	if token == "" {
+		return nil, ErrNotFound
+	}
+
+	query := `
+SELECT id, email, admin, locale, relative_dates, share_email, kindle_email,
+COALESCE(share_token, ''), compact_list
+FROM rss_user
+WHERE share_token = $1
+`
+
+	user := &User{}
+	err := db.QueryRowContext(ctx, query, token).Scan(&user.ID, &user.Email,
+		&user.Admin, &user.Locale, &user.RelativeDates, &user.ShareEmail,
+		&user.KindleEmail, &user.ShareToken, &user.CompactList)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to look up user by share token: %s", err)
+	}
+
+	return user, nil
+}
+
+// SharedItems retrieves the items the user starred and didn't leave out of
+// their feed, most recently starred first. limit is the most to retrieve.
+//
+// Like the list of starred items, this includes items of deleted feeds.
+func SharedItems(ctx context.Context, db Querier, userID,
+	limit int) ([]UserItem, error) {
+	query := `
+SELECT
+ri.id,
+ri.title,
+ri.description,
+ri.link,
+ri.publication_date,
+ri.guid,
+ri.rss_feed_id,
+rf.name,
+COALESCE(ris.state, 'unread'),
+COALESCE(ris.note, '')
+FROM rss_item_star rist
+JOIN rss_item ri ON ri.id = rist.item_id
+JOIN rss_feed rf ON rf.id = ri.rss_feed_id
+LEFT JOIN rss_item_state ris ON ris.item_id = ri.id AND ris.user_id = $1
+WHERE rist.user_id = $1 AND NOT rist.unshared
+ORDER BY rist.create_time DESC, ri.id DESC
+LIMIT $2
+`
+
+	rows, err := db.QueryContext(ctx, query, userID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("unable to query shared items: %s", err)
+	}
+
+	var items []UserItem
+	for rows.Next() {
+		item := UserItem{Starred: true}
+		var state string
+		if err := rows.Scan(
+			&item.ID,
+			&item.Title,
+			&item.Description,
+			&item.Link,
+			&item.PublicationDate,
+			&item.GUID,
+			&item.RSSFeedID,
+			&item.FeedName,
+			&state,
+			&item.Note,
+		); err != nil {
+			_ = rows.Close()
+			return nil, fmt.Errorf("failed to scan row: %s", err)
+		}
+
+		readState, err := ParseReadState(state)
+		if err != nil {
+			_ = rows.Close()
+			return nil, err
+		}
+		item.ReadState = readState
+
+		items = append(items, item)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failure fetching rows: %s", err)
+	}
+
+	return items, nil
+}
+
+// SetItemShared sets whether the item is in the feed of items the user
+// starred. The user must have starred the item. If not, it returns
+// ErrNotFound.
+func SetItemShared(ctx context.Context, db Querier, itemID int64, userID int,
+	shared bool) error {
+	query := `
+UPDATE rss_item_star SET unshared = $1
+WHERE user_id = $2 AND item_id = $3
+`
+
+	result, err := db.ExecContext(ctx, query, !shared, userID, itemID)
+	if err != nil {
+		return fmt.Errorf("unable to set whether item %d is shared: %s", itemID,
+			err)
+	}
+
+	return requireOneRow(result)
+}
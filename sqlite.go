@@ -0,0 +1,8 @@
+//go:build sqlite3
+// +build sqlite3
+
+package gorse
+
+// Register the SQLite driver. It requires cgo, so we only include it when
+// asked to.
+import _ "github.com/mattn/go-sqlite3"
@@ -0,0 +1,1462 @@
+//go:build sqlite3
+// +build sqlite3
+
+package gorse
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/horgh/rss"
+)
+
+func TestMigrateSQLite(t *testing.T) {
+	ctx := context.Background()
+
+	db, err := OpenDB(DBConfig{
+		Type: SQLite,
+		Name: filepath.Join(t.TempDir(), "gorse.db"),
+	})
+	if err != nil {
+		t.Fatalf("OpenDB() = error %s", err)
+	}
+	defer db.Close()
+
+	migrations, err := Migrations(SQLite)
+	if err != nil {
+		t.Fatalf("Migrations() = error %s", err)
+	}
+
+	applied, err := Migrate(ctx, db, SQLite)
+	if err != nil {
+		t.Fatalf("Migrate() = error %s", err)
+	}
+	if len(applied) != len(migrations) {
+		t.Errorf("applied %d migrations, wanted %d", len(applied),
+			len(migrations))
+	}
+
+	applied, err = Migrate(ctx, db, SQLite)
+	if err != nil {
+		t.Fatalf("second Migrate() = error %s", err)
+	}
+	if len(applied) != 0 {
+		t.Errorf("second Migrate() applied %d migrations, wanted 0",
+			len(applied))
+	}
+
+	version, err := SchemaVersion(ctx, db)
+	if err != nil {
+		t.Fatalf("SchemaVersion() = error %s", err)
+	}
+	if version != migrations[len(migrations)-1].Version {
+		t.Errorf("version = %d, wanted %d", version,
+			migrations[len(migrations)-1].Version)
+	}
+
+	if _, err := db.ExecContext(ctx,
+		`INSERT INTO rss_user (email) VALUES ('Me@Example.com')`); err != nil {
+		t.Fatalf("unable to insert user: %s", err)
+	}
+	if _, err := db.ExecContext(ctx,
+		`INSERT INTO rss_feed (name, uri, update_frequency_seconds, archive)
+		VALUES ('Test', 'https://example.com/feed', 3600, false)`); err != nil {
+		t.Fatalf("unable to insert feed: %s", err)
+	}
+
+	var id int64
+	if err := db.QueryRowContext(ctx,
+		`INSERT INTO rss_item
+		(title, description, link, publication_date, rss_feed_id)
+		VALUES ('Hi', '', 'https://example.com/1', CURRENT_TIMESTAMP, 1)
+		RETURNING id`).Scan(&id); err != nil {
+		t.Fatalf("unable to insert item: %s", err)
+	}
+
+	if err := DBSetItemReadState(ctx, db, id, 1, Read); err != nil {
+		t.Fatalf("DBSetItemReadState() = error %s", err)
+	}
+	if err := DBSetItemReadState(ctx, db, id, 1, ReadLater); err != nil {
+		t.Fatalf("DBSetItemReadState() = error %s", err)
+	}
+
+	var email, state string
+	if err := db.QueryRowContext(ctx,
+		`SELECT u.email, s.state FROM rss_user u
+		JOIN rss_item_state s ON s.user_id = u.id`).Scan(&email,
+		&state); err != nil {
+		t.Fatalf("unable to query: %s", err)
+	}
+	if email != "me@example.com" {
+		t.Errorf("email = %s, wanted it lowercased", email)
+	}
+	if state != ReadLater.String() {
+		t.Errorf("state = %s, wanted %s", state, ReadLater)
+	}
+
+	item, err := FindItemByLink(ctx, db, 1, "https://example.com/1")
+	if err != nil {
+		t.Fatalf("FindItemByLink() = error %s", err)
+	}
+	if item.ID != id || item.PublicationDate.IsZero() {
+		t.Errorf("FindItemByLink() = %+v", item)
+	}
+}
+
+func TestSQLStoreSQLite(t *testing.T) {
+	ctx := context.Background()
+
+	db, err := OpenDB(DBConfig{
+		Type: SQLite,
+		Name: filepath.Join(t.TempDir(), "gorse.db"),
+	})
+	if err != nil {
+		t.Fatalf("OpenDB() = error %s", err)
+	}
+	defer db.Close()
+
+	if _, err := Migrate(ctx, db, SQLite); err != nil {
+		t.Fatalf("Migrate() = error %s", err)
+	}
+
+	store := NewSQLStore(db, SQLite)
+
+	user, err := store.CreateUser(ctx, "me@example.com", "password", false)
+	if err != nil {
+		t.Fatalf("CreateUser() = error %s", err)
+	}
+	userID := user.ID
+
+	if _, err := db.ExecContext(ctx,
+		`INSERT INTO rss_feed (name, uri, update_frequency_seconds, archive)
+		VALUES ('Test', 'https://example.com/feed', 3600, false)`); err != nil {
+		t.Fatalf("unable to insert feed: %s", err)
+	}
+
+	feeds, err := store.ActiveFeeds(ctx)
+	if err != nil {
+		t.Fatalf("ActiveFeeds() = error %s", err)
+	}
+	if len(feeds) != 1 || feeds[0].LastUpdateTime != nil {
+		t.Fatalf("ActiveFeeds() = %+v", feeds)
+	}
+	feedID := feeds[0].ID
+
+	newest, err := store.NewestItemTime(ctx, feedID)
+	if err != nil {
+		t.Fatalf("NewestItemTime() = error %s", err)
+	}
+	if !newest.IsZero() {
+		t.Errorf("NewestItemTime() = %s, wanted zero time", newest)
+	}
+
+	now := time.Now().Truncate(time.Second)
+	var ids []int64
+	for i := 0; i < 3; i++ {
+		id, err := store.AddItem(ctx, feedID, &Item{Item: rss.Item{
+			Title:   fmt.Sprintf("Item %d", i),
+			Link:    fmt.Sprintf("https://example.com/%d", i),
+			GUID:    fmt.Sprintf("guid-%d", i),
+			PubDate: now.Add(time.Duration(i) * time.Hour),
+		}})
+		if err != nil {
+			t.Fatalf("AddItem() = error %s", err)
+		}
+		ids = append(ids, id)
+	}
+
+	newest, err = store.NewestItemTime(ctx, feedID)
+	if err != nil {
+		t.Fatalf("NewestItemTime() = error %s", err)
+	}
+	if !newest.Equal(now.Add(2 * time.Hour)) {
+		t.Errorf("NewestItemTime() = %s, wanted %s", newest,
+			now.Add(2*time.Hour))
+	}
+
+	exists, err := store.ItemExistsByGUID(ctx, feedID, "guid-1")
+	if err != nil || !exists {
+		t.Errorf("ItemExistsByGUID() = %t, %v, wanted true", exists, err)
+	}
+	exists, err = store.ItemExistsByLink(ctx, feedID, "https://example.com/9")
+	if err != nil || exists {
+		t.Errorf("ItemExistsByLink() = %t, %v, wanted false", exists, err)
+	}
+
+	if err := store.SetItemReadState(ctx, ids[0], userID,
+		ReadLater); err != nil {
+		t.Fatalf("SetItemReadState() = error %s", err)
+	}
+
+	unreadState, laterState := Unread, ReadLater
+	unreadFilter := ItemFilter{
+		UserID: userID,
+		State:  &unreadState,
+		Since:  now.Add(-time.Hour),
+		Limit:  10,
+	}
+	unread, err := store.FindItems(ctx, unreadFilter)
+	if err != nil {
+		t.Fatalf("FindItems() = error %s", err)
+	}
+	if len(unread) != 2 || unread[0].ID != ids[2] || unread[1].ID != ids[1] {
+		t.Errorf("FindItems() = %+v", unread)
+	}
+	count, err := store.CountItems(ctx, unreadFilter)
+	if err != nil || count != 2 {
+		t.Errorf("CountItems() = %d, %v, wanted 2", count, err)
+	}
+
+	later, err := store.FindItems(ctx, ItemFilter{
+		UserID: userID,
+		State:  &laterState,
+	})
+	if err != nil {
+		t.Fatalf("FindItems() = error %s", err)
+	}
+	if len(later) != 1 || later[0].ID != ids[0] || later[0].FeedName != "Test" ||
+		later[0].ReadState != ReadLater {
+		t.Errorf("FindItems() = %+v", later)
+	}
+
+	// Paging through with a cursor.
+	page, err := store.FindItems(ctx, ItemFilter{UserID: userID, Limit: 2})
+	if err != nil {
+		t.Fatalf("FindItems() = error %s", err)
+	}
+	if len(page) != 2 || page[0].ID != ids[2] || page[1].ID != ids[1] {
+		t.Fatalf("FindItems() = %+v", page)
+	}
+	cursor := page[1].Cursor()
+	page, err = store.FindItems(ctx, ItemFilter{
+		UserID: userID,
+		After:  &cursor,
+		Limit:  2,
+	})
+	if err != nil {
+		t.Fatalf("FindItems() = error %s", err)
+	}
+	if len(page) != 1 || page[0].ID != ids[0] {
+		t.Errorf("FindItems() after cursor = %+v", page)
+	}
+
+	found, err := store.FindItems(ctx, ItemFilter{
+		UserID: userID,
+		FeedID: feedID,
+		Until:  now.Add(time.Hour),
+		Search: "item 1",
+	})
+	if err != nil {
+		t.Fatalf("FindItems() = error %s", err)
+	}
+	if len(found) != 1 || found[0].ID != ids[1] {
+		t.Errorf("FindItems() searching = %+v", found)
+	}
+	count, err = store.CountItems(ctx, ItemFilter{UserID: userID, Search: "50%"})
+	if err != nil || count != 0 {
+		t.Errorf("CountItems() searching = %d, %v, wanted 0", count, err)
+	}
+
+	// Searching finds other forms of words, and sees changes to items.
+	if _, err := db.ExecContext(ctx,
+		`UPDATE rss_item SET description = 'Polling feeds' WHERE id = $1`,
+		ids[0]); err != nil {
+		t.Fatalf("unable to update item: %s", err)
+	}
+	found, err = store.SearchItems(ctx, ItemFilter{
+		UserID: userID,
+		Search: "FEED poll",
+		Limit:  10,
+	})
+	if err != nil {
+		t.Fatalf("SearchItems() = error %s", err)
+	}
+	if len(found) != 1 || found[0].ID != ids[0] {
+		t.Errorf("SearchItems() = %+v", found)
+	}
+
+	// Notes go on items with a state.
+	if err := store.SetItemNote(ctx, ids[1], userID, "No"); err != ErrNotFound {
+		t.Errorf("SetItemNote() = %v, wanted ErrNotFound", err)
+	}
+	if err := store.SetItemNote(ctx, ids[0], userID, " Later "); err != nil {
+		t.Fatalf("SetItemNote() = error %s", err)
+	}
+	if err := store.SetItemNote(ctx, ids[0], userID,
+		strings.Repeat("x", MaxNoteLength+1)); err == nil {
+		t.Errorf("SetItemNote() too long = nil, wanted error")
+	}
+	found, err = store.FindItems(ctx, ItemFilter{UserID: userID,
+		State: &laterState})
+	if err != nil {
+		t.Fatalf("FindItems() = error %s", err)
+	}
+	if len(found) != 1 || found[0].Note != "Later" {
+		t.Errorf("FindItems() = %+v, wanted the note", found)
+	}
+
+	item, err := store.GetItem(ctx, ids[0], userID)
+	if err != nil {
+		t.Fatalf("GetItem() = error %s", err)
+	}
+	if item.ReadState != ReadLater || !item.PublicationDate.Equal(now) ||
+		item.Note != "Later" {
+		t.Errorf("GetItem() = %+v", item)
+	}
+	if err := store.SetItemNote(ctx, ids[0], userID, " "); err != nil {
+		t.Fatalf("SetItemNote() = error %s", err)
+	}
+	if item, err := store.GetItem(ctx, ids[0], userID); err != nil ||
+		item.Note != "" {
+		t.Errorf("GetItem() = %+v, %v, wanted the note cleared", item, err)
+	}
+	if err := store.RecordReadAfterReadLater(ctx, userID, item); err != nil {
+		t.Errorf("RecordReadAfterReadLater() = error %s", err)
+	}
+
+	if err := store.SetItemsReadState(ctx, []int64{ids[1], ids[2], ids[1]},
+		userID, Read); err != nil {
+		t.Fatalf("SetItemsReadState() = error %s", err)
+	}
+	count, err = store.CountItems(ctx, unreadFilter)
+	if err != nil || count != 0 {
+		t.Errorf("CountItems() = %d, %v, wanted 0", count, err)
+	}
+
+	// Setting a state again isn't a change.
+	if err := store.SetItemReadState(ctx, ids[2], userID, Read); err != nil {
+		t.Fatalf("SetItemReadState() = error %s", err)
+	}
+	changes, err := store.StateChanges(ctx, userID, 10)
+	if err != nil {
+		t.Fatalf("StateChanges() = error %s", err)
+	}
+	if len(changes) != 3 ||
+		changes[0].ItemID != ids[2] || changes[0].OldState != Unread ||
+		changes[0].NewState != Read ||
+		changes[2].ItemID != ids[0] || changes[2].OldState != Unread ||
+		changes[2].NewState != ReadLater || changes[2].Time.IsZero() {
+		t.Errorf("StateChanges() = %+v", changes)
+	}
+}
+
+func TestUsersSQLite(t *testing.T) {
+	ctx := context.Background()
+
+	db, err := OpenDB(DBConfig{
+		Type: SQLite,
+		Name: filepath.Join(t.TempDir(), "gorse.db"),
+	})
+	if err != nil {
+		t.Fatalf("OpenDB() = error %s", err)
+	}
+	defer db.Close()
+
+	if _, err := Migrate(ctx, db, SQLite); err != nil {
+		t.Fatalf("Migrate() = error %s", err)
+	}
+
+	admin, err := CreateUser(ctx, db, "Admin@Example.com", "password1", true)
+	if err != nil {
+		t.Fatalf("CreateUser() = error %s", err)
+	}
+	if _, err := CreateUser(ctx, db, "admin@example.com", "password2",
+		false); err == nil {
+		t.Error("CreateUser() with duplicate email succeeded")
+	}
+	if _, err := CreateUser(ctx, db, "b@example.com", "password3",
+		false); err != nil {
+		t.Fatalf("CreateUser() = error %s", err)
+	}
+
+	user, err := AuthenticateUser(ctx, db, "admin@example.com", "password1")
+	if err != nil {
+		t.Fatalf("AuthenticateUser() = error %s", err)
+	}
+	if user.ID != admin.ID || !user.Admin {
+		t.Errorf("AuthenticateUser() = %+v", user)
+	}
+
+	if err := UpdatePassword(ctx, db, admin.ID, "password4"); err != nil {
+		t.Fatalf("UpdatePassword() = error %s", err)
+	}
+	if _, err := AuthenticateUser(ctx, db, "admin@example.com",
+		"password1"); err != ErrInvalidCredentials {
+		t.Errorf("AuthenticateUser() with old password = %v", err)
+	}
+	if _, err := AuthenticateUser(ctx, db, "admin@example.com",
+		"password4"); err != nil {
+		t.Errorf("AuthenticateUser() with new password = error %s", err)
+	}
+	if err := UpdatePassword(ctx, db, 999, "password5"); err == nil {
+		t.Error("UpdatePassword() for missing user succeeded")
+	}
+
+	users, err := ListUsers(ctx, db)
+	if err != nil {
+		t.Fatalf("ListUsers() = error %s", err)
+	}
+	if len(users) != 2 || users[0].Email != "admin@example.com" ||
+		users[1].Email != "b@example.com" || users[1].Admin {
+		t.Errorf("ListUsers() = %+v", users)
+	}
+
+	if err := UpdateLocale(ctx, db, admin.ID, "fr", true); err != nil {
+		t.Fatalf("UpdateLocale() = error %s", err)
+	}
+	user, err = GetUser(ctx, db, admin.ID)
+	if err != nil {
+		t.Fatalf("GetUser() = error %s", err)
+	}
+	if user.Locale != "fr" || !user.RelativeDates {
+		t.Errorf("GetUser() = %+v, wanted locale fr and relative dates", user)
+	}
+	if err := UpdateLocale(ctx, db, 999, "fr", false); err == nil {
+		t.Error("UpdateLocale() for missing user succeeded")
+	}
+
+	if err := UpdateShareEmail(ctx, db, admin.ID,
+		" Friend@example.com"); err != nil {
+		t.Fatalf("UpdateShareEmail() = error %s", err)
+	}
+	user, err = GetUser(ctx, db, admin.ID)
+	if err != nil {
+		t.Fatalf("GetUser() = error %s", err)
+	}
+	if user.ShareEmail != "friend@example.com" {
+		t.Errorf("GetUser() = %+v, wanted share email friend@example.com", user)
+	}
+	if err := UpdateShareEmail(ctx, db, admin.ID, "not an email"); err == nil {
+		t.Error("UpdateShareEmail() with invalid email succeeded")
+	}
+
+	if err := UpdateKindleEmail(ctx, db, admin.ID,
+		"Me@Kindle.com"); err != nil {
+		t.Fatalf("UpdateKindleEmail() = error %s", err)
+	}
+	user, err = GetUser(ctx, db, admin.ID)
+	if err != nil {
+		t.Fatalf("GetUser() = error %s", err)
+	}
+	if user.KindleEmail != "me@kindle.com" ||
+		user.ShareEmail != "friend@example.com" {
+		t.Errorf("GetUser() = %+v, wanted kindle email me@kindle.com", user)
+	}
+
+	if err := UpdateCompactList(ctx, db, admin.ID, true); err != nil {
+		t.Fatalf("UpdateCompactList() = error %s", err)
+	}
+	user, err = GetUser(ctx, db, admin.ID)
+	if err != nil {
+		t.Fatalf("GetUser() = error %s", err)
+	}
+	if !user.CompactList {
+		t.Errorf("GetUser() = %+v, wanted a compact list", user)
+	}
+}
+
+func TestFeedsSQLite(t *testing.T) {
+	ctx := context.Background()
+
+	db, err := OpenDB(DBConfig{
+		Type: SQLite,
+		Name: filepath.Join(t.TempDir(), "gorse.db"),
+	})
+	if err != nil {
+		t.Fatalf("OpenDB() = error %s", err)
+	}
+	defer db.Close()
+
+	if _, err := Migrate(ctx, db, SQLite); err != nil {
+		t.Fatalf("Migrate() = error %s", err)
+	}
+
+	store := NewSQLStore(db, SQLite)
+	defer store.Close()
+
+	if _, err := store.GetFeedByURI(ctx,
+		"https://example.com/feed"); err != ErrNotFound {
+		t.Errorf("GetFeedByURI() = error %v, wanted ErrNotFound", err)
+	}
+
+	id, err := store.CreateFeed(ctx, DBFeed{
+		Name:                   "Example",
+		URI:                    "https://example.com/feed",
+		UpdateFrequencySeconds: 3600,
+		Active:                 true,
+	})
+	if err != nil {
+		t.Fatalf("CreateFeed() = error %s", err)
+	}
+	if _, err := store.CreateFeed(ctx, DBFeed{
+		Name:                   "Example 2",
+		URI:                    "https://example.com/feed",
+		UpdateFrequencySeconds: 3600,
+	}); err == nil {
+		t.Error("CreateFeed() with duplicate URI succeeded")
+	}
+
+	feed, err := store.GetFeedByURI(ctx, "https://example.com/feed")
+	if err != nil {
+		t.Fatalf("GetFeedByURI() = error %s", err)
+	}
+	if feed.ID != id || feed.Name != "Example" || !feed.Active ||
+		feed.Archive {
+		t.Errorf("GetFeedByURI() = %+v", feed)
+	}
+
+	feed.Name = "Renamed"
+	feed.Archive = true
+	if err := store.UpdateFeed(ctx, *feed); err != nil {
+		t.Fatalf("UpdateFeed() = error %s", err)
+	}
+	if err := store.UpdateFeed(ctx, DBFeed{
+		ID:                     id + 1,
+		Name:                   "Missing",
+		URI:                    "https://example.com/missing",
+		UpdateFrequencySeconds: 3600,
+	}); err != ErrNotFound {
+		t.Errorf("UpdateFeed() of missing feed = error %v, wanted ErrNotFound",
+			err)
+	}
+
+	feeds, err := store.ActiveFeeds(ctx)
+	if err != nil {
+		t.Fatalf("ActiveFeeds() = error %s", err)
+	}
+	if len(feeds) != 1 || feeds[0].Name != "Renamed" || !feeds[0].Archive {
+		t.Errorf("ActiveFeeds() = %+v", feeds)
+	}
+
+	if err := store.DeactivateFeed(ctx, id); err != nil {
+		t.Fatalf("DeactivateFeed() = error %s", err)
+	}
+	feeds, err = store.ActiveFeeds(ctx)
+	if err != nil || len(feeds) != 0 {
+		t.Errorf("ActiveFeeds() = %+v, %v, wanted none", feeds, err)
+	}
+}
+
+func TestDeleteFeedSQLite(t *testing.T) {
+	ctx := context.Background()
+
+	db, err := OpenDB(DBConfig{
+		Type: SQLite,
+		Name: filepath.Join(t.TempDir(), "gorse.db"),
+	})
+	if err != nil {
+		t.Fatalf("OpenDB() = error %s", err)
+	}
+	defer db.Close()
+
+	if _, err := Migrate(ctx, db, SQLite); err != nil {
+		t.Fatalf("Migrate() = error %s", err)
+	}
+
+	store := NewSQLStore(db, SQLite)
+	defer store.Close()
+
+	user, err := store.CreateUser(ctx, "me@example.com", "password", false)
+	if err != nil {
+		t.Fatalf("CreateUser() = error %s", err)
+	}
+
+	feedID, err := store.CreateFeed(ctx, DBFeed{
+		Name:                   "Example",
+		URI:                    "https://example.com/feed",
+		UpdateFrequencySeconds: 3600,
+		Active:                 true,
+	})
+	if err != nil {
+		t.Fatalf("CreateFeed() = error %s", err)
+	}
+
+	var ids []int64
+	for i := 0; i < 2; i++ {
+		id, err := store.AddItem(ctx, feedID, &Item{Item: rss.Item{
+			Title:   fmt.Sprintf("Item %d", i),
+			Link:    fmt.Sprintf("https://example.com/%d", i),
+			PubDate: time.Now(),
+		}})
+		if err != nil {
+			t.Fatalf("AddItem() = error %s", err)
+		}
+		ids = append(ids, id)
+	}
+	if err := store.SetItemReadState(ctx, ids[1], user.ID,
+		ReadLater); err != nil {
+		t.Fatalf("SetItemReadState() = error %s", err)
+	}
+
+	unreadState := Unread
+	countItems := func(state *ReadState) int {
+		count, err := store.CountItems(ctx, ItemFilter{
+			UserID: user.ID,
+			State:  state,
+		})
+		if err != nil {
+			t.Fatalf("CountItems() = error %s", err)
+		}
+		return count
+	}
+
+	// Deleting hides the feed and its items. Restoring brings them back.
+	if err := store.DeleteFeed(ctx, feedID, KeepItems); err != nil {
+		t.Fatalf("DeleteFeed() = error %s", err)
+	}
+	if count := countItems(nil); count != 0 {
+		t.Errorf("%d items after deleting, wanted 0", count)
+	}
+	feeds, err := store.ActiveFeeds(ctx)
+	if err != nil || len(feeds) != 0 {
+		t.Errorf("ActiveFeeds() = %+v, %v, wanted none", feeds, err)
+	}
+	feed, err := store.GetFeedByURI(ctx, "https://example.com/feed")
+	if err != nil || !feed.Deleted {
+		t.Errorf("GetFeedByURI() = %+v, %v, wanted deleted feed", feed, err)
+	}
+	if err := store.RestoreFeed(ctx, feedID); err != nil {
+		t.Fatalf("RestoreFeed() = error %s", err)
+	}
+	if count := countItems(&unreadState); count != 1 {
+		t.Errorf("%d unread items after restoring, wanted 1", count)
+	}
+
+	// Archiving marks unread items read but leaves those to read later.
+	if err := store.DeleteFeed(ctx, feedID, ArchiveItems); err != nil {
+		t.Fatalf("DeleteFeed() = error %s", err)
+	}
+	if err := store.RestoreFeed(ctx, feedID); err != nil {
+		t.Fatalf("RestoreFeed() = error %s", err)
+	}
+	if count := countItems(&unreadState); count != 0 {
+		t.Errorf("%d unread items after archiving, wanted 0", count)
+	}
+	item, err := store.GetItem(ctx, ids[1], user.ID)
+	if err != nil || item.ReadState != ReadLater {
+		t.Errorf("GetItem() = %+v, %v, wanted read later item", item, err)
+	}
+
+	if err := store.DeleteFeed(ctx, feedID, PurgeItems); err != nil {
+		t.Fatalf("DeleteFeed() = error %s", err)
+	}
+	if err := store.RestoreFeed(ctx, feedID); err != nil {
+		t.Fatalf("RestoreFeed() = error %s", err)
+	}
+	if count := countItems(nil); count != 0 {
+		t.Errorf("%d items after purging, wanted 0", count)
+	}
+
+	if err := store.DeleteFeed(ctx, feedID+1, KeepItems); err != ErrNotFound {
+		t.Errorf("DeleteFeed() of missing feed = error %v, wanted ErrNotFound",
+			err)
+	}
+}
+
+func TestSubscriptionsSQLite(t *testing.T) {
+	ctx := context.Background()
+
+	db, err := OpenDB(DBConfig{
+		Type: SQLite,
+		Name: filepath.Join(t.TempDir(), "gorse.db"),
+	})
+	if err != nil {
+		t.Fatalf("OpenDB() = error %s", err)
+	}
+	defer db.Close()
+
+	if _, err := Migrate(ctx, db, SQLite); err != nil {
+		t.Fatalf("Migrate() = error %s", err)
+	}
+
+	store := NewSQLStore(db, SQLite)
+	defer store.Close()
+
+	user, err := store.CreateUser(ctx, "me@example.com", "password", false)
+	if err != nil {
+		t.Fatalf("CreateUser() = error %s", err)
+	}
+
+	var feedIDs []int64
+	for _, name := range []string{"B", "A"} {
+		id, err := store.CreateFeed(ctx, DBFeed{
+			Name:                   name,
+			URI:                    "https://example.com/" + name,
+			UpdateFrequencySeconds: 3600,
+			Active:                 true,
+		})
+		if err != nil {
+			t.Fatalf("CreateFeed() = error %s", err)
+		}
+		feedIDs = append(feedIDs, id)
+
+		if _, err := store.AddItem(ctx, id, &Item{Item: rss.Item{
+			Title:   "Item of " + name,
+			Link:    "https://example.com/" + name + "/1",
+			PubDate: time.Now(),
+		}}); err != nil {
+			t.Fatalf("AddItem() = error %s", err)
+		}
+	}
+
+	for _, id := range []int64{feedIDs[0], feedIDs[1], feedIDs[0]} {
+		if err := store.Subscribe(ctx, user.ID, id); err != nil {
+			t.Fatalf("Subscribe() = error %s", err)
+		}
+	}
+
+	feeds, err := store.ListSubscriptions(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("ListSubscriptions() = error %s", err)
+	}
+	if len(feeds) != 2 || feeds[0].Name != "A" || feeds[1].Name != "B" {
+		t.Errorf("ListSubscriptions() = %+v", feeds)
+	}
+
+	subscribers, err := store.FeedSubscribers(ctx, feedIDs[0])
+	if err != nil {
+		t.Fatalf("FeedSubscribers() = error %s", err)
+	}
+	if len(subscribers) != 1 || subscribers[0] != user.ID {
+		t.Errorf("FeedSubscribers() = %v", subscribers)
+	}
+
+	if err := store.Unsubscribe(ctx, user.ID, feedIDs[0]); err != nil {
+		t.Fatalf("Unsubscribe() = error %s", err)
+	}
+	if err := store.Unsubscribe(ctx, user.ID,
+		feedIDs[0]); err != ErrNotFound {
+		t.Errorf("second Unsubscribe() = %v, wanted ErrNotFound", err)
+	}
+
+	// Only items of subscribed feeds.
+	items, err := store.FindItems(ctx, ItemFilter{UserID: user.ID,
+		Subscribed: true})
+	if err != nil {
+		t.Fatalf("FindItems() = error %s", err)
+	}
+	if len(items) != 1 || items[0].RSSFeedID != feedIDs[1] {
+		t.Errorf("FindItems() = %+v", items)
+	}
+	count, err := store.CountItems(ctx, ItemFilter{UserID: user.ID})
+	if err != nil || count != 2 {
+		t.Errorf("CountItems() = %d, %v, wanted 2", count, err)
+	}
+
+	// Deleted feeds aren't listed.
+	if err := store.DeleteFeed(ctx, feedIDs[1], KeepItems); err != nil {
+		t.Fatalf("DeleteFeed() = error %s", err)
+	}
+	feeds, err = store.ListSubscriptions(ctx, user.ID)
+	if err != nil || len(feeds) != 0 {
+		t.Errorf("ListSubscriptions() = %+v, %v, wanted none", feeds, err)
+	}
+}
+
+func TestUnreadCountsSQLite(t *testing.T) {
+	ctx := context.Background()
+
+	db, err := OpenDB(DBConfig{
+		Type: SQLite,
+		Name: filepath.Join(t.TempDir(), "gorse.db"),
+	})
+	if err != nil {
+		t.Fatalf("OpenDB() = error %s", err)
+	}
+	defer db.Close()
+
+	if _, err := Migrate(ctx, db, SQLite); err != nil {
+		t.Fatalf("Migrate() = error %s", err)
+	}
+
+	store := NewSQLStore(db, SQLite)
+	defer store.Close()
+
+	user, err := store.CreateUser(ctx, "me@example.com", "password", false)
+	if err != nil {
+		t.Fatalf("CreateUser() = error %s", err)
+	}
+
+	var feedIDs []int64
+	for _, name := range []string{"A", "B"} {
+		id, err := store.CreateFeed(ctx, DBFeed{
+			Name:                   name,
+			URI:                    "https://example.com/" + name,
+			UpdateFrequencySeconds: 3600,
+			Active:                 true,
+		})
+		if err != nil {
+			t.Fatalf("CreateFeed() = error %s", err)
+		}
+		feedIDs = append(feedIDs, id)
+	}
+
+	// Items an hour apart over a few days.
+	now := time.Now().Truncate(time.Second)
+	var ids []int64
+	for i := 0; i < 60; i++ {
+		id, err := store.AddItem(ctx, feedIDs[i%2], &Item{Item: rss.Item{
+			Title:   fmt.Sprintf("Item %d", i),
+			Link:    fmt.Sprintf("https://example.com/%d", i),
+			PubDate: now.Add(-time.Duration(i) * time.Hour),
+		}})
+		if err != nil {
+			t.Fatalf("AddItem() = error %s", err)
+		}
+		ids = append(ids, id)
+	}
+
+	if err := store.SetItemsReadState(ctx, ids[10:20], user.ID,
+		Read); err != nil {
+		t.Fatalf("SetItemsReadState() = error %s", err)
+	}
+	if err := store.SetItemReadState(ctx, ids[15], user.ID,
+		Unread); err != nil {
+		t.Fatalf("SetItemReadState() = error %s", err)
+	}
+	if err := store.SetItemReadState(ctx, ids[30], user.ID,
+		ReadLater); err != nil {
+		t.Fatalf("SetItemReadState() = error %s", err)
+	}
+
+	// A user added later has everything unread.
+	other, err := store.CreateUser(ctx, "other@example.com", "password", false)
+	if err != nil {
+		t.Fatalf("CreateUser() = error %s", err)
+	}
+
+	// Counts must agree with looking at the items.
+	check := func(name string, filter ItemFilter) {
+		t.Helper()
+
+		count, err := store.CountItems(ctx, filter)
+		if err != nil {
+			t.Fatalf("%s: CountItems() = error %s", name, err)
+		}
+		items, err := store.FindItems(ctx, filter)
+		if err != nil {
+			t.Fatalf("%s: FindItems() = error %s", name, err)
+		}
+		if count != len(items) {
+			t.Errorf("%s: CountItems() = %d, wanted %d", name, count, len(items))
+		}
+	}
+
+	unread := Unread
+	for _, userID := range []int{user.ID, other.ID} {
+		for _, since := range []time.Time{{}, now.Add(-30 * time.Hour),
+			now.Add(-100 * time.Hour)} {
+			name := fmt.Sprintf("user %d since %s", userID, since)
+			check(name, ItemFilter{UserID: userID, State: &unread, Since: since})
+			check(name+" feed", ItemFilter{UserID: userID, State: &unread,
+				Since: since, FeedID: feedIDs[1]})
+		}
+	}
+
+	counts, err := store.UnreadCounts(ctx, user.ID, time.Time{})
+	if err != nil {
+		t.Fatalf("UnreadCounts() = error %s", err)
+	}
+	if counts[feedIDs[0]] != 24 || counts[feedIDs[1]] != 26 {
+		t.Errorf("UnreadCounts() = %v", counts)
+	}
+
+	// Purged items no longer count.
+	if err := store.DeleteFeed(ctx, feedIDs[0], PurgeItems); err != nil {
+		t.Fatalf("DeleteFeed() = error %s", err)
+	}
+	check("purged", ItemFilter{UserID: user.ID, State: &unread})
+	counts, err = store.UnreadCounts(ctx, user.ID, time.Time{})
+	if err != nil {
+		t.Fatalf("UnreadCounts() = error %s", err)
+	}
+	if len(counts) != 1 || counts[feedIDs[1]] != 26 {
+		t.Errorf("UnreadCounts() = %v", counts)
+	}
+}
+
+func TestExportUserSQLite(t *testing.T) {
+	ctx := context.Background()
+
+	db, err := OpenDB(DBConfig{
+		Type: SQLite,
+		Name: filepath.Join(t.TempDir(), "gorse.db"),
+	})
+	if err != nil {
+		t.Fatalf("OpenDB() = error %s", err)
+	}
+	defer db.Close()
+
+	if _, err := Migrate(ctx, db, SQLite); err != nil {
+		t.Fatalf("Migrate() = error %s", err)
+	}
+
+	store := NewSQLStore(db, SQLite)
+	defer store.Close()
+
+	user, err := store.CreateUser(ctx, "me@example.com", "password", false)
+	if err != nil {
+		t.Fatalf("CreateUser() = error %s", err)
+	}
+
+	feedID, err := store.CreateFeed(ctx, DBFeed{
+		Name:                   "Example",
+		URI:                    "https://example.com/feed",
+		UpdateFrequencySeconds: 3600,
+		Active:                 true,
+	})
+	if err != nil {
+		t.Fatalf("CreateFeed() = error %s", err)
+	}
+	if err := store.Subscribe(ctx, user.ID, feedID); err != nil {
+		t.Fatalf("Subscribe() = error %s", err)
+	}
+
+	var ids []int64
+	for i := 0; i < 3; i++ {
+		id, err := store.AddItem(ctx, feedID, &Item{Item: rss.Item{
+			Title:   fmt.Sprintf("Item %d", i),
+			Link:    fmt.Sprintf("https://example.com/%d", i),
+			PubDate: time.Now(),
+		}})
+		if err != nil {
+			t.Fatalf("AddItem() = error %s", err)
+		}
+		ids = append(ids, id)
+	}
+
+	if err := store.SetItemReadState(ctx, ids[0], user.ID,
+		ReadLater); err != nil {
+		t.Fatalf("SetItemReadState() = error %s", err)
+	}
+	if err := store.SetItemNote(ctx, ids[0], user.ID, "Later"); err != nil {
+		t.Fatalf("SetItemNote() = error %s", err)
+	}
+	if err := store.SetItemReadState(ctx, ids[1], user.ID, Read); err != nil {
+		t.Fatalf("SetItemReadState() = error %s", err)
+	}
+
+	var buf bytes.Buffer
+	if err := store.ExportUser(ctx, user.ID, &buf); err != nil {
+		t.Fatalf("ExportUser() = error %s", err)
+	}
+
+	var export struct {
+		Version       int
+		User          ExportedUser
+		Subscriptions []ExportedFeed
+		StateChanges  []ExportedStateChange `json:"state_changes"`
+		Items         []ExportedItem
+	}
+	if err := json.Unmarshal(buf.Bytes(), &export); err != nil {
+		t.Fatalf("export isn't JSON: %s: %s", err, buf.String())
+	}
+
+	if export.Version != ExportVersion || export.User.Email != user.Email ||
+		len(export.Subscriptions) != 1 ||
+		export.Subscriptions[0].ID != feedID {
+		t.Errorf("export = %+v", export)
+	}
+	if len(export.StateChanges) != 2 ||
+		export.StateChanges[0].NewState != "read-later" {
+		t.Errorf("export state changes = %+v", export.StateChanges)
+	}
+	// The unread item without a state isn't included.
+	if len(export.Items) != 2 ||
+		export.Items[0].ID != ids[0] || export.Items[0].State != "read-later" ||
+		export.Items[0].Note != "Later" || export.Items[0].FeedID != feedID ||
+		export.Items[1].ID != ids[1] || export.Items[1].State != "read" {
+		t.Errorf("export items = %+v", export.Items)
+	}
+}
+
+func TestImportItemsSQLite(t *testing.T) {
+	ctx := context.Background()
+
+	db, err := OpenDB(DBConfig{
+		Type: SQLite,
+		Name: filepath.Join(t.TempDir(), "gorse.db"),
+	})
+	if err != nil {
+		t.Fatalf("OpenDB() = error %s", err)
+	}
+	defer db.Close()
+
+	if _, err := Migrate(ctx, db, SQLite); err != nil {
+		t.Fatalf("Migrate() = error %s", err)
+	}
+
+	store := NewSQLStore(db, SQLite)
+	defer store.Close()
+
+	user, err := store.CreateUser(ctx, "me@example.com", "password", false)
+	if err != nil {
+		t.Fatalf("CreateUser() = error %s", err)
+	}
+
+	// We have one of the feeds and one of its items already.
+	feedID, err := store.CreateFeed(ctx, DBFeed{
+		Name:                   "Example",
+		URI:                    "https://example.com/feed",
+		UpdateFrequencySeconds: 3600,
+		Active:                 true,
+	})
+	if err != nil {
+		t.Fatalf("CreateFeed() = error %s", err)
+	}
+	itemID, err := store.AddItem(ctx, feedID, &Item{Item: rss.Item{
+		Title:   "One",
+		Link:    "https://example.com/1",
+		PubDate: time.Now(),
+	}})
+	if err != nil {
+		t.Fatalf("AddItem() = error %s", err)
+	}
+
+	items := []ImportedItem{
+		{FeedName: "Example", FeedURI: "https://example.com/feed",
+			Title: "One", Link: "https://example.com/1",
+			PublicationDate: time.Now(), State: Read},
+		{FeedName: "Example", FeedURI: "https://example.com/feed",
+			Title: "Two", Link: "https://example.com/2",
+			PublicationDate: time.Now(), State: ReadLater, Note: "Good"},
+		{FeedName: "Other", FeedURI: "https://example.org/feed",
+			Title: "Three", Link: "https://example.org/3",
+			PublicationDate: time.Now(), State: Unread},
+	}
+
+	var result ImportResult
+	if err := store.InTx(ctx, func(store Store) error {
+		var err error
+		result, err = ImportItems(ctx, store, user.ID, items)
+		return err
+	}); err != nil {
+		t.Fatalf("ImportItems() = error %s", err)
+	}
+	if result.FeedsAdded != 1 || result.ItemsAdded != 2 {
+		t.Errorf("ImportItems() = %+v", result)
+	}
+
+	feeds, err := store.ListSubscriptions(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("ListSubscriptions() = error %s", err)
+	}
+	if len(feeds) != 2 || feeds[0].Name != "Example" ||
+		feeds[1].Name != "Other" {
+		t.Errorf("ListSubscriptions() = %+v", feeds)
+	}
+
+	item, err := store.GetItem(ctx, itemID, user.ID)
+	if err != nil {
+		t.Fatalf("GetItem() = error %s", err)
+	}
+	if item.ReadState != Read {
+		t.Errorf("GetItem() = %+v, wanted it read", item)
+	}
+
+	laterState := ReadLater
+	later, err := store.FindItems(ctx, ItemFilter{UserID: user.ID,
+		State: &laterState})
+	if err != nil {
+		t.Fatalf("FindItems() = error %s", err)
+	}
+	if len(later) != 1 || later[0].Title != "Two" || later[0].Note != "Good" {
+		t.Errorf("FindItems() = %+v", later)
+	}
+
+	unreadState := Unread
+	count, err := store.CountItems(ctx, ItemFilter{UserID: user.ID,
+		State: &unreadState})
+	if err != nil || count != 1 {
+		t.Errorf("CountItems() = %d, %v, wanted 1", count, err)
+	}
+}
+
+func TestAuditLogSQLite(t *testing.T) {
+	ctx := context.Background()
+
+	db, err := OpenDB(DBConfig{
+		Type: SQLite,
+		Name: filepath.Join(t.TempDir(), "gorse.db"),
+	})
+	if err != nil {
+		t.Fatalf("OpenDB() = error %s", err)
+	}
+	defer db.Close()
+
+	if _, err := Migrate(ctx, db, SQLite); err != nil {
+		t.Fatalf("Migrate() = error %s", err)
+	}
+
+	store := NewSQLStore(db, SQLite)
+	defer store.Close()
+
+	admin, err := store.CreateUser(ctx, "admin@example.com", "password", true)
+	if err != nil {
+		t.Fatalf("CreateUser() = error %s", err)
+	}
+
+	adminCtx := WithActor(ctx, admin.ID)
+	feedID, err := store.CreateFeed(adminCtx, DBFeed{
+		Name:                   "Example",
+		URI:                    "https://example.com/feed",
+		UpdateFrequencySeconds: 3600,
+		Active:                 true,
+	})
+	if err != nil {
+		t.Fatalf("CreateFeed() = error %s", err)
+	}
+
+	itemID, err := store.AddItem(ctx, feedID, &Item{Item: rss.Item{
+		Title:   "One",
+		Link:    "https://example.com/1",
+		PubDate: time.Now(),
+	}})
+	if err != nil {
+		t.Fatalf("AddItem() = error %s", err)
+	}
+
+	// States we set ourselves aren't recorded.
+	if err := store.SetItemsReadState(ctx, []int64{itemID}, admin.ID,
+		Read); err != nil {
+		t.Fatalf("SetItemsReadState() = error %s", err)
+	}
+	if err := store.SetItemsReadState(adminCtx, []int64{itemID}, admin.ID,
+		Unread); err != nil {
+		t.Fatalf("SetItemsReadState() = error %s", err)
+	}
+
+	// Failed actions aren't recorded.
+	if err := store.DeleteFeed(adminCtx, feedID+1,
+		ArchiveItems); err != ErrNotFound {
+		t.Errorf("DeleteFeed() = %v, wanted ErrNotFound", err)
+	}
+	if err := store.DeleteFeed(adminCtx, feedID, ArchiveItems); err != nil {
+		t.Fatalf("DeleteFeed() = error %s", err)
+	}
+
+	entries, err := store.AuditLog(ctx, 10)
+	if err != nil {
+		t.Fatalf("AuditLog() = error %s", err)
+	}
+
+	wanted := []struct {
+		actorID int
+		action  string
+		details string
+	}{
+		{admin.ID, AuditFeedDelete, "feed ID [1], archive items"},
+		{admin.ID, AuditItemStates, "1 items set unread for user ID [1]"},
+		{admin.ID, AuditFeedCreate,
+			"feed ID [1]: Example (https://example.com/feed)"},
+		{0, AuditUserCreate, "user ID [1]: admin@example.com, admin true"},
+	}
+	if len(entries) != len(wanted) {
+		t.Fatalf("AuditLog() = %+v", entries)
+	}
+	for i, w := range wanted {
+		e := entries[i]
+		if e.ActorID != w.actorID || e.Action != w.action ||
+			e.Details != w.details || e.Time.IsZero() {
+			t.Errorf("AuditLog()[%d] = %+v, wanted %+v", i, e, w)
+		}
+	}
+	if entries[0].ActorEmail != "admin@example.com" {
+		t.Errorf("AuditLog()[0] actor email = %s", entries[0].ActorEmail)
+	}
+}
+
+func TestFeedRetentionSQLite(t *testing.T) {
+	ctx := context.Background()
+
+	db, err := OpenDB(DBConfig{
+		Type: SQLite,
+		Name: filepath.Join(t.TempDir(), "gorse.db"),
+	})
+	if err != nil {
+		t.Fatalf("OpenDB() = error %s", err)
+	}
+	defer db.Close()
+
+	if _, err := Migrate(ctx, db, SQLite); err != nil {
+		t.Fatalf("Migrate() = error %s", err)
+	}
+
+	store := NewSQLStore(db, SQLite)
+	defer store.Close()
+
+	feedID, err := store.CreateFeed(ctx, DBFeed{
+		Name:                   "Example",
+		URI:                    "https://example.com/feed",
+		UpdateFrequencySeconds: 3600,
+		Active:                 true,
+	})
+	if err != nil {
+		t.Fatalf("CreateFeed() = error %s", err)
+	}
+
+	policy, err := store.FeedRetention(ctx, feedID)
+	if err != nil {
+		t.Fatalf("FeedRetention() = error %s", err)
+	}
+	if !policy.Forever() {
+		t.Errorf("FeedRetention() = %+v, wanted forever", policy)
+	}
+
+	policies, err := store.FeedRetentions(ctx)
+	if err != nil {
+		t.Fatalf("FeedRetentions() = error %s", err)
+	}
+	if len(policies) != 0 {
+		t.Errorf("FeedRetentions() = %+v, wanted none", policies)
+	}
+
+	want := RetentionPolicy{Days: 30, Items: 100}
+	if err := store.SetFeedRetention(ctx, feedID, want); err != nil {
+		t.Fatalf("SetFeedRetention() = error %s", err)
+	}
+
+	policy, err = store.FeedRetention(ctx, feedID)
+	if err != nil {
+		t.Fatalf("FeedRetention() = error %s", err)
+	}
+	if policy != want {
+		t.Errorf("FeedRetention() = %+v, wanted %+v", policy, want)
+	}
+
+	policies, err = store.FeedRetentions(ctx)
+	if err != nil {
+		t.Fatalf("FeedRetentions() = error %s", err)
+	}
+	if len(policies) != 1 || policies[feedID] != want {
+		t.Errorf("FeedRetentions() = %+v, wanted %+v for feed", policies, want)
+	}
+
+	if err := store.SetFeedRetention(ctx, feedID,
+		RetentionPolicy{Days: -1}); err == nil {
+		t.Errorf("SetFeedRetention() with negative days = success")
+	}
+
+	if err := store.SetFeedRetention(ctx, feedID+1,
+		RetentionPolicy{}); err != ErrNotFound {
+		t.Errorf("SetFeedRetention() of missing feed = %v, wanted %v", err,
+			ErrNotFound)
+	}
+	if _, err := store.FeedRetention(ctx, feedID+1); err != ErrNotFound {
+		t.Errorf("FeedRetention() of missing feed = %v, wanted %v", err,
+			ErrNotFound)
+	}
+
+	entries, err := store.AuditLog(ctx, 10)
+	if err != nil {
+		t.Fatalf("AuditLog() = error %s", err)
+	}
+	if len(entries) == 0 || entries[0].Action != AuditFeedRetention {
+		t.Errorf("AuditLog() = %+v, wanted %s first", entries,
+			AuditFeedRetention)
+	}
+}
+
+func TestFeedIconSQLite(t *testing.T) {
+	ctx := context.Background()
+
+	db, err := OpenDB(DBConfig{
+		Type: SQLite,
+		Name: filepath.Join(t.TempDir(), "gorse.db"),
+	})
+	if err != nil {
+		t.Fatalf("OpenDB() = error %s", err)
+	}
+	defer db.Close()
+
+	if _, err := Migrate(ctx, db, SQLite); err != nil {
+		t.Fatalf("Migrate() = error %s", err)
+	}
+
+	store := NewSQLStore(db, SQLite)
+	defer store.Close()
+
+	feedID, err := store.CreateFeed(ctx, DBFeed{
+		Name:                   "Example",
+		URI:                    "https://example.com/feed",
+		UpdateFrequencySeconds: 3600,
+		Active:                 true,
+	})
+	if err != nil {
+		t.Fatalf("CreateFeed() = error %s", err)
+	}
+
+	if _, err := store.GetFeedIcon(ctx, feedID); err != ErrNotFound {
+		t.Fatalf("GetFeedIcon() = %v, wanted %v", err, ErrNotFound)
+	}
+	if err := store.SetFeedIconFetched(ctx, feedID,
+		time.Now()); err != ErrNotFound {
+		t.Fatalf("SetFeedIconFetched() = %v, wanted %v", err, ErrNotFound)
+	}
+
+	fetchTime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	want := FeedIcon{
+		FeedID:      feedID,
+		Data:        []byte("\x89PNG"),
+		ContentType: "image/png",
+		ETag:        `"abc"`,
+		FetchTime:   fetchTime,
+	}
+	if err := store.SetFeedIcon(ctx, want); err != nil {
+		t.Fatalf("SetFeedIcon() = error %s", err)
+	}
+
+	icon, err := store.GetFeedIcon(ctx, feedID)
+	if err != nil {
+		t.Fatalf("GetFeedIcon() = error %s", err)
+	}
+	if !reflect.DeepEqual(*icon, want) {
+		t.Errorf("GetFeedIcon() = %+v, wanted %+v", *icon, want)
+	}
+
+	want.FetchTime = fetchTime.Add(time.Hour)
+	if err := store.SetFeedIconFetched(ctx, feedID,
+		want.FetchTime); err != nil {
+		t.Fatalf("SetFeedIconFetched() = error %s", err)
+	}
+
+	want.Data = []byte("GIF89a")
+	want.ContentType = "image/gif"
+	want.ETag = ""
+	if err := store.SetFeedIcon(ctx, want); err != nil {
+		t.Fatalf("SetFeedIcon() = error %s", err)
+	}
+
+	icon, err = store.GetFeedIcon(ctx, feedID)
+	if err != nil {
+		t.Fatalf("GetFeedIcon() = error %s", err)
+	}
+	if !reflect.DeepEqual(*icon, want) {
+		t.Errorf("GetFeedIcon() = %+v, wanted %+v", *icon, want)
+	}
+
+	if err := store.SetFeedIcon(ctx, FeedIcon{FeedID: feedID,
+		ContentType: "image/png"}); err == nil {
+		t.Errorf("SetFeedIcon() with no data = success")
+	}
+}
+
+func TestReadAfterArchivesSQLite(t *testing.T) {
+	ctx := context.Background()
+
+	db, err := OpenDB(DBConfig{
+		Type: SQLite,
+		Name: filepath.Join(t.TempDir(), "gorse.db"),
+	})
+	if err != nil {
+		t.Fatalf("OpenDB() = error %s", err)
+	}
+	defer db.Close()
+
+	if _, err := Migrate(ctx, db, SQLite); err != nil {
+		t.Fatalf("Migrate() = error %s", err)
+	}
+
+	store := NewSQLStore(db, SQLite)
+	defer store.Close()
+
+	user, err := store.CreateUser(ctx, "user@example.com", "password", false)
+	if err != nil {
+		t.Fatalf("CreateUser() = error %s", err)
+	}
+
+	feedID, err := store.CreateFeed(ctx, DBFeed{
+		Name:                   "Example",
+		URI:                    "https://example.com/feed",
+		UpdateFrequencySeconds: 3600,
+		Active:                 true,
+	})
+	if err != nil {
+		t.Fatalf("CreateFeed() = error %s", err)
+	}
+
+	var ids []int64
+	for i := 0; i < 3; i++ {
+		id, err := store.AddItem(ctx, feedID, &Item{Item: rss.Item{
+			Title:   fmt.Sprintf("Item %d", i),
+			Link:    fmt.Sprintf("https://example.com/%d", i),
+			PubDate: time.Now(),
+		}})
+		if err != nil {
+			t.Fatalf("AddItem() = error %s", err)
+		}
+		ids = append(ids, id)
+
+		if err := store.RecordReadAfterReadLater(ctx, user.ID, &UserItem{
+			DBItem: DBItem{ID: id, RSSFeedID: feedID},
+		}); err != nil {
+			t.Fatalf("RecordReadAfterReadLater() = error %s", err)
+		}
+	}
+
+	count, err := store.CountReadAfterArchives(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("CountReadAfterArchives() = error %s", err)
+	}
+	if count != 3 {
+		t.Errorf("CountReadAfterArchives() = %d, wanted 3", count)
+	}
+
+	count, err = store.CountReadAfterArchives(ctx, user.ID+1)
+	if err != nil {
+		t.Fatalf("CountReadAfterArchives() = error %s", err)
+	}
+	if count != 0 {
+		t.Errorf("CountReadAfterArchives() of other user = %d, wanted 0", count)
+	}
+
+	// They're all recorded in the same second, so the most recently read is
+	// the one with the highest ID.
+	records, err := store.ReadAfterArchives(ctx, user.ID, 0, 0)
+	if err != nil {
+		t.Fatalf("ReadAfterArchives() = error %s", err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("ReadAfterArchives() = %d records, wanted 3", len(records))
+	}
+	for i, record := range records {
+		want := ids[len(ids)-1-i]
+		if record.ItemID != want || record.FeedID != feedID ||
+			record.UserID != user.ID || record.FeedName != "Example" ||
+			record.Title != fmt.Sprintf("Item %d", len(ids)-1-i) {
+			t.Errorf("ReadAfterArchives()[%d] = %+v, wanted item ID [%d]", i,
+				record, want)
+		}
+	}
+
+	records, err = store.ReadAfterArchives(ctx, user.ID, 2, 2)
+	if err != nil {
+		t.Fatalf("ReadAfterArchives() = error %s", err)
+	}
+	if len(records) != 1 || records[0].ItemID != ids[0] {
+		t.Errorf("ReadAfterArchives() second page = %+v, wanted item ID [%d]",
+			records, ids[0])
+	}
+
+	// Records outlive their items.
+	if _, err := db.ExecContext(ctx, `DELETE FROM rss_item WHERE id = $1`,
+		ids[0]); err != nil {
+		t.Fatalf("deleting item: %s", err)
+	}
+
+	records, err = store.ReadAfterArchives(ctx, user.ID, 1, 2)
+	if err != nil {
+		t.Fatalf("ReadAfterArchives() = error %s", err)
+	}
+	if len(records) != 1 || records[0].ItemID != ids[0] ||
+		records[0].Title != "" {
+		t.Errorf("ReadAfterArchives() of deleted item = %+v", records)
+	}
+}
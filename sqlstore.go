@@ -0,0 +1,1008 @@
+package gorse
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"time"
+)
+
+// SQLStore is a Store using a database. It works with each of the database
+// types we support.
+//
+// We prepare each query the first time we run it and reuse the statement after
+// that. This saves the database parsing and planning the queries we run over
+// and over again, such as checking whether items exist when polling.
+type SQLStore struct {
+	// db is what we run queries with. It runs them in the transaction if we're
+	// in one.
+	db cachedQuerier
+
+	// sqlDB is the database. It is nil if we're in a transaction.
+	sqlDB *sql.DB
+
+	// dbType is the database's type, Postgres or SQLite.
+	dbType string
+}
+
+// NewSQLStore creates a Store using the database. dbType is its type as for
+// DBConfig.
+//
+// Close the Store when done with it to release its prepared statements.
+func NewSQLStore(db *sql.DB, dbType string) *SQLStore {
+	return &SQLStore{
+		db:     cachedQuerier{cache: newStmtCache(db)},
+		sqlDB:  db,
+		dbType: dbType,
+	}
+}
+
+// Close releases the Store's prepared statements. It does not close the
+// database.
+func (s *SQLStore) Close() error {
+	return s.db.cache.close()
+}
+
+// SetRetryPolicy sets how we retry operations that fail for transient
+// reasons. By default we don't. Set it before using the Store.
+//
+// We retry queries outside of transactions individually and transactions as a
+// whole. We don't retry transactions run with InTx.
+func (s *SQLStore) SetRetryPolicy(policy RetryPolicy) {
+	s.db.retry = policy
+}
+
+// SetSlowQueryLog sets a function to tell about each query taking longer than
+// the threshold, such as to log it. By default we don't. Set it before using
+// the Store.
+func (s *SQLStore) SetSlowQueryLog(threshold time.Duration, fn SlowQueryFunc) {
+	s.db.slow = slowQueryLog{threshold: threshold, fn: fn}
+}
+
+// InTx runs the function with a Store where everything happens in one
+// transaction. See WithTx.
+//
+// If we're already in a transaction, the function runs as part of it.
+//
+// We don't retry the transaction if it fails as we don't know that the
+// function is safe to run again.
+func (s *SQLStore) InTx(ctx context.Context, fn func(Store) error) error {
+	if s.sqlDB == nil {
+		return fn(s)
+	}
+	return s.runTx(ctx, nil, func(tx *SQLStore) error { return fn(tx) })
+}
+
+// inTx runs the function in a transaction as InTx does. If a query in the
+// transaction fails for a transient reason, we retry the transaction as our
+// retry policy says. The function must be safe to run again.
+func (s *SQLStore) inTx(ctx context.Context, fn func(*SQLStore) error) error {
+	if s.sqlDB == nil {
+		return fn(s)
+	}
+
+	var transient bool
+	return s.db.retry.run(ctx, func() error {
+		transient = false
+		return s.runTx(ctx, &transient, fn)
+	}, func(error) bool { return transient })
+}
+
+// runTx runs the function in a transaction. If a query in it fails for a
+// transient reason, we set transient.
+func (s *SQLStore) runTx(ctx context.Context, transient *bool,
+	fn func(*SQLStore) error) error {
+	return WithTx(ctx, s.sqlDB, func(tx *sql.Tx) error {
+		return fn(&SQLStore{
+			db: cachedQuerier{
+				cache:     s.db.cache,
+				tx:        tx,
+				transient: transient,
+				slow:      s.db.slow,
+			},
+			dbType: s.dbType,
+		})
+	})
+}
+
+// audited runs the function in a transaction and records the action in the
+// audit log if it succeeds. The function returns the action's details.
+func (s *SQLStore) audited(ctx context.Context, action string,
+	fn func(*SQLStore) (string, error)) error {
+	return s.inTx(ctx, func(tx *SQLStore) error {
+		details, err := fn(tx)
+		if err != nil {
+			return err
+		}
+		return RecordAudit(ctx, tx.db, action, details)
+	})
+}
+
+// AddItem records a new item from a feed. It happens in a transaction along
+// with counting the item unread.
+func (s *SQLStore) AddItem(ctx context.Context, feedID int64,
+	item *Item) (int64, error) {
+	var id int64
+	if err := s.inTx(ctx, func(tx *SQLStore) error {
+		var err error
+		id, err = addItem(ctx, tx.db, feedID, item)
+		return err
+	}); err != nil {
+		return -1, err
+	}
+
+	return id, nil
+}
+
+// UpsertItem adds the item to the feed or updates the one we have to match
+// it. It happens in a transaction along with counting a new item unread.
+func (s *SQLStore) UpsertItem(ctx context.Context, feedID int64,
+	item *Item) (int64, UpsertResult, error) {
+	var id int64
+	var result UpsertResult
+	if err := s.inTx(ctx, func(tx *SQLStore) error {
+		var err error
+		id, result, err = UpsertItem(ctx, tx.db, feedID, item)
+		return err
+	}); err != nil {
+		return -1, ItemUnchanged, err
+	}
+
+	return id, result, nil
+}
+
+// GetReaderView retrieves the reader view of the item.
+func (s *SQLStore) GetReaderView(ctx context.Context,
+	itemID int64) (*ReaderView, error) {
+	return GetReaderView(ctx, s.db, itemID)
+}
+
+// SetReaderView records the reader view.
+func (s *SQLStore) SetReaderView(ctx context.Context, view ReaderView) error {
+	return SetReaderView(ctx, s.db, view)
+}
+
+// FullTextContents retrieves the articles we fetched for the items of feeds
+// in full text mode.
+func (s *SQLStore) FullTextContents(ctx context.Context,
+	itemIDs []int64) (map[int64]string, error) {
+	return FullTextContents(ctx, s.db, itemIDs)
+}
+
+// ItemEnclosures retrieves the enclosures of the items.
+func (s *SQLStore) ItemEnclosures(ctx context.Context,
+	itemIDs []int64) (map[int64][]Enclosure, error) {
+	return ItemEnclosures(ctx, s.db, itemIDs)
+}
+
+// ItemCategories retrieves the categories of the items.
+func (s *SQLStore) ItemCategories(ctx context.Context,
+	itemIDs []int64) (map[int64][]string, error) {
+	return ItemCategories(ctx, s.db, itemIDs)
+}
+
+// GetItem retrieves an item along with its state for the user.
+func (s *SQLStore) GetItem(ctx context.Context, itemID int64,
+	userID int) (*UserItem, error) {
+	query := `
+SELECT
+ri.id,
+ri.title,
+ri.description,
+ri.link,
+ri.publication_date,
+ri.guid,
+ri.rss_feed_id,
+rf.name,
+COALESCE(ris.state, 'unread'),
+COALESCE(ris.note, ''),
+` + itemUnsharedSQL + `,
+` + itemStarredSQL + `
+FROM rss_item ri
+JOIN rss_feed rf ON ri.rss_feed_id = rf.id
+LEFT JOIN rss_item_state ris ON ris.item_id = ri.id AND ris.user_id = $1
+WHERE ri.id = $2
+`
+
+	item := &UserItem{}
+	var state string
+	if err := s.db.QueryRowContext(ctx, query, userID, itemID).Scan(
+		&item.ID,
+		&item.Title,
+		&item.Description,
+		&item.Link,
+		&item.PublicationDate,
+		&item.GUID,
+		&item.RSSFeedID,
+		&item.FeedName,
+		&state,
+		&item.Note,
+		&item.Unshared,
+		&item.Starred,
+	); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to scan row: %s", err)
+	}
+
+	readState, err := ParseReadState(state)
+	if err != nil {
+		return nil, err
+	}
+	item.ReadState = readState
+
+	return item, nil
+}
+
+// FindItemByLink retrieves an item by feed and link.
+func (s *SQLStore) FindItemByLink(ctx context.Context, feedID int64,
+	link string) (*DBItem, error) {
+	return FindItemByLink(ctx, s.db, feedID, link)
+}
+
+// ItemExistsByLink checks whether the feed has an item with the link.
+func (s *SQLStore) ItemExistsByLink(ctx context.Context, feedID int64,
+	link string) (bool, error) {
+	query := `SELECT id FROM rss_item WHERE rss_feed_id = $1 AND link = $2`
+	count, err := countRowsProduced(ctx, s.db, query, feedID, link)
+	if err != nil {
+		return false, fmt.Errorf("unable to query rss_item: %s", err)
+	}
+
+	return count > 0, nil
+}
+
+// ItemExistsByGUID checks whether the feed has an item with the GUID.
+func (s *SQLStore) ItemExistsByGUID(ctx context.Context, feedID int64,
+	guid string) (bool, error) {
+	query := `SELECT id FROM rss_item WHERE rss_feed_id = $1 AND guid = $2`
+	count, err := countRowsProduced(ctx, s.db, query, feedID, guid)
+	if err != nil {
+		return false, fmt.Errorf("unable to query rss_item: %s", err)
+	}
+
+	return count > 0, nil
+}
+
+// NewestItemTime finds the publication date of the feed's newest item.
+func (s *SQLStore) NewestItemTime(ctx context.Context,
+	feedID int64) (time.Time, error) {
+	// Not MAX() as SQLite then gives us a string rather than a time.
+	query := `
+SELECT publication_date FROM rss_item
+WHERE rss_feed_id = $1
+ORDER BY publication_date DESC
+LIMIT 1
+`
+
+	var newestTime time.Time
+	err := s.db.QueryRowContext(ctx, query, feedID).Scan(&newestTime)
+	if err == sql.ErrNoRows {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{},
+			fmt.Errorf("failed to query for newest publication date: %s", err)
+	}
+
+	return newestTime, nil
+}
+
+// FindItems retrieves the items matching the filter, newest first.
+func (s *SQLStore) FindItems(ctx context.Context,
+	filter ItemFilter) ([]UserItem, error) {
+	return FindItems(ctx, s.db, s.dbType, filter)
+}
+
+// RelatedItems retrieves items that share words with the item, best matches
+// first.
+func (s *SQLStore) RelatedItems(ctx context.Context, item UserItem, userID,
+	limit int) ([]UserItem, error) {
+	return RelatedItems(ctx, s.db, s.dbType, item, userID, limit)
+}
+
+// SearchItems retrieves the items matching the filter, best matches first.
+func (s *SQLStore) SearchItems(ctx context.Context,
+	filter ItemFilter) ([]UserItem, error) {
+	return SearchItems(ctx, s.db, s.dbType, filter)
+}
+
+// CountItems counts the items matching the filter.
+func (s *SQLStore) CountItems(ctx context.Context, filter ItemFilter) (int,
+	error) {
+	return CountItems(ctx, s.db, s.dbType, filter)
+}
+
+// SetItemsArchived records that we marked the items read because their feed
+// was in archive mode.
+func (s *SQLStore) SetItemsArchived(ctx context.Context,
+	itemIDs []int64) error {
+	return SetItemsArchived(ctx, s.db, itemIDs)
+}
+
+// Digest summarizes the items matching the filter by feed.
+func (s *SQLStore) Digest(ctx context.Context, filter ItemFilter,
+	perFeed int) ([]DigestFeed, error) {
+	return Digest(ctx, s.db, s.dbType, filter, perFeed)
+}
+
+// UnreadCounts counts the user's unread items published after since by feed.
+func (s *SQLStore) UnreadCounts(ctx context.Context, userID int,
+	since time.Time) (map[int64]int, error) {
+	return UnreadCounts(ctx, s.db, s.dbType, userID, since)
+}
+
+// ActiveFeeds retrieves the feeds to poll ordered by name.
+func (s *SQLStore) ActiveFeeds(ctx context.Context) ([]DBFeed, error) {
+	query := `
+SELECT
+id, name, uri, update_frequency_seconds, last_update_time, archive, active,
+deleted, etag, last_modified, full_text
+FROM rss_feed
+WHERE active = true AND deleted = false
+ORDER BY name
+`
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query for feeds: %s", err)
+	}
+
+	var feeds []DBFeed
+
+	for rows.Next() {
+		feed, err := scanFeed(rows)
+		if err != nil {
+			_ = rows.Close()
+			return nil, fmt.Errorf("failed to scan row: %s", err)
+		}
+
+		feeds = append(feeds, *feed)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failure fetching rows: %s", err)
+	}
+
+	return feeds, nil
+}
+
+// DeleteFeed deletes the feed, doing what retention says with its items. It
+// happens in a transaction.
+func (s *SQLStore) DeleteFeed(ctx context.Context, feedID int64,
+	retention ItemRetention) error {
+	return s.audited(ctx, AuditFeedDelete, func(tx *SQLStore) (string, error) {
+		// Not using prepared statements as archiving sets states with queries
+		// differing depending on how many items there are.
+		if err := DeleteFeed(ctx, tx.db.uncached(), feedID,
+			retention); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("feed ID [%d], %s items", feedID, retention), nil
+	})
+}
+
+// RestoreFeed undoes deleting the feed.
+func (s *SQLStore) RestoreFeed(ctx context.Context, feedID int64) error {
+	return s.audited(ctx, AuditFeedRestore, func(tx *SQLStore) (string, error) {
+		return fmt.Sprintf("feed ID [%d]", feedID),
+			RestoreFeed(ctx, tx.db, feedID)
+	})
+}
+
+// FeedRetention retrieves the feed's retention policy.
+func (s *SQLStore) FeedRetention(ctx context.Context,
+	feedID int64) (RetentionPolicy, error) {
+	return FeedRetention(ctx, s.db, feedID)
+}
+
+// FeedRetentions retrieves the retention policies of the feeds that don't keep
+// their items forever.
+func (s *SQLStore) FeedRetentions(
+	ctx context.Context) (map[int64]RetentionPolicy, error) {
+	return FeedRetentions(ctx, s.db)
+}
+
+// SetFeedRetention sets the feed's retention policy.
+func (s *SQLStore) SetFeedRetention(ctx context.Context, feedID int64,
+	policy RetentionPolicy) error {
+	return s.audited(ctx, AuditFeedRetention, func(tx *SQLStore) (string,
+		error) {
+		return fmt.Sprintf("feed ID [%d]: %s", feedID, policy),
+			SetFeedRetention(ctx, tx.db, feedID, policy)
+	})
+}
+
+// SetFeedArchive sets whether the feed is in archive mode.
+func (s *SQLStore) SetFeedArchive(ctx context.Context, feedID int64,
+	archive bool) error {
+	return s.audited(ctx, AuditFeedArchive, func(tx *SQLStore) (string,
+		error) {
+		return fmt.Sprintf("feed ID [%d]: %t", feedID, archive),
+			SetFeedArchive(ctx, tx.db, feedID, archive)
+	})
+}
+
+// SetFeedFullText sets whether we fetch the articles of the feed's new items.
+func (s *SQLStore) SetFeedFullText(ctx context.Context, feedID int64,
+	fullText bool) error {
+	return s.audited(ctx, AuditFeedFullText, func(tx *SQLStore) (string,
+		error) {
+		return fmt.Sprintf("feed ID [%d]: %t", feedID, fullText),
+			SetFeedFullText(ctx, tx.db, feedID, fullText)
+	})
+}
+
+// SetFeedUpdateFrequency sets how often in seconds we poll the feed.
+func (s *SQLStore) SetFeedUpdateFrequency(ctx context.Context, feedID int64,
+	seconds int64) error {
+	return s.audited(ctx, AuditFeedFrequency, func(tx *SQLStore) (string,
+		error) {
+		return fmt.Sprintf("feed ID [%d]: %d seconds", feedID, seconds),
+			SetFeedUpdateFrequency(ctx, tx.db, feedID, seconds)
+	})
+}
+
+// GetFeedByURI retrieves the feed with the URI.
+func (s *SQLStore) GetFeedByURI(ctx context.Context, uri string) (*DBFeed,
+	error) {
+	return GetFeedByURI(ctx, s.db, uri)
+}
+
+// CreateFeed adds a feed.
+func (s *SQLStore) CreateFeed(ctx context.Context, feed DBFeed) (int64,
+	error) {
+	var id int64
+	if err := s.audited(ctx, AuditFeedCreate, func(tx *SQLStore) (string,
+		error) {
+		var err error
+		if id, err = CreateFeed(ctx, tx.db, feed); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("feed ID [%d]: %s (%s)", id, feed.Name, feed.URI), nil
+	}); err != nil {
+		return -1, err
+	}
+
+	return id, nil
+}
+
+// UpdateFeed changes the feed with the feed's ID to match it.
+func (s *SQLStore) UpdateFeed(ctx context.Context, feed DBFeed) error {
+	return s.audited(ctx, AuditFeedUpdate, func(tx *SQLStore) (string, error) {
+		return fmt.Sprintf("feed ID [%d]: %s (%s)", feed.ID, feed.Name,
+			feed.URI), UpdateFeed(ctx, tx.db, feed)
+	})
+}
+
+// DeactivateFeed stops the feed being polled.
+func (s *SQLStore) DeactivateFeed(ctx context.Context, feedID int64) error {
+	return s.audited(ctx, AuditFeedDeactivate, func(tx *SQLStore) (string,
+		error) {
+		return fmt.Sprintf("feed ID [%d]", feedID),
+			DeactivateFeed(ctx, tx.db, feedID)
+	})
+}
+
+// SetFeedPayload records the payload we last fetched for the feed.
+func (s *SQLStore) SetFeedPayload(ctx context.Context, feedID int64,
+	payload []byte) error {
+	query := `UPDATE rss_feed SET last_payload = $1 WHERE id = $2`
+
+	if _, err := s.db.ExecContext(ctx, query, payload, feedID); err != nil {
+		return fmt.Errorf("failed to record payload for feed ID [%d]: %s", feedID,
+			err)
+	}
+
+	return nil
+}
+
+// SetFeedUpdated records when we last polled the feed. Polling it succeeded,
+// so it no longer has errors.
+func (s *SQLStore) SetFeedUpdated(ctx context.Context, feedID int64,
+	updateTime time.Time) error {
+	query := `
+UPDATE rss_feed SET last_update_time = $1, error_count = 0, last_error = ''
+WHERE id = $2
+`
+
+	if _, err := s.db.ExecContext(ctx, query, updateTime.UTC(),
+		feedID); err != nil {
+		return fmt.Errorf("failed to record feed update for feed ID [%d]: %s",
+			feedID, err)
+	}
+
+	return nil
+}
+
+// SetFeedError records that polling the feed failed and why.
+func (s *SQLStore) SetFeedError(ctx context.Context, feedID int64,
+	message string) error {
+	return SetFeedError(ctx, s.db, feedID, message)
+}
+
+// SetFeedValidators records the ETag and Last-Modified headers the feed was
+// served with.
+func (s *SQLStore) SetFeedValidators(ctx context.Context, feedID int64, etag,
+	lastModified string) error {
+	return SetFeedValidators(ctx, s.db, feedID, etag, lastModified)
+}
+
+// GetFeedIcon retrieves the feed's icon.
+func (s *SQLStore) GetFeedIcon(ctx context.Context, feedID int64) (*FeedIcon,
+	error) {
+	return GetFeedIcon(ctx, s.db, feedID)
+}
+
+// SetFeedIcon records the icon, replacing any the feed had.
+func (s *SQLStore) SetFeedIcon(ctx context.Context, icon FeedIcon) error {
+	return SetFeedIcon(ctx, s.db, icon)
+}
+
+// SetFeedIconFetched records that we fetched the feed's icon at the time and
+// found it hadn't changed.
+func (s *SQLStore) SetFeedIconFetched(ctx context.Context, feedID int64,
+	fetchTime time.Time) error {
+	return SetFeedIconFetched(ctx, s.db, feedID, fetchTime)
+}
+
+// SetItemReadState sets the item's read state for the user. It happens in a
+// transaction so that the state history is right.
+func (s *SQLStore) SetItemReadState(ctx context.Context, itemID int64,
+	userID int, state ReadState) error {
+	return s.inTx(ctx, func(tx *SQLStore) error {
+		return DBSetItemReadState(ctx, tx.db, itemID, userID, state)
+	})
+}
+
+// SetItemsReadState sets the read state of each of the items for the user. It
+// happens in a transaction so that the state history is right.
+//
+// If a user is acting (see WithActor), we record it in the audit log. We don't
+// record the states we set ourselves, such as when polling.
+func (s *SQLStore) SetItemsReadState(ctx context.Context, itemIDs []int64,
+	userID int, state ReadState) error {
+	return s.inTx(ctx, func(tx *SQLStore) error {
+		// Not using prepared statements as the queries differ depending on how
+		// many items there are.
+		if err := DBSetItemsReadState(ctx, tx.db.uncached(), itemIDs, userID,
+			state); err != nil {
+			return err
+		}
+
+		if actor(ctx) == 0 {
+			return nil
+		}
+		return RecordAudit(ctx, tx.db, AuditItemStates, fmt.Sprintf(
+			"%d items set %s for user ID [%d]", len(itemIDs), state, userID))
+	})
+}
+
+// MarkAllRead sets all of the user's unread items read. It happens in a
+// transaction so that the state history and unread counts are right.
+func (s *SQLStore) MarkAllRead(ctx context.Context, userID int, feedID int64,
+	until time.Time) (int64, error) {
+	var count int64
+	if err := s.audited(ctx, AuditItemStates, func(tx *SQLStore) (string,
+		error) {
+		// Not using prepared statements as the queries differ depending on the
+		// feed and cutoff.
+		var err error
+		if count, err = MarkAllRead(ctx, tx.db.uncached(), tx.dbType, userID,
+			feedID, until); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%d items set %s for user ID [%d]", count, Read,
+			userID), nil
+	}); err != nil {
+		return -1, err
+	}
+
+	return count, nil
+}
+
+// SetItemNote sets the user's note on the item.
+func (s *SQLStore) SetItemNote(ctx context.Context, itemID int64, userID int,
+	note string) error {
+	return SetItemNote(ctx, s.db, itemID, userID, note)
+}
+
+// StateChanges retrieves the user's most recent state changes.
+func (s *SQLStore) StateChanges(ctx context.Context, userID,
+	limit int) ([]StateChange, error) {
+	return StateChanges(ctx, s.db, userID, limit)
+}
+
+// RecentlyRead retrieves the items the user most recently marked read.
+func (s *SQLStore) RecentlyRead(ctx context.Context, userID,
+	limit int) ([]ReadItem, error) {
+	return RecentlyRead(ctx, s.db, userID, limit)
+}
+
+// RecordReadAfterReadLater records that the user read an item they saved to
+// read later.
+//
+// It is useful to be able to refer back to such items as it is likely they were
+// looked at more closely than others.
+func (s *SQLStore) RecordReadAfterReadLater(ctx context.Context, userID int,
+	item *UserItem) error {
+	query := `
+INSERT INTO rss_item_read_after_archive
+(user_id, rss_feed_id, rss_item_id)
+VALUES ($1, $2, $3)
+`
+	if _, err := s.db.ExecContext(ctx, query, userID, item.RSSFeedID,
+		item.ID); err != nil {
+		return fmt.Errorf("unable to insert: %s", err)
+	}
+
+	return nil
+}
+
+// ReadAfterArchives retrieves the items the user read after saving them to
+// read later.
+func (s *SQLStore) ReadAfterArchives(ctx context.Context, userID, limit,
+	offset int) ([]ReadAfterArchive, error) {
+	return ReadAfterArchives(ctx, s.db, userID, limit, offset)
+}
+
+// CountReadAfterArchives counts the items the user read after saving them to
+// read later.
+func (s *SQLStore) CountReadAfterArchives(ctx context.Context,
+	userID int) (int, error) {
+	return CountReadAfterArchives(ctx, s.db, userID)
+}
+
+// GetUser retrieves a user by ID.
+func (s *SQLStore) GetUser(ctx context.Context, id int) (*User, error) {
+	return GetUser(ctx, s.db, id)
+}
+
+// CreateUser creates a user with the password. It happens in a transaction
+// along with counting the user's unread items.
+func (s *SQLStore) CreateUser(ctx context.Context, email, password string,
+	admin bool) (*User, error) {
+	var user *User
+	if err := s.inTx(ctx, func(tx *SQLStore) error {
+		var err error
+		// Not using prepared statements as counting the user's unread items
+		// inserts differing numbers of counts.
+		if user, err = CreateUser(ctx, tx.db.uncached(), email, password,
+			admin); err != nil {
+			return err
+		}
+		return RecordAudit(ctx, tx.db, AuditUserCreate, fmt.Sprintf(
+			"user ID [%d]: %s, admin %t", user.ID, user.Email, user.Admin))
+	}); err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// AuthenticateUser checks the email and password belong to a user.
+func (s *SQLStore) AuthenticateUser(ctx context.Context, email,
+	password string) (*User, error) {
+	return AuthenticateUser(ctx, s.db, email, password)
+}
+
+// UpdatePassword sets the user's password.
+func (s *SQLStore) UpdatePassword(ctx context.Context, userID int,
+	password string) error {
+	return s.audited(ctx, AuditUserPassword, func(tx *SQLStore) (string,
+		error) {
+		return fmt.Sprintf("user ID [%d]", userID),
+			UpdatePassword(ctx, tx.db, userID, password)
+	})
+}
+
+// UpdateLocale sets the user's locale and whether they see relative dates.
+func (s *SQLStore) UpdateLocale(ctx context.Context, userID int, locale string,
+	relativeDates bool) error {
+	return UpdateLocale(ctx, s.db, userID, locale, relativeDates)
+}
+
+// UpdateShareEmail sets where the user emails items they share.
+func (s *SQLStore) UpdateShareEmail(ctx context.Context, userID int,
+	email string) error {
+	return UpdateShareEmail(ctx, s.db, userID, email)
+}
+
+// UpdateKindleEmail sets where we email books of the user's items to read
+// later.
+func (s *SQLStore) UpdateKindleEmail(ctx context.Context, userID int,
+	email string) error {
+	return UpdateKindleEmail(ctx, s.db, userID, email)
+}
+
+// UpdateCompactList sets whether the user's lists show items as one line
+// each.
+func (s *SQLStore) UpdateCompactList(ctx context.Context, userID int,
+	compact bool) error {
+	return UpdateCompactList(ctx, s.db, userID, compact)
+}
+
+// SetShareToken sets the token in the URL of the feed of items the user
+// starred.
+func (s *SQLStore) SetShareToken(ctx context.Context, userID int,
+	token string) error {
+	return SetShareToken(ctx, s.db, userID, token)
+}
+
+// UserByShareToken retrieves the user publishing the feed with the token.
+func (s *SQLStore) UserByShareToken(ctx context.Context, token string) (*User,
+	error) {
+	return UserByShareToken(ctx, s.db, token)
+}
+
+// SetItemShared sets whether the item is in the feed of items the user
+// starred.
+func (s *SQLStore) SetItemShared(ctx context.Context, itemID int64,
+	userID int, shared bool) error {
+	return SetItemShared(ctx, s.db, itemID, userID, shared)
+}
+
+// GetReadingPosition retrieves where the user was in the view.
+func (s *SQLStore) GetReadingPosition(ctx context.Context, userID int,
+	view string) (*ReadingPosition, error) {
+	return GetReadingPosition(ctx, s.db, userID, view)
+}
+
+// SetReadingPosition records where the user is in the view.
+func (s *SQLStore) SetReadingPosition(ctx context.Context,
+	position ReadingPosition) error {
+	return SetReadingPosition(ctx, s.db, position)
+}
+
+// SetItemStarred stars or unstars the item for the user.
+func (s *SQLStore) SetItemStarred(ctx context.Context, itemID int64,
+	userID int, starred bool) error {
+	return SetItemStarred(ctx, s.db, itemID, userID, starred)
+}
+
+// AddItemTag tags the item for the user.
+func (s *SQLStore) AddItemTag(ctx context.Context, itemID int64, userID int,
+	tag string) error {
+	return AddItemTag(ctx, s.db, itemID, userID, tag)
+}
+
+// RemoveItemTag removes the tag from the item for the user.
+func (s *SQLStore) RemoveItemTag(ctx context.Context, itemID int64,
+	userID int, tag string) error {
+	return RemoveItemTag(ctx, s.db, itemID, userID, tag)
+}
+
+// ItemTags retrieves the user's tags on the items.
+func (s *SQLStore) ItemTags(ctx context.Context, userID int,
+	itemIDs []int64) (map[int64][]string, error) {
+	return ItemTags(ctx, s.db, userID, itemIDs)
+}
+
+// ListTags retrieves the user's tags along with how many items have each.
+func (s *SQLStore) ListTags(ctx context.Context, userID int) ([]TagCount,
+	error) {
+	return ListTags(ctx, s.db, userID)
+}
+
+// SharedItems retrieves the items in the feed of items the user starred.
+func (s *SQLStore) SharedItems(ctx context.Context, userID,
+	limit int) ([]UserItem, error) {
+	return SharedItems(ctx, s.db, userID, limit)
+}
+
+// AuditLog retrieves the most recent actions in the audit log.
+func (s *SQLStore) AuditLog(ctx context.Context, limit int) ([]AuditEntry,
+	error) {
+	return AuditLog(ctx, s.db, limit)
+}
+
+// ListUsers retrieves all users ordered by email.
+func (s *SQLStore) ListUsers(ctx context.Context) ([]User, error) {
+	return ListUsers(ctx, s.db)
+}
+
+// ExportUser writes all of the user's data as JSON.
+func (s *SQLStore) ExportUser(ctx context.Context, userID int,
+	w io.Writer) error {
+	return ExportUser(ctx, s.db, userID, w)
+}
+
+// SavedFeed retrieves the ID of the feed holding the links the user saved,
+// creating it if they don't have one. It happens in a transaction along with
+// subscribing them to it.
+func (s *SQLStore) SavedFeed(ctx context.Context, userID int) (int64, error) {
+	var id int64
+	if err := s.inTx(ctx, func(tx *SQLStore) error {
+		var err error
+		id, err = SavedFeed(ctx, tx.db, userID)
+		return err
+	}); err != nil {
+		return -1, err
+	}
+
+	return id, nil
+}
+
+// Subscribe subscribes the user to the feed.
+func (s *SQLStore) Subscribe(ctx context.Context, userID int,
+	feedID int64) error {
+	return Subscribe(ctx, s.db, userID, feedID)
+}
+
+// Unsubscribe unsubscribes the user from the feed.
+func (s *SQLStore) Unsubscribe(ctx context.Context, userID int,
+	feedID int64) error {
+	return Unsubscribe(ctx, s.db, userID, feedID)
+}
+
+// ListSubscriptions retrieves the feeds the user subscribes to.
+func (s *SQLStore) ListSubscriptions(ctx context.Context, userID int) ([]DBFeed,
+	error) {
+	return ListSubscriptions(ctx, s.db, userID)
+}
+
+// SubscriptionStats describes the items of each feed the user subscribes to.
+func (s *SQLStore) SubscriptionStats(ctx context.Context,
+	userID int) (map[int64]FeedStats, error) {
+	return SubscriptionStats(ctx, s.db, userID)
+}
+
+// FeedOverview retrieves summaries of the feeds the user subscribes to in the
+// order.
+func (s *SQLStore) FeedOverview(ctx context.Context, userID int,
+	sort FeedSort, limit, offset int) ([]FeedSummary, error) {
+	return FeedOverview(ctx, s.db, userID, sort, limit, offset)
+}
+
+// CountSubscriptions counts the feeds the user subscribes to.
+func (s *SQLStore) CountSubscriptions(ctx context.Context,
+	userID int) (int, error) {
+	return CountSubscriptions(ctx, s.db, userID)
+}
+
+// CountFailingFeeds counts the user's feeds that keep failing to poll.
+func (s *SQLStore) CountFailingFeeds(ctx context.Context, userID,
+	minErrors int) (int, error) {
+	return CountFailingFeeds(ctx, s.db, userID, minErrors)
+}
+
+// FeedSubscribers retrieves the IDs of the users subscribed to the feed.
+func (s *SQLStore) FeedSubscribers(ctx context.Context, feedID int64) ([]int,
+	error) {
+	return FeedSubscribers(ctx, s.db, feedID)
+}
+
+// SetFeedDisplay sets how the user's lists show items from the feed.
+func (s *SQLStore) SetFeedDisplay(ctx context.Context, userID int,
+	feedID int64, mode DisplayMode) error {
+	return SetFeedDisplay(ctx, s.db, userID, feedID, mode)
+}
+
+// FeedDisplayModes retrieves how the user's lists show items from the feeds
+// they subscribe to.
+func (s *SQLStore) FeedDisplayModes(ctx context.Context,
+	userID int) (map[int64]DisplayMode, error) {
+	return FeedDisplayModes(ctx, s.db, userID)
+}
+
+// ListIntegrations retrieves the user's integrations ordered by service.
+func (s *SQLStore) ListIntegrations(ctx context.Context,
+	userID int) ([]Integration, error) {
+	return ListIntegrations(ctx, s.db, userID)
+}
+
+// GetIntegration retrieves the user's integration with the service.
+func (s *SQLStore) GetIntegration(ctx context.Context, userID int,
+	service string) (*Integration, error) {
+	return GetIntegration(ctx, s.db, userID, service)
+}
+
+// SetIntegration records the integration.
+func (s *SQLStore) SetIntegration(ctx context.Context,
+	integration Integration) error {
+	return SetIntegration(ctx, s.db, integration)
+}
+
+// DeleteIntegration removes the user's integration with the service.
+func (s *SQLStore) DeleteIntegration(ctx context.Context, userID int,
+	service string) error {
+	return DeleteIntegration(ctx, s.db, userID, service)
+}
+
+// AddNotifier records the notifier.
+func (s *SQLStore) AddNotifier(ctx context.Context, n Notifier) (int64,
+	error) {
+	return AddNotifier(ctx, s.db, n)
+}
+
+// ListNotifiers retrieves the user's notifiers.
+func (s *SQLStore) ListNotifiers(ctx context.Context,
+	userID int) ([]Notifier, error) {
+	return ListNotifiers(ctx, s.db, userID)
+}
+
+// FeedNotifiers retrieves the notifiers that post the feed's new items.
+func (s *SQLStore) FeedNotifiers(ctx context.Context,
+	feedID int64) ([]Notifier, error) {
+	return FeedNotifiers(ctx, s.db, feedID)
+}
+
+// DeleteNotifier removes the user's notifier.
+func (s *SQLStore) DeleteNotifier(ctx context.Context, userID int,
+	id int64) error {
+	return DeleteNotifier(ctx, s.db, userID, id)
+}
+
+// MuteKeyword mutes the phrase for the user.
+func (s *SQLStore) MuteKeyword(ctx context.Context, userID int, phrase string,
+	isRegexp, markRead bool) error {
+	return MuteKeyword(ctx, s.db, userID, phrase, isRegexp, markRead)
+}
+
+// UnmuteKeyword stops muting the phrase for the user.
+func (s *SQLStore) UnmuteKeyword(ctx context.Context, userID int,
+	phrase string) error {
+	return UnmuteKeyword(ctx, s.db, userID, phrase)
+}
+
+// ListMutedKeywords retrieves the phrases the user muted.
+func (s *SQLStore) ListMutedKeywords(ctx context.Context,
+	userID int) ([]MutedKeyword, error) {
+	return ListMutedKeywords(ctx, s.db, userID)
+}
+
+// AddRule validates the rule and records it.
+func (s *SQLStore) AddRule(ctx context.Context, rule Rule) (int64, error) {
+	return AddRule(ctx, s.db, rule)
+}
+
+// ListRules retrieves the user's rules.
+func (s *SQLStore) ListRules(ctx context.Context, userID int) ([]Rule,
+	error) {
+	return ListRules(ctx, s.db, userID)
+}
+
+// DeleteRule removes the user's rule.
+func (s *SQLStore) DeleteRule(ctx context.Context, userID int,
+	id int64) error {
+	return DeleteRule(ctx, s.db, userID, id)
+}
+
+// AddHighlight highlights the phrase for the user.
+func (s *SQLStore) AddHighlight(ctx context.Context, userID int,
+	phrase string) error {
+	return AddHighlight(ctx, s.db, userID, phrase)
+}
+
+// RemoveHighlight stops highlighting the phrase for the user.
+func (s *SQLStore) RemoveHighlight(ctx context.Context, userID int,
+	phrase string) error {
+	return RemoveHighlight(ctx, s.db, userID, phrase)
+}
+
+// ListHighlights retrieves the phrases the user highlights.
+func (s *SQLStore) ListHighlights(ctx context.Context,
+	userID int) ([]Highlight, error) {
+	return ListHighlights(ctx, s.db, userID)
+}
+
+// countRowsProduced executes a query and counts how many rows it returns.
+func countRowsProduced(ctx context.Context, db Querier, query string,
+	params ...interface{}) (int, error) {
+	rows, err := db.QueryContext(ctx, query, params...)
+	if err != nil {
+		return -1, fmt.Errorf("query failed: %s", err)
+	}
+
+	count := 0
+	for rows.Next() {
+		count++
+	}
+
+	if err := rows.Err(); err != nil {
+		return -1, fmt.Errorf("failure fetching rows: %s", err)
+	}
+
+	return count, nil
+}
@@ -0,0 +1,56 @@
+package gorse
+
+import (
+	"context"
+	"fmt"
+)
+
+// Users may star items to keep them. Starring is apart from the read state,
+// so saving items to read later stays a queue to work through. Starred items
+// are kept when pruning items, including when deleting a feed along with its
+// items.
+
+// SetItemStarred stars or unstars the item for the user. Starring an item
+// already starred, or unstarring one not starred, does nothing. It returns
+// ErrNotFound if there is no such item.
+func SetItemStarred(ctx context.Context, db Querier, itemID int64, userID int,
+	starred bool) error {
+	if !starred {
+		query := `DELETE FROM rss_item_star WHERE user_id = $1 AND item_id = $2`
+		if _, err := db.ExecContext(ctx, query, userID, itemID); err != nil {
+			return fmt.Errorf("unable to unstar item %d: %s", itemID, err)
+		}
+		return nil
+	}
+
+	query := `
+INSERT INTO rss_item_star (user_id, item_id)
+SELECT $1, id FROM rss_item WHERE id = $2
+ON CONFLICT (user_id, item_id) DO NOTHING
+`
+
+	result, err := db.ExecContext(ctx, query, userID, itemID)
+	if err != nil {
+		return fmt.Errorf("unable to star item %d: %s", itemID, err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("unable to check rows affected: %s", err)
+	}
+	if rows > 0 {
+		return nil
+	}
+
+	// Either it was starred already or there's no such item.
+	var exists bool
+	if err := db.QueryRowContext(ctx,
+		`SELECT EXISTS (SELECT 1 FROM rss_item WHERE id = $1)`,
+		itemID).Scan(&exists); err != nil {
+		return fmt.Errorf("unable to look up item %d: %s", itemID, err)
+	}
+	if !exists {
+		return ErrNotFound
+	}
+
+	return nil
+}
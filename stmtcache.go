@@ -0,0 +1,255 @@
+package gorse
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// stmtCache holds prepared statements so we prepare each query only once
+// rather than every time we run it.
+//
+// database/sql takes care of preparing a statement again on each connection
+// it gets used on.
+type stmtCache struct {
+	db *sql.DB
+
+	mutex sync.Mutex
+	stmts map[string]*sql.Stmt
+}
+
+func newStmtCache(db *sql.DB) *stmtCache {
+	return &stmtCache{
+		db:    db,
+		stmts: map[string]*sql.Stmt{},
+	}
+}
+
+// prepare returns the prepared statement for the query, preparing it if this
+// is the first time we've seen it.
+func (c *stmtCache) prepare(ctx context.Context, query string) (*sql.Stmt,
+	error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if stmt, ok := c.stmts[query]; ok {
+		return stmt, nil
+	}
+
+	stmt, err := c.db.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("unable to prepare statement: %s", err)
+	}
+
+	c.stmts[query] = stmt
+	return stmt, nil
+}
+
+// close closes all of the statements.
+func (c *stmtCache) close() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	var firstErr error
+	for query, stmt := range c.stmts {
+		if err := stmt.Close(); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("unable to close statement: %s", err)
+		}
+		delete(c.stmts, query)
+	}
+
+	return firstErr
+}
+
+// cachedQuerier is a Querier that runs queries using statements from the
+// cache. If tx is set, the queries run in the transaction.
+//
+// Outside of a transaction we retry queries that fail for transient reasons
+// as retry says. If the connection was lost we only retry queries that read,
+// as others may have taken effect. In a transaction only the whole
+// transaction can be retried, so instead we note the failure in transient if
+// it's set.
+type cachedQuerier struct {
+	cache *stmtCache
+	tx    *sql.Tx
+
+	retry     RetryPolicy
+	transient *bool
+
+	slow slowQueryLog
+}
+
+// SlowQueryFunc is told about each query that took longer than the threshold
+// given to SetSlowQueryLog. ctx is the query's context.
+type SlowQueryFunc func(ctx context.Context, took time.Duration, query string,
+	args []interface{})
+
+// slowQueryLog reports queries taking longer than threshold to fn. It's off if
+// fn is nil.
+type slowQueryLog struct {
+	threshold time.Duration
+	fn        SlowQueryFunc
+}
+
+// timed wraps the function running the query so that we report it if it's
+// slow.
+func (l slowQueryLog) timed(ctx context.Context, query string,
+	args []interface{}, fn func() error) func() error {
+	if l.fn == nil {
+		return fn
+	}
+	return func() error {
+		start := time.Now()
+		err := fn()
+		if took := time.Since(start); took > l.threshold {
+			l.fn(ctx, took, query, args)
+		}
+		return err
+	}
+}
+
+func (q cachedQuerier) stmt(ctx context.Context, query string) (*sql.Stmt,
+	error) {
+	stmt, err := q.cache.prepare(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	// This gives a statement specific to the transaction. It is closed when the
+	// transaction ends.
+	if q.tx != nil {
+		return q.tx.StmtContext(ctx, stmt), nil
+	}
+
+	return stmt, nil
+}
+
+// run runs the function running the query, retrying it or noting its failure
+// as appropriate.
+func (q cachedQuerier) run(ctx context.Context, query string,
+	args []interface{}, fn func() error) error {
+	fn = q.slow.timed(ctx, query, args, fn)
+
+	if q.tx == nil {
+		retryable := transientError
+		if readOnly(query) {
+			retryable = func(err error) bool {
+				return transientError(err) || connectionLost(err)
+			}
+		}
+		return q.retry.run(ctx, fn, retryable)
+	}
+
+	err := fn()
+	if err != nil && q.transient != nil &&
+		(transientError(err) || connectionLost(err)) {
+		*q.transient = true
+	}
+	return err
+}
+
+// uncached gives a Querier that runs queries without preparing them. This is
+// for queries that differ each time.
+func (q cachedQuerier) uncached() Querier {
+	return uncachedQuerier{q: q}
+}
+
+// ExecContext runs a query that returns no rows.
+func (q cachedQuerier) ExecContext(ctx context.Context, query string,
+	args ...interface{}) (sql.Result, error) {
+	var result sql.Result
+	err := q.run(ctx, query, args, func() error {
+		stmt, err := q.stmt(ctx, query)
+		if err != nil {
+			return err
+		}
+		result, err = stmt.ExecContext(ctx, args...)
+		return err
+	})
+	return result, err
+}
+
+// QueryContext runs a query that returns rows.
+func (q cachedQuerier) QueryContext(ctx context.Context, query string,
+	args ...interface{}) (*sql.Rows, error) {
+	var rows *sql.Rows
+	err := q.run(ctx, query, args, func() error {
+		stmt, err := q.stmt(ctx, query)
+		if err != nil {
+			return err
+		}
+		rows, err = stmt.QueryContext(ctx, args...)
+		return err
+	})
+	return rows, err
+}
+
+// QueryRowContext runs a query that returns at most one row.
+//
+// If we can't prepare the statement we run the query without doing so. We
+// have no way to return the error otherwise. Running it will give the error
+// again (if it wasn't transient) through the returned *sql.Row.
+func (q cachedQuerier) QueryRowContext(ctx context.Context, query string,
+	args ...interface{}) *sql.Row {
+	stmt, err := q.stmt(ctx, query)
+	if err != nil {
+		return q.uncached().QueryRowContext(ctx, query, args...)
+	}
+
+	var row *sql.Row
+	_ = q.run(ctx, query, args, func() error {
+		row = stmt.QueryRowContext(ctx, args...)
+		return row.Err()
+	})
+	return row
+}
+
+// uncachedQuerier is a Querier that runs queries without preparing them, but
+// otherwise as the cachedQuerier does.
+type uncachedQuerier struct {
+	q cachedQuerier
+}
+
+func (u uncachedQuerier) db() Querier {
+	if u.q.tx != nil {
+		return u.q.tx
+	}
+	return u.q.cache.db
+}
+
+// ExecContext runs a query that returns no rows.
+func (u uncachedQuerier) ExecContext(ctx context.Context, query string,
+	args ...interface{}) (sql.Result, error) {
+	var result sql.Result
+	err := u.q.run(ctx, query, args, func() error {
+		var err error
+		result, err = u.db().ExecContext(ctx, query, args...)
+		return err
+	})
+	return result, err
+}
+
+// QueryContext runs a query that returns rows.
+func (u uncachedQuerier) QueryContext(ctx context.Context, query string,
+	args ...interface{}) (*sql.Rows, error) {
+	var rows *sql.Rows
+	err := u.q.run(ctx, query, args, func() error {
+		var err error
+		rows, err = u.db().QueryContext(ctx, query, args...)
+		return err
+	})
+	return rows, err
+}
+
+// QueryRowContext runs a query that returns at most one row.
+func (u uncachedQuerier) QueryRowContext(ctx context.Context, query string,
+	args ...interface{}) *sql.Row {
+	var row *sql.Row
+	_ = u.q.run(ctx, query, args, func() error {
+		row = u.db().QueryRowContext(ctx, query, args...)
+		return row.Err()
+	})
+	return row
+}
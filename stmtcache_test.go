@@ -0,0 +1,103 @@
+package gorse
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestSQLStoreReusesStatements(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("unable to open mock db: %s", err)
+	}
+	defer db.Close()
+
+	// We prepare once, and then run it for each call, including inside a
+	// transaction.
+	prepared := mock.ExpectPrepare(
+		`SELECT id FROM rss_item WHERE rss_feed_id = \$1 AND link = \$2`)
+	prepared.ExpectQuery().WithArgs(1, "a").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	prepared.ExpectQuery().WithArgs(1, "b").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(2))
+	mock.ExpectBegin()
+	prepared.ExpectQuery().WithArgs(1, "c").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectCommit()
+	prepared.WillBeClosed()
+
+	ctx := context.Background()
+	store := NewSQLStore(db, Postgres)
+
+	exists, err := store.ItemExistsByLink(ctx, 1, "a")
+	if err != nil || exists {
+		t.Errorf("ItemExistsByLink(a) = %t, %v, wanted false", exists, err)
+	}
+
+	exists, err = store.ItemExistsByLink(ctx, 1, "b")
+	if err != nil || !exists {
+		t.Errorf("ItemExistsByLink(b) = %t, %v, wanted true", exists, err)
+	}
+
+	if err := store.InTx(ctx, func(store Store) error {
+		exists, err := store.ItemExistsByLink(ctx, 1, "c")
+		if err != nil || exists {
+			t.Errorf("ItemExistsByLink(c) = %t, %v, wanted false", exists, err)
+		}
+		return err
+	}); err != nil {
+		t.Errorf("InTx() = error %s", err)
+	}
+
+	if err := store.Close(); err != nil {
+		t.Errorf("Close() = error %s", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSQLStoreSlowQueryLog(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("unable to open mock db: %s", err)
+	}
+	defer db.Close()
+
+	prepared := mock.ExpectPrepare(
+		`SELECT id FROM rss_item WHERE rss_feed_id = \$1 AND link = \$2`)
+	prepared.ExpectQuery().WithArgs(1, "fast").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	prepared.ExpectQuery().WithArgs(1, "slow").
+		WillDelayFor(50 * time.Millisecond).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	var slow [][]interface{}
+	store := NewSQLStore(db, Postgres)
+	store.SetSlowQueryLog(20*time.Millisecond, func(ctx context.Context,
+		took time.Duration, query string, args []interface{}) {
+		if took < 20*time.Millisecond {
+			t.Errorf("slow query took %s, wanted at least 20ms", took)
+		}
+		slow = append(slow, args)
+	})
+
+	ctx := context.Background()
+	for _, link := range []string{"fast", "slow"} {
+		if _, err := store.ItemExistsByLink(ctx, 1, link); err != nil {
+			t.Errorf("ItemExistsByLink(%s) = error %s", link, err)
+		}
+	}
+
+	if len(slow) != 1 || len(slow[0]) != 2 || slow[0][1] != "slow" {
+		t.Errorf("slow queries = %v, wanted only the one with link slow", slow)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
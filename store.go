@@ -0,0 +1,563 @@
+package gorse
+
+import (
+	"context"
+	"io"
+	"time"
+)
+
+// Store is how we persist and retrieve feeds, items, read states, users,
+// subscriptions, and integrations.
+//
+// SQLStore implements it on top of a database. Code using the Store rather
+// than a database directly can be tested with a fake.
+type Store interface {
+	Items
+	Feeds
+	States
+	Users
+	Subscriptions
+	Integrations
+	Notifiers
+	MutedKeywords
+	Highlights
+	Rules
+
+	// InTx runs the function with a Store where everything happens in one
+	// transaction. If the function returns an error, none of it happens.
+	InTx(ctx context.Context, fn func(Store) error) error
+}
+
+// Items holds feeds' items.
+type Items interface {
+	// AddItem records a new item from a feed. It returns the item's ID.
+	AddItem(ctx context.Context, feedID int64, item *Item) (int64, error)
+
+	// UpsertItem adds the item to the feed or updates the one we have with
+	// the same GUID or link to match it. It returns the item's ID and what it
+	// did.
+	UpsertItem(ctx context.Context, feedID int64, item *Item) (int64,
+		UpsertResult, error)
+
+	// SetItemsArchived records that we marked the items read when we recorded
+	// them because their feed was in archive mode.
+	SetItemsArchived(ctx context.Context, itemIDs []int64) error
+
+	// GetItem retrieves an item along with its state for the user. It returns
+	// ErrNotFound if there is no such item.
+	GetItem(ctx context.Context, itemID int64, userID int) (*UserItem, error)
+
+	// GetReaderView retrieves the reader view of the item. It returns
+	// ErrNotFound if we don't have one.
+	GetReaderView(ctx context.Context, itemID int64) (*ReaderView, error)
+
+	// SetReaderView records the reader view, replacing any the item had.
+	SetReaderView(ctx context.Context, view ReaderView) error
+
+	// FullTextContents retrieves the articles we fetched for those of the
+	// items whose feeds are in full text mode, by item ID.
+	FullTextContents(ctx context.Context, itemIDs []int64) (map[int64]string,
+		error)
+
+	// ItemEnclosures retrieves the enclosures of the items, by item ID.
+	ItemEnclosures(ctx context.Context, itemIDs []int64) (map[int64][]Enclosure,
+		error)
+
+	// ItemCategories retrieves the categories of the items, by item ID.
+	ItemCategories(ctx context.Context, itemIDs []int64) (map[int64][]string,
+		error)
+
+	// FindItemByLink retrieves an item by feed and link. Link is unique per
+	// feed.
+	FindItemByLink(ctx context.Context, feedID int64, link string) (*DBItem,
+		error)
+
+	// ItemExistsByLink checks whether the feed has an item with the link.
+	ItemExistsByLink(ctx context.Context, feedID int64, link string) (bool,
+		error)
+
+	// ItemExistsByGUID checks whether the feed has an item with the GUID.
+	ItemExistsByGUID(ctx context.Context, feedID int64, guid string) (bool,
+		error)
+
+	// NewestItemTime finds the publication date of the feed's newest item. It
+	// is the zero time if the feed has no items.
+	NewestItemTime(ctx context.Context, feedID int64) (time.Time, error)
+
+	// FindItems retrieves the items matching the filter along with their
+	// states for the filter's user, newest first.
+	FindItems(ctx context.Context, filter ItemFilter) ([]UserItem, error)
+
+	// SearchItems retrieves the items matching the filter, best matches for
+	// the filter's Search or SearchAny first. One of them is required and
+	// After is unsupported.
+	SearchItems(ctx context.Context, filter ItemFilter) ([]UserItem, error)
+
+	// RelatedItems retrieves items from feeds the user subscribes to that
+	// share words with the item's title or link, best matches first.
+	RelatedItems(ctx context.Context, item UserItem, userID,
+		limit int) ([]UserItem, error)
+
+	// CountItems counts the items matching the filter.
+	CountItems(ctx context.Context, filter ItemFilter) (int, error)
+
+	// Digest summarizes the items matching the filter by feed, feeds with the
+	// most items first. It includes up to perFeed of each feed's newest items.
+	Digest(ctx context.Context, filter ItemFilter, perFeed int) ([]DigestFeed,
+		error)
+
+	// UnreadCounts counts the user's unread items published after since by
+	// feed. A zero since counts them all. Feeds without any aren't included.
+	UnreadCounts(ctx context.Context, userID int, since time.Time) (
+		map[int64]int, error)
+}
+
+// Feeds holds feeds.
+type Feeds interface {
+	// ActiveFeeds retrieves the feeds to poll ordered by name. These are those
+	// active and not deleted.
+	ActiveFeeds(ctx context.Context) ([]DBFeed, error)
+
+	// GetFeedByURI retrieves the feed with the URI. It returns ErrNotFound if
+	// there isn't one.
+	GetFeedByURI(ctx context.Context, uri string) (*DBFeed, error)
+
+	// CreateFeed adds a feed. It returns the feed's ID.
+	CreateFeed(ctx context.Context, feed DBFeed) (int64, error)
+
+	// UpdateFeed changes the feed with the feed's ID to match it. It returns
+	// ErrNotFound if there is no such feed.
+	UpdateFeed(ctx context.Context, feed DBFeed) error
+
+	// DeactivateFeed stops the feed being polled. It returns ErrNotFound if
+	// there is no such feed.
+	DeactivateFeed(ctx context.Context, feedID int64) error
+
+	// DeleteFeed deletes the feed, doing what retention says with its items.
+	// It returns ErrNotFound if there is no such feed.
+	DeleteFeed(ctx context.Context, feedID int64, retention ItemRetention) error
+
+	// RestoreFeed undoes deleting the feed. It returns ErrNotFound if there is
+	// no such feed.
+	RestoreFeed(ctx context.Context, feedID int64) error
+
+	// FeedRetention retrieves the feed's retention policy. It returns
+	// ErrNotFound if there is no such feed.
+	FeedRetention(ctx context.Context, feedID int64) (RetentionPolicy, error)
+
+	// FeedRetentions retrieves the retention policies of the feeds that don't
+	// keep their items forever, by feed ID.
+	FeedRetentions(ctx context.Context) (map[int64]RetentionPolicy, error)
+
+	// SetFeedRetention sets the feed's retention policy. It returns ErrNotFound
+	// if there is no such feed.
+	SetFeedRetention(ctx context.Context, feedID int64,
+		policy RetentionPolicy) error
+
+	// SetFeedArchive sets whether the feed is in archive mode. It returns
+	// ErrNotFound if there is no such feed.
+	SetFeedArchive(ctx context.Context, feedID int64, archive bool) error
+
+	// SetFeedFullText sets whether we fetch the articles of the feed's new
+	// items. It returns ErrNotFound if there is no such feed.
+	SetFeedFullText(ctx context.Context, feedID int64, fullText bool) error
+
+	// SetFeedUpdateFrequency sets how often in seconds we poll the feed. It
+	// returns ErrNotFound if there is no such feed.
+	SetFeedUpdateFrequency(ctx context.Context, feedID int64,
+		seconds int64) error
+
+	// SetFeedPayload records the payload we last fetched for the feed.
+	SetFeedPayload(ctx context.Context, feedID int64, payload []byte) error
+
+	// SetFeedUpdated records when we last polled the feed. Polling it
+	// succeeded, so it no longer has errors.
+	SetFeedUpdated(ctx context.Context, feedID int64, updateTime time.Time) error
+
+	// SetFeedError records that polling the feed failed and why. It returns
+	// ErrNotFound if there is no such feed.
+	SetFeedError(ctx context.Context, feedID int64, message string) error
+
+	// SetFeedValidators records the ETag and Last-Modified headers the feed
+	// was served with. It returns ErrNotFound if there is no such feed.
+	SetFeedValidators(ctx context.Context, feedID int64, etag,
+		lastModified string) error
+
+	// GetFeedIcon retrieves the feed's icon. It returns ErrNotFound if we
+	// don't have one.
+	GetFeedIcon(ctx context.Context, feedID int64) (*FeedIcon, error)
+
+	// SetFeedIcon records the icon, replacing any the feed had.
+	SetFeedIcon(ctx context.Context, icon FeedIcon) error
+
+	// SetFeedIconFetched records that we fetched the feed's icon at the time
+	// and found it hadn't changed. It returns ErrNotFound if we don't have an
+	// icon for the feed.
+	SetFeedIconFetched(ctx context.Context, feedID int64,
+		fetchTime time.Time) error
+
+	// SavedFeed retrieves the ID of the feed holding the links the user saved,
+	// creating it if they don't have one. See SavedFeed.
+	SavedFeed(ctx context.Context, userID int) (int64, error)
+}
+
+// States holds the state each user has put items in.
+type States interface {
+	// SetItemReadState sets the item's read state for the user.
+	SetItemReadState(ctx context.Context, itemID int64, userID int,
+		state ReadState) error
+
+	// SetItemsReadState sets the read state of each of the items for the user.
+	SetItemsReadState(ctx context.Context, itemIDs []int64, userID int,
+		state ReadState) error
+
+	// MarkAllRead sets all of the user's unread items read, only those of the
+	// feed if feedID is not 0, and only those published at or before until if
+	// it is not zero. It returns how many it set.
+	MarkAllRead(ctx context.Context, userID int, feedID int64,
+		until time.Time) (int64, error)
+
+	// SetItemNote sets the user's note on the item. A blank note removes it.
+	// The item must have a state for the user. If not, it returns ErrNotFound.
+	SetItemNote(ctx context.Context, itemID int64, userID int,
+		note string) error
+
+	// SetItemShared sets whether the item is in the feed of items the user
+	// starred. The user must have starred the item. If not, it returns
+	// ErrNotFound.
+	SetItemShared(ctx context.Context, itemID int64, userID int,
+		shared bool) error
+
+	// SetItemStarred stars or unstars the item for the user. It returns
+	// ErrNotFound if there is no such item.
+	SetItemStarred(ctx context.Context, itemID int64, userID int,
+		starred bool) error
+
+	// AddItemTag tags the item for the user. The tag must be normalized. It
+	// returns ErrNotFound if there is no such item.
+	AddItemTag(ctx context.Context, itemID int64, userID int, tag string) error
+
+	// RemoveItemTag removes the tag from the item for the user.
+	RemoveItemTag(ctx context.Context, itemID int64, userID int,
+		tag string) error
+
+	// ItemTags retrieves the user's tags on the items, by item ID.
+	ItemTags(ctx context.Context, userID int, itemIDs []int64) (
+		map[int64][]string, error)
+
+	// ListTags retrieves the user's tags along with how many items have each.
+	ListTags(ctx context.Context, userID int) ([]TagCount, error)
+
+	// SharedItems retrieves the items in the feed of items the user starred,
+	// most recently starred first.
+	SharedItems(ctx context.Context, userID, limit int) ([]UserItem, error)
+
+	// GetReadingPosition retrieves where the user was in the view. It returns
+	// ErrNotFound if we don't know.
+	GetReadingPosition(ctx context.Context, userID int,
+		view string) (*ReadingPosition, error)
+
+	// SetReadingPosition records where the user is in the view, replacing
+	// where they were.
+	SetReadingPosition(ctx context.Context, position ReadingPosition) error
+
+	// StateChanges retrieves the user's most recent state changes, newest
+	// first. Setting states records the changes.
+	StateChanges(ctx context.Context, userID, limit int) ([]StateChange, error)
+
+	// RecentlyRead retrieves the items the user most recently marked read and
+	// hasn't set to another state since, newest first.
+	RecentlyRead(ctx context.Context, userID, limit int) ([]ReadItem, error)
+
+	// RecordReadAfterReadLater records that the user read an item they saved
+	// to read later.
+	RecordReadAfterReadLater(ctx context.Context, userID int,
+		item *UserItem) error
+
+	// ReadAfterArchives retrieves the items the user read after saving them to
+	// read later, most recently read first. limit is the most to retrieve and
+	// offset skips this many first. offset only applies with a limit.
+	ReadAfterArchives(ctx context.Context, userID, limit, offset int) (
+		[]ReadAfterArchive, error)
+
+	// CountReadAfterArchives counts the items the user read after saving them
+	// to read later.
+	CountReadAfterArchives(ctx context.Context, userID int) (int, error)
+}
+
+// Users holds users.
+type Users interface {
+	// GetUser retrieves a user by ID.
+	GetUser(ctx context.Context, id int) (*User, error)
+
+	// CreateUser creates a user with the password.
+	CreateUser(ctx context.Context, email, password string, admin bool) (*User,
+		error)
+
+	// AuthenticateUser checks the email and password belong to a user. It
+	// returns the user if so and ErrInvalidCredentials if not.
+	AuthenticateUser(ctx context.Context, email, password string) (*User, error)
+
+	// UpdatePassword sets the user's password.
+	UpdatePassword(ctx context.Context, userID int, password string) error
+
+	// UpdateLocale sets the user's locale and whether they see relative dates.
+	UpdateLocale(ctx context.Context, userID int, locale string,
+		relativeDates bool) error
+
+	// UpdateShareEmail sets where the user emails items they share unless
+	// they say otherwise.
+	UpdateShareEmail(ctx context.Context, userID int, email string) error
+
+	// UpdateKindleEmail sets where we email books of the user's items to read
+	// later.
+	UpdateKindleEmail(ctx context.Context, userID int, email string) error
+
+	// UpdateCompactList sets whether the user's lists show items as one line
+	// each rather than expanded. It returns ErrNotFound if there is no such
+	// user.
+	UpdateCompactList(ctx context.Context, userID int, compact bool) error
+
+	// SetShareToken sets the token in the URL of the feed of items the user
+	// starred. Blank stops publishing it.
+	SetShareToken(ctx context.Context, userID int, token string) error
+
+	// UserByShareToken retrieves the user publishing the feed with the token.
+	// It returns ErrNotFound if no one is.
+	UserByShareToken(ctx context.Context, token string) (*User, error)
+
+	// ListUsers retrieves all users ordered by email.
+	ListUsers(ctx context.Context) ([]User, error)
+
+	// ExportUser writes all of the user's data as JSON. See ExportUser.
+	ExportUser(ctx context.Context, userID int, w io.Writer) error
+
+	// AuditLog retrieves the most recent actions in the audit log, newest
+	// first. Changes to feeds and users are in it, as are states users set on
+	// many items at once.
+	AuditLog(ctx context.Context, limit int) ([]AuditEntry, error)
+}
+
+// Subscriptions holds which feeds each user subscribes to.
+type Subscriptions interface {
+	// Subscribe subscribes the user to the feed. Subscribing again does
+	// nothing.
+	Subscribe(ctx context.Context, userID int, feedID int64) error
+
+	// Unsubscribe unsubscribes the user from the feed. It returns ErrNotFound
+	// if they weren't subscribed.
+	Unsubscribe(ctx context.Context, userID int, feedID int64) error
+
+	// ListSubscriptions retrieves the feeds the user subscribes to ordered by
+	// name. Deleted feeds aren't included.
+	ListSubscriptions(ctx context.Context, userID int) ([]DBFeed, error)
+
+	// SubscriptionStats describes the items of each feed the user subscribes
+	// to, by feed ID.
+	SubscriptionStats(ctx context.Context, userID int) (map[int64]FeedStats,
+		error)
+
+	// FeedOverview retrieves summaries of the feeds the user subscribes to in
+	// the order. Limit is the most to retrieve, and offset skips that many
+	// first. Deleted feeds aren't included.
+	FeedOverview(ctx context.Context, userID int, sort FeedSort, limit,
+		offset int) ([]FeedSummary, error)
+
+	// CountSubscriptions counts the feeds the user subscribes to. Deleted
+	// feeds aren't included.
+	CountSubscriptions(ctx context.Context, userID int) (int, error)
+
+	// CountFailingFeeds counts the feeds the user subscribes to that polling
+	// failed for at least minErrors times in a row. Deleted feeds and those
+	// we don't poll aren't included.
+	CountFailingFeeds(ctx context.Context, userID, minErrors int) (int, error)
+
+	// FeedSubscribers retrieves the IDs of the users subscribed to the feed.
+	FeedSubscribers(ctx context.Context, feedID int64) ([]int, error)
+
+	// SetFeedDisplay sets how the user's lists show items from the feed. It
+	// returns ErrNotFound if they don't subscribe to it.
+	SetFeedDisplay(ctx context.Context, userID int, feedID int64,
+		mode DisplayMode) error
+
+	// FeedDisplayModes retrieves how the user's lists show items from the
+	// feeds they subscribe to, by feed ID. Feeds showing items' full
+	// descriptions aren't included.
+	FeedDisplayModes(ctx context.Context, userID int) (map[int64]DisplayMode,
+		error)
+}
+
+// Integrations holds the services each user sends items to.
+type Integrations interface {
+	// ListIntegrations retrieves the user's integrations ordered by service.
+	ListIntegrations(ctx context.Context, userID int) ([]Integration, error)
+
+	// GetIntegration retrieves the user's integration with the service. It
+	// returns ErrNotFound if they don't have one.
+	GetIntegration(ctx context.Context, userID int, service string) (
+		*Integration, error)
+
+	// SetIntegration records the integration, replacing any the user had with
+	// the service.
+	SetIntegration(ctx context.Context, integration Integration) error
+
+	// DeleteIntegration removes the user's integration with the service. It
+	// returns ErrNotFound if they don't have one.
+	DeleteIntegration(ctx context.Context, userID int, service string) error
+}
+
+// Notifiers holds the chats users have us post new items to.
+type Notifiers interface {
+	// AddNotifier records the notifier. It returns the notifier's ID.
+	AddNotifier(ctx context.Context, n Notifier) (int64, error)
+
+	// ListNotifiers retrieves the user's notifiers in the order they added
+	// them.
+	ListNotifiers(ctx context.Context, userID int) ([]Notifier, error)
+
+	// FeedNotifiers retrieves the notifiers that post the feed's new items.
+	FeedNotifiers(ctx context.Context, feedID int64) ([]Notifier, error)
+
+	// DeleteNotifier removes the user's notifier. It returns ErrNotFound if
+	// they don't have it.
+	DeleteNotifier(ctx context.Context, userID int, id int64) error
+}
+
+// MutedKeywords holds the words and phrases users don't want to see.
+type MutedKeywords interface {
+	// MuteKeyword mutes the phrase for the user. isRegexp says whether it is a
+	// regular expression. markRead says whether to mark new items containing
+	// it read when they arrive. We always do for regular expressions.
+	MuteKeyword(ctx context.Context, userID int, phrase string, isRegexp,
+		markRead bool) error
+
+	// UnmuteKeyword stops muting the phrase or regular expression for the
+	// user. It returns ErrNotFound if they didn't mute it.
+	UnmuteKeyword(ctx context.Context, userID int, phrase string) error
+
+	// ListMutedKeywords retrieves the phrases the user muted in alphabetical
+	// order.
+	ListMutedKeywords(ctx context.Context, userID int) ([]MutedKeyword, error)
+}
+
+// Rules holds what users have us do with new items when they arrive.
+type Rules interface {
+	// AddRule validates the rule and records it. It returns the rule's ID.
+	AddRule(ctx context.Context, rule Rule) (int64, error)
+
+	// ListRules retrieves the user's rules in the order they added them.
+	ListRules(ctx context.Context, userID int) ([]Rule, error)
+
+	// DeleteRule removes the user's rule. It returns ErrNotFound if they
+	// don't have it.
+	DeleteRule(ctx context.Context, userID int, id int64) error
+}
+
+// Highlights holds the words and phrases users watch for.
+type Highlights interface {
+	// AddHighlight highlights the phrase for the user.
+	AddHighlight(ctx context.Context, userID int, phrase string) error
+
+	// RemoveHighlight stops highlighting the phrase for the user. It returns
+	// ErrNotFound if they didn't highlight it.
+	RemoveHighlight(ctx context.Context, userID int, phrase string) error
+
+	// ListHighlights retrieves the phrases the user highlights in alphabetical
+	// order.
+	ListHighlights(ctx context.Context, userID int) ([]Highlight, error)
+}
+
+// DBFeed holds the information from the database about a feed.
+type DBFeed struct {
+	// Database ID.
+	ID int64
+
+	// Name.
+	Name string
+
+	// URI to the feed.
+	URI string
+
+	// Update frequency in seconds.
+	UpdateFrequencySeconds int64
+
+	// Last time we updated.
+	LastUpdateTime *time.Time
+
+	// Whether we poll the feed.
+	Active bool
+
+	// Whether the feed was deleted. We don't poll deleted feeds or show their
+	// items.
+	Deleted bool
+
+	// Whether the feed is set to archive mode. Archive mode means that new items
+	// get recorded but set to read automatically. I find this useful for feeds I
+	// don't actively ever look at, but want to track them in case I need to at
+	// some point. For example, a feed I usually read through a different web
+	// interface, but if I fall behind on that web interface and can't go back far
+	// enough, then I might need to look at it through Gorse.
+	Archive bool
+
+	// The ETag and Last-Modified headers the feed was last served with, if
+	// any. We poll it asking for it only if it changed since.
+	ETag         string
+	LastModified string
+
+	// Whether we fetch the article each of the feed's new items links to when
+	// we poll it, keeping it as the item's reader view. This is for feeds
+	// whose items are only summaries.
+	FullText bool
+}
+
+// UserItem is an item along with information about it relevant to a user.
+type UserItem struct {
+	DBItem
+
+	// Name from the rss_feed table.
+	FeedName string
+
+	// The user's read state for the item.
+	ReadState ReadState
+
+	// The user's note on the item. Blank if none.
+	Note string
+
+	// Whether the user left the item out of the feed of items they starred.
+	Unshared bool
+
+	// Whether the user starred the item to keep it. See SetItemStarred.
+	Starred bool
+}
+
+// User is a user.
+type User struct {
+	ID    int
+	Email string
+
+	// Whether the user may manage other users and the feeds.
+	Admin bool
+
+	// Locale is the language to show the interface and dates in, such as fr.
+	// Blank means to go by what the user's browser asks for.
+	Locale string
+
+	// Whether to show times relative to now, such as 2 hours ago.
+	RelativeDates bool
+
+	// ShareEmail is where to email items the user shares unless they say
+	// otherwise. Blank if they haven't said.
+	ShareEmail string
+
+	// KindleEmail is where to email books of the user's items to read later,
+	// such as their Kindle's address. Blank if they haven't said.
+	KindleEmail string
+
+	// ShareToken is the token in the URL of the feed of items the user
+	// starred. Blank if they don't publish one.
+	ShareToken string
+
+	// Whether the user's lists show items as one line each, without their
+	// descriptions, rather than expanded.
+	CompactList bool
+}
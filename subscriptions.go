@@ -0,0 +1,258 @@
+package gorse
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// newFeedUpdateFrequencySeconds is how often we poll feeds users add, such as
+// by importing or subscribing from the browser extension.
+const newFeedUpdateFrequencySeconds = 3600
+
+// Subscribe subscribes the user to the feed. Subscribing again does nothing.
+func Subscribe(ctx context.Context, db Querier, userID int,
+	feedID int64) error {
+	query := `
+INSERT INTO rss_feed_subscription (user_id, feed_id)
+VALUES ($1, $2)
+ON CONFLICT (user_id, feed_id) DO NOTHING
+`
+
+	if _, err := db.ExecContext(ctx, query, userID, feedID); err != nil {
+		return fmt.Errorf("unable to subscribe user ID [%d] to feed ID [%d]: %s",
+			userID, feedID, err)
+	}
+
+	return nil
+}
+
+// SubscribeToFeed subscribes the user to the feed at the URI, adding the feed
+// if we don't have it. name is what to call it if so. It returns the feed's ID
+// and whether we added it.
+//
+// Run this in a transaction.
+func SubscribeToFeed(ctx context.Context, store Store, userID int, name,
+	uri string) (int64, bool, error) {
+	feed, err := store.GetFeedByURI(ctx, uri)
+	if err != nil && err != ErrNotFound {
+		return -1, false, err
+	}
+
+	added := false
+	var feedID int64
+	if err == ErrNotFound {
+		if strings.TrimSpace(name) == "" {
+			name = uri
+		}
+		if feedID, err = store.CreateFeed(ctx, DBFeed{
+			Name:                   name,
+			URI:                    uri,
+			UpdateFrequencySeconds: newFeedUpdateFrequencySeconds,
+			Active:                 true,
+		}); err != nil {
+			return -1, false, err
+		}
+		added = true
+	} else {
+		feedID = feed.ID
+	}
+
+	if err := store.Subscribe(ctx, userID, feedID); err != nil {
+		return -1, false, err
+	}
+
+	return feedID, added, nil
+}
+
+// Unsubscribe unsubscribes the user from the feed. It returns ErrNotFound if
+// they weren't subscribed.
+//
+// We keep the states the user set on the feed's items. They come back if the
+// user subscribes again.
+func Unsubscribe(ctx context.Context, db Querier, userID int,
+	feedID int64) error {
+	query := `
+DELETE FROM rss_feed_subscription
+WHERE user_id = $1 AND feed_id = $2
+`
+
+	result, err := db.ExecContext(ctx, query, userID, feedID)
+	if err != nil {
+		return fmt.Errorf(
+			"unable to unsubscribe user ID [%d] from feed ID [%d]: %s", userID,
+			feedID, err)
+	}
+
+	return requireOneRow(result)
+}
+
+// ListSubscriptions retrieves the feeds the user subscribes to ordered by
+// name. Deleted feeds aren't included.
+func ListSubscriptions(ctx context.Context, db Querier, userID int) ([]DBFeed,
+	error) {
+	query := `
+SELECT
+rf.id, rf.name, rf.uri, rf.update_frequency_seconds, rf.last_update_time,
+rf.archive, rf.active, rf.deleted, rf.etag, rf.last_modified, rf.full_text
+FROM rss_feed rf
+JOIN rss_feed_subscription rfs ON rfs.feed_id = rf.id
+WHERE rfs.user_id = $1 AND rf.deleted = false
+ORDER BY rf.name
+`
+
+	rows, err := db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("unable to query subscriptions: %s", err)
+	}
+
+	var feeds []DBFeed
+	for rows.Next() {
+		feed, err := scanFeed(rows)
+		if err != nil {
+			_ = rows.Close()
+			return nil, fmt.Errorf("failed to scan row: %s", err)
+		}
+		feeds = append(feeds, *feed)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failure fetching rows: %s", err)
+	}
+
+	return feeds, nil
+}
+
+// FeedSubscribers retrieves the IDs of the users subscribed to the feed.
+//
+// When we record a new item, these are the users it is unread for.
+func FeedSubscribers(ctx context.Context, db Querier, feedID int64) ([]int,
+	error) {
+	query := `
+SELECT user_id FROM rss_feed_subscription WHERE feed_id = $1 ORDER BY user_id
+`
+
+	rows, err := db.QueryContext(ctx, query, feedID)
+	if err != nil {
+		return nil, fmt.Errorf("unable to query subscribers: %s", err)
+	}
+
+	var userIDs []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			_ = rows.Close()
+			return nil, fmt.Errorf("failed to scan row: %s", err)
+		}
+		userIDs = append(userIDs, id)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failure fetching rows: %s", err)
+	}
+
+	return userIDs, nil
+}
+
+// DisplayMode is how a user's lists show items from a feed they subscribe to.
+// Some feeds are headlines to skim while others deserve their whole text.
+type DisplayMode int
+
+const (
+	// DisplayFull shows items' full descriptions.
+	DisplayFull DisplayMode = iota
+
+	// DisplaySummary shows the start of items' descriptions.
+	DisplaySummary
+
+	// DisplayTitle shows only items' titles.
+	DisplayTitle
+)
+
+// String gives the name ParseDisplayMode takes.
+func (m DisplayMode) String() string {
+	switch m {
+	case DisplayFull:
+		return "full"
+	case DisplaySummary:
+		return "summary"
+	case DisplayTitle:
+		return "title"
+	default:
+		return "unknown"
+	}
+}
+
+// ParseDisplayMode turns full, summary, or title into a DisplayMode.
+func ParseDisplayMode(s string) (DisplayMode, error) {
+	switch s {
+	case "full":
+		return DisplayFull, nil
+	case "summary":
+		return DisplaySummary, nil
+	case "title":
+		return DisplayTitle, nil
+	default:
+		return -1, fmt.Errorf("unknown display mode: %s", s)
+	}
+}
+
+// SetFeedDisplay sets how the user's lists show items from the feed. It
+// returns ErrNotFound if they don't subscribe to it.
+func SetFeedDisplay(ctx context.Context, db Querier, userID int, feedID int64,
+	mode DisplayMode) error {
+	if mode.String() == "unknown" {
+		return fmt.Errorf("unknown display mode: %d", mode)
+	}
+
+	query := `
+UPDATE rss_feed_subscription SET display = $1
+WHERE user_id = $2 AND feed_id = $3
+`
+
+	result, err := db.ExecContext(ctx, query, mode.String(), userID, feedID)
+	if err != nil {
+		return fmt.Errorf("unable to set display of feed ID [%d] for user ID "+
+			"[%d]: %s", feedID, userID, err)
+	}
+
+	return requireOneRow(result)
+}
+
+// FeedDisplayModes retrieves how the user's lists show items from the feeds
+// they subscribe to, by feed ID. Feeds showing items' full descriptions
+// aren't included.
+func FeedDisplayModes(ctx context.Context, db Querier,
+	userID int) (map[int64]DisplayMode, error) {
+	query := `
+SELECT feed_id, display FROM rss_feed_subscription
+WHERE user_id = $1 AND display != 'full'
+`
+
+	rows, err := db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("unable to query display modes: %s", err)
+	}
+
+	modes := map[int64]DisplayMode{}
+	for rows.Next() {
+		var feedID int64
+		var display string
+		if err := rows.Scan(&feedID, &display); err != nil {
+			_ = rows.Close()
+			return nil, fmt.Errorf("failed to scan row: %s", err)
+		}
+		mode, err := ParseDisplayMode(display)
+		if err != nil {
+			_ = rows.Close()
+			return nil, err
+		}
+		modes[feedID] = mode
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failure fetching rows: %s", err)
+	}
+
+	return modes, nil
+}
@@ -0,0 +1,165 @@
+package gorse
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Users may tag items to organize them. Unlike the categories feeds give
+// items, tags are each user's own. Tagging is apart from the read state, so
+// items saved to read later can be sorted into tags.
+
+// MaxTagLength is the most characters a tag may have.
+const MaxTagLength = 50
+
+// NormalizeTag puts the tag in the form we store it in. This is lowercase
+// with single spaces between words. It is an error if the tag is blank or too
+// long.
+func NormalizeTag(tag string) (string, error) {
+	tag = strings.ToLower(strings.Join(strings.Fields(tag), " "))
+	if tag == "" {
+		return "", fmt.Errorf("tag is blank")
+	}
+	if len([]rune(tag)) > MaxTagLength {
+		return "", fmt.Errorf("tag is longer than %d characters", MaxTagLength)
+	}
+	return tag, nil
+}
+
+// TagCount is one of a user's tags along with how many items have it.
+type TagCount struct {
+	Tag   string
+	Items int
+}
+
+// AddItemTag tags the item for the user. The tag must be normalized. Adding a
+// tag the item has already does nothing. It returns ErrNotFound if there is
+// no such item.
+func AddItemTag(ctx context.Context, db Querier, itemID int64, userID int,
+	tag string) error {
+	query := `
+INSERT INTO rss_item_tag (user_id, item_id, tag)
+SELECT $1, id, $2 FROM rss_item WHERE id = $3
+ON CONFLICT (user_id, item_id, tag) DO NOTHING
+`
+
+	result, err := db.ExecContext(ctx, query, userID, tag, itemID)
+	if err != nil {
+		return fmt.Errorf("unable to tag item %d: %s", itemID, err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("unable to check rows affected: %s", err)
+	}
+	if rows > 0 {
+		return nil
+	}
+
+	// Either it had the tag already or there's no such item.
+	var exists bool
+	if err := db.QueryRowContext(ctx,
+		`SELECT EXISTS (SELECT 1 FROM rss_item WHERE id = $1)`,
+		itemID).Scan(&exists); err != nil {
+		return fmt.Errorf("unable to look up item %d: %s", itemID, err)
+	}
+	if !exists {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// RemoveItemTag removes the tag from the item for the user. Removing a tag
+// the item doesn't have does nothing.
+func RemoveItemTag(ctx context.Context, db Querier, itemID int64, userID int,
+	tag string) error {
+	query := `
+DELETE FROM rss_item_tag WHERE user_id = $1 AND item_id = $2 AND tag = $3
+`
+
+	if _, err := db.ExecContext(ctx, query, userID, itemID, tag); err != nil {
+		return fmt.Errorf("unable to remove tag from item %d: %s", itemID, err)
+	}
+	return nil
+}
+
+// ItemTags retrieves the user's tags on the items, by item ID. Items without
+// any aren't included.
+func ItemTags(ctx context.Context, db Querier, userID int,
+	itemIDs []int64) (map[int64][]string, error) {
+	tags := map[int64][]string{}
+	if len(itemIDs) == 0 {
+		return tags, nil
+	}
+
+	placeholders := make([]string, len(itemIDs))
+	params := []interface{}{userID}
+	for i, id := range itemIDs {
+		placeholders[i] = fmt.Sprintf("$%d", i+2)
+		params = append(params, id)
+	}
+
+	query := `
+SELECT item_id, tag
+FROM rss_item_tag
+WHERE user_id = $1 AND
+item_id IN (` + strings.Join(placeholders, ", ") + `)
+ORDER BY tag
+`
+
+	rows, err := db.QueryContext(ctx, query, params...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to query tags: %s", err)
+	}
+
+	for rows.Next() {
+		var id int64
+		var tag string
+		if err := rows.Scan(&id, &tag); err != nil {
+			_ = rows.Close()
+			return nil, fmt.Errorf("failed to scan row: %s", err)
+		}
+		tags[id] = append(tags[id], tag)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failure fetching rows: %s", err)
+	}
+
+	return tags, nil
+}
+
+// ListTags retrieves the user's tags along with how many items have each, in
+// order by tag.
+func ListTags(ctx context.Context, db Querier, userID int) ([]TagCount,
+	error) {
+	query := `
+SELECT tag, COUNT(*)
+FROM rss_item_tag
+WHERE user_id = $1
+GROUP BY tag
+ORDER BY tag
+`
+
+	rows, err := db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("unable to query tags: %s", err)
+	}
+
+	var tags []TagCount
+	for rows.Next() {
+		var tag TagCount
+		if err := rows.Scan(&tag.Tag, &tag.Items); err != nil {
+			_ = rows.Close()
+			return nil, fmt.Errorf("failed to scan row: %s", err)
+		}
+		tags = append(tags, tag)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failure fetching rows: %s", err)
+	}
+
+	return tags, nil
+}
@@ -0,0 +1,47 @@
+package gorse
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// Querier runs queries. Both *sql.DB and *sql.Tx are Queriers, so functions
+// taking one work either inside or outside of a transaction.
+type Querier interface {
+	ExecContext(context.Context, string, ...interface{}) (sql.Result, error)
+	QueryContext(context.Context, string, ...interface{}) (*sql.Rows, error)
+	QueryRowContext(context.Context, string, ...interface{}) *sql.Row
+}
+
+// WithTx runs the function inside a transaction.
+//
+// If the function returns an error (or panics), we roll back. Otherwise we
+// commit.
+func WithTx(ctx context.Context, db *sql.DB, fn func(*sql.Tx) error) (
+	err error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("unable to begin transaction: %s", err)
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			_ = tx.Rollback()
+			panic(p)
+		}
+	}()
+
+	if err := fn(tx); err != nil {
+		if rbErr := tx.Rollback(); rbErr != nil {
+			return fmt.Errorf("%s (and unable to roll back: %s)", err, rbErr)
+		}
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("unable to commit: %s", err)
+	}
+
+	return nil
+}
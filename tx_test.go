@@ -0,0 +1,93 @@
+package gorse
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestWithTx(t *testing.T) {
+	tests := []struct {
+		Name        string
+		Fn          func(*sql.Tx) error
+		Expect      func(sqlmock.Sqlmock)
+		WantedError bool
+	}{
+		{
+			Name: "commit",
+			Fn: func(tx *sql.Tx) error {
+				_, err := tx.Exec(`UPDATE rss_feed SET active = false`)
+				return err
+			},
+			Expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectExec(`UPDATE rss_feed`).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+		},
+		{
+			Name: "roll back",
+			Fn: func(tx *sql.Tx) error {
+				return errors.New("failed")
+			},
+			Expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectRollback()
+			},
+			WantedError: true,
+		},
+	}
+
+	for _, test := range tests {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("unable to open mock db: %s", err)
+		}
+
+		test.Expect(mock)
+
+		err = WithTx(context.Background(), db, test.Fn)
+		if err != nil && !test.WantedError {
+			t.Errorf("%s: WithTx() = error %s", test.Name, err)
+		}
+		if err == nil && test.WantedError {
+			t.Errorf("%s: WithTx() succeeded, wanted error", test.Name)
+		}
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("%s: %s", test.Name, err)
+		}
+
+		_ = db.Close()
+	}
+}
+
+func TestWithTxPanic(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("unable to open mock db: %s", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Errorf("WithTx() did not re-panic")
+			}
+		}()
+		_ = WithTx(context.Background(), db, func(tx *sql.Tx) error {
+			panic("failed")
+		})
+	}()
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
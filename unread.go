@@ -0,0 +1,308 @@
+package gorse
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// We keep counts of each user's unread items in rss_unread_count. There is a
+// count for each feed and UTC day of publication. Counting unread items then
+// means adding up the counts rather than looking at every item.
+//
+// Counting those published since a time uses the counts of the days after it.
+// We count the items of the day the time falls in individually.
+
+// unreadCountKey identifies one of the unread counts.
+type unreadCountKey struct {
+	userID int
+	feedID int64
+	day    string
+}
+
+// publicationDay gives the day an item published at the time counts towards.
+func publicationDay(t time.Time) string {
+	return t.UTC().Format("2006-01-02")
+}
+
+// UnreadCounts counts the user's unread items published after since by feed.
+// A zero since counts them all. Feeds without any aren't included, nor are
+// deleted feeds.
+func UnreadCounts(ctx context.Context, db Querier, dbType string, userID int,
+	since time.Time) (map[int64]int, error) {
+	d, err := lookupDialect(dbType)
+	if err != nil {
+		return nil, err
+	}
+
+	state := Unread
+	return countUnread(ctx, db, d, ItemFilter{
+		UserID: userID,
+		State:  &state,
+		Since:  since,
+	})
+}
+
+// usesUnreadCounts decides whether we can count the items matching the filter
+// using the unread counts.
+func usesUnreadCounts(filter ItemFilter) bool {
+	return filter.State != nil && *filter.State == Unread && !filter.Starred &&
+		filter.Search == "" && len(filter.SearchAny) == 0 &&
+		filter.Category == "" && filter.Tag == "" &&
+		!filter.HideMuted && !filter.Highlighted &&
+		filter.Until.IsZero() && filter.After == nil
+}
+
+// countUnread counts the unread items matching the filter by feed using the
+// unread counts. The filter must be one usesUnreadCounts accepts.
+func countUnread(ctx context.Context, db Querier, d dialect,
+	filter ItemFilter) (map[int64]int, error) {
+	where := []string{"ruc.user_id = $1"}
+	args := []interface{}{filter.UserID}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if filter.FeedID != 0 {
+		where = append(where, "ruc.feed_id = "+arg(filter.FeedID))
+	}
+	if !filter.Since.IsZero() {
+		where = append(where, "ruc.publication_day > "+
+			arg(publicationDay(filter.Since)))
+	}
+
+	query := `
+SELECT ruc.feed_id, SUM(ruc.unread_count)
+FROM rss_unread_count ruc
+JOIN rss_feed rf ON rf.id = ruc.feed_id AND rf.deleted = false AND
+  (rf.user_id IS NULL OR rf.user_id = $1)`
+	if filter.Subscribed {
+		query += `
+JOIN rss_feed_subscription rfs ON rfs.feed_id = ruc.feed_id AND
+  rfs.user_id = $1`
+	}
+	query += `
+WHERE ` + strings.Join(where, " AND ") + `
+GROUP BY ruc.feed_id`
+
+	counts := map[int64]int{}
+	if err := scanFeedCounts(ctx, db, query, args, counts); err != nil {
+		return nil, err
+	}
+
+	// The rest of the day since falls in.
+	if !filter.Since.IsZero() {
+		y, m, day := filter.Since.UTC().Date()
+		nextDay := time.Date(y, m, day+1, 0, 0, 0, 0, time.UTC)
+
+		// Postgres keeps times to the microsecond.
+		filter.Until = nextDay.Add(-time.Microsecond)
+
+		from, args := itemFilterSQL(d, filter)
+		query := `SELECT ri.rss_feed_id, COUNT(*) ` + from +
+			"\nGROUP BY ri.rss_feed_id"
+		if err := scanFeedCounts(ctx, db, query, args, counts); err != nil {
+			return nil, err
+		}
+	}
+
+	for feedID, count := range counts {
+		if count <= 0 {
+			delete(counts, feedID)
+		}
+	}
+
+	return counts, nil
+}
+
+// scanFeedCounts runs a query selecting feed IDs and counts and adds the
+// counts to those we have.
+func scanFeedCounts(ctx context.Context, db Querier, query string,
+	args []interface{}, counts map[int64]int) error {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("unable to query unread counts: %s", err)
+	}
+
+	for rows.Next() {
+		var feedID int64
+		var count int
+		if err := rows.Scan(&feedID, &count); err != nil {
+			_ = rows.Close()
+			return fmt.Errorf("failed to scan row: %s", err)
+		}
+		counts[feedID] += count
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failure fetching rows: %s", err)
+	}
+
+	return nil
+}
+
+// addUnreadItem counts a new item as unread for every user.
+func addUnreadItem(ctx context.Context, db Querier, feedID int64,
+	pubDate time.Time) error {
+	rows, err := db.QueryContext(ctx, `SELECT id FROM rss_user`)
+	if err != nil {
+		return fmt.Errorf("unable to query users: %s", err)
+	}
+
+	counts := map[unreadCountKey]int{}
+	for rows.Next() {
+		var userID int
+		if err := rows.Scan(&userID); err != nil {
+			_ = rows.Close()
+			return fmt.Errorf("failed to scan row: %s", err)
+		}
+		counts[unreadCountKey{userID: userID, feedID: feedID,
+			day: publicationDay(pubDate)}] = 1
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failure fetching rows: %s", err)
+	}
+
+	return addUnreadCounts(ctx, db, counts)
+}
+
+// adjustUnreadCounts updates the user's unread counts after setting the items
+// to the state. oldStates holds the states they had before.
+func adjustUnreadCounts(ctx context.Context, db Querier, ids []int64,
+	userID int, oldStates map[int64]ReadState, state ReadState) error {
+	delta := -1
+	if state == Unread {
+		delta = 1
+	}
+
+	placeholders := []string{}
+	var params []interface{}
+	for _, id := range ids {
+		if (oldStates[id] == Unread) == (state == Unread) {
+			continue
+		}
+		params = append(params, id)
+		placeholders = append(placeholders, fmt.Sprintf("$%d", len(params)))
+	}
+
+	if len(params) == 0 {
+		return nil
+	}
+
+	query := `
+SELECT rss_feed_id, publication_date FROM rss_item
+WHERE id IN (` + strings.Join(placeholders, ", ") + `)
+`
+
+	rows, err := db.QueryContext(ctx, query, params...)
+	if err != nil {
+		return fmt.Errorf("unable to query items: %s", err)
+	}
+
+	counts := map[unreadCountKey]int{}
+	for rows.Next() {
+		var feedID int64
+		var pubDate time.Time
+		if err := rows.Scan(&feedID, &pubDate); err != nil {
+			_ = rows.Close()
+			return fmt.Errorf("failed to scan row: %s", err)
+		}
+		counts[unreadCountKey{userID: userID, feedID: feedID,
+			day: publicationDay(pubDate)}] += delta
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failure fetching rows: %s", err)
+	}
+
+	return addUnreadCounts(ctx, db, counts)
+}
+
+// RebuildUnreadCounts counts the user's unread items again from scratch.
+//
+// We do this for new users, who have every item unread. Counts should not
+// otherwise need rebuilding, but this repairs them if they're ever wrong.
+func RebuildUnreadCounts(ctx context.Context, db Querier, userID int) error {
+	if _, err := db.ExecContext(ctx,
+		`DELETE FROM rss_unread_count WHERE user_id = $1`, userID); err != nil {
+		return fmt.Errorf("unable to delete unread counts: %s", err)
+	}
+
+	query := `
+SELECT ri.rss_feed_id, ri.publication_date
+FROM rss_item ri
+LEFT JOIN rss_item_state ris ON ris.item_id = ri.id AND ris.user_id = $1
+WHERE COALESCE(ris.state, 'unread') = 'unread'
+`
+
+	rows, err := db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return fmt.Errorf("unable to query unread items: %s", err)
+	}
+
+	counts := map[unreadCountKey]int{}
+	for rows.Next() {
+		var feedID int64
+		var pubDate time.Time
+		if err := rows.Scan(&feedID, &pubDate); err != nil {
+			_ = rows.Close()
+			return fmt.Errorf("failed to scan row: %s", err)
+		}
+		counts[unreadCountKey{userID: userID, feedID: feedID,
+			day: publicationDay(pubDate)}]++
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failure fetching rows: %s", err)
+	}
+
+	return addUnreadCounts(ctx, db, counts)
+}
+
+// addUnreadCounts adds to the unread counts.
+//
+// We insert the counts as VALUES rather than with INSERT ... SELECT as
+// Postgres can only tell the types of the parameters in VALUES.
+func addUnreadCounts(ctx context.Context, db Querier,
+	counts map[unreadCountKey]int) error {
+	var values []string
+	var params []interface{}
+
+	flush := func() error {
+		if len(values) == 0 {
+			return nil
+		}
+
+		query := `
+INSERT INTO rss_unread_count
+(user_id, feed_id, publication_day, unread_count)
+VALUES ` + strings.Join(values, ", ") + `
+ON CONFLICT (user_id, feed_id, publication_day) DO UPDATE
+SET unread_count = rss_unread_count.unread_count + EXCLUDED.unread_count
+`
+		if _, err := db.ExecContext(ctx, query, params...); err != nil {
+			return fmt.Errorf("unable to update unread counts: %s", err)
+		}
+
+		values, params = nil, nil
+		return nil
+	}
+
+	for key, count := range counts {
+		n := len(params)
+		values = append(values, fmt.Sprintf("($%d, $%d, $%d, $%d)", n+1, n+2,
+			n+3, n+4))
+		params = append(params, key.userID, key.feedID, key.day, count)
+
+		if len(values) == maxReadStateBatch {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+
+	return flush()
+}
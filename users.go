@@ -0,0 +1,267 @@
+package gorse
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// MinPasswordLength is the shortest password we accept.
+const MinPasswordLength = 8
+
+// ErrInvalidCredentials means the email and password don't match a user.
+//
+// We don't say which was wrong so as not to reveal who has an account.
+var ErrInvalidCredentials = errors.New("invalid email or password")
+
+// dummyHash is a hash we compare passwords against when there is no user to
+// compare to. This is so that logging in takes as long whether or not the user
+// exists.
+var dummyHash = []byte(
+	"$2a$10$3WkGTexTLHH5J22JHCcyyeNBkXhP6lrfzgW1q.RxMGr4gVK7PCDyu")
+
+// GetUser retrieves a user by ID.
+func GetUser(ctx context.Context, db Querier, id int) (*User, error) {
+	query := `
+SELECT id, email, admin, locale, relative_dates, share_email, kindle_email,
+COALESCE(share_token, ''), compact_list
+FROM rss_user
+WHERE id = $1
+`
+
+	user := &User{}
+	if err := db.QueryRowContext(ctx, query, id).Scan(&user.ID,
+		&user.Email, &user.Admin, &user.Locale, &user.RelativeDates,
+		&user.ShareEmail, &user.KindleEmail, &user.ShareToken,
+		&user.CompactList); err != nil {
+		return nil, fmt.Errorf("unable to look up user: %d: %s", id, err)
+	}
+
+	return user, nil
+}
+
+// CreateUser creates a user with the password.
+func CreateUser(ctx context.Context, db Querier, email, password string,
+	admin bool) (*User, error) {
+	email, err := normalizeEmail(email)
+	if err != nil {
+		return nil, err
+	}
+
+	hash, err := hashPassword(password)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+INSERT INTO rss_user (email, password_hash, admin)
+VALUES ($1, $2, $3)
+RETURNING id
+`
+
+	user := &User{Email: email, Admin: admin}
+	if err := db.QueryRowContext(ctx, query, email, hash, admin).Scan(
+		&user.ID); err != nil {
+		return nil, fmt.Errorf("unable to add user: %s: %s", email, err)
+	}
+
+	if err := RebuildUnreadCounts(ctx, db, user.ID); err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// AuthenticateUser checks the email and password belong to a user. It returns
+// the user if so and ErrInvalidCredentials if not.
+func AuthenticateUser(ctx context.Context, db Querier, email,
+	password string) (*User, error) {
+	query := `
+SELECT id, email, admin, locale, relative_dates, share_email, kindle_email,
+COALESCE(share_token, ''), compact_list, password_hash
+FROM rss_user
+WHERE email = $1
+`
+
+	user := &User{}
+	var hash sql.NullString
+	err := db.QueryRowContext(ctx, query,
+		strings.ToLower(strings.TrimSpace(email))).Scan(&user.ID, &user.Email,
+		&user.Admin, &user.Locale, &user.RelativeDates, &user.ShareEmail,
+		&user.KindleEmail, &user.ShareToken, &user.CompactList, &hash)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, fmt.Errorf("unable to look up user: %s: %s", email, err)
+	}
+
+	if err == sql.ErrNoRows || !hash.Valid {
+		_ = bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+		return nil, ErrInvalidCredentials
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(hash.String),
+		[]byte(password)); err != nil {
+		return nil, ErrInvalidCredentials
+	}
+
+	return user, nil
+}
+
+// UpdatePassword sets the user's password. It returns ErrNotFound if there is
+// no such user.
+func UpdatePassword(ctx context.Context, db Querier, userID int,
+	password string) error {
+	hash, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	query := `UPDATE rss_user SET password_hash = $1 WHERE id = $2`
+
+	result, err := db.ExecContext(ctx, query, hash, userID)
+	if err != nil {
+		return fmt.Errorf("unable to update password for user %d: %s", userID,
+			err)
+	}
+
+	return requireOneRow(result)
+}
+
+// UpdateLocale sets the user's locale and whether they see relative dates. It
+// returns ErrNotFound if there is no such user.
+//
+// We don't check the locale is one we know. That's up to the interface.
+func UpdateLocale(ctx context.Context, db Querier, userID int, locale string,
+	relativeDates bool) error {
+	query := `UPDATE rss_user SET locale = $1, relative_dates = $2 WHERE id = $3`
+
+	result, err := db.ExecContext(ctx, query, locale, relativeDates, userID)
+	if err != nil {
+		return fmt.Errorf("unable to update locale for user %d: %s", userID, err)
+	}
+
+	return requireOneRow(result)
+}
+
+// UpdateShareEmail sets where the user emails items they share unless they
+// say otherwise. Blank means nowhere. It returns ErrNotFound if there is no
+// such user.
+func UpdateShareEmail(ctx context.Context, db Querier, userID int,
+	email string) error {
+	if email != "" {
+		var err error
+		if email, err = normalizeEmail(email); err != nil {
+			return err
+		}
+	}
+
+	query := `UPDATE rss_user SET share_email = $1 WHERE id = $2`
+
+	result, err := db.ExecContext(ctx, query, email, userID)
+	if err != nil {
+		return fmt.Errorf("unable to update share email for user %d: %s", userID,
+			err)
+	}
+
+	return requireOneRow(result)
+}
+
+// UpdateKindleEmail sets where we email books of the user's items to read
+// later, such as their Kindle's address. Blank means nowhere. It returns
+// ErrNotFound if there is no such user.
+func UpdateKindleEmail(ctx context.Context, db Querier, userID int,
+	email string) error {
+	if email != "" {
+		var err error
+		if email, err = normalizeEmail(email); err != nil {
+			return err
+		}
+	}
+
+	query := `UPDATE rss_user SET kindle_email = $1 WHERE id = $2`
+
+	result, err := db.ExecContext(ctx, query, email, userID)
+	if err != nil {
+		return fmt.Errorf("unable to update kindle email for user %d: %s", userID,
+			err)
+	}
+
+	return requireOneRow(result)
+}
+
+// UpdateCompactList sets whether the user's lists show items as one line each
+// rather than expanded. It returns ErrNotFound if there is no such user.
+func UpdateCompactList(ctx context.Context, db Querier, userID int,
+	compact bool) error {
+	query := `UPDATE rss_user SET compact_list = $1 WHERE id = $2`
+
+	result, err := db.ExecContext(ctx, query, compact, userID)
+	if err != nil {
+		return fmt.Errorf("unable to update list density for user %d: %s",
+			userID, err)
+	}
+
+	return requireOneRow(result)
+}
+
+// ListUsers retrieves all users ordered by email.
+func ListUsers(ctx context.Context, db Querier) ([]User, error) {
+	query := `
+SELECT id, email, admin, locale, relative_dates, share_email, kindle_email,
+COALESCE(share_token, ''), compact_list
+FROM rss_user
+ORDER BY email
+`
+
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("unable to query users: %s", err)
+	}
+
+	var users []User
+	for rows.Next() {
+		var user User
+		if err := rows.Scan(&user.ID, &user.Email, &user.Admin, &user.Locale,
+			&user.RelativeDates, &user.ShareEmail, &user.KindleEmail,
+			&user.ShareToken, &user.CompactList); err != nil {
+			_ = rows.Close()
+			return nil, fmt.Errorf("failed to scan row: %s", err)
+		}
+		users = append(users, user)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failure fetching rows: %s", err)
+	}
+
+	return users, nil
+}
+
+func normalizeEmail(email string) (string, error) {
+	email = strings.ToLower(strings.TrimSpace(email))
+
+	at := strings.Index(email, "@")
+	if at < 1 || at == len(email)-1 || strings.ContainsAny(email, " \t\r\n") {
+		return "", fmt.Errorf("invalid email address: %s", email)
+	}
+
+	return email, nil
+}
+
+func hashPassword(password string) (string, error) {
+	if len(password) < MinPasswordLength {
+		return "", fmt.Errorf("password must be at least %d characters",
+			MinPasswordLength)
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password),
+		bcrypt.DefaultCost)
+	if err != nil {
+		return "", fmt.Errorf("unable to hash password: %s", err)
+	}
+
+	return string(hash), nil
+}
@@ -0,0 +1,115 @@
+package gorse
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestAuthenticateUser(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("correct horse"),
+		bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("unable to hash password: %s", err)
+	}
+
+	columns := []string{"id", "email", "admin", "locale", "relative_dates",
+		"share_email", "kindle_email", "share_token", "compact_list",
+		"password_hash"}
+
+	tests := []struct {
+		name     string
+		rows     *sqlmock.Rows
+		password string
+		wantErr  error
+	}{
+		{
+			name: "correct password",
+			rows: sqlmock.NewRows(columns).
+				AddRow(3, "me@example.com", true, "", false, "", "", "", false,
+					string(hash)),
+			password: "correct horse",
+		},
+		{
+			name: "wrong password",
+			rows: sqlmock.NewRows(columns).
+				AddRow(3, "me@example.com", true, "", false, "", "", "", false,
+					string(hash)),
+			password: "battery staple",
+			wantErr:  ErrInvalidCredentials,
+		},
+		{
+			name: "no password set",
+			rows: sqlmock.NewRows(columns).
+				AddRow(3, "me@example.com", true, "", false, "", "", "", false,
+					nil),
+			password: "correct horse",
+			wantErr:  ErrInvalidCredentials,
+		},
+		{
+			name:     "no such user",
+			password: "correct horse",
+			wantErr:  ErrInvalidCredentials,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("unable to open mock db: %s", err)
+			}
+			defer db.Close()
+
+			// We look up the email in lowercase.
+			expect := mock.ExpectQuery(`SELECT id, email, admin, locale, ` +
+				`relative_dates, share_email, kindle_email, ` +
+				`COALESCE\(share_token, ''\), compact_list, password_hash`).
+				WithArgs("me@example.com")
+			if test.rows != nil {
+				expect.WillReturnRows(test.rows)
+			} else {
+				expect.WillReturnError(sql.ErrNoRows)
+			}
+
+			user, err := AuthenticateUser(context.Background(), db,
+				" Me@Example.com", test.password)
+			if err != test.wantErr {
+				t.Fatalf("AuthenticateUser() = error %v, wanted %v", err,
+					test.wantErr)
+			}
+			if err == nil && (user.ID != 3 || !user.Admin) {
+				t.Errorf("AuthenticateUser() = %+v", user)
+			}
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestCreateUserValidates(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("unable to open mock db: %s", err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+
+	if _, err := CreateUser(ctx, db, "nobody", "password", false); err == nil {
+		t.Error("CreateUser() with invalid email succeeded")
+	}
+	if _, err := CreateUser(ctx, db, "me@example.com", "short",
+		false); err == nil {
+		t.Error("CreateUser() with short password succeeded")
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}